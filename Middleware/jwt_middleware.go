@@ -2,7 +2,11 @@ package middlewares
 
 import (
     "net/http"
+    "strconv"
     "strings"
+    "github.com/WolfSlayer04/logica_tiendaenlina/bitacora"
+    "github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+    "github.com/WolfSlayer04/logica_tiendaenlina/errores"
     "github.com/golang-jwt/jwt/v5"
     "context"
     "fmt"
@@ -15,6 +19,8 @@ type Claims struct {
     Tipo     string            `json:"tipo"` // 'C' o 'A'
     Correo   string            `json:"correo"`
     Permisos map[string]bool   `json:"permisos"` // ← NUEVO
+    Empresa  int               `json:"empresa,omitempty"` // 0 = admin de todo el grupo
+    Tienda   int               `json:"tienda,omitempty"`  // tienda activa del cliente; 0 = la que tenga marcada
     jwt.RegisteredClaims
 }
 
@@ -27,13 +33,19 @@ const (
     ContextCorreoKey     contextKey = "correo"
     ContextSoloLecturaKey contextKey = "solo_lectura"
     ContextAccesoTotalKey contextKey = "acceso_total"
+    ContextTiendaKey      contextKey = "tienda"
+    ContextEmpresaTokenKey contextKey = "empresa_token"
 )
 
+// HeaderTienda elige, sólo para la petición, la tienda del cliente con la
+// que se trabaja en lugar de la del token.
+const HeaderTienda = "X-Tienda"
+
 // Middleware JWT para rutas protegidas
 func JWTAuthMiddleware(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
         w.Header().Set("Access-Control-Allow-Origin", "*")
-        w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept, Authorization, X-Tipo-Usuario")
+        w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept, Authorization, X-Tipo-Usuario, X-Empresa, X-Tienda")
         w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
         if r.Method == http.MethodOptions {
             w.WriteHeader(http.StatusOK)
@@ -42,7 +54,7 @@ func JWTAuthMiddleware(next http.Handler) http.Handler {
 
         authHeader := r.Header.Get("Authorization")
         if !strings.HasPrefix(authHeader, "Bearer ") {
-            http.Error(w, "Token faltante o inválido", http.StatusUnauthorized)
+            errores.Escribir(w, r, errores.Nuevo(errores.NoAutenticado))
             return
         }
         tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
@@ -52,15 +64,34 @@ func JWTAuthMiddleware(next http.Handler) http.Handler {
             return jwtKey, nil
         })
         if err != nil || !token.Valid {
-            http.Error(w, "Token inválido o expirado", http.StatusUnauthorized)
+            errores.Escribir(w, r, errores.Nuevo(errores.TokenInvalido).Con("Token inválido o expirado", err))
             return
         }
 
         if claims.Tipo != "C" && claims.Tipo != "A" {
-            http.Error(w, "Tipo de usuario no permitido", http.StatusForbidden)
+            errores.Escribir(w, r, errores.Nuevo(errores.SinPermiso).Con("Tipo de usuario no permitido: "+claims.Tipo, nil))
+            return
+        }
+        // Sólo un admin puede ser de todo el grupo; un cliente siempre es de una empresa
+        if claims.Empresa == 0 && claims.Tipo != "A" {
+            errores.Escribir(w, r, errores.Nuevo(errores.TokenInvalido).Con("Token de cliente sin empresa", nil))
             return
         }
 
+        // La sesión sólo vale en su empresa; si la petición no la determinó, se
+        // usa la del token
+        ctx := r.Context()
+        if claims.Empresa != 0 {
+            actual := empresas.Desde(ctx)
+            if actual != 0 && actual != claims.Empresa {
+                errores.Escribir(w, r, errores.Nuevo(errores.EmpresaNoPermitida).Con(fmt.Sprintf("Token de la empresa %d en la empresa %d", claims.Empresa, actual), nil))
+                return
+            }
+            if actual == 0 {
+                ctx = empresas.Con(ctx, claims.Empresa)
+            }
+        }
+
         // Extraer flags de permisos seguros del JWT
         soloLectura := false
         accesoTotal := false
@@ -73,11 +104,26 @@ func JWTAuthMiddleware(next http.Handler) http.Handler {
             }
         }
 
-        ctx := context.WithValue(r.Context(), ContextUserIDKey, claims.ID)
+        // La tienda del encabezado manda sobre la del token; los handlers
+        // revisan que sea del usuario
+        tienda := claims.Tienda
+        if valor := r.Header.Get(HeaderTienda); valor != "" {
+            id, err := strconv.Atoi(valor)
+            if err != nil || id <= 0 {
+                errores.Escribir(w, r, errores.Validacion(errores.Invalido(HeaderTienda)))
+                return
+            }
+            tienda = id
+        }
+
+        bitacora.EstablecerUsuario(ctx, claims.ID, claims.Tipo)
+        ctx = context.WithValue(ctx, ContextUserIDKey, claims.ID)
         ctx = context.WithValue(ctx, ContextTipoKey, claims.Tipo)
         ctx = context.WithValue(ctx, ContextCorreoKey, claims.Correo)
         ctx = context.WithValue(ctx, ContextSoloLecturaKey, soloLectura)
         ctx = context.WithValue(ctx, ContextAccesoTotalKey, accesoTotal)
+        ctx = context.WithValue(ctx, ContextTiendaKey, tienda)
+        ctx = context.WithValue(ctx, ContextEmpresaTokenKey, claims.Empresa)
         next.ServeHTTP(w, r.WithContext(ctx))
     })
 }
@@ -102,6 +148,21 @@ func GetUserFromContext(r *http.Request) (id int, tipo string, correo string, so
     return
 }
 
+// GetTiendaFromContext regresa la tienda que eligió el cliente con X-Tienda o
+// en el token; 0 si no eligió ninguna.
+func GetTiendaFromContext(r *http.Request) int {
+    tienda, _ := r.Context().Value(ContextTiendaKey).(int)
+    return tienda
+}
+
+// EsAdminDelGrupo dice si el token es de un admin sin empresa (de todo el
+// grupo); sin token autenticado es false.
+func EsAdminDelGrupo(r *http.Request) bool {
+    empresa, ok := r.Context().Value(ContextEmpresaTokenKey).(int)
+    tipo, _ := r.Context().Value(ContextTipoKey).(string)
+    return ok && empresa == 0 && tipo == "A"
+}
+
 // Ejemplo de uso en tu handler
 func RutaProtegidaHandler(w http.ResponseWriter, r *http.Request) {
     id, tipo, correo, soloLectura, accesoTotal := GetUserFromContext(r)
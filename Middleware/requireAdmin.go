@@ -2,6 +2,7 @@ package middlewares
 
 import (
     "net/http"
+    "github.com/WolfSlayer04/logica_tiendaenlina/errores"
 )
 
 
@@ -24,7 +25,7 @@ func RequireAdminPermisos(next http.Handler) http.Handler {
 
         // Solo admins pueden pasar
         if !tipoOk || tipoUsuario != "A" {
-            http.Error(w, "No tienes permisos suficientes", http.StatusForbidden)
+            errores.Escribir(w, r, errores.Nuevo(errores.SinPermiso))
             return
         }
 
@@ -40,11 +41,11 @@ func RequireAdminPermisos(next http.Handler) http.Handler {
                 next.ServeHTTP(w, r)
                 return
             }
-            http.Error(w, "Tu usuario es solo lectura, no puedes editar.", http.StatusForbidden)
+            errores.Escribir(w, r, errores.Nuevo(errores.SoloLectura))
             return
         }
 
         // Si no tiene ninguno de los dos flags, bloquear (por seguridad)
-        http.Error(w, "No tienes permisos suficientes (falta accesoTotal o soloLectura)", http.StatusForbidden)
+        errores.Escribir(w, r, errores.Nuevo(errores.SinPermiso).Con("Falta accesoTotal o soloLectura", nil))
     })
 }
\ No newline at end of file
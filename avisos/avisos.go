@@ -0,0 +1,79 @@
+// Package avisos manda mensajes de texto cortos a los clientes, como el
+// código con el que un cliente del ERP liga su cuenta en línea.
+//
+// Con AVISOS_SMS_URL los mensajes se publican como JSON
+// ({"telefono": ..., "mensaje": ...}) en la pasarela de SMS de esa URL, con
+// AVISOS_SMS_TOKEN como token Bearer si se define. Sin ella sólo se escriben
+// en el log, para desarrollo.
+package avisos
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Enviador manda un mensaje de texto a un teléfono.
+type Enviador interface {
+	Enviar(ctx context.Context, telefono, mensaje string) error
+}
+
+// DesdeEnv regresa la pasarela de AVISOS_SMS_URL o, si no hay, Bitacora.
+func DesdeEnv() Enviador {
+	url := os.Getenv("AVISOS_SMS_URL")
+	if url == "" {
+		slog.Warn("AVISOS_SMS_URL sin definir; los mensajes a clientes sólo se escriben en el log")
+		return Bitacora{}
+	}
+	return Pasarela{URL: url, Token: os.Getenv("AVISOS_SMS_TOKEN")}
+}
+
+// Bitacora no manda nada: escribe el mensaje en el log.
+type Bitacora struct{}
+
+func (Bitacora) Enviar(ctx context.Context, telefono, mensaje string) error {
+	slog.InfoContext(ctx, "aviso sin enviar", "telefono", telefono, "mensaje", mensaje)
+	return nil
+}
+
+// Pasarela publica cada mensaje en una pasarela de SMS por HTTP.
+type Pasarela struct {
+	URL   string
+	Token string
+	// Cliente es el http.Client con el que se publica; nil es uno con 10 s
+	// de timeout.
+	Cliente *http.Client
+}
+
+func (p Pasarela) Enviar(ctx context.Context, telefono, mensaje string) error {
+	cuerpo, err := json.Marshal(map[string]string{"telefono": telefono, "mensaje": mensaje})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(cuerpo))
+	if err != nil {
+		return fmt.Errorf("armando aviso: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.Token)
+	}
+	cliente := p.Cliente
+	if cliente == nil {
+		cliente = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := cliente.Do(req)
+	if err != nil {
+		return fmt.Errorf("enviando aviso: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("la pasarela de SMS respondió %d", resp.StatusCode)
+	}
+	return nil
+}
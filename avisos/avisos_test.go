@@ -0,0 +1,40 @@
+package avisos
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPasarela(t *testing.T) {
+	var recibido map[string]string
+	var autorizacion string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		autorizacion = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&recibido); err != nil {
+			t.Errorf("cuerpo no es JSON: %v", err)
+		}
+		if r.URL.Path == "/falla" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	p := Pasarela{URL: srv.URL + "/sms", Token: "secreto"}
+	if err := p.Enviar(context.Background(), "9991234567", "Tu código es 123456"); err != nil {
+		t.Fatal(err)
+	}
+	if recibido["telefono"] != "9991234567" || recibido["mensaje"] != "Tu código es 123456" {
+		t.Errorf("publicado = %v", recibido)
+	}
+	if autorizacion != "Bearer secreto" {
+		t.Errorf("Authorization = %q", autorizacion)
+	}
+
+	p.URL = srv.URL + "/falla"
+	if err := p.Enviar(context.Background(), "9991234567", "x"); err == nil {
+		t.Error("una respuesta 502 no regresó error")
+	}
+}
@@ -0,0 +1,255 @@
+// Package bitacora concentra el logging estructurado (log/slog en JSON), el
+// identificador de petición X-Request-ID y la línea de acceso por petición.
+package bitacora
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// HeaderRequestID es el encabezado que se recibe y se devuelve con el ID de petición.
+const HeaderRequestID = "X-Request-ID"
+
+type ctxKey int
+
+const (
+	ctxLogger ctxKey = iota
+	ctxRequestID
+	ctxAcceso
+)
+
+// Nuevo crea un logger JSON. El nivel se toma de LOG_LEVEL (debug, info, warn, error).
+func Nuevo(out io.Writer) *slog.Logger {
+	if out == nil {
+		out = os.Stdout
+	}
+	return slog.New(slog.NewJSONHandler(out, &slog.HandlerOptions{Level: nivelDesdeEnv()}))
+}
+
+func nivelDesdeEnv() slog.Level {
+	switch strings.ToLower(os.Getenv("LOG_LEVEL")) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// ConLogger guarda el logger en el contexto.
+func ConLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxLogger, l)
+}
+
+// Desde regresa el logger del contexto, o slog.Default() si no hay uno.
+func Desde(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(ctxLogger).(*slog.Logger); ok && l != nil {
+			return l
+		}
+	}
+	return slog.Default()
+}
+
+// ConRequestID guarda el ID en el contexto y agrega el atributo request_id al
+// logger del contexto.
+func ConRequestID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, ctxRequestID, id)
+	return ConLogger(ctx, Desde(ctx).With("request_id", id))
+}
+
+// RequestID regresa el ID de petición del contexto ("" si no hay).
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(ctxRequestID).(string)
+	return id
+}
+
+// NuevoRequestID genera un identificador aleatorio de 16 bytes en hexadecimal.
+func NuevoRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strings.ReplaceAll(time.Now().UTC().Format("20060102150405.000000000"), ".", "")
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestIDValido acepta IDs de clientes o proxies sólo si son cortos y con
+// caracteres seguros para no contaminar los logs.
+func requestIDValido(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ---------------------------
+// DATOS DE ACCESO
+// ---------------------------
+
+// acceso lo llenan los middlewares internos (p. ej. JWT) para que la línea de
+// acceso incluya datos que se conocen después de entrar al handler.
+type acceso struct {
+	mu          sync.Mutex
+	idUsuario   int
+	tipoUsuario string
+	idEmpresa   int
+}
+
+// EstablecerUsuario registra el usuario autenticado para la línea de acceso.
+func EstablecerUsuario(ctx context.Context, id int, tipo string) {
+	if a, ok := ctx.Value(ctxAcceso).(*acceso); ok {
+		a.mu.Lock()
+		a.idUsuario = id
+		a.tipoUsuario = tipo
+		a.mu.Unlock()
+	}
+}
+
+// EstablecerEmpresa registra la empresa de la petición para la línea de acceso.
+func EstablecerEmpresa(ctx context.Context, id int) {
+	if a, ok := ctx.Value(ctxAcceso).(*acceso); ok {
+		a.mu.Lock()
+		a.idEmpresa = id
+		a.mu.Unlock()
+	}
+}
+
+// ---------------------------
+// MIDDLEWARE
+// ---------------------------
+
+type respuesta struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+	logger *slog.Logger
+}
+
+func (w *respuesta) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *respuesta) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+func (w *respuesta) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *respuesta) Logger() *slog.Logger {
+	return w.logger
+}
+
+// DesdeRespuesta regresa el logger de la petición a partir del ResponseWriter,
+// para las funciones auxiliares que sólo reciben w.
+func DesdeRespuesta(w http.ResponseWriter) *slog.Logger {
+	for w != nil {
+		if r, ok := w.(interface{ Logger() *slog.Logger }); ok {
+			return r.Logger()
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = u.Unwrap()
+	}
+	return slog.Default()
+}
+
+// Middleware asigna o propaga X-Request-ID, deja en el contexto un logger con
+// request_id y escribe una línea de acceso al terminar la petición. Debe
+// registrarse con Router.Use para conocer la plantilla de ruta.
+func Middleware(base *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			inicio := time.Now()
+			id := r.Header.Get(HeaderRequestID)
+			if !requestIDValido(id) {
+				id = NuevoRequestID()
+			}
+			w.Header().Set(HeaderRequestID, id)
+
+			logger := base.With("request_id", id)
+			// Con trazas activas (middleware de OpenTelemetry antes que éste)
+			// se agrega trace_id para saltar del log a la traza.
+			if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+				logger = logger.With("trace_id", sc.TraceID().String())
+			}
+			a := &acceso{}
+			ctx := context.WithValue(r.Context(), ctxRequestID, id)
+			ctx = context.WithValue(ctx, ctxAcceso, a)
+			ctx = ConLogger(ctx, logger)
+
+			rw := &respuesta{ResponseWriter: w, logger: logger}
+			next.ServeHTTP(rw, r.WithContext(ctx))
+
+			status := rw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			ruta := r.URL.Path
+			if route := mux.CurrentRoute(r); route != nil {
+				if tpl, err := route.GetPathTemplate(); err == nil {
+					ruta = tpl
+				}
+			}
+			attrs := []any{
+				"method", r.Method,
+				"route", ruta,
+				"path", r.URL.Path,
+				"status", status,
+				"latency_ms", float64(time.Since(inicio).Microseconds()) / 1000,
+				"bytes", rw.bytes,
+				"remote_addr", r.RemoteAddr,
+			}
+			a.mu.Lock()
+			if a.idUsuario != 0 {
+				attrs = append(attrs, "user_id", a.idUsuario, "user_type", a.tipoUsuario)
+			}
+			if a.idEmpresa != 0 {
+				attrs = append(attrs, "empresa_id", a.idEmpresa)
+			}
+			a.mu.Unlock()
+
+			nivel := slog.LevelInfo
+			if status >= 500 {
+				nivel = slog.LevelError
+			} else if status >= 400 {
+				nivel = slog.LevelWarn
+			}
+			logger.Log(r.Context(), nivel, "acceso http", attrs...)
+		})
+	}
+}
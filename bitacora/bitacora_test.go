@@ -0,0 +1,166 @@
+package bitacora
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// servir monta h en /tiendas/{id} con Middleware y regresa la respuesta y las
+// líneas del log decodificadas; la última es la de acceso.
+func servir(t *testing.T, h http.HandlerFunc, req *http.Request) (*httptest.ResponseRecorder, []map[string]any) {
+	t.Helper()
+	var log bytes.Buffer
+	r := mux.NewRouter()
+	r.Use(Middleware(slog.New(slog.NewJSONHandler(&log, nil))))
+	r.HandleFunc("/tiendas/{id}", h)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	var lineas []map[string]any
+	for _, l := range strings.Split(strings.TrimSpace(log.String()), "\n") {
+		var linea map[string]any
+		if err := json.Unmarshal([]byte(l), &linea); err != nil {
+			t.Fatalf("línea de log no es JSON: %v\n%s", err, l)
+		}
+		lineas = append(lineas, linea)
+	}
+	return rec, lineas
+}
+
+func TestMiddlewareLineaDeAcceso(t *testing.T) {
+	var idHandler string
+	rec, lineas := servir(t, func(w http.ResponseWriter, r *http.Request) {
+		idHandler = RequestID(r.Context())
+		Desde(r.Context()).Info("desde el contexto")
+		DesdeRespuesta(w).Info("desde la respuesta")
+		EstablecerUsuario(r.Context(), 7, "C")
+		EstablecerEmpresa(r.Context(), 3)
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("nada"))
+	}, httptest.NewRequest(http.MethodGet, "/tiendas/15", nil))
+
+	id := rec.Header().Get(HeaderRequestID)
+	if len(id) != 32 || id != idHandler {
+		t.Fatalf("X-Request-ID = %q, en el handler %q", id, idHandler)
+	}
+	if len(lineas) != 3 {
+		t.Fatalf("se esperaban 3 líneas de log, hay %d: %v", len(lineas), lineas)
+	}
+	// Los logs del handler llevan el mismo request_id que la respuesta
+	for _, l := range lineas[:2] {
+		if l["request_id"] != id {
+			t.Errorf("%v: request_id = %v, se esperaba %s", l["msg"], l["request_id"], id)
+		}
+	}
+
+	acceso := lineas[2]
+	esperado := map[string]any{
+		"msg":        "acceso http",
+		"level":      "WARN",
+		"request_id": id,
+		"method":     "GET",
+		"route":      "/tiendas/{id}",
+		"path":       "/tiendas/15",
+		"status":     float64(404),
+		"bytes":      float64(4),
+		"user_id":    float64(7),
+		"user_type":  "C",
+		"empresa_id": float64(3),
+	}
+	for k, v := range esperado {
+		if acceso[k] != v {
+			t.Errorf("%s = %v, se esperaba %v", k, acceso[k], v)
+		}
+	}
+	if _, ok := acceso["latency_ms"].(float64); !ok {
+		t.Errorf("latency_ms = %v", acceso["latency_ms"])
+	}
+}
+
+func TestMiddlewareSinSesion(t *testing.T) {
+	_, lineas := servir(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}, httptest.NewRequest(http.MethodGet, "/tiendas/1", nil))
+
+	acceso := lineas[len(lineas)-1]
+	if acceso["status"] != float64(200) || acceso["level"] != "INFO" {
+		t.Errorf("status = %v, level = %v", acceso["status"], acceso["level"])
+	}
+	for _, k := range []string{"user_id", "user_type", "empresa_id"} {
+		if _, ok := acceso[k]; ok {
+			t.Errorf("%s en una petición sin sesión: %v", k, acceso[k])
+		}
+	}
+}
+
+func TestMiddlewarePropagaRequestID(t *testing.T) {
+	casos := []struct {
+		nombre, recibido string
+		propaga          bool
+	}{
+		{"valido", "lb-7f3a:01.2_x", true},
+		{"vacio", "", false},
+		{"con espacios", "abc def", false},
+		{"salto de linea", "abc\n{\"level\":\"ERROR\"}", false},
+		{"muy largo", strings.Repeat("a", 129), false},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/tiendas/1", nil)
+			if c.recibido != "" {
+				req.Header.Set(HeaderRequestID, c.recibido)
+			}
+			var idHandler string
+			rec, lineas := servir(t, func(w http.ResponseWriter, r *http.Request) {
+				idHandler = RequestID(r.Context())
+			}, req)
+
+			id := rec.Header().Get(HeaderRequestID)
+			if c.propaga && id != c.recibido {
+				t.Errorf("X-Request-ID = %q, se esperaba %q", id, c.recibido)
+			}
+			if !c.propaga && (id == c.recibido || len(id) != 32) {
+				t.Errorf("X-Request-ID = %q, se esperaba uno nuevo", id)
+			}
+			if idHandler != id || lineas[len(lineas)-1]["request_id"] != id {
+				t.Errorf("handler = %q, log = %v, respuesta = %q", idHandler, lineas[len(lineas)-1]["request_id"], id)
+			}
+		})
+	}
+}
+
+func TestConRequestID(t *testing.T) {
+	var log bytes.Buffer
+	ctx := ConLogger(context.Background(), slog.New(slog.NewJSONHandler(&log, nil)))
+	ctx = ConRequestID(ctx, "sync-42")
+
+	if RequestID(ctx) != "sync-42" {
+		t.Errorf("RequestID = %q", RequestID(ctx))
+	}
+	Desde(ctx).Info("pedido sincronizado")
+	var linea map[string]any
+	if err := json.Unmarshal(log.Bytes(), &linea); err != nil || linea["request_id"] != "sync-42" {
+		t.Errorf("línea = %s (%v)", log.String(), err)
+	}
+}
+
+func TestEstablecerFueraDelMiddleware(t *testing.T) {
+	// Sin Middleware no hay línea de acceso que llenar; no debe fallar
+	EstablecerUsuario(context.Background(), 1, "A")
+	EstablecerEmpresa(context.Background(), 1)
+	if RequestID(context.Background()) != "" {
+		t.Error("RequestID sin Middleware no es vacío")
+	}
+	if Desde(context.Background()) != slog.Default() {
+		t.Error("Desde sin logger no regresa slog.Default()")
+	}
+}
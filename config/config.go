@@ -2,7 +2,7 @@ package config
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"strconv"
 	"strings"
@@ -27,7 +27,7 @@ var Config Configuration
 func LoadConfig() error {
 	// Intentar cargar el archivo .env
 	if err := loadEnvFile(".env"); err != nil {
-		log.Printf("Advertencia: %v", err)
+		slog.Warn("no se pudo cargar .env", "error", err)
 	}
 
 	var missingVars []string
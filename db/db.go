@@ -1,14 +1,21 @@
 package db
 
 import (
+    "context"
     "database/sql"
+    "database/sql/driver"
     "fmt"
+    "log/slog"
     "os"
     "strconv"
     "strings"
     "sync"
 
+    "github.com/XSAM/otelsql"
     _ "github.com/go-sql-driver/mysql"
+    "go.opentelemetry.io/otel/attribute"
+    semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+    "go.opentelemetry.io/otel/trace"
 )
 
 type DBConfig struct {
@@ -170,7 +177,7 @@ func ConnectDB(configPath string) (*DBConnection, error) {
         cfg.LocalDB.Port,
         cfg.LocalDB.DBName)
 
-    localDB, err := sql.Open("mysql", localDsn)
+    localDB, err := abrirMySQL("local", localDsn)
     if err != nil {
         return nil, fmt.Errorf("error en conexión local: %v", err)
     }
@@ -188,7 +195,7 @@ func ConnectDB(configPath string) (*DBConnection, error) {
         cfg.RemoteDB.Port,
         cfg.RemoteDB.DBName)
 
-    remoteDB, err := sql.Open("mysql", remoteDsn)
+    remoteDB, err := abrirMySQL("remote", remoteDsn)
     if err != nil {
         localDB.Close()
         return nil, fmt.Errorf("error en conexión remota: %v", err)
@@ -221,16 +228,37 @@ func GetDBConnection() (*DBConnection, error) {
     return dbConnInstance, err
 }
 
+// abrirMySQL abre el pool con el driver envuelto por otelsql: cada consulta
+// hecha con un contexto que ya trae un span (p. ej. r.Context()) genera un span
+// hijo con db.name=local|remote. Las consultas sin span padre no se trazan
+// para no llenar el exportador de trazas sueltas.
+func abrirMySQL(nombre, dsn string) (*sql.DB, error) {
+    return otelsql.Open("mysql", dsn,
+        otelsql.WithAttributes(
+            semconv.DBSystemMySQL,
+            attribute.String("db.name", nombre),
+        ),
+        otelsql.WithSpanOptions(otelsql.SpanOptions{
+            OmitConnResetSession: true,
+            OmitRows:             true,
+            DisableErrSkip:       true,
+            SpanFilter: func(ctx context.Context, _ otelsql.Method, _ string, _ []driver.NamedValue) bool {
+                return trace.SpanContextFromContext(ctx).IsValid()
+            },
+        }),
+    )
+}
+
 // Close cierra ambas conexiones a las bases de datos
 func (dbc *DBConnection) Close() {
     if dbc.Local != nil {
         if err := dbc.Local.Close(); err != nil {
-            fmt.Printf("Error al cerrar la conexión local: %v\n", err)
+            slog.Error("error al cerrar la conexión local", "error", err)
         }
     }
     if dbc.Remote != nil {
         if err := dbc.Remote.Close(); err != nil {
-            fmt.Printf("Error al cerrar la conexión remota: %v\n", err)
+            slog.Error("error al cerrar la conexión remota", "error", err)
         }
     }
 }
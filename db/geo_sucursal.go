@@ -9,6 +9,9 @@ import (
 // SeActivoEstaAlerta determina si una posición cae dentro de una geocerca (círculo, rectángulo, polígono) definida en adm_sucursales_ptos.
 // Recibe el singleton dbConn y la base ("local" o "remote").
 // Ahora retorna: (bool, distancia al centro, error)
+//
+// Deprecated: hace una consulta por sucursal; usar geocerca.Motor, que
+// tiene las geocercas en memoria.
 func SeActivoEstaAlerta(dbConn *DBConnection, base string, tipo_objeto string, idsucursal int, aviso string, radio float64, latitud float64, longitud float64) (bool, float64, error) {
 	var db *sql.DB
 	if base == "local" {
@@ -160,6 +163,9 @@ func distance(lat1, lon1, lat2, lon2 float64) float64 {
 }
 
 // BuscarSucursalPorUbicacionConCobertura busca primero cobertura y si no, asigna la más cercana
+//
+// Deprecated: usar Sucursales.PorUbicacion de repositorio, que asigna con
+// geocerca.Motor. Se conserva para comparar en BenchmarkIntegracionAsignarSucursal.
 func BuscarSucursalPorUbicacionConCobertura(dbConn *DBConnection, base string, idEmpresa int, lat, lng float64) (idsucursal int, nombreSucursal string, err error) {
 	rows, err := dbConn.Local.Query(`
         SELECT idsucursal, sucursal, tipo_objeto, radio
@@ -0,0 +1,61 @@
+// Package documentacion sirve la especificación OpenAPI 3 de la API
+// (openapi.json, mantenida a mano junto a setupRoutes) y una página de Swagger
+// UI que la consume. La prueba de main falla si se registra una ruta que no
+// aparece en la especificación o si ésta documenta una que ya no existe.
+package documentacion
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed openapi.json
+var especificacion []byte
+
+// Especificacion devuelve el documento OpenAPI tal como se sirve. No debe
+// modificarse el slice.
+func Especificacion() []byte {
+	return especificacion
+}
+
+// HandlerEspecificacion sirve /api/openapi.json.
+func HandlerEspecificacion() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(especificacion)
+	}
+}
+
+// Versión fija de swagger-ui-dist para que la página no cambie sola.
+const paginaUI = `<!DOCTYPE html>
+<html lang="es">
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <title>API de la tienda en línea</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5.17.14/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5.17.14/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.ui = SwaggerUIBundle({
+      url: "/api/openapi.json",
+      dom_id: "#swagger-ui",
+      deepLinking: true,
+      persistAuthorization: true
+    });
+  </script>
+</body>
+</html>
+`
+
+// HandlerUI sirve /api/docs, la documentación interactiva generada por
+// Swagger UI a partir de /api/openapi.json.
+func HandlerUI() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(paginaUI))
+	}
+}
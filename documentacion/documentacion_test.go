@@ -0,0 +1,181 @@
+package documentacion
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+)
+
+type operacion struct {
+	OperationID string `json:"operationId"`
+	Parameters  []struct {
+		Ref  string `json:"$ref"`
+		Name string `json:"name"`
+		In   string `json:"in"`
+	} `json:"parameters"`
+	Responses map[string]json.RawMessage `json:"responses"`
+}
+
+func leerEspecificacion(t *testing.T) (map[string]interface{}, map[string]map[string]operacion) {
+	t.Helper()
+	var doc map[string]interface{}
+	if err := json.Unmarshal(Especificacion(), &doc); err != nil {
+		t.Fatalf("openapi.json no es JSON válido: %v", err)
+	}
+	var rutas struct {
+		Paths map[string]map[string]operacion `json:"paths"`
+	}
+	if err := json.Unmarshal(Especificacion(), &rutas); err != nil {
+		t.Fatal(err)
+	}
+	return doc, rutas.Paths
+}
+
+func TestEspecificacionConsistente(t *testing.T) {
+	doc, paths := leerEspecificacion(t)
+	if v, _ := doc["openapi"].(string); !strings.HasPrefix(v, "3.") {
+		t.Fatalf("openapi = %q, se esperaba 3.x", v)
+	}
+
+	ids := map[string]string{}
+	plantilla := regexp.MustCompile(`\{([^}]+)\}`)
+	for ruta, ops := range paths {
+		for metodo, op := range ops {
+			nombre := strings.ToUpper(metodo) + " " + ruta
+			if op.OperationID == "" {
+				t.Errorf("%s: sin operationId", nombre)
+			} else if otra, ok := ids[op.OperationID]; ok {
+				t.Errorf("%s: operationId %q repetido en %s", nombre, op.OperationID, otra)
+			}
+			ids[op.OperationID] = nombre
+			if len(op.Responses) == 0 {
+				t.Errorf("%s: sin respuestas", nombre)
+			}
+
+			declarados := map[string]bool{}
+			for _, p := range op.Parameters {
+				if p.In == "path" {
+					declarados[p.Name] = true
+				}
+			}
+			for _, m := range plantilla.FindAllStringSubmatch(ruta, -1) {
+				if !declarados[m[1]] {
+					t.Errorf("%s: falta declarar el parámetro de ruta %q", nombre, m[1])
+				}
+				delete(declarados, m[1])
+			}
+			for p := range declarados {
+				t.Errorf("%s: parámetro de ruta %q que no está en la plantilla", nombre, p)
+			}
+		}
+	}
+}
+
+// Todas las $ref deben apuntar a un componente existente.
+func TestReferenciasResuelven(t *testing.T) {
+	doc, _ := leerEspecificacion(t)
+	componentes, _ := doc["components"].(map[string]interface{})
+
+	var revisar func(v interface{})
+	revisar = func(v interface{}) {
+		switch x := v.(type) {
+		case map[string]interface{}:
+			if ref, ok := x["$ref"].(string); ok {
+				partes := strings.Split(strings.TrimPrefix(ref, "#/components/"), "/")
+				grupo, _ := componentes[partes[0]].(map[string]interface{})
+				if len(partes) != 2 || grupo[partes[1]] == nil {
+					t.Errorf("$ref sin resolver: %s", ref)
+				}
+			}
+			for _, hijo := range x {
+				revisar(hijo)
+			}
+		case []interface{}:
+			for _, hijo := range x {
+				revisar(hijo)
+			}
+		}
+	}
+	revisar(doc)
+}
+
+// Los enums de códigos del esquema Error deben coincidir con el catálogo del
+// paquete errores.
+func TestCodigosDeError(t *testing.T) {
+	var doc struct {
+		Components struct {
+			Schemas struct {
+				Error struct {
+					Properties struct {
+						Error struct {
+							Properties struct {
+								Code struct {
+									Enum []string `json:"enum"`
+								} `json:"code"`
+							} `json:"properties"`
+						} `json:"error"`
+					} `json:"properties"`
+				} `json:"Error"`
+				CampoError struct {
+					Properties struct {
+						Code struct {
+							Enum []string `json:"enum"`
+						} `json:"code"`
+					} `json:"properties"`
+				} `json:"CampoError"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(Especificacion(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	var codigos, campos []string
+	for _, c := range errores.Codigos() {
+		codigos = append(codigos, string(c))
+	}
+	for _, c := range errores.CodigosCampo() {
+		campos = append(campos, string(c))
+	}
+	comparar := func(nombre string, spec, catalogo []string) {
+		spec = append([]string(nil), spec...)
+		sort.Strings(spec)
+		if strings.Join(spec, ",") != strings.Join(catalogo, ",") {
+			t.Errorf("%s: la especificación tiene %v y el catálogo %v", nombre, spec, catalogo)
+		}
+	}
+	comparar("Error.error.code", doc.Components.Schemas.Error.Properties.Error.Properties.Code.Enum, codigos)
+	comparar("CampoError.code", doc.Components.Schemas.CampoError.Properties.Code.Enum, campos)
+}
+
+func TestHandlers(t *testing.T) {
+	casos := []struct {
+		nombre   string
+		handler  http.HandlerFunc
+		tipo     string
+		contiene string
+	}{
+		{nombre: "especificación", handler: HandlerEspecificacion(), tipo: "application/json", contiene: `"openapi"`},
+		{nombre: "interfaz", handler: HandlerUI(), tipo: "text/html", contiene: "/api/openapi.json"},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c.handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d", rec.Code)
+			}
+			if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, c.tipo) {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			if !strings.Contains(rec.Body.String(), c.contiene) {
+				t.Errorf("el cuerpo no contiene %q", c.contiene)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// Package empresas resuelve a qué empresa del grupo va cada petición, para que
+// un mismo despliegue atienda las tiendas en línea de varias empresas.
+//
+// El orden es: el nombre de host (empresa_dominios), el encabezado X-Empresa,
+// que no puede contradecir al host, y, si sólo hay una empresa activa, ésa. Si
+// nada de eso la determina, el middleware JWT usa la empresa del token. Un
+// token de otra empresa se rechaza con EMPRESA_NO_PERMITIDA.
+package empresas
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/bitacora"
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+	"github.com/WolfSlayer04/logica_tiendaenlina/repositorio"
+	"github.com/gorilla/mux"
+)
+
+// Header es el encabezado con el que el cliente elige la empresa.
+const Header = "X-Empresa"
+
+type ctxKey struct{}
+
+// Con regresa ctx con la empresa de la petición.
+func Con(ctx context.Context, idEmpresa int) context.Context {
+	bitacora.EstablecerEmpresa(ctx, idEmpresa)
+	return context.WithValue(ctx, ctxKey{}, idEmpresa)
+}
+
+// Desde regresa la empresa de la petición, o 0 si no se resolvió.
+func Desde(ctx context.Context) int {
+	id, _ := ctx.Value(ctxKey{}).(int)
+	return id
+}
+
+// Middleware resuelve la empresa con el encabezado, el host o la única
+// empresa activa y la deja en el contexto. Un encabezado con una empresa
+// inexistente o inactiva responde EMPRESA_NO_ENCONTRADA; uno que contradice
+// al host, EMPRESA_NO_PERMITIDA.
+func Middleware(repo repositorio.EmpresaRepo) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			porDominio, err := repo.PorDominio(ctx, Host(r))
+			if err != nil && !errors.Is(err, repositorio.ErrNoEncontrado) {
+				errores.Escribir(w, r, errores.Interno("Error al resolver la empresa por dominio", err))
+				return
+			}
+
+			idEmpresa := porDominio
+			if valor := strings.TrimSpace(r.Header.Get(Header)); valor != "" {
+				id, err := strconv.Atoi(valor)
+				if err != nil || id <= 0 {
+					errores.Escribir(w, r, errores.Nuevo(errores.EmpresaNoEncontrada).Con("X-Empresa inválido: "+valor, err))
+					return
+				}
+				if err := repo.Activa(ctx, id); err != nil {
+					if errors.Is(err, repositorio.ErrNoEncontrado) {
+						errores.Escribir(w, r, errores.Nuevo(errores.EmpresaNoEncontrada).Con("X-Empresa sin empresa activa: "+valor, nil))
+					} else {
+						errores.Escribir(w, r, errores.Interno("Error al validar la empresa", err))
+					}
+					return
+				}
+				if porDominio != 0 && porDominio != id {
+					errores.Escribir(w, r, errores.Nuevo(errores.EmpresaNoPermitida).Con("X-Empresa no corresponde al dominio "+Host(r), nil))
+					return
+				}
+				idEmpresa = id
+			}
+
+			if idEmpresa == 0 {
+				idEmpresa, err = repo.Unica(ctx)
+				if err != nil && !errors.Is(err, repositorio.ErrNoEncontrado) {
+					errores.Escribir(w, r, errores.Interno("Error al buscar la empresa activa", err))
+					return
+				}
+			}
+
+			if idEmpresa != 0 {
+				ctx = Con(ctx, idEmpresa)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Host regresa el nombre de host de la petición en minúsculas, sin puerto.
+func Host(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// Requerida regresa la empresa de la petición o, si no se resolvió, escribe
+// EMPRESA_REQUERIDA y regresa false.
+func Requerida(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id := Desde(r.Context())
+	if id == 0 {
+		errores.Escribir(w, r, errores.Nuevo(errores.EmpresaRequerida))
+		return 0, false
+	}
+	return id, true
+}
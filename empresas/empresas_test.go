@@ -0,0 +1,97 @@
+package empresas
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+	"github.com/WolfSlayer04/logica_tiendaenlina/repositorio"
+)
+
+func TestMiddleware(t *testing.T) {
+	grupo := []repositorio.EmpresaMemoria{
+		{IDEmpresa: 1, Activa: true, Dominios: []string{"abarrotes.example.com"}},
+		{IDEmpresa: 2, Activa: true, Dominios: []string{"ferreteria.example.com"}},
+		{IDEmpresa: 3, Activa: false},
+	}
+	casos := []struct {
+		nombre   string
+		empresas []repositorio.EmpresaMemoria
+		host     string
+		header   string
+		falla    error
+		status   int
+		codigo   errores.Codigo
+		empresa  int
+	}{
+		{nombre: "por dominio", empresas: grupo, host: "abarrotes.example.com", status: http.StatusOK, empresa: 1},
+		{nombre: "dominio con puerto y mayúsculas", empresas: grupo, host: "Ferreteria.Example.com:8080", status: http.StatusOK, empresa: 2},
+		{nombre: "por encabezado", empresas: grupo, host: "api.example.com", header: "2", status: http.StatusOK, empresa: 2},
+		{nombre: "encabezado igual al dominio", empresas: grupo, host: "ferreteria.example.com", header: "2", status: http.StatusOK, empresa: 2},
+		{nombre: "encabezado contra el dominio", empresas: grupo, host: "abarrotes.example.com", header: "2", status: http.StatusForbidden, codigo: errores.EmpresaNoPermitida},
+		{nombre: "encabezado no numérico", empresas: grupo, host: "api.example.com", header: "dos", status: http.StatusNotFound, codigo: errores.EmpresaNoEncontrada},
+		{nombre: "encabezado de empresa inactiva", empresas: grupo, host: "api.example.com", header: "3", status: http.StatusNotFound, codigo: errores.EmpresaNoEncontrada},
+		{nombre: "encabezado de empresa inexistente", empresas: grupo, host: "api.example.com", header: "9", status: http.StatusNotFound, codigo: errores.EmpresaNoEncontrada},
+		{nombre: "una sola empresa activa", empresas: grupo[:1], host: "api.example.com", status: http.StatusOK, empresa: 1},
+		{nombre: "varias empresas sin indicar", empresas: grupo, host: "api.example.com", status: http.StatusOK, empresa: 0},
+		{nombre: "falla la base", empresas: grupo, host: "abarrotes.example.com", falla: errors.New("sin conexión"), status: http.StatusInternalServerError, codigo: errores.ErrorInterno},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			m := repositorio.NuevaMemoria()
+			m.Empresas = c.empresas
+			m.Falla = func(op string) error {
+				if op == "Empresas.PorDominio" {
+					return c.falla
+				}
+				return nil
+			}
+			h := Middleware(m.Repositorios().Empresas)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(strconv.Itoa(Desde(r.Context()))))
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/productos", nil)
+			req.Host = c.host
+			if c.header != "" {
+				req.Header.Set(Header, c.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != c.status {
+				t.Fatalf("status = %d, se esperaba %d (body %s)", rec.Code, c.status, rec.Body)
+			}
+			if c.status == http.StatusOK {
+				if got := rec.Body.String(); got != strconv.Itoa(c.empresa) {
+					t.Errorf("empresa = %s, se esperaba %d", got, c.empresa)
+				}
+				return
+			}
+			var resp errores.Respuesta
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("respuesta no es JSON: %v", err)
+			}
+			if resp.Error.Codigo != c.codigo {
+				t.Errorf("code = %s, se esperaba %s", resp.Error.Codigo, c.codigo)
+			}
+		})
+	}
+}
+
+func TestRequerida(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if _, ok := Requerida(rec, req); ok || rec.Code != http.StatusBadRequest {
+		t.Errorf("sin empresa: ok = %v, status = %d", ok, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	req = req.WithContext(Con(req.Context(), 7))
+	if id, ok := Requerida(rec, req); !ok || id != 7 {
+		t.Errorf("con empresa: id = %d, ok = %v", id, ok)
+	}
+}
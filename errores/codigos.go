@@ -0,0 +1,226 @@
+package errores
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Códigos de error. Una vez publicados no se renombran: los clientes los
+// comparan. Al agregar uno, darlo de alta en catalogo con sus traducciones.
+const (
+	ErrorInterno         Codigo = "ERROR_INTERNO"
+	ValidacionFallida    Codigo = "VALIDACION"
+	JSONInvalido         Codigo = "JSON_INVALIDO"
+	FormularioInvalido   Codigo = "FORMULARIO_INVALIDO"
+	MetodoNoPermitido    Codigo = "METODO_NO_PERMITIDO"
+	CuerpoMuyGrande      Codigo = "CUERPO_MUY_GRANDE"
+	DemasiadasPeticiones Codigo = "DEMASIADAS_PETICIONES"
+
+	NoAutenticado         Codigo = "NO_AUTENTICADO"
+	TokenInvalido         Codigo = "TOKEN_INVALIDO"
+	RefreshTokenInvalido  Codigo = "REFRESH_TOKEN_INVALIDO"
+	CredencialesInvalidas Codigo = "CREDENCIALES_INVALIDAS"
+	UsuarioInactivo       Codigo = "USUARIO_INACTIVO"
+	SesionActiva          Codigo = "SESION_ACTIVA"
+	SinPermiso            Codigo = "SIN_PERMISO"
+	SoloLectura           Codigo = "SOLO_LECTURA"
+	EmpresaNoPermitida    Codigo = "EMPRESA_NO_PERMITIDA"
+	EmpresaRequerida      Codigo = "EMPRESA_REQUERIDA"
+
+	EmpresaNoEncontrada         Codigo = "EMPRESA_NO_ENCONTRADA"
+	PedidoNoEncontrado          Codigo = "PEDIDO_NO_ENCONTRADO"
+	ProductoNoEncontrado        Codigo = "PRODUCTO_NO_ENCONTRADO"
+	ProductoNoEnCarrito         Codigo = "PRODUCTO_NO_EN_CARRITO"
+	UsuarioNoEncontrado         Codigo = "USUARIO_NO_ENCONTRADO"
+	TiendaNoEncontrada          Codigo = "TIENDA_NO_ENCONTRADA"
+	SucursalNoEncontrada        Codigo = "SUCURSAL_NO_ENCONTRADA"
+	ImpuestoNoEncontrado        Codigo = "IMPUESTO_NO_ENCONTRADO"
+	ImagenNoEncontrada          Codigo = "IMAGEN_NO_ENCONTRADA"
+	PersonalizacionNoEncontrada Codigo = "PERSONALIZACION_NO_ENCONTRADA"
+	IndicadorNoEncontrado       Codigo = "INDICADOR_NO_ENCONTRADO"
+	ReservaNoEncontrada         Codigo = "RESERVA_NO_ENCONTRADA"
+	FeriadoNoEncontrado         Codigo = "FERIADO_NO_ENCONTRADO"
+	ReasignacionNoEncontrada    Codigo = "REASIGNACION_NO_ENCONTRADA"
+	DireccionNoEncontrada       Codigo = "DIRECCION_NO_ENCONTRADA"
+
+	CorreoRegistrado         Codigo = "CORREO_REGISTRADO"
+	UbicacionSinCobertura    Codigo = "UBICACION_SIN_COBERTURA"
+	TiendaActivaRequerida    Codigo = "TIENDA_ACTIVA_REQUERIDA"
+	SincronizacionFallida    Codigo = "SINCRONIZACION_FALLIDA"
+	PedidoYaSincronizado     Codigo = "PEDIDO_YA_SINCRONIZADO"
+	HorarioNoDisponible      Codigo = "HORARIO_NO_DISPONIBLE"
+	HorarioSinCapacidad      Codigo = "HORARIO_SIN_CAPACIDAD"
+	ReservaVencida           Codigo = "RESERVA_VENCIDA"
+	ReasignacionResuelta     Codigo = "REASIGNACION_RESUELTA"
+	ClienteRemotoVinculado   Codigo = "CLIENTE_REMOTO_VINCULADO"
+	ClienteRemotoSinTelefono Codigo = "CLIENTE_REMOTO_SIN_TELEFONO"
+	ClienteRemotoExistente   Codigo = "CLIENTE_REMOTO_EXISTENTE"
+	CodigoIncorrecto         Codigo = "CODIGO_INCORRECTO"
+	ReclamoVencido           Codigo = "RECLAMO_VENCIDO"
+	ReclamosAgotados         Codigo = "RECLAMOS_AGOTADOS"
+)
+
+// Códigos de campo para Validacion.
+const (
+	CampoRequerido       CodigoCampo = "REQUERIDO"
+	CampoInvalido        CodigoCampo = "INVALIDO"
+	CampoMayorACero      CodigoCampo = "MAYOR_A_CERO"
+	CampoNoNegativo      CodigoCampo = "NO_NEGATIVO"
+	CampoFueraDeRango    CodigoCampo = "FUERA_DE_RANGO"  // args: mínimo, máximo
+	CampoMuyCorto        CodigoCampo = "MUY_CORTO"       // args: longitud mínima
+	CampoFormatoFecha    CodigoCampo = "FORMATO_FECHA"   // args: formato esperado
+	CampoFormatoArchivo  CodigoCampo = "FORMATO_ARCHIVO" // args: formatos aceptados
+	CampoSinElementos    CodigoCampo = "SIN_ELEMENTOS"
+	CampoMuyLargo        CodigoCampo = "MUY_LARGO"    // args: longitud máxima
+	CampoNoPermitido     CodigoCampo = "NO_PERMITIDO" // args: valores aceptados
+	CampoTipoInvalido    CodigoCampo = "TIPO_INVALIDO"
+	CampoDesconocido     CodigoCampo = "DESCONOCIDO"
+	CampoCorreo          CodigoCampo = "CORREO"
+	CampoRFC             CodigoCampo = "RFC"
+	CampoCodigoPostal    CodigoCampo = "CODIGO_POSTAL"
+	CampoTelefono        CodigoCampo = "TELEFONO"
+	CampoLineaInvalida   CodigoCampo = "LINEA_INVALIDA" // args: número de línea
+	CampoFueraDeMexico   CodigoCampo = "FUERA_DE_MEXICO"
+	CampoPoligonoAbierto CodigoCampo = "POLIGONO_ABIERTO"
+	CampoPoligonoCruzado CodigoCampo = "POLIGONO_CRUZADO"
+	CampoNumeroDePuntos  CodigoCampo = "NUMERO_DE_PUNTOS" // args: mínimo, máximo
+)
+
+type definicion struct {
+	estatus int
+	es, en  string
+}
+
+var catalogo = map[Codigo]definicion{
+	ErrorInterno:         {http.StatusInternalServerError, "Ocurrió un error interno; intenta de nuevo más tarde", "An internal error occurred; please try again later"},
+	ValidacionFallida:    {http.StatusBadRequest, "Hay campos con errores", "Some fields are invalid"},
+	JSONInvalido:         {http.StatusBadRequest, "El cuerpo de la petición no es JSON válido", "The request body is not valid JSON"},
+	FormularioInvalido:   {http.StatusBadRequest, "No se pudo leer el formulario", "The form could not be read"},
+	MetodoNoPermitido:    {http.StatusMethodNotAllowed, "Método no permitido", "Method not allowed"},
+	CuerpoMuyGrande:      {http.StatusRequestEntityTooLarge, "El cuerpo de la petición es demasiado grande", "The request body is too large"},
+	DemasiadasPeticiones: {http.StatusTooManyRequests, "Demasiadas peticiones; espera un momento e intenta de nuevo", "Too many requests; wait a moment and try again"},
+
+	NoAutenticado:         {http.StatusUnauthorized, "Se requiere autenticación", "Authentication required"},
+	TokenInvalido:         {http.StatusUnauthorized, "Token inválido o expirado", "Invalid or expired token"},
+	RefreshTokenInvalido:  {http.StatusUnauthorized, "Refresh token inválido o expirado", "Invalid or expired refresh token"},
+	CredencialesInvalidas: {http.StatusUnauthorized, "Usuario o contraseña incorrectos", "Incorrect user or password"},
+	UsuarioInactivo:       {http.StatusUnauthorized, "Usuario inactivo o suspendido", "User is inactive or suspended"},
+	SesionActiva:          {http.StatusConflict, "Sesión iniciada en otro equipo, espere o cierre sesión", "Session already open on another device; wait or log out"},
+	SinPermiso:            {http.StatusForbidden, "No tienes permisos suficientes", "You do not have enough permissions"},
+	SoloLectura:           {http.StatusForbidden, "Tu usuario es solo lectura, no puedes editar", "Your user is read-only and cannot make changes"},
+	EmpresaNoPermitida:    {http.StatusForbidden, "Tu sesión es de otra empresa", "Your session belongs to another company"},
+	EmpresaRequerida:      {http.StatusBadRequest, "No se pudo determinar la empresa; indica el encabezado X-Empresa", "The company could not be determined; send the X-Empresa header"},
+
+	EmpresaNoEncontrada:         {http.StatusNotFound, "Empresa no encontrada o inactiva", "Company not found or inactive"},
+	PedidoNoEncontrado:          {http.StatusNotFound, "Pedido no encontrado", "Order not found"},
+	ProductoNoEncontrado:        {http.StatusNotFound, "Producto no encontrado", "Product not found"},
+	ProductoNoEnCarrito:         {http.StatusNotFound, "El producto no está en el carrito", "The product is not in the cart"},
+	UsuarioNoEncontrado:         {http.StatusNotFound, "Usuario no encontrado", "User not found"},
+	TiendaNoEncontrada:          {http.StatusNotFound, "Tienda no encontrada", "Store not found"},
+	SucursalNoEncontrada:        {http.StatusNotFound, "Sucursal no encontrada", "Branch not found"},
+	ImpuestoNoEncontrado:        {http.StatusNotFound, "Impuesto no encontrado", "Tax not found"},
+	ImagenNoEncontrada:          {http.StatusNotFound, "No hay imagen con ese identificador", "No image with that identifier"},
+	PersonalizacionNoEncontrada: {http.StatusNotFound, "No hay configuración visual con ese id", "No visual configuration with that id"},
+	IndicadorNoEncontrado:       {http.StatusNotFound, "No hay indicadores para el periodo", "No indicators for the period"},
+	ReservaNoEncontrada:         {http.StatusNotFound, "No hay un horario apartado con ese id", "No delivery slot hold with that id"},
+	FeriadoNoEncontrado:         {http.StatusNotFound, "No hay un feriado con ese id", "No holiday with that id"},
+	ReasignacionNoEncontrada:    {http.StatusNotFound, "No hay una reasignación con ese id", "No reassignment with that id"},
+	DireccionNoEncontrada:       {http.StatusNotFound, "La tienda no tiene una dirección con ese id", "The store has no address with that id"},
+
+	CorreoRegistrado:         {http.StatusBadRequest, "El correo ya está registrado", "The email is already registered"},
+	UbicacionSinCobertura:    {http.StatusBadRequest, "No hay sucursal que cubra esa ubicación", "No branch covers that location"},
+	TiendaActivaRequerida:    {http.StatusBadRequest, "Debes tener al menos una tienda activa", "You must keep at least one active store"},
+	SincronizacionFallida:    {http.StatusConflict, "No se pudo sincronizar el pedido con el sistema principal", "The order could not be synced with the main system"},
+	PedidoYaSincronizado:     {http.StatusConflict, "El pedido ya está sincronizado", "The order is already synced"},
+	HorarioNoDisponible:      {http.StatusBadRequest, "No se entrega en ese horario; elige uno de las fechas disponibles", "There is no delivery in that slot; choose one of the available dates"},
+	HorarioSinCapacidad:      {http.StatusConflict, "El horario de entrega ya está lleno; elige otro", "The delivery slot is full; choose another one"},
+	ReservaVencida:           {http.StatusConflict, "El horario apartado venció o ya se usó; vuelve a elegir horario", "The delivery slot hold expired or was already used; choose a slot again"},
+	ReasignacionResuelta:     {http.StatusConflict, "La reasignación ya se aplicó, se descartó o hay una más nueva", "The reassignment was already applied, discarded or superseded"},
+	ClienteRemotoVinculado:   {http.StatusConflict, "Ya hay una cuenta ligada a tu cliente de la sucursal; inicia sesión", "An account is already linked to your branch customer record; log in"},
+	ClienteRemotoSinTelefono: {http.StatusConflict, "Ya eres cliente de la sucursal, pero no tiene un teléfono tuyo para verificarte; comunícate con ella", "You are already a branch customer, but the branch has no phone number to verify you; contact the branch"},
+	ClienteRemotoExistente:   {http.StatusConflict, "La sucursal ya tiene otro cliente con ese RFC o nombre comercial; comunícate con ella", "The branch already has another customer with that RFC or trade name; contact the branch"},
+	CodigoIncorrecto:         {http.StatusBadRequest, "El código de verificación no es correcto", "The verification code is incorrect"},
+	ReclamoVencido:           {http.StatusConflict, "El código venció, ya se usó o se acabaron los intentos; vuelve a registrarte", "The code expired, was already used or ran out of attempts; register again"},
+	ReclamosAgotados:         {http.StatusTooManyRequests, "Ya se mandaron varios códigos a este cliente; intenta de nuevo en una hora", "Several codes were already sent to this customer; try again in an hour"},
+}
+
+var catalogoCampos = map[CodigoCampo]struct{ es, en string }{
+	CampoRequerido:       {"es obligatorio", "is required"},
+	CampoInvalido:        {"no es válido", "is not valid"},
+	CampoMayorACero:      {"debe ser mayor a 0", "must be greater than 0"},
+	CampoNoNegativo:      {"no puede ser negativo", "cannot be negative"},
+	CampoFueraDeRango:    {"debe estar entre %v y %v", "must be between %v and %v"},
+	CampoMuyCorto:        {"debe tener al menos %v caracteres", "must be at least %v characters long"},
+	CampoFormatoFecha:    {"debe tener el formato %s", "must use the format %s"},
+	CampoFormatoArchivo:  {"formato no permitido (solo %s)", "format not allowed (only %s)"},
+	CampoSinElementos:    {"debe incluir al menos un elemento", "must include at least one item"},
+	CampoMuyLargo:        {"debe tener como máximo %v caracteres", "must be at most %v characters long"},
+	CampoNoPermitido:     {"debe ser uno de: %s", "must be one of: %s"},
+	CampoTipoInvalido:    {"tiene un tipo de dato incorrecto", "has the wrong data type"},
+	CampoDesconocido:     {"no es un campo aceptado", "is not an accepted field"},
+	CampoCorreo:          {"no es un correo válido", "is not a valid email address"},
+	CampoRFC:             {"no es un RFC válido", "is not a valid RFC"},
+	CampoCodigoPostal:    {"debe ser un código postal de 5 dígitos", "must be a 5-digit postal code"},
+	CampoTelefono:        {"debe ser un teléfono de 10 dígitos", "must be a 10-digit phone number"},
+	CampoLineaInvalida:   {"no es válido en la línea %d", "is not valid at line %d"},
+	CampoFueraDeMexico:   {"está fuera de México", "is outside Mexico"},
+	CampoPoligonoAbierto: {"debe terminar en el mismo punto en que empieza", "must end at the same point it starts"},
+	CampoPoligonoCruzado: {"tiene lados que se cruzan", "has edges that cross each other"},
+	CampoNumeroDePuntos:  {"debe tener entre %v y %v puntos", "must have between %v and %v points"},
+}
+
+// Codigos regresa los códigos del catálogo ordenados (para documentación).
+func Codigos() []Codigo {
+	cs := make([]Codigo, 0, len(catalogo))
+	for c := range catalogo {
+		cs = append(cs, c)
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i] < cs[j] })
+	return cs
+}
+
+// CodigosCampo regresa los códigos de campo ordenados.
+func CodigosCampo() []CodigoCampo {
+	cs := make([]CodigoCampo, 0, len(catalogoCampos))
+	for c := range catalogoCampos {
+		cs = append(cs, c)
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i] < cs[j] })
+	return cs
+}
+
+func mensaje(c Codigo, idioma string) string {
+	d, ok := catalogo[c]
+	if !ok {
+		d = catalogo[ErrorInterno]
+	}
+	if idioma == "en" {
+		return d.en
+	}
+	return d.es
+}
+
+// Idioma elige "es" o "en" a partir de Accept-Language respetando los pesos
+// q; sin coincidencias regresa "es".
+func Idioma(r *http.Request) string {
+	mejor, mejorQ := "es", 0.0
+	for _, parte := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		etiqueta, params, _ := strings.Cut(strings.TrimSpace(parte), ";")
+		base, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(etiqueta)), "-")
+		if base != "es" && base != "en" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q > mejorQ {
+			mejor, mejorQ = base, q
+		}
+	}
+	return mejor
+}
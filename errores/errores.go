@@ -0,0 +1,202 @@
+// Package errores define el único formato de error de la API:
+//
+//	{"error": {"code": "PEDIDO_NO_ENCONTRADO", "message": "...", "fields": [...], "request_id": "..."}}
+//
+// El código es estable y es lo que deben comparar los clientes; el mensaje se
+// traduce según Accept-Language (es por omisión, en). Los detalles internos
+// (errores de SQL, valores recibidos) sólo van al log de la petición.
+package errores
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/bitacora"
+)
+
+// Codigo identifica el error de forma estable para los clientes.
+type Codigo string
+
+// Error es el error que los handlers escriben con Escribir. La causa y el
+// contexto no salen en la respuesta.
+type Error struct {
+	Codigo   Codigo
+	Campos   []Campo
+	contexto string
+	causa    error
+}
+
+// Nuevo crea un error con el código dado; el estatus HTTP sale del catálogo.
+func Nuevo(c Codigo) *Error {
+	return &Error{Codigo: c}
+}
+
+// Interno crea un ERROR_INTERNO. contexto describe la operación que falló
+// (p. ej. "Error al obtener los pedidos") y, junto con causa, sólo se registra
+// en el log.
+func Interno(contexto string, causa error) *Error {
+	return &Error{Codigo: ErrorInterno, contexto: contexto, causa: causa}
+}
+
+// Validacion crea un error VALIDACION con la lista de campos inválidos.
+func Validacion(campos ...Campo) *Error {
+	return &Error{Codigo: ValidacionFallida, Campos: campos}
+}
+
+// Envolver regresa el *Error que ya venga en err o, si no hay, uno nuevo con
+// el código dado y err como causa. Sirve para funciones que regresan errores
+// de negocio ya clasificados mezclados con errores de infraestructura.
+func Envolver(err error, c Codigo, contexto string) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return Nuevo(c).Con(contexto, err)
+}
+
+// Con agrega contexto y causa para el log sin cambiar lo que ve el cliente.
+func (e *Error) Con(contexto string, causa error) *Error {
+	e.contexto = contexto
+	e.causa = causa
+	return e
+}
+
+func (e *Error) Error() string {
+	s := string(e.Codigo)
+	if e.contexto != "" {
+		s += ": " + e.contexto
+	}
+	if e.causa != nil {
+		s += ": " + e.causa.Error()
+	}
+	return s
+}
+
+func (e *Error) Unwrap() error {
+	return e.causa
+}
+
+// Estatus regresa el código HTTP asociado al código de error.
+func (e *Error) Estatus() int {
+	if d, ok := catalogo[e.Codigo]; ok {
+		return d.estatus
+	}
+	return http.StatusInternalServerError
+}
+
+// ---------------------------
+// RESPUESTA
+// ---------------------------
+
+// Respuesta es el cuerpo JSON de cualquier error de la API.
+type Respuesta struct {
+	Error Detalle `json:"error"`
+}
+
+type Detalle struct {
+	Codigo    Codigo         `json:"code"`
+	Mensaje   string         `json:"message"`
+	Campos    []CampoDetalle `json:"fields,omitempty"`
+	RequestID string         `json:"request_id,omitempty"`
+}
+
+type CampoDetalle struct {
+	Campo   string      `json:"field"`
+	Codigo  CodigoCampo `json:"code"`
+	Mensaje string      `json:"message"`
+}
+
+// Escribir responde con el formato común y deja el error en el log de la
+// petición. Un err que no sea *Error se trata como ERROR_INTERNO.
+func Escribir(w http.ResponseWriter, r *http.Request, err error) {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = Interno("Error inesperado", err)
+	}
+	estatus := e.Estatus()
+	idioma := Idioma(r)
+
+	registrar(r, e, estatus)
+
+	d := Detalle{
+		Codigo:    e.Codigo,
+		Mensaje:   mensaje(e.Codigo, idioma),
+		RequestID: requestID(w, r),
+	}
+	for _, c := range e.Campos {
+		d.Campos = append(d.Campos, CampoDetalle{Campo: c.Campo, Codigo: c.Codigo, Mensaje: c.mensaje(idioma)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Language", idioma)
+	w.WriteHeader(estatus)
+	_ = json.NewEncoder(w).Encode(Respuesta{Error: d})
+}
+
+func registrar(r *http.Request, e *Error, estatus int) {
+	nivel := slog.LevelWarn
+	if estatus >= 500 {
+		nivel = slog.LevelError
+	}
+	msg := e.contexto
+	if msg == "" {
+		msg = string(e.Codigo)
+	}
+	attrs := []any{"status", estatus, "code", e.Codigo}
+	if e.causa != nil {
+		attrs = append(attrs, "error", e.causa.Error())
+	}
+	for _, c := range e.Campos {
+		attrs = append(attrs, slog.String("field."+c.Campo, string(c.Codigo)))
+	}
+	bitacora.Desde(r.Context()).Log(r.Context(), nivel, msg, attrs...)
+}
+
+func requestID(w http.ResponseWriter, r *http.Request) string {
+	if id := bitacora.RequestID(r.Context()); id != "" {
+		return id
+	}
+	return w.Header().Get(bitacora.HeaderRequestID)
+}
+
+// ---------------------------
+// CAMPOS
+// ---------------------------
+
+// CodigoCampo identifica por qué un campo no pasó la validación.
+type CodigoCampo string
+
+// Campo es un error de validación de un campo del cuerpo o de la URL. El
+// nombre es el del JSON o del parámetro (p. ej. "detalles[0].cantidad").
+type Campo struct {
+	Campo  string
+	Codigo CodigoCampo
+	args   []any
+}
+
+// NuevoCampo crea un error de campo; args se usan en el mensaje traducido
+// (p. ej. los límites de FUERA_DE_RANGO).
+func NuevoCampo(campo string, c CodigoCampo, args ...any) Campo {
+	return Campo{Campo: campo, Codigo: c, args: args}
+}
+
+func Requerido(campo string) Campo { return NuevoCampo(campo, CampoRequerido) }
+func Invalido(campo string) Campo  { return NuevoCampo(campo, CampoInvalido) }
+
+func (c Campo) mensaje(idioma string) string {
+	t, ok := catalogoCampos[c.Codigo]
+	if !ok {
+		return string(c.Codigo)
+	}
+	plantilla := t.es
+	if idioma == "en" {
+		plantilla = t.en
+	}
+	if len(c.args) == 0 {
+		return plantilla
+	}
+	return fmt.Sprintf(plantilla, c.args...)
+}
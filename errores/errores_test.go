@@ -0,0 +1,173 @@
+package errores
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/bitacora"
+)
+
+func escribir(t *testing.T, r *http.Request, err error) (*httptest.ResponseRecorder, Detalle) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	Escribir(rec, r, err)
+	var resp Respuesta
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("respuesta no es JSON: %v (%s)", err, rec.Body)
+	}
+	return rec, resp.Error
+}
+
+func TestEscribir(t *testing.T) {
+	casos := []struct {
+		nombre  string
+		err     error
+		status  int
+		codigo  Codigo
+		mensaje string
+	}{
+		{nombre: "no encontrado", err: Nuevo(PedidoNoEncontrado), status: http.StatusNotFound, codigo: PedidoNoEncontrado, mensaje: "Pedido no encontrado"},
+		{nombre: "interno", err: Interno("Error al crear el pedido", errors.New("INSERT INTO pedidos ...")), status: http.StatusInternalServerError, codigo: ErrorInterno},
+		{nombre: "error ajeno", err: errors.New("algo"), status: http.StatusInternalServerError, codigo: ErrorInterno},
+		{nombre: "envuelto", err: fmt.Errorf("sincronizando: %w", Nuevo(PedidoYaSincronizado)), status: http.StatusConflict, codigo: PedidoYaSincronizado},
+		{nombre: "código sin catálogo", err: Nuevo("NO_EXISTE"), status: http.StatusInternalServerError, codigo: "NO_EXISTE"},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			rec, d := escribir(t, httptest.NewRequest(http.MethodGet, "/", nil), c.err)
+			if rec.Code != c.status {
+				t.Errorf("status = %d, se esperaba %d", rec.Code, c.status)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			if d.Codigo != c.codigo {
+				t.Errorf("code = %s, se esperaba %s", d.Codigo, c.codigo)
+			}
+			if c.mensaje != "" && d.Mensaje != c.mensaje {
+				t.Errorf("message = %q", d.Mensaje)
+			}
+			if d.Mensaje == "" {
+				t.Error("sin mensaje")
+			}
+		})
+	}
+}
+
+// La causa y el contexto van al log de la petición, nunca al cliente.
+func TestEscribirNoFiltraDetalles(t *testing.T) {
+	var log bytes.Buffer
+	r := httptest.NewRequest(http.MethodPost, "/api/pedidos", nil)
+	ctx := bitacora.ConLogger(r.Context(), slog.New(slog.NewJSONHandler(&log, nil)))
+	r = r.WithContext(bitacora.ConRequestID(ctx, "abc-123"))
+
+	rec, d := escribir(t, r, Interno("Error al crear el pedido", errors.New("Error 1062: Duplicate entry 'PED-1'")))
+	if strings.Contains(rec.Body.String(), "Duplicate") || strings.Contains(rec.Body.String(), "crear el pedido") {
+		t.Errorf("el cuerpo trae detalles internos: %s", rec.Body)
+	}
+	if d.RequestID != "abc-123" {
+		t.Errorf("request_id = %q", d.RequestID)
+	}
+	for _, s := range []string{"Error al crear el pedido", "Duplicate entry", `"code":"ERROR_INTERNO"`, `"request_id":"abc-123"`, `"level":"ERROR"`} {
+		if !strings.Contains(log.String(), s) {
+			t.Errorf("el log no contiene %q: %s", s, log.String())
+		}
+	}
+}
+
+func TestEscribirRequestIDDesdeCabecera(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set(bitacora.HeaderRequestID, "cabecera-1")
+	Escribir(rec, httptest.NewRequest(http.MethodGet, "/", nil), Nuevo(SinPermiso))
+	if !strings.Contains(rec.Body.String(), `"request_id":"cabecera-1"`) {
+		t.Errorf("cuerpo = %s", rec.Body)
+	}
+}
+
+func TestValidacionTraducida(t *testing.T) {
+	err := Validacion(
+		Requerido("id_tienda"),
+		NuevoCampo("detalles[0].cantidad", CampoMayorACero),
+		NuevoCampo("lista_precios", CampoFueraDeRango, 1, 25),
+	)
+	casos := []struct {
+		idioma   string
+		mensaje  string
+		mensajes []string
+	}{
+		{idioma: "", mensaje: "Hay campos con errores", mensajes: []string{"es obligatorio", "debe ser mayor a 0", "debe estar entre 1 y 25"}},
+		{idioma: "en-US,en;q=0.9", mensaje: "Some fields are invalid", mensajes: []string{"is required", "must be greater than 0", "must be between 1 and 25"}},
+	}
+	for _, c := range casos {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.Header.Set("Accept-Language", c.idioma)
+		rec, d := escribir(t, r, err)
+		if rec.Code != http.StatusBadRequest || d.Codigo != ValidacionFallida || d.Mensaje != c.mensaje {
+			t.Errorf("%q: status %d, code %s, message %q", c.idioma, rec.Code, d.Codigo, d.Mensaje)
+		}
+		if len(d.Campos) != len(c.mensajes) {
+			t.Fatalf("%q: fields = %+v", c.idioma, d.Campos)
+		}
+		for i, m := range c.mensajes {
+			if d.Campos[i].Mensaje != m {
+				t.Errorf("%q: fields[%d].message = %q, se esperaba %q", c.idioma, i, d.Campos[i].Mensaje, m)
+			}
+		}
+		if d.Campos[0].Campo != "id_tienda" || d.Campos[0].Codigo != CampoRequerido {
+			t.Errorf("fields[0] = %+v", d.Campos[0])
+		}
+	}
+}
+
+func TestIdioma(t *testing.T) {
+	casos := map[string]string{
+		"":                        "es",
+		"en":                      "en",
+		"EN-gb":                   "en",
+		"es-MX,es;q=0.9,en;q=0.8": "es",
+		"fr-FR,en;q=0.5,es;q=0.4": "en",
+		"en;q=0.3,es-MX;q=0.7":    "es",
+		"de-DE":                   "es",
+		"en;q=basura":             "en",
+	}
+	for cabecera, esperado := range casos {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Language", cabecera)
+		if got := Idioma(r); got != esperado {
+			t.Errorf("Idioma(%q) = %q, se esperaba %q", cabecera, got, esperado)
+		}
+	}
+}
+
+func TestEnvolver(t *testing.T) {
+	clasificado := fmt.Errorf("capa: %w", Nuevo(PedidoNoEncontrado))
+	if e := Envolver(clasificado, SincronizacionFallida, "x"); e.Codigo != PedidoNoEncontrado {
+		t.Errorf("Envolver cambió el código clasificado: %s", e.Codigo)
+	}
+	causa := errors.New("timeout")
+	e := Envolver(causa, SincronizacionFallida, "Error al sincronizar")
+	if e.Codigo != SincronizacionFallida || !errors.Is(e, causa) {
+		t.Errorf("Envolver = %v", e)
+	}
+}
+
+// Todo código declarado debe tener estatus y ambas traducciones.
+func TestCatalogoCompleto(t *testing.T) {
+	for c, d := range catalogo {
+		if d.estatus < 400 || d.es == "" || d.en == "" {
+			t.Errorf("%s: definición incompleta %+v", c, d)
+		}
+	}
+	for c, d := range catalogoCampos {
+		if d.es == "" || d.en == "" || strings.Count(d.es, "%") != strings.Count(d.en, "%") {
+			t.Errorf("%s: traducción incompleta %+v", c, d)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Package feriados es el calendario de días sin entregas: los feriados
+// oficiales de México (artículo 74 de la Ley Federal del Trabajo), que se
+// calculan para cualquier año, y los que da de alta cada empresa, para todas
+// sus sucursales o para una sola (cierres de sucursal). Un feriado propio
+// puede repetirse cada año en el mismo día y mes.
+//
+// Los calendarios se importan y exportan en formato iCalendar (.ics, RFC 5545).
+package feriados
+
+import (
+	"sort"
+	"time"
+)
+
+// Origen de un feriado.
+const (
+	Oficial = "oficial" // calculado por Oficiales
+	Manual  = "manual"  // dado de alta por un administrador
+	ICS     = "ics"     // importado de un .ics
+	Config  = "config"  // de dias_feriados en la configuración de entregas
+)
+
+// Feriado es un día sin entregas. De Fecha sólo cuenta el día.
+type Feriado struct {
+	ID     int64
+	Fecha  time.Time
+	Nombre string
+	// Recurrente se repite cada año en el mismo día y mes.
+	Recurrente bool
+	// DiasAdicionales se suman al tiempo de entrega de un pedido hecho ese día.
+	DiasAdicionales int
+	// IDSucursal 0 es para toda la empresa.
+	IDSucursal int
+	Origen     string
+}
+
+// Dia es el feriado en el formato "YYYY-MM-DD".
+func (f Feriado) Dia() string {
+	return f.Fecha.Format("2006-01-02")
+}
+
+// Oficiales regresa los días de descanso obligatorio del año, en orden. Los
+// de jornada electoral no se incluyen porque no tienen fecha fija.
+func Oficiales(anio int) []Feriado {
+	fs := []Feriado{
+		oficial(fecha(anio, time.January, 1), "Año Nuevo"),
+		oficial(lunes(anio, time.February, 1), "Día de la Constitución"),
+		oficial(lunes(anio, time.March, 3), "Natalicio de Benito Juárez"),
+		oficial(fecha(anio, time.May, 1), "Día del Trabajo"),
+		oficial(fecha(anio, time.September, 16), "Día de la Independencia"),
+	}
+	// Cada seis años, desde 2024, el 1 de octubre
+	if anio >= 2024 && (anio-2024)%6 == 0 {
+		fs = append(fs, oficial(fecha(anio, time.October, 1), "Transmisión del Poder Ejecutivo Federal"))
+	}
+	return append(fs,
+		oficial(lunes(anio, time.November, 3), "Día de la Revolución"),
+		oficial(fecha(anio, time.December, 25), "Navidad"),
+	)
+}
+
+func oficial(f time.Time, nombre string) Feriado {
+	return Feriado{Fecha: f, Nombre: nombre, Origen: Oficial}
+}
+
+func fecha(anio int, mes time.Month, dia int) time.Time {
+	return time.Date(anio, mes, dia, 0, 0, 0, 0, time.UTC)
+}
+
+// lunes es el n-ésimo lunes del mes.
+func lunes(anio int, mes time.Month, n int) time.Time {
+	primero := fecha(anio, mes, 1)
+	desfase := (int(time.Monday) - int(primero.Weekday()) + 7) % 7
+	return primero.AddDate(0, 0, desfase+7*(n-1))
+}
+
+// Calendario responde si un día es feriado para una empresa o sucursal.
+type Calendario struct {
+	oficiales bool
+	// por día ("YYYY-MM-DD") y, los recurrentes, por día del año ("MM-DD")
+	fijos   map[string]Feriado
+	anuales map[string]Feriado
+	propios []Feriado
+}
+
+// NuevoCalendario arma el calendario con los feriados propios y, si oficiales,
+// los de la ley. Cuando dos caen el mismo día gana el primero de la lista,
+// así que conviene poner antes los de la sucursal.
+func NuevoCalendario(oficiales bool, propios []Feriado) *Calendario {
+	c := &Calendario{oficiales: oficiales, fijos: map[string]Feriado{}, anuales: map[string]Feriado{}, propios: propios}
+	for _, f := range propios {
+		if f.Recurrente {
+			if _, ok := c.anuales[f.Fecha.Format("01-02")]; !ok {
+				c.anuales[f.Fecha.Format("01-02")] = f
+			}
+		} else if _, ok := c.fijos[f.Dia()]; !ok {
+			c.fijos[f.Dia()] = f
+		}
+	}
+	return c
+}
+
+// Es regresa el feriado que cae en el día de t, si hay.
+func (c *Calendario) Es(t time.Time) (Feriado, bool) {
+	if c == nil {
+		return Feriado{}, false
+	}
+	if f, ok := c.fijos[t.Format("2006-01-02")]; ok {
+		return f, true
+	}
+	if f, ok := c.anuales[t.Format("01-02")]; ok {
+		f.Fecha = fecha(t.Year(), f.Fecha.Month(), f.Fecha.Day())
+		return f, true
+	}
+	if c.oficiales {
+		dia := t.Format("2006-01-02")
+		for _, f := range Oficiales(t.Year()) {
+			if f.Dia() == dia {
+				return f, true
+			}
+		}
+	}
+	return Feriado{}, false
+}
+
+// DelAnio regresa los feriados que caen en el año, en orden, con los
+// recurrentes ya en ese año. Si dos caen el mismo día queda el que regresaría Es.
+func (c *Calendario) DelAnio(anio int) []Feriado {
+	var candidatos []Feriado
+	for _, f := range c.propios {
+		if f.Recurrente {
+			f.Fecha = fecha(anio, f.Fecha.Month(), f.Fecha.Day())
+		}
+		if f.Fecha.Year() == anio {
+			candidatos = append(candidatos, f)
+		}
+	}
+	if c.oficiales {
+		candidatos = append(candidatos, Oficiales(anio)...)
+	}
+
+	vistos := map[string]bool{}
+	var fs []Feriado
+	for _, f := range candidatos {
+		if vistos[f.Dia()] {
+			continue
+		}
+		vistos[f.Dia()] = true
+		ganador, _ := c.Es(f.Fecha)
+		fs = append(fs, ganador)
+	}
+	sort.SliceStable(fs, func(i, j int) bool { return fs[i].Fecha.Before(fs[j].Fecha) })
+	return fs
+}
@@ -0,0 +1,166 @@
+package feriados
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func dias(fs []Feriado) []string {
+	var ds []string
+	for _, f := range fs {
+		ds = append(ds, f.Dia())
+	}
+	return ds
+}
+
+func TestOficiales(t *testing.T) {
+	casos := []struct {
+		anio int
+		dias []string
+	}{
+		{2026, []string{"2026-01-01", "2026-02-02", "2026-03-16", "2026-05-01", "2026-09-16", "2026-11-16", "2026-12-25"}},
+		{2027, []string{"2027-01-01", "2027-02-01", "2027-03-15", "2027-05-01", "2027-09-16", "2027-11-15", "2027-12-25"}},
+		// transmisión del Poder Ejecutivo
+		{2030, []string{"2030-01-01", "2030-02-04", "2030-03-18", "2030-05-01", "2030-09-16", "2030-10-01", "2030-11-18", "2030-12-25"}},
+	}
+	for _, c := range casos {
+		if got := strings.Join(dias(Oficiales(c.anio)), " "); got != strings.Join(c.dias, " ") {
+			t.Errorf("%d: %s, se esperaba %s", c.anio, got, strings.Join(c.dias, " "))
+		}
+	}
+}
+
+func TestCalendario(t *testing.T) {
+	cierre := Feriado{ID: 1, Fecha: fecha(2026, time.November, 16), Nombre: "Inventario", IDSucursal: 7, Origen: Manual}
+	aniversario := Feriado{ID: 2, Fecha: fecha(2020, time.July, 10), Nombre: "Aniversario", Recurrente: true, Origen: Manual}
+	puente := Feriado{ID: 3, Fecha: fecha(2026, time.November, 16), Nombre: "Puente", Origen: ICS}
+	c := NuevoCalendario(true, []Feriado{cierre, aniversario, puente})
+
+	casos := []struct {
+		dia    time.Time
+		nombre string
+	}{
+		{time.Date(2026, time.February, 2, 15, 30, 0, 0, time.Local), "Día de la Constitución"},
+		{fecha(2026, time.November, 16), "Inventario"},
+		{fecha(2031, time.July, 10), "Aniversario"},
+		{fecha(2026, time.February, 3), ""},
+	}
+	for _, cs := range casos {
+		f, ok := c.Es(cs.dia)
+		if ok != (cs.nombre != "") || f.Nombre != cs.nombre {
+			t.Errorf("%s: %q %v, se esperaba %q", cs.dia.Format("2006-01-02"), f.Nombre, ok, cs.nombre)
+		}
+	}
+	if f, _ := c.Es(fecha(2031, time.July, 10)); f.Dia() != "2031-07-10" {
+		t.Errorf("recurrente en 2031 = %s", f.Dia())
+	}
+
+	sinOficiales := NuevoCalendario(false, nil)
+	if _, ok := sinOficiales.Es(fecha(2026, time.January, 1)); ok {
+		t.Error("sin oficiales el 1 de enero no es feriado")
+	}
+	var nulo *Calendario
+	if _, ok := nulo.Es(fecha(2026, time.January, 1)); ok {
+		t.Error("un calendario nil no tiene feriados")
+	}
+
+	anio := c.DelAnio(2026)
+	if len(anio) != 8 {
+		t.Fatalf("DelAnio = %v", dias(anio))
+	}
+	if anio[3].Nombre != "Día del Trabajo" || anio[4].Dia() != "2026-07-10" || anio[6].Nombre != "Inventario" {
+		t.Errorf("DelAnio = %+v", anio)
+	}
+}
+
+const calendarioICS = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VTIMEZONE\r\n" +
+	"TZID:America/Mexico_City\r\n" +
+	"BEGIN:STANDARD\r\n" +
+	"DTSTART:19700101T000000\r\n" +
+	"END:STANDARD\r\n" +
+	"END:VTIMEZONE\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20261224\r\n" +
+	"DTEND;VALUE=DATE:20261226\r\n" +
+	"SUMMARY:Cierre de fin\r\n" +
+	"  de año\\, bodega\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"TRIGGER:-PT15M\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;TZID=America/Mexico_City:20200712T090000\r\n" +
+	"SUMMARY:Día del Abarrotero\r\n" +
+	"RRULE:FREQ=YEARLY;BYMONTH=7\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestLeerICS(t *testing.T) {
+	fs, err := LeerICS(strings.NewReader(calendarioICS))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(dias(fs), " "); got != "2026-12-24 2026-12-25 2020-07-12" {
+		t.Fatalf("días = %s", got)
+	}
+	if fs[0].Nombre != "Cierre de fin de año, bodega" || fs[0].Recurrente || fs[0].Origen != ICS {
+		t.Errorf("primer evento = %+v", fs[0])
+	}
+	if fs[2].Nombre != "Día del Abarrotero" || !fs[2].Recurrente {
+		t.Errorf("recurrente = %+v", fs[2])
+	}
+
+	malos := []struct {
+		nombre string
+		ics    string
+		linea  int
+	}{
+		{"fecha inválida", "BEGIN:VEVENT\nDTSTART:2026-12-24\nEND:VEVENT\n", 2},
+		{"regla mensual", "BEGIN:VEVENT\nDTSTART:20261224\nRRULE:FREQ=MONTHLY\nEND:VEVENT\n", 3},
+		{"sin DTSTART", "BEGIN:VCALENDAR\nBEGIN:VEVENT\nSUMMARY:x\nEND:VEVENT\n", 2},
+		{"sin END", "BEGIN:VEVENT\nDTSTART:20261224\n", 1},
+		{"demasiado largo", "BEGIN:VEVENT\nDTSTART:20260101\nDTEND:20260301\nEND:VEVENT\n", 1},
+	}
+	for _, m := range malos {
+		_, err := LeerICS(strings.NewReader(m.ics))
+		var errICS *ErrorICS
+		if !errors.As(err, &errICS) || errICS.Linea != m.linea {
+			t.Errorf("%s: err = %v, se esperaba en la línea %d", m.nombre, err, m.linea)
+		}
+	}
+}
+
+func TestEscribirICS(t *testing.T) {
+	fs := []Feriado{
+		{Fecha: fecha(2026, time.February, 2), Nombre: "Día de la Constitución", Origen: Oficial},
+		{Fecha: fecha(2020, time.July, 12), Nombre: strings.Repeat("Aniversario de la tienda, ", 4), Recurrente: true, IDSucursal: 7, Origen: Manual},
+	}
+	var b bytes.Buffer
+	if err := EscribirICS(&b, "Feriados", fs, time.Date(2026, time.January, 5, 10, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n") {
+		if len(l) > 75 {
+			t.Errorf("línea de %d octetos: %q", len(l), l)
+		}
+	}
+	for _, esperada := range []string{"DTSTART;VALUE=DATE:20260202\r\n", "DTEND;VALUE=DATE:20260203\r\n", "RRULE:FREQ=YEARLY\r\n", "DTSTAMP:20260105T100000Z\r\n"} {
+		if !strings.Contains(b.String(), esperada) {
+			t.Errorf("falta %q en\n%s", esperada, b.String())
+		}
+	}
+
+	// Lo exportado se vuelve a importar igual
+	leidos, err := LeerICS(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leidos) != 2 || leidos[1].Nombre != fs[1].Nombre || !leidos[1].Recurrente || leidos[0].Dia() != "2026-02-02" {
+		t.Errorf("ida y vuelta = %+v", leidos)
+	}
+}
@@ -0,0 +1,226 @@
+package feriados
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// maxDiasEvento limita cuántos días de un evento de varios días se importan.
+const maxDiasEvento = 31
+
+// ErrorICS es un .ics que no se pudo leer. Linea es el número de línea en el
+// archivo; si la propiedad estaba doblada, el de su primera parte.
+type ErrorICS struct {
+	Linea   int
+	Mensaje string
+}
+
+func (e *ErrorICS) Error() string {
+	return fmt.Sprintf("línea %d: %s", e.Linea, e.Mensaje)
+}
+
+// LeerICS regresa un feriado por cada día de los VEVENT del calendario. Un
+// evento con RRULE FREQ=YEARLY queda recurrente; cualquier otra regla de
+// repetición es un error. Los feriados salen con Origen ICS.
+func LeerICS(r io.Reader) ([]Feriado, error) {
+	lineas, err := desdoblar(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var fs []Feriado
+	var evento *eventoICS
+	anidados := 0 // VALARM y similares dentro del evento
+	for _, l := range lineas {
+		nombre, valor := propiedad(l.texto)
+		switch {
+		case nombre == "BEGIN" && strings.EqualFold(valor, "VEVENT"):
+			if evento != nil {
+				return nil, &ErrorICS{l.numero, "VEVENT dentro de otro VEVENT"}
+			}
+			evento = &eventoICS{linea: l.numero}
+		case nombre == "BEGIN" && evento != nil:
+			anidados++
+		case nombre == "END" && evento != nil && anidados > 0:
+			anidados--
+		case nombre == "END" && strings.EqualFold(valor, "VEVENT"):
+			if evento == nil {
+				return nil, &ErrorICS{l.numero, "END:VEVENT sin BEGIN"}
+			}
+			dias, err := evento.feriados()
+			if err != nil {
+				return nil, err
+			}
+			fs = append(fs, dias...)
+			evento = nil
+		case evento == nil || anidados > 0:
+			// fuera de un evento (VCALENDAR, VTIMEZONE...) no hay nada que leer
+		case nombre == "DTSTART":
+			if evento.inicio, err = fechaICS(valor); err != nil {
+				return nil, &ErrorICS{l.numero, err.Error()}
+			}
+		case nombre == "DTEND":
+			if evento.fin, err = fechaICS(valor); err != nil {
+				return nil, &ErrorICS{l.numero, err.Error()}
+			}
+		case nombre == "SUMMARY":
+			evento.nombre = desescapar(valor)
+		case nombre == "RRULE":
+			if !strings.Contains(";"+strings.ToUpper(valor)+";", ";FREQ=YEARLY;") {
+				return nil, &ErrorICS{l.numero, "sólo se admiten eventos que se repiten cada año (FREQ=YEARLY)"}
+			}
+			evento.recurrente = true
+		}
+	}
+	if evento != nil {
+		return nil, &ErrorICS{evento.linea, "VEVENT sin END"}
+	}
+	return fs, nil
+}
+
+type lineaICS struct {
+	numero int
+	texto  string
+}
+
+// desdoblar junta las líneas que continúan en la siguiente (empiezan con
+// espacio o tabulador) y quita las vacías.
+func desdoblar(r io.Reader) ([]lineaICS, error) {
+	var lineas []lineaICS
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		texto := strings.TrimRight(s.Text(), "\r")
+		if (strings.HasPrefix(texto, " ") || strings.HasPrefix(texto, "\t")) && len(lineas) > 0 {
+			lineas[len(lineas)-1].texto += texto[1:]
+			continue
+		}
+		if texto != "" {
+			lineas = append(lineas, lineaICS{n, texto})
+		}
+	}
+	return lineas, s.Err()
+}
+
+// propiedad separa "NOMBRE;PARAM=X:valor" en nombre y valor; los parámetros
+// no se usan.
+func propiedad(l string) (nombre, valor string) {
+	i := strings.Index(l, ":")
+	if i < 0 {
+		return strings.ToUpper(l), ""
+	}
+	nombre, valor = l[:i], l[i+1:]
+	if j := strings.Index(nombre, ";"); j >= 0 {
+		nombre = nombre[:j]
+	}
+	return strings.ToUpper(nombre), valor
+}
+
+// fechaICS lee el día de un DTSTART o DTEND, sea DATE (20260916) o DATE-TIME
+// (20260916T000000Z); de la hora no se usa nada.
+func fechaICS(valor string) (time.Time, error) {
+	if len(valor) < 8 {
+		return time.Time{}, fmt.Errorf("fecha inválida %q", valor)
+	}
+	f, err := time.Parse("20060102", valor[:8])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("fecha inválida %q", valor)
+	}
+	return f, nil
+}
+
+type eventoICS struct {
+	linea      int
+	inicio     time.Time
+	fin        time.Time
+	nombre     string
+	recurrente bool
+}
+
+// feriados regresa un feriado por día del evento; DTEND es exclusivo.
+func (e *eventoICS) feriados() ([]Feriado, error) {
+	if e.inicio.IsZero() {
+		return nil, &ErrorICS{e.linea, "VEVENT sin DTSTART"}
+	}
+	fin := e.fin
+	if !fin.After(e.inicio) {
+		fin = e.inicio.AddDate(0, 0, 1)
+	}
+	if fin.After(e.inicio.AddDate(0, 0, maxDiasEvento)) {
+		return nil, &ErrorICS{e.linea, fmt.Sprintf("el evento dura más de %d días", maxDiasEvento)}
+	}
+	var fs []Feriado
+	for dia := e.inicio; dia.Before(fin); dia = dia.AddDate(0, 0, 1) {
+		fs = append(fs, Feriado{Fecha: dia, Nombre: e.nombre, Recurrente: e.recurrente, Origen: ICS})
+	}
+	return fs, nil
+}
+
+var (
+	escapeICS   = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+	unescapeICS = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+)
+
+func desescapar(s string) string {
+	return unescapeICS.Replace(s)
+}
+
+// EscribirICS escribe los feriados como un VCALENDAR de eventos de día
+// completo; los recurrentes llevan RRULE:FREQ=YEARLY. nombre es el título del
+// calendario y generado va en el DTSTAMP de cada evento.
+func EscribirICS(w io.Writer, nombre string, fs []Feriado, generado time.Time) error {
+	e := &escritorICS{w: bufio.NewWriter(w)}
+	e.linea("BEGIN:VCALENDAR")
+	e.linea("VERSION:2.0")
+	e.linea("PRODID:-//logica_tiendaenlina//feriados//ES")
+	e.linea("CALSCALE:GREGORIAN")
+	e.linea("X-WR-CALNAME:" + escapeICS.Replace(nombre))
+	sello := generado.UTC().Format("20060102T150405Z")
+	for _, f := range fs {
+		e.linea("BEGIN:VEVENT")
+		e.linea(fmt.Sprintf("UID:%s-%d-%s@feriados", f.Fecha.Format("20060102"), f.IDSucursal, f.Origen))
+		e.linea("DTSTAMP:" + sello)
+		e.linea("DTSTART;VALUE=DATE:" + f.Fecha.Format("20060102"))
+		e.linea("DTEND;VALUE=DATE:" + f.Fecha.AddDate(0, 0, 1).Format("20060102"))
+		e.linea("SUMMARY:" + escapeICS.Replace(f.Nombre))
+		if f.Recurrente {
+			e.linea("RRULE:FREQ=YEARLY")
+		}
+		e.linea("TRANSP:TRANSPARENT")
+		e.linea("END:VEVENT")
+	}
+	e.linea("END:VCALENDAR")
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+type escritorICS struct {
+	w   *bufio.Writer
+	err error
+}
+
+// linea escribe l terminada en CRLF, doblada a 75 octetos sin partir
+// caracteres UTF-8 (RFC 5545, sección 3.1).
+func (e *escritorICS) linea(l string) {
+	if e.err != nil {
+		return
+	}
+	limite := 75
+	for len(l) > limite {
+		corte := limite
+		for corte > 0 && l[corte]&0xC0 == 0x80 {
+			corte--
+		}
+		_, e.err = e.w.WriteString(l[:corte] + "\r\n ")
+		l = l[corte:]
+		limite = 74 // el espacio inicial cuenta
+	}
+	_, err := e.w.WriteString(l + "\r\n")
+	if e.err == nil {
+		e.err = err
+	}
+}
@@ -0,0 +1,339 @@
+// Package geocerca es la cobertura de entrega de las sucursales: un círculo
+// (centro y radio en km), un rectángulo (dos esquinas opuestas) o un polígono,
+// como se guardan en adm_sucursales.tipo_objeto/radio y adm_sucursales_ptos,
+// y su forma en GeoJSON (RFC 7946) para el administrador.
+package geocerca
+
+import "math"
+
+// Tipos de geocerca, como se guardan en adm_sucursales.tipo_objeto.
+const (
+	Ninguna    = "N"
+	Circulo    = "C"
+	Rectangulo = "R"
+	Poligono   = "P"
+)
+
+// radioTierra es el radio medio de la Tierra en km.
+const radioTierra = 6371
+
+// Caja que contiene el territorio de México, islas incluidas.
+const (
+	LatitudMinima  = 14.3
+	LatitudMaxima  = 32.8
+	LongitudMinima = -118.7
+	LongitudMaxima = -86.5
+)
+
+const (
+	// RadioMaximoKm limita el radio de un círculo.
+	RadioMaximoKm = 100
+	// MaxVertices limita los vértices de un polígono.
+	MaxVertices = 1000
+)
+
+// Punto es una coordenada en grados.
+type Punto struct {
+	Lat, Lng float64
+}
+
+// EnMexico dice si el punto cae en la caja de México.
+func (p Punto) EnMexico() bool {
+	return p.Lat >= LatitudMinima && p.Lat <= LatitudMaxima && p.Lng >= LongitudMinima && p.Lng <= LongitudMaxima
+}
+
+// Geocerca es el área que cubre una sucursal. Puntos es el centro del
+// círculo, dos esquinas opuestas del rectángulo o los vértices del polígono
+// en orden, sin repetir el primero.
+type Geocerca struct {
+	Tipo    string
+	Puntos  []Punto
+	RadioKm float64
+
+	// Calculados por Preparar para no repetirlos en cada punto
+	caja   *caja
+	centro Punto
+}
+
+// caja es el rectángulo que encierra la geocerca; lo que cae fuera no se
+// revisa contra los lados.
+type caja struct {
+	min, max Punto
+}
+
+func (c caja) contiene(p Punto) bool {
+	return p.Lat >= c.min.Lat && p.Lat <= c.max.Lat && p.Lng >= c.min.Lng && p.Lng <= c.max.Lng
+}
+
+// Cobertura es la geocerca de una sucursal.
+type Cobertura struct {
+	IDSucursal int
+	Nombre     string
+	Geocerca   Geocerca
+}
+
+// completa dice si la geocerca trae los puntos que pide su tipo.
+func (g Geocerca) completa() bool {
+	switch g.Tipo {
+	case Circulo:
+		return len(g.Puntos) >= 1
+	case Rectangulo:
+		return len(g.Puntos) >= 2
+	case Poligono:
+		return len(g.Puntos) >= 3
+	}
+	return false
+}
+
+// Contiene dice si p cae dentro de la geocerca.
+func (g Geocerca) Contiene(p Punto) bool {
+	if !g.completa() || g.caja != nil && !g.caja.contiene(p) {
+		return false
+	}
+	switch g.Tipo {
+	case Circulo:
+		return DistanciaKm(g.Puntos[0], p) <= g.RadioKm
+	case Rectangulo:
+		a, b := g.Puntos[0], g.Puntos[1]
+		return p.Lat >= math.Min(a.Lat, b.Lat) && p.Lat <= math.Max(a.Lat, b.Lat) &&
+			p.Lng >= math.Min(a.Lng, b.Lng) && p.Lng <= math.Max(a.Lng, b.Lng)
+	}
+	// Rayo hacia el este: dentro si cruza un número impar de lados
+	dentro := false
+	for i, j := 0, len(g.Puntos)-1; i < len(g.Puntos); j, i = i, i+1 {
+		a, b := g.Puntos[i], g.Puntos[j]
+		if (a.Lat > p.Lat) != (b.Lat > p.Lat) && p.Lng < (b.Lng-a.Lng)*(p.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lng {
+			dentro = !dentro
+		}
+	}
+	return dentro
+}
+
+// Centro es el centro del círculo, el del rectángulo o el centroide del
+// polígono.
+func (g Geocerca) Centro() Punto {
+	if g.caja != nil {
+		return g.centro
+	}
+	return g.calcularCentro()
+}
+
+func (g Geocerca) calcularCentro() Punto {
+	switch {
+	case !g.completa():
+		return Punto{}
+	case g.Tipo == Circulo:
+		return g.Puntos[0]
+	case g.Tipo == Rectangulo:
+		a, b := g.Puntos[0], g.Puntos[1]
+		return Punto{Lat: (a.Lat + b.Lat) / 2, Lng: (a.Lng + b.Lng) / 2}
+	}
+	// Relativo al primer vértice para no perder decimales con longitudes de -89
+	origen := g.Puntos[0]
+	relativos := make([]Punto, len(g.Puntos))
+	for i, p := range g.Puntos {
+		relativos[i] = Punto{Lat: p.Lat - origen.Lat, Lng: p.Lng - origen.Lng}
+	}
+	a := area(relativos)
+	var c Punto
+	if a == 0 {
+		// Degenerado: el promedio de los vértices
+		for _, p := range relativos {
+			c.Lat += p.Lat / float64(len(relativos))
+			c.Lng += p.Lng / float64(len(relativos))
+		}
+	} else {
+		for i := range relativos {
+			p, q := relativos[i], relativos[(i+1)%len(relativos)]
+			cruz := p.Lng*q.Lat - q.Lng*p.Lat
+			c.Lng += (p.Lng + q.Lng) * cruz / (6 * a)
+			c.Lat += (p.Lat + q.Lat) * cruz / (6 * a)
+		}
+	}
+	return Punto{Lat: origen.Lat + c.Lat, Lng: origen.Lng + c.Lng}
+}
+
+// DistanciaAlBorde son los km de p a la orilla de la geocerca, esté dentro o
+// fuera; infinito si la geocerca no está completa.
+func (g Geocerca) DistanciaAlBorde(p Punto) float64 {
+	if !g.completa() {
+		return math.Inf(1)
+	}
+	switch g.Tipo {
+	case Circulo:
+		return math.Abs(DistanciaKm(g.Puntos[0], p) - g.RadioKm)
+	case Rectangulo:
+		a, b := g.Puntos[0], g.Puntos[1]
+		return distanciaAlAnillo([]Punto{a, {Lat: a.Lat, Lng: b.Lng}, b, {Lat: b.Lat, Lng: a.Lng}}, p)
+	}
+	return distanciaAlAnillo(g.Puntos, p)
+}
+
+// distanciaAlAnillo es la distancia de p al lado más cercano, en una
+// proyección plana alrededor de p (sobra precisión a la escala de una
+// ciudad).
+func distanciaAlAnillo(vertices []Punto, p Punto) float64 {
+	kmLat := radioTierra * math.Pi / 180
+	kmLng := kmLat * math.Cos(p.Lat*math.Pi/180)
+	plano := func(q Punto) (x, y float64) { return (q.Lng - p.Lng) * kmLng, (q.Lat - p.Lat) * kmLat }
+	minima := math.Inf(1)
+	for i := range vertices {
+		ax, ay := plano(vertices[i])
+		bx, by := plano(vertices[(i+1)%len(vertices)])
+		// Proyección del origen (p) sobre el segmento a-b
+		dx, dy := bx-ax, by-ay
+		t := 0.0
+		if l := dx*dx + dy*dy; l > 0 {
+			t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/l))
+		}
+		minima = math.Min(minima, math.Hypot(ax+t*dx, ay+t*dy))
+	}
+	return minima
+}
+
+// Preparar calcula la caja y el centro de cada geocerca para que Contiene,
+// Centro y Asignar no los calculen en cada llamada. Regresa una copia.
+func Preparar(coberturas []Cobertura) []Cobertura {
+	preparadas := make([]Cobertura, len(coberturas))
+	for i, c := range coberturas {
+		g := c.Geocerca
+		g.caja, g.centro = nil, g.calcularCentro()
+		if g.completa() {
+			g.caja = g.calcularCaja()
+		}
+		c.Geocerca = g
+		preparadas[i] = c
+	}
+	return preparadas
+}
+
+func (g Geocerca) calcularCaja() *caja {
+	if g.Tipo == Circulo {
+		c := g.Puntos[0]
+		dLat := g.RadioKm / (radioTierra * math.Pi / 180)
+		dLng := 180.0 // cerca de los polos el círculo da toda la vuelta
+		if cos := math.Cos(c.Lat * math.Pi / 180); cos > 1e-9 {
+			dLng = math.Min(180, dLat/cos)
+		}
+		// Un poco de holgura contra el redondeo de Haversine en la orilla
+		dLat, dLng = dLat*1.001, dLng*1.001
+		return &caja{min: Punto{Lat: c.Lat - dLat, Lng: c.Lng - dLng}, max: Punto{Lat: c.Lat + dLat, Lng: c.Lng + dLng}}
+	}
+	k := &caja{min: g.Puntos[0], max: g.Puntos[0]}
+	for _, p := range g.Puntos[1:] {
+		k.min = Punto{Lat: math.Min(k.min.Lat, p.Lat), Lng: math.Min(k.min.Lng, p.Lng)}
+		k.max = Punto{Lat: math.Max(k.max.Lat, p.Lat), Lng: math.Max(k.max.Lng, p.Lng)}
+	}
+	return k
+}
+
+// Ubicacion es la sucursal que le toca a un punto. Cubierta dice si su
+// geocerca lo cubre; si no, es la de orilla más cercana. Las distancias son
+// en km.
+type Ubicacion struct {
+	Cobertura
+	Cubierta        bool
+	DistanciaBorde  float64
+	DistanciaCentro float64
+}
+
+// Asignar elige la sucursal de p: de las que lo cubren, la de centro más
+// cercano; si ninguna lo cubre, la de orilla más cercana. Sin geocercas
+// completas regresa la Ubicacion cero.
+func Asignar(coberturas []Cobertura, p Punto) Ubicacion {
+	var elegida, cercana Ubicacion
+	distCubierta, distCercana := math.Inf(1), math.Inf(1)
+	for _, c := range coberturas {
+		if !c.Geocerca.completa() {
+			continue
+		}
+		if c.Geocerca.Contiene(p) {
+			if d := DistanciaKm(c.Geocerca.Centro(), p); d < distCubierta {
+				distCubierta = d
+				elegida = Ubicacion{Cobertura: c, Cubierta: true, DistanciaCentro: d}
+			}
+			continue
+		}
+		if elegida.IDSucursal != 0 {
+			continue // ya hay una que lo cubre
+		}
+		if d := c.Geocerca.DistanciaAlBorde(p); d < distCercana {
+			distCercana = d
+			cercana = Ubicacion{Cobertura: c, DistanciaBorde: d}
+		}
+	}
+	if elegida.IDSucursal != 0 {
+		elegida.DistanciaBorde = elegida.Geocerca.DistanciaAlBorde(p)
+		return elegida
+	}
+	if cercana.IDSucursal != 0 {
+		cercana.DistanciaCentro = DistanciaKm(cercana.Geocerca.Centro(), p)
+	}
+	return cercana
+}
+
+// DistanciaKm es la distancia sobre la Tierra entre dos puntos (Haversine).
+func DistanciaKm(a, b Punto) float64 {
+	dLat := (b.Lat - a.Lat) * math.Pi / 180
+	dLng := (b.Lng - a.Lng) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(a.Lat*math.Pi/180)*math.Cos(b.Lat*math.Pi/180)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * radioTierra * math.Atan2(math.Sqrt(h), math.Sqrt(1-h))
+}
+
+// seCruza dice si algún par de lados no contiguos del polígono se toca.
+func seCruza(vertices []Punto) bool {
+	n := len(vertices)
+	for i := 0; i < n; i++ {
+		a1, a2 := vertices[i], vertices[(i+1)%n]
+		for j := i + 1; j < n; j++ {
+			if j == i+1 || (i == 0 && j == n-1) {
+				continue // lados contiguos
+			}
+			if segmentosSeTocan(a1, a2, vertices[j], vertices[(j+1)%n]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func segmentosSeTocan(p1, p2, q1, q2 Punto) bool {
+	d1, d2 := orientacion(q1, q2, p1), orientacion(q1, q2, p2)
+	d3, d4 := orientacion(p1, p2, q1), orientacion(p1, p2, q2)
+	if d1*d2 < 0 && d3*d4 < 0 {
+		return true
+	}
+	return (d1 == 0 && enSegmento(q1, q2, p1)) || (d2 == 0 && enSegmento(q1, q2, p2)) ||
+		(d3 == 0 && enSegmento(p1, p2, q1)) || (d4 == 0 && enSegmento(p1, p2, q2))
+}
+
+// orientacion es el signo del giro de a→b→c: 1 a la izquierda, -1 a la
+// derecha, 0 si son colineales.
+func orientacion(a, b, c Punto) int {
+	v := (b.Lng-a.Lng)*(c.Lat-a.Lat) - (b.Lat-a.Lat)*(c.Lng-a.Lng)
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	}
+	return 0
+}
+
+// enSegmento dice si c, colineal con a y b, cae entre ellos.
+func enSegmento(a, b, c Punto) bool {
+	return c.Lat >= math.Min(a.Lat, b.Lat) && c.Lat <= math.Max(a.Lat, b.Lat) &&
+		c.Lng >= math.Min(a.Lng, b.Lng) && c.Lng <= math.Max(a.Lng, b.Lng)
+}
+
+// area es el área con signo del polígono en grados², por la fórmula del
+// agrimensor.
+func area(vertices []Punto) float64 {
+	suma := 0.0
+	for i := range vertices {
+		a, b := vertices[i], vertices[(i+1)%len(vertices)]
+		suma += a.Lng*b.Lat - b.Lng*a.Lat
+	}
+	return suma / 2
+}
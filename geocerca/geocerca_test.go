@@ -0,0 +1,288 @@
+package geocerca
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+)
+
+func feature(t *testing.T, s string) Feature {
+	t.Helper()
+	var f Feature
+	if err := json.Unmarshal([]byte(s), &f); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestDesdeGeoJSON(t *testing.T) {
+	casos := []struct {
+		nombre string
+		json   string
+		tipo   string
+		puntos int
+		campo  string
+		codigo errores.CodigoCampo
+	}{
+		{"círculo", `{"type": "Feature", "geometry": {"type": "Point", "coordinates": [-89.62, 21.05]}, "properties": {"radio_km": 3}}`, Circulo, 1, "", ""},
+		{"sin cobertura", `{"type": "Feature", "geometry": null, "properties": {}}`, Ninguna, 0, "", ""},
+		{"polígono", `{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[-89.64, 20.95], [-89.60, 20.95], [-89.62, 20.99], [-89.64, 20.95]]]}}`, Poligono, 3, "", ""},
+		{"rectángulo", `{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[-89.60, 20.99], [-89.64, 20.99], [-89.64, 20.95], [-89.60, 20.95], [-89.60, 20.99]]]}, "properties": {"tipo": "rectangulo"}}`, Rectangulo, 2, "", ""},
+
+		{"círculo sin radio", `{"type": "Feature", "geometry": {"type": "Point", "coordinates": [-89.62, 21.05]}, "properties": {}}`, "", 0, "properties.radio_km", errores.CampoRequerido},
+		{"radio enorme", `{"type": "Feature", "geometry": {"type": "Point", "coordinates": [-89.62, 21.05]}, "properties": {"radio_km": 500}}`, "", 0, "properties.radio_km", errores.CampoFueraDeRango},
+		{"centro en Cuba", `{"type": "Feature", "geometry": {"type": "Point", "coordinates": [-82.38, 23.13]}, "properties": {"radio_km": 3}}`, "", 0, "geometry.coordinates", errores.CampoFueraDeMexico},
+		{"abierto", `{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[-89.64, 20.95], [-89.60, 20.95], [-89.62, 20.99], [-89.63, 20.98]]]}}`, "", 0, "geometry.coordinates[0]", errores.CampoPoligonoAbierto},
+		{"moño", `{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[-89.64, 20.95], [-89.60, 20.99], [-89.60, 20.95], [-89.64, 20.99], [-89.64, 20.95]]]}}`, "", 0, "geometry.coordinates[0]", errores.CampoPoligonoCruzado},
+		{"vértice fuera", `{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[-89.64, 20.95], [-80.0, 20.95], [-89.62, 20.99], [-89.64, 20.95]]]}}`, "", 0, "geometry.coordinates[0][1]", errores.CampoFueraDeMexico},
+		{"dos puntos", `{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[-89.64, 20.95], [-89.60, 20.95], [-89.64, 20.95]]]}}`, "", 0, "geometry.coordinates[0]", errores.CampoNumeroDePuntos},
+		{"con hueco", `{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[-89.64, 20.95], [-89.60, 20.95], [-89.62, 20.99], [-89.64, 20.95]], [[-89.62, 20.96], [-89.61, 20.96], [-89.62, 20.97], [-89.62, 20.96]]]}}`, "", 0, "geometry.coordinates", errores.CampoNumeroDePuntos},
+		{"colineal", `{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[-89.64, 20.95], [-89.62, 20.95], [-89.60, 20.95], [-89.64, 20.95]]]}}`, "", 0, "geometry.coordinates[0]", errores.CampoInvalido},
+		{"rectángulo chueco", `{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[-89.64, 20.95], [-89.60, 20.96], [-89.60, 20.99], [-89.64, 20.99], [-89.64, 20.95]]]}, "properties": {"tipo": "rectangulo"}}`, "", 0, "geometry.coordinates[0]", errores.CampoInvalido},
+		{"tipo desconocido", `{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[-89.64, 20.95], [-89.60, 20.95], [-89.62, 20.99], [-89.64, 20.95]]]}, "properties": {"tipo": "hexagono"}}`, "", 0, "properties.tipo", errores.CampoNoPermitido},
+	}
+	for _, c := range casos {
+		g, campos := DesdeGeoJSON(feature(t, c.json))
+		if c.campo != "" {
+			if len(campos) == 0 || campos[0].Campo != c.campo || campos[0].Codigo != c.codigo {
+				t.Errorf("%s: %+v, se esperaba %s %s", c.nombre, campos, c.campo, c.codigo)
+			}
+			continue
+		}
+		if len(campos) > 0 || g.Tipo != c.tipo || len(g.Puntos) != c.puntos {
+			t.Errorf("%s: %+v %+v", c.nombre, g, campos)
+		}
+	}
+}
+
+func TestContiene(t *testing.T) {
+
+	casos := []struct {
+		nombre string
+		g      Geocerca
+		p      Punto
+		dentro bool
+	}{
+		{"centro del cuadro", cuadro, Punto{20.97, -89.62}, true},
+		{"fuera del cuadro", cuadro, Punto{21.00, -89.62}, false},
+		{"brazo de la L", ele, Punto{20.96, -89.61}, true},
+		{"hueco de la L", ele, Punto{20.98, -89.61}, false},
+		{"rectángulo por esquinas invertidas", rectangulo, Punto{20.97, -89.62}, true},
+		{"fuera del rectángulo", rectangulo, Punto{20.97, -89.59}, false},
+		{"dentro del círculo", circulo, Punto{21.06, -89.62}, true},
+		{"a 5 km del centro", circulo, Punto{21.095, -89.62}, false},
+		{"sin cobertura", Geocerca{Tipo: Ninguna}, Punto{20.97, -89.62}, false},
+	}
+	for _, c := range casos {
+		if got := c.g.Contiene(c.p); got != c.dentro {
+			t.Errorf("%s: Contiene = %v", c.nombre, got)
+		}
+		preparada := Preparar([]Cobertura{{Geocerca: c.g}})[0].Geocerca
+		if got := preparada.Contiene(c.p); got != c.dentro {
+			t.Errorf("%s: Contiene preparada = %v", c.nombre, got)
+		}
+	}
+}
+
+func TestGeoJSONIdaYVuelta(t *testing.T) {
+	geocercas := []Geocerca{
+		{Tipo: Circulo, Puntos: []Punto{{21.05, -89.62}}, RadioKm: 3},
+		{Tipo: Rectangulo, Puntos: []Punto{{20.95, -89.64}, {20.99, -89.60}}},
+		{Tipo: Poligono, Puntos: []Punto{{20.95, -89.64}, {20.95, -89.60}, {20.99, -89.60}, {20.99, -89.64}}},
+		{Tipo: Ninguna},
+	}
+	for _, g := range geocercas {
+		f := g.GeoJSON(map[string]any{"id_sucursal": 1})
+		if f.Properties["id_sucursal"] != 1 {
+			t.Errorf("%s: properties = %v", g.Tipo, f.Properties)
+		}
+		// Como llega en el cuerpo de la petición
+		b, err := json.Marshal(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leida, campos := DesdeGeoJSON(feature(t, string(b)))
+		if len(campos) > 0 || leida.Tipo != g.Tipo || len(leida.Puntos) != len(g.Puntos) || leida.RadioKm != g.RadioKm {
+			t.Errorf("%s: %s volvió como %+v %+v", g.Tipo, b, leida, campos)
+			continue
+		}
+		for i := range g.Puntos {
+			if leida.Puntos[i] != g.Puntos[i] {
+				t.Errorf("%s: punto %d = %v, se esperaba %v", g.Tipo, i, leida.Puntos[i], g.Puntos[i])
+			}
+		}
+	}
+}
+
+func TestAsignar(t *testing.T) {
+	centro := Cobertura{IDSucursal: 1, Nombre: "Centro", Geocerca: cuadro}
+	norte := Cobertura{IDSucursal: 2, Nombre: "Norte", Geocerca: circulo}
+	sinCobertura := Cobertura{IDSucursal: 3, Nombre: "Sin cobertura", Geocerca: Geocerca{Tipo: Ninguna}}
+	// Un círculo grande que también cubre el centro pero con el centro lejos
+	grande := Cobertura{IDSucursal: 4, Nombre: "Grande", Geocerca: Geocerca{Tipo: Circulo, Puntos: []Punto{{20.95, -89.75}}, RadioKm: 15}}
+	coberturas := []Cobertura{sinCobertura, norte, grande, centro}
+
+	casos := []struct {
+		nombre    string
+		p         Punto
+		sucursal  int
+		cubierta  bool
+		distBorde float64
+	}{
+		{"dentro del centro y del grande: gana el centro más cercano", Punto{20.97, -89.62}, 1, true, 2.077},
+		{"dentro del norte", Punto{21.04, -89.62}, 2, true, 1.888},
+		{"sólo en el grande", Punto{21.00, -89.75}, 4, true, 9.440},
+		{"fuera de todas: la orilla más cercana", Punto{21.12, -89.62}, 2, false, 4.783},
+	}
+	for _, c := range casos {
+		u := Asignar(coberturas, c.p)
+		if u.IDSucursal != c.sucursal || u.Cubierta != c.cubierta || math.Abs(u.DistanciaBorde-c.distBorde) > 0.01 {
+			t.Errorf("%s: sucursal %d cubierta %v borde %.3f", c.nombre, u.IDSucursal, u.Cubierta, u.DistanciaBorde)
+		}
+		if u.DistanciaCentro != DistanciaKm(u.Geocerca.Centro(), c.p) {
+			t.Errorf("%s: DistanciaCentro = %v", c.nombre, u.DistanciaCentro)
+		}
+		// Preparadas dan lo mismo
+		if p := Asignar(Preparar(coberturas), c.p); p.IDSucursal != u.IDSucursal || p.DistanciaBorde != u.DistanciaBorde {
+			t.Errorf("%s: preparadas = %+v", c.nombre, p)
+		}
+	}
+	if u := Asignar([]Cobertura{sinCobertura}, Punto{20.97, -89.62}); u.IDSucursal != 0 {
+		t.Errorf("sin geocercas completas: %d", u.IDSucursal)
+	}
+}
+
+// La L es el cuadro sin su cuarto noreste.
+var (
+	cuadro     = Geocerca{Tipo: Poligono, Puntos: []Punto{{20.95, -89.64}, {20.95, -89.60}, {20.99, -89.60}, {20.99, -89.64}}}
+	circulo    = Geocerca{Tipo: Circulo, Puntos: []Punto{{21.05, -89.62}}, RadioKm: 3}
+	ele        = Geocerca{Tipo: Poligono, Puntos: []Punto{{20.95, -89.64}, {20.95, -89.60}, {20.97, -89.60}, {20.97, -89.62}, {20.99, -89.62}, {20.99, -89.64}}}
+	triangulo  = Geocerca{Tipo: Poligono, Puntos: []Punto{{20.95, -89.64}, {20.95, -89.60}, {20.98, -89.62}}}
+	rectangulo = Geocerca{Tipo: Rectangulo, Puntos: []Punto{{20.99, -89.60}, {20.95, -89.64}}}
+)
+
+func TestDistanciaAlBorde(t *testing.T) {
+	// A 21° de latitud un grado mide 111.19 km de norte a sur y 103.8 km de
+	// este a oeste
+	casos := []struct {
+		nombre string
+		g      Geocerca
+		p      Punto
+		km     float64
+	}{
+		{"centro del círculo", circulo, Punto{21.05, -89.62}, 3},
+		{"fuera del círculo", circulo, Punto{21.14, -89.62}, 7.007},
+		{"en la orilla del círculo", circulo, Punto{21.05 + 3/111.19, -89.62}, 0},
+		{"centro del rectángulo", rectangulo, Punto{20.97, -89.62}, 2.077},
+		{"al este del rectángulo", rectangulo, Punto{20.97, -89.58}, 2.077},
+		{"frente a una esquina del rectángulo", rectangulo, Punto{21.00, -89.59}, 1.521},
+		{"dentro del cuadro cerca del sur", cuadro, Punto{20.955, -89.62}, 0.556},
+		{"en el hueco de la L", ele, Punto{20.98, -89.61}, 1.038},
+		{"sobre un vértice", ele, Punto{20.97, -89.62}, 0},
+		{"sin cobertura", Geocerca{Tipo: Ninguna}, Punto{20.97, -89.62}, math.Inf(1)},
+	}
+	for _, c := range casos {
+		got := c.g.DistanciaAlBorde(c.p)
+		if math.IsInf(c.km, 1) != math.IsInf(got, 1) || !math.IsInf(got, 1) && math.Abs(got-c.km) > 0.01 {
+			t.Errorf("%s: %.3f km, se esperaban %.3f", c.nombre, got, c.km)
+		}
+	}
+}
+
+func TestCentro(t *testing.T) {
+	casos := []struct {
+		nombre string
+		g      Geocerca
+		centro Punto
+	}{
+		{"círculo", circulo, Punto{21.05, -89.62}},
+		{"rectángulo", rectangulo, Punto{20.97, -89.62}},
+		{"cuadro", cuadro, Punto{20.97, -89.62}},
+		{"triángulo", triangulo, Punto{20.96, -89.62}},
+		// El cuadro sin su cuarto noreste
+		{"L", ele, Punto{20.96667, -89.62333}},
+	}
+	for _, c := range casos {
+		got := c.g.Centro()
+		if math.Abs(got.Lat-c.centro.Lat) > 1e-5 || math.Abs(got.Lng-c.centro.Lng) > 1e-5 {
+			t.Errorf("%s: centro = %v, se esperaba %v", c.nombre, got, c.centro)
+		}
+	}
+}
+
+func TestMotor(t *testing.T) {
+	cargas := 0
+	geocercas := map[int][]Cobertura{1: {{IDSucursal: 1, Nombre: "Centro", Geocerca: cuadro}}}
+	m := NuevoMotor(func(_ context.Context, idEmpresa int) ([]Cobertura, error) {
+		cargas++
+		return geocercas[idEmpresa], nil
+	}, time.Minute)
+	ahora := time.Date(2026, time.October, 19, 12, 0, 0, 0, time.UTC)
+	m.ahora = func() time.Time { return ahora }
+	ctx := context.Background()
+	dentro := Punto{20.97, -89.62}
+
+	if u, err := m.Asignar(ctx, 1, dentro); err != nil || u.IDSucursal != 1 || !u.Cubierta {
+		t.Fatalf("Asignar = %+v, %v", u, err)
+	}
+	m.Asignar(ctx, 1, dentro)
+	if cargas != 1 {
+		t.Errorf("cargas = %d, las geocercas debían leerse una vez", cargas)
+	}
+
+	// Un cambio en la base no se ve hasta invalidar o vencer el TTL
+	geocercas[1] = []Cobertura{{IDSucursal: 2, Nombre: "Norte", Geocerca: circulo}}
+	if u, _ := m.Asignar(ctx, 1, dentro); u.IDSucursal != 1 {
+		t.Errorf("antes de invalidar: sucursal %d", u.IDSucursal)
+	}
+	m.Invalidar(1)
+	if u, _ := m.Asignar(ctx, 1, dentro); u.IDSucursal != 2 || u.Cubierta {
+		t.Errorf("después de invalidar: %+v", u)
+	}
+	geocercas[1] = []Cobertura{{IDSucursal: 1, Nombre: "Centro", Geocerca: cuadro}}
+	ahora = ahora.Add(time.Minute)
+	if u, _ := m.Asignar(ctx, 1, dentro); u.IDSucursal != 1 || cargas != 3 {
+		t.Errorf("al vencer el TTL: sucursal %d, %d cargas", u.IDSucursal, cargas)
+	}
+
+	if _, err := m.Asignar(ctx, 2, dentro); !errors.Is(err, ErrSinSucursales) {
+		t.Errorf("empresa sin geocercas: %v", err)
+	}
+	falla := errors.New("sin conexión")
+	m = NuevoMotor(func(context.Context, int) ([]Cobertura, error) { return nil, falla }, 0)
+	if _, err := m.Asignar(ctx, 1, dentro); !errors.Is(err, falla) {
+		t.Errorf("error al cargar: %v", err)
+	}
+}
+
+// Cien sucursales con polígonos de 50 vértices; el punto no cae en ninguna,
+// el peor caso.
+func BenchmarkAsignar(b *testing.B) {
+	var cs []Cobertura
+	for i := 0; i < 100; i++ {
+		centro := Punto{Lat: 19 + float64(i%10)*0.1, Lng: -99.5 + float64(i/10)*0.1}
+		var vertices []Punto
+		for v := 0; v < 50; v++ {
+			angulo := 2 * math.Pi * float64(v) / 50
+			vertices = append(vertices, Punto{Lat: centro.Lat + 0.03*math.Sin(angulo), Lng: centro.Lng + 0.03*math.Cos(angulo)})
+		}
+		cs = append(cs, Cobertura{IDSucursal: i + 1, Geocerca: Geocerca{Tipo: Poligono, Puntos: vertices}})
+	}
+	p := Punto{Lat: 20.5, Lng: -98.0}
+	b.Run("sin preparar", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			Asignar(cs, p)
+		}
+	})
+	preparadas := Preparar(cs)
+	b.Run("preparadas", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			Asignar(preparadas, p)
+		}
+	})
+}
@@ -0,0 +1,176 @@
+package geocerca
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+)
+
+// Valores de properties.tipo en el GeoJSON de una geocerca.
+const (
+	tipoNinguna    = "ninguna"
+	tipoCirculo    = "circulo"
+	tipoRectangulo = "rectangulo"
+	tipoPoligono   = "poligono"
+)
+
+// Feature es una geocerca en GeoJSON. El círculo es un Point con
+// properties.radio_km; el rectángulo y el polígono son un Polygon de un solo
+// anillo, y el rectángulo lleva properties.tipo "rectangulo". Sin geometry la
+// sucursal no tiene cobertura. Las coordenadas van en [longitud, latitud].
+type Feature struct {
+	Type       string         `json:"type" valida:"requerido,uno_de=Feature"`
+	ID         any            `json:"id,omitempty"`
+	BBox       []float64      `json:"bbox,omitempty"`
+	Geometry   *Geometria     `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
+
+// Geometria es la geometry de un Feature.
+type Geometria struct {
+	Type        string          `json:"type" valida:"requerido,uno_de=Point|Polygon"`
+	BBox        []float64       `json:"bbox,omitempty"`
+	Coordinates json.RawMessage `json:"coordinates" valida:"requerido"`
+}
+
+// DesdeGeoJSON lee y valida la geocerca: el círculo con radio de más de 0 y
+// hasta RadioMaximoKm, el anillo cerrado, sin lados que se crucen y con el
+// rectángulo alineado a los ejes; todos los puntos dentro de México. Los
+// errores salen con el nombre del campo en el GeoJSON.
+func DesdeGeoJSON(f Feature) (Geocerca, []errores.Campo) {
+	if f.Geometry == nil {
+		return Geocerca{Tipo: Ninguna}, nil
+	}
+	tipo, _ := f.Properties["tipo"].(string)
+	if f.Geometry.Type == "Point" {
+		if tipo != "" && tipo != tipoCirculo {
+			return Geocerca{}, []errores.Campo{errores.NuevoCampo("properties.tipo", errores.CampoNoPermitido, tipoCirculo)}
+		}
+		return circuloDesde(f)
+	}
+	if tipo != "" && tipo != tipoPoligono && tipo != tipoRectangulo {
+		return Geocerca{}, []errores.Campo{errores.NuevoCampo("properties.tipo", errores.CampoNoPermitido, tipoPoligono+", "+tipoRectangulo)}
+	}
+
+	var anillos [][][]float64
+	if err := json.Unmarshal(f.Geometry.Coordinates, &anillos); err != nil || len(anillos) == 0 {
+		return Geocerca{}, []errores.Campo{errores.Invalido("geometry.coordinates")}
+	}
+	if len(anillos) > 1 {
+		// Los huecos no tienen sentido para una zona de reparto
+		return Geocerca{}, []errores.Campo{errores.NuevoCampo("geometry.coordinates", errores.CampoNumeroDePuntos, 1, 1)}
+	}
+	anillo := anillos[0]
+	if len(anillo) < 4 || len(anillo) > MaxVertices+1 {
+		return Geocerca{}, []errores.Campo{errores.NuevoCampo("geometry.coordinates[0]", errores.CampoNumeroDePuntos, 4, MaxVertices+1)}
+	}
+	puntos := make([]Punto, len(anillo))
+	for i, c := range anillo {
+		campo := fmt.Sprintf("geometry.coordinates[0][%d]", i)
+		if len(c) < 2 {
+			return Geocerca{}, []errores.Campo{errores.Invalido(campo)}
+		}
+		puntos[i] = Punto{Lat: c[1], Lng: c[0]}
+		if !puntos[i].EnMexico() {
+			return Geocerca{}, []errores.Campo{errores.NuevoCampo(campo, errores.CampoFueraDeMexico)}
+		}
+	}
+	if puntos[0] != puntos[len(puntos)-1] {
+		return Geocerca{}, []errores.Campo{errores.NuevoCampo("geometry.coordinates[0]", errores.CampoPoligonoAbierto)}
+	}
+	vertices := puntos[:len(puntos)-1]
+
+	if tipo == tipoRectangulo {
+		return rectanguloDesde(vertices)
+	}
+	if seCruza(vertices) {
+		return Geocerca{}, []errores.Campo{errores.NuevoCampo("geometry.coordinates[0]", errores.CampoPoligonoCruzado)}
+	}
+	if area(vertices) == 0 {
+		return Geocerca{}, []errores.Campo{errores.Invalido("geometry.coordinates[0]")}
+	}
+	return Geocerca{Tipo: Poligono, Puntos: vertices}, nil
+}
+
+func circuloDesde(f Feature) (Geocerca, []errores.Campo) {
+	var c []float64
+	if err := json.Unmarshal(f.Geometry.Coordinates, &c); err != nil || len(c) < 2 {
+		return Geocerca{}, []errores.Campo{errores.Invalido("geometry.coordinates")}
+	}
+	centro := Punto{Lat: c[1], Lng: c[0]}
+	var campos []errores.Campo
+	if !centro.EnMexico() {
+		campos = append(campos, errores.NuevoCampo("geometry.coordinates", errores.CampoFueraDeMexico))
+	}
+	radio, ok := f.Properties["radio_km"].(float64)
+	switch {
+	case !ok:
+		campos = append(campos, errores.Requerido("properties.radio_km"))
+	case radio <= 0 || radio > RadioMaximoKm:
+		campos = append(campos, errores.NuevoCampo("properties.radio_km", errores.CampoFueraDeRango, 0, RadioMaximoKm))
+	}
+	if len(campos) > 0 {
+		return Geocerca{}, campos
+	}
+	return Geocerca{Tipo: Circulo, Puntos: []Punto{centro}, RadioKm: radio}, nil
+}
+
+// rectanguloDesde pide cuatro esquinas con los lados sobre los ejes y guarda
+// la suroeste y la noreste.
+func rectanguloDesde(v []Punto) (Geocerca, []errores.Campo) {
+	invalido := []errores.Campo{errores.Invalido("geometry.coordinates[0]")}
+	if len(v) != 4 {
+		return Geocerca{}, []errores.Campo{errores.NuevoCampo("geometry.coordinates[0]", errores.CampoNumeroDePuntos, 5, 5)}
+	}
+	for i := range v {
+		a, b := v[i], v[(i+1)%4]
+		if (a.Lat == b.Lat) == (a.Lng == b.Lng) {
+			return Geocerca{}, invalido
+		}
+	}
+	suroeste := Punto{Lat: math.Min(v[0].Lat, v[2].Lat), Lng: math.Min(v[0].Lng, v[2].Lng)}
+	noreste := Punto{Lat: math.Max(v[0].Lat, v[2].Lat), Lng: math.Max(v[0].Lng, v[2].Lng)}
+	return Geocerca{Tipo: Rectangulo, Puntos: []Punto{suroeste, noreste}}, nil
+}
+
+// GeoJSON es la geocerca como Feature; properties lleva tipo (y radio_km en
+// el círculo) además de las que se pasen. El rectángulo sale como anillo en
+// sentido antihorario desde la esquina suroeste.
+func (g Geocerca) GeoJSON(properties map[string]any) Feature {
+	f := Feature{Type: "Feature", Properties: map[string]any{}}
+	for k, v := range properties {
+		f.Properties[k] = v
+	}
+	if !g.completa() {
+		f.Properties["tipo"] = tipoNinguna
+		return f
+	}
+	var anillo [][]float64
+	switch g.Tipo {
+	case Circulo:
+		c := g.Puntos[0]
+		f.Properties["tipo"] = tipoCirculo
+		f.Properties["radio_km"] = g.RadioKm
+		f.Geometry = geometria("Point", []float64{c.Lng, c.Lat})
+		return f
+	case Rectangulo:
+		a, b := g.Puntos[0], g.Puntos[1]
+		f.Properties["tipo"] = tipoRectangulo
+		anillo = [][]float64{{a.Lng, a.Lat}, {b.Lng, a.Lat}, {b.Lng, b.Lat}, {a.Lng, b.Lat}, {a.Lng, a.Lat}}
+	default:
+		f.Properties["tipo"] = tipoPoligono
+		for _, p := range append(g.Puntos, g.Puntos[0]) {
+			anillo = append(anillo, []float64{p.Lng, p.Lat})
+		}
+	}
+	f.Geometry = geometria("Polygon", [][][]float64{anillo})
+	return f
+}
+
+func geometria(tipo string, coordenadas any) *Geometria {
+	// Sólo hay números: no puede fallar
+	c, _ := json.Marshal(coordenadas)
+	return &Geometria{Type: tipo, Coordinates: c}
+}
@@ -0,0 +1,105 @@
+package geocerca
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TTLPredeterminado es cada cuánto se vuelven a leer las geocercas si nadie
+// las invalida antes.
+const TTLPredeterminado = 5 * time.Minute
+
+// ErrSinSucursales indica que la empresa no tiene sucursales con geocerca.
+var ErrSinSucursales = errors.New("no hay sucursales con geocerca")
+
+// Cargador lee las coberturas de las sucursales activas de una empresa.
+type Cargador func(ctx context.Context, idEmpresa int) ([]Cobertura, error)
+
+// Motor asigna sucursales con las geocercas en memoria: las de cada empresa
+// se cargan la primera vez que se piden y se vuelven a cargar al vencer el TTL
+// o después de Invalidar. Es seguro usarlo desde varias goroutines.
+type Motor struct {
+	cargar Cargador
+	ttl    time.Duration
+	ahora  func() time.Time
+
+	mu       sync.Mutex
+	empresas map[int]cargadas
+}
+
+type cargadas struct {
+	coberturas []Cobertura
+	vence      time.Time
+}
+
+// NuevoMotor crea un motor que lee con cargar; ttl <= 0 es TTLPredeterminado.
+func NuevoMotor(cargar Cargador, ttl time.Duration) *Motor {
+	if ttl <= 0 {
+		ttl = TTLPredeterminado
+	}
+	return &Motor{cargar: cargar, ttl: ttl, ahora: time.Now, empresas: map[int]cargadas{}}
+}
+
+// TTLDesdeEnv lee GEOCERCAS_TTL (duración de Go, p. ej. "10m", o segundos);
+// sin valor o inválido es TTLPredeterminado.
+func TTLDesdeEnv() time.Duration {
+	valor := os.Getenv("GEOCERCAS_TTL")
+	if valor == "" {
+		return TTLPredeterminado
+	}
+	if d, err := time.ParseDuration(valor); err == nil && d > 0 {
+		return d
+	}
+	if seg, err := strconv.Atoi(valor); err == nil && seg > 0 {
+		return time.Duration(seg) * time.Second
+	}
+	slog.Warn("GEOCERCAS_TTL inválido, usando valor por defecto", "valor", valor, "por_defecto", TTLPredeterminado.String())
+	return TTLPredeterminado
+}
+
+// Coberturas regresa las geocercas de la empresa ya preparadas, cargándolas
+// si no están o vencieron. El slice es compartido: no se debe modificar.
+func (m *Motor) Coberturas(ctx context.Context, idEmpresa int) ([]Cobertura, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ahora := m.ahora()
+	if c, ok := m.empresas[idEmpresa]; ok && ahora.Before(c.vence) {
+		return c.coberturas, nil
+	}
+	// Se carga con el candado puesto: las recargas son pocas y así dos
+	// peticiones simultáneas no van las dos a la base
+	cs, err := m.cargar(ctx, idEmpresa)
+	if err != nil {
+		return nil, err
+	}
+	preparadas := Preparar(cs)
+	m.empresas[idEmpresa] = cargadas{coberturas: preparadas, vence: ahora.Add(m.ttl)}
+	return preparadas, nil
+}
+
+// Invalidar hace que la próxima consulta de la empresa vuelva a leer las
+// geocercas.
+func (m *Motor) Invalidar(idEmpresa int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.empresas, idEmpresa)
+}
+
+// Asignar es Asignar con las geocercas de la empresa; ErrSinSucursales si
+// ninguna tiene geocerca.
+func (m *Motor) Asignar(ctx context.Context, idEmpresa int, p Punto) (Ubicacion, error) {
+	cs, err := m.Coberturas(ctx, idEmpresa)
+	if err != nil {
+		return Ubicacion{}, err
+	}
+	u := Asignar(cs, p)
+	if u.IDSucursal == 0 {
+		return Ubicacion{}, ErrSinSucursales
+	}
+	return u, nil
+}
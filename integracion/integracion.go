@@ -0,0 +1,138 @@
+// Package integracion levanta, dentro del proceso de pruebas, dos servidores
+// compatibles con el protocolo de MySQL (go-mysql-server en memoria) para los
+// papeles de base local y remota. Iniciar aplica las migraciones a la local,
+// crea en la remota las tablas del ERP que usa el servicio y carga los datos
+// fijos de sql/semilla_*.sql, así los handlers se prueban con SQL real y el
+// mismo driver que en producción.
+package integracion
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/db"
+	"github.com/WolfSlayer04/logica_tiendaenlina/migraciones"
+
+	sqle "github.com/dolthub/go-mysql-server"
+	"github.com/dolthub/go-mysql-server/memory"
+	"github.com/dolthub/go-mysql-server/server"
+	gmssql "github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/expression/function/spatial"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/sirupsen/logrus"
+)
+
+//go:embed sql/*.sql
+var archivos embed.FS
+
+// Datos fijos cargados por Iniciar (sql/semilla_local.sql y sql/semilla_remota.sql).
+const (
+	IDEmpresa         = 1
+	DominioEmpresa    = "abarrotes.example.com"
+	IDSucursalCentro  = 1 // polígono alrededor de (20.97, -89.62)
+	IDSucursalNorte   = 2 // círculo de 3 km con centro en (21.05, -89.62)
+	IDSucursalCerrada = 3
+	IDProductoIVA     = 100 // IVA 16 %
+	IDProductoIEPS    = 200 // IVA 16 % + IEPS 8 %
+	IDUsuarioCliente  = 1
+	IDTiendaCliente   = 1
+	IDDireccion       = 1 // predeterminada de la tienda, en (20.97, -89.62)
+	IDClienteRemoto   = 1
+	CorreoCliente     = "cliente@example.com"
+	CorreoSuspendido  = "suspendido@example.com"
+	CorreoAdmin       = "admin@example.com"
+	IDAdmin           = 1 // de todo el grupo
+	// Segunda empresa: su sucursal cubre el mismo punto que Centro.
+	IDOtraEmpresa     = 2
+	DominioOtra       = "ferreteria.example.com"
+	IDSucursalOtra    = 4
+	IDProductoOtra    = 300
+	CorreoAdminOtra   = "admin@ferreteria.example.com"
+	IDEmpresaInactiva = 3
+	ClaveUsuarios     = "secreta" // de todos los usuarios y admins de la semilla
+	BaseLocal         = "tienda_local"
+	BaseRemota        = "erp_remoto"
+	esperaServidor    = 5 * time.Second
+)
+
+func init() {
+	// go-mysql-server escribe cada conexión y consulta con logrus.
+	logrus.SetOutput(io.Discard)
+}
+
+// Iniciar arranca las dos bases con el esquema y la semilla cargados. Los
+// servidores y las conexiones se cierran al terminar la prueba.
+func Iniciar(t testing.TB) *db.DBConnection {
+	t.Helper()
+	ctx := context.Background()
+
+	local := servidor(t, BaseLocal)
+	if _, err := migraciones.Aplicar(ctx, local); err != nil {
+		t.Fatalf("aplicando migraciones locales: %v", err)
+	}
+	ejecutarArchivo(t, local, "sql/semilla_local.sql")
+
+	remota := servidor(t, BaseRemota)
+	ejecutarArchivo(t, remota, "sql/erp.sql")
+	ejecutarArchivo(t, remota, "sql/semilla_remota.sql")
+
+	return &db.DBConnection{Local: local, Remote: remota}
+}
+
+// servidor levanta una base vacía en un puerto libre de 127.0.0.1 y regresa
+// un pool conectado a ella con el driver de MySQL.
+func servidor(t testing.TB, nombre string) *sql.DB {
+	t.Helper()
+	base := memory.NewDatabase(nombre)
+	base.EnablePrimaryKeyIndexes()
+	proveedor := memory.NewDBProvider(base)
+	motor := sqle.NewDefault(proveedor)
+	// go-mysql-server no trae ST_Contains. Para un punto contra un polígono,
+	// ST_Intersects da lo mismo salvo en el borde, que las pruebas no usan.
+	motor.Analyzer.Catalog.RegisterFunction(gmssql.NewEmptyContext(), gmssql.Function2{Name: "st_contains", Fn: spatial.NewIntersects})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("abriendo puerto para %s: %v", nombre, err)
+	}
+	cfg := server.Config{Protocol: "tcp", Address: l.Addr().String(), Listener: l}
+	s, err := server.NewServer(cfg, motor, gmssql.NewContext, memory.NewSessionBuilder(proveedor), nil)
+	if err != nil {
+		l.Close()
+		t.Fatalf("creando servidor %s: %v", nombre, err)
+	}
+	go s.Start()
+	t.Cleanup(func() { s.Close() })
+
+	conn, err := sql.Open("mysql", fmt.Sprintf("root@tcp(%s)/%s", l.Addr(), nombre))
+	if err != nil {
+		t.Fatalf("abriendo conexión a %s: %v", nombre, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), esperaServidor)
+	defer cancel()
+	if err := conn.PingContext(ctx); err != nil {
+		t.Fatalf("el servidor %s no responde: %v", nombre, err)
+	}
+	return conn
+}
+
+func ejecutarArchivo(t testing.TB, conn *sql.DB, archivo string) {
+	t.Helper()
+	contenido, err := archivos.ReadFile(archivo)
+	if err != nil {
+		t.Fatalf("leyendo %s: %v", archivo, err)
+	}
+	for _, s := range migraciones.Sentencias(string(contenido)) {
+		if _, err := conn.Exec(s); err != nil {
+			t.Fatalf("%s: %v\n%s", archivo, err, s)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package integracion
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/migraciones"
+)
+
+// El ERP de prueba debe cumplir lo mismo que se le exige al de producción.
+func TestEsquemaRemotoDePrueba(t *testing.T) {
+	dbc := Iniciar(t)
+	diferencias, err := migraciones.VerificarRemoto(context.Background(), dbc.Remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range diferencias {
+		t.Error(d)
+	}
+}
+
+func TestMigracionesAplicadas(t *testing.T) {
+	dbc := Iniciar(t)
+	estados, err := migraciones.Estados(context.Background(), dbc.Local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range estados {
+		if !e.Aplicada {
+			t.Errorf("migración %04d_%s sin aplicar", e.Version, e.Nombre)
+		}
+	}
+}
+
+// Una migración que falló a la mitad se reintenta desde el principio: lo que
+// ya hizo no debe romperla ni duplicarse. Revertir no pasa de 0004.
+func TestMigracionesReintentables(t *testing.T) {
+	dbc := Iniciar(t)
+	ctx := context.Background()
+	direcciones := contarFilas(t, dbc.Local, "direcciones_tienda")
+	configuraciones := contarFilas(t, dbc.Local, "config_entrega")
+
+	if _, err := dbc.Local.Exec("DELETE FROM schema_migrations WHERE version >= 4"); err != nil {
+		t.Fatal(err)
+	}
+	aplicadas, err := migraciones.Aplicar(ctx, dbc.Local)
+	if err != nil {
+		t.Fatalf("reaplicando: %v", err)
+	}
+	if len(aplicadas) == 0 || aplicadas[0].Version != 4 {
+		t.Fatalf("reaplicadas = %d", len(aplicadas))
+	}
+	if n := contarFilas(t, dbc.Local, "direcciones_tienda"); n != direcciones {
+		t.Errorf("direcciones_tienda = %d, había %d", n, direcciones)
+	}
+	if n := contarFilas(t, dbc.Local, "config_entrega"); n != configuraciones {
+		t.Errorf("config_entrega = %d, había %d", n, configuraciones)
+	}
+
+	revertidas, err := migraciones.Revertir(ctx, dbc.Local, len(aplicadas)+1)
+	if err == nil || len(revertidas) != len(aplicadas) {
+		t.Fatalf("revertir de más: %d revertidas, err = %v", len(revertidas), err)
+	}
+	if n := contarFilas(t, dbc.Local, "usuarios"); n == 0 {
+		t.Error("se borraron los usuarios")
+	}
+	if _, err := migraciones.Aplicar(ctx, dbc.Local); err != nil {
+		t.Fatalf("aplicando después de revertir: %v", err)
+	}
+}
+
+// 0016 pasa a UTC las horas locales que había, con el horario de verano que
+// Mérida tuvo hasta 2022, y no las vuelve a convertir si se reintenta.
+func TestMigracionHorasUTC(t *testing.T) {
+	dbc := Iniciar(t)
+	ctx := context.Background()
+	if _, err := dbc.Local.Exec(`INSERT INTO refresh_tokens (usuario_id, tipo_usuario, token_hash, expiracion, ultimo_uso)
+		VALUES (1, 'C', 'hash', '2022-07-01 12:00:00', '2024-01-15 08:00:00')`); err != nil {
+		t.Fatal(err)
+	}
+	horas := func() (string, string) {
+		t.Helper()
+		var expiracion, ultimoUso string
+		if err := dbc.Local.QueryRow("SELECT CAST(expiracion AS CHAR), CAST(ultimo_uso AS CHAR) FROM refresh_tokens WHERE token_hash = 'hash'").
+			Scan(&expiracion, &ultimoUso); err != nil {
+			t.Fatal(err)
+		}
+		return expiracion, ultimoUso
+	}
+	reaplicar := func() {
+		t.Helper()
+		if _, err := dbc.Local.Exec("DELETE FROM schema_migrations WHERE version = 16"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := migraciones.Aplicar(ctx, dbc.Local); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Como antes de la migración
+	if _, err := dbc.Local.Exec("DELETE FROM conversion_utc"); err != nil {
+		t.Fatal(err)
+	}
+	reaplicar()
+	if e, u := horas(); e != "2022-07-01 17:00:00" || u != "2024-01-15 14:00:00" {
+		t.Errorf("convertidas: expiracion %s, ultimo_uso %s", e, u)
+	}
+	// Falló después de convertir, antes de registrarse en schema_migrations
+	reaplicar()
+	if e, u := horas(); e != "2022-07-01 17:00:00" || u != "2024-01-15 14:00:00" {
+		t.Errorf("se convirtieron dos veces: expiracion %s, ultimo_uso %s", e, u)
+	}
+
+	if _, err := migraciones.Revertir(ctx, dbc.Local, 1); err != nil {
+		t.Fatal(err)
+	}
+	if e, u := horas(); e != "2022-07-01 12:00:00" || u != "2024-01-15 08:00:00" {
+		t.Errorf("revertidas: expiracion %s, ultimo_uso %s", e, u)
+	}
+}
+
+func contarFilas(t *testing.T, db *sql.DB, tabla string) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM " + tabla).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
@@ -0,0 +1,91 @@
+-- Tablas del ERP que toca el servicio, con las columnas y llaves únicas de
+-- migraciones.EsquemaRemotoEsperado. En producción este esquema no es nuestro:
+-- aquí sólo reproduce lo necesario para las pruebas.
+
+CREATE TABLE crm_indices (
+    idsucursal INT NOT NULL,
+    idpedido   INT NOT NULL DEFAULT 0,
+    idcliente  INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (idsucursal)
+);
+
+CREATE TABLE crm_pedidos (
+    id_pedido             INT           NOT NULL AUTO_INCREMENT,
+    idpedido              INT           NOT NULL,
+    clave_pedido          VARCHAR(64)   NOT NULL,
+    estatus               CHAR(1)       NOT NULL,
+    fecha_entrega         DATETIME      NULL,
+    mom_creacion          DATETIME      NULL,
+    fecha                 DATETIME      NULL,
+    mom_entrega           DATETIME      NULL,
+    comentarios           VARCHAR(255)  NULL,
+    clave_cliente         VARCHAR(64)   NULL,
+    cliente               VARCHAR(150)  NULL,
+    persona               VARCHAR(100)  NULL,
+    monto                 DECIMAL(14,4) NOT NULL DEFAULT 0,
+    iva                   DECIMAL(14,4) NOT NULL DEFAULT 0,
+    ieps                  DECIMAL(14,4) NOT NULL DEFAULT 0,
+    descuento             DECIMAL(14,4) NOT NULL DEFAULT 0,
+    facturar              CHAR(1)       NULL,
+    idlista               INT           NULL,
+    idmetodopago          INT           NULL,
+    num_orden             VARCHAR(50)   NULL,
+    tot_renglones         INT           NULL,
+    web_movil             TINYINT       NULL,
+    telefonico_presencial TINYINT       NULL,
+    idsucursal            INT           NOT NULL,
+    id_cliente            BIGINT        NULL,
+    PRIMARY KEY (id_pedido)
+);
+
+CREATE TABLE crm_pedidos_det (
+    id          INT           NOT NULL AUTO_INCREMENT,
+    id_pedido   INT           NOT NULL,
+    idproducto  INT           NOT NULL,
+    orden       INT           NOT NULL,
+    descripcion VARCHAR(255)  NULL,
+    precio      DECIMAL(14,4) NOT NULL DEFAULT 0,
+    cantidad    DECIMAL(14,4) NOT NULL DEFAULT 0,
+    precio_o    DECIMAL(14,4) NOT NULL DEFAULT 0,
+    iva         DECIMAL(14,4) NOT NULL DEFAULT 0,
+    ieps        DECIMAL(14,4) NOT NULL DEFAULT 0,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE est_ventas_x_producto_dia (
+    idsucursal INT           NOT NULL,
+    idproducto INT           NOT NULL,
+    dia        DATE          NOT NULL,
+    cantidad   DECIMAL(14,4) NOT NULL DEFAULT 0,
+    PRIMARY KEY (idsucursal, idproducto, dia)
+);
+
+CREATE TABLE est_ventas_x_producto_mes (
+    idsucursal INT           NOT NULL,
+    idproducto INT           NOT NULL,
+    dia        DATE          NOT NULL,
+    cantidad   DECIMAL(14,4) NOT NULL DEFAULT 0,
+    PRIMARY KEY (idsucursal, idproducto, dia)
+);
+
+CREATE TABLE crm_clientes (
+    id_cliente       INT          NOT NULL AUTO_INCREMENT,
+    idsucursal       INT          NOT NULL,
+    estatus          CHAR(1)      NOT NULL DEFAULT 'S',
+    clave_mobile     VARCHAR(64)  NULL,
+    nombre_comercial VARCHAR(150) NULL,
+    razon_social     VARCHAR(200) NULL,
+    rfc              VARCHAR(13)  NULL,
+    idcliente        INT          NULL,
+    tipo_cliente     CHAR(1)      NULL,
+    lista_precio     INT          NULL,
+    ofi_calle        VARCHAR(255) NULL,
+    ofi_num_ext      VARCHAR(20)  NULL,
+    ofi_colonia      VARCHAR(100) NULL,
+    ofi_ciudad       VARCHAR(100) NULL,
+    ofi_estado       VARCHAR(100) NULL,
+    ofi_cod_postal   VARCHAR(10)  NULL,
+    tel_contacto     VARCHAR(20)  NULL,
+    clave            VARCHAR(50)  NULL,
+    PRIMARY KEY (id_cliente)
+);
@@ -0,0 +1,55 @@
+-- Datos fijos de la base local. Ver las constantes de integracion.go.
+
+-- Empresa 2: otra tienda del grupo, para probar que nada se cruza entre empresas.
+INSERT INTO adm_empresas (idempresa, nombre_comercial, estatus) VALUES
+    (1, 'Abarrotes del Sureste', 'S'),
+    (2, 'Ferretería Peninsular', 'S'),
+    (3, 'Empresa Inactiva', 'N');
+
+INSERT INTO empresa_dominios (dominio, idempresa) VALUES
+    ('abarrotes.example.com', 1),
+    ('ferreteria.example.com', 2),
+    ('inactiva.example.com', 3);
+
+-- Centro: polígono alrededor del centro de Mérida. Norte: círculo de 3 km.
+-- Cerrada: inactiva, nunca debe asignarse.
+INSERT INTO adm_sucursales (idsucursal, idempresa, sucursal, estatus, tipo_objeto, radio) VALUES
+    (1, 1, 'Centro', 'S', 'P', 0),
+    (2, 1, 'Norte', 'S', 'C', 3),
+    (3, 1, 'Cerrada', 'N', 'N', 0),
+    (4, 2, 'Ferretería Centro', 'S', 'C', 5);
+
+INSERT INTO adm_sucursales_ptos (idsucursal, orden, punto) VALUES
+    (1, 1, POINT(20.95, -89.64)),
+    (1, 2, POINT(20.95, -89.60)),
+    (1, 3, POINT(20.99, -89.60)),
+    (1, 4, POINT(20.99, -89.64)),
+    (2, 1, POINT(21.05, -89.62)),
+    (4, 1, POINT(20.97, -89.62));
+
+INSERT INTO crm_impuestos (idiva, idempresa, descripcion, iva, tipo_iva, ieps1, ieps2, ieps3) VALUES
+    (1, 1, 'IVA 16', 16, 'T', NULL, NULL, NULL),
+    (2, 1, 'IVA 16 IEPS 8', 16, 'T', 8, NULL, NULL),
+    (3, 2, 'IVA 16', 16, 'T', NULL, NULL, NULL);
+
+INSERT INTO crm_productos (idproducto, idempresa, descripcion, estatus, clave, idiva, precio1, unidad, peso) VALUES
+    (100, 1, 'Refresco 600 ml', 'S', 'REF600', 1, 116, 'PZA', 0.65),
+    (200, 1, 'Botana 45 g', 'S', 'BOT45', 2, 124, 'PZA', 0.05),
+    (300, 2, 'Martillo 16 oz', 'S', 'MAR16', 3, 232, 'PZA', NULL);
+
+-- clave = bcrypt('secreta')
+INSERT INTO usuarios (id_usuario, id_empresa, tipo_usuario, nombre_completo, correo, telefono, clave, clave_remota, fecha_registro, estatus, id_remoto) VALUES
+    (1, 1, 'C', 'Cliente de Prueba', 'cliente@example.com', '9990000000', '$2a$04$EFs4.eo1pwRSm8YeVf40zuX0GUdD6geRe6ewLrC5x25AMsSfulcX2', '000001', '2025-01-01 00:00:00', 'activo', 1),
+    (2, 1, 'C', 'Cliente Suspendido', 'suspendido@example.com', '9990000001', '$2a$04$EFs4.eo1pwRSm8YeVf40zuX0GUdD6geRe6ewLrC5x25AMsSfulcX2', '000002', '2025-01-01 00:00:00', 'suspendido', 2);
+
+INSERT INTO tiendas (id_tienda, id_usuario, id_empresa, idsucursal, nombre_sucursal, nombre_tienda, direccion, colonia, codigo_postal, ciudad, estado, pais, latitud, longitud, ubicacion, fecha_registro, estatus) VALUES
+    (1, 1, 1, 1, 'Centro', 'Tienda de Prueba', 'Calle 60 500', 'Centro', '97000', 'Mérida', 'Yucatán', 'México', 20.97, -89.62, POINT(-89.62, 20.97), '2025-01-01 00:00:00', 'activo');
+
+INSERT INTO direcciones_tienda (id_direccion, id_empresa, id_tienda, alias, direccion, colonia, codigo_postal, ciudad, estado, latitud, longitud, predeterminada, creada, actualizada) VALUES
+    (1, 1, 1, 'Principal', 'Calle 60 500', 'Centro', '97000', 'Mérida', 'Yucatán', 20.97, -89.62, TRUE, '2025-01-01 00:00:00', '2025-01-01 00:00:00');
+
+-- clave = bcrypt('secreta')
+-- El admin 1 es de todo el grupo (idempresa NULL); el 2 sólo de la empresa 2.
+INSERT INTO admin_usuarios (idusuario, idempresa, idperfil, permisos, tipo_usuario, correo, clave) VALUES
+    (1, NULL, 1, '{"pedidos": true}', 'Admin', 'admin@example.com', '$2a$04$EFs4.eo1pwRSm8YeVf40zuX0GUdD6geRe6ewLrC5x25AMsSfulcX2'),
+    (2, 2, 1, '{"pedidos": true}', 'Admin', 'admin@ferreteria.example.com', '$2a$04$EFs4.eo1pwRSm8YeVf40zuX0GUdD6geRe6ewLrC5x25AMsSfulcX2');
@@ -0,0 +1,6 @@
+-- Datos fijos del ERP: el cliente remoto del usuario 1 y los índices de la sucursal Centro.
+
+INSERT INTO crm_indices (idsucursal, idpedido, idcliente) VALUES (1, 0, 1);
+
+INSERT INTO crm_clientes (id_cliente, idsucursal, estatus, nombre_comercial, razon_social, rfc, idcliente, tipo_cliente, lista_precio, clave) VALUES
+    (1, 1, 'S', 'Tienda de Prueba', 'Tienda de Prueba SA', 'TPR250101AAA', 1, 'C', 1, '000001');
@@ -0,0 +1,112 @@
+// Package limites frena a los clientes que hacen demasiadas peticiones a los
+// endpoints públicos (sin sesión). Cada IP tiene una cubeta de fichas: cada
+// petición gasta una y se rellenan a un ritmo fijo hasta la ráfaga permitida.
+// Al quedarse sin fichas la respuesta es 429 DEMASIADAS_PETICIONES con
+// Retry-After.
+//
+// La IP es la de la conexión (RemoteAddr). X-Forwarded-For no se usa porque
+// cualquiera lo puede inventar; detrás de un proxy hay que limitar ahí.
+package limites
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+)
+
+// limpiezaCada es cada cuánto se olvidan las cubetas que ya se rellenaron.
+const limpiezaCada = time.Minute
+
+// Limitador lleva las cubetas de cada IP. Es seguro usarlo desde varias
+// goroutines; un mismo Limitador en varias rutas comparte las cubetas.
+type Limitador struct {
+	porSegundo float64
+	rafaga     float64
+	ahora      func() time.Time
+
+	mu       sync.Mutex
+	cubetas  map[string]*cubeta
+	limpieza time.Time
+}
+
+type cubeta struct {
+	fichas float64
+	visto  time.Time
+}
+
+// Nuevo permite porMinuto peticiones por minuto a cada IP, con ráfagas de
+// hasta rafaga seguidas.
+func Nuevo(porMinuto, rafaga int) *Limitador {
+	return &Limitador{
+		porSegundo: float64(porMinuto) / 60,
+		rafaga:     float64(max(rafaga, 1)),
+		ahora:      time.Now,
+		cubetas:    map[string]*cubeta{},
+	}
+}
+
+// Permitir gasta una ficha de la clave; si no hay, regresa cuánto falta para
+// la siguiente.
+func (l *Limitador) Permitir(clave string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ahora := l.ahora()
+	l.limpiar(ahora)
+
+	c, ok := l.cubetas[clave]
+	if !ok {
+		c = &cubeta{fichas: l.rafaga, visto: ahora}
+		l.cubetas[clave] = c
+	}
+	c.fichas = math.Min(l.rafaga, c.fichas+ahora.Sub(c.visto).Seconds()*l.porSegundo)
+	c.visto = ahora
+	if c.fichas >= 1 {
+		c.fichas--
+		return true, 0
+	}
+	if l.porSegundo <= 0 {
+		return false, time.Hour
+	}
+	return false, time.Duration((1 - c.fichas) / l.porSegundo * float64(time.Second))
+}
+
+// limpiar borra las cubetas que ya estarían llenas: da lo mismo volver a
+// crearlas.
+func (l *Limitador) limpiar(ahora time.Time) {
+	if ahora.Sub(l.limpieza) < limpiezaCada {
+		return
+	}
+	l.limpieza = ahora
+	for clave, c := range l.cubetas {
+		if c.fichas+ahora.Sub(c.visto).Seconds()*l.porSegundo >= l.rafaga {
+			delete(l.cubetas, clave)
+		}
+	}
+}
+
+// Middleware responde 429 a la IP que se quedó sin fichas.
+func (l *Limitador) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, espera := l.Permitir(IP(r)); !ok {
+			segundos := int(math.Ceil(espera.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(max(segundos, 1)))
+			errores.Escribir(w, r, errores.Nuevo(errores.DemasiadasPeticiones))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// IP es la dirección de la conexión sin el puerto.
+func IP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
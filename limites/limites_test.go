@@ -0,0 +1,72 @@
+package limites
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPermitir(t *testing.T) {
+	ahora := time.Date(2026, time.October, 19, 10, 0, 0, 0, time.UTC)
+	l := Nuevo(60, 3)
+	l.ahora = func() time.Time { return ahora }
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Permitir("a"); !ok {
+			t.Fatalf("petición %d de la ráfaga rechazada", i+1)
+		}
+	}
+	ok, espera := l.Permitir("a")
+	if ok || espera != time.Second {
+		t.Fatalf("cuarta petición = %v, espera %v", ok, espera)
+	}
+	if ok, _ := l.Permitir("b"); !ok {
+		t.Error("otra clave comparte la cubeta")
+	}
+
+	ahora = ahora.Add(500 * time.Millisecond)
+	if ok, espera := l.Permitir("a"); ok || espera != 500*time.Millisecond {
+		t.Errorf("a medio segundo = %v, espera %v", ok, espera)
+	}
+	ahora = ahora.Add(500 * time.Millisecond)
+	if ok, _ := l.Permitir("a"); !ok {
+		t.Error("al segundo no se rellenó una ficha")
+	}
+
+	// Las cubetas llenas se olvidan
+	ahora = ahora.Add(time.Hour)
+	l.Permitir("c")
+	if _, ok := l.cubetas["a"]; ok || len(l.cubetas) != 1 {
+		t.Errorf("cubetas después de limpiar = %v", l.cubetas)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	l := Nuevo(1, 1)
+	h := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	llamar := func(ip string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/cobertura", nil)
+		req.RemoteAddr = ip + ":52100"
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := llamar("10.0.0.1"); rec.Code != http.StatusNoContent {
+		t.Fatalf("primera petición: status %d", rec.Code)
+	}
+	rec := llamar("10.0.0.1")
+	if rec.Code != http.StatusTooManyRequests || !strings.Contains(rec.Body.String(), "DEMASIADAS_PETICIONES") {
+		t.Fatalf("segunda petición: status %d: %s", rec.Code, rec.Body)
+	}
+	if s := rec.Header().Get("Retry-After"); s != "60" {
+		t.Errorf("Retry-After = %q", s)
+	}
+	if rec := llamar("10.0.0.2"); rec.Code != http.StatusNoContent {
+		t.Errorf("otra IP: status %d", rec.Code)
+	}
+}
@@ -1,38 +1,95 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	middlewares "github.com/WolfSlayer04/logica_tiendaenlina/Middleware"
+	"github.com/WolfSlayer04/logica_tiendaenlina/avisos"
+	"github.com/WolfSlayer04/logica_tiendaenlina/bitacora"
 	"github.com/WolfSlayer04/logica_tiendaenlina/db"
+	"github.com/WolfSlayer04/logica_tiendaenlina/documentacion"
+	"github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/limites"
+	"github.com/WolfSlayer04/logica_tiendaenlina/metricas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/reloj"
+	"github.com/WolfSlayer04/logica_tiendaenlina/repositorio"
 	"github.com/WolfSlayer04/logica_tiendaenlina/rutas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/trazas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/versiones"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 )
 
 func main() {
+	logger := bitacora.Nuevo(os.Stdout)
+	slog.SetDefault(logger)
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(ejecutarMigrate(os.Args[2:]))
+	}
+
+	apagarTrazas, err := trazas.Iniciar(context.Background())
+	if err != nil {
+		fatal("Error iniciando trazas", err)
+	}
+
+	// La hora del negocio (ZONA_HORARIA, por defecto America/Merida) va en el
+	// contexto de las peticiones y de las tareas de fondo
+	horaNegocio, err := reloj.DesdeEnv()
+	if err != nil {
+		fatal("Error cargando ZONA_HORARIA", err)
+	}
+
+	ctx, stop := signal.NotifyContext(reloj.Con(context.Background(), horaNegocio), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	dbConn, err := db.GetDBConnection()
 	if err != nil {
-		log.Fatalf("Error al conectar a las bases de datos: %v", err)
+		fatal("Error al conectar a las bases de datos", err)
 	}
+	defer dbConn.Close()
 
 	if err := dbConn.CheckConnections(); err != nil {
-		log.Fatalf("Error verificando conexiones: %v", err)
+		fatal("Error verificando conexiones", err)
 	}
-	fmt.Println("Conexión a las bases de datos establecida correctamente")
+	logger.Info("Conexión a las bases de datos establecida correctamente")
 
-	rutas.IniciarSincronizadorPedidos(dbConn)
+	if err := prepararEsquemas(ctx, dbConn); err != nil {
+		fatal("Error aplicando migraciones", err)
+	}
 
-	if err := rutas.InicializaIndicadoresHistoricos(dbConn); err != nil {
-		log.Fatalf("Error inicializando indicadores históricos: %v", err)
+	// Las rutas y las tareas de fondo comparten repositorios (y con ellos el
+	// mismo motor de geocercas)
+	repos := repositorio.NuevoMySQL(dbConn)
+	sincronizadorDone := rutas.IniciarSincronizadorPedidos(ctx, dbConn, repos)
+
+	if err := rutas.InicializaIndicadoresHistoricos(ctx, dbConn); err != nil {
+		fatal("Error inicializando indicadores históricos", err)
+	}
+
+	if err := metricas.RegistrarPoolBD("local", dbConn.Local); err != nil {
+		fatal("Error registrando métricas del pool local", err)
+	}
+	if err := metricas.RegistrarPoolBD("remote", dbConn.Remote); err != nil {
+		fatal("Error registrando métricas del pool remoto", err)
 	}
 
 	r := mux.NewRouter()
-	setupRoutes(r, dbConn)
+	r.Use(otelmux.Middleware(trazas.Servicio, otelmux.WithFilter(trazas.PeticionTrazable)))
+	r.Use(bitacora.Middleware(logger))
+	r.Use(reloj.Middleware(horaNegocio))
+	r.Use(metricas.MiddlewareHTTP)
+	setupRoutes(r, dbConn, repos)
+	reasignacionDone := rutas.IniciarReasignacionTiendas(ctx, repos)
 
 	handler := cors.AllowAll().Handler(r)
 
@@ -41,111 +98,265 @@ func main() {
 		port = "8080"
 	}
 
-	fmt.Printf("Servidor corriendo en http://0.0.0.0:%s\n", port)
-	log.Fatal(http.ListenAndServe(":"+port, handler))
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: handler,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("Servidor corriendo", "addr", "http://0.0.0.0:"+port)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			serverErr <- err
+		}
+		close(serverErr)
+	}()
+
+	select {
+	case err := <-serverErr:
+		if err != nil {
+			logger.Error("Error en el servidor HTTP", "error", err)
+		}
+		stop()
+	case <-ctx.Done():
+		logger.Info("Señal de apagado recibida, deteniendo servidor")
+	}
+
+	apagar(srv, sincronizadorDone, reasignacionDone, apagarTrazas, shutdownTimeout())
 }
 
-func setupRoutes(r *mux.Router, dbConn *db.DBConnection) {
+// fatal registra el error y termina el proceso.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// apagar drena las peticiones HTTP en curso y espera a que el sincronizador
+// termine el pedido actual y la revisión de sucursales la empresa en curso; al
+// final envía los spans pendientes. Todo comparte el mismo límite de tiempo;
+// las conexiones a BD se cierran al regresar de main.
+func apagar(srv *http.Server, sincronizadorDone, reasignacionDone <-chan struct{}, apagarTrazas func(context.Context) error, timeout time.Duration) {
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Error al detener el servidor HTTP", "error", err)
+	}
+
+	select {
+	case <-sincronizadorDone:
+	case <-shutdownCtx.Done():
+		slog.Warn("Tiempo de apagado agotado esperando al sincronizador")
+	}
+	select {
+	case <-reasignacionDone:
+	case <-shutdownCtx.Done():
+		slog.Warn("Tiempo de apagado agotado esperando la revisión de sucursales")
+	}
+
+	if err := apagarTrazas(shutdownCtx); err != nil {
+		slog.Error("Error al enviar las trazas pendientes", "error", err)
+	}
+	slog.Info("Servidor detenido")
+}
+
+// shutdownTimeout lee SHUTDOWN_TIMEOUT (duración de Go, p. ej. "30s", o segundos).
+// Por defecto 30 segundos.
+func shutdownTimeout() time.Duration {
+	const porDefecto = 30 * time.Second
+	valor := os.Getenv("SHUTDOWN_TIMEOUT")
+	if valor == "" {
+		return porDefecto
+	}
+	if d, err := time.ParseDuration(valor); err == nil && d > 0 {
+		return d
+	}
+	if seg, err := strconv.Atoi(valor); err == nil && seg > 0 {
+		return time.Duration(seg) * time.Second
+	}
+	slog.Warn("SHUTDOWN_TIMEOUT inválido, usando valor por defecto", "valor", valor, "por_defecto", porDefecto.String())
+	return porDefecto
+}
+
+func setupRoutes(r *mux.Router, dbConn *db.DBConnection, repos repositorio.Repositorios) {
+	// Salud del servicio (sin autenticación, para el orquestador)
+	r.HandleFunc("/healthz", rutas.Healthz()).Methods("GET")
+	r.HandleFunc("/readyz", rutas.Readyz(dbConn)).Methods("GET")
+	r.Handle("/metrics", metricas.Handler()).Methods("GET")
+
+	// Documentación de la API (mantener documentacion/openapi.json al agregar rutas)
+	r.HandleFunc("/api/openapi.json", documentacion.HandlerEspecificacion()).Methods("GET")
+	r.HandleFunc("/api/docs", documentacion.HandlerUI()).Methods("GET")
+
+	// Endpoints públicos que consultan datos: 30 por minuto por IP, con ráfagas
+	// de 10. Se comparte entre v1 y las rutas sin versión
+	publicos := limites.Nuevo(30, 10)
+
+	// Los códigos para reclamar un cliente del ERP salen por la pasarela de SMS
+	enviador := avisos.DesdeEnv()
+
+	// Versiones de la API. v2 sólo tiene los endpoints rediseñados; las rutas
+	// sin versión son alias de v1 para la app móvil instalada.
+	versiones.Montar(r, versiones.V2, func(api *mux.Router) { rutasV2(api, dbConn, repos) })
+	versiones.Montar(r, versiones.V1, func(api *mux.Router) { rutasV1(api, dbConn, repos, publicos, enviador) })
+	versiones.Alias(r, versiones.Legado, func(api *mux.Router) { rutasV1(api, dbConn, repos, publicos, enviador) }, avisoLegado)
+}
+
+// avisoLegado marca las rutas sin versión como obsoletas en favor de /api/v1.
+var avisoLegado = versiones.Aviso{
+	Desde:   time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+	Retiro:  time.Date(2027, 4, 30, 0, 0, 0, 0, time.UTC),
+	Sucesor: versiones.CambiarPrefijo(versiones.Legado, versiones.V1),
+}
+
+// rutasV2 registra los endpoints rediseñados; los demás siguen en v1.
+func rutasV2(api *mux.Router, dbConn *db.DBConnection, repos repositorio.Repositorios) {
+	api.Use(empresas.Middleware(repos.Empresas))
+	api.Handle("/productos", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetProductosV2(dbConn)))).Methods("GET")
+}
+
+// rutasV1 registra la API v1 sobre api, que ya trae el prefijo.
+func rutasV1(api *mux.Router, dbConn *db.DBConnection, repos repositorio.Repositorios, publicos *limites.Limitador, enviador avisos.Enviador) {
+	// Cada petición trae su empresa (dominio, X-Empresa o token)
+	api.Use(empresas.Middleware(repos.Empresas))
+
 	// Rutas públicas
-	r.HandleFunc("/api/registro", rutas.RegistroUsuarioTienda(dbConn)).Methods("POST")
-	r.HandleFunc("/api/login", rutas.LoginUsuario(dbConn)).Methods("POST")
-	r.HandleFunc("/api/empresa/logo", rutas.EmpresaGetLogo(dbConn)).Methods("GET")
-	r.HandleFunc("/api/refresh", rutas.RefreshTokenEndpoint(dbConn)).Methods("POST")
-	r.Handle("/api/admin/personalizar", rutas.AdminGetAllPersonalizaciones(dbConn)).Methods("GET")
-	r.Handle("/api/admin/personalizar/{id}",rutas.AdminGetPersonalizacionByID(dbConn)).Methods("GET")
+	api.Handle("/registro", publicos.Middleware(rutas.RegistroUsuarioTienda(repos, enviador))).Methods("POST")
+	api.Handle("/registro/reclamos/{id_reclamo}/confirmar", publicos.Middleware(rutas.ConfirmarReclamo(repos))).Methods("POST")
+	api.Handle("/cobertura", publicos.Middleware(rutas.GetCobertura(repos))).Methods("GET")
+	api.HandleFunc("/login", rutas.LoginUsuario(dbConn, repos)).Methods("POST")
+	api.HandleFunc("/empresa/logo", rutas.EmpresaGetLogo(dbConn)).Methods("GET")
+	api.HandleFunc("/refresh", rutas.RefreshTokenEndpoint(dbConn)).Methods("POST")
+	api.Handle("/admin/personalizar", rutas.AdminGetAllPersonalizaciones(dbConn)).Methods("GET")
+	api.Handle("/admin/personalizar/{id}",rutas.AdminGetPersonalizacionByID(dbConn)).Methods("GET")
 
 	// Protegidas con JWT
-	r.Handle("/api/categorias", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetCategorias(dbConn)))).Methods("GET")
+	api.Handle("/categorias", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetCategorias(dbConn)))).Methods("GET")
 
 	// PRODUCTOS
-	r.Handle("/api/productos/estatus", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetEstatusProductos(dbConn)))).Methods("GET")
-	r.Handle("/api/productos/iva", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetProductosConIVA(dbConn)))).Methods("GET")
-	r.Handle("/api/productos/iva/buscar", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetProductosConIVABuscar(dbConn)))).Methods("GET")
-	r.Handle("/api/productos/buscar", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.SearchProductos(dbConn)))).Methods("GET")
-	r.Handle("/api/productos/sugerencias", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetProductoSuggestions(dbConn)))).Methods("GET")
-	r.Handle("/api/productos", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetProductos(dbConn)))).Methods("GET")
-	r.Handle("/api/productos", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.AddProducto(dbConn))))).Methods("POST")
-
-	r.Handle("/api/productos/iva/categoria/{idcategoria}", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetProductosConIVAPorCategoria(dbConn)))).Methods("GET")
-	r.Handle("/api/productos/categoria/{idcategoria}", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetProductosByCategoria(dbConn)))).Methods("GET")
-	r.Handle("/api/productos/{id}", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetProductoByID(dbConn)))).Methods("GET")
-	r.Handle("/api/productos/{idproducto}", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.EditProducto(dbConn))))).Methods("PUT")
+	api.Handle("/productos/estatus", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetEstatusProductos(dbConn)))).Methods("GET")
+	api.Handle("/productos/iva", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetProductosConIVA(dbConn)))).Methods("GET")
+	api.Handle("/productos/iva/buscar", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetProductosConIVABuscar(dbConn)))).Methods("GET")
+	api.Handle("/productos/buscar", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.SearchProductos(dbConn)))).Methods("GET")
+	api.Handle("/productos/sugerencias", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetProductoSuggestions(dbConn)))).Methods("GET")
+	api.Handle("/productos", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetProductos(dbConn)))).Methods("GET")
+	api.Handle("/productos", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.AddProducto(dbConn))))).Methods("POST")
+
+	api.Handle("/productos/iva/categoria/{idcategoria}", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetProductosConIVAPorCategoria(dbConn)))).Methods("GET")
+	api.Handle("/productos/categoria/{idcategoria}", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetProductosByCategoria(dbConn)))).Methods("GET")
+	api.Handle("/productos/{id}", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetProductoByID(dbConn)))).Methods("GET")
+	api.Handle("/productos/{idproducto}", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.EditProducto(dbConn))))).Methods("PUT")
 
 	// Impuestos por empresa
-	r.Handle("/api/impuestos", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetImpuestosPorEmpresa(dbConn)))).Methods("GET")
+	api.Handle("/impuestos", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetImpuestosPorEmpresa(dbConn)))).Methods("GET")
 
 	// Carrito
-	r.Handle("/api/carrito/agregar", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.AddToCart(dbConn)))).Methods("POST")
-	r.Handle("/api/carrito", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetCart(dbConn)))).Methods("GET")
-	r.Handle("/api/carrito/vaciar", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.ClearCart(dbConn)))).Methods("DELETE")
-	r.Handle("/api/carrito/eliminar/{idproducto}", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.RemoveFromCart(dbConn)))).Methods("DELETE")
-	r.Handle("/api/carrito/actualizar", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.UpdateCartItem(dbConn)))).Methods("PUT")
+	api.Handle("/carrito/agregar", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.AddToCart(dbConn)))).Methods("POST")
+	api.Handle("/carrito", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetCart(dbConn)))).Methods("GET")
+	api.Handle("/carrito/vaciar", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.ClearCart(dbConn)))).Methods("DELETE")
+	api.Handle("/carrito/eliminar/{idproducto}", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.RemoveFromCart(dbConn)))).Methods("DELETE")
+	api.Handle("/carrito/actualizar", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.UpdateCartItem(dbConn)))).Methods("PUT")
 
 	// Pedidos
-	r.Handle("/api/pedidos", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.CreatePedido(dbConn)))).Methods("POST")
-	r.Handle("/api/pedidos", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.AdminGetPedidosConDetallesPaginado(dbConn)))).Methods("GET")
-	r.Handle("/api/pedidos/usuario", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetPedidosByUsuario(dbConn)))).Methods("GET")
+	api.Handle("/pedidos", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.CreatePedido(repos)))).Methods("POST")
+	api.Handle("/pedidos", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.AdminGetPedidosConDetallesPaginado(dbConn)))).Methods("GET")
+	api.Handle("/pedidos/usuario", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetPedidosByUsuario(dbConn)))).Methods("GET")
 
 	// Usuarios/tiendas
-	r.Handle("/api/usuarios", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetUsuarios(dbConn)))).Methods("GET")
-	r.Handle("/api/tiendas", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetTiendas(dbConn)))).Methods("GET")
-	r.Handle("/api/tiendas/por_usuario", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetTiendaByUsuario(dbConn)))).Methods("GET")
-	r.Handle("/api/perfil", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetPerfilUsuario(dbConn)))).Methods("GET")
-	r.Handle("/api/usuarios/editar", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.EditarUsuario(dbConn)))).Methods("PUT")
-	r.Handle("/api/tiendas/eliminar", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.EliminarTienda(dbConn)))).Methods("DELETE")
+	api.Handle("/usuarios", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetUsuarios(dbConn)))).Methods("GET")
+	api.Handle("/tiendas", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetTiendas(dbConn)))).Methods("GET")
+	api.Handle("/tiendas/por_usuario", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetTiendaByUsuario(dbConn)))).Methods("GET")
+	api.Handle("/perfil", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetPerfilUsuario(dbConn)))).Methods("GET")
+	api.Handle("/usuarios/editar", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.EditarUsuario(dbConn)))).Methods("PUT")
+	api.Handle("/tiendas/eliminar", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.EliminarTienda(dbConn)))).Methods("DELETE")
+
+	// Tiendas adicionales de un cliente y su tienda activa
+	api.Handle("/tiendas", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.CreateTienda(repos)))).Methods("POST")
+	api.Handle("/tiendas/{id_tienda}", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.UpdateTienda(repos)))).Methods("PUT")
+	api.Handle("/tiendas/{id_tienda}/activar", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.ActivarTienda(repos)))).Methods("POST")
+
+	// Libreta de direcciones de entrega
+	api.Handle("/tiendas/{id_tienda}/direcciones", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetDireccionesTienda(repos)))).Methods("GET")
+	api.Handle("/tiendas/{id_tienda}/direcciones", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.CreateDireccionTienda(repos)))).Methods("POST")
+	api.Handle("/tiendas/{id_tienda}/direcciones/{id_direccion}", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.UpdateDireccionTienda(repos)))).Methods("PUT")
+	api.Handle("/tiendas/{id_tienda}/direcciones/{id_direccion}", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.DeleteDireccionTienda(repos)))).Methods("DELETE")
 
 	// Indicadores
-	r.Handle("/api/indicadores/diario", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetIndicadoresDiarioAll(dbConn)))).Methods("GET")
-	r.Handle("/api/indicadores/diario/fecha", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetIndicadorDiarioByFecha(dbConn)))).Methods("GET")
-	r.Handle("/api/indicadores/mensual", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetIndicadoresMensualAll(dbConn)))).Methods("GET")
-	r.Handle("/api/indicadores/mensual/fecha", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetIndicadorMensualByFecha(dbConn)))).Methods("GET")
-	r.Handle("/api/dashboard/stats", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetDashboardStats(dbConn)))).Methods("GET")
+	api.Handle("/indicadores/diario", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetIndicadoresDiarioAll(dbConn)))).Methods("GET")
+	api.Handle("/indicadores/diario/fecha", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetIndicadorDiarioByFecha(dbConn)))).Methods("GET")
+	api.Handle("/indicadores/mensual", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetIndicadoresMensualAll(dbConn)))).Methods("GET")
+	api.Handle("/indicadores/mensual/fecha", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetIndicadorMensualByFecha(dbConn)))).Methods("GET")
+	api.Handle("/dashboard/stats", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetDashboardStats(dbConn)))).Methods("GET")
 
 	// Pedidos administración y sincronización (solo admin)
-	r.Handle("/api/pedidos/{id_pedido}/sucursal", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.AdminActualizarSucursalPedido(dbConn))))).Methods("PUT")
-	r.Handle("/api/pedidos/{id_pedido}/estatus", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.AdminActualizarEstatusPedido(dbConn))))).Methods("PUT")
-	r.Handle("/api/pedidos/{id_pedido}/descuento", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.AdminAplicarDescuentoPedido(dbConn))))).Methods("PUT")
-	r.Handle("/api/pedidos/{id_pedido}/detalles", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.AdminActualizarDetallesPedido(dbConn))))).Methods("PUT")
-	r.Handle("/api/pedidos/{id_pedido}", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.AdminGetPedidoByID(dbConn))))).Methods("GET")
+	api.Handle("/pedidos/{id_pedido}/sucursal", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.AdminActualizarSucursalPedido(dbConn, repos))))).Methods("PUT")
+	api.Handle("/pedidos/{id_pedido}/estatus", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.AdminActualizarEstatusPedido(dbConn))))).Methods("PUT")
+	api.Handle("/pedidos/{id_pedido}/descuento", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.AdminAplicarDescuentoPedido(repos))))).Methods("PUT")
+	api.Handle("/pedidos/{id_pedido}/detalles", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.AdminActualizarDetallesPedido(dbConn))))).Methods("PUT")
+	api.Handle("/pedidos/{id_pedido}", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.AdminGetPedidoByID(dbConn))))).Methods("GET")
 
 	// ADMIN clientes
-	r.Handle("/api/admin/clientes", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.GetAllUsuariosConTienda(dbConn))))).Methods("GET")
+	api.Handle("/admin/clientes", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.GetAllUsuariosConTienda(dbConn))))).Methods("GET")
 
 	// ADMIN usuarios
-	r.Handle("/api/admin/usuarios", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.GetAllAdminUsuarios(dbConn))))).Methods("GET")
-	r.Handle("/api/admin/usuarios", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.CreateAdminUsuario(dbConn))))).Methods("POST")
-	r.Handle("/api/admin/usuarios", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.UpdateAdminUsuario(dbConn))))).Methods("PUT")
-	r.Handle("/api/admin/usuarios", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.DeleteAdminUsuario(dbConn))))).Methods("DELETE")
+	api.Handle("/admin/usuarios", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.GetAllAdminUsuarios(dbConn))))).Methods("GET")
+	api.Handle("/admin/usuarios", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.CreateAdminUsuario(dbConn))))).Methods("POST")
+	api.Handle("/admin/usuarios", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.UpdateAdminUsuario(dbConn))))).Methods("PUT")
+	api.Handle("/admin/usuarios", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.DeleteAdminUsuario(dbConn))))).Methods("DELETE")
 
 	// ADMIN personalizaciones
-	r.Handle("/api/admin/personalizar", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.AdminCreatePersonalizacion(dbConn))))).Methods("POST")
-	r.Handle("/api/admin/personalizar/{id}", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.AdminUpdatePersonalizacionByID(dbConn))))).Methods("PUT")
-	r.Handle("/api/admin/personalizar/{id}", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.AdminDeletePersonalizacionByID(dbConn))))).Methods("DELETE")
+	api.Handle("/admin/personalizar", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.AdminCreatePersonalizacion(dbConn))))).Methods("POST")
+	api.Handle("/admin/personalizar/{id}", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.AdminUpdatePersonalizacionByID(dbConn))))).Methods("PUT")
+	api.Handle("/admin/personalizar/{id}", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.AdminDeletePersonalizacionByID(dbConn))))).Methods("DELETE")
 	
 
 	// Logo empresa edición (solo admin)
-	r.Handle("/api/empresa/logo", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.EmpresaUploadLogo(dbConn))))).Methods("POST")
-	r.Handle("/api/empresa/logo", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.EmpresaUpdateLogo(dbConn))))).Methods("PUT")
-	r.Handle("/api/empresa/logo", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.EmpresaDeleteLogo(dbConn))))).Methods("DELETE")
+	api.Handle("/empresa/logo", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.EmpresaUploadLogo(dbConn))))).Methods("POST")
+	api.Handle("/empresa/logo", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.EmpresaUpdateLogo(dbConn))))).Methods("PUT")
+	api.Handle("/empresa/logo", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.EmpresaDeleteLogo(dbConn))))).Methods("DELETE")
 
 	// Sincronización de pedidos
-	r.Handle("/api/pedidos/sincronizar", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.SincronizarPedido(dbConn))))).Methods("POST")
-	r.Handle("/api/pedidos/verificar_sincronizacion", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.VerificarSincronizacion(dbConn)))).Methods("GET")
-	r.Handle("/api/pedidos/pendientes_sincronizacion", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.PedidosPendientesSincronizacion(dbConn)))).Methods("GET")
-	r.Handle("/api/pedidos/actualizar_fecha_entrega", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.ActualizarFechaEntrega(dbConn))))).Methods("POST")
-	r.Handle("/api/pedidos/obtener_por_id_remoto", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.ObtenerPedidoPorIDRemoto(dbConn)))).Methods("GET")
+	api.Handle("/pedidos/sincronizar", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.SincronizarPedido(dbConn))))).Methods("POST")
+	api.Handle("/pedidos/verificar_sincronizacion", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.VerificarSincronizacion(dbConn)))).Methods("GET")
+	api.Handle("/pedidos/pendientes_sincronizacion", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.PedidosPendientesSincronizacion(dbConn)))).Methods("GET")
+	api.Handle("/pedidos/actualizar_fecha_entrega", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.ActualizarFechaEntrega(dbConn))))).Methods("POST")
+	api.Handle("/pedidos/obtener_por_id_remoto", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.ObtenerPedidoPorIDRemoto(dbConn)))).Methods("GET")
 
 	// ADMIN config entregas
-	r.Handle("/api/admin/config-entrega", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.UpdateConfigEntrega(dbConn))))).Methods("POST")
-	r.Handle("/api/admin/config-entrega", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.GetConfigEntrega(dbConn))))).Methods("GET")
+	api.Handle("/admin/config-entrega", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.UpdateConfigEntrega(dbConn, repos))))).Methods("POST")
+	api.Handle("/admin/config-entrega", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.GetConfigEntrega(repos))))).Methods("GET")
+	api.Handle("/admin/config-entrega", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.DeleteConfigEntrega(dbConn, repos))))).Methods("DELETE")
+
+	// ADMIN calendario de feriados
+	api.Handle("/admin/feriados", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.GetFeriados(repos))))).Methods("GET")
+	api.Handle("/admin/feriados", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.CreateFeriado(dbConn, repos))))).Methods("POST")
+	api.Handle("/admin/feriados/{id_feriado}", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.DeleteFeriado(dbConn))))).Methods("DELETE")
+	api.Handle("/admin/feriados/importar", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.ImportarFeriados(dbConn, repos))))).Methods("POST")
+	api.Handle("/admin/feriados/exportar", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.ExportarFeriados(repos))))).Methods("GET")
+
+	// ADMIN cobertura de sucursales
+	api.Handle("/admin/sucursales/{id_sucursal}/cobertura", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.GetCoberturaSucursal(repos))))).Methods("GET")
+	api.Handle("/admin/sucursales/{id_sucursal}/cobertura", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.UpdateCoberturaSucursal(repos))))).Methods("PUT")
+	api.Handle("/admin/sucursales/{id_sucursal}/cobertura/vista-previa", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.PreviewCoberturaSucursal(repos))))).Methods("POST")
+
+	// ADMIN reasignación de tiendas a sucursales
+	api.Handle("/admin/reasignaciones", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.GetReasignaciones(repos))))).Methods("GET")
+	api.Handle("/admin/reasignaciones", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.CreateReasignacion(repos))))).Methods("POST")
+	api.Handle("/admin/reasignaciones/{id_reasignacion}", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.GetReasignacion(repos))))).Methods("GET")
+	api.Handle("/admin/reasignaciones/{id_reasignacion}/aprobar", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.AprobarReasignacion(repos))))).Methods("POST")
+	api.Handle("/admin/reasignaciones/{id_reasignacion}/descartar", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.DescartarReasignacion(repos))))).Methods("POST")
+	api.Handle("/admin/tiendas/{id_tienda}/movimientos", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.GetMovimientosTienda(repos))))).Methods("GET")
 
 	// Fechas de entrega
-	r.Handle("/api/fechas-entrega-disponibles", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetFechasEntregaDisponibles(dbConn)))).Methods("GET")
+	api.Handle("/fechas-entrega-disponibles", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetFechasEntregaDisponibles(repos)))).Methods("GET")
+	api.Handle("/entregas/promesa", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.PromesaDeEntrega(repos)))).Methods("POST")
+	api.Handle("/entregas/reservas", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.ApartarHorarioEntrega(repos)))).Methods("POST")
+	api.Handle("/entregas/reservas/{id_reserva}", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.LiberarHorarioEntrega(repos)))).Methods("DELETE")
 
 	// Sucursales
-	r.Handle("/api/sucursales", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetSucursalALL(dbConn)))).Methods("GET")
-	r.Handle("/api/sucursales/{id}", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetSucursal(dbConn)))).Methods("GET")
-	r.Handle("/api/sucursales/{id}/lista-precios", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.UpdateListaPreciosSucursal(dbConn))))).Methods("PUT")
-	r.Handle("/api/sucursales/{id}/productos", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetProductosSucursal(dbConn)))).Methods("GET")
-	r.Handle("/api/sucursales/{id}/lista-precios", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetListaPreciosSucursal(dbConn)))).Methods("GET")
+	api.Handle("/sucursales", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetSucursalALL(dbConn)))).Methods("GET")
+	api.Handle("/sucursales/{id}", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetSucursal(dbConn)))).Methods("GET")
+	api.Handle("/sucursales/{id}/lista-precios", middlewares.JWTAuthMiddleware(middlewares.RequireAdminPermisos(http.HandlerFunc(rutas.UpdateListaPreciosSucursal(dbConn))))).Methods("PUT")
+	api.Handle("/sucursales/{id}/productos", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetProductosSucursal(dbConn)))).Methods("GET")
+	api.Handle("/sucursales/{id}/lista-precios", middlewares.JWTAuthMiddleware(http.HandlerFunc(rutas.GetListaPreciosSucursal(dbConn)))).Methods("GET")
 }
\ No newline at end of file
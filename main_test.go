@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/db"
+	"github.com/WolfSlayer04/logica_tiendaenlina/documentacion"
+	"github.com/WolfSlayer04/logica_tiendaenlina/repositorio"
+	"github.com/WolfSlayer04/logica_tiendaenlina/versiones"
+	"github.com/gorilla/mux"
+)
+
+// Cada ruta registrada en setupRoutes debe estar en documentacion/openapi.json
+// con el mismo método, y la especificación no debe documentar rutas que no existen.
+// Los alias sin versión no se documentan: basta con que exista su ruta en v1.
+func TestRutasDocumentadas(t *testing.T) {
+	r := mux.NewRouter()
+	dbConn := &db.DBConnection{}
+	setupRoutes(r, dbConn, repositorio.NuevoMySQL(dbConn))
+
+	registradas := map[string]bool{}
+	err := r.Walk(func(ruta *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		plantilla, err := ruta.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		if ruta.GetHandler() == nil {
+			return nil // prefijo de un subrouter de versión
+		}
+		metodos, err := ruta.GetMethods()
+		if err != nil {
+			t.Errorf("%s: la ruta no declara métodos", plantilla)
+			return nil
+		}
+		for _, m := range metodos {
+			registradas[m+" "+plantilla] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alias := map[string]bool{}
+	for ruta := range registradas {
+		metodo, plantilla, _ := strings.Cut(ruta, " ")
+		resto, ok := strings.CutPrefix(plantilla, versiones.Legado+"/")
+		if !ok || strings.HasPrefix(plantilla, versiones.V1+"/") || strings.HasPrefix(plantilla, versiones.V2+"/") {
+			continue
+		}
+		if v1 := metodo + " " + versiones.V1 + "/" + resto; registradas[v1] {
+			alias[v1] = true
+			delete(registradas, ruta)
+		}
+	}
+	for _, ruta := range ordenadas(registradas) {
+		if strings.Contains(ruta, " "+versiones.V1+"/") && !alias[ruta] {
+			t.Errorf("%s no tiene alias sin versión", ruta)
+		}
+	}
+
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(documentacion.Especificacion(), &spec); err != nil {
+		t.Fatalf("openapi.json: %v", err)
+	}
+	documentadas := map[string]bool{}
+	for plantilla, ops := range spec.Paths {
+		for m := range ops {
+			documentadas[strings.ToUpper(m)+" "+plantilla] = true
+		}
+	}
+
+	for _, ruta := range ordenadas(registradas) {
+		if !documentadas[ruta] {
+			t.Errorf("%s está registrada pero no aparece en documentacion/openapi.json", ruta)
+		}
+	}
+	for _, ruta := range ordenadas(documentadas) {
+		if !registradas[ruta] {
+			t.Errorf("%s está en documentacion/openapi.json pero no se registra en setupRoutes", ruta)
+		}
+	}
+}
+
+func ordenadas(m map[string]bool) []string {
+	claves := make([]string, 0, len(m))
+	for k := range m {
+		claves = append(claves, k)
+	}
+	sort.Strings(claves)
+	return claves
+}
@@ -0,0 +1,158 @@
+// Package metricas expone las métricas Prometheus del servicio: HTTP por
+// plantilla de ruta, pools de BD, sincronizador de pedidos y contadores de negocio.
+package metricas
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registro propio para no mezclar con el registro global de otras librerías.
+var Registro = prometheus.NewRegistry()
+
+var (
+	httpPeticiones = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tienda_http_requests_total",
+		Help: "Peticiones HTTP atendidas, por plantilla de ruta, método y código de estatus.",
+	}, []string{"route", "method", "status"})
+
+	httpDuracion = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tienda_http_request_duration_seconds",
+		Help:    "Latencia de las peticiones HTTP, por plantilla de ruta y método.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	sincronizaciones = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tienda_sync_pedidos_total",
+		Help: "Sincronizaciones de pedidos hacia el sistema principal, por resultado (ok/error).",
+	}, []string{"resultado"})
+
+	sincronizacionDuracion = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "tienda_sync_pedido_duration_seconds",
+		Help:    "Duración de sincronizarPedidoCore por pedido.",
+		Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	})
+
+	pedidosPendientes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "tienda_sync_pedidos_pendientes",
+		Help: "Pedidos locales pendientes de sincronizar en la última pasada del sincronizador.",
+	})
+
+	pedidosCreados = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tienda_pedidos_creados_total",
+		Help: "Pedidos creados, por sucursal.",
+	}, []string{"sucursal"})
+
+	ingresos = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tienda_pedidos_ingresos_total",
+		Help: "Importe total (con impuestos) de los pedidos creados, por sucursal.",
+	}, []string{"sucursal"})
+)
+
+func init() {
+	Registro.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpPeticiones,
+		httpDuracion,
+		sincronizaciones,
+		sincronizacionDuracion,
+		pedidosPendientes,
+		pedidosCreados,
+		ingresos,
+	)
+	// Inicializa las series para que existan aunque aún no haya eventos
+	sincronizaciones.WithLabelValues("ok")
+	sincronizaciones.WithLabelValues("error")
+}
+
+// Handler devuelve el handler HTTP para /metrics.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registro, promhttp.HandlerOpts{Registry: Registro})
+}
+
+// RegistrarPoolBD publica las estadísticas de sql.DBStats de un pool con la
+// etiqueta db_name (p. ej. "local" o "remote").
+func RegistrarPoolBD(nombre string, conn *sql.DB) error {
+	return Registro.Register(collectors.NewDBStatsCollector(conn, nombre))
+}
+
+// ---------------------------
+// HTTP
+// ---------------------------
+
+type respuestaConEstatus struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *respuestaConEstatus) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *respuestaConEstatus) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// MiddlewareHTTP mide peticiones usando la plantilla de ruta de mux (p. ej.
+// /api/pedidos/{id_pedido}) para no crear una serie por cada ID. Debe
+// registrarse con Router.Use para que la ruta ya esté resuelta.
+func MiddlewareHTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inicio := time.Now()
+		rw := &respuestaConEstatus{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, r)
+
+		ruta := PlantillaRuta(r)
+		httpPeticiones.WithLabelValues(ruta, r.Method, strconv.Itoa(rw.status)).Inc()
+		httpDuracion.WithLabelValues(ruta, r.Method).Observe(time.Since(inicio).Seconds())
+	})
+}
+
+// PlantillaRuta regresa la plantilla de la ruta de mux que atendió la petición.
+func PlantillaRuta(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tpl, err := route.GetPathTemplate(); err == nil {
+			return tpl
+		}
+	}
+	return "sin_ruta"
+}
+
+// ---------------------------
+// SINCRONIZADOR
+// ---------------------------
+
+// ObservarSincronizacion registra el resultado y la duración de una sincronización.
+func ObservarSincronizacion(duracion time.Duration, err error) {
+	sincronizacionDuracion.Observe(duracion.Seconds())
+	if err != nil {
+		sincronizaciones.WithLabelValues("error").Inc()
+		return
+	}
+	sincronizaciones.WithLabelValues("ok").Inc()
+}
+
+// PedidosPendientes actualiza el tamaño del rezago de sincronización.
+func PedidosPendientes(n int) {
+	pedidosPendientes.Set(float64(n))
+}
+
+// ---------------------------
+// NEGOCIO
+// ---------------------------
+
+// PedidoCreado cuenta un pedido confirmado y suma su total a la sucursal.
+func PedidoCreado(idSucursal int, total float64) {
+	sucursal := strconv.Itoa(idSucursal)
+	pedidosCreados.WithLabelValues(sucursal).Inc()
+	ingresos.WithLabelValues(sucursal).Add(total)
+}
@@ -0,0 +1,75 @@
+package metricas
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/gorilla/mux"
+)
+
+func scrape(t *testing.T) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status de /metrics = %d", rec.Code)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	return string(body)
+}
+
+func TestMetricasExpuestas(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(MiddlewareHTTP)
+	r.HandleFunc("/api/pedidos/{id_pedido}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}).Methods("GET")
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/pedidos/42", nil))
+
+	// sql.Open no conecta; basta para leer Stats().
+	local, err := sql.Open("mysql", "u:p@tcp(127.0.0.1:1)/x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer local.Close()
+	if err := RegistrarPoolBD("local_test", local); err != nil {
+		t.Fatal(err)
+	}
+
+	ObservarSincronizacion(150*time.Millisecond, nil)
+	ObservarSincronizacion(20*time.Millisecond, errors.New("remota caída"))
+	PedidosPendientes(3)
+	PedidoCreado(7, 1160.5)
+
+	body := scrape(t)
+	esperadas := []string{
+		`tienda_http_requests_total{method="GET",route="/api/pedidos/{id_pedido}",status="404"} 1`,
+		`tienda_http_request_duration_seconds_bucket{method="GET",route="/api/pedidos/{id_pedido}",le="+Inf"} 1`,
+		`go_sql_open_connections{db_name="local_test"}`,
+		`go_sql_max_open_connections{db_name="local_test"}`,
+		`tienda_sync_pedidos_total{resultado="ok"} 1`,
+		`tienda_sync_pedidos_total{resultado="error"} 1`,
+		`tienda_sync_pedido_duration_seconds_count 2`,
+		`tienda_sync_pedidos_pendientes 3`,
+		`tienda_pedidos_creados_total{sucursal="7"} 1`,
+		`tienda_pedidos_ingresos_total{sucursal="7"} 1160.5`,
+	}
+	for _, serie := range esperadas {
+		if !strings.Contains(body, serie) {
+			t.Errorf("falta la serie %q en /metrics", serie)
+		}
+	}
+}
+
+func TestPlantillaRutaSinRuta(t *testing.T) {
+	if got := PlantillaRuta(httptest.NewRequest(http.MethodGet, "/x", nil)); got != "sin_ruta" {
+		t.Errorf("PlantillaRuta sin mux = %q, se esperaba sin_ruta", got)
+	}
+}
@@ -0,0 +1,347 @@
+// Package migraciones aplica el esquema versionado de la base local. Los
+// archivos sql/NNNN_nombre.up.sql y sql/NNNN_nombre.down.sql van embebidos en
+// el binario y las versiones aplicadas se registran en schema_migrations.
+package migraciones
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sql/*.sql
+var archivos embed.FS
+
+// nombreBloqueo es el GET_LOCK que evita que dos réplicas migren a la vez.
+const nombreBloqueo = "tienda_schema_migrations"
+
+const crearTablaVersiones = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version     INT          NOT NULL,
+    nombre      VARCHAR(150) NOT NULL,
+    aplicada_en DATETIME     NOT NULL,
+    PRIMARY KEY (version)
+)`
+
+// Migracion es un par up/down identificado por su versión. Un down sin
+// sentencias (sólo comentarios) marca una migración que no se revierte.
+type Migracion struct {
+	Version int
+	Nombre  string
+	Up      string
+	Down    string
+}
+
+// Estado indica si una migración ya está aplicada en la base.
+type Estado struct {
+	Version    int    `json:"version"`
+	Nombre     string `json:"nombre"`
+	Aplicada   bool   `json:"aplicada"`
+	AplicadaEn string `json:"aplicada_en,omitempty"`
+}
+
+// Cargar lee las migraciones embebidas ordenadas por versión.
+func Cargar() ([]Migracion, error) {
+	return cargarDesde(archivos, "sql")
+}
+
+func cargarDesde(fsys fs.FS, dir string) ([]Migracion, error) {
+	entradas, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	porVersion := map[int]*Migracion{}
+	for _, e := range entradas {
+		nombre := e.Name()
+		var direccion string
+		switch {
+		case strings.HasSuffix(nombre, ".up.sql"):
+			direccion = "up"
+		case strings.HasSuffix(nombre, ".down.sql"):
+			direccion = "down"
+		default:
+			continue
+		}
+		base := strings.TrimSuffix(nombre, "."+direccion+".sql")
+		num, resto, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("nombre de migración inválido: %s (se espera NNNN_nombre.up.sql)", nombre)
+		}
+		contenido, err := fs.ReadFile(fsys, path.Join(dir, nombre))
+		if err != nil {
+			return nil, err
+		}
+		m := porVersion[version]
+		if m == nil {
+			m = &Migracion{Version: version, Nombre: resto}
+			porVersion[version] = m
+		} else if m.Nombre != resto {
+			return nil, fmt.Errorf("versión %d repetida: %s y %s", version, m.Nombre, resto)
+		}
+		if direccion == "up" {
+			m.Up = string(contenido)
+		} else {
+			m.Down = string(contenido)
+		}
+	}
+
+	lista := make([]Migracion, 0, len(porVersion))
+	for _, m := range porVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("la migración %04d_%s debe tener archivo up y down", m.Version, m.Nombre)
+		}
+		lista = append(lista, *m)
+	}
+	sort.Slice(lista, func(i, j int) bool { return lista[i].Version < lista[j].Version })
+	return lista, nil
+}
+
+// Aplicar ejecuta en orden las migraciones pendientes y regresa las aplicadas.
+func Aplicar(ctx context.Context, db *sql.DB) ([]Migracion, error) {
+	todas, err := Cargar()
+	if err != nil {
+		return nil, err
+	}
+	var aplicadas []Migracion
+	err = conBloqueo(ctx, db, func(conn *sql.Conn) error {
+		hechas, err := versionesAplicadas(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range todas {
+			if _, ok := hechas[m.Version]; ok {
+				continue
+			}
+			if err := ejecutar(ctx, conn, m.Up); err != nil {
+				return fmt.Errorf("migración %04d_%s: %w", m.Version, m.Nombre, err)
+			}
+			if _, err := conn.ExecContext(ctx,
+				`INSERT INTO schema_migrations (version, nombre, aplicada_en) VALUES (?, ?, ?)`,
+				m.Version, m.Nombre, time.Now().UTC().Format("2006-01-02 15:04:05")); err != nil {
+				return fmt.Errorf("registrando migración %04d: %w", m.Version, err)
+			}
+			aplicadas = append(aplicadas, m)
+		}
+		return nil
+	})
+	return aplicadas, err
+}
+
+// Revertir deshace las últimas `pasos` migraciones aplicadas (la más reciente primero).
+func Revertir(ctx context.Context, db *sql.DB, pasos int) ([]Migracion, error) {
+	if pasos <= 0 {
+		return nil, fmt.Errorf("el número de pasos debe ser mayor a cero")
+	}
+	todas, err := Cargar()
+	if err != nil {
+		return nil, err
+	}
+	porVersion := map[int]Migracion{}
+	for _, m := range todas {
+		porVersion[m.Version] = m
+	}
+
+	var revertidas []Migracion
+	err = conBloqueo(ctx, db, func(conn *sql.Conn) error {
+		hechas, err := versionesAplicadas(ctx, conn)
+		if err != nil {
+			return err
+		}
+		versiones := make([]int, 0, len(hechas))
+		for v := range hechas {
+			versiones = append(versiones, v)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(versiones)))
+
+		for i := 0; i < pasos && i < len(versiones); i++ {
+			m, ok := porVersion[versiones[i]]
+			if !ok {
+				return fmt.Errorf("la versión %d está aplicada pero no existe en este binario", versiones[i])
+			}
+			if len(Sentencias(m.Down)) == 0 {
+				return fmt.Errorf("%04d_%s no se puede revertir: adopta tablas que ya existían", m.Version, m.Nombre)
+			}
+			if err := ejecutar(ctx, conn, m.Down); err != nil {
+				return fmt.Errorf("revirtiendo %04d_%s: %w", m.Version, m.Nombre, err)
+			}
+			if _, err := conn.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = ?`, m.Version); err != nil {
+				return fmt.Errorf("borrando registro de %04d: %w", m.Version, err)
+			}
+			revertidas = append(revertidas, m)
+		}
+		return nil
+	})
+	return revertidas, err
+}
+
+// Estados lista todas las migraciones conocidas y si están aplicadas.
+func Estados(ctx context.Context, db *sql.DB) ([]Estado, error) {
+	todas, err := Cargar()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, crearTablaVersiones); err != nil {
+		return nil, fmt.Errorf("creando schema_migrations: %w", err)
+	}
+	hechas, err := versionesAplicadas(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	estados := make([]Estado, 0, len(todas))
+	for _, m := range todas {
+		e := Estado{Version: m.Version, Nombre: m.Nombre}
+		if fecha, ok := hechas[m.Version]; ok {
+			e.Aplicada = true
+			e.AplicadaEn = fecha
+		}
+		estados = append(estados, e)
+	}
+	return estados, nil
+}
+
+// conBloqueo toma una conexión dedicada (GET_LOCK es por sesión), asegura la
+// tabla schema_migrations y ejecuta fn con el candado tomado.
+func conBloqueo(ctx context.Context, db *sql.DB, fn func(conn *sql.Conn) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var ok sql.NullInt64
+	if err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, 60)`, nombreBloqueo).Scan(&ok); err != nil {
+		return fmt.Errorf("tomando candado de migraciones: %w", err)
+	}
+	if !ok.Valid || ok.Int64 != 1 {
+		return fmt.Errorf("otra instancia está aplicando migraciones")
+	}
+	defer conn.ExecContext(context.Background(), `SELECT RELEASE_LOCK(?)`, nombreBloqueo)
+
+	if _, err := conn.ExecContext(ctx, crearTablaVersiones); err != nil {
+		return fmt.Errorf("creando schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+func versionesAplicadas(ctx context.Context, conn *sql.Conn) (map[int]string, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, CAST(aplicada_en AS CHAR) FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("leyendo schema_migrations: %w", err)
+	}
+	defer rows.Close()
+	hechas := map[int]string{}
+	for rows.Next() {
+		var v int
+		var fecha string
+		if err := rows.Scan(&v, &fecha); err != nil {
+			return nil, err
+		}
+		hechas[v] = fecha
+	}
+	return hechas, rows.Err()
+}
+
+// ejecutar corre las sentencias del archivo una por una: el driver no tiene
+// multiStatements y el DDL de MySQL no es transaccional de todos modos. Para
+// que una migración que falló a la mitad pueda reintentarse, las tablas usan
+// IF [NOT] EXISTS, los datos se copian sólo si faltan y los cambios de
+// columnas e índices, que en MySQL no tienen IF [NOT] EXISTS, se saltan si ya
+// están hechos (ver hecha).
+func ejecutar(ctx context.Context, conn *sql.Conn, script string) error {
+	for _, s := range Sentencias(script) {
+		lista, err := hecha(ctx, conn, s)
+		if err != nil {
+			return err
+		}
+		if lista {
+			continue
+		}
+		if _, err := conn.ExecContext(ctx, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Cambios de columnas e índices que se revisan en information_schema antes de
+// ejecutarse. Cada ALTER TABLE debe hacer un solo cambio.
+var (
+	agregaColumna = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(\w+)\s+ADD\s+COLUMN\s+(\w+)\s`)
+	quitaColumna  = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(\w+)\s+DROP\s+COLUMN\s+(\w+)$`)
+	agregaIndice  = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(\w+)\s+ADD\s+(?:UNIQUE\s+)?(?:KEY|INDEX)\s+(\w+)\s`)
+	quitaIndice   = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(\w+)\s+DROP\s+(?:KEY|INDEX)\s+(\w+)$`)
+	creaIndice    = regexp.MustCompile(`(?is)^CREATE\s+(?:UNIQUE\s+)?INDEX\s+(\w+)\s+ON\s+(\w+)\s`)
+	borraIndice   = regexp.MustCompile(`(?is)^DROP\s+INDEX\s+(\w+)\s+ON\s+(\w+)$`)
+)
+
+// hecha dice si el cambio de columna o índice de s ya está en la base: la
+// columna o el índice que agrega ya existe, o el que quita ya no. Cualquier
+// otra sentencia se ejecuta siempre.
+func hecha(ctx context.Context, conn *sql.Conn, s string) (bool, error) {
+	const columna = `SELECT COUNT(*) FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`
+	const indice = `SELECT COUNT(*) FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = ?`
+	var consulta, tabla, nombre string
+	agrega := true
+	if m := agregaColumna.FindStringSubmatch(s); m != nil {
+		consulta, tabla, nombre = columna, m[1], m[2]
+	} else if m := quitaColumna.FindStringSubmatch(s); m != nil {
+		consulta, tabla, nombre, agrega = columna, m[1], m[2], false
+	} else if m := agregaIndice.FindStringSubmatch(s); m != nil {
+		consulta, tabla, nombre = indice, m[1], m[2]
+	} else if m := quitaIndice.FindStringSubmatch(s); m != nil {
+		consulta, tabla, nombre, agrega = indice, m[1], m[2], false
+	} else if m := creaIndice.FindStringSubmatch(s); m != nil {
+		consulta, tabla, nombre = indice, m[2], m[1]
+	} else if m := borraIndice.FindStringSubmatch(s); m != nil {
+		consulta, tabla, nombre, agrega = indice, m[2], m[1], false
+	} else {
+		return false, nil
+	}
+	var n int
+	if err := conn.QueryRowContext(ctx, consulta, tabla, nombre).Scan(&n); err != nil {
+		return false, fmt.Errorf("revisando %s.%s: %w", tabla, nombre, err)
+	}
+	return (n > 0) == agrega, nil
+}
+
+// Sentencias separa un script en sentencias terminadas en ';' al final de la
+// línea, ignorando las líneas de comentario (--).
+func Sentencias(script string) []string {
+	var sentencias []string
+	var actual strings.Builder
+	for _, linea := range strings.Split(strings.ReplaceAll(script, "\r\n", "\n"), "\n") {
+		recortada := strings.TrimSpace(linea)
+		if recortada == "" || strings.HasPrefix(recortada, "--") {
+			continue
+		}
+		actual.WriteString(linea)
+		actual.WriteString("\n")
+		if strings.HasSuffix(recortada, ";") {
+			s := strings.TrimSuffix(strings.TrimSpace(actual.String()), ";")
+			if s != "" {
+				sentencias = append(sentencias, s)
+			}
+			actual.Reset()
+		}
+	}
+	if s := strings.TrimSpace(actual.String()); s != "" {
+		sentencias = append(sentencias, s)
+	}
+	return sentencias
+}
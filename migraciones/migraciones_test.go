@@ -0,0 +1,58 @@
+package migraciones
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigracionesEmbebidas(t *testing.T) {
+	lista, err := Cargar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lista) == 0 {
+		t.Fatal("no hay migraciones embebidas")
+	}
+	for i, m := range lista {
+		if m.Version != i+1 {
+			t.Errorf("versión %d en la posición %d: las versiones deben ser consecutivas", m.Version, i)
+		}
+		if len(Sentencias(m.Up)) == 0 {
+			t.Errorf("%04d_%s: up sin sentencias", m.Version, m.Nombre)
+		}
+		// Sólo las que adoptan tablas de producción no se revierten
+		if irreversible := m.Version <= 3; (len(Sentencias(m.Down)) == 0) != irreversible {
+			t.Errorf("%04d_%s: down con sentencias = %v", m.Version, m.Nombre, !irreversible)
+		}
+	}
+
+	// Las tablas locales de las que depende el código deben crearse en algún up.
+	var todo strings.Builder
+	for _, m := range lista {
+		todo.WriteString(m.Up)
+	}
+	for _, tabla := range []string{
+		"pedidos", "detalle_pedidos", "refresh_tokens", "ind_diario", "ind_mensual",
+		"empresa_config_visual", "empresa_logos", "log_sincronizacion", "usuarios",
+		"tiendas", "admin_usuarios", "crm_productos", "crm_impuestos", "categorias",
+		"adm_empresas", "adm_sucursales", "adm_sucursales_ptos",
+	} {
+		if !strings.Contains(todo.String(), "CREATE TABLE IF NOT EXISTS "+tabla+" (") {
+			t.Errorf("ninguna migración crea la tabla %s", tabla)
+		}
+	}
+}
+
+func TestSentencias(t *testing.T) {
+	script := "-- comentario; con punto y coma\r\nCREATE TABLE a (\r\n    id INT\r\n);\r\n\r\nDROP TABLE b;\r\nSELECT 1"
+	got := Sentencias(script)
+	want := []string{"CREATE TABLE a (\n    id INT\n)", "DROP TABLE b", "SELECT 1"}
+	if len(got) != len(want) {
+		t.Fatalf("Sentencias = %q, se esperaba %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("sentencia %d = %q, se esperaba %q", i, got[i], want[i])
+		}
+	}
+}
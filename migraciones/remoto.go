@@ -0,0 +1,176 @@
+package migraciones
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TablaRemota describe lo que el servicio necesita de una tabla del ERP: las
+// columnas en las que escribe o lee y las llaves únicas de las que dependen sus
+// INSERT ... ON DUPLICATE KEY UPDATE.
+type TablaRemota struct {
+	Nombre       string
+	Columnas     []string
+	LlavesUnicas [][]string
+}
+
+// EsquemaRemotoEsperado son las tablas del ERP que toca el servicio. La base
+// remota no se migra desde aquí: sólo se verifica.
+var EsquemaRemotoEsperado = []TablaRemota{
+	{
+		Nombre:       "crm_indices",
+		Columnas:     []string{"idsucursal", "idpedido", "idcliente"},
+		LlavesUnicas: [][]string{{"idsucursal"}},
+	},
+	{
+		Nombre: "crm_pedidos",
+		Columnas: []string{
+			"id_pedido", "idpedido", "clave_pedido", "estatus", "fecha_entrega", "mom_creacion",
+			"fecha", "mom_entrega", "comentarios", "clave_cliente", "cliente", "persona", "monto",
+			"iva", "ieps", "descuento", "facturar", "idlista", "idmetodopago", "num_orden",
+			"tot_renglones", "web_movil", "telefonico_presencial", "idsucursal", "id_cliente",
+		},
+	},
+	{
+		Nombre:   "crm_pedidos_det",
+		Columnas: []string{"id_pedido", "idproducto", "orden", "descripcion", "precio", "cantidad", "precio_o", "iva", "ieps"},
+	},
+	{
+		Nombre:       "est_ventas_x_producto_dia",
+		Columnas:     []string{"idsucursal", "idproducto", "dia", "cantidad"},
+		LlavesUnicas: [][]string{{"idsucursal", "idproducto", "dia"}},
+	},
+	{
+		Nombre:       "est_ventas_x_producto_mes",
+		Columnas:     []string{"idsucursal", "idproducto", "dia", "cantidad"},
+		LlavesUnicas: [][]string{{"idsucursal", "idproducto", "dia"}},
+	},
+	{
+		Nombre: "crm_clientes",
+		Columnas: []string{
+			"id_cliente", "idsucursal", "estatus", "clave_mobile", "nombre_comercial", "razon_social",
+			"rfc", "idcliente", "tipo_cliente", "lista_precio", "ofi_calle", "ofi_num_ext",
+			"ofi_colonia", "ofi_ciudad", "ofi_estado", "ofi_cod_postal", "tel_contacto", "clave",
+		},
+	},
+}
+
+// Diferencia es algo que el servicio espera en la base remota y no encontró.
+type Diferencia struct {
+	Tabla   string `json:"tabla"`
+	Detalle string `json:"detalle"`
+}
+
+func (d Diferencia) String() string {
+	return d.Tabla + ": " + d.Detalle
+}
+
+// VerificarRemoto compara EsquemaRemotoEsperado con information_schema de la
+// base actual de la conexión. Sólo ejecuta SELECT.
+func VerificarRemoto(ctx context.Context, db *sql.DB) ([]Diferencia, error) {
+	return verificarEsquema(ctx, db, EsquemaRemotoEsperado)
+}
+
+func verificarEsquema(ctx context.Context, db *sql.DB, esperado []TablaRemota) ([]Diferencia, error) {
+	columnas := map[string]map[string]bool{}
+	rows, err := db.QueryContext(ctx, `
+		SELECT LOWER(TABLE_NAME), LOWER(COLUMN_NAME)
+		FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE()`)
+	if err != nil {
+		return nil, fmt.Errorf("leyendo columnas remotas: %w", err)
+	}
+	for rows.Next() {
+		var tabla, columna string
+		if err := rows.Scan(&tabla, &columna); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if columnas[tabla] == nil {
+			columnas[tabla] = map[string]bool{}
+		}
+		columnas[tabla][columna] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// índice -> columnas en orden, sólo de índices únicos
+	unicas := map[string]map[string][]string{}
+	rows, err = db.QueryContext(ctx, `
+		SELECT LOWER(TABLE_NAME), INDEX_NAME, LOWER(COLUMN_NAME)
+		FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE() AND NON_UNIQUE = 0
+		ORDER BY TABLE_NAME, INDEX_NAME, SEQ_IN_INDEX`)
+	if err != nil {
+		return nil, fmt.Errorf("leyendo índices remotos: %w", err)
+	}
+	for rows.Next() {
+		var tabla, indice, columna string
+		if err := rows.Scan(&tabla, &indice, &columna); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if unicas[tabla] == nil {
+			unicas[tabla] = map[string][]string{}
+		}
+		unicas[tabla][indice] = append(unicas[tabla][indice], columna)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var diferencias []Diferencia
+	for _, t := range esperado {
+		tabla := strings.ToLower(t.Nombre)
+		cols, ok := columnas[tabla]
+		if !ok {
+			diferencias = append(diferencias, Diferencia{Tabla: t.Nombre, Detalle: "no existe la tabla"})
+			continue
+		}
+		var faltan []string
+		for _, c := range t.Columnas {
+			if !cols[strings.ToLower(c)] {
+				faltan = append(faltan, c)
+			}
+		}
+		if len(faltan) > 0 {
+			diferencias = append(diferencias, Diferencia{Tabla: t.Nombre, Detalle: "faltan columnas: " + strings.Join(faltan, ", ")})
+		}
+		for _, llave := range t.LlavesUnicas {
+			if !tieneLlaveUnica(unicas[tabla], llave) {
+				diferencias = append(diferencias, Diferencia{
+					Tabla:   t.Nombre,
+					Detalle: "falta llave única (" + strings.Join(llave, ", ") + ")",
+				})
+			}
+		}
+	}
+	return diferencias, nil
+}
+
+// tieneLlaveUnica acepta cualquier índice único con exactamente esas columnas,
+// sin importar el orden.
+func tieneLlaveUnica(indices map[string][]string, llave []string) bool {
+	buscada := normalizarColumnas(llave)
+	for _, cols := range indices {
+		if normalizarColumnas(cols) == buscada {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizarColumnas(cols []string) string {
+	c := make([]string, len(cols))
+	for i, s := range cols {
+		c[i] = strings.ToLower(s)
+	}
+	sort.Strings(c)
+	return strings.Join(c, ",")
+}
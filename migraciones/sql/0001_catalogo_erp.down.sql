@@ -0,0 +1,3 @@
+-- No se revierte: estas tablas se adoptan de bases que ya existían (IF NOT
+-- EXISTS) y borrarlas tiraría el catálogo del ERP. Sin sentencias, Revertir
+-- se detiene aquí.
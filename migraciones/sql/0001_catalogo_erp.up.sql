@@ -0,0 +1,114 @@
+-- Réplica local del catálogo del ERP: empresas, sucursales (con su geocerca),
+-- categorías, impuestos y productos. Sólo se incluyen las columnas que usa el
+-- servicio. IF NOT EXISTS permite adoptar bases que ya existían sin DDL.
+
+CREATE TABLE IF NOT EXISTS adm_empresas (
+    idempresa        INT          NOT NULL AUTO_INCREMENT,
+    nombre_comercial VARCHAR(150) NOT NULL DEFAULT '',
+    estatus          CHAR(1)      NOT NULL DEFAULT 'S',
+    PRIMARY KEY (idempresa)
+);
+
+CREATE TABLE IF NOT EXISTS adm_sucursales (
+    idsucursal   INT          NOT NULL AUTO_INCREMENT,
+    idempresa    INT          NOT NULL,
+    sucursal     VARCHAR(150) NOT NULL DEFAULT '',
+    direccion    VARCHAR(255) NULL,
+    ciudad       VARCHAR(100) NULL,
+    colonia      VARCHAR(100) NULL,
+    cp           VARCHAR(10)  NULL,
+    estatus      CHAR(1)      NOT NULL DEFAULT 'S',
+    tipo_objeto  CHAR(1)      NOT NULL DEFAULT 'N',
+    radio        DOUBLE       NOT NULL DEFAULT 0,
+    lista_precios INT         NOT NULL DEFAULT 1,
+    PRIMARY KEY (idsucursal),
+    KEY idx_adm_sucursales_empresa (idempresa, estatus)
+);
+
+-- Vértices de la geocerca de cada sucursal (círculo: 1 punto, rectángulo: 2,
+-- polígono: N). punto guarda (latitud, longitud) como lo lee db/geo_sucursal.go.
+CREATE TABLE IF NOT EXISTS adm_sucursales_ptos (
+    id         INT   NOT NULL AUTO_INCREMENT,
+    idsucursal INT   NOT NULL,
+    orden      INT   NOT NULL DEFAULT 0,
+    punto      POINT NOT NULL,
+    PRIMARY KEY (id),
+    KEY idx_adm_sucursales_ptos_sucursal (idsucursal, orden)
+);
+
+CREATE TABLE IF NOT EXISTS categorias (
+    idcategoria INT          NOT NULL AUTO_INCREMENT,
+    categoria   VARCHAR(150) NOT NULL,
+    estatus     CHAR(1)      NOT NULL DEFAULT 'S',
+    PRIMARY KEY (idcategoria)
+);
+
+CREATE TABLE IF NOT EXISTS crm_impuestos (
+    idiva       INT           NOT NULL AUTO_INCREMENT,
+    idempresa   INT           NOT NULL,
+    descripcion VARCHAR(100)  NOT NULL DEFAULT '',
+    iva         DECIMAL(6,2)  NOT NULL DEFAULT 0,
+    tipo_iva    VARCHAR(20)   NOT NULL DEFAULT '',
+    ieps1       DECIMAL(6,2)  NULL,
+    ieps2       DECIMAL(6,2)  NULL,
+    ieps3       DECIMAL(6,2)  NULL,
+    PRIMARY KEY (idiva),
+    KEY idx_crm_impuestos_empresa (idempresa)
+);
+
+CREATE TABLE IF NOT EXISTS crm_productos (
+    idproducto        INT           NOT NULL AUTO_INCREMENT,
+    idempresa         INT           NOT NULL,
+    idlinea           INT           NULL,
+    descripcion       VARCHAR(255)  NOT NULL,
+    estatus           CHAR(1)       NOT NULL DEFAULT 'S',
+    tipo_prod         VARCHAR(10)   NULL,
+    idcategoria       INT           NULL,
+    clasif            VARCHAR(20)   NULL,
+    con_formula       CHAR(1)       NULL,
+    clave             VARCHAR(50)   NULL,
+    idiva             INT           NULL,
+    cod_barras        VARCHAR(50)   NULL,
+    precio1           DECIMAL(14,4) NULL,
+    precio2           DECIMAL(14,4) NULL,
+    precio3           DECIMAL(14,4) NULL,
+    precio4           DECIMAL(14,4) NULL,
+    precio5           DECIMAL(14,4) NULL,
+    precio6           DECIMAL(14,4) NULL,
+    precio7           DECIMAL(14,4) NULL,
+    precio8           DECIMAL(14,4) NULL,
+    precio9           DECIMAL(14,4) NULL,
+    precio10          DECIMAL(14,4) NULL,
+    precio11          DECIMAL(14,4) NULL,
+    precio12          DECIMAL(14,4) NULL,
+    precio13          DECIMAL(14,4) NULL,
+    precio14          DECIMAL(14,4) NULL,
+    precio15          DECIMAL(14,4) NULL,
+    precio16          DECIMAL(14,4) NULL,
+    precio17          DECIMAL(14,4) NULL,
+    precio18          DECIMAL(14,4) NULL,
+    precio19          DECIMAL(14,4) NULL,
+    precio20          DECIMAL(14,4) NULL,
+    precio21          DECIMAL(14,4) NULL,
+    precio22          DECIMAL(14,4) NULL,
+    precio23          DECIMAL(14,4) NULL,
+    precio24          DECIMAL(14,4) NULL,
+    precio25          DECIMAL(14,4) NULL,
+    ieps_adic         DECIMAL(14,4) NULL,
+    con_ieps_adic     CHAR(1)       NULL,
+    unidad            VARCHAR(20)   NULL,
+    unidad_ent        VARCHAR(20)   NULL,
+    factor_conversion DECIMAL(14,4) NULL,
+    sat_clave         VARCHAR(20)   NULL,
+    sat_medida        VARCHAR(20)   NULL,
+    volumen           DECIMAL(14,4) NULL,
+    peso              DECIMAL(14,4) NULL,
+    idmoneda          INT           NULL,
+    lote              CHAR(1)       NULL,
+    desc_ticket       VARCHAR(100)  NULL,
+    cant_sig_lista    INT           NULL,
+    en_venta          CHAR(1)       NULL,
+    PRIMARY KEY (idproducto),
+    KEY idx_crm_productos_categoria (idcategoria, estatus),
+    KEY idx_crm_productos_clave (clave)
+);
@@ -0,0 +1,78 @@
+-- Clientes de la tienda en línea, sus tiendas, administradores y refresh tokens.
+
+CREATE TABLE IF NOT EXISTS usuarios (
+    id_usuario             INT          NOT NULL AUTO_INCREMENT,
+    id_empresa             INT          NOT NULL,
+    tipo_usuario           VARCHAR(20)  NOT NULL,
+    nombre_completo        VARCHAR(150) NOT NULL,
+    correo                 VARCHAR(150) NOT NULL,
+    telefono               VARCHAR(20)  NULL,
+    clave                  VARCHAR(255) NOT NULL,
+    clave_remota           VARCHAR(50)  NULL,
+    fecha_registro         DATETIME     NOT NULL,
+    ultimo_acceso          DATETIME     NULL,
+    estatus                VARCHAR(20)  NOT NULL DEFAULT 'activo',
+    requiere_cambiar_clave BOOLEAN      NOT NULL DEFAULT FALSE,
+    id_remoto              BIGINT       NULL,
+    PRIMARY KEY (id_usuario),
+    UNIQUE KEY uq_usuarios_correo (correo)
+);
+
+-- ubicacion guarda POINT(longitud, latitud): se lee con ST_Y/ST_X.
+CREATE TABLE IF NOT EXISTS tiendas (
+    id_tienda            INT          NOT NULL AUTO_INCREMENT,
+    id_usuario           INT          NOT NULL,
+    id_empresa           INT          NOT NULL,
+    idsucursal           INT          NULL,
+    nombre_sucursal      VARCHAR(150) NULL,
+    nombre_tienda        VARCHAR(150) NOT NULL,
+    razon_social         VARCHAR(200) NULL,
+    rfc                  VARCHAR(13)  NULL,
+    direccion            VARCHAR(255) NULL,
+    colonia              VARCHAR(100) NULL,
+    codigo_postal        VARCHAR(10)  NULL,
+    ciudad               VARCHAR(100) NULL,
+    estado               VARCHAR(100) NULL,
+    pais                 VARCHAR(100) NULL,
+    tipo_tienda          VARCHAR(50)  NULL,
+    latitud              DOUBLE       NULL,
+    longitud             DOUBLE       NULL,
+    ubicacion            POINT        NULL,
+    horario_apertura     VARCHAR(10)  NULL,
+    horario_cierre       VARCHAR(10)  NULL,
+    dias_operacion       VARCHAR(100) NULL,
+    fecha_registro       DATETIME     NOT NULL,
+    ultima_actualizacion DATETIME     NULL,
+    estatus              VARCHAR(20)  NOT NULL DEFAULT 'activo',
+    PRIMARY KEY (id_tienda),
+    KEY idx_tiendas_usuario (id_usuario)
+);
+
+-- permisos y config_entrega son JSON guardado como texto.
+CREATE TABLE IF NOT EXISTS admin_usuarios (
+    idusuario      INT          NOT NULL AUTO_INCREMENT,
+    idperfil       INT          NOT NULL DEFAULT 0,
+    permisos       TEXT         NULL,
+    tipo_usuario   VARCHAR(20)  NOT NULL DEFAULT 'Admin',
+    correo         VARCHAR(150) NOT NULL,
+    clave          VARCHAR(255) NOT NULL,
+    config_entrega TEXT         NULL,
+    PRIMARY KEY (idusuario),
+    UNIQUE KEY uq_admin_usuarios_correo (correo)
+);
+
+-- tipo_usuario distingue clientes (C) de administradores (A): usuario_id
+-- apunta a usuarios o a admin_usuarios según el caso.
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id           INT          NOT NULL AUTO_INCREMENT,
+    usuario_id   INT          NOT NULL,
+    tipo_usuario VARCHAR(20)  NOT NULL,
+    token_hash   VARCHAR(255) NOT NULL,
+    user_agent   VARCHAR(255) NULL,
+    ip_address   VARCHAR(45)  NULL,
+    expiracion   DATETIME     NOT NULL,
+    ultimo_uso   DATETIME     NULL,
+    estado       VARCHAR(20)  NOT NULL DEFAULT 'activo',
+    PRIMARY KEY (id),
+    KEY idx_refresh_tokens_usuario (usuario_id, tipo_usuario, estado)
+);
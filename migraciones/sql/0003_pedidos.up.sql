@@ -0,0 +1,76 @@
+-- Pedidos de la tienda en línea y su bitácora de sincronización con el ERP.
+-- id_principal es el folio por sucursal (crm_indices.idpedido) e id_remoto el
+-- crm_pedidos.id_pedido que se generó en el ERP.
+
+CREATE TABLE IF NOT EXISTS pedidos (
+    id_pedido            BIGINT        NOT NULL AUTO_INCREMENT,
+    clave_unica          VARCHAR(50)   NOT NULL,
+    id_usuario           INT           NOT NULL,
+    id_tienda            INT           NOT NULL,
+    id_sucursal          INT           NOT NULL,
+    fecha_creacion       DATETIME      NOT NULL,
+    fecha_entrega        DATETIME      NULL,
+    subtotal             DECIMAL(14,4) NOT NULL DEFAULT 0,
+    descuento            DECIMAL(14,4) NOT NULL DEFAULT 0,
+    iva                  DECIMAL(14,4) NOT NULL DEFAULT 0,
+    ieps                 DECIMAL(14,4) NOT NULL DEFAULT 0,
+    total                DECIMAL(14,4) NOT NULL DEFAULT 0,
+    id_metodo_pago       INT           NOT NULL DEFAULT 0,
+    referencia_pago      VARCHAR(100)  NULL,
+    direccion_entrega    VARCHAR(255)  NULL,
+    colonia_entrega      VARCHAR(100)  NULL,
+    cp_entrega           VARCHAR(10)   NULL,
+    ciudad_entrega       VARCHAR(100)  NULL,
+    estado_entrega       VARCHAR(100)  NULL,
+    latitud_entrega      DOUBLE        NULL,
+    longitud_entrega     DOUBLE        NULL,
+    estatus              VARCHAR(20)   NOT NULL DEFAULT 'pendiente',
+    comentarios          TEXT          NULL,
+    origen_pedido        VARCHAR(20)   NULL,
+    id_lista_precio      INT           NOT NULL DEFAULT 1,
+    sincronizado         BOOLEAN       NOT NULL DEFAULT FALSE,
+    id_principal         BIGINT        NULL,
+    id_remoto            BIGINT        NULL,
+    fecha_sincronizacion DATETIME      NULL,
+    PRIMARY KEY (id_pedido),
+    UNIQUE KEY uq_pedidos_clave_unica (clave_unica),
+    KEY idx_pedidos_usuario (id_usuario, fecha_creacion),
+    KEY idx_pedidos_sincronizado (sincronizado, estatus),
+    KEY idx_pedidos_fecha_creacion (fecha_creacion)
+);
+
+CREATE TABLE IF NOT EXISTS detalle_pedidos (
+    id_detalle           BIGINT        NOT NULL AUTO_INCREMENT,
+    id_pedido            BIGINT        NOT NULL,
+    id_producto          INT           NOT NULL,
+    clave_producto       VARCHAR(50)   NULL,
+    descripcion          VARCHAR(255)  NULL,
+    unidad               VARCHAR(20)   NULL,
+    cantidad             DECIMAL(14,4) NOT NULL,
+    precio_unitario      DECIMAL(14,4) NOT NULL,
+    porcentaje_descuento DECIMAL(6,2)  NOT NULL DEFAULT 0,
+    importe_descuento    DECIMAL(14,4) NOT NULL DEFAULT 0,
+    subtotal             DECIMAL(14,4) NOT NULL DEFAULT 0,
+    importe_iva          DECIMAL(14,4) NOT NULL DEFAULT 0,
+    importe_ieps         DECIMAL(14,4) NOT NULL DEFAULT 0,
+    total                DECIMAL(14,4) NOT NULL DEFAULT 0,
+    latitud_entrega      DOUBLE        NULL,
+    longitud_entrega     DOUBLE        NULL,
+    estatus              VARCHAR(20)   NULL,
+    comentarios          TEXT          NULL,
+    fecha_registro       DATETIME      NOT NULL,
+    PRIMARY KEY (id_detalle),
+    KEY idx_detalle_pedidos_pedido (id_pedido)
+);
+
+CREATE TABLE IF NOT EXISTS log_sincronizacion (
+    id                   BIGINT      NOT NULL AUTO_INCREMENT,
+    id_pedido            BIGINT      NOT NULL,
+    id_principal         BIGINT      NULL,
+    id_remoto            BIGINT      NULL,
+    fecha_sincronizacion DATETIME    NOT NULL,
+    usuario              VARCHAR(100) NULL,
+    estado               VARCHAR(20) NOT NULL,
+    PRIMARY KEY (id),
+    KEY idx_log_sincronizacion_pedido (id_pedido)
+);
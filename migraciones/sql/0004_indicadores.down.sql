@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS ind_mensual;
+DROP TABLE IF EXISTS ind_diario;
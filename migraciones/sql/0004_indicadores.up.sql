@@ -0,0 +1,23 @@
+-- Acumulados de pedidos por día y por mes (fecha = primer día del mes). La
+-- llave única en fecha la exige el INSERT ... ON DUPLICATE KEY de
+-- InicializaIndicadoresHistoricos.
+
+CREATE TABLE IF NOT EXISTS ind_diario (
+    id           INT           NOT NULL AUTO_INCREMENT,
+    fecha        DATE          NOT NULL,
+    num_pedidos  INT           NOT NULL DEFAULT 0,
+    tot_pedidos  DECIMAL(16,4) NOT NULL DEFAULT 0,
+    num_clientes INT           NOT NULL DEFAULT 0,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_ind_diario_fecha (fecha)
+);
+
+CREATE TABLE IF NOT EXISTS ind_mensual (
+    id           INT           NOT NULL AUTO_INCREMENT,
+    fecha        DATE          NOT NULL,
+    num_pedidos  INT           NOT NULL DEFAULT 0,
+    tot_pedidos  DECIMAL(16,4) NOT NULL DEFAULT 0,
+    num_clientes INT           NOT NULL DEFAULT 0,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_ind_mensual_fecha (fecha)
+);
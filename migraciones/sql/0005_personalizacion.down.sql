@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS empresa_logos;
+DROP TABLE IF EXISTS empresa_config_visual;
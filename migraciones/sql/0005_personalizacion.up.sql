@@ -0,0 +1,21 @@
+-- Personalización visual (JSON como texto) y logos de la empresa.
+
+CREATE TABLE IF NOT EXISTS empresa_config_visual (
+    id         INT      NOT NULL AUTO_INCREMENT,
+    idempresa  INT      NOT NULL,
+    config     TEXT     NOT NULL,
+    updated_at DATETIME NOT NULL,
+    PRIMARY KEY (id),
+    KEY idx_empresa_config_visual_empresa (idempresa)
+);
+
+CREATE TABLE IF NOT EXISTS empresa_logos (
+    id            INT          NOT NULL AUTO_INCREMENT,
+    idempresa     INT          NOT NULL,
+    identificador VARCHAR(50)  NOT NULL,
+    imagen        MEDIUMBLOB   NOT NULL,
+    mime_type     VARCHAR(50)  NOT NULL,
+    updated_at    DATETIME     NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_empresa_logos_identificador (idempresa, identificador)
+);
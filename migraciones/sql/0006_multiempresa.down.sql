@@ -0,0 +1,6 @@
+ALTER TABLE usuarios DROP INDEX uq_usuarios_empresa_correo;
+ALTER TABLE usuarios ADD UNIQUE KEY uq_usuarios_correo (correo);
+DROP INDEX idx_pedidos_empresa ON pedidos;
+ALTER TABLE pedidos DROP COLUMN id_empresa;
+ALTER TABLE admin_usuarios DROP COLUMN idempresa;
+DROP TABLE IF EXISTS empresa_dominios;
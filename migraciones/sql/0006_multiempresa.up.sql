@@ -0,0 +1,28 @@
+-- Varias empresas del grupo en un mismo despliegue. empresa_dominios asigna
+-- los nombres de host de cada tienda en línea a su empresa. admin_usuarios
+-- con idempresa NULL administran todas las empresas. pedidos.id_empresa se
+-- llena a partir de la sucursal de los pedidos existentes. El correo de los
+-- usuarios es único por empresa: el mismo cliente puede tener cuenta en dos.
+
+CREATE TABLE IF NOT EXISTS empresa_dominios (
+    dominio   VARCHAR(255) NOT NULL,
+    idempresa INT          NOT NULL,
+    PRIMARY KEY (dominio),
+    KEY idx_empresa_dominios_empresa (idempresa)
+);
+
+ALTER TABLE admin_usuarios ADD COLUMN idempresa INT NULL;
+
+ALTER TABLE pedidos ADD COLUMN id_empresa INT NOT NULL DEFAULT 0;
+
+UPDATE pedidos SET id_empresa = (
+    SELECT s.idempresa FROM adm_sucursales s WHERE s.idsucursal = pedidos.id_sucursal
+) WHERE EXISTS (
+    SELECT 1 FROM adm_sucursales s WHERE s.idsucursal = pedidos.id_sucursal
+);
+
+CREATE INDEX idx_pedidos_empresa ON pedidos (id_empresa, fecha_creacion);
+
+ALTER TABLE usuarios DROP INDEX uq_usuarios_correo;
+
+ALTER TABLE usuarios ADD UNIQUE KEY uq_usuarios_empresa_correo (id_empresa, correo);
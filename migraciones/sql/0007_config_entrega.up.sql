@@ -0,0 +1,30 @@
+-- Configuración de entregas por empresa y, opcionalmente, por sucursal. La
+-- fila con idsucursal = 0 es la de la empresa; la de una sucursal sólo guarda
+-- los campos que cambian y hereda el resto. Se llena con la configuración que
+-- hasta ahora se leía de admin_usuarios (la de un admin de la empresa antes que
+-- la de uno de todo el grupo). admin_usuarios.config_entrega ya no se usa.
+
+CREATE TABLE IF NOT EXISTS config_entrega (
+    idempresa   INT      NOT NULL,
+    idsucursal  INT      NOT NULL DEFAULT 0,
+    config      TEXT     NOT NULL,
+    actualizado DATETIME NOT NULL,
+    PRIMARY KEY (idempresa, idsucursal)
+);
+
+INSERT INTO config_entrega (idempresa, idsucursal, config, actualizado)
+SELECT e.idempresa, 0, (
+    SELECT a.config_entrega FROM admin_usuarios a
+    WHERE a.tipo_usuario = 'Admin' AND a.config_entrega IS NOT NULL
+      AND (a.idempresa = e.idempresa OR a.idempresa IS NULL)
+    ORDER BY a.idempresa IS NULL, a.idusuario
+    LIMIT 1
+), NOW()
+FROM adm_empresas e
+WHERE EXISTS (
+    SELECT 1 FROM admin_usuarios a
+    WHERE a.tipo_usuario = 'Admin' AND a.config_entrega IS NOT NULL
+      AND (a.idempresa = e.idempresa OR a.idempresa IS NULL)
+) AND NOT EXISTS (
+    SELECT 1 FROM config_entrega c WHERE c.idempresa = e.idempresa AND c.idsucursal = 0
+);
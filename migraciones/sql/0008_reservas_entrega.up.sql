@@ -0,0 +1,20 @@
+-- Ocupación de los horarios de entrega. Cada renglón es un lugar en un horario
+-- (sucursal, día y hora de inicio del horario): mientras el cliente hace el
+-- checkout queda apartado hasta `expira`; al crear el pedido se confirma con su
+-- id_pedido y expira queda en NULL. Los apartados vencidos ya no cuentan.
+
+CREATE TABLE IF NOT EXISTS reservas_entrega (
+    id_reserva  BIGINT        NOT NULL AUTO_INCREMENT,
+    id_empresa  INT           NOT NULL,
+    id_sucursal INT           NOT NULL,
+    fecha       DATE          NOT NULL,
+    horario     CHAR(5)       NOT NULL,
+    id_usuario  INT           NOT NULL,
+    peso        DECIMAL(14,4) NOT NULL DEFAULT 0,
+    id_pedido   BIGINT        NULL,
+    expira      DATETIME      NULL,
+    creada      DATETIME      NOT NULL,
+    PRIMARY KEY (id_reserva),
+    UNIQUE KEY uq_reservas_entrega_pedido (id_pedido),
+    KEY idx_reservas_entrega_horario (id_empresa, id_sucursal, fecha, horario)
+);
@@ -0,0 +1,18 @@
+-- Calendario de feriados propio de cada empresa. id_sucursal = 0 es para toda
+-- la empresa; otro valor es un cierre de esa sucursal. Un feriado recurrente se
+-- repite cada año en el mismo día y mes (el año de `fecha` no cuenta). Los
+-- oficiales de la Ley Federal del Trabajo no se guardan: se calculan.
+-- La lista dias_feriados de config_entrega se sigue respetando.
+
+CREATE TABLE IF NOT EXISTS dias_feriados (
+    id_feriado       BIGINT       NOT NULL AUTO_INCREMENT,
+    id_empresa       INT          NOT NULL,
+    id_sucursal      INT          NOT NULL DEFAULT 0,
+    fecha            DATE         NOT NULL,
+    nombre           VARCHAR(100) NOT NULL DEFAULT '',
+    recurrente       BOOLEAN      NOT NULL DEFAULT FALSE,
+    dias_adicionales INT          NOT NULL DEFAULT 0,
+    origen           VARCHAR(10)  NOT NULL DEFAULT 'manual',
+    PRIMARY KEY (id_feriado),
+    UNIQUE KEY uq_dias_feriados_fecha (id_empresa, id_sucursal, fecha)
+);
@@ -0,0 +1,5 @@
+-- Cómo se calculó la fecha de entrega de cada pedido ("pedido después de las
+-- 14:00 + 2 días hábiles + feriado 16/11"), para que soporte pueda contestar
+-- por qué cae ese día. Los pedidos anteriores quedan en NULL.
+
+ALTER TABLE pedidos ADD COLUMN explicacion_entrega VARCHAR(500) NULL;
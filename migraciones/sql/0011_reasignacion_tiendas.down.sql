@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS tiendas_movimientos;
+DROP TABLE IF EXISTS reasignaciones_tiendas;
+DROP TABLE IF EXISTS reasignaciones;
@@ -0,0 +1,45 @@
+-- Reasignación de tiendas a la sucursal que les toca con las geocercas
+-- vigentes. Cada evaluación que encuentra cambios queda como un reporte
+-- (reasignaciones) con una fila por tienda (reasignaciones_tiendas); nada se
+-- mueve hasta que un administrador lo aprueba. Sólo hay un reporte pendiente
+-- por empresa: uno nuevo deja al anterior como 'reemplazada'.
+-- tiendas_movimientos es el historial de cambios de sucursal de cada tienda.
+
+CREATE TABLE IF NOT EXISTS reasignaciones (
+    id_reasignacion BIGINT      NOT NULL AUTO_INCREMENT,
+    id_empresa      INT         NOT NULL,
+    estatus         VARCHAR(20) NOT NULL DEFAULT 'pendiente',
+    origen          VARCHAR(20) NOT NULL,
+    creada          DATETIME    NOT NULL,
+    resuelta        DATETIME    NULL,
+    id_admin        INT         NULL,
+    PRIMARY KEY (id_reasignacion),
+    KEY idx_reasignaciones_empresa (id_empresa, estatus)
+);
+
+CREATE TABLE IF NOT EXISTS reasignaciones_tiendas (
+    id_reasignacion     BIGINT       NOT NULL,
+    id_tienda           INT          NOT NULL,
+    idsucursal_anterior INT          NOT NULL DEFAULT 0,
+    sucursal_anterior   VARCHAR(150) NOT NULL DEFAULT '',
+    idsucursal_nueva    INT          NOT NULL,
+    sucursal_nueva      VARCHAR(150) NOT NULL DEFAULT '',
+    en_cobertura        BOOLEAN      NOT NULL DEFAULT FALSE,
+    aplicada            BOOLEAN      NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (id_reasignacion, id_tienda)
+);
+
+CREATE TABLE IF NOT EXISTS tiendas_movimientos (
+    id_movimiento       BIGINT       NOT NULL AUTO_INCREMENT,
+    id_empresa          INT          NOT NULL,
+    id_tienda           INT          NOT NULL,
+    idsucursal_anterior INT          NOT NULL DEFAULT 0,
+    sucursal_anterior   VARCHAR(150) NOT NULL DEFAULT '',
+    idsucursal_nueva    INT          NOT NULL,
+    sucursal_nueva      VARCHAR(150) NOT NULL DEFAULT '',
+    id_reasignacion     BIGINT       NULL,
+    id_admin            INT          NULL,
+    fecha               DATETIME     NOT NULL,
+    PRIMARY KEY (id_movimiento),
+    KEY idx_tiendas_movimientos_tienda (id_tienda, fecha)
+);
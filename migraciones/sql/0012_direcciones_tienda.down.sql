@@ -0,0 +1,2 @@
+ALTER TABLE pedidos DROP COLUMN id_direccion;
+DROP TABLE IF EXISTS direcciones_tienda;
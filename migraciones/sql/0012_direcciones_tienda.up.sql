@@ -0,0 +1,39 @@
+-- Libreta de direcciones de entrega de cada tienda. Cada tienda tiene a lo más
+-- una predeterminada; las borradas quedan con estatus 'eliminada' porque los
+-- pedidos guardan su id_direccion. La ubicación que ya tenía cada tienda pasa
+-- a ser su dirección predeterminada (si aún no tiene direcciones, para poder
+-- reintentar la migración).
+
+CREATE TABLE IF NOT EXISTS direcciones_tienda (
+    id_direccion   BIGINT       NOT NULL AUTO_INCREMENT,
+    id_empresa     INT          NOT NULL,
+    id_tienda      INT          NOT NULL,
+    alias          VARCHAR(50)  NOT NULL,
+    direccion      VARCHAR(255) NOT NULL,
+    colonia        VARCHAR(100) NOT NULL DEFAULT '',
+    codigo_postal  VARCHAR(10)  NOT NULL DEFAULT '',
+    ciudad         VARCHAR(100) NOT NULL DEFAULT '',
+    estado         VARCHAR(100) NOT NULL DEFAULT '',
+    referencias    VARCHAR(255) NOT NULL DEFAULT '',
+    latitud        DOUBLE       NOT NULL,
+    longitud       DOUBLE       NOT NULL,
+    predeterminada BOOLEAN      NOT NULL DEFAULT FALSE,
+    estatus        VARCHAR(20)  NOT NULL DEFAULT 'activa',
+    creada         DATETIME     NOT NULL,
+    actualizada    DATETIME     NOT NULL,
+    PRIMARY KEY (id_direccion),
+    KEY idx_direcciones_tienda_tienda (id_tienda, estatus)
+);
+
+INSERT INTO direcciones_tienda (
+    id_empresa, id_tienda, alias, direccion, colonia, codigo_postal, ciudad, estado,
+    latitud, longitud, predeterminada, creada, actualizada
+)
+SELECT id_empresa, id_tienda, 'Principal', IFNULL(direccion, ''), IFNULL(colonia, ''), IFNULL(codigo_postal, ''),
+       IFNULL(ciudad, ''), IFNULL(estado, ''),
+       IFNULL(latitud, ST_Y(ubicacion)), IFNULL(longitud, ST_X(ubicacion)), TRUE, fecha_registro, fecha_registro
+FROM tiendas
+WHERE estatus = 'activo' AND (latitud IS NOT NULL AND longitud IS NOT NULL OR ubicacion IS NOT NULL)
+  AND NOT EXISTS (SELECT 1 FROM direcciones_tienda d WHERE d.id_tienda = tiendas.id_tienda);
+
+ALTER TABLE pedidos ADD COLUMN id_direccion BIGINT NULL;
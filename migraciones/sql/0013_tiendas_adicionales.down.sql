@@ -0,0 +1,3 @@
+ALTER TABLE usuarios DROP COLUMN id_tienda_activa;
+ALTER TABLE tiendas DROP COLUMN clave_remota;
+ALTER TABLE tiendas DROP COLUMN id_remoto;
@@ -0,0 +1,13 @@
+-- Un cliente puede tener varias tiendas. Cada una es su propio cliente en el
+-- ERP (id_remoto, clave_remota de crm_clientes); las que ya existían quedan
+-- con el cliente de su usuario. usuarios.id_tienda_activa es la tienda con la
+-- que trabaja el cliente (NULL = la primera).
+
+ALTER TABLE tiendas ADD COLUMN id_remoto BIGINT NULL;
+ALTER TABLE tiendas ADD COLUMN clave_remota VARCHAR(50) NULL;
+ALTER TABLE usuarios ADD COLUMN id_tienda_activa INT NULL;
+
+UPDATE tiendas t
+JOIN usuarios u ON u.id_usuario = t.id_usuario
+SET t.id_remoto = u.id_remoto, t.clave_remota = u.clave_remota
+WHERE t.id_remoto IS NULL;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS reclamos_cliente;
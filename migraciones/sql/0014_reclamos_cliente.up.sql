@@ -0,0 +1,22 @@
+-- Reclamos de clientes del ERP. Quien se registra con el RFC o el nombre
+-- comercial de un cliente que ya existe en crm_clientes recibe un código en el
+-- teléfono de ese cliente; al confirmarlo, su usuario y su tienda quedan
+-- ligados al id_cliente (id_remoto) en vez de crear otro. registro guarda la
+-- petición de alta, con la clave ya encriptada, hasta entonces.
+
+CREATE TABLE IF NOT EXISTS reclamos_cliente (
+    id_reclamo   BIGINT       NOT NULL AUTO_INCREMENT,
+    id_empresa   INT          NOT NULL,
+    id_remoto    BIGINT       NOT NULL,
+    clave_remota VARCHAR(50)  NOT NULL DEFAULT '',
+    telefono     VARCHAR(20)  NOT NULL,
+    codigo_hash  VARCHAR(100) NOT NULL,
+    registro     TEXT         NOT NULL,
+    intentos     INT          NOT NULL DEFAULT 0,
+    estatus      VARCHAR(20)  NOT NULL DEFAULT 'pendiente',
+    id_usuario   INT          NULL,
+    creado       DATETIME     NOT NULL,
+    vence        DATETIME     NOT NULL,
+    PRIMARY KEY (id_reclamo),
+    KEY idx_reclamos_cliente_remoto (id_empresa, id_remoto, estatus)
+);
@@ -0,0 +1,8 @@
+DELETE FROM ind_mensual;
+ALTER TABLE ind_mensual DROP INDEX uq_ind_mensual_empresa_fecha;
+ALTER TABLE ind_mensual ADD UNIQUE KEY uq_ind_mensual_fecha (fecha);
+ALTER TABLE ind_mensual DROP COLUMN id_empresa;
+DELETE FROM ind_diario;
+ALTER TABLE ind_diario DROP INDEX uq_ind_diario_empresa_fecha;
+ALTER TABLE ind_diario ADD UNIQUE KEY uq_ind_diario_fecha (fecha);
+ALTER TABLE ind_diario DROP COLUMN id_empresa;
@@ -0,0 +1,13 @@
+-- Los acumulados de pedidos son por empresa. Los que había sumaban todo el
+-- grupo: se borran y InicializaIndicadoresHistoricos los vuelve a calcular
+-- por empresa al arrancar.
+
+DELETE FROM ind_diario;
+ALTER TABLE ind_diario ADD COLUMN id_empresa INT NOT NULL DEFAULT 0;
+ALTER TABLE ind_diario DROP INDEX uq_ind_diario_fecha;
+ALTER TABLE ind_diario ADD UNIQUE KEY uq_ind_diario_empresa_fecha (id_empresa, fecha);
+
+DELETE FROM ind_mensual;
+ALTER TABLE ind_mensual ADD COLUMN id_empresa INT NOT NULL DEFAULT 0;
+ALTER TABLE ind_mensual DROP INDEX uq_ind_mensual_fecha;
+ALTER TABLE ind_mensual ADD UNIQUE KEY uq_ind_mensual_empresa_fecha (id_empresa, fecha);
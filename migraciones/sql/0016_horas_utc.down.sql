@@ -0,0 +1,28 @@
+-- El código anterior lee estas columnas en hora local: se regresan a
+-- America/Merida, también las que ya se guardaron en UTC.
+
+START TRANSACTION;
+
+SET @revertir = (SELECT COUNT(*) > 0 FROM conversion_utc);
+
+UPDATE refresh_tokens SET
+    expiracion = CONVERT_TZ(expiracion, '+00:00', 'America/Merida'),
+    ultimo_uso = CONVERT_TZ(ultimo_uso, '+00:00', 'America/Merida')
+WHERE @revertir;
+
+UPDATE reservas_entrega SET
+    creada = CONVERT_TZ(creada, '+00:00', 'America/Merida'),
+    expira = CONVERT_TZ(expira, '+00:00', 'America/Merida')
+WHERE @revertir;
+
+UPDATE detalle_pedidos SET fecha_registro = CONVERT_TZ(fecha_registro, '+00:00', 'America/Merida')
+WHERE @revertir;
+
+UPDATE pedidos SET fecha_creacion = CONVERT_TZ(fecha_creacion, '+00:00', 'America/Merida')
+WHERE @revertir;
+
+DELETE FROM conversion_utc;
+
+COMMIT;
+
+DROP TABLE IF EXISTS conversion_utc;
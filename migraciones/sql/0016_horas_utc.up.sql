@@ -0,0 +1,43 @@
+-- Los instantes se guardan en UTC (reloj.ParaBD). Los renglones de antes iban
+-- en la hora local: pedidos, sus detalles y los apartados de entrega en la del
+-- servidor, que corría en America/Merida, y los refresh tokens en
+-- America/Merida. Se pasan a UTC. fecha_entrega es el horario prometido y se
+-- queda en hora local; fecha_registro de usuarios y tiendas ya iba en UTC (el
+-- driver convierte los time.Time).
+--
+-- Requiere las zonas horarias cargadas en MySQL (mysql_tzinfo_to_sql): sin
+-- ellas CONVERT_TZ regresa NULL y las columnas NOT NULL hacen fallar la
+-- migración sin cambiar nada. Se usa la zona y no '-06:00' porque hasta 2022
+-- Mérida tenía horario de verano. conversion_utc marca que ya se convirtió,
+-- en la misma transacción, para no convertir dos veces si se reintenta; las
+-- sentencias van en la misma conexión, así que @convertir dura toda la
+-- migración.
+
+CREATE TABLE IF NOT EXISTS conversion_utc (
+    convertida DATETIME NOT NULL
+);
+
+START TRANSACTION;
+
+SET @convertir = (SELECT COUNT(*) = 0 FROM conversion_utc);
+
+UPDATE pedidos SET fecha_creacion = CONVERT_TZ(fecha_creacion, 'America/Merida', '+00:00')
+WHERE @convertir;
+
+UPDATE detalle_pedidos SET fecha_registro = CONVERT_TZ(fecha_registro, 'America/Merida', '+00:00')
+WHERE @convertir;
+
+UPDATE reservas_entrega SET
+    creada = CONVERT_TZ(creada, 'America/Merida', '+00:00'),
+    expira = CONVERT_TZ(expira, 'America/Merida', '+00:00')
+WHERE @convertir;
+
+UPDATE refresh_tokens SET
+    expiracion = CONVERT_TZ(expiracion, 'America/Merida', '+00:00'),
+    ultimo_uso = CONVERT_TZ(ultimo_uso, 'America/Merida', '+00:00')
+WHERE @convertir;
+
+INSERT INTO conversion_utc (convertida)
+SELECT UTC_TIMESTAMP() FROM DUAL WHERE @convertir;
+
+COMMIT;
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/db"
+	"github.com/WolfSlayer04/logica_tiendaenlina/migraciones"
+)
+
+const usoMigrate = `uso: logica_tiendaenlina migrate <comando>
+
+  up            aplica las migraciones pendientes en la base local
+  down [N]      revierte las últimas N migraciones (por defecto 1)
+  status        lista las migraciones y si están aplicadas
+  check-remote  verifica (sólo lectura) las tablas del ERP que usa el servicio`
+
+// ejecutarMigrate atiende el subcomando "migrate" y regresa el código de salida.
+func ejecutarMigrate(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usoMigrate)
+		return 2
+	}
+	ctx := context.Background()
+
+	dbConn, err := db.GetDBConnection()
+	if err != nil {
+		slog.Error("Error al conectar a las bases de datos", "error", err)
+		return 1
+	}
+	defer dbConn.Close()
+
+	switch args[0] {
+	case "up":
+		aplicadas, err := migraciones.Aplicar(ctx, dbConn.Local)
+		for _, m := range aplicadas {
+			fmt.Printf("aplicada  %04d_%s\n", m.Version, m.Nombre)
+		}
+		if err != nil {
+			slog.Error("Error aplicando migraciones", "error", err)
+			return 1
+		}
+		if len(aplicadas) == 0 {
+			fmt.Println("sin migraciones pendientes")
+		}
+	case "down":
+		pasos := 1
+		if len(args) > 1 {
+			if pasos, err = strconv.Atoi(args[1]); err != nil || pasos <= 0 {
+				fmt.Fprintln(os.Stderr, "N debe ser un entero mayor a cero")
+				return 2
+			}
+		}
+		revertidas, err := migraciones.Revertir(ctx, dbConn.Local, pasos)
+		for _, m := range revertidas {
+			fmt.Printf("revertida %04d_%s\n", m.Version, m.Nombre)
+		}
+		if err != nil {
+			slog.Error("Error revirtiendo migraciones", "error", err)
+			return 1
+		}
+	case "status":
+		estados, err := migraciones.Estados(ctx, dbConn.Local)
+		if err != nil {
+			slog.Error("Error leyendo estado de migraciones", "error", err)
+			return 1
+		}
+		for _, e := range estados {
+			marca := "pendiente"
+			if e.Aplicada {
+				marca = "aplicada " + e.AplicadaEn
+			}
+			fmt.Printf("%04d_%-30s %s\n", e.Version, e.Nombre, marca)
+		}
+	case "check-remote":
+		diferencias, err := migraciones.VerificarRemoto(ctx, dbConn.Remote)
+		if err != nil {
+			slog.Error("Error verificando esquema remoto", "error", err)
+			return 1
+		}
+		if len(diferencias) == 0 {
+			fmt.Println("esquema remoto OK")
+			return 0
+		}
+		for _, d := range diferencias {
+			fmt.Println(d)
+		}
+		return 1
+	default:
+		fmt.Fprintln(os.Stderr, usoMigrate)
+		return 2
+	}
+	return 0
+}
+
+// prepararEsquemas aplica las migraciones locales si MIGRATE_ON_START=true y
+// avisa en el log si al esquema remoto le falta algo que el servicio usa.
+func prepararEsquemas(ctx context.Context, dbConn *db.DBConnection) error {
+	if migrarAlIniciar() {
+		aplicadas, err := migraciones.Aplicar(ctx, dbConn.Local)
+		for _, m := range aplicadas {
+			slog.Info("Migración aplicada", "version", m.Version, "nombre", m.Nombre)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	diferencias, err := migraciones.VerificarRemoto(ctx, dbConn.Remote)
+	if err != nil {
+		slog.Warn("No se pudo verificar el esquema remoto", "error", err)
+		return nil
+	}
+	for _, d := range diferencias {
+		slog.Warn("Esquema remoto distinto al esperado", "tabla", d.Tabla, "detalle", d.Detalle)
+	}
+	return nil
+}
+
+func migrarAlIniciar() bool {
+	switch strings.ToLower(os.Getenv("MIGRATE_ON_START")) {
+	case "1", "true", "si", "sí", "yes":
+		return true
+	}
+	return false
+}
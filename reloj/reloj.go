@@ -0,0 +1,163 @@
+// Package reloj es la hora del negocio. Todo lo que depende de "ahora" o de
+// "hoy" (el día de un pedido en ind_diario, los horarios de entrega, la
+// vigencia de tokens y apartados) la toma del Reloj del contexto en lugar de
+// time.Now, para que no dependa de la zona horaria del servidor y para que las
+// pruebas puedan fijar la hora con Fijo.
+//
+// Los instantes (fecha_creacion, expiraciones, último uso) se guardan en UTC
+// con ParaBD y se leen con LeerBD (los que había en hora local los pasa a UTC
+// la migración 0016_horas_utc); los días y los meses se cuentan en la zona
+// del negocio. fecha_entrega no es un instante sino el horario prometido al
+// cliente y se guarda en la hora local del negocio.
+package reloj
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	// Las zonas no dependen de que el servidor tenga /usr/share/zoneinfo
+	_ "time/tzdata"
+)
+
+// ZonaPredeterminada es la zona del negocio si ZONA_HORARIA no dice otra.
+const ZonaPredeterminada = "America/Merida"
+
+// FormatoBD es el formato de DATETIME en MySQL.
+const FormatoBD = "2006-01-02 15:04:05"
+
+// Reloj da el instante actual.
+type Reloj interface {
+	// Ahora regresa el instante actual en la zona del negocio.
+	Ahora() time.Time
+}
+
+type sistema struct{ zona *time.Location }
+
+// Sistema es el reloj del servidor en la zona indicada.
+func Sistema(zona *time.Location) Reloj {
+	return sistema{zona: zona}
+}
+
+func (s sistema) Ahora() time.Time {
+	return time.Now().In(s.zona)
+}
+
+// Fijo es un reloj que sólo se mueve cuando se le pide; es para pruebas.
+type Fijo struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+// NuevoFijo regresa un reloj detenido en t; la zona del negocio es la de t.
+func NuevoFijo(t time.Time) *Fijo {
+	return &Fijo{t: t}
+}
+
+func (f *Fijo) Ahora() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.t
+}
+
+// Avanzar mueve el reloj d hacia adelante (o hacia atrás si es negativa).
+func (f *Fijo) Avanzar(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.t = f.t.Add(d)
+}
+
+// Fijar pone el reloj en t.
+func (f *Fijo) Fijar(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.t = t
+}
+
+// CargarZona regresa la zona con ese nombre de la base IANA; "" es
+// ZonaPredeterminada.
+func CargarZona(nombre string) (*time.Location, error) {
+	if nombre == "" {
+		nombre = ZonaPredeterminada
+	}
+	return time.LoadLocation(nombre)
+}
+
+// DesdeEnv es el reloj del sistema en la zona de ZONA_HORARIA.
+func DesdeEnv() (Reloj, error) {
+	zona, err := CargarZona(os.Getenv("ZONA_HORARIA"))
+	if err != nil {
+		return nil, err
+	}
+	return Sistema(zona), nil
+}
+
+var predeterminado = func() Reloj {
+	zona, err := CargarZona("")
+	if err != nil {
+		panic(err) // tzdata va dentro del binario
+	}
+	return Sistema(zona)
+}()
+
+type ctxKey struct{}
+
+// Con guarda el reloj en el contexto.
+func Con(ctx context.Context, r Reloj) context.Context {
+	return context.WithValue(ctx, ctxKey{}, r)
+}
+
+// Desde regresa el reloj del contexto o, si no hay, el del sistema en
+// ZonaPredeterminada.
+func Desde(ctx context.Context) Reloj {
+	if ctx != nil {
+		if r, ok := ctx.Value(ctxKey{}).(Reloj); ok && r != nil {
+			return r
+		}
+	}
+	return predeterminado
+}
+
+// Middleware deja el reloj en el contexto de cada petición.
+func Middleware(r Reloj) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			next.ServeHTTP(w, req.WithContext(Con(req.Context(), r)))
+		})
+	}
+}
+
+// Dia es el día de t en su zona, en formato "YYYY-MM-DD".
+func Dia(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// InicioDelDia es la medianoche con que empieza el día de t en su zona.
+// Los días con cambio de horario duran 23 o 25 horas, así que el siguiente
+// se calcula con InicioDelDia(t).AddDate(0, 0, 1) y no sumando 24 horas.
+func InicioDelDia(t time.Time) time.Time {
+	anio, mes, dia := t.Date()
+	return time.Date(anio, mes, dia, 0, 0, 0, 0, t.Location())
+}
+
+// InicioDelMes es la medianoche del primer día del mes de t en su zona.
+func InicioDelMes(t time.Time) time.Time {
+	anio, mes, _ := t.Date()
+	return time.Date(anio, mes, 1, 0, 0, 0, 0, t.Location())
+}
+
+// ParaBD es el instante t en UTC con FormatoBD, como se guarda en la base.
+func ParaBD(t time.Time) string {
+	return t.UTC().Format(FormatoBD)
+}
+
+// LeerBD interpreta un DATETIME guardado con ParaBD y lo regresa en zona.
+func LeerBD(s string, zona *time.Location) (time.Time, error) {
+	t, err := time.ParseInLocation(FormatoBD, s, time.UTC)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.In(zona), nil
+}
@@ -0,0 +1,101 @@
+package reloj
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func zona(t *testing.T, nombre string) *time.Location {
+	t.Helper()
+	z, err := time.LoadLocation(nombre)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return z
+}
+
+func TestMedianoche(t *testing.T) {
+	merida := zona(t, "America/Merida")
+	// 23:30 en Mérida ya es el día siguiente en UTC
+	r := NuevoFijo(time.Date(2026, time.March, 31, 23, 30, 0, 0, merida))
+
+	ahora := r.Ahora()
+	if Dia(ahora) != "2026-03-31" {
+		t.Errorf("Dia = %s", Dia(ahora))
+	}
+	if InicioDelMes(ahora) != time.Date(2026, time.March, 1, 0, 0, 0, 0, merida) {
+		t.Errorf("InicioDelMes = %s", InicioDelMes(ahora))
+	}
+	guardado := ParaBD(ahora)
+	if guardado != "2026-04-01 05:30:00" {
+		t.Errorf("ParaBD = %s", guardado)
+	}
+	leido, err := LeerBD(guardado, merida)
+	if err != nil || !leido.Equal(ahora) || Dia(leido) != "2026-03-31" {
+		t.Errorf("LeerBD = %s, %v", leido, err)
+	}
+
+	r.Avanzar(30 * time.Minute)
+	if Dia(r.Ahora()) != "2026-04-01" || InicioDelDia(r.Ahora()) != r.Ahora() {
+		t.Errorf("a medianoche Dia = %s", Dia(r.Ahora()))
+	}
+	if _, err := LeerBD("2026-04-01", merida); err == nil {
+		t.Error("LeerBD aceptó una fecha sin hora")
+	}
+}
+
+func TestCambioDeHorario(t *testing.T) {
+	// Tijuana sigue el horario de verano de Estados Unidos: el 8 de marzo de
+	// 2026 a las 2:00 se pasa a las 3:00 y el 1 de noviembre a la 1:00 se
+	// vuelve a la 1:00.
+	tijuana := zona(t, "America/Tijuana")
+	casos := []struct {
+		nombre string
+		ahora  time.Time
+		horas  float64
+		utc    string
+	}{
+		{"primavera", time.Date(2026, time.March, 8, 12, 0, 0, 0, tijuana), 23, "2026-03-08 08:00:00"},
+		{"otoño", time.Date(2026, time.November, 1, 12, 0, 0, 0, tijuana), 25, "2026-11-01 07:00:00"},
+		{"normal", time.Date(2026, time.June, 15, 12, 0, 0, 0, tijuana), 24, "2026-06-15 07:00:00"},
+	}
+	for _, c := range casos {
+		inicio := InicioDelDia(c.ahora)
+		fin := inicio.AddDate(0, 0, 1)
+		if h := fin.Sub(inicio).Hours(); h != c.horas {
+			t.Errorf("%s: el día dura %v horas, se esperaban %v", c.nombre, h, c.horas)
+		}
+		if ParaBD(inicio) != c.utc {
+			t.Errorf("%s: inicio del día en UTC = %s, se esperaba %s", c.nombre, ParaBD(inicio), c.utc)
+		}
+	}
+
+	// 1:30 del 1 de noviembre ocurre dos veces; la segunda sigue siendo ese día
+	r := NuevoFijo(time.Date(2026, time.November, 1, 8, 30, 0, 0, time.UTC).In(tijuana))
+	r.Avanzar(time.Hour)
+	if got := r.Ahora().Format("2006-01-02 15:04 MST"); got != "2026-11-01 01:30 PST" {
+		t.Errorf("tras el cambio = %s", got)
+	}
+}
+
+func TestContexto(t *testing.T) {
+	if z := Desde(context.Background()).Ahora().Location().String(); z != ZonaPredeterminada {
+		t.Errorf("zona predeterminada = %s", z)
+	}
+	fijo := NuevoFijo(time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC))
+	var visto time.Time
+	h := Middleware(fijo)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		visto = Desde(r.Context()).Ahora()
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if !visto.Equal(fijo.Ahora()) {
+		t.Errorf("reloj en la petición = %s", visto)
+	}
+
+	if _, err := CargarZona("Marte/Olympus"); err == nil {
+		t.Error("CargarZona aceptó una zona inexistente")
+	}
+}
@@ -0,0 +1,1385 @@
+package repositorio
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/feriados"
+	"github.com/WolfSlayer04/logica_tiendaenlina/geocerca"
+)
+
+// Memoria implementa todos los repositorios sobre mapas en memoria. Sirve para
+// probar handlers sin base de datos: los campos exportados se llenan antes de
+// la prueba y se revisan después. Usar siempre con puntero.
+type Memoria struct {
+	mu sync.Mutex
+
+	Empresas   []EmpresaMemoria
+	Sucursales []SucursalMemoria
+	// ConfigEntregaJSON es lo que regresa ConfigEntrega por empresa y
+	// sucursal; IDSucursal 0 es la de la empresa (sin entrada = sin configurar).
+	ConfigEntregaJSON map[ClaveConfigEntrega][]byte
+	// Feriados son los de dias_feriados de todas las empresas.
+	Feriados []FeriadoMemoria
+	// Productos guarda la empresa, los impuestos y el peso por idproducto.
+	Productos map[int64]ProductoMemoria
+	// Reservas son los lugares ocupados o apartados en los horarios de entrega.
+	Reservas map[int64]*Reserva
+
+	Pedidos       map[int64]*PedidoMemoria
+	Usuarios      map[int64]*UsuarioMemoria
+	RefreshTokens []RefreshToken
+	// ClientesRemotos son los de crm_clientes; el id_cliente de cada uno es
+	// su posición más uno.
+	ClientesRemotos []ClienteRemoto
+	// Reclamos son los de todas las empresas, también los ya resueltos.
+	Reclamos []*Reclamo
+	// IndicadoresDiarios acumula el total vendido por día ("YYYY-MM-DD").
+	IndicadoresDiarios map[string]float64
+	// Reasignaciones son los reportes de todas las empresas, con sus tiendas;
+	// Movimientos, los cambios de sucursal que hizo Aplicar.
+	Reasignaciones []*Reasignacion
+	Movimientos    []MovimientoSucursal
+	// Direcciones son las de la libreta de todas las tiendas, también las
+	// eliminadas (Eliminada en true).
+	Direcciones []*DireccionMemoria
+
+	// Falla, si se define, se consulta al inicio de cada operación con su
+	// nombre ("Pedidos.Crear", "Sync.CrearClienteRemoto", ...) para simular errores.
+	Falla func(operacion string) error
+
+	sigPedido     int64
+	sigUsuario    int64
+	sigReserva    int64
+	sigMovimiento int64
+	sigDireccion  int64
+	sigReclamo    int64
+	sigTienda     int
+}
+
+// EmpresaMemoria es una empresa del grupo con los hosts de su tienda en línea.
+type EmpresaMemoria struct {
+	IDEmpresa int
+	Activa    bool
+	Dominios  []string
+}
+
+// ClaveConfigEntrega identifica una configuración de entregas guardada.
+type ClaveConfigEntrega struct {
+	IDEmpresa  int
+	IDSucursal int
+}
+
+// FeriadoMemoria es un feriado guardado por una empresa.
+type FeriadoMemoria struct {
+	IDEmpresa int
+	feriados.Feriado
+}
+
+// ProductoMemoria es un producto del catálogo de una empresa; Peso 0 es sin
+// peso capturado e IDCategoria 0 sin categoría.
+type ProductoMemoria struct {
+	IDEmpresa   int
+	Impuestos   Impuestos
+	Peso        float64
+	IDCategoria int
+}
+
+// SucursalMemoria es una sucursal con su punto de referencia y radio en km.
+// Geocerca, si se define, es la cobertura que regresan Coberturas y Cobertura;
+// si no, es el círculo de Latitud, Longitud y RadioKm.
+type SucursalMemoria struct {
+	IDSucursal int
+	IDEmpresa  int
+	Nombre     string
+	Activa     bool
+	Latitud    float64
+	Longitud   float64
+	RadioKm    float64
+	Geocerca   *geocerca.Geocerca
+}
+
+func (s SucursalMemoria) cobertura() geocerca.Cobertura {
+	c := geocerca.Cobertura{IDSucursal: s.IDSucursal, Nombre: s.Nombre}
+	if s.Geocerca != nil {
+		c.Geocerca = *s.Geocerca
+	} else {
+		c.Geocerca = geocerca.Geocerca{Tipo: geocerca.Circulo, Puntos: []geocerca.Punto{{Lat: s.Latitud, Lng: s.Longitud}}, RadioKm: s.RadioKm}
+	}
+	return c
+}
+
+// PedidoMemoria es un pedido guardado con su estado de sincronización.
+type PedidoMemoria struct {
+	IDPedido     int64
+	Pedido       NuevoPedido
+	Sincronizado bool
+}
+
+// UsuarioMemoria es un usuario guardado con su clave y su tienda. Otras son
+// las tiendas que se le agregaron después del registro y TiendaActiva la que
+// marcó con Activar (0 = la primera).
+type UsuarioMemoria struct {
+	Usuario      Usuario
+	Clave        string
+	Tienda       *Tienda
+	Alta         NuevaTienda
+	Otras        []*TiendaMemoria
+	TiendaActiva int
+}
+
+// TiendaMemoria es una tienda agregada a un usuario ya registrado.
+type TiendaMemoria struct {
+	Tienda Tienda
+	Alta   NuevaTienda
+}
+
+// refTienda apunta a una tienda de un usuario, la del registro o una de las
+// otras, para leerla o cambiarla.
+type refTienda struct {
+	usuario *UsuarioMemoria
+	tienda  *Tienda
+	alta    *NuevaTienda
+}
+
+// leer regresa la tienda con su sucursal y su cliente remoto (el del usuario
+// si no tiene uno propio).
+func (t refTienda) leer() Tienda {
+	ti := *t.tienda
+	ti.IDSucursal = t.alta.IDSucursal
+	ti.NombreSucursal = t.alta.NombreSucursal
+	ti.IDRemoto, ti.ClaveRemota = t.alta.IDRemoto, t.alta.ClaveRemota
+	if ti.IDRemoto == 0 {
+		ti.IDRemoto, ti.ClaveRemota = t.usuario.Usuario.IDRemoto, t.usuario.Usuario.ClaveRemota
+	}
+	return ti
+}
+
+// tiendas regresa las tiendas del usuario, la activa primero y luego la más
+// vieja; hay que tener el candado.
+func (u *UsuarioMemoria) tiendas() []refTienda {
+	var ts []refTienda
+	if u.Tienda != nil {
+		ts = append(ts, refTienda{u, u.Tienda, &u.Alta})
+	}
+	for _, o := range u.Otras {
+		ts = append(ts, refTienda{u, &o.Tienda, &o.Alta})
+	}
+	sort.SliceStable(ts, func(i, j int) bool {
+		if activa := u.TiendaActiva; (ts[i].tienda.IDTienda == activa) != (ts[j].tienda.IDTienda == activa) {
+			return ts[i].tienda.IDTienda == activa
+		}
+		return ts[i].tienda.IDTienda < ts[j].tienda.IDTienda
+	})
+	return ts
+}
+
+// tiendas regresa las tiendas de todos los usuarios; hay que tener el
+// candado.
+func (m *Memoria) tiendas() []refTienda {
+	var ts []refTienda
+	for _, u := range m.Usuarios {
+		ts = append(ts, u.tiendas()...)
+	}
+	return ts
+}
+
+// tienda regresa la tienda de la empresa; hay que tener el candado.
+func (m *Memoria) tienda(idEmpresa, idTienda int) (refTienda, error) {
+	for _, t := range m.tiendas() {
+		if t.tienda.IDTienda == idTienda && t.alta.IDEmpresa == idEmpresa {
+			return t, nil
+		}
+	}
+	return refTienda{}, ErrNoEncontrado
+}
+
+// tiendaDe construye la tienda de memoria con los datos del alta.
+func tiendaDe(id int, nt NuevaTienda) *Tienda {
+	return &Tienda{
+		IDTienda:     id,
+		NombreTienda: nt.NombreTienda,
+		Direccion:    nt.Direccion,
+		Colonia:      nt.Colonia,
+		CodigoPostal: nt.CodigoPostal,
+		Ciudad:       nt.Ciudad,
+		Estado:       nt.Estado,
+		Pais:         nt.Pais,
+		Latitud:      nt.Latitud,
+		Longitud:     nt.Longitud,
+		LatitudUbic:  nt.Latitud,
+		LongitudUbic: nt.Longitud,
+	}
+}
+
+// direccionPrincipal agrega la ubicación de la tienda como su dirección
+// predeterminada; hay que tener el candado.
+func (m *Memoria) direccionPrincipal(idTienda int, nt NuevaTienda) {
+	m.sigDireccion++
+	m.Direcciones = append(m.Direcciones, &DireccionMemoria{Direccion: Direccion{
+		ID:             m.sigDireccion,
+		IDEmpresa:      nt.IDEmpresa,
+		IDTienda:       idTienda,
+		Alias:          "Principal",
+		Direccion:      nt.Direccion,
+		Colonia:        nt.Colonia,
+		CodigoPostal:   nt.CodigoPostal,
+		Ciudad:         nt.Ciudad,
+		Estado:         nt.Estado,
+		Latitud:        nt.Latitud,
+		Longitud:       nt.Longitud,
+		Predeterminada: true,
+		Creada:         nt.FechaRegistro,
+		Actualizada:    nt.FechaRegistro,
+	}})
+}
+
+// DireccionMemoria es una dirección de la libreta; Eliminada es la baja
+// lógica de Eliminar.
+type DireccionMemoria struct {
+	Direccion
+	Eliminada bool
+}
+
+// NuevaMemoria regresa repositorios en memoria vacíos.
+func NuevaMemoria() *Memoria {
+	return &Memoria{
+		ConfigEntregaJSON:  map[ClaveConfigEntrega][]byte{},
+		Productos:          map[int64]ProductoMemoria{},
+		Reservas:           map[int64]*Reserva{},
+		Pedidos:            map[int64]*PedidoMemoria{},
+		Usuarios:           map[int64]*UsuarioMemoria{},
+		IndicadoresDiarios: map[string]float64{},
+	}
+}
+
+// Repositorios regresa m detrás de cada una de las interfaces.
+func (m *Memoria) Repositorios() Repositorios {
+	return Repositorios{
+		Empresas:       empresasMemoria{m},
+		Pedidos:        pedidosMemoria{m},
+		Productos:      productosMemoria{m},
+		Usuarios:       usuariosMemoria{m},
+		Tiendas:        tiendasMemoria{m},
+		Sucursales:     sucursalesMemoria{m},
+		Entregas:       entregasMemoria{m},
+		Sync:           syncMemoria{m},
+		Reasignaciones: reasignacionesMemoria{m},
+		Direcciones:    direccionesMemoria{m},
+		Reclamos:       reclamosMemoria{m},
+	}
+}
+
+func (m *Memoria) falla(operacion string) error {
+	if m.Falla == nil {
+		return nil
+	}
+	return m.Falla(operacion)
+}
+
+// ---------------------------
+// PEDIDOS
+// ---------------------------
+
+type pedidosMemoria struct{ m *Memoria }
+
+func (r pedidosMemoria) Crear(_ context.Context, p *NuevoPedido) (int64, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Pedidos.Crear"); err != nil {
+		return 0, err
+	}
+	var reserva *Reserva
+	if p.IDReserva != 0 {
+		reserva = r.m.Reservas[p.IDReserva]
+		if reserva == nil || reserva.IDEmpresa != p.IDEmpresa || !reserva.vigente(p.FechaCreacion) {
+			return 0, fmt.Errorf("confirmando reserva %d: %w", p.IDReserva, ErrReservaVencida)
+		}
+	}
+	r.m.sigPedido++
+	if reserva != nil {
+		reserva.IDPedido = r.m.sigPedido
+		reserva.Peso = p.Peso
+		reserva.Expira = time.Time{}
+	}
+	copia := *p
+	copia.Detalles = append([]NuevoDetalle(nil), p.Detalles...)
+	r.m.Pedidos[r.m.sigPedido] = &PedidoMemoria{IDPedido: r.m.sigPedido, Pedido: copia}
+	r.m.IndicadoresDiarios[p.FechaCreacion.Format("2006-01-02")] += p.Total
+	return r.m.sigPedido, nil
+}
+
+func (r pedidosMemoria) Totales(_ context.Context, idEmpresa int, idPedido int64) (TotalesPedido, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Pedidos.Totales"); err != nil {
+		return TotalesPedido{}, err
+	}
+	p, ok := r.m.Pedidos[idPedido]
+	if !ok || p.Pedido.IDEmpresa != idEmpresa {
+		return TotalesPedido{}, ErrNoEncontrado
+	}
+	return TotalesPedido{
+		Subtotal:  p.Pedido.Subtotal,
+		Descuento: p.Pedido.Descuento,
+		IVA:       p.Pedido.IVA,
+		IEPS:      p.Pedido.IEPS,
+		Total:     p.Pedido.Total,
+	}, nil
+}
+
+func (r pedidosMemoria) AplicarDescuento(_ context.Context, idEmpresa int, idPedido int64, descuento, total float64) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Pedidos.AplicarDescuento"); err != nil {
+		return err
+	}
+	// Igual que el UPDATE: si no existe en la empresa no hace nada
+	if p, ok := r.m.Pedidos[idPedido]; ok && p.Pedido.IDEmpresa == idEmpresa {
+		p.Pedido.Descuento = descuento
+		p.Pedido.Total = total
+	}
+	return nil
+}
+
+// ---------------------------
+// PRODUCTOS
+// ---------------------------
+
+type productosMemoria struct{ m *Memoria }
+
+func (r productosMemoria) Impuestos(_ context.Context, idEmpresa int, idProducto int64) (Impuestos, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Productos.Impuestos"); err != nil {
+		return Impuestos{}, err
+	}
+	p, ok := r.m.Productos[idProducto]
+	if !ok || p.IDEmpresa != idEmpresa {
+		return Impuestos{}, ErrNoEncontrado
+	}
+	return p.Impuestos, nil
+}
+
+func (r productosMemoria) Pesos(_ context.Context, idEmpresa int, idsProducto []int64) (map[int64]float64, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Productos.Pesos"); err != nil {
+		return nil, err
+	}
+	pesos := map[int64]float64{}
+	for _, id := range idsProducto {
+		if p, ok := r.m.Productos[id]; ok && p.IDEmpresa == idEmpresa && p.Peso > 0 {
+			pesos[id] = p.Peso
+		}
+	}
+	return pesos, nil
+}
+
+func (r productosMemoria) Categorias(_ context.Context, idEmpresa int, idsProducto []int64) (map[int64]int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Productos.Categorias"); err != nil {
+		return nil, err
+	}
+	categorias := map[int64]int{}
+	for _, id := range idsProducto {
+		if p, ok := r.m.Productos[id]; ok && p.IDEmpresa == idEmpresa && p.IDCategoria > 0 {
+			categorias[id] = p.IDCategoria
+		}
+	}
+	return categorias, nil
+}
+
+// ---------------------------
+// USUARIOS Y TIENDAS
+// ---------------------------
+
+type usuariosMemoria struct{ m *Memoria }
+
+func (r usuariosMemoria) RegistrarConTienda(_ context.Context, nu NuevoUsuario, nt NuevaTienda) (int64, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Usuarios.RegistrarConTienda"); err != nil {
+		return 0, err
+	}
+	return r.m.registrar(nu, nt)
+}
+
+// registrar guarda el usuario con su tienda y regresa el id_usuario, o
+// ErrCorreoRegistrado como la llave única de MySQL; hay que tener el candado.
+func (m *Memoria) registrar(nu NuevoUsuario, nt NuevaTienda) (int64, error) {
+	for _, u := range m.Usuarios {
+		if u.Usuario.IDEmpresa == nu.IDEmpresa && u.Usuario.Correo == nu.Correo {
+			return 0, ErrCorreoRegistrado
+		}
+	}
+	m.sigUsuario++
+	id := m.sigUsuario
+	m.Usuarios[id] = &UsuarioMemoria{
+		Usuario: Usuario{
+			IDUsuario:      id,
+			IDEmpresa:      nu.IDEmpresa,
+			TipoUsuario:    nu.TipoUsuario,
+			NombreCompleto: nu.NombreCompleto,
+			Correo:         nu.Correo,
+			Telefono:       nu.Telefono,
+			Estatus:        "activo",
+			ClaveRemota:    nu.ClaveRemota,
+			IDRemoto:       nu.IDRemoto,
+		},
+		Clave:  nu.Clave,
+		Tienda: tiendaDe(m.sigTienda+1, nt),
+		Alta:   nt,
+	}
+	m.sigTienda++
+	m.direccionPrincipal(m.sigTienda, nt)
+	return id, nil
+}
+
+func (r usuariosMemoria) PorID(_ context.Context, idUsuario int64) (Usuario, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Usuarios.PorID"); err != nil {
+		return Usuario{}, err
+	}
+	u, ok := r.m.Usuarios[idUsuario]
+	if !ok {
+		return Usuario{}, ErrNoEncontrado
+	}
+	return u.Usuario, nil
+}
+
+func (r usuariosMemoria) GuardarRefreshToken(_ context.Context, t RefreshToken) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Usuarios.GuardarRefreshToken"); err != nil {
+		return err
+	}
+	for i, actual := range r.m.RefreshTokens {
+		if actual.IDUsuario == t.IDUsuario && actual.TipoUsuario == t.TipoUsuario {
+			r.m.RefreshTokens[i] = t
+			return nil
+		}
+	}
+	r.m.RefreshTokens = append(r.m.RefreshTokens, t)
+	return nil
+}
+
+type tiendasMemoria struct{ m *Memoria }
+
+func (r tiendasMemoria) PorUsuario(_ context.Context, idUsuario int64) (Tienda, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Tiendas.PorUsuario"); err != nil {
+		return Tienda{}, err
+	}
+	u, ok := r.m.Usuarios[idUsuario]
+	if !ok {
+		return Tienda{}, ErrNoEncontrado
+	}
+	ts := u.tiendas()
+	if len(ts) == 0 {
+		return Tienda{}, ErrNoEncontrado
+	}
+	return ts[0].leer(), nil
+}
+
+func (r tiendasMemoria) DeUsuario(_ context.Context, idUsuario int64) ([]Tienda, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Tiendas.DeUsuario"); err != nil {
+		return nil, err
+	}
+	res := []Tienda{}
+	if u, ok := r.m.Usuarios[idUsuario]; ok {
+		for _, t := range u.tiendas() {
+			res = append(res, t.leer())
+		}
+	}
+	return res, nil
+}
+
+func (r tiendasMemoria) Obtener(_ context.Context, idEmpresa, idTienda int) (Tienda, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Tiendas.Obtener"); err != nil {
+		return Tienda{}, err
+	}
+	t, err := r.m.tienda(idEmpresa, idTienda)
+	if err != nil {
+		return Tienda{}, err
+	}
+	return t.leer(), nil
+}
+
+func (r tiendasMemoria) Duenio(_ context.Context, idEmpresa, idTienda int) (int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Tiendas.Duenio"); err != nil {
+		return 0, err
+	}
+	t, err := r.m.tienda(idEmpresa, idTienda)
+	if err != nil {
+		return 0, err
+	}
+	return int(t.usuario.Usuario.IDUsuario), nil
+}
+
+func (r tiendasMemoria) Crear(_ context.Context, idUsuario int64, nt NuevaTienda) (int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Tiendas.Crear"); err != nil {
+		return 0, err
+	}
+	u, ok := r.m.Usuarios[idUsuario]
+	if !ok {
+		return 0, ErrNoEncontrado
+	}
+	r.m.sigTienda++
+	u.Otras = append(u.Otras, &TiendaMemoria{Tienda: *tiendaDe(r.m.sigTienda, nt), Alta: nt})
+	r.m.direccionPrincipal(r.m.sigTienda, nt)
+	return r.m.sigTienda, nil
+}
+
+func (r tiendasMemoria) Actualizar(_ context.Context, idTienda int, nt NuevaTienda, idAdmin int, ahora time.Time) (*MovimientoSucursal, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Tiendas.Actualizar"); err != nil {
+		return nil, err
+	}
+	t, err := r.m.tienda(nt.IDEmpresa, idTienda)
+	if err != nil {
+		return nil, err
+	}
+	anterior := *t.alta
+	*t.tienda = *tiendaDe(idTienda, nt)
+	*t.alta = nt
+	t.alta.FechaRegistro = anterior.FechaRegistro
+	t.alta.IDRemoto, t.alta.ClaveRemota = anterior.IDRemoto, anterior.ClaveRemota
+	if anterior.IDSucursal == nt.IDSucursal {
+		return nil, nil
+	}
+	r.m.sigMovimiento++
+	m := MovimientoSucursal{
+		ID:                 r.m.sigMovimiento,
+		IDTienda:           idTienda,
+		IDSucursalAnterior: anterior.IDSucursal,
+		SucursalAnterior:   anterior.NombreSucursal,
+		IDSucursalNueva:    nt.IDSucursal,
+		SucursalNueva:      nt.NombreSucursal,
+		IDAdmin:            idAdmin,
+		Fecha:              ahora,
+	}
+	r.m.Movimientos = append(r.m.Movimientos, m)
+	return &m, nil
+}
+
+func (r tiendasMemoria) Activar(_ context.Context, idUsuario int64, idTienda int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Tiendas.Activar"); err != nil {
+		return err
+	}
+	u, ok := r.m.Usuarios[idUsuario]
+	if !ok {
+		return ErrNoEncontrado
+	}
+	for _, t := range u.tiendas() {
+		if t.tienda.IDTienda == idTienda {
+			u.TiendaActiva = idTienda
+			return nil
+		}
+	}
+	return ErrNoEncontrado
+}
+
+func (r tiendasMemoria) Ubicaciones(_ context.Context, idEmpresa int) ([]UbicacionTienda, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Tiendas.Ubicaciones"); err != nil {
+		return nil, err
+	}
+	var us []UbicacionTienda
+	for _, t := range r.m.tiendas() {
+		if t.alta.IDEmpresa != idEmpresa || t.usuario.Usuario.Estatus != "activo" {
+			continue
+		}
+		us = append(us, UbicacionTienda{
+			IDTienda:       t.tienda.IDTienda,
+			NombreTienda:   t.tienda.NombreTienda,
+			IDSucursal:     t.alta.IDSucursal,
+			NombreSucursal: t.alta.NombreSucursal,
+			Punto:          geocerca.Punto{Lat: t.tienda.Latitud, Lng: t.tienda.Longitud},
+		})
+	}
+	sort.Slice(us, func(i, j int) bool { return us[i].IDTienda < us[j].IDTienda })
+	return us, nil
+}
+
+// ---------------------------
+// EMPRESAS
+// ---------------------------
+
+type empresasMemoria struct{ m *Memoria }
+
+func (r empresasMemoria) Activa(_ context.Context, idEmpresa int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Empresas.Activa"); err != nil {
+		return err
+	}
+	for _, e := range r.m.Empresas {
+		if e.IDEmpresa == idEmpresa && e.Activa {
+			return nil
+		}
+	}
+	return ErrNoEncontrado
+}
+
+func (r empresasMemoria) PorDominio(_ context.Context, dominio string) (int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Empresas.PorDominio"); err != nil {
+		return 0, err
+	}
+	for _, e := range r.m.Empresas {
+		if !e.Activa {
+			continue
+		}
+		for _, d := range e.Dominios {
+			if d == dominio {
+				return e.IDEmpresa, nil
+			}
+		}
+	}
+	return 0, ErrNoEncontrado
+}
+
+func (r empresasMemoria) Unica(context.Context) (int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Empresas.Unica"); err != nil {
+		return 0, err
+	}
+	var ids []int
+	for _, e := range r.m.Empresas {
+		if e.Activa {
+			ids = append(ids, e.IDEmpresa)
+		}
+	}
+	if len(ids) != 1 {
+		return 0, ErrNoEncontrado
+	}
+	return ids[0], nil
+}
+
+func (r empresasMemoria) Activas(context.Context) ([]int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Empresas.Activas"); err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, e := range r.m.Empresas {
+		if e.Activa {
+			ids = append(ids, e.IDEmpresa)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// ---------------------------
+// SUCURSALES
+// ---------------------------
+
+type sucursalesMemoria struct{ m *Memoria }
+
+func (r sucursalesMemoria) PrimeraActiva(_ context.Context, idEmpresa int) (int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Sucursales.PrimeraActiva"); err != nil {
+		return 0, err
+	}
+	ids := []int{}
+	for _, s := range r.m.Sucursales {
+		if s.Activa && s.IDEmpresa == idEmpresa {
+			ids = append(ids, s.IDSucursal)
+		}
+	}
+	if len(ids) == 0 {
+		return 0, ErrNoEncontrado
+	}
+	sort.Ints(ids)
+	return ids[0], nil
+}
+
+func (r sucursalesMemoria) DeEmpresa(_ context.Context, idEmpresa, idSucursal int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Sucursales.DeEmpresa"); err != nil {
+		return err
+	}
+	for _, s := range r.m.Sucursales {
+		if s.IDSucursal == idSucursal && s.IDEmpresa == idEmpresa {
+			return nil
+		}
+	}
+	return ErrNoEncontrado
+}
+
+func (r sucursalesMemoria) PorUbicacion(_ context.Context, idEmpresa int, lat, lng float64) (SucursalAsignada, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Sucursales.PorUbicacion"); err != nil {
+		return SucursalAsignada{}, err
+	}
+	var cs []geocerca.Cobertura
+	for _, s := range r.m.Sucursales {
+		if s.Activa && s.IDEmpresa == idEmpresa {
+			cs = append(cs, s.cobertura())
+		}
+	}
+	u := geocerca.Asignar(cs, geocerca.Punto{Lat: lat, Lng: lng})
+	if u.IDSucursal == 0 {
+		return SucursalAsignada{}, geocerca.ErrSinSucursales
+	}
+	return sucursalAsignada(u), nil
+}
+
+func (r sucursalesMemoria) ConfigEntrega(_ context.Context, idEmpresa, idSucursal int) (empresa, sucursal []byte, err error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Sucursales.ConfigEntrega"); err != nil {
+		return nil, nil, err
+	}
+	empresa = r.m.ConfigEntregaJSON[ClaveConfigEntrega{IDEmpresa: idEmpresa}]
+	if idSucursal != 0 {
+		sucursal = r.m.ConfigEntregaJSON[ClaveConfigEntrega{IDEmpresa: idEmpresa, IDSucursal: idSucursal}]
+	}
+	return empresa, sucursal, nil
+}
+
+func (r sucursalesMemoria) Feriados(_ context.Context, idEmpresa, idSucursal int) ([]feriados.Feriado, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Sucursales.Feriados"); err != nil {
+		return nil, err
+	}
+	var deSucursal, deEmpresa []feriados.Feriado
+	for _, f := range r.m.Feriados {
+		switch {
+		case f.IDEmpresa != idEmpresa:
+		case f.IDSucursal == 0:
+			deEmpresa = append(deEmpresa, f.Feriado)
+		case f.IDSucursal == idSucursal:
+			deSucursal = append(deSucursal, f.Feriado)
+		}
+	}
+	return append(deSucursal, deEmpresa...), nil
+}
+
+func (r sucursalesMemoria) Coberturas(_ context.Context, idEmpresa int) ([]geocerca.Cobertura, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Sucursales.Coberturas"); err != nil {
+		return nil, err
+	}
+	var cs []geocerca.Cobertura
+	for _, s := range r.m.Sucursales {
+		if s.Activa && s.IDEmpresa == idEmpresa {
+			cs = append(cs, s.cobertura())
+		}
+	}
+	return cs, nil
+}
+
+func (r sucursalesMemoria) Cobertura(_ context.Context, idEmpresa, idSucursal int) (geocerca.Cobertura, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Sucursales.Cobertura"); err != nil {
+		return geocerca.Cobertura{}, err
+	}
+	for _, s := range r.m.Sucursales {
+		if s.IDSucursal == idSucursal && s.IDEmpresa == idEmpresa {
+			return s.cobertura(), nil
+		}
+	}
+	return geocerca.Cobertura{}, ErrNoEncontrado
+}
+
+func (r sucursalesMemoria) GuardarCobertura(_ context.Context, idEmpresa, idSucursal int, g geocerca.Geocerca) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Sucursales.GuardarCobertura"); err != nil {
+		return err
+	}
+	for i, s := range r.m.Sucursales {
+		if s.IDSucursal == idSucursal && s.IDEmpresa == idEmpresa {
+			r.m.Sucursales[i].Geocerca = &g
+			return nil
+		}
+	}
+	return ErrNoEncontrado
+}
+
+// ---------------------------
+// HORARIOS DE ENTREGA
+// ---------------------------
+
+type entregasMemoria struct{ m *Memoria }
+
+// vigente indica si la reserva ocupa su lugar en ahora.
+func (r *Reserva) vigente(ahora time.Time) bool {
+	return r.IDPedido != 0 || r.Expira.After(ahora)
+}
+
+func (r entregasMemoria) Ocupacion(_ context.Context, idEmpresa, idSucursal int, desde, hasta string, ahora time.Time) (map[Horario]Ocupacion, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Entregas.Ocupacion"); err != nil {
+		return nil, err
+	}
+	ocupacion := map[Horario]Ocupacion{}
+	for _, res := range r.m.Reservas {
+		if res.IDEmpresa != idEmpresa || res.IDSucursal != idSucursal || res.Horario.Fecha < desde || res.Horario.Fecha > hasta || !res.vigente(ahora) {
+			continue
+		}
+		o := ocupacion[res.Horario]
+		o.Pedidos++
+		o.Peso += res.Peso
+		ocupacion[res.Horario] = o
+	}
+	return ocupacion, nil
+}
+
+func (r entregasMemoria) Apartar(_ context.Context, res Reserva, limite Capacidad, ahora time.Time) (int64, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Entregas.Apartar"); err != nil {
+		return 0, err
+	}
+	var o Ocupacion
+	for _, otra := range r.m.Reservas {
+		if otra.IDEmpresa == res.IDEmpresa && otra.IDSucursal == res.IDSucursal && otra.Horario == res.Horario && otra.vigente(ahora) {
+			o.Pedidos++
+			o.Peso += otra.Peso
+		}
+	}
+	if !limite.Admite(o, res.Peso) {
+		return 0, ErrSinCapacidad
+	}
+	r.m.sigReserva++
+	res.IDReserva = r.m.sigReserva
+	res.IDPedido = 0
+	r.m.Reservas[res.IDReserva] = &res
+	return res.IDReserva, nil
+}
+
+func (r entregasMemoria) Vigente(_ context.Context, idEmpresa int, idReserva int64, ahora time.Time) (Reserva, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Entregas.Vigente"); err != nil {
+		return Reserva{}, err
+	}
+	res, ok := r.m.Reservas[idReserva]
+	if !ok || res.IDEmpresa != idEmpresa || res.IDPedido != 0 || !res.vigente(ahora) {
+		return Reserva{}, ErrReservaVencida
+	}
+	return *res, nil
+}
+
+func (r entregasMemoria) Liberar(_ context.Context, idEmpresa, idUsuario int, idReserva int64) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Entregas.Liberar"); err != nil {
+		return err
+	}
+	res, ok := r.m.Reservas[idReserva]
+	if !ok || res.IDEmpresa != idEmpresa || res.IDUsuario != idUsuario || res.IDPedido != 0 {
+		return ErrNoEncontrado
+	}
+	delete(r.m.Reservas, idReserva)
+	return nil
+}
+
+// ---------------------------
+// SINCRONIZACIÓN
+// ---------------------------
+
+type syncMemoria struct{ m *Memoria }
+
+func (r syncMemoria) CrearClienteRemoto(_ context.Context, c ClienteRemoto) (int64, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Sync.CrearClienteRemoto"); err != nil {
+		return 0, err
+	}
+	if _, err := r.m.clienteRemoto(c.IDSucursal, c.RFC, c.NombreComercial); err == nil {
+		return 0, ErrClienteRemotoExistente
+	}
+	r.m.ClientesRemotos = append(r.m.ClientesRemotos, c)
+	return int64(len(r.m.ClientesRemotos)), nil
+}
+
+func (r syncMemoria) BuscarClienteRemoto(_ context.Context, idSucursal int, rfc, nombreComercial string) (ClienteExistente, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Sync.BuscarClienteRemoto"); err != nil {
+		return ClienteExistente{}, err
+	}
+	return r.m.clienteRemoto(idSucursal, rfc, nombreComercial)
+}
+
+// clienteRemoto busca como BuscarClienteRemoto; hay que tener el candado.
+func (m *Memoria) clienteRemoto(idSucursal int, rfc, nombreComercial string) (ClienteExistente, error) {
+	for _, buscar := range []func(ClienteRemoto) bool{
+		func(c ClienteRemoto) bool { return rfc != "" && c.RFC == rfc },
+		func(c ClienteRemoto) bool { return nombreComercial != "" && c.NombreComercial == nombreComercial },
+	} {
+		for i, c := range m.ClientesRemotos {
+			if c.IDSucursal == idSucursal && buscar(c) {
+				return ClienteExistente{IDCliente: int64(i + 1), Clave: c.Clave, NombreComercial: c.NombreComercial, Telefono: c.Telefono}, nil
+			}
+		}
+	}
+	return ClienteExistente{}, ErrNoEncontrado
+}
+
+func (r syncMemoria) Pendientes(context.Context) ([]int64, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Sync.Pendientes"); err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for id, p := range r.m.Pedidos {
+		if !p.Sincronizado {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+func (r syncMemoria) MarcarProcesando(context.Context) (int64, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Sync.MarcarProcesando"); err != nil {
+		return 0, err
+	}
+	var n int64
+	for _, p := range r.m.Pedidos {
+		if p.Sincronizado && p.Pedido.Estatus == "pendiente" {
+			p.Pedido.Estatus = "procesando"
+			n++
+		}
+	}
+	return n, nil
+}
+
+// ---------------------------
+// REASIGNACIONES
+// ---------------------------
+
+type reasignacionesMemoria struct{ m *Memoria }
+
+func (r reasignacionesMemoria) Guardar(_ context.Context, re Reasignacion) (int64, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Reasignaciones.Guardar"); err != nil {
+		return 0, err
+	}
+	for _, p := range r.m.Reasignaciones {
+		if p.IDEmpresa == re.IDEmpresa && p.Estatus == ReasignacionPendiente {
+			p.Estatus = ReasignacionReemplazada
+			p.Resuelta = re.Creada
+		}
+	}
+	if len(re.Tiendas) == 0 {
+		return 0, nil
+	}
+	re.ID = int64(len(r.m.Reasignaciones) + 1)
+	re.Estatus = ReasignacionPendiente
+	re.NumTiendas = len(re.Tiendas)
+	re.Tiendas = append([]TiendaReasignada(nil), re.Tiendas...)
+	r.m.Reasignaciones = append(r.m.Reasignaciones, &re)
+	return re.ID, nil
+}
+
+// reasignacion regresa la reasignación de la empresa; hay que tener el candado.
+func (r reasignacionesMemoria) reasignacion(idEmpresa int, id int64) (*Reasignacion, error) {
+	for _, re := range r.m.Reasignaciones {
+		if re.ID == id && re.IDEmpresa == idEmpresa {
+			return re, nil
+		}
+	}
+	return nil, ErrNoEncontrado
+}
+
+func (r reasignacionesMemoria) Pendiente(_ context.Context, idEmpresa int) (Reasignacion, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Reasignaciones.Pendiente"); err != nil {
+		return Reasignacion{}, err
+	}
+	for _, re := range r.m.Reasignaciones {
+		if re.IDEmpresa == idEmpresa && re.Estatus == ReasignacionPendiente {
+			return r.copia(re), nil
+		}
+	}
+	return Reasignacion{}, ErrNoEncontrado
+}
+
+func (r reasignacionesMemoria) copia(re *Reasignacion) Reasignacion {
+	c := *re
+	c.Tiendas = append([]TiendaReasignada{}, re.Tiendas...)
+	for i, t := range c.Tiendas {
+		if ti, err := r.m.tienda(re.IDEmpresa, t.IDTienda); err == nil {
+			c.Tiendas[i].NombreTienda = ti.tienda.NombreTienda
+		}
+	}
+	return c
+}
+
+func (r reasignacionesMemoria) Obtener(_ context.Context, idEmpresa int, id int64) (Reasignacion, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Reasignaciones.Obtener"); err != nil {
+		return Reasignacion{}, err
+	}
+	re, err := r.reasignacion(idEmpresa, id)
+	if err != nil {
+		return Reasignacion{}, err
+	}
+	return r.copia(re), nil
+}
+
+func (r reasignacionesMemoria) Listar(_ context.Context, idEmpresa, limite int) ([]Reasignacion, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Reasignaciones.Listar"); err != nil {
+		return nil, err
+	}
+	res := []Reasignacion{}
+	for i := len(r.m.Reasignaciones) - 1; i >= 0 && len(res) < limite; i-- {
+		if re := r.m.Reasignaciones[i]; re.IDEmpresa == idEmpresa {
+			c := *re
+			c.Tiendas = nil
+			res = append(res, c)
+		}
+	}
+	return res, nil
+}
+
+func (r reasignacionesMemoria) Aplicar(_ context.Context, idEmpresa int, id int64, idTiendas []int, idAdmin int, ahora time.Time) ([]MovimientoSucursal, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Reasignaciones.Aplicar"); err != nil {
+		return nil, err
+	}
+	re, err := r.reasignacion(idEmpresa, id)
+	if err != nil {
+		return nil, err
+	}
+	if re.Estatus != ReasignacionPendiente {
+		return nil, ErrReasignacionResuelta
+	}
+	elegidas := map[int]bool{}
+	for _, idTienda := range idTiendas {
+		elegidas[idTienda] = true
+	}
+	movimientos := []MovimientoSucursal{}
+	for i, t := range re.Tiendas {
+		if idTiendas != nil && !elegidas[t.IDTienda] {
+			continue
+		}
+		if ti, err := r.m.tienda(idEmpresa, t.IDTienda); err == nil && ti.alta.IDSucursal == t.IDSucursalAnterior {
+			ti.alta.IDSucursal = t.IDSucursalNueva
+			ti.alta.NombreSucursal = t.SucursalNueva
+			re.Tiendas[i].Aplicada = true
+			r.m.sigMovimiento++
+			m := MovimientoSucursal{
+				ID:                 r.m.sigMovimiento,
+				IDTienda:           t.IDTienda,
+				IDSucursalAnterior: t.IDSucursalAnterior,
+				SucursalAnterior:   t.SucursalAnterior,
+				IDSucursalNueva:    t.IDSucursalNueva,
+				SucursalNueva:      t.SucursalNueva,
+				IDReasignacion:     id,
+				IDAdmin:            idAdmin,
+				Fecha:              ahora,
+			}
+			r.m.Movimientos = append(r.m.Movimientos, m)
+			movimientos = append(movimientos, m)
+		}
+	}
+	re.Estatus = ReasignacionAplicada
+	re.Resuelta = ahora
+	re.IDAdmin = idAdmin
+	return movimientos, nil
+}
+
+func (r reasignacionesMemoria) Descartar(_ context.Context, idEmpresa int, id int64, idAdmin int, ahora time.Time) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Reasignaciones.Descartar"); err != nil {
+		return err
+	}
+	re, err := r.reasignacion(idEmpresa, id)
+	if err != nil {
+		return err
+	}
+	if re.Estatus != ReasignacionPendiente {
+		return ErrReasignacionResuelta
+	}
+	re.Estatus = ReasignacionDescartada
+	re.Resuelta = ahora
+	re.IDAdmin = idAdmin
+	return nil
+}
+
+func (r reasignacionesMemoria) Movimientos(_ context.Context, idEmpresa, idTienda int) ([]MovimientoSucursal, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Reasignaciones.Movimientos"); err != nil {
+		return nil, err
+	}
+	ms := []MovimientoSucursal{}
+	for i := len(r.m.Movimientos) - 1; i >= 0; i-- {
+		m := r.m.Movimientos[i]
+		if m.IDTienda != idTienda {
+			continue
+		}
+		if _, err := r.m.tienda(idEmpresa, idTienda); err == nil {
+			ms = append(ms, m)
+		}
+	}
+	return ms, nil
+}
+
+// ---------------------------
+// DIRECCIONES
+// ---------------------------
+
+type direccionesMemoria struct{ m *Memoria }
+
+// direccion regresa la dirección activa de la tienda; hay que tener el
+// candado.
+func (r direccionesMemoria) direccion(idEmpresa, idTienda int, id int64) (*DireccionMemoria, error) {
+	for _, d := range r.m.Direcciones {
+		if d.ID == id && d.IDEmpresa == idEmpresa && d.IDTienda == idTienda && !d.Eliminada {
+			return d, nil
+		}
+	}
+	return nil, ErrNoEncontrado
+}
+
+// activas regresa las direcciones activas de la tienda en el orden de
+// Listar; hay que tener el candado.
+func (r direccionesMemoria) activas(idEmpresa, idTienda int) []*DireccionMemoria {
+	var ds []*DireccionMemoria
+	for _, d := range r.m.Direcciones {
+		if d.IDEmpresa == idEmpresa && d.IDTienda == idTienda && !d.Eliminada {
+			ds = append(ds, d)
+		}
+	}
+	sort.SliceStable(ds, func(i, j int) bool {
+		if ds[i].Predeterminada != ds[j].Predeterminada {
+			return ds[i].Predeterminada
+		}
+		if !ds[i].Creada.Equal(ds[j].Creada) {
+			return ds[i].Creada.Before(ds[j].Creada)
+		}
+		return ds[i].ID < ds[j].ID
+	})
+	return ds
+}
+
+func (r direccionesMemoria) Listar(_ context.Context, idEmpresa, idTienda int) ([]Direccion, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Direcciones.Listar"); err != nil {
+		return nil, err
+	}
+	ds := []Direccion{}
+	for _, d := range r.activas(idEmpresa, idTienda) {
+		ds = append(ds, d.Direccion)
+	}
+	return ds, nil
+}
+
+func (r direccionesMemoria) Obtener(_ context.Context, idEmpresa, idTienda int, id int64) (Direccion, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Direcciones.Obtener"); err != nil {
+		return Direccion{}, err
+	}
+	d, err := r.direccion(idEmpresa, idTienda, id)
+	if err != nil {
+		return Direccion{}, err
+	}
+	return d.Direccion, nil
+}
+
+func (r direccionesMemoria) Guardar(_ context.Context, d Direccion, ahora time.Time) (int64, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Direcciones.Guardar"); err != nil {
+		return 0, err
+	}
+	otras := 0
+	for _, a := range r.activas(d.IDEmpresa, d.IDTienda) {
+		if a.ID != d.ID {
+			otras++
+		}
+	}
+	d.Predeterminada = d.Predeterminada || otras == 0
+	d.Actualizada = ahora
+	if d.ID == 0 {
+		r.m.sigDireccion++
+		d.ID = r.m.sigDireccion
+		d.Creada = ahora
+		r.m.Direcciones = append(r.m.Direcciones, &DireccionMemoria{Direccion: d})
+	} else {
+		actual, err := r.direccion(d.IDEmpresa, d.IDTienda, d.ID)
+		if err != nil {
+			return 0, err
+		}
+		d.Predeterminada = d.Predeterminada || actual.Predeterminada
+		d.Creada = actual.Creada
+		actual.Direccion = d
+	}
+	if d.Predeterminada {
+		for _, a := range r.activas(d.IDEmpresa, d.IDTienda) {
+			a.Predeterminada = a.ID == d.ID
+		}
+	}
+	return d.ID, nil
+}
+
+func (r direccionesMemoria) Eliminar(_ context.Context, idEmpresa, idTienda int, id int64, ahora time.Time) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Direcciones.Eliminar"); err != nil {
+		return err
+	}
+	d, err := r.direccion(idEmpresa, idTienda, id)
+	if err != nil {
+		return err
+	}
+	era := d.Predeterminada
+	d.Eliminada = true
+	d.Predeterminada = false
+	d.Actualizada = ahora
+	// activas ya deja primero a la más vieja
+	if quedan := r.activas(idEmpresa, idTienda); era && len(quedan) > 0 {
+		quedan[0].Predeterminada = true
+	}
+	return nil
+}
+
+// ---------------------------
+// RECLAMOS
+// ---------------------------
+
+type reclamosMemoria struct{ m *Memoria }
+
+func (r reclamosMemoria) Vinculado(_ context.Context, idEmpresa int, idRemoto int64) (bool, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Reclamos.Vinculado"); err != nil {
+		return false, err
+	}
+	for _, u := range r.m.Usuarios {
+		if u.Usuario.IDEmpresa == idEmpresa && u.Usuario.IDRemoto == idRemoto {
+			return true, nil
+		}
+	}
+	for _, t := range r.m.tiendas() {
+		if t.alta.IDEmpresa == idEmpresa && t.alta.IDRemoto == idRemoto {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r reclamosMemoria) Iniciar(_ context.Context, re Reclamo, limite LimiteReclamos) (Reclamo, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Reclamos.Iniciar"); err != nil {
+		return Reclamo{}, err
+	}
+	previos, intentos := 0, 0
+	for _, otro := range r.m.Reclamos {
+		if otro.IDEmpresa == re.IDEmpresa && otro.IDRemoto == re.IDRemoto && !otro.Creado.Before(limite.Desde) {
+			previos++
+			intentos = max(intentos, otro.Intentos)
+		}
+	}
+	if previos >= limite.Reclamos || intentos >= limite.Intentos {
+		return Reclamo{}, ErrReclamosAgotados
+	}
+	for _, otro := range r.m.Reclamos {
+		if otro.IDEmpresa == re.IDEmpresa && otro.IDRemoto == re.IDRemoto && otro.Estatus == ReclamoPendiente {
+			otro.Estatus = ReclamoReemplazado
+		}
+	}
+	r.m.sigReclamo++
+	re.ID = r.m.sigReclamo
+	re.Intentos = intentos
+	re.Estatus = ReclamoPendiente
+	guardado := re
+	r.m.Reclamos = append(r.m.Reclamos, &guardado)
+	return re, nil
+}
+
+// pendiente regresa el reclamo pendiente de la empresa o ErrReclamoVencido;
+// hay que tener el candado.
+func (r reclamosMemoria) pendiente(idEmpresa int, id int64) (*Reclamo, error) {
+	for _, re := range r.m.Reclamos {
+		if re.ID == id && re.IDEmpresa == idEmpresa && re.Estatus == ReclamoPendiente {
+			return re, nil
+		}
+	}
+	return nil, ErrReclamoVencido
+}
+
+func (r reclamosMemoria) Intentar(_ context.Context, idEmpresa int, id int64, ahora time.Time, maximo int) (Reclamo, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Reclamos.Intentar"); err != nil {
+		return Reclamo{}, err
+	}
+	re, err := r.pendiente(idEmpresa, id)
+	if err != nil {
+		return Reclamo{}, err
+	}
+	if !ahora.Before(re.Vence) || re.Intentos >= maximo {
+		return Reclamo{}, ErrReclamoVencido
+	}
+	re.Intentos++
+	return *re, nil
+}
+
+func (r reclamosMemoria) Confirmar(_ context.Context, idEmpresa int, id int64, nu NuevoUsuario, nt NuevaTienda) (int64, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.falla("Reclamos.Confirmar"); err != nil {
+		return 0, err
+	}
+	re, err := r.pendiente(idEmpresa, id)
+	if err != nil {
+		return 0, err
+	}
+	idUsuario, err := r.m.registrar(nu, nt)
+	if err != nil {
+		return 0, err
+	}
+	re.Estatus = ReclamoConfirmado
+	return idUsuario, nil
+}
@@ -0,0 +1,390 @@
+package repositorio
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/db"
+	"github.com/WolfSlayer04/logica_tiendaenlina/feriados"
+	"github.com/WolfSlayer04/logica_tiendaenlina/geocerca"
+)
+
+// formatoFecha es para horas locales del negocio, como fecha_entrega; los
+// instantes se guardan en UTC con reloj.ParaBD.
+const formatoFecha = "2006-01-02 15:04:05"
+
+// NuevoMySQL regresa los repositorios sobre las bases local y remota. Las
+// geocercas de las sucursales quedan en memoria (GEOCERCAS_TTL) y sólo los
+// cambios hechos con estos mismos repositorios las recargan al momento, así
+// que main los crea una vez y los comparte con todos los handlers.
+func NuevoMySQL(dbc *db.DBConnection) Repositorios {
+	sucursales := sucursalesMySQL{dbc: dbc}
+	sucursales.motor = geocerca.NuevoMotor(sucursales.Coberturas, geocerca.TTLDesdeEnv())
+	return Repositorios{
+		Empresas:       empresasMySQL{db: dbc.Local},
+		Pedidos:        pedidosMySQL{db: dbc.Local},
+		Productos:      productosMySQL{db: dbc.Local},
+		Usuarios:       usuariosMySQL{db: dbc.Local},
+		Tiendas:        tiendasMySQL{db: dbc.Local},
+		Sucursales:     sucursales,
+		Entregas:       entregasMySQL{db: dbc.Local},
+		Sync:           syncMySQL{local: dbc.Local, remoto: dbc.Remote},
+		Reasignaciones: reasignacionesMySQL{db: dbc.Local},
+		Direcciones:    direccionesMySQL{db: dbc.Local},
+		Reclamos:       reclamosMySQL{db: dbc.Local},
+	}
+}
+
+// ---------------------------
+// PRODUCTOS
+// ---------------------------
+
+type productosMySQL struct {
+	db *sql.DB
+}
+
+func (p productosMySQL) Impuestos(ctx context.Context, idEmpresa int, idProducto int64) (Impuestos, error) {
+	var imp Impuestos
+	err := p.db.QueryRowContext(ctx, `
+		SELECT IFNULL(i.iva, 0), IFNULL(i.ieps1, 0) + IFNULL(i.ieps2, 0) + IFNULL(i.ieps3, 0)
+		FROM crm_productos p
+		LEFT JOIN crm_impuestos i ON p.idiva = i.idiva
+		WHERE p.idempresa = ? AND p.idproducto = ?
+	`, idEmpresa, idProducto).Scan(&imp.IVA, &imp.IEPS)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Impuestos{}, ErrNoEncontrado
+	}
+	return imp, err
+}
+
+func (p productosMySQL) Pesos(ctx context.Context, idEmpresa int, idsProducto []int64) (map[int64]float64, error) {
+	pesos := map[int64]float64{}
+	if len(idsProducto) == 0 {
+		return pesos, nil
+	}
+	args := []interface{}{idEmpresa}
+	for _, id := range idsProducto {
+		args = append(args, id)
+	}
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT idproducto, peso
+		FROM crm_productos
+		WHERE idempresa = ? AND peso IS NOT NULL AND idproducto IN (?`+strings.Repeat(", ?", len(idsProducto)-1)+`)
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var peso float64
+		if err := rows.Scan(&id, &peso); err != nil {
+			return nil, err
+		}
+		pesos[id] = peso
+	}
+	return pesos, rows.Err()
+}
+
+func (p productosMySQL) Categorias(ctx context.Context, idEmpresa int, idsProducto []int64) (map[int64]int, error) {
+	categorias := map[int64]int{}
+	if len(idsProducto) == 0 {
+		return categorias, nil
+	}
+	args := []interface{}{idEmpresa}
+	for _, id := range idsProducto {
+		args = append(args, id)
+	}
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT idproducto, idcategoria
+		FROM crm_productos
+		WHERE idempresa = ? AND idcategoria IS NOT NULL AND idproducto IN (?`+strings.Repeat(", ?", len(idsProducto)-1)+`)
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var idCategoria int
+		if err := rows.Scan(&id, &idCategoria); err != nil {
+			return nil, err
+		}
+		categorias[id] = idCategoria
+	}
+	return categorias, rows.Err()
+}
+
+// ---------------------------
+// EMPRESAS
+// ---------------------------
+
+type empresasMySQL struct {
+	db *sql.DB
+}
+
+func (e empresasMySQL) Activa(ctx context.Context, idEmpresa int) error {
+	var n int
+	err := e.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM adm_empresas WHERE idempresa = ? AND estatus = 'S'", idEmpresa).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoEncontrado
+	}
+	return nil
+}
+
+func (e empresasMySQL) Activas(ctx context.Context) ([]int, error) {
+	rows, err := e.db.QueryContext(ctx, "SELECT idempresa FROM adm_empresas WHERE estatus = 'S' ORDER BY idempresa")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (e empresasMySQL) PorDominio(ctx context.Context, dominio string) (int, error) {
+	var idEmpresa int
+	err := e.db.QueryRowContext(ctx, `
+		SELECT d.idempresa
+		FROM empresa_dominios d
+		JOIN adm_empresas e ON e.idempresa = d.idempresa
+		WHERE d.dominio = ? AND e.estatus = 'S'
+	`, dominio).Scan(&idEmpresa)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNoEncontrado
+	}
+	return idEmpresa, err
+}
+
+func (e empresasMySQL) Unica(ctx context.Context) (int, error) {
+	rows, err := e.db.QueryContext(ctx, "SELECT idempresa FROM adm_empresas WHERE estatus = 'S' LIMIT 2")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(ids) != 1 {
+		return 0, ErrNoEncontrado
+	}
+	return ids[0], nil
+}
+
+// ---------------------------
+// SUCURSALES
+// ---------------------------
+
+type sucursalesMySQL struct {
+	dbc   *db.DBConnection
+	motor *geocerca.Motor
+}
+
+func (s sucursalesMySQL) PrimeraActiva(ctx context.Context, idEmpresa int) (int, error) {
+	var idSucursal int
+	err := s.dbc.Local.QueryRowContext(ctx, "SELECT idsucursal FROM adm_sucursales WHERE idempresa = ? AND estatus = 'S' ORDER BY idsucursal LIMIT 1", idEmpresa).Scan(&idSucursal)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNoEncontrado
+	}
+	return idSucursal, err
+}
+
+func (s sucursalesMySQL) DeEmpresa(ctx context.Context, idEmpresa, idSucursal int) error {
+	var n int
+	err := s.dbc.Local.QueryRowContext(ctx, "SELECT COUNT(*) FROM adm_sucursales WHERE idempresa = ? AND idsucursal = ?", idEmpresa, idSucursal).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoEncontrado
+	}
+	return nil
+}
+
+func (s sucursalesMySQL) PorUbicacion(ctx context.Context, idEmpresa int, lat, lng float64) (SucursalAsignada, error) {
+	u, err := s.motor.Asignar(ctx, idEmpresa, geocerca.Punto{Lat: lat, Lng: lng})
+	if err != nil {
+		return SucursalAsignada{}, err
+	}
+	return sucursalAsignada(u), nil
+}
+
+func sucursalAsignada(u geocerca.Ubicacion) SucursalAsignada {
+	return SucursalAsignada{
+		IDSucursal:       u.IDSucursal,
+		Nombre:           u.Nombre,
+		EnCobertura:      u.Cubierta,
+		DistanciaKm:      u.DistanciaCentro,
+		DistanciaBordeKm: u.DistanciaBorde,
+	}
+}
+
+func (s sucursalesMySQL) ConfigEntrega(ctx context.Context, idEmpresa, idSucursal int) (empresa, sucursal []byte, err error) {
+	// La fila de la empresa es la de idsucursal 0
+	rows, err := s.dbc.Local.QueryContext(ctx, `
+		SELECT idsucursal, config
+		FROM config_entrega
+		WHERE idempresa = ? AND idsucursal IN (0, ?)
+	`, idEmpresa, idSucursal)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var config []byte
+		if err := rows.Scan(&id, &config); err != nil {
+			return nil, nil, err
+		}
+		if id == 0 {
+			empresa = config
+		} else {
+			sucursal = config
+		}
+	}
+	return empresa, sucursal, rows.Err()
+}
+
+func (s sucursalesMySQL) Feriados(ctx context.Context, idEmpresa, idSucursal int) ([]feriados.Feriado, error) {
+	rows, err := s.dbc.Local.QueryContext(ctx, `
+		SELECT id_feriado, id_sucursal, DATE_FORMAT(fecha, '%Y-%m-%d'), nombre, recurrente, dias_adicionales, origen
+		FROM dias_feriados
+		WHERE id_empresa = ? AND id_sucursal IN (0, ?)
+		ORDER BY id_sucursal DESC, fecha
+	`, idEmpresa, idSucursal)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var fs []feriados.Feriado
+	for rows.Next() {
+		var f feriados.Feriado
+		var fecha string
+		if err := rows.Scan(&f.ID, &f.IDSucursal, &fecha, &f.Nombre, &f.Recurrente, &f.DiasAdicionales, &f.Origen); err != nil {
+			return nil, err
+		}
+		if f.Fecha, err = time.Parse("2006-01-02", fecha); err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+	}
+	return fs, rows.Err()
+}
+
+// consultaCoberturas trae una fila por punto de cada sucursal, en orden; las
+// que no tienen puntos salen una vez con el punto en NULL.
+const consultaCoberturas = `
+	SELECT s.idsucursal, s.sucursal, s.tipo_objeto, s.radio, ST_X(p.punto), ST_Y(p.punto)
+	FROM adm_sucursales s
+	LEFT JOIN adm_sucursales_ptos p ON p.idsucursal = s.idsucursal
+	WHERE s.idempresa = ? %s
+	ORDER BY s.idsucursal, p.orden
+`
+
+func (s sucursalesMySQL) Coberturas(ctx context.Context, idEmpresa int) ([]geocerca.Cobertura, error) {
+	return s.coberturas(ctx, fmt.Sprintf(consultaCoberturas, "AND s.estatus = 'S'"), idEmpresa)
+}
+
+func (s sucursalesMySQL) Cobertura(ctx context.Context, idEmpresa, idSucursal int) (geocerca.Cobertura, error) {
+	cs, err := s.coberturas(ctx, fmt.Sprintf(consultaCoberturas, "AND s.idsucursal = ?"), idEmpresa, idSucursal)
+	if err != nil {
+		return geocerca.Cobertura{}, err
+	}
+	if len(cs) == 0 {
+		return geocerca.Cobertura{}, ErrNoEncontrado
+	}
+	return cs[0], nil
+}
+
+func (s sucursalesMySQL) coberturas(ctx context.Context, consulta string, args ...any) ([]geocerca.Cobertura, error) {
+	rows, err := s.dbc.Local.QueryContext(ctx, consulta, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cs []geocerca.Cobertura
+	for rows.Next() {
+		var c geocerca.Cobertura
+		var lat, lng sql.NullFloat64
+		if err := rows.Scan(&c.IDSucursal, &c.Nombre, &c.Geocerca.Tipo, &c.Geocerca.RadioKm, &lat, &lng); err != nil {
+			return nil, err
+		}
+		if len(cs) == 0 || cs[len(cs)-1].IDSucursal != c.IDSucursal {
+			cs = append(cs, c)
+		}
+		if lat.Valid && lng.Valid {
+			g := &cs[len(cs)-1].Geocerca
+			// punto guarda (latitud, longitud)
+			g.Puntos = append(g.Puntos, geocerca.Punto{Lat: lat.Float64, Lng: lng.Float64})
+		}
+	}
+	return cs, rows.Err()
+}
+
+func (s sucursalesMySQL) GuardarCobertura(ctx context.Context, idEmpresa, idSucursal int, g geocerca.Geocerca) error {
+	tx, err := s.dbc.Local.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("iniciando transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	var n int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM adm_sucursales WHERE idempresa = ? AND idsucursal = ?", idEmpresa, idSucursal).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoEncontrado
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE adm_sucursales SET tipo_objeto = ?, radio = ? WHERE idsucursal = ?", g.Tipo, g.RadioKm, idSucursal); err != nil {
+		return fmt.Errorf("actualizando sucursal: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM adm_sucursales_ptos WHERE idsucursal = ?", idSucursal); err != nil {
+		return fmt.Errorf("borrando puntos: %w", err)
+	}
+	for i, p := range g.Puntos {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO adm_sucursales_ptos (idsucursal, orden, punto) VALUES (?, ?, POINT(?, ?))", idSucursal, i+1, p.Lat, p.Lng); err != nil {
+			return fmt.Errorf("guardando punto %d: %w", i+1, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("confirmando cobertura: %w", err)
+	}
+	s.motor.Invalidar(idEmpresa)
+	return nil
+}
+
+func nullTime(nt sql.NullTime) interface{} {
+	if nt.Valid {
+		return nt.Time.Format(formatoFecha)
+	}
+	return nil
+}
+
+func nullString(ns sql.NullString) interface{} {
+	if ns.Valid {
+		return ns.String
+	}
+	return nil
+}
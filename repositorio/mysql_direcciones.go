@@ -0,0 +1,186 @@
+package repositorio
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/reloj"
+)
+
+type direccionesMySQL struct {
+	db *sql.DB
+}
+
+// consultaDirecciones lee las direcciones activas; se completa con el WHERE.
+const consultaDirecciones = `
+	SELECT id_direccion, id_empresa, id_tienda, alias, direccion, colonia, codigo_postal, ciudad, estado,
+	       referencias, latitud, longitud, predeterminada, creada, actualizada
+	FROM direcciones_tienda
+	WHERE estatus = 'activa'
+`
+
+func leerDireccion(ctx context.Context, s interface{ Scan(...any) error }) (Direccion, error) {
+	var d Direccion
+	var creada, actualizada string
+	if err := s.Scan(&d.ID, &d.IDEmpresa, &d.IDTienda, &d.Alias, &d.Direccion, &d.Colonia, &d.CodigoPostal, &d.Ciudad, &d.Estado,
+		&d.Referencias, &d.Latitud, &d.Longitud, &d.Predeterminada, &creada, &actualizada); err != nil {
+		return Direccion{}, err
+	}
+	zona := reloj.Desde(ctx).Ahora().Location()
+	var err error
+	if d.Creada, err = reloj.LeerBD(creada, zona); err != nil {
+		return Direccion{}, err
+	}
+	if d.Actualizada, err = reloj.LeerBD(actualizada, zona); err != nil {
+		return Direccion{}, err
+	}
+	return d, nil
+}
+
+func (r direccionesMySQL) Listar(ctx context.Context, idEmpresa, idTienda int) ([]Direccion, error) {
+	rows, err := r.db.QueryContext(ctx, consultaDirecciones+`
+		  AND id_empresa = ? AND id_tienda = ?
+		ORDER BY predeterminada DESC, creada, id_direccion
+	`, idEmpresa, idTienda)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ds := []Direccion{}
+	for rows.Next() {
+		d, err := leerDireccion(ctx, rows)
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, d)
+	}
+	return ds, rows.Err()
+}
+
+func (r direccionesMySQL) Obtener(ctx context.Context, idEmpresa, idTienda int, id int64) (Direccion, error) {
+	d, err := leerDireccion(ctx, r.db.QueryRowContext(ctx, consultaDirecciones+`
+		  AND id_empresa = ? AND id_tienda = ? AND id_direccion = ?
+	`, idEmpresa, idTienda, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Direccion{}, ErrNoEncontrado
+	}
+	return d, err
+}
+
+// predeterminada bloquea la dirección activa de la tienda hasta el COMMIT y
+// dice si es la predeterminada.
+func predeterminada(ctx context.Context, tx *sql.Tx, idEmpresa, idTienda int, id int64) (bool, error) {
+	var es bool
+	err := tx.QueryRowContext(ctx, `
+		SELECT predeterminada FROM direcciones_tienda
+		WHERE id_empresa = ? AND id_tienda = ? AND id_direccion = ? AND estatus = 'activa'
+		FOR UPDATE
+	`, idEmpresa, idTienda, id).Scan(&es)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrNoEncontrado
+	}
+	return es, err
+}
+
+func (r direccionesMySQL) Guardar(ctx context.Context, d Direccion, ahora time.Time) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("iniciando transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	var otras int
+	if err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM direcciones_tienda
+		WHERE id_empresa = ? AND id_tienda = ? AND id_direccion <> ? AND estatus = 'activa'
+	`, d.IDEmpresa, d.IDTienda, d.ID).Scan(&otras); err != nil {
+		return 0, err
+	}
+	esPredeterminada := d.Predeterminada || otras == 0
+	bd := reloj.ParaBD(ahora)
+	id := d.ID
+	if id == 0 {
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO direcciones_tienda (
+				id_empresa, id_tienda, alias, direccion, colonia, codigo_postal, ciudad, estado,
+				referencias, latitud, longitud, predeterminada, creada, actualizada
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, d.IDEmpresa, d.IDTienda, d.Alias, d.Direccion, d.Colonia, d.CodigoPostal, d.Ciudad, d.Estado,
+			d.Referencias, d.Latitud, d.Longitud, esPredeterminada, bd, bd)
+		if err != nil {
+			return 0, fmt.Errorf("guardando dirección: %w", err)
+		}
+		if id, err = res.LastInsertId(); err != nil {
+			return 0, err
+		}
+	} else {
+		actual, err := predeterminada(ctx, tx, d.IDEmpresa, d.IDTienda, id)
+		if err != nil {
+			return 0, err
+		}
+		esPredeterminada = esPredeterminada || actual
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE direcciones_tienda
+			SET alias = ?, direccion = ?, colonia = ?, codigo_postal = ?, ciudad = ?, estado = ?,
+			    referencias = ?, latitud = ?, longitud = ?, predeterminada = ?, actualizada = ?
+			WHERE id_direccion = ?
+		`, d.Alias, d.Direccion, d.Colonia, d.CodigoPostal, d.Ciudad, d.Estado,
+			d.Referencias, d.Latitud, d.Longitud, esPredeterminada, bd, id); err != nil {
+			return 0, fmt.Errorf("actualizando dirección %d: %w", id, err)
+		}
+	}
+	if esPredeterminada {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE direcciones_tienda SET predeterminada = FALSE
+			WHERE id_empresa = ? AND id_tienda = ? AND id_direccion <> ? AND predeterminada
+		`, d.IDEmpresa, d.IDTienda, id); err != nil {
+			return 0, fmt.Errorf("quitando la predeterminada anterior: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("confirmando dirección: %w", err)
+	}
+	return id, nil
+}
+
+func (r direccionesMySQL) Eliminar(ctx context.Context, idEmpresa, idTienda int, id int64, ahora time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("iniciando transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	era, err := predeterminada(ctx, tx, idEmpresa, idTienda, id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE direcciones_tienda SET estatus = 'eliminada', predeterminada = FALSE, actualizada = ?
+		WHERE id_direccion = ?
+	`, reloj.ParaBD(ahora), id); err != nil {
+		return fmt.Errorf("eliminando dirección %d: %w", id, err)
+	}
+	if era {
+		var siguiente int64
+		err := tx.QueryRowContext(ctx, `
+			SELECT id_direccion FROM direcciones_tienda
+			WHERE id_empresa = ? AND id_tienda = ? AND estatus = 'activa'
+			ORDER BY creada, id_direccion
+			LIMIT 1
+		`, idEmpresa, idTienda).Scan(&siguiente)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if siguiente != 0 {
+			if _, err := tx.ExecContext(ctx, `
+				UPDATE direcciones_tienda SET predeterminada = TRUE WHERE id_direccion = ?
+			`, siguiente); err != nil {
+				return fmt.Errorf("cambiando la predeterminada: %w", err)
+			}
+		}
+	}
+	return tx.Commit()
+}
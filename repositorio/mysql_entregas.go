@@ -0,0 +1,135 @@
+package repositorio
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/reloj"
+)
+
+type entregasMySQL struct {
+	db *sql.DB
+}
+
+func (e entregasMySQL) Ocupacion(ctx context.Context, idEmpresa, idSucursal int, desde, hasta string, ahora time.Time) (map[Horario]Ocupacion, error) {
+	rows, err := e.db.QueryContext(ctx, `
+		SELECT DATE_FORMAT(fecha, '%Y-%m-%d'), horario, COUNT(*), IFNULL(SUM(peso), 0)
+		FROM reservas_entrega
+		WHERE id_empresa = ? AND id_sucursal = ? AND fecha BETWEEN ? AND ?
+		  AND (id_pedido IS NOT NULL OR expira > ?)
+		GROUP BY fecha, horario
+	`, idEmpresa, idSucursal, desde, hasta, reloj.ParaBD(ahora))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ocupacion := map[Horario]Ocupacion{}
+	for rows.Next() {
+		var h Horario
+		var o Ocupacion
+		if err := rows.Scan(&h.Fecha, &h.Inicio, &o.Pedidos, &o.Peso); err != nil {
+			return nil, err
+		}
+		ocupacion[h] = o
+	}
+	return ocupacion, rows.Err()
+}
+
+func (e entregasMySQL) Apartar(ctx context.Context, r Reserva, limite Capacidad, ahora time.Time) (int64, error) {
+	tx, err := e.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("iniciando transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	// FOR UPDATE bloquea el horario hasta el COMMIT para que dos apartados
+	// simultáneos no tomen el mismo lugar
+	var o Ocupacion
+	err = tx.QueryRowContext(ctx, `
+		SELECT COUNT(*), IFNULL(SUM(peso), 0)
+		FROM reservas_entrega
+		WHERE id_empresa = ? AND id_sucursal = ? AND fecha = ? AND horario = ?
+		  AND (id_pedido IS NOT NULL OR expira > ?)
+		FOR UPDATE
+	`, r.IDEmpresa, r.IDSucursal, r.Horario.Fecha, r.Horario.Inicio, reloj.ParaBD(ahora)).Scan(&o.Pedidos, &o.Peso)
+	if err != nil {
+		return 0, fmt.Errorf("consultando ocupación: %w", err)
+	}
+	if !limite.Admite(o, r.Peso) {
+		return 0, ErrSinCapacidad
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO reservas_entrega (id_empresa, id_sucursal, fecha, horario, id_usuario, peso, expira, creada)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, r.IDEmpresa, r.IDSucursal, r.Horario.Fecha, r.Horario.Inicio, r.IDUsuario, r.Peso,
+		reloj.ParaBD(r.Expira), reloj.ParaBD(ahora))
+	if err != nil {
+		return 0, fmt.Errorf("insertando apartado: %w", err)
+	}
+	idReserva, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("confirmando apartado: %w", err)
+	}
+	return idReserva, nil
+}
+
+func (e entregasMySQL) Vigente(ctx context.Context, idEmpresa int, idReserva int64, ahora time.Time) (Reserva, error) {
+	var r Reserva
+	var expira string
+	err := e.db.QueryRowContext(ctx, `
+		SELECT id_reserva, id_empresa, id_sucursal, id_usuario, DATE_FORMAT(fecha, '%Y-%m-%d'), horario, peso,
+		       DATE_FORMAT(expira, '%Y-%m-%d %H:%i:%s')
+		FROM reservas_entrega
+		WHERE id_empresa = ? AND id_reserva = ? AND id_pedido IS NULL AND expira > ?
+	`, idEmpresa, idReserva, reloj.ParaBD(ahora)).Scan(
+		&r.IDReserva, &r.IDEmpresa, &r.IDSucursal, &r.IDUsuario, &r.Horario.Fecha, &r.Horario.Inicio, &r.Peso, &expira)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Reserva{}, ErrReservaVencida
+	}
+	if err != nil {
+		return Reserva{}, err
+	}
+	r.Expira, err = reloj.LeerBD(expira, ahora.Location())
+	return r, err
+}
+
+func (e entregasMySQL) Liberar(ctx context.Context, idEmpresa, idUsuario int, idReserva int64) error {
+	result, err := e.db.ExecContext(ctx, "DELETE FROM reservas_entrega WHERE id_empresa = ? AND id_reserva = ? AND id_usuario = ? AND id_pedido IS NULL", idEmpresa, idReserva, idUsuario)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNoEncontrado
+	}
+	return nil
+}
+
+// confirmarReserva liga el apartado al pedido dentro de la transacción que lo
+// crea; si ya venció o se usó regresa ErrReservaVencida.
+func confirmarReserva(ctx context.Context, tx *sql.Tx, ped *NuevoPedido, idPedido int64) error {
+	result, err := tx.ExecContext(ctx, `
+		UPDATE reservas_entrega
+		SET id_pedido = ?, peso = ?, expira = NULL
+		WHERE id_reserva = ? AND id_empresa = ? AND id_pedido IS NULL AND expira > ?
+	`, idPedido, ped.Peso, ped.IDReserva, ped.IDEmpresa, reloj.ParaBD(ped.FechaCreacion))
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrReservaVencida
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package repositorio
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/reloj"
+)
+
+type pedidosMySQL struct {
+	db *sql.DB
+}
+
+func (p pedidosMySQL) Crear(ctx context.Context, ped *NuevoPedido) (int64, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("iniciando transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	fechaCreacion := reloj.ParaBD(ped.FechaCreacion)
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO pedidos (
+			id_empresa, clave_unica, id_usuario, id_tienda, id_sucursal, fecha_creacion, fecha_entrega,
+			subtotal, descuento, iva, ieps, total, id_metodo_pago, referencia_pago,
+			direccion_entrega, colonia_entrega, cp_entrega, ciudad_entrega, estado_entrega,
+			latitud_entrega, longitud_entrega,
+			estatus, comentarios, origen_pedido, id_lista_precio, explicacion_entrega, id_direccion
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		ped.IDEmpresa, ped.ClaveUnica, ped.IDUsuario, ped.IDTienda, ped.IDSucursal, fechaCreacion, nullTime(ped.FechaEntrega),
+		ped.Subtotal, ped.Descuento, ped.IVA, ped.IEPS, ped.Total, ped.IDMetodoPago, nullString(ped.ReferenciaPago),
+		ped.DireccionEntrega, ped.ColoniaEntrega, ped.CPEntrega, ped.CiudadEntrega, ped.EstadoEntrega,
+		ped.LatitudEntrega, ped.LongitudEntrega,
+		ped.Estatus, nullString(ped.Comentarios), ped.OrigenPedido, ped.IDListaPrecio,
+		sql.NullString{String: ped.ExplicacionEntrega, Valid: ped.ExplicacionEntrega != ""},
+		sql.NullInt64{Int64: ped.IDDireccion, Valid: ped.IDDireccion != 0},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("insertando pedido: %w", err)
+	}
+	idPedido, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO detalle_pedidos (
+			id_pedido, id_producto, clave_producto, descripcion, unidad, cantidad,
+			precio_unitario, porcentaje_descuento, importe_descuento, subtotal,
+			importe_iva, importe_ieps, total, latitud_entrega, longitud_entrega, estatus, comentarios, fecha_registro
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("preparando detalle: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, d := range ped.Detalles {
+		_, err = stmt.ExecContext(ctx,
+			idPedido, d.IDProducto, d.ClaveProducto, d.Descripcion, d.Unidad, d.Cantidad,
+			d.PrecioUnitario, d.PorcentajeDescuento, d.ImporteDescuento, d.Subtotal,
+			d.ImporteIVA, d.ImporteIEPS, d.Total, d.LatitudEntrega, d.LongitudEntrega, d.Estatus, d.Comentarios,
+			fechaCreacion,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("insertando detalle del producto %d: %w", d.IDProducto, err)
+		}
+	}
+
+	if ped.IDReserva != 0 {
+		if err := confirmarReserva(ctx, tx, ped, idPedido); err != nil {
+			return 0, fmt.Errorf("confirmando reserva %d: %w", ped.IDReserva, err)
+		}
+	}
+
+	if err := AcumularIndicadores(ctx, tx, ped.IDEmpresa, ped.Total, ped.FechaCreacion); err != nil {
+		return 0, fmt.Errorf("actualizando indicadores diarios/mensuales: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("confirmando pedido: %w", err)
+	}
+	return idPedido, nil
+}
+
+func (p pedidosMySQL) Totales(ctx context.Context, idEmpresa int, idPedido int64) (TotalesPedido, error) {
+	var t TotalesPedido
+	err := p.db.QueryRowContext(ctx, "SELECT subtotal, descuento, iva, ieps, total FROM pedidos WHERE id_empresa = ? AND id_pedido = ?", idEmpresa, idPedido).
+		Scan(&t.Subtotal, &t.Descuento, &t.IVA, &t.IEPS, &t.Total)
+	if errors.Is(err, sql.ErrNoRows) {
+		return TotalesPedido{}, ErrNoEncontrado
+	}
+	return t, err
+}
+
+func (p pedidosMySQL) AplicarDescuento(ctx context.Context, idEmpresa int, idPedido int64, descuento, total float64) error {
+	_, err := p.db.ExecContext(ctx, "UPDATE pedidos SET descuento = ?, total = ? WHERE id_pedido = ? AND id_empresa = ?", descuento, total, idPedido, idEmpresa)
+	return err
+}
+
+// AcumularIndicadores suma un pedido a ind_diario e ind_mensual de su empresa
+// dentro de la transacción que lo crea. El día y el mes son los de
+// fechaPedido en su zona, que debe ser la del negocio; fecha_creacion está en
+// UTC, así que los clientes se cuentan entre los límites del día y del mes
+// pasados a UTC.
+func AcumularIndicadores(ctx context.Context, tx *sql.Tx, idEmpresa int, total float64, fechaPedido time.Time) error {
+	// --- DIARIO ---
+	dia := reloj.Dia(fechaPedido) // "YYYY-MM-DD"
+	inicioDia := reloj.InicioDelDia(fechaPedido)
+	var existe int
+	err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM ind_diario WHERE id_empresa = ? AND fecha = ?`, idEmpresa, dia).Scan(&existe)
+	if err != nil {
+		return err
+	}
+	if existe > 0 {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE ind_diario
+			SET num_pedidos = num_pedidos + 1,
+				tot_pedidos = tot_pedidos + ?,
+				num_clientes = (
+					SELECT COUNT(DISTINCT id_usuario) FROM pedidos
+					WHERE id_empresa = ? AND fecha_creacion >= ? AND fecha_creacion < ?
+				)
+			WHERE id_empresa = ? AND fecha = ?`,
+			total, idEmpresa, reloj.ParaBD(inicioDia), reloj.ParaBD(inicioDia.AddDate(0, 0, 1)), idEmpresa, dia)
+	} else {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO ind_diario (id_empresa, fecha, num_pedidos, tot_pedidos, num_clientes)
+			VALUES (?, ?, 1, ?, 1)`,
+			idEmpresa, dia, total)
+	}
+	if err != nil {
+		return err
+	}
+
+	// --- MENSUAL ---
+	inicioMes := reloj.InicioDelMes(fechaPedido)
+	mes := reloj.Dia(inicioMes)
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM ind_mensual WHERE id_empresa = ? AND fecha = ?`, idEmpresa, mes).Scan(&existe)
+	if err != nil {
+		return err
+	}
+	if existe > 0 {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE ind_mensual
+			SET num_pedidos = num_pedidos + 1,
+				tot_pedidos = tot_pedidos + ?,
+				num_clientes = (
+					SELECT COUNT(DISTINCT id_usuario) FROM pedidos
+					WHERE id_empresa = ? AND fecha_creacion >= ? AND fecha_creacion < ?
+				)
+			WHERE id_empresa = ? AND fecha = ?`,
+			total, idEmpresa, reloj.ParaBD(inicioMes), reloj.ParaBD(inicioMes.AddDate(0, 1, 0)), idEmpresa, mes)
+	} else {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO ind_mensual (id_empresa, fecha, num_pedidos, tot_pedidos, num_clientes)
+			VALUES (?, ?, 1, ?, 1)`,
+			idEmpresa, mes, total)
+	}
+	return err
+}
@@ -0,0 +1,311 @@
+package repositorio
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/reloj"
+)
+
+type reasignacionesMySQL struct {
+	db *sql.DB
+}
+
+func (r reasignacionesMySQL) Guardar(ctx context.Context, re Reasignacion) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("iniciando transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	creada := reloj.ParaBD(re.Creada)
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE reasignaciones SET estatus = ?, resuelta = ?
+		WHERE id_empresa = ? AND estatus = ?
+	`, ReasignacionReemplazada, creada, re.IDEmpresa, ReasignacionPendiente); err != nil {
+		return 0, fmt.Errorf("reemplazando la reasignación pendiente: %w", err)
+	}
+	var id int64
+	if len(re.Tiendas) > 0 {
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO reasignaciones (id_empresa, estatus, origen, creada) VALUES (?, ?, ?, ?)
+		`, re.IDEmpresa, ReasignacionPendiente, re.Origen, creada)
+		if err != nil {
+			return 0, fmt.Errorf("guardando reasignación: %w", err)
+		}
+		if id, err = res.LastInsertId(); err != nil {
+			return 0, err
+		}
+		for _, t := range re.Tiendas {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO reasignaciones_tiendas (
+					id_reasignacion, id_tienda, idsucursal_anterior, sucursal_anterior, idsucursal_nueva, sucursal_nueva, en_cobertura
+				) VALUES (?, ?, ?, ?, ?, ?, ?)
+			`, id, t.IDTienda, t.IDSucursalAnterior, t.SucursalAnterior, t.IDSucursalNueva, t.SucursalNueva, t.EnCobertura)
+			if err != nil {
+				return 0, fmt.Errorf("guardando tienda %d: %w", t.IDTienda, err)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("confirmando reasignación: %w", err)
+	}
+	return id, nil
+}
+
+// consultaReasignaciones es la cabecera de las reasignaciones con el número de
+// tiendas; se completa con el WHERE.
+const consultaReasignaciones = `
+	SELECT r.id_reasignacion, r.id_empresa, r.estatus, r.origen, r.creada, r.resuelta, IFNULL(r.id_admin, 0),
+	       (SELECT COUNT(*) FROM reasignaciones_tiendas rt WHERE rt.id_reasignacion = r.id_reasignacion)
+	FROM reasignaciones r
+`
+
+func leerReasignacion(ctx context.Context, s interface{ Scan(...any) error }) (Reasignacion, error) {
+	var re Reasignacion
+	var creada string
+	var resuelta sql.NullString
+	if err := s.Scan(&re.ID, &re.IDEmpresa, &re.Estatus, &re.Origen, &creada, &resuelta, &re.IDAdmin, &re.NumTiendas); err != nil {
+		return Reasignacion{}, err
+	}
+	zona := reloj.Desde(ctx).Ahora().Location()
+	var err error
+	if re.Creada, err = reloj.LeerBD(creada, zona); err != nil {
+		return Reasignacion{}, err
+	}
+	if resuelta.Valid {
+		if re.Resuelta, err = reloj.LeerBD(resuelta.String, zona); err != nil {
+			return Reasignacion{}, err
+		}
+	}
+	return re, nil
+}
+
+func (r reasignacionesMySQL) Pendiente(ctx context.Context, idEmpresa int) (Reasignacion, error) {
+	var id int64
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id_reasignacion FROM reasignaciones
+		WHERE id_empresa = ? AND estatus = ?
+		ORDER BY id_reasignacion DESC LIMIT 1
+	`, idEmpresa, ReasignacionPendiente).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Reasignacion{}, ErrNoEncontrado
+	}
+	if err != nil {
+		return Reasignacion{}, err
+	}
+	return r.Obtener(ctx, idEmpresa, id)
+}
+
+func (r reasignacionesMySQL) Obtener(ctx context.Context, idEmpresa int, id int64) (Reasignacion, error) {
+	re, err := leerReasignacion(ctx, r.db.QueryRowContext(ctx, consultaReasignaciones+`
+		WHERE r.id_empresa = ? AND r.id_reasignacion = ?
+	`, idEmpresa, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Reasignacion{}, ErrNoEncontrado
+	}
+	if err != nil {
+		return Reasignacion{}, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT rt.id_tienda, IFNULL(t.nombre_tienda, ''), rt.idsucursal_anterior, rt.sucursal_anterior,
+		       rt.idsucursal_nueva, rt.sucursal_nueva, rt.en_cobertura, rt.aplicada
+		FROM reasignaciones_tiendas rt
+		LEFT JOIN tiendas t ON t.id_tienda = rt.id_tienda
+		WHERE rt.id_reasignacion = ?
+		ORDER BY rt.id_tienda
+	`, id)
+	if err != nil {
+		return Reasignacion{}, err
+	}
+	defer rows.Close()
+	re.Tiendas = []TiendaReasignada{}
+	for rows.Next() {
+		var t TiendaReasignada
+		if err := rows.Scan(&t.IDTienda, &t.NombreTienda, &t.IDSucursalAnterior, &t.SucursalAnterior,
+			&t.IDSucursalNueva, &t.SucursalNueva, &t.EnCobertura, &t.Aplicada); err != nil {
+			return Reasignacion{}, err
+		}
+		re.Tiendas = append(re.Tiendas, t)
+	}
+	return re, rows.Err()
+}
+
+func (r reasignacionesMySQL) Listar(ctx context.Context, idEmpresa, limite int) ([]Reasignacion, error) {
+	rows, err := r.db.QueryContext(ctx, consultaReasignaciones+`
+		WHERE r.id_empresa = ?
+		ORDER BY r.id_reasignacion DESC
+		LIMIT ?
+	`, idEmpresa, limite)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []Reasignacion{}
+	for rows.Next() {
+		re, err := leerReasignacion(ctx, rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, rows.Err()
+}
+
+// resolver bloquea la reasignación hasta el COMMIT y revisa que siga
+// pendiente.
+func resolver(ctx context.Context, tx *sql.Tx, idEmpresa int, id int64) error {
+	var estatus string
+	err := tx.QueryRowContext(ctx, `
+		SELECT estatus FROM reasignaciones
+		WHERE id_empresa = ? AND id_reasignacion = ?
+		FOR UPDATE
+	`, idEmpresa, id).Scan(&estatus)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNoEncontrado
+	}
+	if err != nil {
+		return err
+	}
+	if estatus != ReasignacionPendiente {
+		return ErrReasignacionResuelta
+	}
+	return nil
+}
+
+func (r reasignacionesMySQL) Aplicar(ctx context.Context, idEmpresa int, id int64, idTiendas []int, idAdmin int, ahora time.Time) ([]MovimientoSucursal, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("iniciando transacción: %w", err)
+	}
+	defer tx.Rollback()
+	if err := resolver(ctx, tx, idEmpresa, id); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id_tienda, idsucursal_anterior, sucursal_anterior, idsucursal_nueva, sucursal_nueva
+		FROM reasignaciones_tiendas
+		WHERE id_reasignacion = ?
+		ORDER BY id_tienda
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	var candidatos []MovimientoSucursal
+	for rows.Next() {
+		m := MovimientoSucursal{IDReasignacion: id, IDAdmin: idAdmin, Fecha: ahora}
+		if err := rows.Scan(&m.IDTienda, &m.IDSucursalAnterior, &m.SucursalAnterior, &m.IDSucursalNueva, &m.SucursalNueva); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidatos = append(candidatos, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	elegidas := map[int]bool{}
+	for _, idTienda := range idTiendas {
+		elegidas[idTienda] = true
+	}
+	fecha := reloj.ParaBD(ahora)
+	admin := sql.NullInt64{Int64: int64(idAdmin), Valid: idAdmin != 0}
+	movimientos := []MovimientoSucursal{}
+	for _, m := range candidatos {
+		if idTiendas != nil && !elegidas[m.IDTienda] {
+			continue
+		}
+		// Si la tienda cambió de sucursal después del reporte, se respeta
+		res, err := tx.ExecContext(ctx, `
+			UPDATE tiendas SET idsucursal = ?, nombre_sucursal = ?, ultima_actualizacion = ?
+			WHERE id_tienda = ? AND id_empresa = ? AND IFNULL(idsucursal, 0) = ?
+		`, m.IDSucursalNueva, m.SucursalNueva, fecha, m.IDTienda, idEmpresa, m.IDSucursalAnterior)
+		if err != nil {
+			return nil, fmt.Errorf("moviendo tienda %d: %w", m.IDTienda, err)
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return nil, err
+		} else if n == 0 {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE reasignaciones_tiendas SET aplicada = TRUE WHERE id_reasignacion = ? AND id_tienda = ?
+		`, id, m.IDTienda); err != nil {
+			return nil, err
+		}
+		res, err = tx.ExecContext(ctx, `
+			INSERT INTO tiendas_movimientos (
+				id_empresa, id_tienda, idsucursal_anterior, sucursal_anterior, idsucursal_nueva, sucursal_nueva, id_reasignacion, id_admin, fecha
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, idEmpresa, m.IDTienda, m.IDSucursalAnterior, m.SucursalAnterior, m.IDSucursalNueva, m.SucursalNueva, id, admin, fecha)
+		if err != nil {
+			return nil, fmt.Errorf("guardando movimiento de la tienda %d: %w", m.IDTienda, err)
+		}
+		if m.ID, err = res.LastInsertId(); err != nil {
+			return nil, err
+		}
+		movimientos = append(movimientos, m)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE reasignaciones SET estatus = ?, resuelta = ?, id_admin = ? WHERE id_reasignacion = ?
+	`, ReasignacionAplicada, fecha, admin, id); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("confirmando reasignación: %w", err)
+	}
+	return movimientos, nil
+}
+
+func (r reasignacionesMySQL) Descartar(ctx context.Context, idEmpresa int, id int64, idAdmin int, ahora time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("iniciando transacción: %w", err)
+	}
+	defer tx.Rollback()
+	if err := resolver(ctx, tx, idEmpresa, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE reasignaciones SET estatus = ?, resuelta = ?, id_admin = ? WHERE id_reasignacion = ?
+	`, ReasignacionDescartada, reloj.ParaBD(ahora), sql.NullInt64{Int64: int64(idAdmin), Valid: idAdmin != 0}, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r reasignacionesMySQL) Movimientos(ctx context.Context, idEmpresa, idTienda int) ([]MovimientoSucursal, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id_movimiento, id_tienda, idsucursal_anterior, sucursal_anterior, idsucursal_nueva, sucursal_nueva,
+		       IFNULL(id_reasignacion, 0), IFNULL(id_admin, 0), fecha
+		FROM tiendas_movimientos
+		WHERE id_empresa = ? AND id_tienda = ?
+		ORDER BY fecha DESC, id_movimiento DESC
+	`, idEmpresa, idTienda)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	zona := reloj.Desde(ctx).Ahora().Location()
+	ms := []MovimientoSucursal{}
+	for rows.Next() {
+		var m MovimientoSucursal
+		var fecha string
+		if err := rows.Scan(&m.ID, &m.IDTienda, &m.IDSucursalAnterior, &m.SucursalAnterior, &m.IDSucursalNueva, &m.SucursalNueva,
+			&m.IDReasignacion, &m.IDAdmin, &fecha); err != nil {
+			return nil, err
+		}
+		if m.Fecha, err = reloj.LeerBD(fecha, zona); err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+	return ms, rows.Err()
+}
@@ -0,0 +1,157 @@
+package repositorio
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/reloj"
+)
+
+type reclamosMySQL struct {
+	db *sql.DB
+}
+
+func (r reclamosMySQL) Vinculado(ctx context.Context, idEmpresa int, idRemoto int64) (bool, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT (SELECT COUNT(*) FROM usuarios WHERE id_empresa = ? AND id_remoto = ?)
+		     + (SELECT COUNT(*) FROM tiendas WHERE id_empresa = ? AND id_remoto = ? AND estatus = 'activo')
+	`, idEmpresa, idRemoto, idEmpresa, idRemoto).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("buscando cuentas del cliente remoto %d: %w", idRemoto, err)
+	}
+	return n > 0, nil
+}
+
+func (r reclamosMySQL) Iniciar(ctx context.Context, re Reclamo, limite LimiteReclamos) (Reclamo, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Reclamo{}, fmt.Errorf("iniciando transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Cada reclamo empieza con los intentos del anterior, así que el mayor es
+	// el total gastado. Se bloquean para que dos registros a la vez no se
+	// salten el límite
+	var previos, intentos int
+	if err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*), IFNULL(MAX(intentos), 0) FROM reclamos_cliente
+		WHERE id_empresa = ? AND id_remoto = ? AND creado >= ?
+		FOR UPDATE
+	`, re.IDEmpresa, re.IDRemoto, reloj.ParaBD(limite.Desde)).Scan(&previos, &intentos); err != nil {
+		return Reclamo{}, fmt.Errorf("contando reclamos del cliente remoto %d: %w", re.IDRemoto, err)
+	}
+	if previos >= limite.Reclamos || intentos >= limite.Intentos {
+		return Reclamo{}, ErrReclamosAgotados
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE reclamos_cliente SET estatus = ?
+		WHERE id_empresa = ? AND id_remoto = ? AND estatus = ?
+	`, ReclamoReemplazado, re.IDEmpresa, re.IDRemoto, ReclamoPendiente); err != nil {
+		return Reclamo{}, fmt.Errorf("reemplazando reclamos pendientes: %w", err)
+	}
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO reclamos_cliente (
+			id_empresa, id_remoto, clave_remota, telefono, codigo_hash, registro, intentos, estatus, creado, vence
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, re.IDEmpresa, re.IDRemoto, re.ClaveRemota, re.Telefono, re.CodigoHash, string(re.Registro), intentos,
+		ReclamoPendiente, reloj.ParaBD(re.Creado), reloj.ParaBD(re.Vence))
+	if err != nil {
+		return Reclamo{}, fmt.Errorf("guardando reclamo: %w", err)
+	}
+	if re.ID, err = res.LastInsertId(); err != nil {
+		return Reclamo{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Reclamo{}, fmt.Errorf("confirmando reclamo: %w", err)
+	}
+	re.Intentos = intentos
+	re.Estatus = ReclamoPendiente
+	return re, nil
+}
+
+// reclamoPendiente bloquea el reclamo pendiente de la empresa hasta el
+// COMMIT; ErrReclamoVencido si no hay.
+func reclamoPendiente(ctx context.Context, tx *sql.Tx, idEmpresa int, id int64, zona *time.Location) (Reclamo, error) {
+	var re Reclamo
+	var registro, creado, vence string
+	err := tx.QueryRowContext(ctx, `
+		SELECT id_reclamo, id_empresa, id_remoto, clave_remota, telefono, codigo_hash, registro, intentos, estatus,
+		       DATE_FORMAT(creado, '%Y-%m-%d %H:%i:%s'), DATE_FORMAT(vence, '%Y-%m-%d %H:%i:%s')
+		FROM reclamos_cliente
+		WHERE id_empresa = ? AND id_reclamo = ? AND estatus = ?
+		FOR UPDATE
+	`, idEmpresa, id, ReclamoPendiente).Scan(&re.ID, &re.IDEmpresa, &re.IDRemoto, &re.ClaveRemota, &re.Telefono,
+		&re.CodigoHash, &registro, &re.Intentos, &re.Estatus, &creado, &vence)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Reclamo{}, ErrReclamoVencido
+	}
+	if err != nil {
+		return Reclamo{}, err
+	}
+	re.Registro = []byte(registro)
+	if re.Creado, err = reloj.LeerBD(creado, zona); err != nil {
+		return Reclamo{}, err
+	}
+	if re.Vence, err = reloj.LeerBD(vence, zona); err != nil {
+		return Reclamo{}, err
+	}
+	return re, nil
+}
+
+func (r reclamosMySQL) Intentar(ctx context.Context, idEmpresa int, id int64, ahora time.Time, maximo int) (Reclamo, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Reclamo{}, fmt.Errorf("iniciando transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	re, err := reclamoPendiente(ctx, tx, idEmpresa, id, ahora.Location())
+	if err != nil {
+		return Reclamo{}, err
+	}
+	if !ahora.Before(re.Vence) || re.Intentos >= maximo {
+		return Reclamo{}, ErrReclamoVencido
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE reclamos_cliente SET intentos = intentos + 1 WHERE id_reclamo = ?
+	`, id); err != nil {
+		return Reclamo{}, fmt.Errorf("contando intento del reclamo %d: %w", id, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return Reclamo{}, fmt.Errorf("confirmando intento: %w", err)
+	}
+	re.Intentos++
+	return re, nil
+}
+
+func (r reclamosMySQL) Confirmar(ctx context.Context, idEmpresa int, id int64, nu NuevoUsuario, nt NuevaTienda) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("iniciando transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := reclamoPendiente(ctx, tx, idEmpresa, id, time.UTC); err != nil {
+		return 0, err
+	}
+	idUsuario, err := insertarUsuario(ctx, tx, nu)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := insertarTienda(ctx, tx, idUsuario, nt); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE reclamos_cliente SET estatus = ?, id_usuario = ? WHERE id_reclamo = ?
+	`, ReclamoConfirmado, idUsuario, id); err != nil {
+		return 0, fmt.Errorf("confirmando reclamo %d: %w", id, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("confirmando registro: %w", err)
+	}
+	return idUsuario, nil
+}
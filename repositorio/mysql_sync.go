@@ -0,0 +1,121 @@
+package repositorio
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+type syncMySQL struct {
+	local  *sql.DB
+	remoto *sql.DB
+}
+
+func (s syncMySQL) BuscarClienteRemoto(ctx context.Context, idSucursal int, rfc, nombreComercial string) (ClienteExistente, error) {
+	for _, b := range []struct{ columna, valor string }{{"rfc", rfc}, {"nombre_comercial", nombreComercial}} {
+		if b.valor == "" {
+			continue
+		}
+		var c ClienteExistente
+		var clave, nombre, telefono sql.NullString
+		err := s.remoto.QueryRowContext(ctx, `
+			SELECT id_cliente, clave, nombre_comercial, tel_contacto FROM crm_clientes
+			WHERE idsucursal = ? AND `+b.columna+` = ? AND estatus = 'S'
+			ORDER BY id_cliente LIMIT 1
+		`, idSucursal, b.valor).Scan(&c.IDCliente, &clave, &nombre, &telefono)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return ClienteExistente{}, fmt.Errorf("error buscando cliente por %s: %w", b.columna, err)
+		}
+		c.Clave, c.NombreComercial, c.Telefono = clave.String, nombre.String, telefono.String
+		return c, nil
+	}
+	return ClienteExistente{}, ErrNoEncontrado
+}
+
+// CrearClienteRemoto rechaza el alta si ya hay un cliente activo con el mismo
+// RFC o nombre comercial en la sucursal; si no, toma el siguiente correlativo
+// de crm_indices e inserta en crm_clientes (nombre_comercial = nombre de la tienda).
+func (s syncMySQL) CrearClienteRemoto(ctx context.Context, c ClienteRemoto) (int64, error) {
+	if _, err := s.BuscarClienteRemoto(ctx, c.IDSucursal, c.RFC, c.NombreComercial); err == nil {
+		return 0, ErrClienteRemotoExistente
+	} else if !errors.Is(err, ErrNoEncontrado) {
+		return 0, err
+	}
+
+	// La colonia es el segmento de la dirección anterior al código postal
+	colonia := ""
+	partes := strings.Split(strings.ReplaceAll(c.Direccion, "\"", ""), ",")
+	for i := 1; i < len(partes); i++ {
+		if strings.HasPrefix(strings.TrimSpace(partes[i]), c.CodigoPostal) {
+			colonia = strings.TrimSpace(partes[i-1])
+			break
+		}
+	}
+
+	_, err := s.remoto.ExecContext(ctx, `
+		INSERT INTO crm_indices (idsucursal, idpedido, idcliente)
+		VALUES (?, 0, 1)
+		ON DUPLICATE KEY UPDATE idcliente = idcliente + 1
+	`, c.IDSucursal)
+	if err != nil {
+		return 0, fmt.Errorf("error actualizando/creando índice de cliente: %w", err)
+	}
+	var correlativo int64
+	err = s.remoto.QueryRowContext(ctx, `SELECT idcliente FROM crm_indices WHERE idsucursal = ?`, c.IDSucursal).Scan(&correlativo)
+	if err != nil {
+		return 0, fmt.Errorf("error obteniendo correlativo de cliente: %w", err)
+	}
+
+	claveMobile := fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintf("%d%s%s%d", time.Now().Unix(), c.Clave, c.NombreComercial, rand.Intn(10000)))))
+	res, err := s.remoto.ExecContext(ctx, `
+		INSERT INTO crm_clientes (
+			id_cliente, idsucursal, estatus, clave_mobile, nombre_comercial, razon_social, rfc, idcliente, tipo_cliente, lista_precio,
+			ofi_calle, ofi_num_ext, ofi_colonia, ofi_ciudad, ofi_estado, ofi_cod_postal, tel_contacto, clave
+		) VALUES (
+			0, ?, 'S', ?, ?, ?, ?, ?, 'C', 1,
+			?, ?, ?, ?, ?, ?, ?, ?
+		)
+	`, c.IDSucursal, claveMobile, c.NombreComercial, c.RazonSocial, c.RFC, correlativo,
+		c.Calle, c.Numero, colonia, c.Ciudad, c.Estado, c.CodigoPostal, c.Telefono, c.Clave)
+	if err != nil {
+		return 0, fmt.Errorf("error insertando cliente remoto: %w", err)
+	}
+	idCliente, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error obteniendo id_cliente insertado: %w", err)
+	}
+	return idCliente, nil
+}
+
+func (s syncMySQL) Pendientes(ctx context.Context) ([]int64, error) {
+	rows, err := s.local.QueryContext(ctx, `SELECT id_pedido FROM pedidos WHERE sincronizado = false OR sincronizado IS NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s syncMySQL) MarcarProcesando(ctx context.Context) (int64, error) {
+	res, err := s.local.ExecContext(ctx, `UPDATE pedidos SET estatus = 'procesando' WHERE sincronizado = true AND estatus = 'pendiente'`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,360 @@
+package repositorio
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/reloj"
+	"github.com/go-sql-driver/mysql"
+)
+
+// errLlaveDuplicada es el error de MySQL ER_DUP_ENTRY.
+const errLlaveDuplicada = 1062
+
+// ---------------------------
+// USUARIOS
+// ---------------------------
+
+type usuariosMySQL struct {
+	db *sql.DB
+}
+
+func (u usuariosMySQL) RegistrarConTienda(ctx context.Context, nu NuevoUsuario, nt NuevaTienda) (int64, error) {
+	tx, err := u.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("iniciando transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	idUsuario, err := insertarUsuario(ctx, tx, nu)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := insertarTienda(ctx, tx, idUsuario, nt); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("confirmando registro: %w", err)
+	}
+	return idUsuario, nil
+}
+
+// insertarUsuario da de alta el usuario activo y regresa su id_usuario;
+// ErrCorreoRegistrado si choca con uq_usuarios_empresa_correo.
+func insertarUsuario(ctx context.Context, tx *sql.Tx, nu NuevoUsuario) (int64, error) {
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO usuarios (
+			id_empresa, tipo_usuario, nombre_completo, correo, telefono, clave, clave_remota, fecha_registro, estatus, requiere_cambiar_clave, id_remoto
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, 'activo', false, ?)
+	`, nu.IDEmpresa, nu.TipoUsuario, nu.NombreCompleto, nu.Correo, nu.Telefono, nu.Clave, nu.ClaveRemota, reloj.ParaBD(nu.FechaRegistro), nu.IDRemoto)
+	var errMySQL *mysql.MySQLError
+	if errors.As(err, &errMySQL) && errMySQL.Number == errLlaveDuplicada {
+		return 0, ErrCorreoRegistrado
+	}
+	if err != nil {
+		return 0, fmt.Errorf("creando usuario: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// insertarTienda da de alta la tienda del usuario con su ubicación como
+// primera dirección de entrega y regresa el id_tienda.
+func insertarTienda(ctx context.Context, tx *sql.Tx, idUsuario int64, nt NuevaTienda) (int64, error) {
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO tiendas (
+			id_usuario, id_empresa, idsucursal, nombre_sucursal, nombre_tienda, razon_social, rfc, direccion, colonia, codigo_postal, ciudad, estado, pais, tipo_tienda, latitud, longitud, ubicacion, id_remoto, clave_remota, fecha_registro, ultima_actualizacion, estatus
+		) VALUES (
+			?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, POINT(?, ?), ?, ?, ?, ?, 'activo'
+		)
+	`,
+		idUsuario, nt.IDEmpresa, nt.IDSucursal, nt.NombreSucursal, nt.NombreTienda, nt.RazonSocial, nt.RFC,
+		nt.Direccion, nt.Colonia, nt.CodigoPostal, nt.Ciudad, nt.Estado, nt.Pais, nt.TipoTienda,
+		nt.Latitud, nt.Longitud,
+		nt.Longitud, // X
+		nt.Latitud,  // Y
+		sql.NullInt64{Int64: nt.IDRemoto, Valid: nt.IDRemoto != 0}, sql.NullString{String: nt.ClaveRemota, Valid: nt.ClaveRemota != ""},
+		reloj.ParaBD(nt.FechaRegistro), reloj.ParaBD(nt.FechaRegistro),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("creando tienda: %w", err)
+	}
+	idTienda, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	// La ubicación del registro es la primera dirección de entrega
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO direcciones_tienda (
+			id_empresa, id_tienda, alias, direccion, colonia, codigo_postal, ciudad, estado,
+			latitud, longitud, predeterminada, creada, actualizada
+		) VALUES (?, ?, 'Principal', ?, ?, ?, ?, ?, ?, ?, TRUE, ?, ?)
+	`,
+		nt.IDEmpresa, idTienda, nt.Direccion, nt.Colonia, nt.CodigoPostal, nt.Ciudad, nt.Estado,
+		nt.Latitud, nt.Longitud, reloj.ParaBD(nt.FechaRegistro), reloj.ParaBD(nt.FechaRegistro),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("creando dirección de entrega: %w", err)
+	}
+	return idTienda, nil
+}
+
+func (u usuariosMySQL) PorID(ctx context.Context, idUsuario int64) (Usuario, error) {
+	var us Usuario
+	var claveRemota sql.NullString
+	var idRemoto sql.NullInt64
+	err := u.db.QueryRowContext(ctx, `
+		SELECT id_usuario, id_empresa, tipo_usuario, nombre_completo, correo, telefono, estatus, clave_remota, id_remoto
+		FROM usuarios WHERE id_usuario = ?
+	`, idUsuario).Scan(&us.IDUsuario, &us.IDEmpresa, &us.TipoUsuario, &us.NombreCompleto, &us.Correo, &us.Telefono, &us.Estatus, &claveRemota, &idRemoto)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Usuario{}, ErrNoEncontrado
+	}
+	if err != nil {
+		return Usuario{}, err
+	}
+	us.ClaveRemota = claveRemota.String
+	us.IDRemoto = idRemoto.Int64
+	return us, nil
+}
+
+func (u usuariosMySQL) GuardarRefreshToken(ctx context.Context, t RefreshToken) error {
+	expiracion := reloj.ParaBD(t.Expiracion)
+	ultimoUso := reloj.ParaBD(t.UltimoUso)
+
+	var idToken int
+	err := u.db.QueryRowContext(ctx, `
+		SELECT id FROM refresh_tokens
+		WHERE usuario_id = ? AND tipo_usuario = ? AND estado = 'activo'
+		ORDER BY expiracion DESC LIMIT 1
+	`, t.IDUsuario, t.TipoUsuario).Scan(&idToken)
+	if errors.Is(err, sql.ErrNoRows) {
+		_, err = u.db.ExecContext(ctx, `
+			INSERT INTO refresh_tokens (usuario_id, tipo_usuario, token_hash, user_agent, ip_address, expiracion, ultimo_uso, estado)
+			VALUES (?, ?, ?, ?, ?, ?, ?, 'activo')
+		`, t.IDUsuario, t.TipoUsuario, t.Hash, t.UserAgent, t.IP, expiracion, ultimoUso)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	_, err = u.db.ExecContext(ctx, `
+		UPDATE refresh_tokens
+		SET token_hash = ?, user_agent = ?, ip_address = ?, expiracion = ?, ultimo_uso = ?, estado = 'activo'
+		WHERE id = ?
+	`, t.Hash, t.UserAgent, t.IP, expiracion, ultimoUso, idToken)
+	return err
+}
+
+// ---------------------------
+// TIENDAS
+// ---------------------------
+
+type tiendasMySQL struct {
+	db *sql.DB
+}
+
+// consultaTiendas lee las tiendas activas; se completa con el WHERE y
+// ordenTiendas. Una tienda sin cliente remoto propio usa el de su usuario.
+const consultaTiendas = `
+	SELECT t.id_tienda, IFNULL(t.idsucursal, 0), IFNULL(t.nombre_sucursal, ''), t.nombre_tienda, t.direccion, t.colonia,
+	       t.codigo_postal, t.ciudad, t.estado, t.pais, t.latitud, t.longitud,
+	       IFNULL(ST_Y(t.ubicacion), 0) AS latitud_ubic, IFNULL(ST_X(t.ubicacion), 0) AS longitud_ubic,
+	       COALESCE(t.id_remoto, u.id_remoto, 0), COALESCE(t.clave_remota, u.clave_remota, '')
+	FROM tiendas t
+	JOIN usuarios u ON u.id_usuario = t.id_usuario
+	WHERE t.estatus = 'activo'
+`
+
+// ordenTiendas pone primero la tienda activa del usuario y luego la más vieja.
+const ordenTiendas = `
+	ORDER BY t.id_tienda = IFNULL(u.id_tienda_activa, 0) DESC, t.id_tienda
+`
+
+func leerTienda(s interface{ Scan(...any) error }) (Tienda, error) {
+	var ti Tienda
+	var lat, lon, latUbic, lonUbic sql.NullFloat64
+	if err := s.Scan(
+		&ti.IDTienda, &ti.IDSucursal, &ti.NombreSucursal, &ti.NombreTienda, &ti.Direccion, &ti.Colonia,
+		&ti.CodigoPostal, &ti.Ciudad, &ti.Estado, &ti.Pais,
+		&lat, &lon, &latUbic, &lonUbic, &ti.IDRemoto, &ti.ClaveRemota,
+	); err != nil {
+		return Tienda{}, err
+	}
+	ti.Latitud = lat.Float64
+	ti.Longitud = lon.Float64
+	ti.LatitudUbic = latUbic.Float64
+	ti.LongitudUbic = lonUbic.Float64
+	return ti, nil
+}
+
+func (t tiendasMySQL) PorUsuario(ctx context.Context, idUsuario int64) (Tienda, error) {
+	ti, err := leerTienda(t.db.QueryRowContext(ctx, consultaTiendas+`
+		  AND t.id_usuario = ?
+	`+ordenTiendas+`
+		LIMIT 1
+	`, idUsuario))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Tienda{}, ErrNoEncontrado
+	}
+	return ti, err
+}
+
+func (t tiendasMySQL) DeUsuario(ctx context.Context, idUsuario int64) ([]Tienda, error) {
+	rows, err := t.db.QueryContext(ctx, consultaTiendas+`
+		  AND t.id_usuario = ?
+	`+ordenTiendas, idUsuario)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ts := []Tienda{}
+	for rows.Next() {
+		ti, err := leerTienda(rows)
+		if err != nil {
+			return nil, err
+		}
+		ts = append(ts, ti)
+	}
+	return ts, rows.Err()
+}
+
+func (t tiendasMySQL) Obtener(ctx context.Context, idEmpresa, idTienda int) (Tienda, error) {
+	ti, err := leerTienda(t.db.QueryRowContext(ctx, consultaTiendas+`
+		  AND t.id_empresa = ? AND t.id_tienda = ?
+	`, idEmpresa, idTienda))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Tienda{}, ErrNoEncontrado
+	}
+	return ti, err
+}
+
+func (t tiendasMySQL) Crear(ctx context.Context, idUsuario int64, nt NuevaTienda) (int, error) {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("iniciando transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	idTienda, err := insertarTienda(ctx, tx, idUsuario, nt)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("confirmando tienda: %w", err)
+	}
+	return int(idTienda), nil
+}
+
+func (t tiendasMySQL) Actualizar(ctx context.Context, idTienda int, nt NuevaTienda, idAdmin int, ahora time.Time) (*MovimientoSucursal, error) {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("iniciando transacción: %w", err)
+	}
+	defer tx.Rollback()
+
+	m := MovimientoSucursal{IDTienda: idTienda, IDSucursalNueva: nt.IDSucursal, SucursalNueva: nt.NombreSucursal, IDAdmin: idAdmin, Fecha: ahora}
+	err = tx.QueryRowContext(ctx, `
+		SELECT IFNULL(idsucursal, 0), IFNULL(nombre_sucursal, '') FROM tiendas
+		WHERE id_tienda = ? AND id_empresa = ? AND estatus = 'activo'
+		FOR UPDATE
+	`, idTienda, nt.IDEmpresa).Scan(&m.IDSucursalAnterior, &m.SucursalAnterior)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoEncontrado
+	}
+	if err != nil {
+		return nil, err
+	}
+	fecha := reloj.ParaBD(ahora)
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE tiendas
+		SET idsucursal = ?, nombre_sucursal = ?, nombre_tienda = ?, razon_social = ?, rfc = ?, direccion = ?, colonia = ?,
+		    codigo_postal = ?, ciudad = ?, estado = ?, pais = ?, tipo_tienda = ?, latitud = ?, longitud = ?,
+		    ubicacion = POINT(?, ?), ultima_actualizacion = ?
+		WHERE id_tienda = ?
+	`,
+		nt.IDSucursal, nt.NombreSucursal, nt.NombreTienda, nt.RazonSocial, nt.RFC, nt.Direccion, nt.Colonia,
+		nt.CodigoPostal, nt.Ciudad, nt.Estado, nt.Pais, nt.TipoTienda, nt.Latitud, nt.Longitud,
+		nt.Longitud, // X
+		nt.Latitud,  // Y
+		fecha, idTienda,
+	); err != nil {
+		return nil, fmt.Errorf("actualizando tienda %d: %w", idTienda, err)
+	}
+
+	var movimiento *MovimientoSucursal
+	if m.IDSucursalAnterior != m.IDSucursalNueva {
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO tiendas_movimientos (
+				id_empresa, id_tienda, idsucursal_anterior, sucursal_anterior, idsucursal_nueva, sucursal_nueva, id_admin, fecha
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, nt.IDEmpresa, idTienda, m.IDSucursalAnterior, m.SucursalAnterior, m.IDSucursalNueva, m.SucursalNueva,
+			sql.NullInt64{Int64: int64(idAdmin), Valid: idAdmin != 0}, fecha)
+		if err != nil {
+			return nil, fmt.Errorf("guardando movimiento de la tienda %d: %w", idTienda, err)
+		}
+		if m.ID, err = res.LastInsertId(); err != nil {
+			return nil, err
+		}
+		movimiento = &m
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("confirmando tienda: %w", err)
+	}
+	return movimiento, nil
+}
+
+func (t tiendasMySQL) Activar(ctx context.Context, idUsuario int64, idTienda int) error {
+	var n int
+	if err := t.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM tiendas WHERE id_tienda = ? AND id_usuario = ? AND estatus = 'activo'
+	`, idTienda, idUsuario).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoEncontrado
+	}
+	_, err := t.db.ExecContext(ctx, `
+		UPDATE usuarios SET id_tienda_activa = ? WHERE id_usuario = ?
+	`, idTienda, idUsuario)
+	return err
+}
+
+func (t tiendasMySQL) Duenio(ctx context.Context, idEmpresa, idTienda int) (int, error) {
+	var idUsuario int
+	err := t.db.QueryRowContext(ctx, `
+		SELECT id_usuario FROM tiendas
+		WHERE id_empresa = ? AND id_tienda = ? AND estatus = 'activo'
+	`, idEmpresa, idTienda).Scan(&idUsuario)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNoEncontrado
+	}
+	return idUsuario, err
+}
+
+func (t tiendasMySQL) Ubicaciones(ctx context.Context, idEmpresa int) ([]UbicacionTienda, error) {
+	rows, err := t.db.QueryContext(ctx, `
+		SELECT id_tienda, nombre_tienda, IFNULL(idsucursal, 0), IFNULL(nombre_sucursal, ''),
+		       IFNULL(latitud, ST_Y(ubicacion)), IFNULL(longitud, ST_X(ubicacion))
+		FROM tiendas
+		WHERE id_empresa = ? AND estatus = 'activo'
+		  AND (latitud IS NOT NULL AND longitud IS NOT NULL OR ubicacion IS NOT NULL)
+		ORDER BY id_tienda
+	`, idEmpresa)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var us []UbicacionTienda
+	for rows.Next() {
+		var u UbicacionTienda
+		if err := rows.Scan(&u.IDTienda, &u.NombreTienda, &u.IDSucursal, &u.NombreSucursal, &u.Punto.Lat, &u.Punto.Lng); err != nil {
+			return nil, err
+		}
+		us = append(us, u)
+	}
+	return us, rows.Err()
+}
@@ -0,0 +1,625 @@
+// Package repositorio separa el acceso a datos de los handlers HTTP. Cada
+// agregado tiene su interfaz (empresas, pedidos, productos, usuarios, tiendas,
+// sucursales, horarios de entrega, reasignación de tiendas, direcciones de
+// entrega, reclamos de clientes del ERP y la sincronización con el ERP), una
+// implementación MySQL sobre
+// *db.DBConnection y una implementación en memoria para pruebas.
+package repositorio
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/feriados"
+	"github.com/WolfSlayer04/logica_tiendaenlina/geocerca"
+)
+
+// ErrNoEncontrado indica que el registro pedido no existe.
+var ErrNoEncontrado = errors.New("registro no encontrado")
+
+// ErrSinCapacidad indica que el horario de entrega ya está lleno.
+var ErrSinCapacidad = errors.New("horario de entrega sin capacidad")
+
+// ErrReservaVencida indica que el apartado del horario no existe, venció o ya
+// se usó en otro pedido.
+var ErrReservaVencida = errors.New("reserva de horario vencida")
+
+// ErrReasignacionResuelta indica que la reasignación ya se aplicó, se
+// descartó o la reemplazó otra.
+var ErrReasignacionResuelta = errors.New("reasignación ya resuelta")
+
+// ErrClienteRemotoExistente indica que la sucursal ya tiene en el ERP un
+// cliente activo con el mismo RFC o nombre comercial.
+var ErrClienteRemotoExistente = errors.New("ya existe un cliente remoto con este RFC o nombre comercial")
+
+// ErrReclamoVencido indica que el reclamo no existe, venció, ya se usó, lo
+// reemplazó otro o se le acabaron los intentos.
+var ErrReclamoVencido = errors.New("reclamo de cliente vencido")
+
+// ErrReclamosAgotados indica que el cliente remoto ya tuvo todos los reclamos
+// que se le permiten en la ventana de tiempo.
+var ErrReclamosAgotados = errors.New("demasiados reclamos del cliente remoto")
+
+// ErrCorreoRegistrado indica que la empresa ya tiene un usuario con el correo.
+var ErrCorreoRegistrado = errors.New("correo ya registrado en la empresa")
+
+// PedidoRepo guarda y consulta pedidos de la base local.
+type PedidoRepo interface {
+	// Crear inserta el pedido con sus detalles, confirma su reserva de horario
+	// (si trae) y acumula los indicadores diarios/mensuales en una sola
+	// transacción. Regresa el id_pedido o ErrReservaVencida.
+	Crear(ctx context.Context, p *NuevoPedido) (int64, error)
+	// Totales regresa los importes del pedido de la empresa o ErrNoEncontrado.
+	Totales(ctx context.Context, idEmpresa int, idPedido int64) (TotalesPedido, error)
+	// AplicarDescuento fija el descuento global y el total ya recalculado del
+	// pedido de la empresa.
+	AplicarDescuento(ctx context.Context, idEmpresa int, idPedido int64, descuento, total float64) error
+}
+
+// ProductoRepo consulta el catálogo de productos.
+type ProductoRepo interface {
+	// Impuestos regresa los porcentajes de IVA e IEPS del producto de la
+	// empresa o ErrNoEncontrado.
+	Impuestos(ctx context.Context, idEmpresa int, idProducto int64) (Impuestos, error)
+	// Pesos regresa el peso en kg de los productos de la empresa que lo
+	// tienen capturado; los demás no vienen en el mapa.
+	Pesos(ctx context.Context, idEmpresa int, idsProducto []int64) (map[int64]float64, error)
+	// Categorias regresa el idcategoria de los productos de la empresa que
+	// tienen una; los demás no vienen en el mapa.
+	Categorias(ctx context.Context, idEmpresa int, idsProducto []int64) (map[int64]int, error)
+}
+
+// UsuarioRepo guarda usuarios (clientes) y sus sesiones.
+type UsuarioRepo interface {
+	// RegistrarConTienda crea el usuario y su tienda en una transacción y
+	// regresa el id_usuario; ErrCorreoRegistrado si el correo ya es de otro
+	// usuario de la empresa.
+	RegistrarConTienda(ctx context.Context, u NuevoUsuario, t NuevaTienda) (int64, error)
+	// PorID regresa el usuario o ErrNoEncontrado.
+	PorID(ctx context.Context, idUsuario int64) (Usuario, error)
+	// GuardarRefreshToken actualiza la sesión activa del usuario o crea una nueva.
+	GuardarRefreshToken(ctx context.Context, t RefreshToken) error
+}
+
+// TiendaRepo consulta las tiendas de los usuarios.
+type TiendaRepo interface {
+	// PorUsuario regresa la tienda activa del usuario (la que marcó con
+	// Activar o, si no marcó ninguna, la primera) o ErrNoEncontrado.
+	PorUsuario(ctx context.Context, idUsuario int64) (Tienda, error)
+	// DeUsuario regresa las tiendas activas del usuario, la activa primero.
+	DeUsuario(ctx context.Context, idUsuario int64) ([]Tienda, error)
+	// Obtener regresa la tienda activa de la empresa o ErrNoEncontrado.
+	Obtener(ctx context.Context, idEmpresa, idTienda int) (Tienda, error)
+	// Crear agrega una tienda a un usuario que ya existe, con su ubicación
+	// como dirección de entrega predeterminada, y regresa el id_tienda.
+	Crear(ctx context.Context, idUsuario int64, t NuevaTienda) (int, error)
+	// Actualizar reemplaza los datos de la tienda con los de t (menos
+	// FechaRegistro y el cliente remoto); ErrNoEncontrado si no es de la
+	// empresa. Si cambia de sucursal lo guarda en tiendas_movimientos y
+	// regresa el movimiento; si no, nil.
+	Actualizar(ctx context.Context, idTienda int, t NuevaTienda, idAdmin int, ahora time.Time) (*MovimientoSucursal, error)
+	// Activar marca la tienda como la activa del usuario; ErrNoEncontrado si
+	// no es una tienda activa suya.
+	Activar(ctx context.Context, idUsuario int64, idTienda int) error
+	// Ubicaciones regresa las tiendas activas de la empresa que tienen
+	// ubicación, con la sucursal que tienen asignada.
+	Ubicaciones(ctx context.Context, idEmpresa int) ([]UbicacionTienda, error)
+	// Duenio regresa el id_usuario de la tienda activa de la empresa o
+	// ErrNoEncontrado.
+	Duenio(ctx context.Context, idEmpresa, idTienda int) (int, error)
+}
+
+// DireccionRepo guarda la libreta de direcciones de entrega de cada tienda
+// (direcciones_tienda). Si una tienda tiene direcciones, exactamente una es
+// la predeterminada.
+type DireccionRepo interface {
+	// Listar regresa las direcciones de la tienda, la predeterminada primero y
+	// luego de la más vieja a la más nueva.
+	Listar(ctx context.Context, idEmpresa, idTienda int) ([]Direccion, error)
+	// Obtener regresa la dirección de la tienda o ErrNoEncontrado.
+	Obtener(ctx context.Context, idEmpresa, idTienda int, id int64) (Direccion, error)
+	// Guardar crea la dirección (ID 0) o reemplaza sus datos; ErrNoEncontrado
+	// si no es de la tienda. Si es predeterminada, o la primera de la tienda,
+	// las demás dejan de serlo; la predeterminada no deja de serlo por
+	// guardarla con Predeterminada en false. Regresa el id.
+	Guardar(ctx context.Context, d Direccion, ahora time.Time) (int64, error)
+	// Eliminar da de baja la dirección de la tienda; si era la
+	// predeterminada, pasa a serlo la más vieja que quede. ErrNoEncontrado si
+	// no es de la tienda.
+	Eliminar(ctx context.Context, idEmpresa, idTienda int, id int64, ahora time.Time) error
+}
+
+// EmpresaRepo resuelve a qué empresa del grupo va una petición (adm_empresas,
+// empresa_dominios).
+type EmpresaRepo interface {
+	// Activa regresa ErrNoEncontrado si la empresa no existe o está inactiva.
+	Activa(ctx context.Context, idEmpresa int) error
+	// PorDominio regresa la empresa activa asignada al host o ErrNoEncontrado.
+	PorDominio(ctx context.Context, dominio string) (int, error)
+	// Unica regresa la empresa activa cuando sólo hay una; si no hay ninguna o
+	// hay varias regresa ErrNoEncontrado.
+	Unica(ctx context.Context) (int, error)
+	// Activas regresa las empresas activas en orden.
+	Activas(ctx context.Context) ([]int, error)
+}
+
+// SucursalRepo consulta las sucursales (adm_sucursales) y la configuración de
+// entregas de cada empresa.
+type SucursalRepo interface {
+	// PrimeraActiva regresa la primera sucursal activa de la empresa.
+	PrimeraActiva(ctx context.Context, idEmpresa int) (int, error)
+	// DeEmpresa regresa ErrNoEncontrado si la sucursal no es de la empresa.
+	DeEmpresa(ctx context.Context, idEmpresa, idSucursal int) error
+	// PorUbicacion asigna la sucursal más cercana que cubre el punto o, si
+	// ninguna lo cubre, la más cercana.
+	PorUbicacion(ctx context.Context, idEmpresa int, lat, lng float64) (SucursalAsignada, error)
+	// ConfigEntrega regresa los JSON de configuración de entregas guardados
+	// para la empresa y para la sucursal (config_entrega); nil el que no
+	// exista. Con idSucursal 0 sólo se busca el de la empresa.
+	ConfigEntrega(ctx context.Context, idEmpresa, idSucursal int) (empresa, sucursal []byte, err error)
+	// Feriados regresa los feriados guardados para la empresa (dias_feriados)
+	// y, con idSucursal distinto de 0, los de esa sucursal antes que los de la
+	// empresa.
+	Feriados(ctx context.Context, idEmpresa, idSucursal int) ([]feriados.Feriado, error)
+	// Coberturas regresa la geocerca de cada sucursal activa de la empresa,
+	// también las que no tienen cobertura (tipo N).
+	Coberturas(ctx context.Context, idEmpresa int) ([]geocerca.Cobertura, error)
+	// Cobertura regresa la geocerca de una sucursal de la empresa, activa o
+	// no, o ErrNoEncontrado.
+	Cobertura(ctx context.Context, idEmpresa, idSucursal int) (geocerca.Cobertura, error)
+	// GuardarCobertura reemplaza el tipo, el radio y los puntos de la
+	// geocerca; ErrNoEncontrado si la sucursal no es de la empresa.
+	GuardarCobertura(ctx context.Context, idEmpresa, idSucursal int, g geocerca.Geocerca) error
+}
+
+// EntregaRepo lleva la ocupación de los horarios de entrega de cada sucursal
+// (reservas_entrega). Un lugar ocupado es un pedido confirmado o un apartado
+// que no ha vencido en ahora.
+type EntregaRepo interface {
+	// Ocupacion regresa lo ocupado por horario entre las fechas desde y hasta
+	// ("YYYY-MM-DD", inclusive). Los horarios vacíos no vienen en el mapa.
+	Ocupacion(ctx context.Context, idEmpresa, idSucursal int, desde, hasta string, ahora time.Time) (map[Horario]Ocupacion, error)
+	// Apartar guarda el apartado si el horario todavía lo admite con limite;
+	// si no, regresa ErrSinCapacidad. Regresa el id_reserva.
+	Apartar(ctx context.Context, r Reserva, limite Capacidad, ahora time.Time) (int64, error)
+	// Vigente regresa el apartado de la empresa que no ha vencido ni se ha
+	// confirmado, o ErrReservaVencida.
+	Vigente(ctx context.Context, idEmpresa int, idReserva int64, ahora time.Time) (Reserva, error)
+	// Liberar borra el apartado sin confirmar del usuario; ErrNoEncontrado si
+	// no hay.
+	Liberar(ctx context.Context, idEmpresa, idUsuario int, idReserva int64) error
+}
+
+// SyncRepo agrupa lo que el servicio escribe en el ERP (base remota) y el
+// estado de sincronización de los pedidos locales.
+type SyncRepo interface {
+	// CrearClienteRemoto da de alta el cliente en crm_clientes y regresa su
+	// id_cliente; ErrClienteRemotoExistente si BuscarClienteRemoto lo
+	// encuentra.
+	CrearClienteRemoto(ctx context.Context, c ClienteRemoto) (int64, error)
+	// BuscarClienteRemoto regresa el cliente activo de la sucursal con el RFC
+	// o, si no hay, con el nombre comercial (vacíos no se buscan), o
+	// ErrNoEncontrado.
+	BuscarClienteRemoto(ctx context.Context, idSucursal int, rfc, nombreComercial string) (ClienteExistente, error)
+	// Pendientes regresa los pedidos locales que no se han enviado al ERP.
+	Pendientes(ctx context.Context) ([]int64, error)
+	// MarcarProcesando pasa a 'procesando' los pedidos ya sincronizados que
+	// seguían 'pendiente' y regresa cuántos cambiaron.
+	MarcarProcesando(ctx context.Context) (int64, error)
+}
+
+// ReasignacionRepo guarda los reportes de tiendas que las geocercas vigentes
+// asignan a otra sucursal (reasignaciones) y los cambios de sucursal de cada
+// tienda (tiendas_movimientos).
+type ReasignacionRepo interface {
+	// Guardar deja como reemplazada la reasignación pendiente de la empresa
+	// y, si r trae tiendas, guarda r como la nueva pendiente. Regresa su id, o
+	// 0 si no trae tiendas.
+	Guardar(ctx context.Context, r Reasignacion) (int64, error)
+	// Pendiente regresa la reasignación pendiente de la empresa, con sus
+	// tiendas, o ErrNoEncontrado.
+	Pendiente(ctx context.Context, idEmpresa int) (Reasignacion, error)
+	// Obtener regresa la reasignación de la empresa con sus tiendas, o
+	// ErrNoEncontrado.
+	Obtener(ctx context.Context, idEmpresa int, id int64) (Reasignacion, error)
+	// Listar regresa las últimas reasignaciones de la empresa, de la más
+	// nueva a la más vieja, sin sus tiendas.
+	Listar(ctx context.Context, idEmpresa, limite int) ([]Reasignacion, error)
+	// Aplicar mueve a su nueva sucursal las tiendas de la reasignación
+	// pendiente (todas si idTiendas es nil) y la deja aplicada. Una tienda que
+	// ya no está en la sucursal anterior se salta. Regresa los movimientos
+	// hechos; ErrNoEncontrado o ErrReasignacionResuelta.
+	Aplicar(ctx context.Context, idEmpresa int, id int64, idTiendas []int, idAdmin int, ahora time.Time) ([]MovimientoSucursal, error)
+	// Descartar deja la reasignación pendiente como descartada, sin mover
+	// tiendas; ErrNoEncontrado o ErrReasignacionResuelta.
+	Descartar(ctx context.Context, idEmpresa int, id int64, idAdmin int, ahora time.Time) error
+	// Movimientos regresa los cambios de sucursal de la tienda, del más nuevo
+	// al más viejo.
+	Movimientos(ctx context.Context, idEmpresa, idTienda int) ([]MovimientoSucursal, error)
+}
+
+// ReclamoRepo guarda los reclamos de clientes del ERP (reclamos_cliente):
+// quien se registra con el RFC o el nombre comercial de un cliente que ya
+// existe en crm_clientes recibe un código en el teléfono de ese cliente y, al
+// confirmarlo, su cuenta queda ligada a él en vez de crear otro.
+type ReclamoRepo interface {
+	// Vinculado dice si un usuario o una tienda activa de la empresa ya está
+	// ligado al cliente remoto.
+	Vinculado(ctx context.Context, idEmpresa int, idRemoto int64) (bool, error)
+	// Iniciar guarda el reclamo pendiente, reemplaza el que hubiera para el
+	// mismo cliente remoto y lo regresa con su id. El nuevo empieza con los
+	// intentos que ya gastó el cliente en los reclamos creados desde
+	// limite.Desde, para que volver a registrarse no reponga intentos; si ya
+	// son limite.Reclamos reclamos o limite.Intentos intentos regresa
+	// ErrReclamosAgotados.
+	Iniciar(ctx context.Context, r Reclamo, limite LimiteReclamos) (Reclamo, error)
+	// Intentar gasta un intento del reclamo pendiente de la empresa y lo
+	// regresa; ErrReclamoVencido si ya venció en ahora o ya gastó maximo.
+	Intentar(ctx context.Context, idEmpresa int, id int64, ahora time.Time, maximo int) (Reclamo, error)
+	// Confirmar deja el reclamo como confirmado y registra al usuario con su
+	// tienda (como RegistrarConTienda) en una transacción; ErrReclamoVencido
+	// si ya no está pendiente. Regresa el id_usuario.
+	Confirmar(ctx context.Context, idEmpresa int, id int64, u NuevoUsuario, t NuevaTienda) (int64, error)
+}
+
+// Repositorios agrupa una implementación de cada repositorio.
+type Repositorios struct {
+	Empresas       EmpresaRepo
+	Pedidos        PedidoRepo
+	Productos      ProductoRepo
+	Usuarios       UsuarioRepo
+	Tiendas        TiendaRepo
+	Sucursales     SucursalRepo
+	Entregas       EntregaRepo
+	Sync           SyncRepo
+	Reasignaciones ReasignacionRepo
+	Direcciones    DireccionRepo
+	Reclamos       ReclamoRepo
+}
+
+// NuevoPedido es la cabecera de un pedido con sus renglones ya calculados.
+// FechaCreacion va en la zona del negocio, de la que salen el día y el mes de
+// los indicadores, y se guarda en UTC; FechaEntrega es el horario prometido y
+// se guarda en hora local.
+type NuevoPedido struct {
+	IDEmpresa        int
+	ClaveUnica       string
+	IDUsuario        int
+	IDTienda         int
+	IDSucursal       int
+	FechaCreacion    time.Time
+	FechaEntrega     sql.NullTime
+	Subtotal         float64
+	Descuento        float64
+	IVA              float64
+	IEPS             float64
+	Total            float64
+	IDMetodoPago     int
+	ReferenciaPago   sql.NullString
+	DireccionEntrega string
+	ColoniaEntrega   string
+	CPEntrega        string
+	CiudadEntrega    string
+	EstadoEntrega    string
+	LatitudEntrega   *float64
+	LongitudEntrega  *float64
+	Estatus          string
+	Comentarios      sql.NullString
+	OrigenPedido     string
+	IDListaPrecio    int
+	// IDReserva es el apartado del horario que se confirma con el pedido
+	// (0 si no trae) y Peso el total en kg con el que queda confirmado.
+	IDReserva int64
+	Peso      float64
+	// ExplicacionEntrega es cómo se llegó a la fecha de entrega.
+	ExplicacionEntrega string
+	// IDDireccion es la dirección de la libreta a la que se entrega (0 si
+	// el pedido trae la dirección escrita).
+	IDDireccion int64
+	Detalles    []NuevoDetalle
+}
+
+// NuevoDetalle es un renglón de detalle_pedidos.
+type NuevoDetalle struct {
+	IDProducto          int64
+	ClaveProducto       string
+	Descripcion         string
+	Unidad              string
+	Cantidad            float64
+	PrecioUnitario      float64
+	PorcentajeDescuento float64
+	ImporteDescuento    float64
+	Subtotal            float64
+	ImporteIVA          float64
+	ImporteIEPS         float64
+	Total               float64
+	LatitudEntrega      *float64
+	LongitudEntrega     *float64
+	Estatus             string
+	Comentarios         string
+}
+
+// TotalesPedido son los importes de la cabecera de un pedido.
+type TotalesPedido struct {
+	Subtotal  float64
+	Descuento float64
+	IVA       float64
+	IEPS      float64
+	Total     float64
+}
+
+// Impuestos son los porcentajes que aplican a un producto (IEPS ya sumado).
+type Impuestos struct {
+	IVA  float64
+	IEPS float64
+}
+
+// Horario identifica un horario de entrega de un día: la fecha
+// ("YYYY-MM-DD") y la hora de inicio ("HH:MM").
+type Horario struct {
+	Fecha  string
+	Inicio string
+}
+
+// Ocupacion es lo que ya está comprometido en un horario.
+type Ocupacion struct {
+	Pedidos int
+	Peso    float64
+}
+
+// Capacidad es el límite de un horario; 0 en un campo es sin límite.
+type Capacidad struct {
+	Pedidos int
+	Peso    float64
+}
+
+// Admite indica si cabe un pedido más de peso kg sobre lo ocupado.
+func (c Capacidad) Admite(o Ocupacion, peso float64) bool {
+	if c.Pedidos > 0 && o.Pedidos+1 > c.Pedidos {
+		return false
+	}
+	return c.Peso <= 0 || o.Peso+peso <= c.Peso
+}
+
+// Reserva es un lugar en un horario de entrega. Mientras IDPedido es 0 es un
+// apartado que vence en Expira.
+type Reserva struct {
+	IDReserva  int64
+	IDEmpresa  int
+	IDSucursal int
+	IDUsuario  int
+	Horario    Horario
+	Peso       float64
+	IDPedido   int64
+	Expira     time.Time
+}
+
+// NuevoUsuario es un cliente por registrar; Clave ya viene encriptada.
+type NuevoUsuario struct {
+	IDEmpresa      int
+	TipoUsuario    string
+	NombreCompleto string
+	Correo         string
+	Telefono       string
+	Clave          string
+	ClaveRemota    string
+	IDRemoto       int64
+	FechaRegistro  time.Time
+}
+
+// Usuario es el cliente tal como se regresa en el login.
+type Usuario struct {
+	IDUsuario      int64
+	IDEmpresa      int
+	TipoUsuario    string
+	NombreCompleto string
+	Correo         string
+	Telefono       string
+	Estatus        string
+	ClaveRemota    string
+	IDRemoto       int64
+}
+
+// NuevaTienda es la tienda que se registra junto con el usuario o que se le
+// agrega después. IDRemoto y ClaveRemota son su cliente en crm_clientes.
+type NuevaTienda struct {
+	IDEmpresa      int
+	IDSucursal     int
+	NombreSucursal string
+	NombreTienda   string
+	RazonSocial    string
+	RFC            string
+	Direccion      string
+	Colonia        string
+	CodigoPostal   string
+	Ciudad         string
+	Estado         string
+	Pais           string
+	TipoTienda     string
+	Latitud        float64
+	Longitud       float64
+	IDRemoto       int64
+	ClaveRemota    string
+	FechaRegistro  time.Time
+}
+
+// Tienda es la tienda de un usuario tal como se regresa en el login.
+type Tienda struct {
+	IDTienda       int
+	IDSucursal     int
+	NombreSucursal string
+	NombreTienda   string
+	Direccion      string
+	Colonia        string
+	CodigoPostal   string
+	Ciudad         string
+	Estado         string
+	Pais           string
+	Latitud        float64
+	Longitud       float64
+	LatitudUbic    float64
+	LongitudUbic   float64
+	IDRemoto       int64
+	ClaveRemota    string
+}
+
+// UbicacionTienda es dónde está una tienda y qué sucursal la atiende.
+type UbicacionTienda struct {
+	IDTienda       int
+	NombreTienda   string
+	IDSucursal     int
+	NombreSucursal string
+	Punto          geocerca.Punto
+}
+
+// Direccion es una dirección de entrega de la libreta de una tienda.
+type Direccion struct {
+	ID             int64
+	IDEmpresa      int
+	IDTienda       int
+	Alias          string
+	Direccion      string
+	Colonia        string
+	CodigoPostal   string
+	Ciudad         string
+	Estado         string
+	Referencias    string
+	Latitud        float64
+	Longitud       float64
+	Predeterminada bool
+	Creada         time.Time
+	Actualizada    time.Time
+}
+
+// SucursalAsignada es la sucursal que atiende una ubicación.
+// EnCobertura dice si su geocerca cubre la ubicación; si no, es la de orilla
+// más cercana. Las distancias son en km desde la ubicación.
+type SucursalAsignada struct {
+	IDSucursal       int
+	Nombre           string
+	EnCobertura      bool
+	DistanciaKm      float64 // al centro de la geocerca
+	DistanciaBordeKm float64 // a la orilla, esté dentro o fuera
+}
+
+// RefreshToken es la sesión que se guarda en refresh_tokens. Hash es el bcrypt
+// del token; las fechas se guardan en UTC.
+type RefreshToken struct {
+	IDUsuario   int
+	TipoUsuario string
+	Hash        string
+	UserAgent   string
+	IP          string
+	Expiracion  time.Time
+	UltimoUso   time.Time
+}
+
+// ClienteRemoto son los datos con los que se da de alta un cliente en el ERP.
+type ClienteRemoto struct {
+	IDSucursal      int
+	Clave           string
+	NombreComercial string
+	RazonSocial     string
+	RFC             string
+	Direccion       string
+	Calle           string
+	Numero          string
+	Ciudad          string
+	Estado          string
+	CodigoPostal    string
+	Telefono        string
+}
+
+// ClienteExistente es un cliente que ya está en crm_clientes.
+type ClienteExistente struct {
+	IDCliente       int64
+	Clave           string
+	NombreComercial string
+	Telefono        string
+}
+
+// Estatus de un reclamo.
+const (
+	ReclamoPendiente   = "pendiente"
+	ReclamoConfirmado  = "confirmado"
+	ReclamoReemplazado = "reemplazado"
+)
+
+// LimiteReclamos es lo que se permite a un cliente remoto desde Desde: los
+// reclamos que se le crean y los intentos que gastan entre todos.
+type LimiteReclamos struct {
+	Desde    time.Time
+	Reclamos int
+	Intentos int
+}
+
+// Reclamo es un intento de ligar una cuenta nueva a un cliente del ERP.
+// Registro es la petición de alta (la arma y la lee quien llama) y
+// CodigoHash, el código que se mandó a Telefono, encriptado.
+type Reclamo struct {
+	ID          int64
+	IDEmpresa   int
+	IDRemoto    int64
+	ClaveRemota string
+	Telefono    string
+	CodigoHash  string
+	Registro    []byte
+	Intentos    int
+	Estatus     string
+	Creado      time.Time
+	Vence       time.Time
+}
+
+// Estatus de una reasignación.
+const (
+	ReasignacionPendiente   = "pendiente"
+	ReasignacionAplicada    = "aplicada"
+	ReasignacionDescartada  = "descartada"
+	ReasignacionReemplazada = "reemplazada"
+)
+
+// Reasignacion es un reporte de las tiendas a las que las geocercas vigentes
+// asignan otra sucursal. Origen dice qué la generó ("cobertura", "manual" o
+// "programada"); IDAdmin es quien la aplicó o descartó.
+type Reasignacion struct {
+	ID        int64
+	IDEmpresa int
+	Estatus   string
+	Origen    string
+	Creada    time.Time
+	Resuelta  time.Time
+	IDAdmin   int
+	// NumTiendas viene también en Listar, que no trae Tiendas.
+	NumTiendas int
+	Tiendas    []TiendaReasignada
+}
+
+// TiendaReasignada es una tienda del reporte: la sucursal que tiene y la que
+// le toca. EnCobertura es falso si ninguna geocerca la cubre y la nueva es
+// sólo la más cercana.
+type TiendaReasignada struct {
+	IDTienda           int
+	NombreTienda       string
+	IDSucursalAnterior int
+	SucursalAnterior   string
+	IDSucursalNueva    int
+	SucursalNueva      string
+	EnCobertura        bool
+	Aplicada           bool
+}
+
+// MovimientoSucursal es un cambio de sucursal de una tienda.
+// IDReasignacion es 0 si no vino de una reasignación.
+type MovimientoSucursal struct {
+	ID                 int64
+	IDTienda           int
+	IDSucursalAnterior int
+	SucursalAnterior   string
+	IDSucursalNueva    int
+	SucursalNueva      string
+	IDReasignacion     int64
+	IDAdmin            int
+	Fecha              time.Time
+}
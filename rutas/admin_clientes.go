@@ -5,6 +5,8 @@ import (
 	
 	"net/http"
 	"github.com/WolfSlayer04/logica_tiendaenlina/db"
+	"github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
 )
 
 // --- Estructuras locales para respuesta compuesta ---
@@ -58,6 +60,10 @@ type AdminClienteResponse struct {
 
 func GetAllUsuariosConTienda(dbc *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
 		query := `
 			SELECT
 				u.id_usuario, u.id_empresa, u.tipo_usuario, u.nombre_completo, u.correo, u.telefono, u.clave, 
@@ -67,10 +73,11 @@ func GetAllUsuariosConTienda(dbc *db.DBConnection) http.HandlerFunc {
 				CAST(t.fecha_registro AS CHAR), CAST(t.ultima_actualizacion AS CHAR), t.estatus
 			FROM usuarios u
 			LEFT JOIN tiendas t ON u.id_usuario = t.id_usuario
+			WHERE u.id_empresa = ?
 		`
-		rows, err := dbc.Local.Query(query)
+		rows, err := dbc.Local.QueryContext(r.Context(), query, idEmpresa)
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "Error consultando usuarios", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error consultando usuarios", err))
 			return
 		}
 		defer rows.Close()
@@ -87,7 +94,7 @@ func GetAllUsuariosConTienda(dbc *db.DBConnection) http.HandlerFunc {
 				&row.FechaRegTienda, &row.UltimaActualizacion, &row.EstatusTienda,
 			)
 			if err != nil {
-				writeErrorResponse(w, http.StatusInternalServerError, "Error leyendo fila", err.Error())
+				errores.Escribir(w, r, errores.Interno("Error leyendo fila", err))
 				return
 			}
 
@@ -1,153 +1,222 @@
 package rutas
 
 import (
-	"database/sql"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
+	"strconv"
+
 	"github.com/WolfSlayer04/logica_tiendaenlina/db"
+	"github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+	"github.com/WolfSlayer04/logica_tiendaenlina/feriados"
+	"github.com/WolfSlayer04/logica_tiendaenlina/repositorio"
+	"github.com/WolfSlayer04/logica_tiendaenlina/validacion"
 )
 
 // ConfigEntrega representa la estructura JSON de configuración de entregas
 type ConfigEntrega struct {
-	DiasHabiles        []string `json:"dias_habiles"`
-	TiempoProcesamiento int     `json:"tiempo_procesamiento"`
-	ReglasFindeSemana  struct {
-		ProcesarSabado       bool `json:"procesar_sabado"`
-		ProcesarDomingo      bool `json:"procesar_domingo"`
-		DiasAdicionalesSabado int  `json:"dias_adicionales_sabado"`
-		DiasAdicionalesDomingo int `json:"dias_adicionales_domingo"`
-	} `json:"reglas_fin_semana"`
-	HorariosEntrega []struct {
-		Etiqueta string `json:"etiqueta"`
-		Inicio   string `json:"inicio"`
-		Fin      string `json:"fin"`
-	} `json:"horarios_entrega"`
-	DiasFeriados []struct {
-		Fecha          string `json:"fecha"`
-		DiasAdicionales int   `json:"dias_adicionales"`
-	} `json:"dias_feriados"`
+	DiasHabiles         []string         `json:"dias_habiles" valida:"requerido"`
+	TiempoProcesamiento int              `json:"tiempo_procesamiento" valida:"no_negativo"`
+	ReglasFindeSemana   ReglasFinSemana  `json:"reglas_fin_semana"`
+	HorariosEntrega     []HorarioEntrega `json:"horarios_entrega"`
+	DiasFeriados        []DiaFeriado     `json:"dias_feriados"`
+	// FeriadosOficiales aplica los días de descanso obligatorio de la ley
+	// además de los del calendario propio; sin valor es true.
+	FeriadosOficiales *bool `json:"feriados_oficiales,omitempty"`
+	// HoraCorte (HH:MM) es la hora desde la que un pedido cuenta como hecho
+	// el día siguiente; vacía, sin corte.
+	HoraCorte string `json:"hora_corte,omitempty" valida:"hora"`
+	// MismoDiaAntesDe (HH:MM): un pedido hecho antes de esa hora en un día
+	// de entrega se entrega el mismo día, en el primer horario que todavía
+	// no empieza, si ninguno de sus productos suma días por categoría.
+	MismoDiaAntesDe string `json:"mismo_dia_antes_de,omitempty" valida:"hora"`
+	// TiemposCategoria suman días a los pedidos con productos de esas
+	// categorías; de varias cuenta la que más suma.
+	TiemposCategoria []TiempoCategoria `json:"tiempos_categoria,omitempty"`
+	// Calendario son los feriados de dias_feriados que arma ObtenerConfigEntrega.
+	Calendario *feriados.Calendario `json:"-"`
+}
+
+type ReglasFinSemana struct {
+	ProcesarSabado         bool `json:"procesar_sabado"`
+	ProcesarDomingo        bool `json:"procesar_domingo"`
+	DiasAdicionalesSabado  int  `json:"dias_adicionales_sabado" valida:"no_negativo"`
+	DiasAdicionalesDomingo int  `json:"dias_adicionales_domingo" valida:"no_negativo"`
+}
+
+// HorarioEntrega es una ventana de entrega con horas HH:MM. La capacidad es
+// por sucursal y por día: cuántos pedidos y cuántos kg caben (0 es sin límite).
+type HorarioEntrega struct {
+	Etiqueta         string  `json:"etiqueta"`
+	Inicio           string  `json:"inicio" valida:"requerido,hora"`
+	Fin              string  `json:"fin" valida:"requerido,hora"`
+	CapacidadPedidos int     `json:"capacidad_pedidos" valida:"no_negativo"`
+	CapacidadPeso    float64 `json:"capacidad_peso" valida:"no_negativo"`
+}
+
+// TiempoCategoria son los días que tarda de más un producto de la categoría
+// (crm_productos.idcategoria), p. ej. los frescos. Nombre es el que sale en la
+// explicación de la fecha de entrega.
+type TiempoCategoria struct {
+	IDCategoria     int    `json:"id_categoria" valida:"requerido"`
+	Nombre          string `json:"nombre"`
+	DiasAdicionales int    `json:"dias_adicionales" valida:"no_negativo"`
+}
+
+type DiaFeriado struct {
+	Fecha           string `json:"fecha" valida:"requerido,fecha"`
+	DiasAdicionales int    `json:"dias_adicionales" valida:"no_negativo"`
+}
+
+// ConfigEntregaSucursal son los campos de ConfigEntrega que cambia una
+// sucursal. Los que no trae (o trae vacíos) los hereda de su empresa.
+type ConfigEntregaSucursal struct {
+	DiasHabiles         []string          `json:"dias_habiles,omitempty"`
+	TiempoProcesamiento *int              `json:"tiempo_procesamiento,omitempty" valida:"no_negativo"`
+	ReglasFindeSemana   *ReglasFinSemana  `json:"reglas_fin_semana,omitempty"`
+	HorariosEntrega     []HorarioEntrega  `json:"horarios_entrega,omitempty"`
+	DiasFeriados        []DiaFeriado      `json:"dias_feriados,omitempty"`
+	FeriadosOficiales   *bool             `json:"feriados_oficiales,omitempty"`
+	HoraCorte           string            `json:"hora_corte,omitempty" valida:"hora"`
+	MismoDiaAntesDe     string            `json:"mismo_dia_antes_de,omitempty" valida:"hora"`
+	TiemposCategoria    []TiempoCategoria `json:"tiempos_categoria,omitempty"`
 }
 
-// GetConfigEntrega obtiene la configuración de entregas del administrador
-func GetConfigEntrega(dbConn *db.DBConnection) http.HandlerFunc {
+// sucursalDeConsulta lee ?id_sucursal= y revisa que sea de la empresa. Sin el
+// parámetro regresa 0, que en la configuración de entregas es la empresa.
+func sucursalDeConsulta(w http.ResponseWriter, r *http.Request, sucursales repositorio.SucursalRepo, idEmpresa int) (int, bool) {
+	valor := r.URL.Query().Get("id_sucursal")
+	if valor == "" {
+		return 0, true
+	}
+	id, err := strconv.Atoi(valor)
+	if err != nil || id <= 0 {
+		errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_sucursal")))
+		return 0, false
+	}
+	if err := sucursales.DeEmpresa(r.Context(), idEmpresa, id); errors.Is(err, repositorio.ErrNoEncontrado) {
+		errores.Escribir(w, r, errores.Nuevo(errores.SucursalNoEncontrada))
+		return 0, false
+	} else if err != nil {
+		errores.Escribir(w, r, errores.Interno("No se pudo validar la sucursal", err))
+		return 0, false
+	}
+	return id, true
+}
+
+// GetConfigEntrega regresa la configuración de entregas guardada para la
+// empresa o, con ?id_sucursal=, para la sucursal, junto con la efectiva (la
+// que resulta de heredar la de la empresa y la por defecto).
+func GetConfigEntrega(repos repositorio.Repositorios) http.HandlerFunc {
+	sucursales := repos.Sucursales
 	return func(w http.ResponseWriter, r *http.Request) {
-		// En Postman: Para probar temporalmente, envía el ID admin como parámetro
-		idAdminStr := r.URL.Query().Get("id_admin")
-		if idAdminStr == "" {
-			writeErrorResponse1(w, http.StatusBadRequest, "Falta el ID del administrador", "Para pruebas, usa ?id_admin=X")
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
 			return
 		}
-		
-		var idAdmin int
-		fmt.Sscanf(idAdminStr, "%d", &idAdmin)
-		
-		// Verificar que el usuario existe y es admin
-		var tipoUsuario string
-		query := `SELECT tipo_usuario FROM admin_usuarios WHERE idusuario = ?`
-		err := dbConn.Local.QueryRow(query, idAdmin).Scan(&tipoUsuario)
-		if err == sql.ErrNoRows {
-			writeErrorResponse1(w, http.StatusUnauthorized, "Administrador no encontrado", "")
-			return
-		} else if err != nil {
-			writeErrorResponse1(w, http.StatusInternalServerError, "Error de base de datos", err.Error())
-			return
-		}
-		
-		if tipoUsuario != "Admin" {
-			writeErrorResponse1(w, http.StatusForbidden, "El usuario no tiene permisos de administrador", "")
+		idSucursal, ok := sucursalDeConsulta(w, r, sucursales, idEmpresa)
+		if !ok {
 			return
 		}
 
-		// Consultar la configuración de entregas
-		query = `SELECT config_entrega FROM admin_usuarios WHERE idusuario = ?`
-		var configJSON []byte
-		err = dbConn.Local.QueryRow(query, idAdmin).Scan(&configJSON)
+		deEmpresa, deSucursal, err := sucursales.ConfigEntrega(r.Context(), idEmpresa, idSucursal)
 		if err != nil {
-			writeErrorResponse1(w, http.StatusInternalServerError, "Error al obtener configuración de entregas", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error al obtener configuración de entregas", err))
 			return
 		}
-
-		// Si no hay configuración, devolver un objeto vacío
-		if len(configJSON) == 0 {
-			writeSuccessResponse1(w, "No hay configuración de entregas", map[string]interface{}{
-				"config": ConfigEntrega{},
-			})
+		efectiva, err := combinarConfigEntrega(deEmpresa, deSucursal)
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al procesar configuración", err))
 			return
 		}
 
-		// Devolver la configuración
-		var config map[string]interface{}
-		if err := json.Unmarshal(configJSON, &config); err != nil {
-			writeErrorResponse1(w, http.StatusInternalServerError, "Error al procesar configuración", err.Error())
-			return
+		guardada := deEmpresa
+		var config interface{} = ConfigEntrega{}
+		if idSucursal != 0 {
+			guardada = deSucursal
+			config = ConfigEntregaSucursal{}
+		}
+		mensaje := "No hay configuración de entregas"
+		if len(guardada) > 0 {
+			config = json.RawMessage(guardada)
+			mensaje = "Configuración de entregas obtenida"
 		}
-		
-		writeSuccessResponse1(w, "Configuración de entregas obtenida", map[string]interface{}{
-			"config": config,
+		writeSuccessResponse1(w, mensaje, map[string]interface{}{
+			"id_sucursal": idSucursal,
+			"config":      config,
+			"efectiva":    efectiva,
 		})
 	}
 }
 
-// UpdateConfigEntrega actualiza la configuración de entregas del administrador
-func UpdateConfigEntrega(dbConn *db.DBConnection) http.HandlerFunc {
+// UpdateConfigEntrega guarda la configuración de entregas de la empresa o, con
+// ?id_sucursal=, sólo los campos que cambia esa sucursal.
+func UpdateConfigEntrega(dbConn *db.DBConnection, repos repositorio.Repositorios) http.HandlerFunc {
+	sucursales := repos.Sucursales
 	return func(w http.ResponseWriter, r *http.Request) {
-		// En Postman: Para probar temporalmente, envía el ID admin como parámetro
-		idAdminStr := r.URL.Query().Get("id_admin")
-		if idAdminStr == "" {
-			writeErrorResponse1(w, http.StatusBadRequest, "Falta el ID del administrador", "Para pruebas, usa ?id_admin=X")
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
 			return
 		}
-		
-		var idAdmin int
-		fmt.Sscanf(idAdminStr, "%d", &idAdmin)
-		
-		// Verificar que el usuario existe y es admin
-		var tipoUsuario string
-		query := `SELECT tipo_usuario FROM admin_usuarios WHERE idusuario = ?`
-		err := dbConn.Local.QueryRow(query, idAdmin).Scan(&tipoUsuario)
-		if err == sql.ErrNoRows {
-			writeErrorResponse1(w, http.StatusUnauthorized, "Administrador no encontrado", "")
+		idSucursal, ok := sucursalDeConsulta(w, r, sucursales, idEmpresa)
+		if !ok {
 			return
-		} else if err != nil {
-			writeErrorResponse1(w, http.StatusInternalServerError, "Error de base de datos", err.Error())
+		}
+
+		var config interface{} = &ConfigEntrega{}
+		if idSucursal != 0 {
+			config = &ConfigEntregaSucursal{}
+		}
+		if err := validacion.Decodificar(w, r, config); err != nil {
+			errores.Escribir(w, r, err)
 			return
 		}
-		
-		if tipoUsuario != "Admin" {
-			writeErrorResponse1(w, http.StatusForbidden, "El usuario no tiene permisos de administrador", "")
+		configJSON, err := json.Marshal(config)
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al serializar la configuración", err))
 			return
 		}
 
-		// Decodificar la configuración de entregas
-		var config ConfigEntrega
-		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
-			writeErrorResponse1(w, http.StatusBadRequest, "Error al decodificar la configuración", err.Error())
+		_, err = dbConn.Local.ExecContext(r.Context(), `
+			INSERT INTO config_entrega (idempresa, idsucursal, config, actualizado)
+			VALUES (?, ?, ?, NOW())
+			ON DUPLICATE KEY UPDATE config = VALUES(config), actualizado = VALUES(actualizado)
+		`, idEmpresa, idSucursal, configJSON)
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al actualizar la configuración", err))
 			return
 		}
 
-		// Validar la configuración
-		if len(config.DiasHabiles) == 0 {
-			writeErrorResponse1(w, http.StatusBadRequest, "Debe especificar al menos un día hábil", "")
+		writeSuccessResponse1(w, "Configuración de entregas actualizada correctamente", nil)
+	}
+}
+
+// DeleteConfigEntrega borra la configuración propia de una sucursal, que
+// vuelve a usar la de su empresa.
+func DeleteConfigEntrega(dbConn *db.DBConnection, repos repositorio.Repositorios) http.HandlerFunc {
+	sucursales := repos.Sucursales
+	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
 			return
 		}
-
-		// Convertir a JSON
-		configJSON, err := json.Marshal(config)
-		if err != nil {
-			writeErrorResponse1(w, http.StatusInternalServerError, "Error al serializar la configuración", err.Error())
+		idSucursal, ok := sucursalDeConsulta(w, r, sucursales, idEmpresa)
+		if !ok {
+			return
+		}
+		// La de la empresa no se borra: sin ella se usaría la por defecto
+		if idSucursal == 0 {
+			errores.Escribir(w, r, errores.Validacion(errores.Requerido("id_sucursal")))
 			return
 		}
 
-		// Actualizar en la base de datos
-		query = `UPDATE admin_usuarios SET config_entrega = ? WHERE idusuario = ?`
-		_, err = dbConn.Local.Exec(query, configJSON, idAdmin)
+		_, err := dbConn.Local.ExecContext(r.Context(), "DELETE FROM config_entrega WHERE idempresa = ? AND idsucursal = ?", idEmpresa, idSucursal)
 		if err != nil {
-			writeErrorResponse1(w, http.StatusInternalServerError, "Error al actualizar la configuración", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error al borrar la configuración", err))
 			return
 		}
 
-		// Responder con éxito
-		writeSuccessResponse1(w, "Configuración de entregas actualizada correctamente", nil)
+		writeSuccessResponse1(w, "La sucursal usa la configuración de entregas de la empresa", nil)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,314 @@
+package rutas
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/bitacora"
+	"github.com/WolfSlayer04/logica_tiendaenlina/db"
+	"github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+	"github.com/WolfSlayer04/logica_tiendaenlina/feriados"
+	"github.com/WolfSlayer04/logica_tiendaenlina/reloj"
+	"github.com/WolfSlayer04/logica_tiendaenlina/repositorio"
+	"github.com/WolfSlayer04/logica_tiendaenlina/validacion"
+	"github.com/gorilla/mux"
+)
+
+// tamanoMaximoICS limita el .ics que se importa.
+const tamanoMaximoICS = 1 << 20
+
+// FeriadoRequest da de alta un día sin entregas para la empresa o, con
+// id_sucursal, sólo para esa sucursal. Si ya hay uno ese día se reemplaza.
+type FeriadoRequest struct {
+	Fecha           string `json:"fecha" valida:"requerido,fecha"`
+	Nombre          string `json:"nombre" valida:"requerido,max=100"`
+	Recurrente      bool   `json:"recurrente"`
+	DiasAdicionales int    `json:"dias_adicionales" valida:"no_negativo"`
+	IDSucursal      int    `json:"id_sucursal"`
+}
+
+// FeriadoJSON es un feriado en las respuestas; id_feriado 0 es uno que no está
+// guardado en el calendario (oficial o de dias_feriados).
+type FeriadoJSON struct {
+	IDFeriado       int64  `json:"id_feriado"`
+	Fecha           string `json:"fecha"`
+	Nombre          string `json:"nombre"`
+	Recurrente      bool   `json:"recurrente"`
+	DiasAdicionales int    `json:"dias_adicionales"`
+	IDSucursal      int    `json:"id_sucursal"`
+	Origen          string `json:"origen"`
+}
+
+func feriadoJSON(f feriados.Feriado) FeriadoJSON {
+	return FeriadoJSON{
+		IDFeriado:       f.ID,
+		Fecha:           f.Dia(),
+		Nombre:          f.Nombre,
+		Recurrente:      f.Recurrente,
+		DiasAdicionales: f.DiasAdicionales,
+		IDSucursal:      f.IDSucursal,
+		Origen:          f.Origen,
+	}
+}
+
+// anioDeConsulta lee ?anio=; sin el parámetro regresa el año en curso.
+func anioDeConsulta(w http.ResponseWriter, r *http.Request) (int, bool) {
+	valor := r.URL.Query().Get("anio")
+	if valor == "" {
+		return reloj.Desde(r.Context()).Ahora().Year(), true
+	}
+	anio, err := strconv.Atoi(valor)
+	if err != nil || anio < 1900 || anio > 9999 {
+		errores.Escribir(w, r, errores.Validacion(errores.NuevoCampo("anio", errores.CampoFueraDeRango, 1900, 9999)))
+		return 0, false
+	}
+	return anio, true
+}
+
+// guardarFeriados da de alta los feriados de la empresa; el que cae el mismo
+// día en la misma sucursal que otro ya guardado lo reemplaza.
+func guardarFeriados(ctx context.Context, tx *sql.Tx, idEmpresa int, fs []feriados.Feriado) error {
+	for _, f := range fs {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO dias_feriados (id_empresa, id_sucursal, fecha, nombre, recurrente, dias_adicionales, origen)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE nombre = VALUES(nombre), recurrente = VALUES(recurrente),
+				dias_adicionales = VALUES(dias_adicionales), origen = VALUES(origen)
+		`, idEmpresa, f.IDSucursal, f.Dia(), f.Nombre, f.Recurrente, f.DiasAdicionales, f.Origen)
+		if err != nil {
+			return fmt.Errorf("guardando el feriado del %s: %w", f.Dia(), err)
+		}
+	}
+	return nil
+}
+
+// enTransaccion corre fn dentro de una transacción de la base local.
+func enTransaccion(ctx context.Context, dbConn *db.DBConnection, fn func(*sql.Tx) error) error {
+	tx, err := dbConn.Local.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetFeriados regresa los días sin entregas del año (?anio=, por defecto el
+// actual) para la empresa o, con ?id_sucursal=, para la sucursal: los
+// guardados, los de dias_feriados y, si la configuración no los apaga, los
+// oficiales. Los recurrentes salen con la fecha de ese año.
+func GetFeriados(repos repositorio.Repositorios) http.HandlerFunc {
+	sucursales := repos.Sucursales
+	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		idSucursal, ok := sucursalDeConsulta(w, r, sucursales, idEmpresa)
+		if !ok {
+			return
+		}
+		anio, ok := anioDeConsulta(w, r)
+		if !ok {
+			return
+		}
+
+		config, err := ObtenerConfigEntrega(r.Context(), sucursales, idEmpresa, idSucursal)
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al obtener los feriados", err))
+			return
+		}
+		lista := []FeriadoJSON{}
+		for _, f := range config.Calendario.DelAnio(anio) {
+			lista = append(lista, feriadoJSON(f))
+		}
+		writeSuccessResponse1(w, "Feriados obtenidos", lista)
+	}
+}
+
+// CreateFeriado guarda un feriado o un cierre de sucursal.
+func CreateFeriado(dbConn *db.DBConnection, repos repositorio.Repositorios) http.HandlerFunc {
+	sucursales := repos.Sucursales
+	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		var req FeriadoRequest
+		if err := validacion.Decodificar(w, r, &req); err != nil {
+			errores.Escribir(w, r, err)
+			return
+		}
+		if req.IDSucursal != 0 {
+			if err := sucursales.DeEmpresa(r.Context(), idEmpresa, req.IDSucursal); errors.Is(err, repositorio.ErrNoEncontrado) {
+				errores.Escribir(w, r, errores.Nuevo(errores.SucursalNoEncontrada))
+				return
+			} else if err != nil {
+				errores.Escribir(w, r, errores.Interno("No se pudo validar la sucursal", err))
+				return
+			}
+		}
+
+		// La validación ya revisó el formato
+		fecha, _ := time.Parse("2006-01-02", req.Fecha)
+		f := feriados.Feriado{
+			Fecha:           fecha,
+			Nombre:          req.Nombre,
+			Recurrente:      req.Recurrente,
+			DiasAdicionales: req.DiasAdicionales,
+			IDSucursal:      req.IDSucursal,
+			Origen:          feriados.Manual,
+		}
+		err := enTransaccion(r.Context(), dbConn, func(tx *sql.Tx) error {
+			if err := guardarFeriados(r.Context(), tx, idEmpresa, []feriados.Feriado{f}); err != nil {
+				return err
+			}
+			// Si reemplazó a otro conserva su id
+			return tx.QueryRowContext(r.Context(), `
+				SELECT id_feriado FROM dias_feriados WHERE id_empresa = ? AND id_sucursal = ? AND fecha = ?
+			`, idEmpresa, f.IDSucursal, f.Dia()).Scan(&f.ID)
+		})
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al guardar el feriado", err))
+			return
+		}
+		writeSuccessResponse1(w, "Feriado guardado", feriadoJSON(f))
+	}
+}
+
+// DeleteFeriado borra un feriado guardado de la empresa.
+func DeleteFeriado(dbConn *db.DBConnection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		idFeriado, err := strconv.ParseInt(mux.Vars(r)["id_feriado"], 10, 64)
+		if err != nil || idFeriado <= 0 {
+			errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_feriado")))
+			return
+		}
+
+		result, err := dbConn.Local.ExecContext(r.Context(), "DELETE FROM dias_feriados WHERE id_empresa = ? AND id_feriado = ?", idEmpresa, idFeriado)
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al borrar el feriado", err))
+			return
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al borrar el feriado", err))
+			return
+		} else if n == 0 {
+			errores.Escribir(w, r, errores.Nuevo(errores.FeriadoNoEncontrado))
+			return
+		}
+		writeSuccessResponse1(w, "Feriado borrado", nil)
+	}
+}
+
+// ImportarFeriados guarda los eventos de un calendario .ics (el cuerpo, como
+// text/calendar) como feriados de la empresa o, con ?id_sucursal=, de la
+// sucursal. Es todo o nada: si una línea no se entiende no se guarda ninguno.
+func ImportarFeriados(dbConn *db.DBConnection, repos repositorio.Repositorios) http.HandlerFunc {
+	sucursales := repos.Sucursales
+	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		idSucursal, ok := sucursalDeConsulta(w, r, sucursales, idEmpresa)
+		if !ok {
+			return
+		}
+
+		fs, err := feriados.LeerICS(http.MaxBytesReader(w, r.Body, tamanoMaximoICS))
+		var grande *http.MaxBytesError
+		var errICS *feriados.ErrorICS
+		switch {
+		case errors.As(err, &grande):
+			errores.Escribir(w, r, errores.Nuevo(errores.CuerpoMuyGrande).Con("Calendario demasiado grande", err))
+			return
+		case errors.As(err, &errICS):
+			errores.Escribir(w, r, errores.Validacion(errores.NuevoCampo("ics", errores.CampoLineaInvalida, errICS.Linea)).Con("Calendario inválido", err))
+			return
+		case err != nil:
+			errores.Escribir(w, r, errores.Interno("Error al leer el calendario", err))
+			return
+		case len(fs) == 0:
+			errores.Escribir(w, r, errores.Validacion(errores.NuevoCampo("ics", errores.CampoSinElementos)))
+			return
+		}
+		for i := range fs {
+			fs[i].IDSucursal = idSucursal
+		}
+
+		err = enTransaccion(r.Context(), dbConn, func(tx *sql.Tx) error {
+			return guardarFeriados(r.Context(), tx, idEmpresa, fs)
+		})
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al importar los feriados", err))
+			return
+		}
+		writeSuccessResponse1(w, "Feriados importados", map[string]interface{}{
+			"id_sucursal": idSucursal,
+			"importados":  len(fs),
+		})
+	}
+}
+
+// ExportarFeriados descarga el calendario como .ics. Con ?anio= son los días
+// sin entregas de ese año, como en GetFeriados; sin él, sólo los guardados,
+// con los recurrentes como eventos anuales, listo para volver a importarse.
+func ExportarFeriados(repos repositorio.Repositorios) http.HandlerFunc {
+	sucursales := repos.Sucursales
+	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		idSucursal, ok := sucursalDeConsulta(w, r, sucursales, idEmpresa)
+		if !ok {
+			return
+		}
+
+		var fs []feriados.Feriado
+		nombre := "feriados"
+		if r.URL.Query().Get("anio") != "" {
+			anio, ok := anioDeConsulta(w, r)
+			if !ok {
+				return
+			}
+			config, err := ObtenerConfigEntrega(r.Context(), sucursales, idEmpresa, idSucursal)
+			if err != nil {
+				errores.Escribir(w, r, errores.Interno("Error al obtener los feriados", err))
+				return
+			}
+			fs = config.Calendario.DelAnio(anio)
+			nombre = fmt.Sprintf("feriados-%d", anio)
+		} else {
+			var err error
+			fs, err = sucursales.Feriados(r.Context(), idEmpresa, idSucursal)
+			if err != nil {
+				errores.Escribir(w, r, errores.Interno("Error al obtener los feriados", err))
+				return
+			}
+		}
+		if idSucursal != 0 {
+			nombre = fmt.Sprintf("%s-sucursal-%d", nombre, idSucursal)
+		}
+
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.ics"`, nombre))
+		if err := feriados.EscribirICS(w, "Días sin entregas", fs, reloj.Desde(r.Context()).Ahora()); err != nil {
+			// Los encabezados ya salieron; sólo queda el log
+			bitacora.Desde(r.Context()).Error("error enviando calendario", "handler", "ExportarFeriados", "error", err)
+		}
+	}
+}
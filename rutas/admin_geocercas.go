@@ -0,0 +1,219 @@
+package rutas
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/bitacora"
+	"github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+	"github.com/WolfSlayer04/logica_tiendaenlina/geocerca"
+	"github.com/WolfSlayer04/logica_tiendaenlina/reloj"
+	"github.com/WolfSlayer04/logica_tiendaenlina/repositorio"
+	"github.com/WolfSlayer04/logica_tiendaenlina/validacion"
+	"github.com/gorilla/mux"
+)
+
+// CambioTienda es una tienda a la que la nueva cobertura le asignaría otra
+// sucursal. en_cobertura es falso si ninguna sucursal la cubre y la nueva es
+// sólo la más cercana.
+type CambioTienda struct {
+	IDTienda         int    `json:"id_tienda"`
+	NombreTienda     string `json:"nombre_tienda"`
+	IDSucursalActual int    `json:"id_sucursal_actual"`
+	SucursalActual   string `json:"sucursal_actual"`
+	IDSucursalNueva  int    `json:"id_sucursal_nueva"`
+	SucursalNueva    string `json:"sucursal_nueva"`
+	EnCobertura      bool   `json:"en_cobertura"`
+}
+
+// sucursalDeRuta lee {id_sucursal} y revisa que sea de la empresa.
+func sucursalDeRuta(w http.ResponseWriter, r *http.Request, sucursales repositorio.SucursalRepo, idEmpresa int) (int, bool) {
+	idSucursal, err := strconv.Atoi(mux.Vars(r)["id_sucursal"])
+	if err != nil || idSucursal <= 0 {
+		errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_sucursal")))
+		return 0, false
+	}
+	if err := sucursales.DeEmpresa(r.Context(), idEmpresa, idSucursal); errors.Is(err, repositorio.ErrNoEncontrado) {
+		errores.Escribir(w, r, errores.Nuevo(errores.SucursalNoEncontrada))
+		return 0, false
+	} else if err != nil {
+		errores.Escribir(w, r, errores.Interno("Error al consultar la sucursal", err))
+		return 0, false
+	}
+	return idSucursal, true
+}
+
+// geocercaDelCuerpo lee el Feature del cuerpo y lo convierte en geocerca.
+func geocercaDelCuerpo(w http.ResponseWriter, r *http.Request) (geocerca.Geocerca, bool) {
+	var f geocerca.Feature
+	if err := validacion.Decodificar(w, r, &f); err != nil {
+		errores.Escribir(w, r, err)
+		return geocerca.Geocerca{}, false
+	}
+	g, campos := geocerca.DesdeGeoJSON(f)
+	if len(campos) > 0 {
+		errores.Escribir(w, r, errores.Validacion(campos...))
+		return geocerca.Geocerca{}, false
+	}
+	return g, true
+}
+
+func featureDeSucursal(c geocerca.Cobertura) geocerca.Feature {
+	return c.Geocerca.GeoJSON(map[string]any{"id_sucursal": c.IDSucursal, "sucursal": c.Nombre})
+}
+
+// cambiosDeCobertura compara, para cada tienda activa con ubicación, la
+// sucursal que le asignan las geocercas actuales con la que le asignarían si
+// la sucursal tuviera la geocerca g. Sólo lista las que cambian por g; la
+// sucursal actual es la que la tienda tiene guardada.
+func cambiosDeCobertura(ctx context.Context, repos repositorio.Repositorios, idEmpresa, idSucursal int, g geocerca.Geocerca) ([]CambioTienda, error) {
+	actuales, err := repos.Sucursales.Coberturas(ctx, idEmpresa)
+	if err != nil {
+		return nil, err
+	}
+	tiendas, err := repos.Tiendas.Ubicaciones(ctx, idEmpresa)
+	if err != nil {
+		return nil, err
+	}
+	propuestas := make([]geocerca.Cobertura, len(actuales))
+	copy(propuestas, actuales)
+	for i := range propuestas {
+		if propuestas[i].IDSucursal == idSucursal {
+			propuestas[i].Geocerca = g
+		}
+	}
+
+	cambios := []CambioTienda{}
+	for _, t := range tiendas {
+		antes := geocerca.Asignar(actuales, t.Punto)
+		despues := geocerca.Asignar(propuestas, t.Punto)
+		if despues.IDSucursal == antes.IDSucursal || despues.IDSucursal == t.IDSucursal {
+			continue
+		}
+		cambios = append(cambios, CambioTienda{
+			IDTienda:         t.IDTienda,
+			NombreTienda:     t.NombreTienda,
+			IDSucursalActual: t.IDSucursal,
+			SucursalActual:   t.NombreSucursal,
+			IDSucursalNueva:  despues.IDSucursal,
+			SucursalNueva:    despues.Nombre,
+			EnCobertura:      despues.Cubierta,
+		})
+	}
+	return cambios, nil
+}
+
+// GetCoberturaSucursal regresa la geocerca de la sucursal como GeoJSON.
+func GetCoberturaSucursal(repos repositorio.Repositorios) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		idSucursal, ok := sucursalDeRuta(w, r, repos.Sucursales, idEmpresa)
+		if !ok {
+			return
+		}
+		c, err := repos.Sucursales.Cobertura(r.Context(), idEmpresa, idSucursal)
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al obtener la cobertura", err))
+			return
+		}
+		writeSuccessResponse(w, "Cobertura obtenida", featureDeSucursal(c))
+	}
+}
+
+// PreviewCoberturaSucursal valida la geocerca del cuerpo sin guardarla y
+// regresa las tiendas que cambiarían de sucursal.
+func PreviewCoberturaSucursal(repos repositorio.Repositorios) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		idSucursal, ok := sucursalDeRuta(w, r, repos.Sucursales, idEmpresa)
+		if !ok {
+			return
+		}
+		g, ok := geocercaDelCuerpo(w, r)
+		if !ok {
+			return
+		}
+		c, err := repos.Sucursales.Cobertura(r.Context(), idEmpresa, idSucursal)
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al obtener la cobertura", err))
+			return
+		}
+		cambios, err := cambiosDeCobertura(r.Context(), repos, idEmpresa, idSucursal, g)
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al calcular los cambios de sucursal", err))
+			return
+		}
+		c.Geocerca = g
+		writeSuccessResponse(w, "Vista previa de la cobertura", map[string]interface{}{
+			"cobertura": featureDeSucursal(c),
+			"cambios":   cambios,
+		})
+	}
+}
+
+// UpdateCoberturaSucursal reemplaza la geocerca de la sucursal. Las tiendas
+// no se reasignan; la respuesta lista las que cambiarían de sucursal con la
+// nueva cobertura y el reporte de reasignación que queda pendiente de
+// aprobar.
+func UpdateCoberturaSucursal(repos repositorio.Repositorios) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		idSucursal, ok := sucursalDeRuta(w, r, repos.Sucursales, idEmpresa)
+		if !ok {
+			return
+		}
+		g, ok := geocercaDelCuerpo(w, r)
+		if !ok {
+			return
+		}
+		// Los cambios se calculan antes de guardar, contra la cobertura anterior
+		cambios, err := cambiosDeCobertura(r.Context(), repos, idEmpresa, idSucursal, g)
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al calcular los cambios de sucursal", err))
+			return
+		}
+		err = repos.Sucursales.GuardarCobertura(r.Context(), idEmpresa, idSucursal, g)
+		if errors.Is(err, repositorio.ErrNoEncontrado) {
+			errores.Escribir(w, r, errores.Nuevo(errores.SucursalNoEncontrada))
+			return
+		} else if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al guardar la cobertura", err))
+			return
+		}
+		c, err := repos.Sucursales.Cobertura(r.Context(), idEmpresa, idSucursal)
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al obtener la cobertura", err))
+			return
+		}
+		bitacora.Desde(r.Context()).Info("cobertura de sucursal actualizada",
+			"id_empresa", idEmpresa, "id_sucursal", idSucursal, "tipo", g.Tipo, "puntos", len(g.Puntos), "tiendas_afectadas", len(cambios))
+
+		// La cobertura ya quedó guardada: si el reporte falla, la revisión
+		// periódica lo vuelve a intentar
+		var reasignacion *Reasignacion
+		re, err := reasignarTiendas(r.Context(), repos, idEmpresa, origenCobertura, reloj.Desde(r.Context()).Ahora())
+		if err != nil {
+			bitacora.Desde(r.Context()).Error("no se pudo generar la reasignación de tiendas", "id_empresa", idEmpresa, "error", err)
+		} else {
+			j := reasignacionDe(re)
+			reasignacion = &j
+		}
+		writeSuccessResponse(w, "Cobertura actualizada", map[string]interface{}{
+			"cobertura":    featureDeSucursal(c),
+			"cambios":      cambios,
+			"reasignacion": reasignacion,
+		})
+	}
+}
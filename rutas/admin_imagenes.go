@@ -4,11 +4,13 @@ import (
 	"database/sql"
 	"encoding/json"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"time"
 
+	"github.com/WolfSlayer04/logica_tiendaenlina/bitacora"
 	"github.com/WolfSlayer04/logica_tiendaenlina/db"
+	"github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
 )
 
 // getIdentificadorFromRequest extrae el identificador de logo/logotipo del formulario o query.
@@ -27,55 +29,47 @@ func getIdentificadorFromRequest(r *http.Request) (string, error) {
 // POST /api/empresa/logo  (requiere "identificador")
 func EmpresaUploadLogo(dbConn *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		idempresa, err := getUniqueIDEmpresa(dbConn)
-		if err != nil {
-			log.Println("[EmpresaUploadLogo] Error obteniendo idempresa:", err)
-			http.Error(w, "No se pudo obtener idempresa: "+err.Error(), http.StatusInternalServerError)
+		idempresa, ok := empresas.Requerida(w, r)
+		if !ok {
 			return
 		}
-		err = r.ParseMultipartForm(5 << 20)
+		err := r.ParseMultipartForm(5 << 20)
 		if err != nil {
-			log.Println("[EmpresaUploadLogo] Error al leer el formulario:", err)
-			http.Error(w, "Error al leer el formulario: "+err.Error(), http.StatusBadRequest)
+			errores.Escribir(w, r, errores.Nuevo(errores.FormularioInvalido).Con("Error al leer el formulario", err))
 			return
 		}
 		identificador, err := getIdentificadorFromRequest(r)
 		if err != nil {
-			log.Println("[EmpresaUploadLogo] identificador requerido")
-			http.Error(w, "Falta el identificador (logo, logotipo, etc)", http.StatusBadRequest)
+			errores.Escribir(w, r, errores.Validacion(errores.Requerido("identificador")))
 			return
 		}
 		// El campo del archivo debe coincidir con el identificador ("logo" o "logotipo")
 		file, header, err := r.FormFile(identificador)
 		if err != nil {
-			log.Printf("[EmpresaUploadLogo] Archivo de %s no recibido: %v", identificador, err)
-			http.Error(w, "Archivo de imagen no recibido: "+err.Error(), http.StatusBadRequest)
+			errores.Escribir(w, r, errores.Validacion(errores.Requerido(identificador)).Con("Archivo de imagen no recibido", err))
 			return
 		}
 		defer file.Close()
 		fileBytes, err := ioutil.ReadAll(file)
 		if err != nil {
-			log.Println("[EmpresaUploadLogo] Error leyendo archivo:", err)
-			http.Error(w, "Error leyendo archivo: "+err.Error(), http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error leyendo archivo", err))
 			return
 		}
 		mimeType := header.Header.Get("Content-Type")
 		if mimeType != "image/png" && mimeType != "image/jpeg" {
-			log.Println("[EmpresaUploadLogo] Formato de imagen no permitido:", mimeType)
-			http.Error(w, "Formato de imagen no permitido (solo PNG o JPG)", http.StatusBadRequest)
+			errores.Escribir(w, r, errores.Validacion(errores.NuevoCampo("imagen", errores.CampoFormatoArchivo, "PNG, JPG")))
 			return
 		}
-		_, err = dbConn.Local.Exec("DELETE FROM empresa_logos WHERE idempresa = ? AND identificador = ?", idempresa, identificador)
+		_, err = dbConn.Local.ExecContext(r.Context(), "DELETE FROM empresa_logos WHERE idempresa = ? AND identificador = ?", idempresa, identificador)
 		if err != nil {
-			log.Println("[EmpresaUploadLogo] Error borrando imagen anterior:", err)
+			bitacora.Desde(r.Context()).Error("error borrando imagen anterior", "handler", "EmpresaUploadLogo", "error", err)
 		}
-		_, err = dbConn.Local.Exec(
+		_, err = dbConn.Local.ExecContext(r.Context(), 
 			"INSERT INTO empresa_logos (idempresa, identificador, imagen, mime_type, updated_at) VALUES (?, ?, ?, ?, NOW())",
 			idempresa, identificador, fileBytes, mimeType,
 		)
 		if err != nil {
-			log.Println("[EmpresaUploadLogo] Error guardando imagen nueva:", err)
-			http.Error(w, "Error guardando imagen: "+err.Error(), http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error guardando imagen", err))
 			return
 		}
 		w.WriteHeader(http.StatusCreated)
@@ -86,56 +80,47 @@ func EmpresaUploadLogo(dbConn *db.DBConnection) http.HandlerFunc {
 // PUT /api/empresa/logo  (requiere "identificador")
 func EmpresaUpdateLogo(dbConn *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		idempresa, err := getUniqueIDEmpresa(dbConn)
-		if err != nil {
-			log.Println("[EmpresaUpdateLogo] Error obteniendo idempresa:", err)
-			http.Error(w, "No se pudo obtener idempresa: "+err.Error(), http.StatusInternalServerError)
+		idempresa, ok := empresas.Requerida(w, r)
+		if !ok {
 			return
 		}
-		err = r.ParseMultipartForm(5 << 20)
+		err := r.ParseMultipartForm(5 << 20)
 		if err != nil {
-			log.Println("[EmpresaUpdateLogo] Error al leer el formulario:", err)
-			http.Error(w, "Error al leer el formulario: "+err.Error(), http.StatusBadRequest)
+			errores.Escribir(w, r, errores.Nuevo(errores.FormularioInvalido).Con("Error al leer el formulario", err))
 			return
 		}
 		identificador, err := getIdentificadorFromRequest(r)
 		if err != nil {
-			log.Println("[EmpresaUpdateLogo] identificador requerido")
-			http.Error(w, "Falta el identificador (logo, logotipo, etc)", http.StatusBadRequest)
+			errores.Escribir(w, r, errores.Validacion(errores.Requerido("identificador")))
 			return
 		}
 		file, header, err := r.FormFile(identificador)
 		if err != nil {
-			log.Printf("[EmpresaUpdateLogo] Archivo de %s no recibido: %v", identificador, err)
-			http.Error(w, "Archivo de imagen no recibido: "+err.Error(), http.StatusBadRequest)
+			errores.Escribir(w, r, errores.Validacion(errores.Requerido(identificador)).Con("Archivo de imagen no recibido", err))
 			return
 		}
 		defer file.Close()
 		fileBytes, err := ioutil.ReadAll(file)
 		if err != nil {
-			log.Println("[EmpresaUpdateLogo] Error leyendo archivo:", err)
-			http.Error(w, "Error leyendo archivo: "+err.Error(), http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error leyendo archivo", err))
 			return
 		}
 		mimeType := header.Header.Get("Content-Type")
 		if mimeType != "image/png" && mimeType != "image/jpeg" {
-			log.Println("[EmpresaUpdateLogo] Formato de imagen no permitido:", mimeType)
-			http.Error(w, "Formato de imagen no permitido (solo PNG o JPG)", http.StatusBadRequest)
+			errores.Escribir(w, r, errores.Validacion(errores.NuevoCampo("imagen", errores.CampoFormatoArchivo, "PNG, JPG")))
 			return
 		}
-		res, err := dbConn.Local.Exec(
+		res, err := dbConn.Local.ExecContext(r.Context(), 
 			"UPDATE empresa_logos SET imagen = ?, mime_type = ?, updated_at = NOW() WHERE idempresa = ? AND identificador = ?",
 			fileBytes, mimeType, idempresa, identificador,
 		)
 		if err != nil {
-			log.Println("[EmpresaUpdateLogo] Error actualizando imagen:", err)
-			http.Error(w, "Error al actualizar registro: "+err.Error(), http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error al actualizar registro", err))
 			return
 		}
 		rows, _ := res.RowsAffected()
 		if rows == 0 {
-			log.Printf("[EmpresaUpdateLogo] No se encontró registro para actualizar (%s), intenta con POST", identificador)
-			http.Error(w, "No se pudo actualizar, intenta con POST", http.StatusBadRequest)
+			errores.Escribir(w, r, errores.Nuevo(errores.ImagenNoEncontrada).Con("No se encontró registro para actualizar, intenta con POST", nil))
 			return
 		}
 		json.NewEncoder(w).Encode(map[string]any{"ok": true})
@@ -145,22 +130,18 @@ func EmpresaUpdateLogo(dbConn *db.DBConnection) http.HandlerFunc {
 // DELETE /api/empresa/logo?identificador=logo
 func EmpresaDeleteLogo(dbConn *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		idempresa, err := getUniqueIDEmpresa(dbConn)
-		if err != nil {
-			log.Println("[EmpresaDeleteLogo] Error obteniendo idempresa:", err)
-			http.Error(w, "No se pudo obtener idempresa: "+err.Error(), http.StatusInternalServerError)
+		idempresa, ok := empresas.Requerida(w, r)
+		if !ok {
 			return
 		}
 		identificador, err := getIdentificadorFromRequest(r)
 		if err != nil {
-			log.Println("[EmpresaDeleteLogo] identificador requerido")
-			http.Error(w, "Falta el identificador (logo, logotipo, etc)", http.StatusBadRequest)
+			errores.Escribir(w, r, errores.Validacion(errores.Requerido("identificador")))
 			return
 		}
-		_, err = dbConn.Local.Exec("DELETE FROM empresa_logos WHERE idempresa = ? AND identificador = ?", idempresa, identificador)
+		_, err = dbConn.Local.ExecContext(r.Context(), "DELETE FROM empresa_logos WHERE idempresa = ? AND identificador = ?", idempresa, identificador)
 		if err != nil {
-			log.Println("[EmpresaDeleteLogo] Error borrando imagen:", err)
-			http.Error(w, "Error borrando imagen: "+err.Error(), http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error borrando imagen", err))
 			return
 		}
 		json.NewEncoder(w).Encode(map[string]any{"ok": true})
@@ -170,30 +151,25 @@ func EmpresaDeleteLogo(dbConn *db.DBConnection) http.HandlerFunc {
 // GET /api/empresa/logo?identificador=logo
 func EmpresaGetLogo(dbConn *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		idempresa, err := getUniqueIDEmpresa(dbConn)
-		if err != nil {
-			log.Println("[EmpresaGetLogo] Error obteniendo idempresa:", err)
-			http.Error(w, "No se pudo obtener idempresa: "+err.Error(), http.StatusInternalServerError)
+		idempresa, ok := empresas.Requerida(w, r)
+		if !ok {
 			return
 		}
 		identificador, err := getIdentificadorFromRequest(r)
 		if err != nil {
-			log.Println("[EmpresaGetLogo] identificador requerido")
-			http.Error(w, "Falta el identificador (logo, logotipo, etc)", http.StatusBadRequest)
+			errores.Escribir(w, r, errores.Validacion(errores.Requerido("identificador")))
 			return
 		}
-		row := dbConn.Local.QueryRow("SELECT imagen, mime_type, updated_at FROM empresa_logos WHERE idempresa = ? AND identificador = ?", idempresa, identificador)
+		row := dbConn.Local.QueryRowContext(r.Context(), "SELECT imagen, mime_type, updated_at FROM empresa_logos WHERE idempresa = ? AND identificador = ?", idempresa, identificador)
 		var img []byte
 		var mime string
 		var updatedAtBytes []byte
 		err = row.Scan(&img, &mime, &updatedAtBytes)
 		if err == sql.ErrNoRows {
-			log.Printf("[EmpresaGetLogo] No hay imagen para esta empresa con identificador: %s", identificador)
-			http.Error(w, "No hay imagen para esta empresa con ese identificador", http.StatusNotFound)
+			errores.Escribir(w, r, errores.Nuevo(errores.ImagenNoEncontrada))
 			return
 		} else if err != nil {
-			log.Println("[EmpresaGetLogo] Error consultando imagen:", err)
-			http.Error(w, "Error consultando imagen: "+err.Error(), http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error consultando imagen", err))
 			return
 		}
 		var updatedAt time.Time
@@ -221,7 +197,7 @@ func EmpresaGetLogo(dbConn *db.DBConnection) http.HandlerFunc {
 		w.Header().Set("Last-Modified", updatedAt.UTC().Format(http.TimeFormat))
 		_, err = w.Write(img)
 		if err != nil {
-			log.Println("[EmpresaGetLogo] Error enviando imagen:", err)
+			bitacora.Desde(r.Context()).Error("error enviando imagen", "handler", "EmpresaGetLogo", "error", err)
 		}
 	}
 }
\ No newline at end of file
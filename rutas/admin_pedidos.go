@@ -2,12 +2,16 @@ package rutas
 
 import (
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/WolfSlayer04/logica_tiendaenlina/db"
+	"github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+	"github.com/WolfSlayer04/logica_tiendaenlina/repositorio"
+	"github.com/WolfSlayer04/logica_tiendaenlina/validacion"
 
 	"github.com/gorilla/mux"
 )
@@ -15,56 +19,64 @@ import (
 // ----------- ESTRUCTURAS AUXILIARES -----------
 
 type SucursalRequest struct {
-	IDSucursal int `json:"id_sucursal"`
+	IDSucursal int `json:"id_sucursal" valida:"requerido,mayor_cero"`
 }
 
 type EstatusRequest struct {
-	Estatus string `json:"estatus"`
+	Estatus string `json:"estatus" valida:"requerido,uno_de=pendiente|procesando|enviado|entregado|cancelado"`
 }
 
 type DescuentoRequest struct {
-	Descuento float64 `json:"descuento"`
+	Descuento float64 `json:"descuento" valida:"no_negativo"`
 }
 
 type DetallePedidoUpdate struct {
-	IDDetalle        int64   `json:"id_detalle"`
-	Cantidad         float64 `json:"cantidad"`
-	PrecioUnitario   float64 `json:"precio_unitario"`
-	ImporteDescuento float64 `json:"importe_descuento"`
+	IDDetalle        int64   `json:"id_detalle" valida:"requerido"`
+	Cantidad         float64 `json:"cantidad" valida:"mayor_cero"`
+	PrecioUnitario   float64 `json:"precio_unitario" valida:"no_negativo"`
+	ImporteDescuento float64 `json:"importe_descuento" valida:"no_negativo"`
 	Comentarios      string  `json:"comentarios"`
 }
 
 type DetallesUpdateRequest struct {
-	Detalles []DetallePedidoUpdate `json:"detalles"`
+	Detalles []DetallePedidoUpdate `json:"detalles" valida:"requerido"`
 }
 
 // ----------- ASIGNAR/CAMBIAR SUCURSAL -----------
 
-func AdminActualizarSucursalPedido(dbConn *db.DBConnection) http.HandlerFunc {
+func AdminActualizarSucursalPedido(dbConn *db.DBConnection, repos repositorio.Repositorios) http.HandlerFunc {
+	sucursales := repos.Sucursales
 	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
 		idPedidoStr := mux.Vars(r)["id_pedido"]
 		idPedido, err := strconv.ParseInt(idPedidoStr, 10, 64)
 		if err != nil {
-			writeErrorResponse(w, http.StatusBadRequest, "ID de pedido inválido", err.Error())
+			errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_pedido")).Con("ID de pedido inválido", err))
 			return
 		}
 		var req SucursalRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			writeErrorResponse(w, http.StatusBadRequest, "JSON inválido", err.Error())
+		if err := validacion.Decodificar(w, r, &req); err != nil {
+			errores.Escribir(w, r, err)
 			return
 		}
-		if req.IDSucursal <= 0 {
-			writeErrorResponse(w, http.StatusBadRequest, "ID de sucursal requerido", "")
+		if err := sucursales.DeEmpresa(r.Context(), idEmpresa, req.IDSucursal); errors.Is(err, repositorio.ErrNoEncontrado) {
+			errores.Escribir(w, r, errores.Nuevo(errores.SucursalNoEncontrada))
+			return
+		} else if err != nil {
+			errores.Escribir(w, r, errores.Interno("No se pudo validar la sucursal", err))
 			return
 		}
-		res, err := dbConn.Local.Exec("UPDATE pedidos SET id_sucursal = ? WHERE id_pedido = ?", req.IDSucursal, idPedido)
+		res, err := dbConn.Local.ExecContext(r.Context(), "UPDATE pedidos SET id_sucursal = ? WHERE id_empresa = ? AND id_pedido = ?", req.IDSucursal, idEmpresa, idPedido)
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "No se pudo actualizar la sucursal", err.Error())
+			errores.Escribir(w, r, errores.Interno("No se pudo actualizar la sucursal", err))
 			return
 		}
 		affected, _ := res.RowsAffected()
 		if affected == 0 {
-			writeErrorResponse(w, http.StatusNotFound, "Pedido no encontrado", "")
+			errores.Escribir(w, r, errores.Nuevo(errores.PedidoNoEncontrado))
 			return
 		}
 		writeSuccessResponse(w, "Sucursal asignada correctamente", nil)
@@ -75,29 +87,29 @@ func AdminActualizarSucursalPedido(dbConn *db.DBConnection) http.HandlerFunc {
 
 func AdminActualizarEstatusPedido(dbConn *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
 		idPedidoStr := mux.Vars(r)["id_pedido"]
 		idPedido, err := strconv.ParseInt(idPedidoStr, 10, 64)
 		if err != nil {
-			writeErrorResponse(w, http.StatusBadRequest, "ID de pedido inválido", err.Error())
+			errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_pedido")).Con("ID de pedido inválido", err))
 			return
 		}
 		var req EstatusRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			writeErrorResponse(w, http.StatusBadRequest, "JSON inválido", err.Error())
-			return
-		}
-		if req.Estatus == "" {
-			writeErrorResponse(w, http.StatusBadRequest, "Estatus requerido", "")
+		if err := validacion.Decodificar(w, r, &req); err != nil {
+			errores.Escribir(w, r, err)
 			return
 		}
-		res, err := dbConn.Local.Exec("UPDATE pedidos SET estatus = ? WHERE id_pedido = ?", req.Estatus, idPedido)
+		res, err := dbConn.Local.ExecContext(r.Context(), "UPDATE pedidos SET estatus = ? WHERE id_empresa = ? AND id_pedido = ?", req.Estatus, idEmpresa, idPedido)
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "No se pudo actualizar el estatus", err.Error())
+			errores.Escribir(w, r, errores.Interno("No se pudo actualizar el estatus", err))
 			return
 		}
 		affected, _ := res.RowsAffected()
 		if affected == 0 {
-			writeErrorResponse(w, http.StatusNotFound, "Pedido no encontrado", "")
+			errores.Escribir(w, r, errores.Nuevo(errores.PedidoNoEncontrado))
 			return
 		}
 		writeSuccessResponse(w, "Estatus actualizado correctamente", nil)
@@ -106,39 +118,37 @@ func AdminActualizarEstatusPedido(dbConn *db.DBConnection) http.HandlerFunc {
 
 // ----------- APLICAR DESCUENTO GLOBAL AL PEDIDO -----------
 
-func AdminAplicarDescuentoPedido(dbConn *db.DBConnection) http.HandlerFunc {
+func AdminAplicarDescuentoPedido(repos repositorio.Repositorios) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
 		idPedidoStr := mux.Vars(r)["id_pedido"]
 		idPedido, err := strconv.ParseInt(idPedidoStr, 10, 64)
 		if err != nil {
-			writeErrorResponse(w, http.StatusBadRequest, "ID de pedido inválido", err.Error())
+			errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_pedido")).Con("ID de pedido inválido", err))
 			return
 		}
 		var req DescuentoRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			writeErrorResponse(w, http.StatusBadRequest, "JSON inválido", err.Error())
-			return
-		}
-		if req.Descuento < 0 {
-			writeErrorResponse(w, http.StatusBadRequest, "El descuento no puede ser negativo", "")
+		if err := validacion.Decodificar(w, r, &req); err != nil {
+			errores.Escribir(w, r, err)
 			return
 		}
-		var subtotal, iva, ieps float64
-		err = dbConn.Local.QueryRow("SELECT subtotal, iva, ieps FROM pedidos WHERE id_pedido = ?", idPedido).Scan(&subtotal, &iva, &ieps)
-		if err == sql.ErrNoRows {
-			writeErrorResponse(w, http.StatusNotFound, "Pedido no encontrado", "")
+		totales, err := repos.Pedidos.Totales(r.Context(), idEmpresa, idPedido)
+		if errors.Is(err, repositorio.ErrNoEncontrado) {
+			errores.Escribir(w, r, errores.Nuevo(errores.PedidoNoEncontrado))
 			return
 		} else if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "Error consultando pedido", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error consultando pedido", err))
 			return
 		}
-		total := subtotal - req.Descuento + iva + ieps
+		total := totales.Subtotal - req.Descuento + totales.IVA + totales.IEPS
 		if total < 0 {
 			total = 0
 		}
-		_, err = dbConn.Local.Exec("UPDATE pedidos SET descuento = ?, total = ? WHERE id_pedido = ?", req.Descuento, total, idPedido)
-		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "No se pudo aplicar el descuento", err.Error())
+		if err := repos.Pedidos.AplicarDescuento(r.Context(), idEmpresa, idPedido, req.Descuento, total); err != nil {
+			errores.Escribir(w, r, errores.Interno("No se pudo aplicar el descuento", err))
 			return
 		}
 		writeSuccessResponse(w, "Descuento aplicado correctamente", map[string]interface{}{
@@ -151,53 +161,58 @@ func AdminAplicarDescuentoPedido(dbConn *db.DBConnection) http.HandlerFunc {
 
 func AdminActualizarDetallesPedido(dbConn *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
 		idPedidoStr := mux.Vars(r)["id_pedido"]
 		idPedido, err := strconv.ParseInt(idPedidoStr, 10, 64)
 		if err != nil {
-			writeErrorResponse(w, http.StatusBadRequest, "ID de pedido inválido", err.Error())
+			errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_pedido")).Con("ID de pedido inválido", err))
 			return
 		}
 		var req DetallesUpdateRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			writeErrorResponse(w, http.StatusBadRequest, "JSON inválido", err.Error())
+		if err := validacion.Decodificar(w, r, &req); err != nil {
+			errores.Escribir(w, r, err)
 			return
 		}
-		if len(req.Detalles) == 0 {
-			writeErrorResponse(w, http.StatusBadRequest, "Se requiere al menos un producto para actualizar", "")
+		var existe int
+		err = dbConn.Local.QueryRowContext(r.Context(), "SELECT COUNT(*) FROM pedidos WHERE id_empresa = ? AND id_pedido = ?", idEmpresa, idPedido).Scan(&existe)
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error consultando pedido", err))
+			return
+		}
+		if existe == 0 {
+			errores.Escribir(w, r, errores.Nuevo(errores.PedidoNoEncontrado))
 			return
 		}
 		tx, err := dbConn.Local.Begin()
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "No se pudo iniciar la transacción", err.Error())
+			errores.Escribir(w, r, errores.Interno("No se pudo iniciar la transacción", err))
 			return
 		}
 		defer func() {
-			if r := recover(); r != nil {
+			if p := recover(); p != nil {
 				tx.Rollback()
-				writeErrorResponse(w, http.StatusInternalServerError, "Error inesperado", fmt.Sprintf("%v", r))
+				errores.Escribir(w, r, errores.Interno("Error inesperado", fmt.Errorf("%v", p)))
 			}
 		}()
 		var subtotal, totalDescuento, totalIVA, totalIEPS, total float64
 
 		for _, d := range req.Detalles {
-			if d.Cantidad <= 0 || d.PrecioUnitario < 0 {
-				tx.Rollback()
-				writeErrorResponse(w, http.StatusBadRequest, "Cantidad o precio inválido en algún producto", "")
-				return
-			}
 			subt := d.PrecioUnitario * d.Cantidad
 			iva := 0.0
 			ieps := 0.0
 			tot := subt - d.ImporteDescuento + iva + ieps
 
-			_, err := tx.Exec(`
+			_, err := tx.ExecContext(r.Context(), `
 				UPDATE detalle_pedidos
 				SET cantidad = ?, precio_unitario = ?, importe_descuento = ?, subtotal = ?, importe_iva = ?, importe_ieps = ?, total = ?, comentarios = ?
 				WHERE id_detalle = ? AND id_pedido = ?
 			`, d.Cantidad, d.PrecioUnitario, d.ImporteDescuento, subt, iva, ieps, tot, d.Comentarios, d.IDDetalle, idPedido)
 			if err != nil {
 				tx.Rollback()
-				writeErrorResponse(w, http.StatusInternalServerError, "Error al actualizar detalle", err.Error())
+				errores.Escribir(w, r, errores.Interno("Error al actualizar detalle", err))
 				return
 			}
 			subtotal += subt
@@ -206,17 +221,17 @@ func AdminActualizarDetallesPedido(dbConn *db.DBConnection) http.HandlerFunc {
 			totalIEPS += ieps
 			total += tot
 		}
-		_, err = tx.Exec(`
+		_, err = tx.ExecContext(r.Context(), `
 			UPDATE pedidos SET subtotal = ?, descuento = ?, iva = ?, ieps = ?, total = ?
-			WHERE id_pedido = ?
-		`, subtotal, totalDescuento, totalIVA, totalIEPS, total, idPedido)
+			WHERE id_empresa = ? AND id_pedido = ?
+		`, subtotal, totalDescuento, totalIVA, totalIEPS, total, idEmpresa, idPedido)
 		if err != nil {
 			tx.Rollback()
-			writeErrorResponse(w, http.StatusInternalServerError, "Error al actualizar totales del pedido", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error al actualizar totales del pedido", err))
 			return
 		}
 		if err := tx.Commit(); err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "Error al confirmar cambios", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error al confirmar cambios", err))
 			return
 		}
 		writeSuccessResponse(w, "Detalles del pedido actualizados correctamente", map[string]interface{}{
@@ -233,7 +248,11 @@ func AdminActualizarDetallesPedido(dbConn *db.DBConnection) http.HandlerFunc {
 
 func AdminGetPedidosConDetalles(dbConn *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		rows, err := dbConn.Local.Query(`
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		rows, err := dbConn.Local.QueryContext(r.Context(), `
 			SELECT 
 				p.id_pedido, p.clave_unica, p.id_usuario, p.id_tienda, p.id_sucursal, p.fecha_creacion, p.fecha_entrega,
 				p.subtotal, p.descuento, p.iva, p.ieps, p.total, p.id_metodo_pago, p.referencia_pago, p.direccion_entrega,
@@ -244,10 +263,11 @@ func AdminGetPedidosConDetalles(dbConn *db.DBConnection) http.HandlerFunc {
 			FROM pedidos p
 			LEFT JOIN usuarios u ON u.id_usuario = p.id_usuario
 			LEFT JOIN adm_sucursales s ON s.idsucursal = p.id_sucursal
+			WHERE p.id_empresa = ?
 			ORDER BY p.id_pedido DESC
-		`)
+		`, idEmpresa)
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "Error al consultar pedidos", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error al consultar pedidos", err))
 			return
 		}
 		defer rows.Close()
@@ -315,7 +335,7 @@ func AdminGetPedidosConDetalles(dbConn *db.DBConnection) http.HandlerFunc {
 				&p.NombreSucursal,
 			)
 			if err != nil {
-				writeErrorResponse(w, http.StatusInternalServerError, "Error al leer pedido", err.Error())
+				errores.Escribir(w, r, errores.Interno("Error al leer pedido", err))
 				return
 			}
 
@@ -326,7 +346,7 @@ func AdminGetPedidosConDetalles(dbConn *db.DBConnection) http.HandlerFunc {
 				"id_usuario":        p.IDUsuario,
 				"id_tienda":         p.IDTienda,
 				"id_sucursal":       p.IDSucursal,
-				"fecha_creacion":    p.FechaCreacion,
+				"fecha_creacion":    horaLocal(r.Context(), p.FechaCreacion),
 				"fecha_entrega":     NullToStr(p.FechaEntrega),
 				"subtotal":          p.Subtotal,
 				"descuento":         p.Descuento,
@@ -350,7 +370,7 @@ func AdminGetPedidosConDetalles(dbConn *db.DBConnection) http.HandlerFunc {
 				"nombre_sucursal":   NullToStr(p.NombreSucursal), // CORRECCIÓN: Usar NullToStr
 			}
 
-			detRows, err := dbConn.Local.Query(`
+			detRows, err := dbConn.Local.QueryContext(r.Context(), `
 				SELECT id_detalle, id_pedido, id_producto, clave_producto, descripcion, unidad, cantidad, precio_unitario,
 				       porcentaje_descuento, importe_descuento, subtotal, importe_iva, importe_ieps, total,
 				       latitud_entrega, longitud_entrega, estatus, comentarios, fecha_registro
@@ -358,7 +378,7 @@ func AdminGetPedidosConDetalles(dbConn *db.DBConnection) http.HandlerFunc {
 				WHERE id_pedido = ?
 			`, p.IDPedido)
 			if err != nil {
-				writeErrorResponse(w, http.StatusInternalServerError, "Error al consultar detalles", err.Error())
+				errores.Escribir(w, r, errores.Interno("Error al consultar detalles", err))
 				return
 			}
 			var detalles []map[string]interface{}
@@ -446,26 +466,30 @@ func AdminGetPedidosConDetalles(dbConn *db.DBConnection) http.HandlerFunc {
 
 func AdminGetPedidoByID(dbConn *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
 		idPedidoStr := mux.Vars(r)["id_pedido"]
 		idPedido, err := strconv.ParseInt(idPedidoStr, 10, 64)
 		if err != nil {
-			writeErrorResponse(w, http.StatusBadRequest, "ID de pedido inválido", err.Error())
+			errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_pedido")).Con("ID de pedido inválido", err))
 			return
 		}
 		var pedido map[string]interface{}
-		row := dbConn.Local.QueryRow(`
+		row := dbConn.Local.QueryRowContext(r.Context(), `
 			SELECT 
 				p.id_pedido, p.clave_unica, p.id_usuario, p.id_tienda, p.id_sucursal, p.fecha_creacion, p.fecha_entrega,
 				p.subtotal, p.descuento, p.iva, p.ieps, p.total, p.id_metodo_pago, p.referencia_pago, p.direccion_entrega,
 				p.colonia_entrega, p.cp_entrega, p.ciudad_entrega, p.estado_entrega, p.latitud_entrega, p.longitud_entrega,
-				p.estatus, p.comentarios, p.origen_pedido, p.id_lista_precio,
+				p.estatus, p.comentarios, p.origen_pedido, p.id_lista_precio, p.explicacion_entrega,
 				u.nombre_completo as nombre_usuario,
 				s.sucursal as nombre_sucursal
 			FROM pedidos p
 			LEFT JOIN usuarios u ON u.id_usuario = p.id_usuario
 			LEFT JOIN adm_sucursales s ON s.idsucursal = p.id_sucursal
-			WHERE p.id_pedido = ?
-		`, idPedido)
+			WHERE p.id_empresa = ? AND p.id_pedido = ?
+		`, idEmpresa, idPedido)
 		var p struct {
 			IDPedido         int64
 			ClaveUnica       string
@@ -492,6 +516,7 @@ func AdminGetPedidoByID(dbConn *db.DBConnection) http.HandlerFunc {
 			Comentarios      sql.NullString
 			OrigenPedido     string
 			IDListaPrecio    int
+			ExplicacionEntrega sql.NullString
 			NombreUsuario    sql.NullString
 			NombreSucursal   sql.NullString
 		}
@@ -521,14 +546,15 @@ func AdminGetPedidoByID(dbConn *db.DBConnection) http.HandlerFunc {
 			&p.Comentarios,
 			&p.OrigenPedido,
 			&p.IDListaPrecio,
+			&p.ExplicacionEntrega,
 			&p.NombreUsuario,
 			&p.NombreSucursal,
 		)
 		if err == sql.ErrNoRows {
-			writeErrorResponse(w, http.StatusNotFound, "Pedido no encontrado", "")
+			errores.Escribir(w, r, errores.Nuevo(errores.PedidoNoEncontrado))
 			return
 		} else if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "Error al consultar el pedido", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error al consultar el pedido", err))
 			return
 		}
 		pedido = map[string]interface{}{
@@ -537,7 +563,7 @@ func AdminGetPedidoByID(dbConn *db.DBConnection) http.HandlerFunc {
 			"id_usuario":        p.IDUsuario,
 			"id_tienda":         p.IDTienda,
 			"id_sucursal":       p.IDSucursal,
-			"fecha_creacion":    p.FechaCreacion,
+			"fecha_creacion":    horaLocal(r.Context(), p.FechaCreacion),
 			"fecha_entrega":     NullToStr(p.FechaEntrega),
 			"subtotal":          p.Subtotal,
 			"descuento":         p.Descuento,
@@ -557,10 +583,11 @@ func AdminGetPedidoByID(dbConn *db.DBConnection) http.HandlerFunc {
 			"comentarios":       NullToStr(p.Comentarios),
 			"origen_pedido":     p.OrigenPedido,
 			"id_lista_precio":   p.IDListaPrecio,
+			"explicacion_entrega": NullToStr(p.ExplicacionEntrega),
 			"nombre_usuario":    NullToStr(p.NombreUsuario),
 			"nombre_sucursal":   NullToStr(p.NombreSucursal),
 		}
-		rows, err := dbConn.Local.Query(`
+		rows, err := dbConn.Local.QueryContext(r.Context(), `
 			SELECT id_detalle, id_pedido, id_producto, clave_producto, descripcion, unidad, cantidad, precio_unitario,
 			       porcentaje_descuento, importe_descuento, subtotal, importe_iva, importe_ieps, total,
 			       latitud_entrega, longitud_entrega, estatus, comentarios, fecha_registro
@@ -568,7 +595,7 @@ func AdminGetPedidoByID(dbConn *db.DBConnection) http.HandlerFunc {
 			WHERE id_pedido = ?
 		`, idPedido)
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "Error al consultar detalles", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error al consultar detalles", err))
 			return
 		}
 		defer rows.Close()
@@ -653,6 +680,10 @@ func AdminGetPedidoByID(dbConn *db.DBConnection) http.HandlerFunc {
 
 func AdminGetPedidosConDetallesPaginado(dbConn *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
 		// Parámetros de paginación
 		pageStr := r.URL.Query().Get("page")
 		perPageStr := r.URL.Query().Get("perPage")
@@ -672,8 +703,8 @@ func AdminGetPedidosConDetallesPaginado(dbConn *db.DBConnection) http.HandlerFun
 		busqueda := r.URL.Query().Get("busqueda")
 
 		// WHERE dinámico
-		where := " WHERE 1=1 "
-		args := []interface{}{}
+		where := " WHERE p.id_empresa = ? "
+		args := []interface{}{idEmpresa}
 
 		if estatus != "" {
 			where += " AND p.estatus = ? "
@@ -708,9 +739,9 @@ func AdminGetPedidosConDetallesPaginado(dbConn *db.DBConnection) http.HandlerFun
 			LEFT JOIN adm_sucursales s ON s.idsucursal = p.id_sucursal
 			` + where
 		var totalPedidos int
-		err = dbConn.Local.QueryRow(countQuery, args...).Scan(&totalPedidos)
+		err = dbConn.Local.QueryRowContext(r.Context(), countQuery, args...).Scan(&totalPedidos)
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "Error al contar pedidos", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error al contar pedidos", err))
 			return
 		}
 
@@ -731,9 +762,9 @@ func AdminGetPedidosConDetallesPaginado(dbConn *db.DBConnection) http.HandlerFun
 			LIMIT ? OFFSET ?
 		`
 		argsWithLimit := append(args, perPage, offset)
-		rows, err := dbConn.Local.Query(query, argsWithLimit...)
+		rows, err := dbConn.Local.QueryContext(r.Context(), query, argsWithLimit...)
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "Error al consultar pedidos", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error al consultar pedidos", err))
 			return
 		}
 		defer rows.Close()
@@ -799,7 +830,7 @@ func AdminGetPedidosConDetallesPaginado(dbConn *db.DBConnection) http.HandlerFun
 				&p.NombreSucursal,
 			)
 			if err != nil {
-				writeErrorResponse(w, http.StatusInternalServerError, "Error al leer pedido", err.Error())
+				errores.Escribir(w, r, errores.Interno("Error al leer pedido", err))
 				return
 			}
 
@@ -809,7 +840,7 @@ func AdminGetPedidosConDetallesPaginado(dbConn *db.DBConnection) http.HandlerFun
 				"id_usuario":        p.IDUsuario,
 				"id_tienda":         p.IDTienda,
 				"id_sucursal":       p.IDSucursal,
-				"fecha_creacion":    p.FechaCreacion,
+				"fecha_creacion":    horaLocal(r.Context(), p.FechaCreacion),
 				"fecha_entrega":     NullToStr(p.FechaEntrega),
 				"subtotal":          p.Subtotal,
 				"descuento":         p.Descuento,
@@ -833,7 +864,7 @@ func AdminGetPedidosConDetallesPaginado(dbConn *db.DBConnection) http.HandlerFun
 				"nombre_sucursal":   NullToStr(p.NombreSucursal),
 			}
 
-			detRows, err := dbConn.Local.Query(`
+			detRows, err := dbConn.Local.QueryContext(r.Context(), `
 				SELECT id_detalle, id_pedido, id_producto, clave_producto, descripcion, unidad, cantidad, precio_unitario,
 				       porcentaje_descuento, importe_descuento, subtotal, importe_iva, importe_ieps, total,
 				       latitud_entrega, longitud_entrega, estatus, comentarios, fecha_registro
@@ -841,7 +872,7 @@ func AdminGetPedidosConDetallesPaginado(dbConn *db.DBConnection) http.HandlerFun
 				WHERE id_pedido = ?
 			`, p.IDPedido)
 			if err != nil {
-				writeErrorResponse(w, http.StatusInternalServerError, "Error al consultar detalles", err.Error())
+				errores.Escribir(w, r, errores.Interno("Error al consultar detalles", err))
 				return
 			}
 			var detalles []map[string]interface{}
@@ -889,7 +920,7 @@ func AdminGetPedidosConDetallesPaginado(dbConn *db.DBConnection) http.HandlerFun
 					&d.FechaRegistro,
 				)
 				if err != nil {
-					writeErrorResponse(w, http.StatusInternalServerError, "Error al leer detalle de pedido", err.Error())
+					errores.Escribir(w, r, errores.Interno("Error al leer detalle de pedido", err))
 					return
 				}
 				fechaRegistroStr := ""
@@ -0,0 +1,70 @@
+package rutas
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/repositorio"
+	"github.com/gorilla/mux"
+)
+
+func TestAdminAplicarDescuentoPedido(t *testing.T) {
+	casos := []struct {
+		nombre    string
+		idPedido  string
+		idEmpresa int
+		body      string
+		falla     error
+		status    int
+		totalEsp  float64
+		descuento float64
+	}{
+		{nombre: "descuento aplicado", idPedido: "1", body: `{"descuento": 10}`, status: http.StatusOK, totalEsp: 114, descuento: 10},
+		{nombre: "total no baja de cero", idPedido: "1", body: `{"descuento": 500}`, status: http.StatusOK, totalEsp: 0, descuento: 500},
+		{nombre: "descuento negativo", idPedido: "1", body: `{"descuento": -1}`, status: http.StatusBadRequest, totalEsp: 124},
+		{nombre: "id inválido", idPedido: "abc", body: `{"descuento": 1}`, status: http.StatusBadRequest, totalEsp: 124},
+		{nombre: "pedido inexistente", idPedido: "42", body: `{"descuento": 1}`, status: http.StatusNotFound, totalEsp: 124},
+		{nombre: "pedido de otra empresa", idPedido: "1", idEmpresa: 2, body: `{"descuento": 1}`, status: http.StatusNotFound, totalEsp: 124},
+		{nombre: "json inválido", idPedido: "1", body: `{`, status: http.StatusBadRequest, totalEsp: 124},
+		{nombre: "falla al guardar", idPedido: "1", body: `{"descuento": 1}`, falla: errors.New("sin conexión"), status: http.StatusInternalServerError, totalEsp: 124},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			m := repositorio.NuevaMemoria()
+			m.Pedidos[1] = &repositorio.PedidoMemoria{IDPedido: 1, Pedido: repositorio.NuevoPedido{
+				IDEmpresa: 1, Subtotal: 100, IVA: 16, IEPS: 8, Total: 124,
+			}}
+			m.Falla = func(op string) error {
+				if op == "Pedidos.AplicarDescuento" {
+					return c.falla
+				}
+				return nil
+			}
+
+			idEmpresa := c.idEmpresa
+			if idEmpresa == 0 {
+				idEmpresa = 1
+			}
+			req := httptest.NewRequest(http.MethodPut, "/api/pedidos/"+c.idPedido+"/descuento", strings.NewReader(c.body))
+			req = mux.SetURLVars(conEmpresa(req, idEmpresa), map[string]string{"id_pedido": c.idPedido})
+			rec := httptest.NewRecorder()
+			AdminAplicarDescuentoPedido(m.Repositorios())(rec, req)
+
+			if rec.Code != c.status {
+				t.Fatalf("status = %d, se esperaba %d (body %s)", rec.Code, c.status, rec.Body)
+			}
+			p := m.Pedidos[1].Pedido
+			if !casiIgual(p.Total, c.totalEsp) || !casiIgual(p.Descuento, c.descuento) {
+				t.Errorf("pedido guardado: total %v descuento %v, se esperaba %v/%v", p.Total, p.Descuento, c.totalEsp, c.descuento)
+			}
+			if c.status == http.StatusOK {
+				if got := respuestaExito(t, rec)["total_final"].(float64); !casiIgual(got, c.totalEsp) {
+					t.Errorf("total_final = %v", got)
+				}
+			}
+		})
+	}
+}
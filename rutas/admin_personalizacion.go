@@ -3,11 +3,13 @@ package rutas
 import (
 	"database/sql"
 	"encoding/json"
-	"io/ioutil"
 	"net/http"
 	"time"
 
 	"github.com/WolfSlayer04/logica_tiendaenlina/db"
+	"github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+	"github.com/WolfSlayer04/logica_tiendaenlina/validacion"
 	"github.com/gorilla/mux"
 )
 
@@ -18,23 +20,16 @@ type EmpresaConfigVisual struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
-func getUniqueIDEmpresa(dbConn *db.DBConnection) (int, error) {
-	var idempresa int
-	err := dbConn.Local.QueryRow("SELECT idempresa FROM adm_empresas LIMIT 1").Scan(&idempresa)
-	return idempresa, err
-}
-
 func AdminGetAllPersonalizaciones(dbConn *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		idempresa, err := getUniqueIDEmpresa(dbConn)
-		if err != nil {
-			http.Error(w, "No se pudo obtener idempresa: "+err.Error(), http.StatusInternalServerError)
+		idempresa, ok := empresas.Requerida(w, r)
+		if !ok {
 			return
 		}
 
-		rows, err := dbConn.Local.Query("SELECT id, idempresa, config, updated_at FROM empresa_config_visual WHERE idempresa = ?", idempresa)
+		rows, err := dbConn.Local.QueryContext(r.Context(), "SELECT id, idempresa, config, updated_at FROM empresa_config_visual WHERE idempresa = ?", idempresa)
 		if err != nil {
-			http.Error(w, "Error de base de datos: "+err.Error(), http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
 			return
 		}
 		defer rows.Close()
@@ -67,19 +62,23 @@ func AdminGetAllPersonalizaciones(dbConn *db.DBConnection) http.HandlerFunc {
 
 func AdminGetPersonalizacionByID(dbConn *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		idempresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
 		vars := mux.Vars(r)
 		id := vars["id"]
 
 		var ecv EmpresaConfigVisual
 		var updatedAtRaw interface{}
-		err := dbConn.Local.QueryRow("SELECT id, idempresa, config, updated_at FROM empresa_config_visual WHERE id = ?", id).
+		err := dbConn.Local.QueryRowContext(r.Context(), "SELECT id, idempresa, config, updated_at FROM empresa_config_visual WHERE id = ? AND idempresa = ?", id, idempresa).
 			Scan(&ecv.ID, &ecv.IDEmpresa, &ecv.Config, &updatedAtRaw)
 		if err != nil {
 			if err == sql.ErrNoRows {
-				http.Error(w, "No hay configuración visual con ese id", http.StatusNotFound)
+				errores.Escribir(w, r, errores.Nuevo(errores.PersonalizacionNoEncontrada))
 				return
 			}
-			http.Error(w, "Error de base de datos: "+err.Error(), http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
 			return
 		}
 		switch v := updatedAtRaw.(type) {
@@ -102,28 +101,29 @@ func AdminGetPersonalizacionByID(dbConn *db.DBConnection) http.HandlerFunc {
 
 func AdminCreatePersonalizacion(dbConn *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		idempresa, err := getUniqueIDEmpresa(dbConn)
-		if err != nil {
-			http.Error(w, "No se pudo obtener idempresa: "+err.Error(), http.StatusInternalServerError)
+		idempresa, ok := empresas.Requerida(w, r)
+		if !ok {
 			return
 		}
-		body, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			http.Error(w, "No se pudo leer el body", http.StatusBadRequest)
+		// La configuración es libre: se guarda tal cual llega, pero con el
+		// límite de tamaño y siempre que sea un objeto JSON
+		var body json.RawMessage
+		if err := validacion.Leer(w, r, &body); err != nil {
+			errores.Escribir(w, r, err)
 			return
 		}
 		var configData map[string]interface{}
-		if err := json.Unmarshal(body, &configData); err != nil {
-			http.Error(w, "Body no es JSON válido: "+err.Error(), http.StatusBadRequest)
+		if err := json.Unmarshal(body, &configData); err != nil || configData == nil {
+			errores.Escribir(w, r, errores.Nuevo(errores.JSONInvalido).Con("Body no es un objeto JSON", err))
 			return
 		}
 		configStr := string(body)
-		res, err := dbConn.Local.Exec(`
+		res, err := dbConn.Local.ExecContext(r.Context(), `
 			INSERT INTO empresa_config_visual (idempresa, config, updated_at)
 			VALUES (?, ?, NOW())
 		`, idempresa, configStr)
 		if err != nil {
-			http.Error(w, "Error al crear registro: "+err.Error(), http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error al crear registro", err))
 			return
 		}
 		id, _ := res.LastInsertId()
@@ -140,27 +140,33 @@ func AdminCreatePersonalizacion(dbConn *db.DBConnection) http.HandlerFunc {
 
 func AdminUpdatePersonalizacionByID(dbConn *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		idempresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
 		vars := mux.Vars(r)
 		id := vars["id"]
 
-		body, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			http.Error(w, "No se pudo leer el body", http.StatusBadRequest)
+		// La configuración es libre: se guarda tal cual llega, pero con el
+		// límite de tamaño y siempre que sea un objeto JSON
+		var body json.RawMessage
+		if err := validacion.Leer(w, r, &body); err != nil {
+			errores.Escribir(w, r, err)
 			return
 		}
 		var configData map[string]interface{}
-		if err := json.Unmarshal(body, &configData); err != nil {
-			http.Error(w, "Body no es JSON válido: "+err.Error(), http.StatusBadRequest)
+		if err := json.Unmarshal(body, &configData); err != nil || configData == nil {
+			errores.Escribir(w, r, errores.Nuevo(errores.JSONInvalido).Con("Body no es un objeto JSON", err))
 			return
 		}
 		configStr := string(body)
-		res, err := dbConn.Local.Exec(`
+		res, err := dbConn.Local.ExecContext(r.Context(), `
 			UPDATE empresa_config_visual
 			SET config = ?, updated_at = NOW()
-			WHERE id = ?
-		`, configStr, id)
+			WHERE id = ? AND idempresa = ?
+		`, configStr, id, idempresa)
 		if err != nil {
-			http.Error(w, "Error al actualizar registro: "+err.Error(), http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error al actualizar registro", err))
 			return
 		}
 		rows, _ := res.RowsAffected()
@@ -176,12 +182,16 @@ func AdminUpdatePersonalizacionByID(dbConn *db.DBConnection) http.HandlerFunc {
 
 func AdminDeletePersonalizacionByID(dbConn *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		idempresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
 		vars := mux.Vars(r)
 		id := vars["id"]
 
-		res, err := dbConn.Local.Exec("DELETE FROM empresa_config_visual WHERE id = ?", id)
+		res, err := dbConn.Local.ExecContext(r.Context(), "DELETE FROM empresa_config_visual WHERE id = ? AND idempresa = ?", id, idempresa)
 		if err != nil {
-			http.Error(w, "Error al borrar registro: "+err.Error(), http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error al borrar registro", err))
 			return
 		}
 		rows, _ := res.RowsAffected()
@@ -7,6 +7,9 @@ import (
 	"strconv"
 
 	"github.com/WolfSlayer04/logica_tiendaenlina/db"
+	"github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+	"github.com/WolfSlayer04/logica_tiendaenlina/validacion"
 
 	"github.com/gorilla/mux"
 )
@@ -28,11 +31,15 @@ type Sucursal struct {
 
 func GetSucursalALL(dbConn *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
 		query := `SELECT idsucursal, idempresa, sucursal, direccion, ciudad, colonia, cp, estatus, tipo_objeto, radio, lista_precios
-				  FROM adm_sucursales`
-		rows, err := dbConn.Local.Query(query)
+				  FROM adm_sucursales WHERE idempresa = ?`
+		rows, err := dbConn.Local.QueryContext(r.Context(), query, idEmpresa)
 		if err != nil {
-			http.Error(w, "Error de base de datos", http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
 			return
 		}
 		defer rows.Close()
@@ -45,14 +52,14 @@ func GetSucursalALL(dbConn *db.DBConnection) http.HandlerFunc {
 				&s.Colonia, &s.CP, &s.Estatus, &s.TipoObjeto, &s.Radio, &s.ListaPrecios,
 			)
 			if err != nil {
-				http.Error(w, "Error leyendo sucursales", http.StatusInternalServerError)
+				errores.Escribir(w, r, errores.Interno("Error leyendo sucursales", err))
 				return
 			}
 			sucursales = append(sucursales, s)
 		}
 
 		if err := rows.Err(); err != nil {
-			http.Error(w, "Error finalizando la consulta", http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error finalizando la consulta", err))
 			return
 		}
 
@@ -64,24 +71,28 @@ func GetSucursalALL(dbConn *db.DBConnection) http.HandlerFunc {
 // GET /api/sucursales/{id}: Obtiene la info completa de la sucursal
 func GetSucursal(dbConn *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
 		vars := mux.Vars(r)
 		id, err := strconv.Atoi(vars["id"])
 		if err != nil {
-			http.Error(w, "ID de sucursal inválido", http.StatusBadRequest)
+			errores.Escribir(w, r, errores.Validacion(errores.Invalido("id")).Con("ID de sucursal inválido", err))
 			return
 		}
 		var s Sucursal
 		query := `SELECT idsucursal, idempresa, sucursal, direccion, ciudad, colonia, cp, estatus, tipo_objeto, radio, lista_precios
-				  FROM adm_sucursales WHERE idsucursal = ?`
-		err = dbConn.Local.QueryRow(query, id).Scan(
+				  FROM adm_sucursales WHERE idempresa = ? AND idsucursal = ?`
+		err = dbConn.Local.QueryRowContext(r.Context(), query, idEmpresa, id).Scan(
 			&s.IDSucursal, &s.IDEmpresa, &s.Sucursal, &s.Direccion, &s.Ciudad,
 			&s.Colonia, &s.CP, &s.Estatus, &s.TipoObjeto, &s.Radio, &s.ListaPrecios,
 		)
 		if err == sql.ErrNoRows {
-			http.Error(w, "Sucursal no encontrada", http.StatusNotFound)
+			errores.Escribir(w, r, errores.Nuevo(errores.SucursalNoEncontrada))
 			return
 		} else if err != nil {
-			http.Error(w, "Error de base de datos", http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -92,31 +103,31 @@ func GetSucursal(dbConn *db.DBConnection) http.HandlerFunc {
 // PUT /api/sucursales/{id}/lista-precios: Cambia la lista de precios para la sucursal
 func UpdateListaPreciosSucursal(dbConn *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
 		vars := mux.Vars(r)
 		id, err := strconv.Atoi(vars["id"])
 		if err != nil {
-			http.Error(w, "ID de sucursal inválido", http.StatusBadRequest)
+			errores.Escribir(w, r, errores.Validacion(errores.Invalido("id")).Con("ID de sucursal inválido", err))
 			return
 		}
 		var body struct {
-			ListaPrecios int `json:"lista_precios"`
+			ListaPrecios int `json:"lista_precios" valida:"rango=1:25"`
 		}
-		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-			http.Error(w, "JSON inválido", http.StatusBadRequest)
+		if err := validacion.Decodificar(w, r, &body); err != nil {
+			errores.Escribir(w, r, err)
 			return
 		}
-		if body.ListaPrecios < 1 || body.ListaPrecios > 25 {
-			http.Error(w, "La lista de precios debe estar entre 1 y 25", http.StatusBadRequest)
-			return
-		}
-		res, err := dbConn.Local.Exec("UPDATE adm_sucursales SET lista_precios = ? WHERE idsucursal = ?", body.ListaPrecios, id)
+		res, err := dbConn.Local.ExecContext(r.Context(), "UPDATE adm_sucursales SET lista_precios = ? WHERE idempresa = ? AND idsucursal = ?", body.ListaPrecios, idEmpresa, id)
 		if err != nil {
-			http.Error(w, "Error actualizando lista de precios", http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error actualizando lista de precios", err))
 			return
 		}
 		affected, _ := res.RowsAffected()
 		if affected == 0 {
-			http.Error(w, "Sucursal no encontrada", http.StatusNotFound)
+			errores.Escribir(w, r, errores.Nuevo(errores.SucursalNoEncontrada))
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -127,20 +138,24 @@ func UpdateListaPreciosSucursal(dbConn *db.DBConnection) http.HandlerFunc {
 // GET /api/sucursales/{id}/productos: Lista productos con precio de la lista seleccionada en la sucursal
 func GetProductosSucursal(dbConn *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
 		vars := mux.Vars(r)
 		id, err := strconv.Atoi(vars["id"])
 		if err != nil {
-			http.Error(w, "ID de sucursal inválido", http.StatusBadRequest)
+			errores.Escribir(w, r, errores.Validacion(errores.Invalido("id")).Con("ID de sucursal inválido", err))
 			return
 		}
 		// Obtener lista_precios
 		var listaPrecios int
-		err = dbConn.Local.QueryRow("SELECT lista_precios FROM adm_sucursales WHERE idsucursal = ?", id).Scan(&listaPrecios)
+		err = dbConn.Local.QueryRowContext(r.Context(), "SELECT lista_precios FROM adm_sucursales WHERE idempresa = ? AND idsucursal = ?", idEmpresa, id).Scan(&listaPrecios)
 		if err == sql.ErrNoRows {
-			http.Error(w, "Sucursal no encontrada", http.StatusNotFound)
+			errores.Escribir(w, r, errores.Nuevo(errores.SucursalNoEncontrada))
 			return
 		} else if err != nil {
-			http.Error(w, "Error de base de datos", http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
 			return
 		}
 		if listaPrecios < 1 || listaPrecios > 25 {
@@ -155,11 +170,11 @@ func GetProductosSucursal(dbConn *db.DBConnection) http.HandlerFunc {
 				ieps_adic, con_ieps_adic, unidad, unidad_ent, factor_conversion, sat_clave, sat_medida, volumen, peso,
 				idmoneda, lote, desc_ticket, cant_sig_lista, en_venta
 			FROM crm_productos
-			WHERE estatus = 'S'
+			WHERE idempresa = ? AND estatus = 'S'
 		`
-		rows, err := dbConn.Local.Query(query)
+		rows, err := dbConn.Local.QueryContext(r.Context(), query, idEmpresa)
 		if err != nil {
-			http.Error(w, "Error obteniendo productos", http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error obteniendo productos", err))
 			return
 		}
 		defer rows.Close()
@@ -175,7 +190,7 @@ func GetProductosSucursal(dbConn *db.DBConnection) http.HandlerFunc {
 				&p.Peso, &p.IDMoneda, &p.Lote, &p.DescTicket, &p.CantSigLista, &p.EnVenta,
 			)
 			if err != nil {
-				http.Error(w, "Error leyendo productos", http.StatusInternalServerError)
+				errores.Escribir(w, r, errores.Interno("Error leyendo productos", err))
 				return
 			}
 
@@ -274,19 +289,23 @@ func GetProductosSucursal(dbConn *db.DBConnection) http.HandlerFunc {
 // GET /api/sucursales/{id}/lista-precios
 func GetListaPreciosSucursal(dbConn *db.DBConnection) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
+        idEmpresa, ok := empresas.Requerida(w, r)
+        if !ok {
+            return
+        }
         vars := mux.Vars(r)
         id, err := strconv.Atoi(vars["id"])
         if err != nil {
-            http.Error(w, "ID de sucursal inválido", http.StatusBadRequest)
+            errores.Escribir(w, r, errores.Validacion(errores.Invalido("id")).Con("ID de sucursal inválido", err))
             return
         }
         var listaPrecios int
-        err = dbConn.Local.QueryRow("SELECT lista_precios FROM adm_sucursales WHERE idsucursal = ?", id).Scan(&listaPrecios)
+        err = dbConn.Local.QueryRowContext(r.Context(), "SELECT lista_precios FROM adm_sucursales WHERE idempresa = ? AND idsucursal = ?", idEmpresa, id).Scan(&listaPrecios)
         if err == sql.ErrNoRows {
-            http.Error(w, "Sucursal no encontrada", http.StatusNotFound)
+            errores.Escribir(w, r, errores.Nuevo(errores.SucursalNoEncontrada))
             return
         } else if err != nil {
-            http.Error(w, "Error de base de datos", http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
             return
         }
         w.Header().Set("Content-Type", "application/json")
@@ -8,6 +8,9 @@ import (
     "sync"
 
     "github.com/WolfSlayer04/logica_tiendaenlina/db"
+    "github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+    "github.com/WolfSlayer04/logica_tiendaenlina/errores"
+    "github.com/WolfSlayer04/logica_tiendaenlina/validacion"
 
     "github.com/gorilla/mux"
 )
@@ -29,32 +32,30 @@ var (
 // AddToCart agrega o actualiza un producto en el carrito (suma cantidad)
 func AddToCart(dbc *db.DBConnection) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
-        var req struct {
-            IDProducto int     `json:"idproducto"`
-            Cantidad   int     `json:"cantidad"`
-            Precio     float64 `json:"precio"`
-        }
-
-        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-            http.Error(w, "Datos inválidos", http.StatusBadRequest)
+        idEmpresa, ok := empresas.Requerida(w, r)
+        if !ok {
             return
         }
+        var req struct {
+            IDProducto int     `json:"idproducto" valida:"requerido,mayor_cero"`
+            Cantidad   int     `json:"cantidad" valida:"mayor_cero"`
+            Precio     float64 `json:"precio" valida:"no_negativo"`
+        }
 
-        // Validación básica
-        if req.IDProducto <= 0 || req.Cantidad <= 0 || req.Precio < 0 {
-            http.Error(w, "Datos incompletos", http.StatusBadRequest)
+        if err := validacion.Decodificar(w, r, &req); err != nil {
+            errores.Escribir(w, r, err)
             return
         }
 
         // Verificar que el producto exista y esté activo
         var exists bool
-        err := dbc.Local.QueryRow("SELECT EXISTS(SELECT 1 FROM crm_productos WHERE idproducto = ? AND estatus = 'S')", req.IDProducto).Scan(&exists)
+        err := dbc.Local.QueryRowContext(r.Context(), "SELECT EXISTS(SELECT 1 FROM crm_productos WHERE idempresa = ? AND idproducto = ? AND estatus = 'S')", idEmpresa, req.IDProducto).Scan(&exists)
         if err != nil {
-            http.Error(w, "Error al verificar el producto", http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("Error al verificar el producto", err))
             return
         }
         if !exists {
-            http.Error(w, "Producto no encontrado o inactivo", http.StatusNotFound)
+            errores.Escribir(w, r, errores.Nuevo(errores.ProductoNoEncontrado))
             return
         }
 
@@ -84,17 +85,12 @@ func AddToCart(dbc *db.DBConnection) http.HandlerFunc {
 func UpdateCartItem(dbc *db.DBConnection) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
         var req struct {
-            IDProducto int `json:"idproducto"`
-            Cantidad   int `json:"cantidad"`
-        }
-
-        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-            http.Error(w, "Datos inválidos", http.StatusBadRequest)
-            return
+            IDProducto int `json:"idproducto" valida:"requerido,mayor_cero"`
+            Cantidad   int `json:"cantidad" valida:"no_negativo"`
         }
 
-        if req.IDProducto <= 0 || req.Cantidad < 0 {
-            http.Error(w, "Datos incompletos", http.StatusBadRequest)
+        if err := validacion.Decodificar(w, r, &req); err != nil {
+            errores.Escribir(w, r, err)
             return
         }
 
@@ -103,7 +99,7 @@ func UpdateCartItem(dbc *db.DBConnection) http.HandlerFunc {
 
         item, exists := cartItems[req.IDProducto]
         if !exists {
-            http.Error(w, "Producto no está en el carrito", http.StatusNotFound)
+            errores.Escribir(w, r, errores.Nuevo(errores.ProductoNoEnCarrito))
             return
         }
 
@@ -125,12 +121,12 @@ func RemoveFromCart(dbc *db.DBConnection) http.HandlerFunc {
         vars := mux.Vars(r)
         idStr, ok := vars["idproducto"]
         if !ok {
-            http.Error(w, "ID de producto faltante", http.StatusBadRequest)
+            errores.Escribir(w, r, errores.Validacion(errores.Requerido("idproducto")))
             return
         }
         id, err := strconv.Atoi(idStr)
         if err != nil || id <= 0 {
-            http.Error(w, "ID de producto inválido", http.StatusBadRequest)
+            errores.Escribir(w, r, errores.Validacion(errores.Invalido("idproducto")))
             return
         }
 
@@ -138,7 +134,7 @@ func RemoveFromCart(dbc *db.DBConnection) http.HandlerFunc {
         defer mu.Unlock()
         _, exists := cartItems[id]
         if !exists {
-            http.Error(w, "Producto no está en el carrito", http.StatusNotFound)
+            errores.Escribir(w, r, errores.Nuevo(errores.ProductoNoEnCarrito))
             return
         }
         delete(cartItems, id)
@@ -180,9 +176,9 @@ func GetCart(dbc *db.DBConnection) http.HandlerFunc {
 
         query := "SELECT idproducto, descripcion FROM crm_productos WHERE idproducto IN (" + placeholders + ")"
 
-        rows, err := dbc.Local.Query(query, args...)
+        rows, err := dbc.Local.QueryContext(r.Context(), query, args...)
         if err != nil {
-            http.Error(w, "Error al cargar descripciones", http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("Error al cargar descripciones", err))
             return
         }
         defer rows.Close()
@@ -0,0 +1,136 @@
+package rutas
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+	"github.com/WolfSlayer04/logica_tiendaenlina/geocerca"
+	"github.com/WolfSlayer04/logica_tiendaenlina/reloj"
+	"github.com/WolfSlayer04/logica_tiendaenlina/repositorio"
+)
+
+// proximasFechas es cuántos horarios con lugar se informan en /cobertura.
+const proximasFechas = 3
+
+// SucursalCobertura es la sucursal que atendería una ubicación.
+type SucursalCobertura struct {
+	IDSucursal int    `json:"id_sucursal"`
+	Nombre     string `json:"nombre"`
+}
+
+// CoberturaUbicacion dice si una ubicación está dentro de la cobertura de
+// alguna sucursal. Sin cobertura, Sucursal es la más cercana; si ninguna
+// sucursal tiene cobertura, nil.
+type CoberturaUbicacion struct {
+	Cubierta         bool               `json:"cubierta"`
+	Sucursal         *SucursalCobertura `json:"sucursal"`
+	DistanciaKm      float64            `json:"distancia_km"`
+	DistanciaBordeKm float64            `json:"distancia_borde_km"`
+}
+
+// Cobertura es la respuesta de /cobertura: la de la ubicación y, si está
+// cubierta, los próximos horarios de entrega con lugar.
+type Cobertura struct {
+	CoberturaUbicacion
+	ProximasFechas []map[string]interface{} `json:"proximas_fechas"`
+}
+
+// coberturaDe busca la sucursal que atendería la ubicación.
+func coberturaDe(ctx context.Context, sucursales repositorio.SucursalRepo, idEmpresa int, lat, lng float64) (CoberturaUbicacion, error) {
+	asignada, err := sucursales.PorUbicacion(ctx, idEmpresa, lat, lng)
+	if errors.Is(err, geocerca.ErrSinSucursales) {
+		return CoberturaUbicacion{}, nil
+	} else if err != nil {
+		return CoberturaUbicacion{}, err
+	}
+	return CoberturaUbicacion{
+		Cubierta:         asignada.EnCobertura,
+		Sucursal:         &SucursalCobertura{IDSucursal: asignada.IDSucursal, Nombre: asignada.Nombre},
+		DistanciaKm:      round(asignada.DistanciaKm, 3),
+		DistanciaBordeKm: round(asignada.DistanciaBordeKm, 3),
+	}, nil
+}
+
+// coordenada lee un parámetro de consulta numérico entre -limite y limite.
+func coordenada(r *http.Request, nombre string, limite float64) (float64, *errores.Campo) {
+	valor := r.URL.Query().Get(nombre)
+	if valor == "" {
+		c := errores.Requerido(nombre)
+		return 0, &c
+	}
+	f, err := strconv.ParseFloat(valor, 64)
+	if err != nil {
+		c := errores.Invalido(nombre)
+		return 0, &c
+	}
+	if f < -limite || f > limite {
+		c := errores.NuevoCampo(nombre, errores.CampoFueraDeRango, -limite, limite)
+		return 0, &c
+	}
+	return f, nil
+}
+
+// GetCobertura dice, antes del registro, si ?lat=&lng= tiene cobertura, qué
+// sucursal lo atendería y sus próximos horarios de entrega con lugar. Es
+// público: no crea nada.
+func GetCobertura(repos repositorio.Repositorios) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var campos []errores.Campo
+		lat, c := coordenada(r, "lat", 90)
+		if c != nil {
+			campos = append(campos, *c)
+		}
+		lng, c := coordenada(r, "lng", 180)
+		if c != nil {
+			campos = append(campos, *c)
+		}
+		if len(campos) > 0 {
+			errores.Escribir(w, r, errores.Validacion(campos...))
+			return
+		}
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+
+		ubicacion, err := coberturaDe(r.Context(), repos.Sucursales, idEmpresa, lat, lng)
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("No se pudo buscar la sucursal", err))
+			return
+		}
+		cobertura := Cobertura{CoberturaUbicacion: ubicacion, ProximasFechas: []map[string]interface{}{}}
+		if cobertura.Sucursal == nil {
+			writeSuccessResponse(w, "Ninguna sucursal tiene cobertura", cobertura)
+			return
+		}
+		if !cobertura.Cubierta {
+			writeSuccessResponse(w, "La ubicación está fuera de cobertura", cobertura)
+			return
+		}
+
+		idSucursal := cobertura.Sucursal.IDSucursal
+		config, err := ObtenerConfigEntrega(r.Context(), repos.Sucursales, idEmpresa, idSucursal)
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al obtener configuración de entregas", err))
+			return
+		}
+		fechas, err := fechasEntrega(r.Context(), repos, idEmpresa, idSucursal, config, reloj.Desde(r.Context()).Ahora())
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al obtener la ocupación de los horarios", err))
+			return
+		}
+		for _, f := range fechas {
+			if len(cobertura.ProximasFechas) == proximasFechas {
+				break
+			}
+			if f["disponible"] == true {
+				cobertura.ProximasFechas = append(cobertura.ProximasFechas, f)
+			}
+		}
+		writeSuccessResponse(w, "La ubicación tiene cobertura", cobertura)
+	}
+}
@@ -2,10 +2,12 @@ package rutas
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
+	"sort"
 	"github.com/WolfSlayer04/logica_tiendaenlina/db"
-	"time"
+	"github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+	"github.com/WolfSlayer04/logica_tiendaenlina/reloj"
 )
 
 type ProductosVendidosMes struct {
@@ -28,78 +30,77 @@ type DashboardStatsResponse struct {
 
 func GetDashboardStats(dbConn *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
 		var stats DashboardStatsResponse
+		// fecha_creacion está en UTC; el mes es el del negocio
+		now := reloj.Desde(r.Context()).Ahora()
+		inicioMes := reloj.InicioDelMes(now)
 
 		// Productos
-		err := dbConn.Local.QueryRow("SELECT COUNT(*) FROM crm_productos").Scan(&stats.ProductosTotal)
+		err := dbConn.Local.QueryRowContext(r.Context(), "SELECT COUNT(*) FROM crm_productos WHERE idempresa = ?", idEmpresa).Scan(&stats.ProductosTotal)
 		if err != nil {
-			log.Println("Error al contar productos:", err)
-			http.Error(w, "Error al contar productos", http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error al contar productos", err))
 			return
 		}
-		err = dbConn.Local.QueryRow("SELECT COUNT(*) FROM crm_productos WHERE estatus = 'S'").Scan(&stats.ProductosActivos)
+		err = dbConn.Local.QueryRowContext(r.Context(), "SELECT COUNT(*) FROM crm_productos WHERE idempresa = ? AND estatus = 'S'", idEmpresa).Scan(&stats.ProductosActivos)
 		if err != nil {
-			log.Println("Error al contar productos activos:", err)
-			http.Error(w, "Error al contar productos activos", http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error al contar productos activos", err))
 			return
 		}
 
 		// Pedidos
-		err = dbConn.Local.QueryRow("SELECT COUNT(*) FROM pedidos").Scan(&stats.PedidosTotal)
+		err = dbConn.Local.QueryRowContext(r.Context(), "SELECT COUNT(*) FROM pedidos WHERE id_empresa = ?", idEmpresa).Scan(&stats.PedidosTotal)
 		if err != nil {
-			log.Println("Error al contar pedidos:", err)
-			http.Error(w, "Error al contar pedidos", http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error al contar pedidos", err))
 			return
 		}
-		err = dbConn.Local.QueryRow("SELECT COUNT(*) FROM pedidos WHERE estatus = 'pendiente'").Scan(&stats.PedidosPendientes)
+		err = dbConn.Local.QueryRowContext(r.Context(), "SELECT COUNT(*) FROM pedidos WHERE id_empresa = ? AND estatus = 'pendiente'", idEmpresa).Scan(&stats.PedidosPendientes)
 		if err != nil {
-			log.Println("Error al contar pedidos pendientes:", err)
-			http.Error(w, "Error al contar pedidos pendientes", http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error al contar pedidos pendientes", err))
 			return
 		}
 		// Pedidos pendientes del mes actual (usa fecha_creacion en pedidos)
-		err = dbConn.Local.QueryRow(`
+		err = dbConn.Local.QueryRowContext(r.Context(), `
 			SELECT COUNT(*)
 			FROM pedidos
-			WHERE estatus = 'pendiente'
-			  AND YEAR(fecha_creacion) = YEAR(NOW())
-			  AND MONTH(fecha_creacion) = MONTH(NOW())
-		`).Scan(&stats.PedidosPendientesMes)
+			WHERE id_empresa = ?
+			  AND estatus = 'pendiente'
+			  AND fecha_creacion >= ? AND fecha_creacion < ?
+		`, idEmpresa, reloj.ParaBD(inicioMes), reloj.ParaBD(inicioMes.AddDate(0, 1, 0))).Scan(&stats.PedidosPendientesMes)
 		if err != nil {
-			log.Println("Error al contar pedidos pendientes del mes:", err)
-			http.Error(w, "Error al contar pedidos pendientes del mes", http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error al contar pedidos pendientes del mes", err))
 			return
 		}
 
 		// Usuarios
-		err = dbConn.Local.QueryRow("SELECT COUNT(*) FROM usuarios").Scan(&stats.UsuariosTotal)
+		err = dbConn.Local.QueryRowContext(r.Context(), "SELECT COUNT(*) FROM usuarios WHERE id_empresa = ?", idEmpresa).Scan(&stats.UsuariosTotal)
 		if err != nil {
-			log.Println("Error al contar usuarios:", err)
-			http.Error(w, "Error al contar usuarios", http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error al contar usuarios", err))
 			return
 		}
-		err = dbConn.Local.QueryRow("SELECT COUNT(*) FROM usuarios WHERE estatus = 'activo'").Scan(&stats.UsuariosActivos)
+		err = dbConn.Local.QueryRowContext(r.Context(), "SELECT COUNT(*) FROM usuarios WHERE id_empresa = ? AND estatus = 'activo'", idEmpresa).Scan(&stats.UsuariosActivos)
 		if err != nil {
-			log.Println("Error al contar usuarios activos:", err)
-			http.Error(w, "Error al contar usuarios activos", http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error al contar usuarios activos", err))
 			return
 		}
 
-		// Productos vendidos por mes (histórico) usando fecha_creacion en pedidos
-		rows, err := dbConn.Local.Query(`
+		// Productos vendidos por mes (histórico) usando fecha_creacion en pedidos;
+		// se suma por pedido y el mes se calcula aquí en la zona del negocio
+		rows, err := dbConn.Local.QueryContext(r.Context(), `
 			SELECT 
-				YEAR(p.fecha_creacion) AS anio,
-				MONTH(p.fecha_creacion) AS mes,
+				DATE_FORMAT(p.fecha_creacion, '%Y-%m-%d %H:%i:%s') AS fecha,
 				COALESCE(SUM(dp.cantidad), 0) AS total
 			FROM detalle_pedidos dp
 			JOIN pedidos p ON p.id_pedido = dp.id_pedido
-			WHERE p.estatus IN ('completado', 'solicitado', 'pendiente','enviado', 'procesando')
-			GROUP BY anio, mes
-			ORDER BY anio, mes
-		`)
+			WHERE p.id_empresa = ?
+			  AND p.estatus IN ('completado', 'solicitado', 'pendiente','enviado', 'procesando')
+			GROUP BY p.id_pedido, p.fecha_creacion
+		`, idEmpresa)
 		if err != nil {
-			log.Println("Error al consultar productos vendidos por mes:", err)
-			http.Error(w, "Error al consultar productos vendidos por mes", http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error al consultar productos vendidos por mes", err))
 			return
 		}
 		defer rows.Close()
@@ -107,30 +108,40 @@ func GetDashboardStats(dbConn *db.DBConnection) http.HandlerFunc {
 		// Inicializar el slice para que nunca sea null en JSON
 		stats.ProductosVendidosHistorico = make([]ProductosVendidosMes, 0)
 
+		porMes := map[[2]int]float64{}
 		for rows.Next() {
-			var anio, mes int
+			var fecha string
 			var totalFloat float64
-			if err := rows.Scan(&anio, &mes, &totalFloat); err != nil {
-				log.Println("Error al escanear fila de productos vendidos por mes:", err)
-				http.Error(w, "Error al leer los datos", http.StatusInternalServerError)
+			if err := rows.Scan(&fecha, &totalFloat); err != nil {
+				errores.Escribir(w, r, errores.Interno("Error al leer los datos", err))
 				return
 			}
-			row := ProductosVendidosMes{
-				Anio:  anio,
-				Mes:   mes,
-				Total: int(totalFloat),
+			creado, err := reloj.LeerBD(fecha, now.Location())
+			if err != nil {
+				errores.Escribir(w, r, errores.Interno("Error al leer los datos", err))
+				return
 			}
-			stats.ProductosVendidosHistorico = append(stats.ProductosVendidosHistorico, row)
+			porMes[[2]int{creado.Year(), int(creado.Month())}] += totalFloat
 		}
 		if err := rows.Err(); err != nil {
-			log.Println("Error en rows de productos vendidos por mes:", err)
-			http.Error(w, "Error al leer los datos", http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error al leer los datos", err))
 			return
 		}
+		for mes, totalFloat := range porMes {
+			row := ProductosVendidosMes{
+				Anio:  mes[0],
+				Mes:   mes[1],
+				Total: int(totalFloat),
+			}
+			stats.ProductosVendidosHistorico = append(stats.ProductosVendidosHistorico, row)
+		}
+		sort.Slice(stats.ProductosVendidosHistorico, func(i, j int) bool {
+			a, b := stats.ProductosVendidosHistorico[i], stats.ProductosVendidosHistorico[j]
+			return a.Anio < b.Anio || (a.Anio == b.Anio && a.Mes < b.Mes)
+		})
 
 		// Determinar productos vendidos en el mes actual a partir del histórico
 		stats.ProductosVendidosMes = 0
-		now := time.Now()
 		for _, row := range stats.ProductosVendidosHistorico {
 			if row.Anio == now.Year() && row.Mes == int(now.Month()) {
 				stats.ProductosVendidosMes = row.Total
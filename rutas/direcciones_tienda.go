@@ -0,0 +1,257 @@
+package rutas
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	middlewares "github.com/WolfSlayer04/logica_tiendaenlina/Middleware"
+	"github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+	"github.com/WolfSlayer04/logica_tiendaenlina/reloj"
+	"github.com/WolfSlayer04/logica_tiendaenlina/repositorio"
+	"github.com/WolfSlayer04/logica_tiendaenlina/validacion"
+	"github.com/gorilla/mux"
+)
+
+// DireccionRequest es una dirección de entrega por crear o reemplazar.
+type DireccionRequest struct {
+	Alias          string   `json:"alias" valida:"requerido,max=50"`
+	Direccion      string   `json:"direccion" valida:"requerido,max=255"`
+	Colonia        string   `json:"colonia" valida:"max=100"`
+	CodigoPostal   string   `json:"codigo_postal" valida:"cp"`
+	Ciudad         string   `json:"ciudad" valida:"max=100"`
+	Estado         string   `json:"estado" valida:"max=100"`
+	Referencias    string   `json:"referencias" valida:"max=255"`
+	Latitud        *float64 `json:"latitud" valida:"requerido,latitud"`
+	Longitud       *float64 `json:"longitud" valida:"requerido,longitud"`
+	Predeterminada bool     `json:"predeterminada"`
+}
+
+// Direccion es una dirección de la libreta de una tienda con la sucursal que
+// la cubre hoy.
+type Direccion struct {
+	IDDireccion    int64              `json:"id_direccion"`
+	IDTienda       int                `json:"id_tienda"`
+	Alias          string             `json:"alias"`
+	Direccion      string             `json:"direccion"`
+	Colonia        string             `json:"colonia"`
+	CodigoPostal   string             `json:"codigo_postal"`
+	Ciudad         string             `json:"ciudad"`
+	Estado         string             `json:"estado"`
+	Referencias    string             `json:"referencias"`
+	Latitud        float64            `json:"latitud"`
+	Longitud       float64            `json:"longitud"`
+	Predeterminada bool               `json:"predeterminada"`
+	Creada         string             `json:"creada"`
+	Actualizada    string             `json:"actualizada"`
+	Cobertura      CoberturaUbicacion `json:"cobertura"`
+}
+
+func direccionDe(d repositorio.Direccion, cobertura CoberturaUbicacion) Direccion {
+	return Direccion{
+		IDDireccion:    d.ID,
+		IDTienda:       d.IDTienda,
+		Alias:          d.Alias,
+		Direccion:      d.Direccion,
+		Colonia:        d.Colonia,
+		CodigoPostal:   d.CodigoPostal,
+		Ciudad:         d.Ciudad,
+		Estado:         d.Estado,
+		Referencias:    d.Referencias,
+		Latitud:        d.Latitud,
+		Longitud:       d.Longitud,
+		Predeterminada: d.Predeterminada,
+		Creada:         d.Creada.Format("2006-01-02 15:04:05"),
+		Actualizada:    d.Actualizada.Format("2006-01-02 15:04:05"),
+		Cobertura:      cobertura,
+	}
+}
+
+// tiendaDeRuta lee {id_tienda} y revisa que sea una tienda activa de la
+// empresa y, si no es un administrador quien pide, del usuario de la sesión.
+// Si no, escribe el error y regresa false; a otro cliente la tienda le
+// aparece como no encontrada.
+func tiendaDeRuta(w http.ResponseWriter, r *http.Request, repos repositorio.Repositorios, idEmpresa int) (int, bool) {
+	idTienda, err := strconv.Atoi(mux.Vars(r)["id_tienda"])
+	if err != nil || idTienda <= 0 {
+		errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_tienda")))
+		return 0, false
+	}
+	return idTienda, tiendaPermitida(w, r, repos, idEmpresa, idTienda)
+}
+
+// tiendaPermitida revisa que la tienda sea activa de la empresa y del
+// usuario de la sesión (cualquiera para un administrador); si no, escribe el
+// error y regresa false.
+func tiendaPermitida(w http.ResponseWriter, r *http.Request, repos repositorio.Repositorios, idEmpresa, idTienda int) bool {
+	duenio, err := repos.Tiendas.Duenio(r.Context(), idEmpresa, idTienda)
+	if errors.Is(err, repositorio.ErrNoEncontrado) {
+		errores.Escribir(w, r, errores.Nuevo(errores.TiendaNoEncontrada))
+		return false
+	} else if err != nil {
+		errores.Escribir(w, r, errores.Interno("No se pudo obtener la tienda", err))
+		return false
+	}
+	idUsuario, tipo, _, _, _ := middlewares.GetUserFromContext(r)
+	if tipo != "A" && idUsuario != duenio {
+		errores.Escribir(w, r, errores.Nuevo(errores.TiendaNoEncontrada))
+		return false
+	}
+	return true
+}
+
+func direccionDeRuta(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id_direccion"], 10, 64)
+	if err != nil || id <= 0 {
+		errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_direccion")))
+		return 0, false
+	}
+	return id, true
+}
+
+func escribirErrorDireccion(w http.ResponseWriter, r *http.Request, err error, mensaje string) {
+	if errors.Is(err, repositorio.ErrNoEncontrado) {
+		errores.Escribir(w, r, errores.Nuevo(errores.DireccionNoEncontrada))
+		return
+	}
+	errores.Escribir(w, r, errores.Interno(mensaje, err))
+}
+
+// GetDireccionesTienda regresa la libreta de direcciones de la tienda, la
+// predeterminada primero, con la sucursal que cubre cada una.
+func GetDireccionesTienda(repos repositorio.Repositorios) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		idTienda, ok := tiendaDeRuta(w, r, repos, idEmpresa)
+		if !ok {
+			return
+		}
+		direcciones, err := repos.Direcciones.Listar(r.Context(), idEmpresa, idTienda)
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al obtener las direcciones", err))
+			return
+		}
+		res := []Direccion{}
+		for _, d := range direcciones {
+			cobertura, err := coberturaDe(r.Context(), repos.Sucursales, idEmpresa, d.Latitud, d.Longitud)
+			if err != nil {
+				errores.Escribir(w, r, errores.Interno("No se pudo buscar la sucursal", err))
+				return
+			}
+			res = append(res, direccionDe(d, cobertura))
+		}
+		writeSuccessResponse(w, "Direcciones de la tienda", res)
+	}
+}
+
+// guardarDireccion guarda la dirección de la petición con el id dado (0 para
+// crearla) y responde con ella y su cobertura. Una dirección sin cobertura se
+// guarda igual; sólo no se puede usar en un pedido.
+func guardarDireccion(w http.ResponseWriter, r *http.Request, repos repositorio.Repositorios, idEmpresa, idTienda int, id int64) {
+	var req DireccionRequest
+	if err := validacion.Decodificar(w, r, &req); err != nil {
+		errores.Escribir(w, r, err)
+		return
+	}
+	ahora := reloj.Desde(r.Context()).Ahora()
+	id, err := repos.Direcciones.Guardar(r.Context(), repositorio.Direccion{
+		ID:             id,
+		IDEmpresa:      idEmpresa,
+		IDTienda:       idTienda,
+		Alias:          req.Alias,
+		Direccion:      req.Direccion,
+		Colonia:        req.Colonia,
+		CodigoPostal:   req.CodigoPostal,
+		Ciudad:         req.Ciudad,
+		Estado:         req.Estado,
+		Referencias:    req.Referencias,
+		Latitud:        *req.Latitud,
+		Longitud:       *req.Longitud,
+		Predeterminada: req.Predeterminada,
+	}, ahora)
+	if err != nil {
+		escribirErrorDireccion(w, r, err, "No se pudo guardar la dirección")
+		return
+	}
+	d, err := repos.Direcciones.Obtener(r.Context(), idEmpresa, idTienda, id)
+	if err != nil {
+		escribirErrorDireccion(w, r, err, "Error al obtener la dirección")
+		return
+	}
+	cobertura, err := coberturaDe(r.Context(), repos.Sucursales, idEmpresa, d.Latitud, d.Longitud)
+	if err != nil {
+		errores.Escribir(w, r, errores.Interno("No se pudo buscar la sucursal", err))
+		return
+	}
+	mensaje := "Dirección guardada"
+	if !cobertura.Cubierta {
+		mensaje = "Dirección guardada; está fuera de cobertura"
+	}
+	writeSuccessResponse(w, mensaje, direccionDe(d, cobertura))
+}
+
+// CreateDireccionTienda agrega una dirección a la libreta de la tienda. La
+// primera queda como predeterminada.
+func CreateDireccionTienda(repos repositorio.Repositorios) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		idTienda, ok := tiendaDeRuta(w, r, repos, idEmpresa)
+		if !ok {
+			return
+		}
+		guardarDireccion(w, r, repos, idEmpresa, idTienda, 0)
+	}
+}
+
+// UpdateDireccionTienda reemplaza los datos de una dirección de la libreta.
+// Con predeterminada en true pasa a ser la predeterminada; en false no deja
+// de serlo (para eso se marca otra).
+func UpdateDireccionTienda(repos repositorio.Repositorios) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		idTienda, ok := tiendaDeRuta(w, r, repos, idEmpresa)
+		if !ok {
+			return
+		}
+		id, ok := direccionDeRuta(w, r)
+		if !ok {
+			return
+		}
+		guardarDireccion(w, r, repos, idEmpresa, idTienda, id)
+	}
+}
+
+// DeleteDireccionTienda quita una dirección de la libreta; si era la
+// predeterminada, pasa a serlo la más vieja que quede. Los pedidos que ya la
+// usaron la conservan.
+func DeleteDireccionTienda(repos repositorio.Repositorios) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		idTienda, ok := tiendaDeRuta(w, r, repos, idEmpresa)
+		if !ok {
+			return
+		}
+		id, ok := direccionDeRuta(w, r)
+		if !ok {
+			return
+		}
+		if err := repos.Direcciones.Eliminar(r.Context(), idEmpresa, idTienda, id, reloj.Desde(r.Context()).Ahora()); err != nil {
+			escribirErrorDireccion(w, r, err, "No se pudo eliminar la dirección")
+			return
+		}
+		writeSuccessResponse(w, "Dirección eliminada", nil)
+	}
+}
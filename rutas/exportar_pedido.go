@@ -1,13 +1,24 @@
 package rutas
 
 import (
+	"context"
 	"crypto/md5"
 	"database/sql"
-	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"github.com/WolfSlayer04/logica_tiendaenlina/bitacora"
 	"github.com/WolfSlayer04/logica_tiendaenlina/db"
+	"github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+	"github.com/WolfSlayer04/logica_tiendaenlina/metricas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/reloj"
+	"github.com/WolfSlayer04/logica_tiendaenlina/repositorio"
+	"github.com/WolfSlayer04/logica_tiendaenlina/trazas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/validacion"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"time"
 )
 
@@ -70,8 +81,8 @@ type DetallePedido struct {
 }
 
 type SincronizacionRequest struct {
-	IDPedido   int64  `json:"id_pedido"`
-	IDSucursal int64  `json:"id_sucursal"`
+	IDPedido   int64  `json:"id_pedido" valida:"requerido"`
+	IDSucursal int64  `json:"id_sucursal" valida:"requerido"`
 	ClaveUnica string `json:"clave_unica"`
 }
 
@@ -100,25 +111,37 @@ func GenerarClaveCliente(pedidoID int64, claveUnica string) string {
 	return hash
 }
 
-func FormatearFechaEntrega(fechaEntrega sql.NullTime) string {
+// horaLocal pasa un DATETIME guardado en UTC a la hora del negocio, en el
+// mismo formato; si no lo puede leer lo regresa igual.
+func horaLocal(ctx context.Context, s string) string {
+	t, err := reloj.LeerBD(s, reloj.Desde(ctx).Ahora().Location())
+	if err != nil {
+		return s
+	}
+	return t.Format(reloj.FormatoBD)
+}
+
+// FormatearFechaEntrega da la fecha de entrega para el ERP; sin fecha, dos
+// días después de ahora.
+func FormatearFechaEntrega(fechaEntrega sql.NullTime, ahora time.Time) string {
 	if !fechaEntrega.Valid {
-		return time.Now().AddDate(0, 0, 2).Format("2006-01-02 15:04:05")
+		return ahora.AddDate(0, 0, 2).Format("2006-01-02 15:04:05")
 	}
 	return fechaEntrega.Time.Format("2006-01-02 15:04:05")
 }
 
 func ActualizarFechaEntrega(dbc *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var req struct {
-			IDPedido     int64  `json:"id_pedido"`
-			FechaEntrega string `json:"fecha_entrega"`
-		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			writeErrorResponse(w, http.StatusBadRequest, "Error en el formato de la solicitud", err.Error())
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
 			return
 		}
-		if req.IDPedido == 0 || req.FechaEntrega == "" {
-			writeErrorResponse(w, http.StatusBadRequest, "Campos requeridos faltantes", "IDPedido y FechaEntrega son obligatorios")
+		var req struct {
+			IDPedido     int64  `json:"id_pedido" valida:"requerido"`
+			FechaEntrega string `json:"fecha_entrega" valida:"requerido"`
+		}
+		if err := validacion.Decodificar(w, r, &req); err != nil {
+			errores.Escribir(w, r, err)
 			return
 		}
 		formatos := []string{
@@ -135,52 +158,54 @@ func ActualizarFechaEntrega(dbc *db.DBConnection) http.HandlerFunc {
 			}
 		}
 		if errParse != nil {
-			writeErrorResponse(w, http.StatusBadRequest, "Formato de fecha inválido", errParse.Error())
+			errores.Escribir(w, r, errores.Validacion(errores.NuevoCampo("fecha_entrega", errores.CampoFormatoFecha, "YYYY-MM-DD HH:MM:SS")).Con("Formato de fecha inválido", errParse))
 			return
 		}
 		tx, err := dbc.Local.Begin()
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "Error al iniciar transacción", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error al iniciar transacción", err))
 			return
 		}
 		defer tx.Rollback()
-		result, err := tx.Exec(
-			"UPDATE pedidos SET fecha_entrega = ? WHERE id_pedido = ?",
-			fechaEntrega.Format("2006-01-02 15:04:05"), req.IDPedido)
+		result, err := tx.ExecContext(r.Context(), 
+			"UPDATE pedidos SET fecha_entrega = ? WHERE id_empresa = ? AND id_pedido = ?",
+			fechaEntrega.Format("2006-01-02 15:04:05"), idEmpresa, req.IDPedido)
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "Error al actualizar fecha de entrega", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error al actualizar fecha de entrega", err))
 			return
 		}
 		rowsAffected, _ := result.RowsAffected()
 		if rowsAffected == 0 {
-			writeErrorResponse(w, http.StatusNotFound, "Pedido no encontrado", "")
+			errores.Escribir(w, r, errores.Nuevo(errores.PedidoNoEncontrado))
 			return
 		}
 		var sincronizado bool
 		var idPrincipal sql.NullInt64
 		var idRemoto sql.NullInt64
-		err = tx.QueryRow(`
+		err = tx.QueryRowContext(r.Context(), `
             SELECT COALESCE(sincronizado, false), id_principal, id_remoto 
             FROM pedidos WHERE id_pedido = ?`, 
             req.IDPedido).Scan(&sincronizado, &idPrincipal, &idRemoto)
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "Error al verificar sincronización", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error al verificar sincronización", err))
 			return
 		}
 		if sincronizado && idRemoto.Valid {
-			fechaActual := time.Now().Format("2006-01-02 15:04:05")
-			_, err = dbc.Remote.Exec(
+			// El ERP guarda la hora local del negocio
+			fechaActual := reloj.Desde(r.Context()).Ahora().Format(reloj.FormatoBD)
+			_, err = dbc.Remote.ExecContext(r.Context(), 
 				"UPDATE crm_pedidos SET fecha_entrega = ?, fecha = ?, mom_entrega = ? WHERE id_pedido = ?",
 				fechaEntrega.Format("2006-01-02 15:04:05"), 
 				fechaActual,
 				fechaActual,
 				idRemoto.Int64)
 			if err != nil {
-				log.Printf("WolfSlayer04 - Error al actualizar fecha en sistema principal: %v", err)
+				bitacora.Desde(r.Context()).Error("error al actualizar fecha en sistema principal",
+					"id_pedido", req.IDPedido, "id_remoto", idRemoto.Int64, "error", err)
 			}
 		}
 		if err := tx.Commit(); err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "Error al confirmar transacción", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error al confirmar transacción", err))
 			return
 		}
 		writeSuccessResponse(w, "Fecha de entrega actualizada correctamente", map[string]interface{}{
@@ -195,10 +220,14 @@ func ActualizarFechaEntrega(dbc *db.DBConnection) http.HandlerFunc {
 
 func ObtenerPedidoPorIDRemoto(dbc *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
 		idRemotoStr := r.URL.Query().Get("id_remoto")
 		idPrincipalStr := r.URL.Query().Get("id_principal")
 		if idRemotoStr == "" && idPrincipalStr == "" {
-			writeErrorResponse(w, http.StatusBadRequest, "Falta el parámetro id_remoto o id_principal", "")
+			errores.Escribir(w, r, errores.Validacion(errores.Requerido("id_remoto"), errores.Requerido("id_principal")))
 			return
 		}
 		var query string
@@ -206,28 +235,28 @@ func ObtenerPedidoPorIDRemoto(dbc *db.DBConnection) http.HandlerFunc {
 		var err error
 		if idRemotoStr != "" {
 			if _, err = fmt.Sscanf(idRemotoStr, "%d", &id); err != nil || id <= 0 {
-				writeErrorResponse(w, http.StatusBadRequest, "id_remoto inválido", "")
+				errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_remoto")))
 				return
 			}
-			query = "SELECT id_pedido FROM pedidos WHERE id_remoto = ?"
+			query = "SELECT id_pedido FROM pedidos WHERE id_empresa = ? AND id_remoto = ?"
 		} else {
 			if _, err = fmt.Sscanf(idPrincipalStr, "%d", &id); err != nil || id <= 0 {
-				writeErrorResponse(w, http.StatusBadRequest, "id_principal inválido", "")
+				errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_principal")))
 				return
 			}
-			query = "SELECT id_pedido FROM pedidos WHERE id_principal = ?"
+			query = "SELECT id_pedido FROM pedidos WHERE id_empresa = ? AND id_principal = ?"
 		}
 		var idPedidoLocal int64
-		err = dbc.Local.QueryRow(query, id).Scan(&idPedidoLocal)
+		err = dbc.Local.QueryRowContext(r.Context(), query, idEmpresa, id).Scan(&idPedidoLocal)
 		if err != nil {
 			if err == sql.ErrNoRows {
-				writeErrorResponse(w, http.StatusNotFound, "No se encontró pedido con ese ID remoto", "")
+				errores.Escribir(w, r, errores.Nuevo(errores.PedidoNoEncontrado))
 			} else {
-				writeErrorResponse(w, http.StatusInternalServerError, "Error al buscar pedido", err.Error())
+				errores.Escribir(w, r, errores.Interno("Error al buscar pedido", err))
 			}
 			return
 		}
-		rows, err := dbc.Local.Query(`
+		rows, err := dbc.Local.QueryContext(r.Context(), `
 			SELECT p.id_pedido, p.clave_unica, p.fecha_creacion, p.fecha_entrega,
 				   p.total, p.estatus, p.id_principal, p.id_remoto, p.sincronizado,
 				   p.fecha_sincronizacion
@@ -235,12 +264,12 @@ func ObtenerPedidoPorIDRemoto(dbc *db.DBConnection) http.HandlerFunc {
 			WHERE p.id_pedido = ?
 		`, idPedidoLocal)
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "Error al obtener datos del pedido", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error al obtener datos del pedido", err))
 			return
 		}
 		defer rows.Close()
 		if !rows.Next() {
-			writeErrorResponse(w, http.StatusNotFound, "Pedido no encontrado", "")
+			errores.Escribir(w, r, errores.Nuevo(errores.PedidoNoEncontrado))
 			return
 		}
 		var pedido struct {
@@ -260,13 +289,13 @@ func ObtenerPedidoPorIDRemoto(dbc *db.DBConnection) http.HandlerFunc {
 			&pedido.Total, &pedido.Estatus, &pedido.IDPrincipal, &pedido.IDRemoto,
 			&pedido.Sincronizado, &pedido.FechaSincronizacion)
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "Error al leer datos del pedido", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error al leer datos del pedido", err))
 			return
 		}
 		response := map[string]interface{}{
 			"id_pedido":            pedido.IDPedido,
 			"clave_unica":          pedido.ClaveUnica,
-			"fecha_creacion":       pedido.FechaCreacion,
+			"fecha_creacion":       horaLocal(r.Context(), pedido.FechaCreacion),
 			"fecha_entrega":        NullStringToStr(pedido.FechaEntrega),
 			"total":                pedido.Total,
 			"estatus":              pedido.Estatus,
@@ -281,8 +310,41 @@ func ObtenerPedidoPorIDRemoto(dbc *db.DBConnection) http.HandlerFunc {
 
 // --- Lógica principal de sincronización ---
 
-func sincronizarPedidoCore(dbc *db.DBConnection, req SincronizacionRequest, usuarioActual string) (*SincronizacionResponse, error) {
-	currentTime := time.Now().UTC().Format("2006-01-02 15:04:05")
+// ctx aporta el logger y la traza (request_id o componente del sincronizador)
+// pero no su cancelación: las transacciones no se cortan a medias. Cada pedido
+// abre su propio span, enlazado con la petición que creó el pedido.
+func sincronizarPedidoCore(ctx context.Context, dbc *db.DBConnection, req SincronizacionRequest, usuarioActual string) (resp *SincronizacionResponse, err error) {
+	inicio := time.Now()
+	ctx, span := trazas.Tracer().Start(context.WithoutCancel(ctx), "sincronizar pedido",
+		trace.WithLinks(trazas.EnlaceOrigenPedido(req.IDPedido)...),
+		trace.WithAttributes(
+			attribute.Int64("pedido.id", req.IDPedido),
+			attribute.String("pedido.clave_unica", req.ClaveUnica),
+			attribute.Int64("pedido.id_sucursal", req.IDSucursal),
+		))
+	logger := bitacora.Desde(ctx).With("id_pedido", req.IDPedido, "clave_unica", req.ClaveUnica, "id_sucursal", req.IDSucursal)
+	defer func() {
+		metricas.ObservarSincronizacion(time.Since(inicio), err)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		} else {
+			trazas.OlvidarOrigenPedido(req.IDPedido)
+		}
+		span.End()
+		duracion := float64(time.Since(inicio).Microseconds()) / 1000
+		if err != nil {
+			logger.Error("sincronización de pedido fallida", "duracion_ms", duracion, "error", err)
+			return
+		}
+		logger.Info("pedido sincronizado", "id_principal", resp.IDPrincipal, "id_remoto", resp.IDAutoincremental, "duracion_ms", duracion)
+	}()
+
+	// En la base local las horas van en UTC; el ERP guarda la hora local del
+	// negocio y de ella saca el día de sus estadísticas
+	ahora := reloj.Desde(ctx).Ahora()
+	currentTime := reloj.ParaBD(ahora)
+	horaERP := ahora.Format(reloj.FormatoBD)
 	txLocal, err := dbc.Local.Begin()
 	if err != nil {
 		return nil, fmt.Errorf("error al iniciar transacción local: %w", err)
@@ -295,17 +357,17 @@ func sincronizarPedidoCore(dbc *db.DBConnection, req SincronizacionRequest, usua
 	defer txRemote.Rollback()
 
 	var sincronizado bool
-	err = txLocal.QueryRow("SELECT COALESCE(sincronizado, false) FROM pedidos WHERE id_pedido = ?", req.IDPedido).Scan(&sincronizado)
+	err = txLocal.QueryRowContext(ctx, "SELECT COALESCE(sincronizado, false) FROM pedidos WHERE id_pedido = ?", req.IDPedido).Scan(&sincronizado)
 	if err != nil {
-		return nil, fmt.Errorf("pedido no encontrado: %w", err)
+		return nil, errores.Nuevo(errores.PedidoNoEncontrado).Con("pedido no encontrado", err)
 	}
 	if sincronizado {
-		return nil, fmt.Errorf("el pedido ya está sincronizado")
+		return nil, errores.Nuevo(errores.PedidoYaSincronizado)
 	}
 
 	var pedido Pedido
 	var fechaEntregaStr sql.NullString
-	err = txLocal.QueryRow(`
+	err = txLocal.QueryRowContext(ctx, `
 		SELECT id_pedido, clave_unica, id_usuario, id_tienda, id_sucursal, 
 			   fecha_creacion, fecha_entrega, subtotal, descuento, iva, 
 			   ieps, total, id_metodo_pago, referencia_pago, direccion_entrega,
@@ -340,23 +402,27 @@ func sincronizarPedidoCore(dbc *db.DBConnection, req SincronizacionRequest, usua
 			}
 		}
 		if errParse != nil {
-			pedido.FechaEntrega = sql.NullTime{Time: time.Now().AddDate(0, 0, 2), Valid: true}
+			pedido.FechaEntrega = sql.NullTime{Time: ahora.AddDate(0, 0, 2), Valid: true}
 		}
 	} else {
-		pedido.FechaEntrega = sql.NullTime{Time: time.Now().AddDate(0, 0, 2), Valid: true}
+		pedido.FechaEntrega = sql.NullTime{Time: ahora.AddDate(0, 0, 2), Valid: true}
 	}
-	fechaEntregaFormateada := FormatearFechaEntrega(pedido.FechaEntrega)
+	fechaEntregaFormateada := FormatearFechaEntrega(pedido.FechaEntrega, ahora)
 
 	var nombreUsuario string
 	var idClienteRemoto sql.NullInt64
-	err = txLocal.QueryRow(`
-		SELECT u.nombre_completo, u.id_remoto FROM usuarios u WHERE u.id_usuario = ?
-	`, pedido.IDUsuario).Scan(&nombreUsuario, &idClienteRemoto)
+	// Cada tienda es su propio cliente en el ERP; las de antes usan el del usuario
+	err = txLocal.QueryRowContext(ctx, `
+		SELECT u.nombre_completo, IFNULL(t.id_remoto, u.id_remoto)
+		FROM usuarios u
+		LEFT JOIN tiendas t ON t.id_tienda = ? AND t.id_usuario = u.id_usuario
+		WHERE u.id_usuario = ?
+	`, pedido.IDTienda, pedido.IDUsuario).Scan(&nombreUsuario, &idClienteRemoto)
 	if err != nil {
 		nombreUsuario = "Cliente"
 	}
 
-	rows, err := txLocal.Query(`
+	rows, err := txLocal.QueryContext(ctx, `
 		SELECT id_detalle, id_pedido, id_producto, clave_producto, descripcion,
 			   unidad, cantidad, precio_unitario, porcentaje_descuento,
 			   importe_descuento, subtotal, importe_iva, importe_ieps, total,
@@ -382,12 +448,12 @@ func sincronizarPedidoCore(dbc *db.DBConnection, req SincronizacionRequest, usua
 	}
 
 	var valorAnterior int64
-	err = txRemote.QueryRow(`SELECT COALESCE(idpedido, 0) FROM crm_indices WHERE idsucursal = ?`, req.IDSucursal).Scan(&valorAnterior)
+	err = txRemote.QueryRowContext(ctx, `SELECT COALESCE(idpedido, 0) FROM crm_indices WHERE idsucursal = ?`, req.IDSucursal).Scan(&valorAnterior)
 	if err != nil && err != sql.ErrNoRows {
 		return nil, fmt.Errorf("error al obtener valor anterior: %w", err)
 	}
 
-	_, err = txRemote.Exec(`
+	_, err = txRemote.ExecContext(ctx, `
 		INSERT INTO crm_indices (idsucursal, idpedido) VALUES (?, 1)
 		ON DUPLICATE KEY UPDATE idpedido = idpedido + 1
 	`, req.IDSucursal)
@@ -396,20 +462,20 @@ func sincronizarPedidoCore(dbc *db.DBConnection, req SincronizacionRequest, usua
 	}
 
 	var idPrincipal int64
-	err = txRemote.QueryRow(`SELECT idpedido FROM crm_indices WHERE idsucursal = ?`, req.IDSucursal).Scan(&idPrincipal)
+	err = txRemote.QueryRowContext(ctx, `SELECT idpedido FROM crm_indices WHERE idsucursal = ?`, req.IDSucursal).Scan(&idPrincipal)
 	if err != nil {
 		return nil, fmt.Errorf("error al obtener ID principal: %w", err)
 	}
 
 	clavePedidoPrincipal := fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintf("%d%s%d%s",
-		req.IDSucursal, pedido.ClaveUnica, time.Now().Unix(), currentTime))))
+		req.IDSucursal, pedido.ClaveUnica, ahora.Unix(), currentTime))))
 	claveCliente := GenerarClaveCliente(pedido.IDPedido, pedido.ClaveUnica)
 	idClienteVal := int64(0)
 	if idClienteRemoto.Valid {
 		idClienteVal = idClienteRemoto.Int64
 	}
 
-	result, err := txRemote.Exec(`
+	result, err := txRemote.ExecContext(ctx, `
 		INSERT INTO crm_pedidos (
 			idpedido, clave_pedido, estatus, fecha_entrega, mom_creacion,
 			fecha, mom_entrega, comentarios, clave_cliente, cliente, 
@@ -420,9 +486,9 @@ func sincronizarPedidoCore(dbc *db.DBConnection, req SincronizacionRequest, usua
 		idPrincipal,
 		clavePedidoPrincipal,
 		fechaEntregaFormateada,
-		currentTime,
-		currentTime,
-		currentTime,
+		horaERP,
+		horaERP,
+		horaERP,
 		"Pedido desde la pagina web",
 		claveCliente,
 		nombreUsuario,
@@ -446,9 +512,9 @@ func sincronizarPedidoCore(dbc *db.DBConnection, req SincronizacionRequest, usua
 	var idPedidoAutoincremental int64
 	idPedidoAutoincremental, err = result.LastInsertId()
 	if err != nil {
-		err = txRemote.QueryRow("SELECT LAST_INSERT_ID()").Scan(&idPedidoAutoincremental)
+		err = txRemote.QueryRowContext(ctx, "SELECT LAST_INSERT_ID()").Scan(&idPedidoAutoincremental)
 		if err != nil {
-			err = txRemote.QueryRow("SELECT id_pedido FROM crm_pedidos WHERE idpedido = ? AND idsucursal = ?",
+			err = txRemote.QueryRowContext(ctx, "SELECT id_pedido FROM crm_pedidos WHERE idpedido = ? AND idsucursal = ?",
 				idPrincipal, req.IDSucursal).Scan(&idPedidoAutoincremental)
 			if err != nil {
 				idPedidoAutoincremental = 0
@@ -477,7 +543,7 @@ func sincronizarPedidoCore(dbc *db.DBConnection, req SincronizacionRequest, usua
 		}
 		precioConIVA := precioNeto + ivaUnitario + iepsUnitario
 
-		_, err = stmt.Exec(
+		_, err = stmt.ExecContext(ctx, 
 			idPedidoAutoincremental,
 			det.IDProducto, i+1, det.Descripcion,
 			precioConIVA,         // precio (unitario con IVA/IEPS)
@@ -490,38 +556,38 @@ func sincronizarPedidoCore(dbc *db.DBConnection, req SincronizacionRequest, usua
 		}
 	}
 
-	_, err = txRemote.Exec(`
+	_, err = txRemote.ExecContext(ctx, `
 		INSERT INTO est_ventas_x_producto_dia 
 		(idsucursal, idproducto, dia, cantidad) 
 		VALUES (?, ?, DATE(?), ?)
 		ON DUPLICATE KEY UPDATE 
 		cantidad = cantidad + ?`,
-		req.IDSucursal, idPedidoAutoincremental, currentTime, 1, 1)
+		req.IDSucursal, idPedidoAutoincremental, horaERP, 1, 1)
 	if err != nil {
 		return nil, fmt.Errorf("error al actualizar estadísticas diarias: %w", err)
 	}
 
-	_, err = txRemote.Exec(`
+	_, err = txRemote.ExecContext(ctx, `
 		INSERT INTO est_ventas_x_producto_mes
 		(idsucursal, idproducto, dia, cantidad)
 		VALUES (?, ?, DATE_FORMAT(?, '%Y-%m-01'), ?)
 		ON DUPLICATE KEY UPDATE
 		cantidad = cantidad + ?`,
-		req.IDSucursal, idPedidoAutoincremental, currentTime, 1, 1)
+		req.IDSucursal, idPedidoAutoincremental, horaERP, 1, 1)
 	if err != nil {
 		return nil, fmt.Errorf("error al actualizar estadísticas mensuales: %w", err)
 	}
 
-	_, err = txLocal.Exec(`
+	_, err = txLocal.ExecContext(ctx, `
 		INSERT INTO log_sincronizacion 
 		(id_pedido, id_principal, id_remoto, fecha_sincronizacion, usuario, estado) 
 		VALUES (?, ?, ?, ?, ?, 'OK')`,
 		req.IDPedido, idPrincipal, idPedidoAutoincremental, currentTime, usuarioActual)
 	if err != nil {
-		log.Printf("Error al registrar log de sincronización: %v\n", err)
+		logger.Warn("error al registrar log de sincronización", "error", err)
 	}
 
-	_, err = txLocal.Exec(`
+	_, err = txLocal.ExecContext(ctx, `
 		UPDATE pedidos 
 		SET sincronizado = true,
 			id_principal = ?,
@@ -539,12 +605,13 @@ func sincronizarPedidoCore(dbc *db.DBConnection, req SincronizacionRequest, usua
 	if err := txLocal.Commit(); err != nil {
 		return nil, fmt.Errorf("error al confirmar transacción local: %w", err)
 	}
+	estadoSync.registrarExito(time.Now())
 
 	return &SincronizacionResponse{
 		Success:           true,
 		IDPrincipal:       idPrincipal,
 		IDAutoincremental: idPedidoAutoincremental,
-		Message:           fmt.Sprintf("Sincronización completada con éxito el %s", currentTime),
+		Message:           fmt.Sprintf("Sincronización completada con éxito el %s", horaERP),
 	}, nil
 }
 
@@ -552,25 +619,37 @@ func sincronizarPedidoCore(dbc *db.DBConnection, req SincronizacionRequest, usua
 func SincronizarPedido(dbc *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			writeErrorResponse(w, http.StatusMethodNotAllowed, "Método no permitido", "")
+			errores.Escribir(w, r, errores.Nuevo(errores.MetodoNoPermitido))
+			return
+		}
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
 			return
 		}
 		var req SincronizacionRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			writeErrorResponse(w, http.StatusBadRequest, "Error en el formato de la solicitud", err.Error())
+		if err := validacion.Decodificar(w, r, &req); err != nil {
+			errores.Escribir(w, r, err)
 			return
 		}
-		if req.IDPedido == 0 || req.IDSucursal == 0 {
-			writeErrorResponse(w, http.StatusBadRequest, "Campos requeridos faltantes", "IDPedido y IDSucursal son obligatorios")
+		// sincronizarPedidoCore no conoce la empresa (también la usa el
+		// sincronizador), así que el pedido se valida aquí
+		var existe int
+		err := dbc.Local.QueryRowContext(r.Context(), "SELECT COUNT(*) FROM pedidos WHERE id_empresa = ? AND id_pedido = ?", idEmpresa, req.IDPedido).Scan(&existe)
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al buscar pedido", err))
+			return
+		}
+		if existe == 0 {
+			errores.Escribir(w, r, errores.Nuevo(errores.PedidoNoEncontrado))
 			return
 		}
 		usuarioActual := r.Header.Get("X-User")
 		if usuarioActual == "" {
 			usuarioActual = "WolfSlayer04"
 		}
-		resp, err := sincronizarPedidoCore(dbc, req, usuarioActual)
+		resp, err := sincronizarPedidoCore(r.Context(), dbc, req, usuarioActual)
 		if err != nil {
-			writeErrorResponse(w, http.StatusConflict, fmt.Sprintf("Error al sincronizar: %v", err), "")
+			errores.Escribir(w, r, errores.Envolver(err, errores.SincronizacionFallida, "Error al sincronizar"))
 			return
 		}
 		writeSuccessResponse(w, "Pedido sincronizado correctamente", resp)
@@ -578,11 +657,12 @@ func SincronizarPedido(dbc *db.DBConnection) http.HandlerFunc {
 }
 
 // --- Sincronización en background (automática) ---
-func SincronizarPedidoBackground(dbc *db.DBConnection, idPedido int64) error {
+func SincronizarPedidoBackground(ctx context.Context, dbc *db.DBConnection, idPedido int64) error {
 	var idSucursal int64
 	var claveUnica string
-	err := dbc.Local.QueryRow("SELECT id_sucursal, clave_unica FROM pedidos WHERE id_pedido = ?", idPedido).Scan(&idSucursal, &claveUnica)
+	err := dbc.Local.QueryRowContext(ctx, "SELECT id_sucursal, clave_unica FROM pedidos WHERE id_pedido = ?", idPedido).Scan(&idSucursal, &claveUnica)
 	if err != nil {
+		bitacora.Desde(ctx).Error("error leyendo pedido a sincronizar", "id_pedido", idPedido, "error", err)
 		return err
 	}
 	req := SincronizacionRequest{
@@ -590,79 +670,116 @@ func SincronizarPedidoBackground(dbc *db.DBConnection, idPedido int64) error {
 		IDSucursal: idSucursal,
 		ClaveUnica: claveUnica,
 	}
-	_, err = sincronizarPedidoCore(dbc, req, "DiablitoSincronizador")
+	_, err = sincronizarPedidoCore(ctx, dbc, req, "DiablitoSincronizador")
 	return err
 }
 
-func IniciarSincronizadorPedidos(dbc *db.DBConnection) {
+// IniciarSincronizadorPedidos arranca el sincronizador en background. El ciclo
+// termina cuando se cancela ctx: el pedido que se esté sincronizando en ese
+// momento se completa (ambas transacciones se confirman o se revierten) y ya no
+// se toma el siguiente. El canal devuelto se cierra cuando la goroutine terminó.
+func IniciarSincronizadorPedidos(ctx context.Context, dbc *db.DBConnection, repos repositorio.Repositorios) <-chan struct{} {
+	done := make(chan struct{})
+	logger := slog.Default().With("componente", "sincronizador")
 	go func() {
+		defer close(done)
 		for {
-			rows, err := dbc.Local.Query(`SELECT id_pedido FROM pedidos WHERE sincronizado = false OR sincronizado IS NULL`)
-			if err != nil {
-				log.Printf("Sincronizador: Error consultando pedidos pendientes: %v", err)
-				time.Sleep(2 * time.Minute)
-				continue
-			}
-
-			var idsPendientes []int64
-			for rows.Next() {
-				var id int64
-				if err := rows.Scan(&id); err == nil {
-					idsPendientes = append(idsPendientes, id)
-				}
+			if !cicloSincronizador(ctx, dbc, repos.Sync, logger) {
+				logger.Info("sincronizador detenido")
+				return
 			}
-			rows.Close()
-
-			for _, id := range idsPendientes {
-				err := SincronizarPedidoBackground(dbc, id)
-				if err != nil {
-					log.Printf("Sincronizador: Error sincronizando pedido %d: %v", id, err)
-				} else {
-					log.Printf("Sincronizador: Pedido %d sincronizado correctamente.", id)
-				}
+			if !esperarOCancelar(ctx, 1*time.Minute) {
+				logger.Info("sincronizador detenido")
+				return
 			}
+		}
+	}()
+	return done
+}
 
-			res, err := dbc.Local.Exec(`UPDATE pedidos SET estatus = 'procesando' WHERE sincronizado = true AND estatus = 'pendiente'`)
-			if err != nil {
-				log.Printf("Sincronizador: Error actualizando estatus a 'procesando': %v", err)
-			} else if count, _ := res.RowsAffected(); count > 0 {
-				log.Printf("Sincronizador: %d pedidos cambiados de 'pendiente' a 'procesando'.", count)
-			} else {
-				log.Println("Sincronizador: No había pedidos para cambiar a 'procesando'.")
-			}
+// cicloSincronizador ejecuta una pasada del sincronizador. Regresa false si se
+// canceló ctx durante la pasada.
+func cicloSincronizador(ctx context.Context, dbc *db.DBConnection, syncRepo repositorio.SyncRepo, logger *slog.Logger) bool {
+	idsPendientes, err := syncRepo.Pendientes(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+		logger.Error("error consultando pedidos pendientes", "error", err)
+		return esperarOCancelar(ctx, 2*time.Minute)
+	}
+	metricas.PedidosPendientes(len(idsPendientes))
 
-			time.Sleep(1 * time.Minute)
+	for _, id := range idsPendientes {
+		if ctx.Err() != nil {
+			return false
 		}
-	}()
+		// sincronizarPedidoCore ya registra el resultado con id_pedido y clave_unica.
+		// Se usa un contexto sin cancelación para no cortar un pedido a medias;
+		// conserva los valores de ctx, como el reloj del negocio.
+		err := SincronizarPedidoBackground(bitacora.ConLogger(context.WithoutCancel(ctx), logger), dbc, id)
+		if err != nil {
+			estadoSync.registrarError(time.Now())
+		}
+	}
+
+	count, err := syncRepo.MarcarProcesando(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+		logger.Error("error actualizando estatus a 'procesando'", "error", err)
+	} else if count > 0 {
+		logger.Info("pedidos cambiados de 'pendiente' a 'procesando'", "pedidos", count)
+	} else {
+		logger.Debug("no había pedidos para cambiar a 'procesando'")
+	}
+	return ctx.Err() == nil
+}
+
+// esperarOCancelar duerme d o hasta que se cancele ctx. Regresa false si se canceló.
+func esperarOCancelar(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
 }
 
 // --- Verificación y consulta de sincronización ---
 
 func VerificarSincronizacion(dbc *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
 		idPedidoStr := r.URL.Query().Get("id_pedido")
 		if idPedidoStr == "" {
-			writeErrorResponse(w, http.StatusBadRequest, "Falta el parámetro id_pedido", "")
+			errores.Escribir(w, r, errores.Validacion(errores.Requerido("id_pedido")))
 			return
 		}
 		var idPedido int64
 		if _, err := fmt.Sscanf(idPedidoStr, "%d", &idPedido); err != nil || idPedido <= 0 {
-			writeErrorResponse(w, http.StatusBadRequest, "id_pedido inválido", "")
+			errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_pedido")))
 			return
 		}
 		var sincronizado bool
 		var idPrincipal sql.NullInt64
 		var idRemoto sql.NullInt64
 		var fechaSincronizacion sql.NullTime
-		err := dbc.Local.QueryRow(`
+		err := dbc.Local.QueryRowContext(r.Context(), `
 			SELECT COALESCE(sincronizado, false), id_principal, id_remoto, fecha_sincronizacion 
-			FROM pedidos WHERE id_pedido = ?
-		`, idPedido).Scan(&sincronizado, &idPrincipal, &idRemoto, &fechaSincronizacion)
+			FROM pedidos WHERE id_empresa = ? AND id_pedido = ?
+		`, idEmpresa, idPedido).Scan(&sincronizado, &idPrincipal, &idRemoto, &fechaSincronizacion)
 		if err != nil {
 			if err == sql.ErrNoRows {
-				writeErrorResponse(w, http.StatusNotFound, "Pedido no encontrado", "")
+				errores.Escribir(w, r, errores.Nuevo(errores.PedidoNoEncontrado))
 			} else {
-				writeErrorResponse(w, http.StatusInternalServerError, "Error al verificar sincronización", err.Error())
+				errores.Escribir(w, r, errores.Interno("Error al verificar sincronización", err))
 			}
 			return
 		}
@@ -681,14 +798,18 @@ func VerificarSincronizacion(dbc *db.DBConnection) http.HandlerFunc {
 
 func PedidosPendientesSincronizacion(dbc *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		rows, err := dbc.Local.Query(`
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		rows, err := dbc.Local.QueryContext(r.Context(), `
 			SELECT id_pedido, clave_unica, fecha_creacion, total, estatus 
 			FROM pedidos 
-			WHERE sincronizado = false OR sincronizado IS NULL
+			WHERE id_empresa = ? AND (sincronizado = false OR sincronizado IS NULL)
 			ORDER BY fecha_creacion DESC
-		`)
+		`, idEmpresa)
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "Error al obtener pedidos pendientes", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error al obtener pedidos pendientes", err))
 			return
 		}
 		defer rows.Close()
@@ -698,13 +819,13 @@ func PedidosPendientesSincronizacion(dbc *db.DBConnection) http.HandlerFunc {
 			var claveUnica, fechaCreacion, estatus string
 			var total float64
 			if err := rows.Scan(&idPedido, &claveUnica, &fechaCreacion, &total, &estatus); err != nil {
-				writeErrorResponse(w, http.StatusInternalServerError, "Error al leer datos de pedido", err.Error())
+				errores.Escribir(w, r, errores.Interno("Error al leer datos de pedido", err))
 				return
 			}
 			pendientes = append(pendientes, map[string]interface{}{
 				"id_pedido":      idPedido,
 				"clave_unica":    claveUnica,
-				"fecha_creacion": fechaCreacion,
+				"fecha_creacion": horaLocal(r.Context(), fechaCreacion),
 				"total":          total,
 				"estatus":        estatus,
 			})
@@ -1,9 +1,13 @@
 package rutas
 
 import (
+	"context"
 	"database/sql"
 	"net/http"
 	"github.com/WolfSlayer04/logica_tiendaenlina/db"
+	"github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+	"github.com/WolfSlayer04/logica_tiendaenlina/reloj"
 )
 
 // ---------------------------
@@ -22,13 +26,18 @@ type IndicadorResponse struct {
 // ---------------------------
 func GetIndicadoresDiarioAll(dbc *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		rows, err := dbc.Local.Query(`
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		rows, err := dbc.Local.QueryContext(r.Context(), `
 			SELECT id, fecha, num_pedidos, tot_pedidos, num_clientes
 			FROM ind_diario
+			WHERE id_empresa = ?
 			ORDER BY fecha DESC
-		`)
+		`, idEmpresa)
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "Error al obtener indicadores diarios", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error al obtener indicadores diarios", err))
 			return
 		}
 		defer rows.Close()
@@ -38,7 +47,7 @@ func GetIndicadoresDiarioAll(dbc *db.DBConnection) http.HandlerFunc {
 			var i IndicadorResponse
 			var fecha string
 			if err := rows.Scan(&i.ID, &fecha, &i.NumPedidos, &i.TotPedidos, &i.NumClientes); err != nil {
-				writeErrorResponse(w, http.StatusInternalServerError, "Error al leer indicadores diarios", err.Error())
+				errores.Escribir(w, r, errores.Interno("Error al leer indicadores diarios", err))
 				return
 			}
 			i.Fecha = fecha
@@ -53,25 +62,29 @@ func GetIndicadoresDiarioAll(dbc *db.DBConnection) http.HandlerFunc {
 // ---------------------------
 func GetIndicadorDiarioByFecha(dbc *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
 		fecha := r.URL.Query().Get("fecha")
 		if fecha == "" {
-			writeErrorResponse(w, http.StatusBadRequest, "Falta el parámetro fecha (YYYY-MM-DD)", "")
+			errores.Escribir(w, r, errores.Validacion(errores.NuevoCampo("fecha", errores.CampoFormatoFecha, "YYYY-MM-DD")))
 			return
 		}
 		var i IndicadorResponse
 		var fechaVal string
-		row := dbc.Local.QueryRow(`
+		row := dbc.Local.QueryRowContext(r.Context(), `
 			SELECT id, fecha, num_pedidos, tot_pedidos, num_clientes
 			FROM ind_diario
-			WHERE fecha = ?
+			WHERE id_empresa = ? AND fecha = ?
 			LIMIT 1
-		`, fecha)
+		`, idEmpresa, fecha)
 		err := row.Scan(&i.ID, &fechaVal, &i.NumPedidos, &i.TotPedidos, &i.NumClientes)
 		if err != nil {
 			if err == sql.ErrNoRows {
-				writeErrorResponse(w, http.StatusNotFound, "No hay indicadores para la fecha", "")
+				errores.Escribir(w, r, errores.Nuevo(errores.IndicadorNoEncontrado))
 			} else {
-				writeErrorResponse(w, http.StatusInternalServerError, "Error al buscar el indicador diario", err.Error())
+				errores.Escribir(w, r, errores.Interno("Error al buscar el indicador diario", err))
 			}
 			return
 		}
@@ -85,13 +98,18 @@ func GetIndicadorDiarioByFecha(dbc *db.DBConnection) http.HandlerFunc {
 // ---------------------------
 func GetIndicadoresMensualAll(dbc *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		rows, err := dbc.Local.Query(`
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		rows, err := dbc.Local.QueryContext(r.Context(), `
 			SELECT id, fecha, num_pedidos, tot_pedidos, num_clientes
 			FROM ind_mensual
+			WHERE id_empresa = ?
 			ORDER BY fecha DESC
-		`)
+		`, idEmpresa)
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "Error al obtener indicadores mensuales", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error al obtener indicadores mensuales", err))
 			return
 		}
 		defer rows.Close()
@@ -101,7 +119,7 @@ func GetIndicadoresMensualAll(dbc *db.DBConnection) http.HandlerFunc {
 			var i IndicadorResponse
 			var fecha string
 			if err := rows.Scan(&i.ID, &fecha, &i.NumPedidos, &i.TotPedidos, &i.NumClientes); err != nil {
-				writeErrorResponse(w, http.StatusInternalServerError, "Error al leer indicadores mensuales", err.Error())
+				errores.Escribir(w, r, errores.Interno("Error al leer indicadores mensuales", err))
 				return
 			}
 			i.Fecha = fecha
@@ -116,9 +134,13 @@ func GetIndicadoresMensualAll(dbc *db.DBConnection) http.HandlerFunc {
 // ---------------------------
 func GetIndicadorMensualByFecha(dbc *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
 		fecha := r.URL.Query().Get("fecha")
 		if fecha == "" {
-			writeErrorResponse(w, http.StatusBadRequest, "Falta el parámetro fecha (YYYY-MM)", "")
+			errores.Escribir(w, r, errores.Validacion(errores.NuevoCampo("fecha", errores.CampoFormatoFecha, "YYYY-MM")))
 			return
 		}
 		// Normaliza a primer día del mes si solo es YYYY-MM
@@ -127,18 +149,18 @@ func GetIndicadorMensualByFecha(dbc *db.DBConnection) http.HandlerFunc {
 		}
 		var i IndicadorResponse
 		var fechaVal string
-		row := dbc.Local.QueryRow(`
+		row := dbc.Local.QueryRowContext(r.Context(), `
 			SELECT id, fecha, num_pedidos, tot_pedidos, num_clientes
 			FROM ind_mensual
-			WHERE fecha = ?
+			WHERE id_empresa = ? AND fecha = ?
 			LIMIT 1
-		`, fecha)
+		`, idEmpresa, fecha)
 		err := row.Scan(&i.ID, &fechaVal, &i.NumPedidos, &i.TotPedidos, &i.NumClientes)
 		if err != nil {
 			if err == sql.ErrNoRows {
-				writeErrorResponse(w, http.StatusNotFound, "No hay indicadores para el mes", "")
+				errores.Escribir(w, r, errores.Nuevo(errores.IndicadorNoEncontrado))
 			} else {
-				writeErrorResponse(w, http.StatusInternalServerError, "Error al buscar el indicador mensual", err.Error())
+				errores.Escribir(w, r, errores.Interno("Error al buscar el indicador mensual", err))
 			}
 			return
 		}
@@ -150,105 +172,82 @@ func GetIndicadorMensualByFecha(dbc *db.DBConnection) http.HandlerFunc {
 // ---------------------------
 // FUNCION: Inicializa los acumulados históricos si ya existen pedidos
 // ---------------------------
-func InicializaIndicadoresHistoricos(dbc *db.DBConnection) error {
-	// DIARIO
-	diarioQuery := `
-INSERT INTO ind_diario (fecha, num_pedidos, tot_pedidos, num_clientes)
-SELECT
-	DATE(fecha_creacion) AS fecha,
-	COUNT(*) AS num_pedidos,
-	IFNULL(SUM(total), 0) AS tot_pedidos,
-	COUNT(DISTINCT id_usuario) AS num_clientes
-FROM pedidos
-GROUP BY DATE(fecha_creacion)
-ON DUPLICATE KEY UPDATE
-	num_pedidos = VALUES(num_pedidos),
-	tot_pedidos = VALUES(tot_pedidos),
-	num_clientes = VALUES(num_clientes)
-`
-	// Se elimina el print de debug: fmt.Println("DEBUG QUERY DIARIO:\n", diarioQuery)
-	_, err := dbc.Local.Exec(diarioQuery)
-	if err != nil {
-		return err
-	}
 
-	// MENSUAL
-	mensualQuery := `
-INSERT INTO ind_mensual (fecha, num_pedidos, tot_pedidos, num_clientes)
-SELECT
-	DATE_FORMAT(fecha_creacion, '%Y-%m-01') AS fecha,
-	COUNT(*) AS num_pedidos,
-	IFNULL(SUM(total), 0) AS tot_pedidos,
-	COUNT(DISTINCT id_usuario) AS num_clientes
-FROM pedidos
-GROUP BY DATE_FORMAT(fecha_creacion, '%Y-%m-01')
-ON DUPLICATE KEY UPDATE
-	num_pedidos = VALUES(num_pedidos),
-	tot_pedidos = VALUES(tot_pedidos),
-	num_clientes = VALUES(num_clientes)
-`
-	// Se elimina el print de debug: fmt.Println("DEBUG QUERY MENSUAL:\n", mensualQuery)
-	_, err = dbc.Local.Exec(mensualQuery)
-	return err
+// indicadorAcumulado son los pedidos de una empresa en un día o en un mes.
+type indicadorAcumulado struct {
+	pedidos  int
+	total    float64
+	clientes map[int64]bool
 }
 
-// ---------------------------
-// FUNCION: Acumula indicadores al crear un pedido
-// ---------------------------
-func AcumulaIndicadores(tx *sql.Tx, total float64, usuarioID int, fechaPedido string) error {
-	// --- DIARIO ---
-	dia := fechaPedido[:10] // "YYYY-MM-DD"
-	var existe int
-	err := tx.QueryRow(`SELECT COUNT(*) FROM ind_diario WHERE fecha = ?`, dia).Scan(&existe)
+// llaveIndicador es la empresa y el día (o el primer día del mes).
+type llaveIndicador struct {
+	idEmpresa int
+	fecha     string
+}
+
+func acumularIndicador(m map[llaveIndicador]*indicadorAcumulado, idEmpresa int, fecha string, total float64, idUsuario sql.NullInt64) {
+	llave := llaveIndicador{idEmpresa, fecha}
+	a := m[llave]
+	if a == nil {
+		a = &indicadorAcumulado{clientes: map[int64]bool{}}
+		m[llave] = a
+	}
+	a.pedidos++
+	a.total += total
+	if idUsuario.Valid {
+		a.clientes[idUsuario.Int64] = true
+	}
+}
+
+// InicializaIndicadoresHistoricos recalcula ind_diario e ind_mensual de cada
+// empresa con todos sus pedidos. fecha_creacion está en UTC, así que el día y el mes de cada
+// pedido se calculan aquí con la zona del reloj de ctx y no con DATE() en SQL.
+func InicializaIndicadoresHistoricos(ctx context.Context, dbc *db.DBConnection) error {
+	zona := reloj.Desde(ctx).Ahora().Location()
+	rows, err := dbc.Local.QueryContext(ctx, `
+		SELECT id_empresa, DATE_FORMAT(fecha_creacion, '%Y-%m-%d %H:%i:%s'), IFNULL(total, 0), id_usuario
+		FROM pedidos
+		WHERE fecha_creacion IS NOT NULL`)
 	if err != nil {
 		return err
 	}
-	if existe > 0 {
-		_, err = tx.Exec(`
-			UPDATE ind_diario
-			SET num_pedidos = num_pedidos + 1,
-				tot_pedidos = tot_pedidos + ?,
-				num_clientes = (SELECT COUNT(DISTINCT id_usuario) FROM pedidos WHERE DATE(fecha_creacion) = ?)
-			WHERE fecha = ?`,
-			total, dia, dia)
-		if err != nil {
+	defer rows.Close()
+	diario := map[llaveIndicador]*indicadorAcumulado{}
+	mensual := map[llaveIndicador]*indicadorAcumulado{}
+	for rows.Next() {
+		var idEmpresa int
+		var fecha string
+		var total float64
+		var idUsuario sql.NullInt64
+		if err := rows.Scan(&idEmpresa, &fecha, &total, &idUsuario); err != nil {
 			return err
 		}
-	} else {
-		_, err = tx.Exec(`
-			INSERT INTO ind_diario (fecha, num_pedidos, tot_pedidos, num_clientes)
-			VALUES (?, 1, ?, 1)`,
-			dia, total)
+		creado, err := reloj.LeerBD(fecha, zona)
 		if err != nil {
 			return err
 		}
+		acumularIndicador(diario, idEmpresa, reloj.Dia(creado), total, idUsuario)
+		acumularIndicador(mensual, idEmpresa, reloj.Dia(reloj.InicioDelMes(creado)), total, idUsuario)
 	}
-
-	// --- MENSUAL ---
-	mes := dia[:7] + "-01"
-	err = tx.QueryRow(`SELECT COUNT(*) FROM ind_mensual WHERE fecha = ?`, mes).Scan(&existe)
-	if err != nil {
+	if err := rows.Err(); err != nil {
 		return err
 	}
-	if existe > 0 {
-		_, err = tx.Exec(`
-			UPDATE ind_mensual
-			SET num_pedidos = num_pedidos + 1,
-				tot_pedidos = tot_pedidos + ?,
-				num_clientes = (SELECT COUNT(DISTINCT id_usuario) FROM pedidos WHERE fecha_creacion >= ? AND fecha_creacion < DATE_ADD(?, INTERVAL 1 MONTH))
-			WHERE fecha = ?`,
-			total, mes, mes, mes)
-		if err != nil {
-			return err
-		}
-	} else {
-		_, err = tx.Exec(`
-			INSERT INTO ind_mensual (fecha, num_pedidos, tot_pedidos, num_clientes)
-			VALUES (?, 1, ?, 1)`,
-			mes, total)
-		if err != nil {
-			return err
+
+	for tabla, acumulados := range map[string]map[llaveIndicador]*indicadorAcumulado{"ind_diario": diario, "ind_mensual": mensual} {
+		for llave, a := range acumulados {
+			_, err := dbc.Local.ExecContext(ctx, `
+				INSERT INTO `+tabla+` (id_empresa, fecha, num_pedidos, tot_pedidos, num_clientes)
+				VALUES (?, ?, ?, ?, ?)
+				ON DUPLICATE KEY UPDATE
+					num_pedidos = VALUES(num_pedidos),
+					tot_pedidos = VALUES(tot_pedidos),
+					num_clientes = VALUES(num_clientes)`,
+				llave.idEmpresa, llave.fecha, a.pedidos, a.total, len(a.clientes))
+			if err != nil {
+				return err
+			}
 		}
 	}
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,1845 @@
+package rutas
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	middlewares "github.com/WolfSlayer04/logica_tiendaenlina/Middleware"
+	"github.com/WolfSlayer04/logica_tiendaenlina/avisos"
+	"github.com/WolfSlayer04/logica_tiendaenlina/db"
+	"github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+	"github.com/WolfSlayer04/logica_tiendaenlina/feriados"
+	"github.com/WolfSlayer04/logica_tiendaenlina/integracion"
+	"github.com/WolfSlayer04/logica_tiendaenlina/reloj"
+	"github.com/WolfSlayer04/logica_tiendaenlina/repositorio"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Pruebas contra las bases en memoria de integracion: mismo SQL y mismo driver
+// que en producción, sin servidores MySQL externos.
+
+const pedidoDosRenglones = `{
+	"id_usuario": 1, "id_tienda": 1, "id_sucursal": 1, "id_metodo_pago": 1, "origen_pedido": "web",
+	"direccion_entrega": "Calle 60 500", "cp_entrega": "97000",
+	"detalles": [
+		{"id_producto": 100, "clave_producto": "REF600", "descripcion": "Refresco 600 ml", "unidad": "PZA", "cantidad": 2, "precio_unitario": 116},
+		{"id_producto": 200, "clave_producto": "BOT45", "descripcion": "Botana 45 g", "unidad": "PZA", "cantidad": 1, "precio_unitario": 124}
+	]
+}`
+
+// llamar ejecuta el handler como la empresa sembrada y regresa el status y el
+// cuerpo decodificado.
+func llamar(t *testing.T, h http.HandlerFunc, metodo, url, body string) (int, map[string]interface{}) {
+	t.Helper()
+	return llamarEmpresa(t, integracion.IDEmpresa, h, metodo, url, body)
+}
+
+// llamarEmpresa es llamar con otra empresa; 0 es una petición sin empresa.
+func llamarEmpresa(t *testing.T, idEmpresa int, h http.HandlerFunc, metodo, url, body string) (int, map[string]interface{}) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(metodo, url, strings.NewReader(body))
+	if idEmpresa != 0 {
+		req = conEmpresa(req, idEmpresa)
+	}
+	h(rec, req)
+	var resp map[string]interface{}
+	if rec.Body.Len() > 0 {
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s %s: respuesta no es JSON: %v\n%s", metodo, url, err, rec.Body)
+		}
+	}
+	return rec.Code, resp
+}
+
+func contar(t *testing.T, conn *sql.DB, consulta string, args ...interface{}) int {
+	t.Helper()
+	var n int
+	if err := conn.QueryRow(consulta, args...).Scan(&n); err != nil {
+		t.Fatalf("%s: %v", consulta, err)
+	}
+	return n
+}
+
+func crearPedido(t *testing.T, dbc *db.DBConnection, body string) int64 {
+	t.Helper()
+	status, resp := llamar(t, CreatePedido(repositorio.NuevoMySQL(dbc)), http.MethodPost, "/api/pedidos", body)
+	if status != http.StatusOK {
+		t.Fatalf("crear pedido: status %d: %v", status, resp)
+	}
+	data := resp["data"].(map[string]interface{})
+	return int64(data["id_pedido"].(float64))
+}
+
+func TestIntegracionCrearPedido(t *testing.T) {
+	casos := []struct {
+		nombre   string
+		body     string
+		status   int
+		pedidos  int
+		detalles int
+		total    float64
+	}{
+		{nombre: "dos renglones con IVA e IEPS", body: pedidoDosRenglones, status: http.StatusOK, pedidos: 1, detalles: 2, total: 356},
+		{
+			nombre: "sucursal por defecto",
+			body:   `{"id_usuario": 1, "id_tienda": 1, "id_metodo_pago": 1, "detalles": [{"id_producto": 100, "cantidad": 1, "precio_unitario": 116}]}`,
+			status: http.StatusOK, pedidos: 1, detalles: 1, total: 116,
+		},
+		{
+			nombre: "producto inexistente",
+			body:   `{"id_usuario": 1, "id_tienda": 1, "id_sucursal": 1, "id_metodo_pago": 1, "detalles": [{"id_producto": 999, "cantidad": 1, "precio_unitario": 10}]}`,
+			status: http.StatusInternalServerError,
+		},
+		{
+			nombre: "sin método de pago",
+			body:   `{"id_usuario": 1, "id_tienda": 1, "id_sucursal": 1, "detalles": [{"id_producto": 100, "cantidad": 1, "precio_unitario": 116}]}`,
+			status: http.StatusBadRequest,
+		},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			dbc := integracion.Iniciar(t)
+			status, resp := llamar(t, CreatePedido(repositorio.NuevoMySQL(dbc)), http.MethodPost, "/api/pedidos", c.body)
+			if status != c.status {
+				t.Fatalf("status = %d, se esperaba %d: %v", status, c.status, resp)
+			}
+			if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM pedidos"); n != c.pedidos {
+				t.Errorf("pedidos = %d, se esperaban %d", n, c.pedidos)
+			}
+			if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM detalle_pedidos"); n != c.detalles {
+				t.Errorf("detalles = %d, se esperaban %d", n, c.detalles)
+			}
+			if c.pedidos == 0 {
+				return
+			}
+
+			var total float64
+			var idSucursal int
+			var estatus, fechaEntrega, explicacion string
+			err := dbc.Local.QueryRow("SELECT total, id_sucursal, estatus, fecha_entrega, explicacion_entrega FROM pedidos").
+				Scan(&total, &idSucursal, &estatus, &fechaEntrega, &explicacion)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !casiIgual(total, c.total) {
+				t.Errorf("total = %v, se esperaba %v", total, c.total)
+			}
+			if idSucursal != integracion.IDSucursalCentro || estatus != "pendiente" || fechaEntrega == "" {
+				t.Errorf("pedido guardado: sucursal %d, estatus %q, fecha_entrega %q", idSucursal, estatus, fechaEntrega)
+			}
+			if explicacion == "" || explicacion != resp["data"].(map[string]interface{})["explicacion_entrega"] {
+				t.Errorf("explicacion_entrega = %q: %v", explicacion, resp["data"])
+			}
+			if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM detalle_pedidos WHERE estatus = 'solicitado'"); n != c.detalles {
+				t.Errorf("detalles en 'solicitado' = %d", n)
+			}
+		})
+	}
+}
+
+func TestIntegracionSincronizacion(t *testing.T) {
+	casos := []struct {
+		nombre      string
+		preparar    func(t *testing.T, dbc *db.DBConnection) int64
+		codigo      errores.Codigo
+		renglones   int
+		idPrincipal int64
+	}{
+		{
+			nombre:      "pedido nuevo",
+			preparar:    func(t *testing.T, dbc *db.DBConnection) int64 { return crearPedido(t, dbc, pedidoDosRenglones) },
+			renglones:   2,
+			idPrincipal: 1,
+		},
+		{
+			nombre: "pedido ya sincronizado",
+			preparar: func(t *testing.T, dbc *db.DBConnection) int64 {
+				id := crearPedido(t, dbc, pedidoDosRenglones)
+				if _, err := sincronizarPedidoCore(context.Background(), dbc, SincronizacionRequest{IDPedido: id, IDSucursal: 1}, "prueba"); err != nil {
+					t.Fatal(err)
+				}
+				return id
+			},
+			codigo: errores.PedidoYaSincronizado,
+		},
+		{
+			nombre:   "pedido inexistente",
+			preparar: func(*testing.T, *db.DBConnection) int64 { return 404 },
+			codigo:   errores.PedidoNoEncontrado,
+		},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			dbc := integracion.Iniciar(t)
+			id := c.preparar(t, dbc)
+			remotosAntes := contar(t, dbc.Remote, "SELECT COUNT(*) FROM crm_pedidos")
+
+			resp, err := sincronizarPedidoCore(context.Background(), dbc, SincronizacionRequest{IDPedido: id, IDSucursal: 1}, "prueba")
+			if c.codigo != "" {
+				var e *errores.Error
+				if !errors.As(err, &e) || e.Codigo != c.codigo {
+					t.Fatalf("error = %v, se esperaba %s", err, c.codigo)
+				}
+				if n := contar(t, dbc.Remote, "SELECT COUNT(*) FROM crm_pedidos"); n != remotosAntes {
+					t.Errorf("se insertaron pedidos remotos en un intento fallido: %d -> %d", remotosAntes, n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.IDPrincipal != c.idPrincipal || resp.IDAutoincremental == 0 {
+				t.Errorf("respuesta = %+v", resp)
+			}
+
+			var monto float64
+			var renglones int
+			var idCliente int64
+			var numOrden string
+			err = dbc.Remote.QueryRow("SELECT monto, tot_renglones, id_cliente, num_orden FROM crm_pedidos WHERE id_pedido = ?", resp.IDAutoincremental).
+				Scan(&monto, &renglones, &idCliente, &numOrden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !casiIgual(monto, 356) || renglones != c.renglones || idCliente != integracion.IDClienteRemoto || !strings.HasPrefix(numOrden, "PED-") {
+				t.Errorf("crm_pedidos: monto %v, renglones %d, id_cliente %d, num_orden %q", monto, renglones, idCliente, numOrden)
+			}
+			if n := contar(t, dbc.Remote, "SELECT COUNT(*) FROM crm_pedidos_det WHERE id_pedido = ?", resp.IDAutoincremental); n != c.renglones {
+				t.Errorf("crm_pedidos_det = %d", n)
+			}
+			if n := contar(t, dbc.Remote, "SELECT idpedido FROM crm_indices WHERE idsucursal = 1"); int64(n) != c.idPrincipal {
+				t.Errorf("crm_indices.idpedido = %d", n)
+			}
+			if n := contar(t, dbc.Remote, "SELECT COUNT(*) FROM est_ventas_x_producto_dia WHERE idsucursal = 1"); n != 1 {
+				t.Errorf("est_ventas_x_producto_dia = %d", n)
+			}
+
+			var sincronizado bool
+			var idPrincipal int64
+			if err := dbc.Local.QueryRow("SELECT sincronizado, id_principal FROM pedidos WHERE id_pedido = ?", id).Scan(&sincronizado, &idPrincipal); err != nil {
+				t.Fatal(err)
+			}
+			if !sincronizado || idPrincipal != c.idPrincipal {
+				t.Errorf("pedido local: sincronizado %v, id_principal %d", sincronizado, idPrincipal)
+			}
+			if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM log_sincronizacion WHERE id_pedido = ? AND estado = 'OK'", id); n != 1 {
+				t.Errorf("log_sincronizacion = %d", n)
+			}
+		})
+	}
+}
+
+func TestIntegracionCicloSincronizador(t *testing.T) {
+	dbc := integracion.Iniciar(t)
+	crearPedido(t, dbc, pedidoDosRenglones)
+	crearPedido(t, dbc, pedidoDosRenglones)
+
+	logger := slog.New(slog.NewTextHandler(&strings.Builder{}, nil))
+	if !cicloSincronizador(context.Background(), dbc, repositorio.NuevoMySQL(dbc).Sync, logger) {
+		t.Fatal("el ciclo no debía reportar cancelación")
+	}
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM pedidos WHERE sincronizado = true AND estatus = 'procesando'"); n != 2 {
+		t.Errorf("pedidos sincronizados y en 'procesando' = %d, se esperaban 2", n)
+	}
+	if n := contar(t, dbc.Remote, "SELECT idpedido FROM crm_indices WHERE idsucursal = 1"); n != 2 {
+		t.Errorf("crm_indices.idpedido = %d, se esperaba 2", n)
+	}
+}
+
+func TestIntegracionIndicadores(t *testing.T) {
+	dbc := integracion.Iniciar(t)
+	// El pedido de otra empresa el mismo día no cuenta en los de ésta
+	otra := fmt.Sprintf(`{"id_usuario": 9, "id_tienda": 1, "id_sucursal": %d, "id_metodo_pago": 1, "origen_pedido": "web",
+		"detalles": [{"id_producto": %d, "cantidad": 1, "precio_unitario": 100}]}`, integracion.IDSucursalOtra, integracion.IDProductoOtra)
+	if status, resp := llamarEmpresa(t, integracion.IDOtraEmpresa, CreatePedido(repositorio.NuevoMySQL(dbc)), http.MethodPost, "/api/pedidos", otra); status != http.StatusOK {
+		t.Fatalf("pedido de otra empresa: status %d: %v", status, resp)
+	}
+	crearPedido(t, dbc, pedidoDosRenglones)
+	crearPedido(t, dbc, strings.Replace(pedidoDosRenglones, `"id_usuario": 1`, `"id_usuario": 2`, 1))
+	dia := reloj.Dia(hoy())
+
+	casos := []struct {
+		nombre  string
+		handler http.HandlerFunc
+		url     string
+		status  int
+	}{
+		{nombre: "diario por fecha", handler: GetIndicadorDiarioByFecha(dbc), url: "/api/indicadores/diario?fecha=" + dia, status: http.StatusOK},
+		{nombre: "diario sin fecha", handler: GetIndicadorDiarioByFecha(dbc), url: "/api/indicadores/diario", status: http.StatusBadRequest},
+		{nombre: "diario sin pedidos", handler: GetIndicadorDiarioByFecha(dbc), url: "/api/indicadores/diario?fecha=2001-01-01", status: http.StatusNotFound},
+		{nombre: "mensual por fecha", handler: GetIndicadorMensualByFecha(dbc), url: "/api/indicadores/mensual?fecha=" + dia[:7] + "-01", status: http.StatusOK},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			status, resp := llamar(t, c.handler, http.MethodGet, c.url, "")
+			if status != c.status {
+				t.Fatalf("status = %d, se esperaba %d: %v", status, c.status, resp)
+			}
+			if status != http.StatusOK {
+				return
+			}
+			data := resp["data"].(map[string]interface{})
+			if data["num_pedidos"].(float64) != 2 || !casiIgual(data["tot_pedidos"].(float64), 712) || data["num_clientes"].(float64) != 2 {
+				t.Errorf("indicador = %v", data)
+			}
+		})
+	}
+
+	comprobarOtra := func(etapa string) {
+		t.Helper()
+		for _, url := range []string{"/api/indicadores/diario?fecha=" + dia, "/api/indicadores/mensual?fecha=" + dia[:7]} {
+			h := GetIndicadorDiarioByFecha(dbc)
+			if strings.Contains(url, "mensual") {
+				h = GetIndicadorMensualByFecha(dbc)
+			}
+			status, resp := llamarEmpresa(t, integracion.IDOtraEmpresa, h, http.MethodGet, url, "")
+			if status != http.StatusOK {
+				t.Fatalf("%s: otra empresa %s: status %d: %v", etapa, url, status, resp)
+			}
+			data := resp["data"].(map[string]interface{})
+			if data["num_pedidos"].(float64) != 1 || !casiIgual(data["tot_pedidos"].(float64), 100) || data["num_clientes"].(float64) != 1 {
+				t.Errorf("%s: otra empresa %s = %v", etapa, url, data)
+			}
+		}
+		status, resp := llamar(t, GetIndicadoresDiarioAll(dbc), http.MethodGet, "/api/indicadores/diario", "")
+		if lista, _ := resp["data"].([]interface{}); status != http.StatusOK || len(lista) != 1 || lista[0].(map[string]interface{})["num_pedidos"].(float64) != 2 {
+			t.Errorf("%s: diarios de la empresa: status %d: %v", etapa, status, resp)
+		}
+	}
+	comprobarOtra("al crear")
+
+	// Recalcular desde cero deja a cada empresa con lo suyo
+	for _, tabla := range []string{"ind_diario", "ind_mensual"} {
+		if _, err := dbc.Local.Exec("DELETE FROM " + tabla); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := InicializaIndicadoresHistoricos(context.Background(), dbc); err != nil {
+		t.Fatal(err)
+	}
+	comprobarOtra("al recalcular")
+}
+
+// Los pedidos cerca de medianoche cuentan en el día del negocio aunque en UTC
+// ya sea el siguiente, también en los días con cambio de horario.
+func TestIntegracionIndicadoresZonaHoraria(t *testing.T) {
+	type pedido struct {
+		hora string // en la zona del negocio
+		utc  string // fecha_creacion guardada
+		dia  string
+		mes  string
+	}
+	casos := []struct {
+		zona    string
+		pedidos []pedido
+	}{
+		{"America/Merida", []pedido{
+			{"2026-03-31 23:30", "2026-04-01 05:30:00", "2026-03-31", "2026-03-01"},
+			{"2026-04-01 00:30", "2026-04-01 06:30:00", "2026-04-01", "2026-04-01"},
+		}},
+		{"America/Tijuana", []pedido{
+			// el 8 de marzo dura 23 horas y el 1 de noviembre 25
+			{"2026-03-08 23:30", "2026-03-09 06:30:00", "2026-03-08", "2026-03-01"},
+			{"2026-11-01 23:30", "2026-11-02 07:30:00", "2026-11-01", "2026-11-01"},
+		}},
+	}
+	for _, c := range casos {
+		t.Run(c.zona, func(t *testing.T) {
+			dbc := integracion.Iniciar(t)
+			zona, err := time.LoadLocation(c.zona)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fijo := reloj.NuevoFijo(time.Time{})
+			crear := conReloj(CreatePedido(repositorio.NuevoMySQL(dbc)), fijo)
+			for _, p := range c.pedidos {
+				hora, _ := time.ParseInLocation("2006-01-02 15:04", p.hora, zona)
+				fijo.Fijar(hora)
+				if status, resp := llamar(t, crear, http.MethodPost, "/api/pedidos", pedidoDosRenglones); status != http.StatusOK {
+					t.Fatalf("%s: status %d: %v", p.hora, status, resp)
+				}
+			}
+
+			comprobar := func(etapa string) {
+				t.Helper()
+				for _, p := range c.pedidos {
+					if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM pedidos WHERE fecha_creacion = ?", p.utc); n != 1 {
+						t.Errorf("%s: no hay pedido con fecha_creacion %s en UTC", etapa, p.utc)
+					}
+					if n := contar(t, dbc.Local, "SELECT IFNULL(SUM(num_pedidos), 0) FROM ind_diario WHERE fecha = ?", p.dia); n != 1 {
+						t.Errorf("%s: ind_diario %s tiene %d pedidos, se esperaba 1", etapa, p.dia, n)
+					}
+					if n := contar(t, dbc.Local, "SELECT IFNULL(SUM(num_clientes), 0) FROM ind_mensual WHERE fecha = ?", p.mes); n != 1 {
+						t.Errorf("%s: ind_mensual %s tiene %d clientes, se esperaba 1", etapa, p.mes, n)
+					}
+				}
+			}
+			comprobar("al crear")
+
+			// Recalcular desde cero da los mismos días
+			for _, tabla := range []string{"ind_diario", "ind_mensual"} {
+				if _, err := dbc.Local.Exec("DELETE FROM " + tabla); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := InicializaIndicadoresHistoricos(reloj.Con(context.Background(), fijo), dbc); err != nil {
+				t.Fatal(err)
+			}
+			comprobar("al recalcular")
+		})
+	}
+}
+
+func TestIntegracionLogin(t *testing.T) {
+	casos := []struct {
+		nombre  string
+		correo  string
+		clave   string
+		status  int
+		mensaje string
+	}{
+		{nombre: "cliente", correo: integracion.CorreoCliente, clave: integracion.ClaveUsuarios, status: http.StatusOK, mensaje: "Login exitoso"},
+		{nombre: "admin", correo: integracion.CorreoAdmin, clave: integracion.ClaveUsuarios, status: http.StatusOK, mensaje: "Login exitoso (admin)"},
+		{nombre: "clave incorrecta", correo: integracion.CorreoCliente, clave: "otra", status: http.StatusUnauthorized},
+		{nombre: "usuario suspendido", correo: integracion.CorreoSuspendido, clave: integracion.ClaveUsuarios, status: http.StatusUnauthorized},
+		{nombre: "correo desconocido", correo: "nadie@example.com", clave: "x", status: http.StatusUnauthorized},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			dbc := integracion.Iniciar(t)
+			body := fmt.Sprintf(`{"correo": %q, "clave": %q}`, c.correo, c.clave)
+			status, resp := llamar(t, LoginUsuario(dbc, repositorio.NuevoMySQL(dbc)), http.MethodPost, "/api/login", body)
+			if status != c.status {
+				t.Fatalf("status = %d, se esperaba %d: %v", status, c.status, resp)
+			}
+			tokens := contar(t, dbc.Local, "SELECT COUNT(*) FROM refresh_tokens WHERE estado = 'activo'")
+			if status != http.StatusOK {
+				if tokens != 0 {
+					t.Errorf("un login fallido guardó %d refresh tokens", tokens)
+				}
+				return
+			}
+			if resp["message"] != c.mensaje {
+				t.Errorf("mensaje = %v", resp["message"])
+			}
+			data := resp["data"].(map[string]interface{})
+			if token, _ := data["access_token"].(string); token == "" {
+				t.Error("sin access_token")
+			}
+			if tokens != 1 {
+				t.Errorf("refresh tokens activos = %d, se esperaba 1", tokens)
+			}
+		})
+	}
+}
+
+func TestIntegracionRefresh(t *testing.T) {
+	dbc := integracion.Iniciar(t)
+	const token = "token-de-prueba"
+	hash, err := bcrypt.GenerateFromPassword([]byte(token), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Último uso hace dos horas para que no cuente como sesión activa en otro equipo.
+	ahora := time.Now().UTC()
+	_, err = dbc.Local.Exec(`
+		INSERT INTO refresh_tokens (usuario_id, tipo_usuario, token_hash, expiracion, ultimo_uso, estado)
+		VALUES (?, 'C', ?, ?, ?, 'activo')`,
+		integracion.IDUsuarioCliente, string(hash),
+		ahora.Add(24*time.Hour).Format("2006-01-02 15:04:05"), ahora.Add(-2*time.Hour).Format("2006-01-02 15:04:05"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Los casos van en orden: el primero consume el token y el segundo lo reusa.
+	casos := []struct {
+		nombre string
+		body   string
+		status int
+	}{
+		{nombre: "token válido", body: `{"refresh_token": "` + token + `"}`, status: http.StatusOK},
+		{nombre: "token ya usado", body: `{"refresh_token": "` + token + `"}`, status: http.StatusUnauthorized},
+		{nombre: "token desconocido", body: `{"refresh_token": "otro"}`, status: http.StatusUnauthorized},
+		{nombre: "sin token", body: `{}`, status: http.StatusBadRequest},
+	}
+	for _, c := range casos {
+		status, resp := llamar(t, RefreshTokenEndpoint(dbc), http.MethodPost, "/api/refresh", c.body)
+		if status != c.status {
+			t.Fatalf("%s: status = %d, se esperaba %d: %v", c.nombre, status, c.status, resp)
+		}
+		if status == http.StatusOK {
+			data := resp["data"].(map[string]interface{})
+			nuevo, _ := data["refresh_token"].(string)
+			if nuevo == "" || nuevo == token {
+				t.Errorf("%s: refresh_token nuevo = %q", c.nombre, nuevo)
+			}
+		}
+	}
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM refresh_tokens WHERE estado = 'revocado'"); n != 1 {
+		t.Errorf("tokens revocados = %d, se esperaba 1", n)
+	}
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM refresh_tokens WHERE estado = 'activo'"); n != 1 {
+		t.Errorf("tokens activos = %d, se esperaba 1", n)
+	}
+}
+
+func TestIntegracionRegistroGeocerca(t *testing.T) {
+	casos := []struct {
+		nombre   string
+		rfc      string
+		lat, lng float64
+		status   int
+		sucursal int
+	}{
+		{nombre: "dentro del polígono", rfc: "AAA010101AA1", lat: 20.97, lng: -89.62, status: http.StatusOK, sucursal: integracion.IDSucursalCentro},
+		{nombre: "dentro del círculo", rfc: "AAA010101AA2", lat: 21.06, lng: -89.62, status: http.StatusOK, sucursal: integracion.IDSucursalNorte},
+		{nombre: "fuera de cobertura asigna la más cercana", rfc: "AAA010101AA3", lat: 20.90, lng: -89.70, status: http.StatusOK, sucursal: integracion.IDSucursalCentro},
+		{nombre: "rfc de un cliente del ERP que ya tiene cuenta", rfc: "TPR250101AAA", lat: 20.97, lng: -89.62, status: http.StatusConflict},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			dbc := integracion.Iniciar(t)
+			body := fmt.Sprintf(`{
+				"usuario": {"tipo_usuario": "C", "nombre_completo": "Nuevo", "correo": "nuevo@example.com", "telefono": "9991112233", "clave": "secreta"},
+				"tienda": {"nombre_tienda": "Tienda %s", "razon_social": "Nueva SA", "rfc": %q, "direccion": "Calle 1, Centro, 97000 Mérida",
+					"codigo_postal": "97000", "ciudad": "Mérida", "estado": "Yucatán", "pais": "México", "latitud": %f, "longitud": %f}
+			}`, c.rfc, c.rfc, c.lat, c.lng)
+			status, resp := llamar(t, RegistroUsuarioTienda(repositorio.NuevoMySQL(dbc), avisos.Bitacora{}), http.MethodPost, "/api/registro", body)
+			if status != c.status {
+				t.Fatalf("status = %d, se esperaba %d: %v", status, c.status, resp)
+			}
+			if status != http.StatusOK {
+				if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM usuarios WHERE correo = 'nuevo@example.com'"); n != 0 {
+					t.Error("no debía crearse el usuario")
+				}
+				return
+			}
+
+			var idSucursal int
+			var latUbic, lngUbic float64
+			err := dbc.Local.QueryRow(`
+				SELECT t.idsucursal, ST_Y(t.ubicacion), ST_X(t.ubicacion)
+				FROM tiendas t JOIN usuarios u ON u.id_usuario = t.id_usuario
+				WHERE u.correo = 'nuevo@example.com'`).Scan(&idSucursal, &latUbic, &lngUbic)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if idSucursal != c.sucursal {
+				t.Errorf("sucursal asignada = %d, se esperaba %d", idSucursal, c.sucursal)
+			}
+			if !casiIgual(latUbic, c.lat) || !casiIgual(lngUbic, c.lng) {
+				t.Errorf("ubicacion = (%v, %v)", latUbic, lngUbic)
+			}
+			if n := contar(t, dbc.Remote, "SELECT COUNT(*) FROM crm_clientes WHERE rfc = ?", c.rfc); n != 1 {
+				t.Errorf("clientes remotos con el RFC = %d", n)
+			}
+			if n := contar(t, dbc.Remote, "SELECT idcliente FROM crm_indices WHERE idsucursal = 1"); n != 2 {
+				t.Errorf("crm_indices.idcliente = %d, se esperaba 2", n)
+			}
+			if n := contar(t, dbc.Local, `
+				SELECT COUNT(*) FROM direcciones_tienda d JOIN tiendas t ON t.id_tienda = d.id_tienda
+				WHERE t.nombre_tienda = ? AND d.predeterminada AND d.latitud = ? AND d.longitud = ?`, "Tienda "+c.rfc, c.lat, c.lng); n != 1 {
+				t.Errorf("direcciones predeterminadas con la ubicación del registro = %d", n)
+			}
+		})
+	}
+}
+
+// El correo es único por empresa: el cliente de la empresa 1 puede
+// registrarse en la 2 con el mismo correo, pero no otra vez en la 1.
+func TestIntegracionRegistroCorreoPorEmpresa(t *testing.T) {
+	dbc := integracion.Iniciar(t)
+	repos := repositorio.NuevoMySQL(dbc)
+	registro := func(rfc string) string {
+		return fmt.Sprintf(`{
+			"usuario": {"tipo_usuario": "C", "nombre_completo": "Otro", "correo": %q, "telefono": "9991112233", "clave": "secreta"},
+			"tienda": {"nombre_tienda": "Tienda %s", "rfc": %q, "direccion": "Calle 1, Centro, 97000 Mérida",
+				"codigo_postal": "97000", "latitud": 20.97, "longitud": -89.62}
+		}`, integracion.CorreoCliente, rfc, rfc)
+	}
+
+	status, resp := llamar(t, RegistroUsuarioTienda(repos, avisos.Bitacora{}), http.MethodPost, "/api/registro", registro("AAA010101AA1"))
+	if status != http.StatusBadRequest || resp["error"].(map[string]interface{})["code"] != string(errores.CorreoRegistrado) {
+		t.Fatalf("misma empresa: status = %d: %v", status, resp)
+	}
+	status, resp = llamarEmpresa(t, integracion.IDOtraEmpresa, RegistroUsuarioTienda(repos, avisos.Bitacora{}), http.MethodPost, "/api/registro", registro("AAA010101AA2"))
+	if status != http.StatusOK {
+		t.Fatalf("otra empresa: status = %d: %v", status, resp)
+	}
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM usuarios WHERE correo = ?", integracion.CorreoCliente); n != 2 {
+		t.Errorf("usuarios con el correo = %d, se esperaban 2", n)
+	}
+}
+
+// registroLupita es el alta de una tienda que ya es el cliente 7 del ERP,
+// que agrega clienteLupita.
+const registroLupita = `{
+	"usuario": {"tipo_usuario": "C", "nombre_completo": "Lupita", "correo": "lupita@example.com", "telefono": "9991112233", "clave": "secreta"},
+	"tienda": {"nombre_tienda": "Abarrotes Lupita", "rfc": "LUP800101AB1", "direccion": "Calle 1, Centro, 97000 Mérida",
+		"codigo_postal": "97000", "latitud": 20.97, "longitud": -89.62}
+}`
+
+func clienteLupita(t *testing.T, dbc *db.DBConnection) {
+	t.Helper()
+	if _, err := dbc.Remote.Exec(`
+		INSERT INTO crm_clientes (id_cliente, idsucursal, estatus, nombre_comercial, razon_social, rfc, idcliente, tipo_cliente, lista_precio, tel_contacto, clave)
+		VALUES (7, 1, 'S', 'Abarrotes Lupita', 'Lupita SA', 'LUP800101AB1', 7, 'C', 1, '9995550101', '000007')`); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// confirmarReclamoHTTP prueba codigo en el reclamo idReclamo.
+func confirmarReclamoHTTP(t *testing.T, repos repositorio.Repositorios, idReclamo, codigo string) (int, map[string]interface{}) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		ConfirmarReclamo(repos)(w, mux.SetURLVars(r, map[string]string{"id_reclamo": idReclamo}))
+	}
+	return llamar(t, h, http.MethodPost, "/api/registro/reclamos/"+idReclamo+"/confirmar", `{"codigo": "`+codigo+`"}`)
+}
+
+func TestIntegracionReclamoClienteRemoto(t *testing.T) {
+	dbc := integracion.Iniciar(t)
+	repos := repositorio.NuevoMySQL(dbc)
+	clienteLupita(t, dbc)
+	var enviados avisosEnviados
+	status, resp := llamar(t, RegistroUsuarioTienda(repos, &enviados), http.MethodPost, "/api/registro", registroLupita)
+	if status != http.StatusAccepted {
+		t.Fatalf("registro: status = %d: %v", status, resp)
+	}
+	idReclamo := fmt.Sprint(resp["data"].(map[string]interface{})["id_reclamo"])
+	if len(enviados) != 1 || !strings.HasPrefix(enviados[0], "9995550101: ") {
+		t.Fatalf("mensajes = %q", enviados)
+	}
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM usuarios WHERE correo = 'lupita@example.com'"); n != 0 {
+		t.Fatal("no debía crearse el usuario antes de confirmar")
+	}
+
+	confirmar := func(codigo string) (int, map[string]interface{}) {
+		return confirmarReclamoHTTP(t, repos, idReclamo, codigo)
+	}
+	if status, resp := confirmar("12345"); status != http.StatusBadRequest {
+		t.Errorf("código incorrecto: status = %d: %v", status, resp)
+	}
+	status, resp = confirmar(codigoEnviado(t, enviados))
+	if status != http.StatusOK {
+		t.Fatalf("confirmar: status = %d: %v", status, resp)
+	}
+	usuario := resp["data"].(map[string]interface{})["usuario"].(map[string]interface{})
+	if usuario["id_remoto"] != float64(7) || usuario["clave_remota"] != "000007" {
+		t.Errorf("usuario = %v", usuario)
+	}
+
+	if n := contar(t, dbc.Local, `
+		SELECT COUNT(*) FROM tiendas t JOIN usuarios u ON u.id_usuario = t.id_usuario
+		WHERE u.correo = 'lupita@example.com' AND u.id_remoto = 7 AND t.id_remoto = 7 AND t.clave_remota = '000007'`); n != 1 {
+		t.Error("el usuario y su tienda no quedaron ligados al cliente 7")
+	}
+	if n := contar(t, dbc.Remote, "SELECT COUNT(*) FROM crm_clientes WHERE rfc = 'LUP800101AB1'"); n != 1 {
+		t.Errorf("clientes remotos con el RFC = %d, no debía crearse otro", n)
+	}
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM reclamos_cliente WHERE estatus = 'confirmado' AND intentos = 2 AND id_usuario IS NOT NULL"); n != 1 {
+		t.Error("el reclamo no quedó confirmado")
+	}
+	if status, _ := confirmar(codigoEnviado(t, enviados)); status != http.StatusConflict {
+		t.Errorf("reclamo ya usado: status = %d", status)
+	}
+}
+
+// Volver a registrarse no repone los intentos del reclamo anterior y después de
+// reclamosPorVentana reclamos en la hora ya no se manda otro código.
+func TestIntegracionReclamosAgotados(t *testing.T) {
+	dbc := integracion.Iniciar(t)
+	repos := repositorio.NuevoMySQL(dbc)
+	clienteLupita(t, dbc)
+	var enviados avisosEnviados
+	registrar := func() (int, map[string]interface{}) {
+		return llamar(t, RegistroUsuarioTienda(repos, &enviados), http.MethodPost, "/api/registro", registroLupita)
+	}
+
+	status, resp := registrar()
+	if status != http.StatusAccepted {
+		t.Fatalf("primer registro: status = %d: %v", status, resp)
+	}
+	idReclamo := fmt.Sprint(resp["data"].(map[string]interface{})["id_reclamo"])
+	for i := 0; i < 2; i++ {
+		if status, resp := confirmarReclamoHTTP(t, repos, idReclamo, "000000"); status != http.StatusBadRequest {
+			t.Fatalf("código incorrecto: status = %d: %v", status, resp)
+		}
+	}
+
+	for i := 2; i <= reclamosPorVentana; i++ {
+		status, resp = registrar()
+		if status != http.StatusAccepted {
+			t.Fatalf("registro %d: status = %d: %v", i, status, resp)
+		}
+		if intentos := resp["data"].(map[string]interface{})["intentos"]; intentos != float64(intentosReclamo-2) {
+			t.Errorf("registro %d: intentos = %v, se esperaba %d", i, intentos, intentosReclamo-2)
+		}
+	}
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM reclamos_cliente WHERE estatus = 'pendiente' AND intentos = 2"); n != 1 {
+		t.Error("el reclamo pendiente no heredó los intentos gastados")
+	}
+
+	status, resp = registrar()
+	if status != http.StatusTooManyRequests || resp["error"].(map[string]interface{})["code"] != string(errores.ReclamosAgotados) {
+		t.Fatalf("registro de más: status = %d: %v", status, resp)
+	}
+	if len(enviados) != reclamosPorVentana {
+		t.Errorf("mensajes = %d, se esperaban %d", len(enviados), reclamosPorVentana)
+	}
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM reclamos_cliente"); n != reclamosPorVentana {
+		t.Errorf("reclamos = %d, se esperaban %d", n, reclamosPorVentana)
+	}
+}
+
+func TestIntegracionPedidosPaginados(t *testing.T) {
+	dbc := integracion.Iniciar(t)
+	for i := 0; i < 3; i++ {
+		crearPedido(t, dbc, pedidoDosRenglones)
+	}
+
+	casos := []struct {
+		nombre  string
+		query   string
+		total   int
+		pagina  int
+		primero float64
+	}{
+		{nombre: "primera página", query: "page=1&perPage=2", total: 3, pagina: 2, primero: 3},
+		{nombre: "última página", query: "page=2&perPage=2", total: 3, pagina: 1, primero: 1},
+		{nombre: "fuera de rango", query: "page=5&perPage=2", total: 3, pagina: 0},
+		{nombre: "por sucursal", query: "sucursal=Centro", total: 3, pagina: 3, primero: 3},
+		{nombre: "por estatus sin resultados", query: "estatus=entregado", total: 0, pagina: 0},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			status, resp := llamar(t, AdminGetPedidosConDetallesPaginado(dbc), http.MethodGet, "/api/admin/pedidos/paginado?"+c.query, "")
+			if status != http.StatusOK {
+				t.Fatalf("status = %d: %v", status, resp)
+			}
+			data := resp["data"].(map[string]interface{})
+			pedidos, _ := data["pedidos"].([]interface{})
+			if int(data["total"].(float64)) != c.total || len(pedidos) != c.pagina {
+				t.Fatalf("total %v, en la página %d; se esperaba %d y %d", data["total"], len(pedidos), c.total, c.pagina)
+			}
+			if c.pagina == 0 {
+				return
+			}
+			primero := pedidos[0].(map[string]interface{})
+			pedido := primero["pedido"].(map[string]interface{})
+			if pedido["id_pedido"].(float64) != c.primero {
+				t.Errorf("primer pedido = %v, se esperaba %v", pedido["id_pedido"], c.primero)
+			}
+			if detalles, _ := primero["detalles"].([]interface{}); len(detalles) != 2 {
+				t.Errorf("detalles del pedido = %d", len(detalles))
+			}
+		})
+	}
+}
+
+// v1 y v2 regresan el mismo catálogo con distinta forma.
+func TestIntegracionProductosV2(t *testing.T) {
+	dbc := integracion.Iniciar(t)
+
+	status, v1 := llamar(t, GetProductos(dbc), http.MethodGet, "/api/v1/productos?id_usuario=1", "")
+	if status != http.StatusOK {
+		t.Fatalf("v1: status %d: %v", status, v1)
+	}
+	if int(v1["total"].(float64)) != 2 || v1["productos"].([]interface{})[0].(map[string]interface{})["idproducto"].(float64) != 100 {
+		t.Fatalf("v1 = %v", v1)
+	}
+
+	casos := []struct {
+		nombre, query string
+		ids           []float64
+		paginacion    map[string]float64
+	}{
+		{nombre: "todos", query: "", ids: []float64{100, 200}, paginacion: map[string]float64{"pagina": 1, "limite": 20, "total": 2, "paginas": 1}},
+		{nombre: "segunda página", query: "&page=2&limit=1", ids: []float64{200}, paginacion: map[string]float64{"pagina": 2, "limite": 1, "total": 2, "paginas": 2}},
+		{nombre: "límite acotado", query: "&limit=500", ids: []float64{100, 200}, paginacion: map[string]float64{"pagina": 1, "limite": 100, "total": 2, "paginas": 1}},
+		{nombre: "página vacía", query: "&page=3&limit=1", ids: []float64{}, paginacion: map[string]float64{"pagina": 3, "limite": 1, "total": 2, "paginas": 2}},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			status, resp := llamar(t, GetProductosV2(dbc), http.MethodGet, "/api/v2/productos?id_usuario=1"+c.query, "")
+			if status != http.StatusOK {
+				t.Fatalf("status %d: %v", status, resp)
+			}
+			data, ok := resp["data"].([]interface{})
+			if !ok || len(data) != len(c.ids) {
+				t.Fatalf("data = %v", resp["data"])
+			}
+			for i, id := range c.ids {
+				p := data[i].(map[string]interface{})
+				if p["id"] != id || p["precio"] == nil {
+					t.Errorf("data[%d] = %v", i, p)
+				}
+				if _, ok := p["idproducto"]; ok {
+					t.Errorf("data[%d] trae el campo de v1 idproducto", i)
+				}
+			}
+			pag := resp["paginacion"].(map[string]interface{})
+			for k, v := range c.paginacion {
+				if pag[k] != v {
+					t.Errorf("paginacion.%s = %v, se esperaba %v", k, pag[k], v)
+				}
+			}
+		})
+	}
+
+	status, resp := llamar(t, GetProductosV2(dbc), http.MethodGet, "/api/v2/productos", "")
+	if status != http.StatusBadRequest {
+		t.Errorf("sin id_usuario: status %d: %v", status, resp)
+	}
+}
+
+// Dos empresas en la misma base: ni el catálogo, ni los pedidos, ni las
+// sesiones de una se ven desde la otra.
+func TestIntegracionMultiempresa(t *testing.T) {
+	dbc := integracion.Iniciar(t)
+
+	t.Run("catálogo", func(t *testing.T) {
+		for idEmpresa, total := range map[int]float64{integracion.IDEmpresa: 2, integracion.IDOtraEmpresa: 1} {
+			status, resp := llamarEmpresa(t, idEmpresa, GetEstatusProductos(dbc), http.MethodGet, "/api/v1/productos/estatus?estatus=S", "")
+			if status != http.StatusOK || resp["total"] != total {
+				t.Errorf("empresa %d: status %d, total %v, se esperaba %v", idEmpresa, status, resp["total"], total)
+			}
+		}
+		status, resp := llamarEmpresa(t, 0, GetEstatusProductos(dbc), http.MethodGet, "/api/v1/productos/estatus?estatus=S", "")
+		if status != http.StatusBadRequest || resp["error"].(map[string]interface{})["code"] != string(errores.EmpresaRequerida) {
+			t.Errorf("sin empresa: status %d: %v", status, resp)
+		}
+	})
+
+	t.Run("pedidos", func(t *testing.T) {
+		id := crearPedido(t, dbc, pedidoDosRenglones)
+		if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM pedidos WHERE id_pedido = ? AND id_empresa = ?", id, integracion.IDEmpresa); n != 1 {
+			t.Fatalf("el pedido %d no quedó en la empresa %d", id, integracion.IDEmpresa)
+		}
+		url := fmt.Sprintf("/api/v1/pedidos/verificar_sincronizacion?id_pedido=%d", id)
+		if status, resp := llamar(t, VerificarSincronizacion(dbc), http.MethodGet, url, ""); status != http.StatusOK {
+			t.Errorf("misma empresa: status %d: %v", status, resp)
+		}
+		if status, resp := llamarEmpresa(t, integracion.IDOtraEmpresa, VerificarSincronizacion(dbc), http.MethodGet, url, ""); status != http.StatusNotFound {
+			t.Errorf("otra empresa: status %d: %v", status, resp)
+		}
+
+		// Una sucursal de otra empresa no se puede elegir
+		body := strings.Replace(pedidoDosRenglones, `"id_sucursal": 1`, fmt.Sprintf(`"id_sucursal": %d`, integracion.IDSucursalOtra), 1)
+		status, resp := llamar(t, CreatePedido(repositorio.NuevoMySQL(dbc)), http.MethodPost, "/api/v1/pedidos", body)
+		if status != http.StatusNotFound || resp["error"].(map[string]interface{})["code"] != string(errores.SucursalNoEncontrada) {
+			t.Errorf("sucursal ajena: status %d: %v", status, resp)
+		}
+	})
+
+	t.Run("sesiones", func(t *testing.T) {
+		repos := repositorio.NuevoMySQL(dbc)
+		login := fmt.Sprintf(`{"correo": %q, "clave": %q}`, integracion.CorreoAdminOtra, integracion.ClaveUsuarios)
+		if status, resp := llamar(t, LoginUsuario(dbc, repos), http.MethodPost, "/api/v1/login", login); status != http.StatusUnauthorized {
+			t.Fatalf("admin de otra empresa: status %d: %v", status, resp)
+		}
+		status, resp := llamarEmpresa(t, integracion.IDOtraEmpresa, LoginUsuario(dbc, repos), http.MethodPost, "/api/v1/login", login)
+		if status != http.StatusOK {
+			t.Fatalf("admin en su empresa: status %d: %v", status, resp)
+		}
+		token := resp["data"].(map[string]interface{})["access_token"].(string)
+
+		// Sin dominio ni X-Empresa (hay dos empresas activas) vale la del token
+		h := empresas.Middleware(repos.Empresas)(middlewares.JWTAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, empresas.Desde(r.Context()))
+		})))
+		casos := []struct {
+			nombre, header string
+			status         int
+		}{
+			{nombre: "empresa del token", status: http.StatusOK},
+			{nombre: "X-Empresa igual al token", header: "2", status: http.StatusOK},
+			{nombre: "X-Empresa de otra empresa", header: "1", status: http.StatusForbidden},
+		}
+		for _, c := range casos {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/productos", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			if c.header != "" {
+				req.Header.Set(empresas.Header, c.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != c.status {
+				t.Errorf("%s: status %d, se esperaba %d: %s", c.nombre, rec.Code, c.status, rec.Body)
+			} else if c.status == http.StatusOK && rec.Body.String() != "2" {
+				t.Errorf("%s: empresa = %s", c.nombre, rec.Body)
+			}
+		}
+	})
+
+	t.Run("administradores", func(t *testing.T) {
+		if _, err := dbc.Local.Exec(`
+			INSERT INTO admin_usuarios (idusuario, idempresa, idperfil, permisos, tipo_usuario, correo, clave)
+			VALUES (3, NULL, 1, '{}', 'Admin', 'grupo@example.com', 'x')`); err != nil {
+			t.Fatal(err)
+		}
+		// sesion firma un token como el de login; idEmpresa 0 no lleva el claim
+		sesion := func(id int, tipo string, idEmpresa int) string {
+			t.Helper()
+			claims := jwt.MapClaims{"id": id, "tipo": tipo, "correo": "x@example.com", "exp": time.Now().Add(time.Minute).Unix()}
+			if idEmpresa != 0 {
+				claims["empresa"] = idEmpresa
+			}
+			token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return token
+		}
+		con := func(token string, h http.HandlerFunc) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				r.Header.Set("Authorization", "Bearer "+token)
+				middlewares.JWTAuthMiddleware(h).ServeHTTP(w, r)
+			}
+		}
+		admin := `{"idperfil": 1, "permisos": "{}", "tipo_usuario": "Admin", "correo": "grupo@example.com"}`
+
+		// El admin de la empresa 2 no toca a los del grupo
+		deEmpresa := sesion(2, "A", integracion.IDOtraEmpresa)
+		if status, resp := llamarEmpresa(t, integracion.IDOtraEmpresa, con(deEmpresa, UpdateAdminUsuario(dbc)), http.MethodPut, "/api/v1/admin/usuarios?id=3", admin); status != http.StatusNotFound {
+			t.Errorf("PUT admin del grupo: status %d: %v", status, resp)
+		}
+		if status, resp := llamarEmpresa(t, integracion.IDOtraEmpresa, con(deEmpresa, DeleteAdminUsuario(dbc)), http.MethodDelete, "/api/v1/admin/usuarios?id=3", ""); status != http.StatusNotFound {
+			t.Errorf("DELETE admin del grupo: status %d: %v", status, resp)
+		}
+		if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM admin_usuarios WHERE idusuario = 3"); n != 1 {
+			t.Fatal("se borró el admin del grupo")
+		}
+
+		// El del grupo sí
+		delGrupo := sesion(1, "A", 0)
+		if status, resp := llamarEmpresa(t, integracion.IDOtraEmpresa, con(delGrupo, DeleteAdminUsuario(dbc)), http.MethodDelete, "/api/v1/admin/usuarios?id=3", ""); status != http.StatusOK {
+			t.Errorf("DELETE como admin del grupo: status %d: %v", status, resp)
+		}
+		if status, resp := llamarEmpresa(t, integracion.IDOtraEmpresa, con(delGrupo, DeleteAdminUsuario(dbc)), http.MethodDelete, "/api/v1/admin/usuarios?id=3", ""); status != http.StatusNotFound {
+			t.Errorf("DELETE dos veces: status %d: %v", status, resp)
+		}
+
+		// Un cliente siempre es de una empresa
+		ok := func(w http.ResponseWriter, r *http.Request) {}
+		if status, _ := llamarEmpresa(t, integracion.IDOtraEmpresa, con(sesion(integracion.IDUsuarioCliente, "C", 0), ok), http.MethodGet, "/api/v1/perfil", ""); status != http.StatusUnauthorized {
+			t.Errorf("token de cliente sin empresa: status %d", status)
+		}
+	})
+}
+
+func TestIntegracionEstatusPedido(t *testing.T) {
+	dbc := integracion.Iniciar(t)
+	id := crearPedido(t, dbc, pedidoDosRenglones)
+	cambiar := func(body string) (int, map[string]interface{}) {
+		t.Helper()
+		return llamar(t, func(w http.ResponseWriter, r *http.Request) {
+			AdminActualizarEstatusPedido(dbc)(w, mux.SetURLVars(r, map[string]string{"id_pedido": fmt.Sprint(id)}))
+		}, http.MethodPut, fmt.Sprintf("/api/v1/pedidos/%d/estatus", id), body)
+	}
+	estatus := func() string {
+		t.Helper()
+		var e string
+		if err := dbc.Local.QueryRow("SELECT estatus FROM pedidos WHERE id_pedido = ?", id).Scan(&e); err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+
+	if status, resp := cambiar(`{"estatus": "enviado"}`); status != http.StatusOK || estatus() != "enviado" {
+		t.Fatalf("estatus válido: status %d: %v", status, resp)
+	}
+	for _, body := range []string{`{"estatus": "perdido"}`, `{"estatus": "Enviado"}`, `{"estatus": ""}`} {
+		status, resp := cambiar(body)
+		e, _ := resp["error"].(map[string]interface{})
+		campos, _ := e["fields"].([]interface{})
+		if status != http.StatusBadRequest || len(campos) != 1 || campos[0].(map[string]interface{})["field"] != "estatus" {
+			t.Errorf("%s: status %d: %v", body, status, resp)
+		}
+	}
+	if e := estatus(); e != "enviado" {
+		t.Errorf("estatus = %q después de los rechazados", e)
+	}
+}
+
+func TestIntegracionConfigEntrega(t *testing.T) {
+	dbc := integracion.Iniciar(t)
+	repos := repositorio.NuevoMySQL(dbc)
+	porSucursal := func(url string, id int) string { return fmt.Sprintf("%s?id_sucursal=%d", url, id) }
+	efectiva := func(t *testing.T, url string) map[string]interface{} {
+		t.Helper()
+		status, resp := llamar(t, GetConfigEntrega(repos), http.MethodGet, url, "")
+		if status != http.StatusOK {
+			t.Fatalf("GET %s: status %d: %v", url, status, resp)
+		}
+		return resp["data"].(map[string]interface{})["efectiva"].(map[string]interface{})
+	}
+
+	if e := efectiva(t, "/api/v1/admin/config-entrega"); e["tiempo_procesamiento"] != 2.0 {
+		t.Errorf("sin configuración guardada: %v", e)
+	}
+
+	empresa := `{"dias_habiles": ["LUNES", "MARTES", "MIERCOLES", "JUEVES", "VIERNES", "SABADO", "DOMINGO"], "tiempo_procesamiento": 1,
+		"horarios_entrega": [{"etiqueta": "Mediodía", "inicio": "10:00", "fin": "14:00"}]}`
+	if status, resp := llamar(t, UpdateConfigEntrega(dbc, repos), http.MethodPost, "/api/v1/admin/config-entrega", empresa); status != http.StatusOK {
+		t.Fatalf("empresa: status %d: %v", status, resp)
+	}
+	url := porSucursal("/api/v1/admin/config-entrega", integracion.IDSucursalCentro)
+	sucursal := `{"horarios_entrega": [{"etiqueta": "Temprano", "inicio": "07:30", "fin": "11:00"}]}`
+	if status, resp := llamar(t, UpdateConfigEntrega(dbc, repos), http.MethodPost, url, sucursal); status != http.StatusOK {
+		t.Fatalf("sucursal: status %d: %v", status, resp)
+	}
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM config_entrega WHERE idempresa = ?", integracion.IDEmpresa); n != 2 {
+		t.Errorf("renglones en config_entrega = %d, se esperaban 2", n)
+	}
+
+	// La sucursal sólo cambia el horario; lo demás lo hereda de la empresa
+	e := efectiva(t, url)
+	horarios := e["horarios_entrega"].([]interface{})
+	if e["tiempo_procesamiento"] != 1.0 || len(e["dias_habiles"].([]interface{})) != 7 ||
+		len(horarios) != 1 || horarios[0].(map[string]interface{})["inicio"] != "07:30" {
+		t.Errorf("efectiva de la sucursal: %v", e)
+	}
+	if e := efectiva(t, porSucursal("/api/v1/admin/config-entrega", integracion.IDSucursalNorte)); e["horarios_entrega"].([]interface{})[0].(map[string]interface{})["inicio"] != "10:00" {
+		t.Errorf("sucursal sin configuración propia: %v", e)
+	}
+
+	rechazos := []struct {
+		nombre, metodo, url, body string
+		h                         http.HandlerFunc
+		status                    int
+	}{
+		{nombre: "tiempo negativo", metodo: http.MethodPost, url: url, body: `{"tiempo_procesamiento": -1}`, h: UpdateConfigEntrega(dbc, repos), status: http.StatusBadRequest},
+		{nombre: "sucursal de otra empresa", metodo: http.MethodPost, url: porSucursal("/api/v1/admin/config-entrega", integracion.IDSucursalOtra), body: sucursal, h: UpdateConfigEntrega(dbc, repos), status: http.StatusNotFound},
+		{nombre: "id_sucursal inválido", metodo: http.MethodGet, url: "/api/v1/admin/config-entrega?id_sucursal=uno", h: GetConfigEntrega(repos), status: http.StatusBadRequest},
+		{nombre: "borrar la de la empresa", metodo: http.MethodDelete, url: "/api/v1/admin/config-entrega", h: DeleteConfigEntrega(dbc, repos), status: http.StatusBadRequest},
+	}
+	for _, c := range rechazos {
+		if status, resp := llamar(t, c.h, c.metodo, c.url, c.body); status != c.status {
+			t.Errorf("%s: status %d, se esperaba %d: %v", c.nombre, status, c.status, resp)
+		}
+	}
+
+	status, resp := llamar(t, GetFechasEntregaDisponibles(repos), http.MethodGet, porSucursal("/api/v1/fechas-entrega-disponibles", integracion.IDSucursalCentro), "")
+	if status != http.StatusOK {
+		t.Fatalf("fechas disponibles: status %d: %v", status, resp)
+	}
+	fechas := resp["data"].([]interface{})
+	if len(fechas) != 7 || fechas[0].(map[string]interface{})["etiqueta"] != "Temprano" {
+		t.Errorf("fechas de la sucursal: %v", fechas)
+	}
+
+	crearPedido(t, dbc, pedidoDosRenglones)
+	var fechaEntrega string
+	if err := dbc.Local.QueryRow("SELECT fecha_entrega FROM pedidos").Scan(&fechaEntrega); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(fechaEntrega, "07:30:00") {
+		t.Errorf("fecha_entrega = %s, se esperaba el horario de la sucursal", fechaEntrega)
+	}
+
+	if status, resp := llamar(t, DeleteConfigEntrega(dbc, repos), http.MethodDelete, url, ""); status != http.StatusOK {
+		t.Fatalf("borrar: status %d: %v", status, resp)
+	}
+	if e := efectiva(t, url); e["horarios_entrega"].([]interface{})[0].(map[string]interface{})["inicio"] != "10:00" {
+		t.Errorf("tras borrar, la sucursal debe heredar de la empresa: %v", e)
+	}
+}
+
+func TestIntegracionReservasEntrega(t *testing.T) {
+	dbc := integracion.Iniciar(t)
+	repos := repositorio.NuevoMySQL(dbc)
+	url := fmt.Sprintf("/api/v1/admin/config-entrega?id_sucursal=%d", integracion.IDSucursalCentro)
+	if status, resp := llamar(t, UpdateConfigEntrega(dbc, repos), http.MethodPost, url, configConCapacidad); status != http.StatusOK {
+		t.Fatalf("config: status %d: %v", status, resp)
+	}
+	manana := hoy().AddDate(0, 0, 1).Format("2006-01-02")
+	apartar := fmt.Sprintf(`{"id_usuario": 1, "id_sucursal": %d, "fecha": %q, "horario": "09:00",
+		"detalles": [{"id_producto": 100, "cantidad": 2}, {"id_producto": 200, "cantidad": 1}]}`, integracion.IDSucursalCentro, manana)
+
+	status, resp := llamar(t, ApartarHorarioEntrega(repos), http.MethodPost, "/api/v1/entregas/reservas", apartar)
+	if status != http.StatusOK {
+		t.Fatalf("apartar: status %d: %v", status, resp)
+	}
+	data := resp["data"].(map[string]interface{})
+	idReserva := int64(data["id_reserva"].(float64))
+	if !casiIgual(data["peso"].(float64), 1.35) {
+		t.Errorf("peso = %v, se esperaba 1.35 (2 × 0.65 + 0.05)", data["peso"])
+	}
+	if status, resp := llamar(t, ApartarHorarioEntrega(repos), http.MethodPost, "/api/v1/entregas/reservas", apartar); status != http.StatusConflict {
+		t.Errorf("segundo apartado en la mañana: status %d: %v", status, resp)
+	}
+
+	status, resp = llamar(t, GetFechasEntregaDisponibles(repos), http.MethodGet, fmt.Sprintf("/api/v1/fechas-entrega-disponibles?id_sucursal=%d", integracion.IDSucursalCentro), "")
+	if status != http.StatusOK {
+		t.Fatalf("fechas: status %d: %v", status, resp)
+	}
+	primera := resp["data"].([]interface{})[0].(map[string]interface{})
+	if primera["horario"] != "09:00" || primera["pedidos_disponibles"] != 0.0 || primera["disponible"] != false {
+		t.Errorf("la mañana apartada debe verse llena: %v", primera)
+	}
+
+	body := strings.Replace(pedidoDosRenglones, `"id_metodo_pago": 1,`, fmt.Sprintf(`"id_metodo_pago": 1, "id_reserva": %d,`, idReserva), 1)
+	id := crearPedido(t, dbc, body)
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM reservas_entrega WHERE id_reserva = ? AND id_pedido = ? AND expira IS NULL", idReserva, id); n != 1 {
+		t.Errorf("la reserva %d no quedó confirmada con el pedido %d", idReserva, id)
+	}
+	var fechaEntrega string
+	if err := dbc.Local.QueryRow("SELECT fecha_entrega FROM pedidos WHERE id_pedido = ?", id).Scan(&fechaEntrega); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(fechaEntrega, manana) || !strings.HasSuffix(fechaEntrega, "09:00:00") {
+		t.Errorf("fecha_entrega = %s, se esperaba la del horario apartado", fechaEntrega)
+	}
+	if status, resp := llamar(t, CreatePedido(repos), http.MethodPost, "/api/v1/pedidos", body); status != http.StatusConflict {
+		t.Errorf("reserva ya usada: status %d: %v", status, resp)
+	}
+
+	// Un pedido sin horario ocupa el primero con lugar: la tarde
+	id = crearPedido(t, dbc, pedidoDosRenglones)
+	if err := dbc.Local.QueryRow("SELECT fecha_entrega FROM pedidos WHERE id_pedido = ?", id).Scan(&fechaEntrega); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(fechaEntrega, "13:00:00") {
+		t.Errorf("fecha_entrega = %s, se esperaba la tarde", fechaEntrega)
+	}
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM reservas_entrega WHERE id_pedido IS NOT NULL"); n != 2 {
+		t.Errorf("reservas confirmadas = %d, se esperaban 2", n)
+	}
+
+	// Los apartados vencidos no se confirman
+	tarde := strings.Replace(strings.Replace(apartar, "09:00", "13:00", 1), `"cantidad": 2`, `"cantidad": 1`, 1)
+	status, resp = llamar(t, ApartarHorarioEntrega(repos), http.MethodPost, "/api/v1/entregas/reservas", tarde)
+	if status != http.StatusOK {
+		t.Fatalf("apartar tarde: status %d: %v", status, resp)
+	}
+	idReserva = int64(resp["data"].(map[string]interface{})["id_reserva"].(float64))
+	if _, err := dbc.Local.Exec("UPDATE reservas_entrega SET expira = ? WHERE id_reserva = ?", reloj.ParaBD(time.Now().Add(-time.Minute)), idReserva); err != nil {
+		t.Fatal(err)
+	}
+	body = strings.Replace(pedidoDosRenglones, `"id_metodo_pago": 1,`, fmt.Sprintf(`"id_metodo_pago": 1, "id_reserva": %d,`, idReserva), 1)
+	if status, resp := llamar(t, CreatePedido(repos), http.MethodPost, "/api/v1/pedidos", body); status != http.StatusConflict {
+		t.Errorf("reserva vencida: status %d: %v", status, resp)
+	}
+	if err := repos.Entregas.Liberar(context.Background(), integracion.IDEmpresa, 2, idReserva); !errors.Is(err, repositorio.ErrNoEncontrado) {
+		t.Errorf("liberar el de otro usuario: %v", err)
+	}
+	if err := repos.Entregas.Liberar(context.Background(), integracion.IDEmpresa, integracion.IDUsuarioCliente, idReserva); err != nil {
+		t.Errorf("liberar: %v", err)
+	}
+	if err := repos.Entregas.Liberar(context.Background(), integracion.IDEmpresa, integracion.IDUsuarioCliente, idReserva); !errors.Is(err, repositorio.ErrNoEncontrado) {
+		t.Errorf("liberar dos veces: %v", err)
+	}
+}
+
+func TestIntegracionFeriados(t *testing.T) {
+	dbc := integracion.Iniciar(t)
+	repos := repositorio.NuevoMySQL(dbc)
+	deAnio := func(t *testing.T, anio, idSucursal int) map[string]string {
+		t.Helper()
+		url := fmt.Sprintf("/api/v1/admin/feriados?anio=%d&id_sucursal=%d", anio, idSucursal)
+		status, resp := llamar(t, GetFeriados(repos), http.MethodGet, url, "")
+		if status != http.StatusOK {
+			t.Fatalf("GET %s: status %d: %v", url, status, resp)
+		}
+		nombres := map[string]string{}
+		for _, f := range resp["data"].([]interface{}) {
+			f := f.(map[string]interface{})
+			nombres[f["fecha"].(string)] = f["nombre"].(string)
+		}
+		return nombres
+	}
+	borrar := func(idEmpresa int, id string) int {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/admin/feriados/"+id, nil)
+		DeleteFeriado(dbc)(rec, mux.SetURLVars(conEmpresa(req, idEmpresa), map[string]string{"id_feriado": id}))
+		return rec.Code
+	}
+
+	status, resp := llamar(t, CreateFeriado(dbc, repos), http.MethodPost, "/api/v1/admin/feriados", `{"fecha": "2026-12-24", "nombre": "Cena", "recurrente": true}`)
+	if status != http.StatusOK {
+		t.Fatalf("alta: status %d: %v", status, resp)
+	}
+	idNochebuena := resp["data"].(map[string]interface{})["id_feriado"].(float64)
+	// El mismo día se reemplaza y conserva el id
+	status, resp = llamar(t, CreateFeriado(dbc, repos), http.MethodPost, "/api/v1/admin/feriados", `{"fecha": "2026-12-24", "nombre": "Nochebuena", "recurrente": true}`)
+	if status != http.StatusOK || resp["data"].(map[string]interface{})["id_feriado"] != idNochebuena {
+		t.Fatalf("reemplazo: status %d: %v", status, resp)
+	}
+	cierre := fmt.Sprintf(`{"fecha": "2026-12-28", "nombre": "Inventario", "id_sucursal": %d}`, integracion.IDSucursalCentro)
+	if status, resp := llamar(t, CreateFeriado(dbc, repos), http.MethodPost, "/api/v1/admin/feriados", cierre); status != http.StatusOK {
+		t.Fatalf("cierre: status %d: %v", status, resp)
+	}
+
+	ics := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART;VALUE=DATE:20261230\r\nDTEND;VALUE=DATE:20270101\r\nSUMMARY:Vacaciones\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nDTSTART;VALUE=DATE:20200815\r\nSUMMARY:Feria\r\nRRULE:FREQ=YEARLY\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	url := fmt.Sprintf("/api/v1/admin/feriados/importar?id_sucursal=%d", integracion.IDSucursalNorte)
+	status, resp = llamar(t, ImportarFeriados(dbc, repos), http.MethodPost, url, ics)
+	if status != http.StatusOK || resp["data"].(map[string]interface{})["importados"] != 3.0 {
+		t.Fatalf("importar: status %d: %v", status, resp)
+	}
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM dias_feriados WHERE id_empresa = ?", integracion.IDEmpresa); n != 5 {
+		t.Errorf("renglones en dias_feriados = %d, se esperaban 5", n)
+	}
+
+	centro := deAnio(t, 2026, integracion.IDSucursalCentro)
+	if centro["2026-02-02"] != "Día de la Constitución" || centro["2026-12-24"] != "Nochebuena" || centro["2026-12-28"] != "Inventario" || centro["2026-12-30"] != "" {
+		t.Errorf("feriados del centro en 2026: %v", centro)
+	}
+	norte := deAnio(t, 2027, integracion.IDSucursalNorte)
+	if norte["2027-12-24"] != "Nochebuena" || norte["2027-08-15"] != "Feria" || norte["2027-03-15"] != "Natalicio de Benito Juárez" || len(norte) != 9 {
+		t.Errorf("feriados del norte en 2027: %v", norte)
+	}
+
+	// Lo guardado sale como .ics y se puede volver a importar
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/admin/feriados/exportar?id_sucursal=%d", integracion.IDSucursalCentro), nil)
+	ExportarFeriados(repos)(rec, conEmpresa(req, integracion.IDEmpresa))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/calendar") {
+		t.Fatalf("exportar: status %d, %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	exportado, err := feriados.LeerICS(rec.Body)
+	if err != nil || len(exportado) != 2 || !exportado[1].Recurrente {
+		t.Errorf("exportado = %+v, %v", exportado, err)
+	}
+
+	status, resp = llamar(t, ImportarFeriados(dbc, repos), http.MethodPost, "/api/v1/admin/feriados/importar", "BEGIN:VEVENT\nDTSTART:mañana\nEND:VEVENT\n")
+	if campos, _ := resp["error"].(map[string]interface{})["fields"].([]interface{}); status != http.StatusBadRequest || len(campos) != 1 ||
+		campos[0].(map[string]interface{})["code"] != "LINEA_INVALIDA" {
+		t.Errorf("ics inválido: status %d: %v", status, resp)
+	}
+	if status, resp := llamar(t, GetFeriados(repos), http.MethodGet, "/api/v1/admin/feriados?anio=dos", ""); status != http.StatusBadRequest {
+		t.Errorf("año inválido: status %d: %v", status, resp)
+	}
+
+	id := fmt.Sprint(int64(idNochebuena))
+	if status := borrar(integracion.IDOtraEmpresa, id); status != http.StatusNotFound {
+		t.Errorf("borrar desde otra empresa: status %d", status)
+	}
+	if status := borrar(integracion.IDEmpresa, id); status != http.StatusOK {
+		t.Errorf("borrar: status %d", status)
+	}
+	if status := borrar(integracion.IDEmpresa, id); status != http.StatusNotFound {
+		t.Errorf("borrar dos veces: status %d", status)
+	}
+}
+
+func TestIntegracionCoberturaSucursal(t *testing.T) {
+	dbc := integracion.Iniciar(t)
+	repos := repositorio.NuevoMySQL(dbc)
+	deSucursal := func(h http.HandlerFunc, id int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			h(w, mux.SetURLVars(r, map[string]string{"id_sucursal": fmt.Sprint(id)}))
+		}
+	}
+	url := func(id int) string { return fmt.Sprintf("/api/v1/admin/sucursales/%d/cobertura", id) }
+
+	status, resp := llamar(t, deSucursal(GetCoberturaSucursal(repos), integracion.IDSucursalCentro), http.MethodGet, url(integracion.IDSucursalCentro), "")
+	if status != http.StatusOK {
+		t.Fatalf("GET centro: status %d: %v", status, resp)
+	}
+	centro := resp["data"].(map[string]interface{})
+	anillo := centro["geometry"].(map[string]interface{})["coordinates"].([]interface{})[0].([]interface{})
+	if len(anillo) != 5 || fmt.Sprint(anillo[0]) != "[-89.64 20.95]" || fmt.Sprint(anillo[4]) != fmt.Sprint(anillo[0]) {
+		t.Errorf("anillo del centro = %v", anillo)
+	}
+	if p := centro["properties"].(map[string]interface{}); p["tipo"] != "poligono" || p["sucursal"] != "Centro" {
+		t.Errorf("properties del centro = %v", p)
+	}
+	status, resp = llamar(t, deSucursal(GetCoberturaSucursal(repos), integracion.IDSucursalNorte), http.MethodGet, url(integracion.IDSucursalNorte), "")
+	if p := resp["data"].(map[string]interface{})["properties"].(map[string]interface{}); status != http.StatusOK || p["tipo"] != "circulo" || p["radio_km"] != 3.0 {
+		t.Errorf("GET norte: status %d: %v", status, resp)
+	}
+	// La sucursal de otra empresa no se ve
+	if status, _ := llamar(t, deSucursal(GetCoberturaSucursal(repos), integracion.IDSucursalOtra), http.MethodGet, url(integracion.IDSucursalOtra), ""); status != http.StatusNotFound {
+		t.Errorf("GET de otra empresa: status %d", status)
+	}
+
+	// Un rectángulo lejos del centro deja a la tienda fuera de toda
+	// cobertura; Norte queda más cerca
+	lejos := `{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[-89.70, 20.90], [-89.68, 20.90], [-89.68, 20.92], [-89.70, 20.92], [-89.70, 20.90]]]}, "properties": {"tipo": "rectangulo"}}`
+	previa := deSucursal(PreviewCoberturaSucursal(repos), integracion.IDSucursalCentro)
+	status, resp = llamar(t, previa, http.MethodPost, url(integracion.IDSucursalCentro)+"/vista-previa", lejos)
+	if status != http.StatusOK {
+		t.Fatalf("vista previa: status %d: %v", status, resp)
+	}
+	cambios := resp["data"].(map[string]interface{})["cambios"].([]interface{})
+	if len(cambios) != 1 {
+		t.Fatalf("cambios = %v", cambios)
+	}
+	if c := cambios[0].(map[string]interface{}); c["id_tienda"] != float64(integracion.IDTiendaCliente) || c["id_sucursal_actual"] != float64(integracion.IDSucursalCentro) ||
+		c["id_sucursal_nueva"] != float64(integracion.IDSucursalNorte) || c["en_cobertura"] != false {
+		t.Errorf("cambio = %v", c)
+	}
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM adm_sucursales_ptos WHERE idsucursal = ?", integracion.IDSucursalCentro); n != 4 {
+		t.Errorf("la vista previa guardó: %d puntos", n)
+	}
+
+	abierto := `{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[-89.70, 20.90], [-89.68, 20.90], [-89.68, 20.92]]]}}`
+	status, resp = llamar(t, deSucursal(UpdateCoberturaSucursal(repos), integracion.IDSucursalCentro), http.MethodPut, url(integracion.IDSucursalCentro), abierto)
+	if status != http.StatusBadRequest || !strings.Contains(fmt.Sprint(resp), "NUMERO_DE_PUNTOS") {
+		t.Errorf("PUT abierto: status %d: %v", status, resp)
+	}
+
+	// Carga las geocercas en memoria antes del cambio
+	if asignada, err := repos.Sucursales.PorUbicacion(context.Background(), integracion.IDEmpresa, 20.97, -89.62); err != nil || asignada.IDSucursal != integracion.IDSucursalCentro {
+		t.Fatalf("PorUbicacion antes del PUT = %+v, %v", asignada, err)
+	}
+	status, resp = llamar(t, deSucursal(UpdateCoberturaSucursal(repos), integracion.IDSucursalCentro), http.MethodPut, url(integracion.IDSucursalCentro), lejos)
+	if status != http.StatusOK || len(resp["data"].(map[string]interface{})["cambios"].([]interface{})) != 1 {
+		t.Fatalf("PUT: status %d: %v", status, resp)
+	}
+	var tipo string
+	if err := dbc.Local.QueryRow("SELECT tipo_objeto FROM adm_sucursales WHERE idsucursal = ?", integracion.IDSucursalCentro).Scan(&tipo); err != nil || tipo != "R" {
+		t.Errorf("tipo_objeto = %q, %v", tipo, err)
+	}
+	// Las esquinas se guardan como (latitud, longitud) y la asignación del
+	// registro ya usa la nueva geocerca, sin esperar el TTL
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM adm_sucursales_ptos WHERE idsucursal = ? AND ST_X(punto) = 20.90 AND ST_Y(punto) = -89.70", integracion.IDSucursalCentro); n != 1 {
+		t.Errorf("esquina suroeste guardada %d veces", n)
+	}
+	asignada, err := repos.Sucursales.PorUbicacion(context.Background(), integracion.IDEmpresa, 20.91, -89.69)
+	if err != nil || asignada.IDSucursal != integracion.IDSucursalCentro {
+		t.Errorf("PorUbicacion dentro del rectángulo = %+v, %v", asignada, err)
+	}
+	if asignada, err := repos.Sucursales.PorUbicacion(context.Background(), integracion.IDEmpresa, 20.97, -89.62); err != nil || asignada.IDSucursal != integracion.IDSucursalNorte {
+		t.Errorf("PorUbicacion de la tienda después del PUT = %+v, %v", asignada, err)
+	}
+
+	status, resp = llamar(t, deSucursal(GetCoberturaSucursal(repos), integracion.IDSucursalCentro), http.MethodGet, url(integracion.IDSucursalCentro), "")
+	if p := resp["data"].(map[string]interface{})["properties"].(map[string]interface{}); status != http.StatusOK || p["tipo"] != "rectangulo" {
+		t.Errorf("GET después del PUT: status %d: %v", status, resp)
+	}
+	// La tienda no se reasigna sola
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM tiendas WHERE id_tienda = ? AND idsucursal = ?", integracion.IDTiendaCliente, integracion.IDSucursalCentro); n != 1 {
+		t.Error("el PUT cambió la sucursal de la tienda")
+	}
+}
+
+// Asignar sucursal con ST_Contains por sucursal contra las geocercas en
+// memoria: go test ./rutas -run ^$ -bench AsignarSucursal
+func TestIntegracionCobertura(t *testing.T) {
+	dbc := integracion.Iniciar(t)
+	repos := repositorio.NuevoMySQL(dbc)
+	h := GetCobertura(repos)
+	usuarios := contar(t, dbc.Local, "SELECT COUNT(*) FROM usuarios")
+
+	status, resp := llamar(t, h, http.MethodGet, "/api/v1/cobertura?lat=20.97&lng=-89.62", "")
+	if status != http.StatusOK {
+		t.Fatalf("dentro del centro: status %d: %v", status, resp)
+	}
+	data := resp["data"].(map[string]interface{})
+	sucursal := data["sucursal"].(map[string]interface{})
+	if data["cubierta"] != true || sucursal["id_sucursal"] != float64(integracion.IDSucursalCentro) || sucursal["nombre"] != "Centro" {
+		t.Errorf("dentro del centro = %v", data)
+	}
+	if d := data["distancia_km"].(float64); d > 0.1 {
+		t.Errorf("distancia al centro = %v", d)
+	}
+	fechas := data["proximas_fechas"].([]interface{})
+	if len(fechas) == 0 || len(fechas) > proximasFechas {
+		t.Fatalf("proximas_fechas = %v", fechas)
+	}
+	if f := fechas[0].(map[string]interface{}); f["disponible"] != true || f["fecha"] == "" {
+		t.Errorf("primera fecha = %v", f)
+	}
+
+	// Mérida poniente queda fuera: se informa la más cercana, sin fechas
+	status, resp = llamar(t, h, http.MethodGet, "/api/v1/cobertura?lat=20.97&lng=-89.70", "")
+	data = resp["data"].(map[string]interface{})
+	if status != http.StatusOK || data["cubierta"] != false || data["sucursal"].(map[string]interface{})["id_sucursal"] != float64(integracion.IDSucursalCentro) {
+		t.Fatalf("fuera de cobertura: status %d: %v", status, resp)
+	}
+	if d := data["distancia_borde_km"].(float64); math.Abs(d-6.24) > 0.05 {
+		t.Errorf("distancia a la orilla = %v", d)
+	}
+	if fechas := data["proximas_fechas"].([]interface{}); len(fechas) != 0 {
+		t.Errorf("fuera de cobertura con fechas: %v", fechas)
+	}
+
+	status, resp = llamar(t, h, http.MethodGet, "/api/v1/cobertura?lat=120&lng=x", "")
+	if campos, _ := resp["error"].(map[string]interface{})["fields"].([]interface{}); status != http.StatusBadRequest || len(campos) != 2 {
+		t.Errorf("coordenadas inválidas: status %d: %v", status, resp)
+	}
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM usuarios"); n != usuarios {
+		t.Errorf("la consulta creó usuarios: %d, antes %d", n, usuarios)
+	}
+}
+
+func TestIntegracionReasignacionTiendas(t *testing.T) {
+	dbc := integracion.Iniciar(t)
+	repos := repositorio.NuevoMySQL(dbc)
+	conVars := func(h http.HandlerFunc, vars map[string]string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			h(w, mux.SetURLVars(r, vars))
+		}
+	}
+	deSucursal := func(id int) map[string]string { return map[string]string{"id_sucursal": fmt.Sprint(id)} }
+	deReasignacion := func(id float64) map[string]string { return map[string]string{"id_reasignacion": fmt.Sprint(id)} }
+
+	// Con la semilla cada tienda está en su sucursal
+	status, resp := llamar(t, CreateReasignacion(repos), http.MethodPost, "/api/v1/admin/reasignaciones", "")
+	if data := resp["data"].(map[string]interface{}); status != http.StatusOK || data["id_reasignacion"] != 0.0 || len(data["tiendas"].([]interface{})) != 0 {
+		t.Fatalf("sin cambios: status %d: %v", status, resp)
+	}
+
+	// Norte pasa a cubrir la tienda, pero el centro del Centro sigue más cerca
+	norte := `{"type": "Feature", "geometry": {"type": "Point", "coordinates": [-89.62, 20.98]}, "properties": {"radio_km": 3}}`
+	status, resp = llamar(t, conVars(UpdateCoberturaSucursal(repos), deSucursal(integracion.IDSucursalNorte)), http.MethodPut, "/api/v1/admin/sucursales/2/cobertura", norte)
+	if re := resp["data"].(map[string]interface{})["reasignacion"].(map[string]interface{}); status != http.StatusOK || re["id_reasignacion"] != 0.0 {
+		t.Fatalf("PUT norte: status %d: %v", status, resp)
+	}
+	// Al mover el Centro, la tienda le toca a Norte y queda un reporte pendiente
+	lejos := `{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[-89.70, 20.90], [-89.68, 20.90], [-89.68, 20.92], [-89.70, 20.92], [-89.70, 20.90]]]}, "properties": {"tipo": "rectangulo"}}`
+	status, resp = llamar(t, conVars(UpdateCoberturaSucursal(repos), deSucursal(integracion.IDSucursalCentro)), http.MethodPut, "/api/v1/admin/sucursales/1/cobertura", lejos)
+	if status != http.StatusOK {
+		t.Fatalf("PUT centro: status %d: %v", status, resp)
+	}
+	re := resp["data"].(map[string]interface{})["reasignacion"].(map[string]interface{})
+	id := re["id_reasignacion"].(float64)
+	if id == 0 || re["estatus"] != "pendiente" || re["origen"] != "cobertura" || re["num_tiendas"] != 1.0 {
+		t.Fatalf("reasignación = %v", re)
+	}
+	tienda := re["tiendas"].([]interface{})[0].(map[string]interface{})
+	if tienda["id_tienda"] != float64(integracion.IDTiendaCliente) || tienda["id_sucursal_anterior"] != float64(integracion.IDSucursalCentro) ||
+		tienda["id_sucursal_nueva"] != float64(integracion.IDSucursalNorte) || tienda["sucursal_nueva"] != "Norte" || tienda["en_cobertura"] != true || tienda["aplicada"] != false {
+		t.Errorf("tienda del reporte = %v", tienda)
+	}
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM tiendas WHERE id_tienda = ? AND idsucursal = ?", integracion.IDTiendaCliente, integracion.IDSucursalCentro); n != 1 {
+		t.Error("la tienda se movió antes de aprobar")
+	}
+
+	// Evaluar otra vez no duplica el reporte
+	status, resp = llamar(t, CreateReasignacion(repos), http.MethodPost, "/api/v1/admin/reasignaciones", "")
+	if status != http.StatusOK || resp["data"].(map[string]interface{})["id_reasignacion"] != id {
+		t.Errorf("segunda evaluación: status %d: %v", status, resp)
+	}
+	status, resp = llamar(t, GetReasignaciones(repos), http.MethodGet, "/api/v1/admin/reasignaciones", "")
+	lista := resp["data"].([]interface{})
+	if status != http.StatusOK || len(lista) != 1 || lista[0].(map[string]interface{})["tiendas"] != nil {
+		t.Errorf("lista: status %d: %v", status, resp)
+	}
+
+	aprobar := conVars(AprobarReasignacion(repos), deReasignacion(id))
+	status, resp = llamar(t, aprobar, http.MethodPost, "/api/v1/admin/reasignaciones/1/aprobar", `{"id_tiendas": [99]}`)
+	if status != http.StatusBadRequest || !strings.Contains(fmt.Sprint(resp), "id_tiendas[0]") {
+		t.Errorf("tienda fuera del reporte: status %d: %v", status, resp)
+	}
+	status, resp = llamar(t, aprobar, http.MethodPost, "/api/v1/admin/reasignaciones/1/aprobar", "")
+	if movs := resp["data"].([]interface{}); status != http.StatusOK || len(movs) != 1 || movs[0].(map[string]interface{})["id_reasignacion"] != id {
+		t.Fatalf("aprobar: status %d: %v", status, resp)
+	}
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM tiendas WHERE id_tienda = ? AND idsucursal = ? AND nombre_sucursal = 'Norte'", integracion.IDTiendaCliente, integracion.IDSucursalNorte); n != 1 {
+		t.Error("la tienda no quedó en Norte")
+	}
+	status, resp = llamar(t, aprobar, http.MethodPost, "/api/v1/admin/reasignaciones/1/aprobar", "")
+	if status != http.StatusConflict || !strings.Contains(fmt.Sprint(resp), "REASIGNACION_RESUELTA") {
+		t.Errorf("aprobar dos veces: status %d: %v", status, resp)
+	}
+	status, resp = llamar(t, conVars(GetReasignacion(repos), deReasignacion(id)), http.MethodGet, "/api/v1/admin/reasignaciones/1", "")
+	if data := resp["data"].(map[string]interface{}); status != http.StatusOK || data["estatus"] != "aplicada" || data["resuelta"] == nil ||
+		data["tiendas"].([]interface{})[0].(map[string]interface{})["aplicada"] != true {
+		t.Errorf("reporte aplicado: status %d: %v", status, resp)
+	}
+
+	status, resp = llamar(t, conVars(GetMovimientosTienda(repos), map[string]string{"id_tienda": fmt.Sprint(integracion.IDTiendaCliente)}), http.MethodGet, "/api/v1/admin/tiendas/1/movimientos", "")
+	movs := resp["data"].([]interface{})
+	if status != http.StatusOK || len(movs) != 1 {
+		t.Fatalf("movimientos: status %d: %v", status, resp)
+	}
+	if m := movs[0].(map[string]interface{}); m["sucursal_anterior"] != "Centro" || m["sucursal_nueva"] != "Norte" || m["id_admin"] != nil {
+		t.Errorf("movimiento = %v", m)
+	}
+
+	// Ya en Norte no hay nada que reasignar
+	status, resp = llamar(t, CreateReasignacion(repos), http.MethodPost, "/api/v1/admin/reasignaciones", "")
+	if status != http.StatusOK || resp["data"].(map[string]interface{})["id_reasignacion"] != 0.0 {
+		t.Errorf("después de aplicar: status %d: %v", status, resp)
+	}
+	status, resp = llamar(t, conVars(DescartarReasignacion(repos), deReasignacion(999)), http.MethodPost, "/api/v1/admin/reasignaciones/999/descartar", "")
+	if status != http.StatusNotFound || !strings.Contains(fmt.Sprint(resp), "REASIGNACION_NO_ENCONTRADA") {
+		t.Errorf("descartar inexistente: status %d: %v", status, resp)
+	}
+}
+
+func TestIntegracionDireccionesTienda(t *testing.T) {
+	dbc := integracion.Iniciar(t)
+	repos := repositorio.NuevoMySQL(dbc)
+	// como corre el handler con la sesión de un usuario ("C") o admin ("A")
+	// y las variables de la ruta
+	como := func(h http.HandlerFunc, idUsuario int, tipo string, vars map[string]string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), middlewares.ContextUserIDKey, idUsuario)
+			ctx = context.WithValue(ctx, middlewares.ContextTipoKey, tipo)
+			h(w, mux.SetURLVars(r.WithContext(ctx), vars))
+		}
+	}
+	tienda := map[string]string{"id_tienda": fmt.Sprint(integracion.IDTiendaCliente)}
+	deDireccion := func(id float64) map[string]string {
+		return map[string]string{"id_tienda": fmt.Sprint(integracion.IDTiendaCliente), "id_direccion": fmt.Sprint(id)}
+	}
+	cliente := integracion.IDUsuarioCliente
+	url := "/api/v1/tiendas/1/direcciones"
+	listar := func() []interface{} {
+		t.Helper()
+		status, resp := llamar(t, como(GetDireccionesTienda(repos), cliente, "C", tienda), http.MethodGet, url, "")
+		if status != http.StatusOK {
+			t.Fatalf("GET: status %d: %v", status, resp)
+		}
+		return resp["data"].([]interface{})
+	}
+
+	// La semilla trae la ubicación de la tienda como predeterminada
+	lista := listar()
+	if len(lista) != 1 {
+		t.Fatalf("direcciones = %v", lista)
+	}
+	principal := lista[0].(map[string]interface{})
+	cob := principal["cobertura"].(map[string]interface{})
+	if principal["id_direccion"] != float64(integracion.IDDireccion) || principal["predeterminada"] != true ||
+		cob["cubierta"] != true || cob["sucursal"].(map[string]interface{})["id_sucursal"] != float64(integracion.IDSucursalCentro) {
+		t.Errorf("dirección de la semilla = %v", principal)
+	}
+	// Otro cliente no ve la tienda; un administrador sí
+	if status, resp := llamar(t, como(GetDireccionesTienda(repos), 2, "C", tienda), http.MethodGet, url, ""); status != http.StatusNotFound ||
+		!strings.Contains(fmt.Sprint(resp), "TIENDA_NO_ENCONTRADA") {
+		t.Errorf("otro cliente: status %d: %v", status, resp)
+	}
+	if status, resp := llamar(t, como(GetDireccionesTienda(repos), integracion.IDAdmin, "A", tienda), http.MethodGet, url, ""); status != http.StatusOK {
+		t.Errorf("admin: status %d: %v", status, resp)
+	}
+
+	status, resp := llamar(t, como(CreateDireccionTienda(repos), cliente, "C", tienda), http.MethodPost, url, `{"alias": "Bodega", "direccion": "Calle 1"}`)
+	if status != http.StatusBadRequest || !strings.Contains(fmt.Sprint(resp), "latitud") || !strings.Contains(fmt.Sprint(resp), "longitud") {
+		t.Errorf("sin coordenadas: status %d: %v", status, resp)
+	}
+	// Una dirección en el círculo de Norte, marcada como predeterminada
+	status, resp = llamar(t, como(CreateDireccionTienda(repos), cliente, "C", tienda), http.MethodPost, url,
+		`{"alias": "Bodega", "direccion": "Calle 1", "codigo_postal": "97100", "referencias": "Portón verde", "latitud": 21.05, "longitud": -89.62, "predeterminada": true}`)
+	if status != http.StatusOK {
+		t.Fatalf("POST bodega: status %d: %v", status, resp)
+	}
+	bodega := resp["data"].(map[string]interface{})
+	idBodega := bodega["id_direccion"].(float64)
+	if cob := bodega["cobertura"].(map[string]interface{}); bodega["predeterminada"] != true || cob["cubierta"] != true ||
+		cob["sucursal"].(map[string]interface{})["id_sucursal"] != float64(integracion.IDSucursalNorte) {
+		t.Errorf("bodega = %v", bodega)
+	}
+	// Fuera de cobertura se guarda y lo avisa
+	status, resp = llamar(t, como(CreateDireccionTienda(repos), cliente, "C", tienda), http.MethodPost, url,
+		`{"alias": "Rancho", "direccion": "Km 20", "latitud": 20.50, "longitud": -89.00}`)
+	if status != http.StatusOK || resp["data"].(map[string]interface{})["cobertura"].(map[string]interface{})["cubierta"] != false ||
+		!strings.Contains(resp["message"].(string), "fuera de cobertura") {
+		t.Fatalf("POST rancho: status %d: %v", status, resp)
+	}
+	idRancho := resp["data"].(map[string]interface{})["id_direccion"].(float64)
+
+	lista = listar()
+	if len(lista) != 3 || lista[0].(map[string]interface{})["id_direccion"] != idBodega || lista[1].(map[string]interface{})["predeterminada"] != false {
+		t.Fatalf("después de agregar = %v", lista)
+	}
+	// Guardarla con predeterminada en false no le quita lo predeterminada
+	status, resp = llamar(t, como(UpdateDireccionTienda(repos), cliente, "C", deDireccion(idBodega)), http.MethodPut, url+"/2",
+		`{"alias": "Bodega norte", "direccion": "Calle 1", "codigo_postal": "97100", "latitud": 21.05, "longitud": -89.62}`)
+	if data := resp["data"].(map[string]interface{}); status != http.StatusOK || data["alias"] != "Bodega norte" || data["predeterminada"] != true {
+		t.Errorf("PUT bodega: status %d: %v", status, resp)
+	}
+	status, resp = llamar(t, como(UpdateDireccionTienda(repos), cliente, "C", deDireccion(99)), http.MethodPut, url+"/99",
+		`{"alias": "X", "direccion": "X", "latitud": 21.05, "longitud": -89.62}`)
+	if status != http.StatusNotFound || !strings.Contains(fmt.Sprint(resp), "DIRECCION_NO_ENCONTRADA") {
+		t.Errorf("PUT inexistente: status %d: %v", status, resp)
+	}
+
+	// El pedido con id_direccion va a la sucursal que la cubre, aunque traiga otra
+	pedido := strings.Replace(pedidoDosRenglones, `"id_sucursal": 1,`, fmt.Sprintf(`"id_sucursal": 1, "id_direccion": %v,`, idBodega), 1)
+	// pero otro cliente no pide a la tienda ni a su libreta
+	status, resp = llamar(t, como(CreatePedido(repos), 2, "C", nil), http.MethodPost, "/api/v1/pedidos", pedido)
+	if status != http.StatusNotFound || resp["error"].(map[string]interface{})["code"] != string(errores.TiendaNoEncontrada) {
+		t.Errorf("pedido a la tienda de otro cliente: status %d: %v", status, resp)
+	}
+	status, resp = llamar(t, como(CreatePedido(repos), cliente, "C", nil), http.MethodPost, "/api/v1/pedidos", pedido)
+	if status != http.StatusOK {
+		t.Fatalf("pedido a la bodega: status %d: %v", status, resp)
+	}
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM pedidos WHERE id_direccion = ? AND id_sucursal = ? AND direccion_entrega = 'Calle 1' AND cp_entrega = '97100' AND latitud_entrega = 21.05",
+		idBodega, integracion.IDSucursalNorte); n != 1 {
+		t.Error("el pedido no quedó con la dirección y la sucursal de la libreta")
+	}
+	for _, c := range []struct {
+		id     float64
+		status int
+		codigo errores.Codigo
+	}{
+		{idRancho, http.StatusBadRequest, errores.UbicacionSinCobertura},
+		{99, http.StatusNotFound, errores.DireccionNoEncontrada},
+	} {
+		pedido := strings.Replace(pedidoDosRenglones, `"id_sucursal": 1,`, fmt.Sprintf(`"id_direccion": %v,`, c.id), 1)
+		status, resp := llamar(t, CreatePedido(repos), http.MethodPost, "/api/v1/pedidos", pedido)
+		if status != c.status || resp["error"].(map[string]interface{})["code"] != string(c.codigo) {
+			t.Errorf("pedido a la dirección %v: status %d: %v", c.id, status, resp)
+		}
+	}
+
+	// Al quitar la predeterminada pasa a serlo la más vieja
+	if status, resp := llamar(t, como(DeleteDireccionTienda(repos), cliente, "C", deDireccion(idBodega)), http.MethodDelete, url+"/2", ""); status != http.StatusOK {
+		t.Fatalf("DELETE: status %d: %v", status, resp)
+	}
+	lista = listar()
+	if len(lista) != 2 || lista[0].(map[string]interface{})["id_direccion"] != float64(integracion.IDDireccion) || lista[0].(map[string]interface{})["predeterminada"] != true {
+		t.Errorf("después de eliminar = %v", lista)
+	}
+	if status, _ := llamar(t, como(DeleteDireccionTienda(repos), cliente, "C", deDireccion(idBodega)), http.MethodDelete, url+"/2", ""); status != http.StatusNotFound {
+		t.Errorf("DELETE dos veces: status %d", status)
+	}
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM pedidos WHERE id_direccion = ?", idBodega); n != 1 {
+		t.Error("el pedido perdió su dirección")
+	}
+}
+
+func TestIntegracionTiendasAdicionales(t *testing.T) {
+	dbc := integracion.Iniciar(t)
+	repos := repositorio.NuevoMySQL(dbc)
+	// como corre el handler con la sesión de un usuario ("C") o admin ("A"),
+	// la tienda elegida en el token o en X-Tienda y las variables de la ruta
+	como := func(h http.HandlerFunc, idUsuario int, tipo string, idTienda int, vars map[string]string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), middlewares.ContextUserIDKey, idUsuario)
+			ctx = context.WithValue(ctx, middlewares.ContextTipoKey, tipo)
+			ctx = context.WithValue(ctx, middlewares.ContextTiendaKey, idTienda)
+			h(w, mux.SetURLVars(r.WithContext(ctx), vars))
+		}
+	}
+	claimTienda := func(token string) interface{} {
+		t.Helper()
+		claims := jwt.MapClaims{}
+		if _, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) { return jwtKey, nil }); err != nil {
+			t.Fatal(err)
+		}
+		return claims["tienda"]
+	}
+	cliente := integracion.IDUsuarioCliente
+	remotosAntes := contar(t, dbc.Remote, "SELECT COUNT(*) FROM crm_clientes")
+
+	// La tienda nueva cae en el círculo de Norte y es otro cliente en el ERP
+	body := `{"nombre_tienda": "Abarrotes Norte", "rfc": "AANO800101AB1", "direccion": "Calle 1", "codigo_postal": "97100", "latitud": 21.05, "longitud": -89.62}`
+	status, resp := llamar(t, como(CreateTienda(repos), cliente, "C", 0, nil), http.MethodPost, "/api/v1/tiendas", body)
+	if status != http.StatusOK {
+		t.Fatalf("POST: status %d: %v", status, resp)
+	}
+	nueva := resp["data"].(map[string]interface{})
+	idNueva := int(nueva["id_tienda"].(float64))
+	idRemoto := nueva["id_remoto"].(float64)
+	if nueva["idsucursal"] != float64(integracion.IDSucursalNorte) || idRemoto == 0 || idRemoto == float64(integracion.IDClienteRemoto) {
+		t.Errorf("tienda nueva = %v", nueva)
+	}
+	if n := contar(t, dbc.Remote, "SELECT COUNT(*) FROM crm_clientes"); n != remotosAntes+1 {
+		t.Errorf("crm_clientes = %d, se esperaba %d", n, remotosAntes+1)
+	}
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM direcciones_tienda WHERE id_tienda = ? AND predeterminada AND latitud = 21.05", idNueva); n != 1 {
+		t.Error("la tienda nueva no tiene su dirección predeterminada")
+	}
+	// Un administrador tiene que decir a qué cliente
+	if status, resp := llamar(t, como(CreateTienda(repos), integracion.IDAdmin, "A", 0, nil), http.MethodPost, "/api/v1/tiendas", body); status != http.StatusBadRequest ||
+		!strings.Contains(fmt.Sprint(resp), "id_usuario") {
+		t.Errorf("admin sin id_usuario: status %d: %v", status, resp)
+	}
+
+	// El login empieza con la primera tienda y trae las dos
+	status, resp = llamar(t, LoginUsuario(dbc, repos), http.MethodPost, "/api/login",
+		fmt.Sprintf(`{"correo": %q, "clave": %q}`, integracion.CorreoCliente, integracion.ClaveUsuarios))
+	if status != http.StatusOK {
+		t.Fatalf("login: status %d: %v", status, resp)
+	}
+	sesion := resp["data"].(map[string]interface{})
+	if tiendas := sesion["tiendas"].([]interface{}); len(tiendas) != 2 ||
+		sesion["tienda"].(map[string]interface{})["id_tienda"] != float64(integracion.IDTiendaCliente) ||
+		sesion["tienda"].(map[string]interface{})["id_remoto"] != float64(integracion.IDClienteRemoto) {
+		t.Errorf("login = %v", sesion)
+	}
+	if c := claimTienda(sesion["access_token"].(string)); c != float64(integracion.IDTiendaCliente) {
+		t.Errorf("claim tienda del login = %v", c)
+	}
+
+	// Cambiar la tienda activa da otro token y se guarda
+	activar := map[string]string{"id_tienda": fmt.Sprint(idNueva)}
+	status, resp = llamar(t, como(ActivarTienda(repos), cliente, "C", 0, activar), http.MethodPost, "/api/v1/tiendas/2/activar", "")
+	if status != http.StatusOK {
+		t.Fatalf("activar: status %d: %v", status, resp)
+	}
+	if c := claimTienda(resp["data"].(map[string]interface{})["access_token"].(string)); c != float64(idNueva) {
+		t.Errorf("claim tienda al activar = %v", c)
+	}
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM usuarios WHERE id_usuario = ? AND id_tienda_activa = ?", cliente, idNueva); n != 1 {
+		t.Error("no se guardó la tienda activa")
+	}
+	status, resp = llamar(t, GetTiendaByUsuario(dbc), http.MethodGet, fmt.Sprintf("/api/v1/tiendas/por_usuario?usuario=%d", cliente), "")
+	if status != http.StatusOK || resp["data"].(map[string]interface{})["id_tienda"] != float64(idNueva) {
+		t.Errorf("por_usuario después de activar: status %d: %v", status, resp)
+	}
+	if status, _ := llamar(t, como(ActivarTienda(repos), 2, "C", 0, activar), http.MethodPost, "/api/v1/tiendas/2/activar", ""); status != http.StatusNotFound {
+		t.Errorf("activar la tienda de otro: status %d", status)
+	}
+	if status, _ := llamar(t, como(ActivarTienda(repos), integracion.IDAdmin, "A", 0, activar), http.MethodPost, "/api/v1/tiendas/2/activar", ""); status != http.StatusForbidden {
+		t.Errorf("activar como admin: status %d", status)
+	}
+
+	// Sin id_tienda el pedido es de la tienda activa, o de la de X-Tienda
+	sinTienda := strings.Replace(pedidoDosRenglones, `"id_tienda": 1, `, "", 1)
+	status, resp = llamar(t, como(CreatePedido(repos), cliente, "C", 0, nil), http.MethodPost, "/api/v1/pedidos", sinTienda)
+	if status != http.StatusOK {
+		t.Fatalf("pedido sin id_tienda: status %d: %v", status, resp)
+	}
+	idPedido := int64(resp["data"].(map[string]interface{})["id_pedido"].(float64))
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM pedidos WHERE id_pedido = ? AND id_tienda = ?", idPedido, idNueva); n != 1 {
+		t.Error("el pedido no quedó en la tienda activa")
+	}
+	status, resp = llamar(t, como(CreatePedido(repos), cliente, "C", integracion.IDTiendaCliente, nil), http.MethodPost, "/api/v1/pedidos", sinTienda)
+	if status != http.StatusOK {
+		t.Fatalf("pedido con X-Tienda: status %d: %v", status, resp)
+	}
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM pedidos WHERE id_pedido = ? AND id_tienda = ?", resp["data"].(map[string]interface{})["id_pedido"], integracion.IDTiendaCliente); n != 1 {
+		t.Error("el pedido no quedó en la tienda de X-Tienda")
+	}
+	if status, _ := llamar(t, como(CreatePedido(repos), 2, "C", idNueva, nil), http.MethodPost, "/api/v1/pedidos", sinTienda); status != http.StatusNotFound {
+		t.Errorf("X-Tienda de otro cliente: status %d", status)
+	}
+
+	// En el ERP el pedido va a nombre del cliente de su tienda
+	sinc, err := sincronizarPedidoCore(context.Background(), dbc, SincronizacionRequest{IDPedido: idPedido, IDSucursal: 1}, "prueba")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := contar(t, dbc.Remote, "SELECT COUNT(*) FROM crm_pedidos WHERE id_pedido = ? AND id_cliente = ?", sinc.IDAutoincremental, idRemoto); n != 1 {
+		t.Error("crm_pedidos no quedó con el cliente de la tienda")
+	}
+
+	// Al moverla al centro cambia de sucursal y queda en sus movimientos
+	editar := map[string]string{"id_tienda": fmt.Sprint(idNueva)}
+	movida := strings.Replace(body, `"latitud": 21.05`, `"latitud": 20.97`, 1)
+	status, resp = llamar(t, como(UpdateTienda(repos), cliente, "C", 0, editar), http.MethodPut, "/api/v1/tiendas/2", movida)
+	if status != http.StatusOK || resp["data"].(map[string]interface{})["idsucursal"] != float64(integracion.IDSucursalCentro) ||
+		!strings.Contains(resp["message"].(string), "sucursal") {
+		t.Fatalf("PUT: status %d: %v", status, resp)
+	}
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM tiendas_movimientos WHERE id_tienda = ? AND idsucursal_anterior = ? AND idsucursal_nueva = ? AND id_admin IS NULL",
+		idNueva, integracion.IDSucursalNorte, integracion.IDSucursalCentro); n != 1 {
+		t.Error("no quedó el movimiento de sucursal")
+	}
+	// Sin cambio de sucursal no hay movimiento
+	if status, resp := llamar(t, como(UpdateTienda(repos), cliente, "C", 0, editar), http.MethodPut, "/api/v1/tiendas/2", movida); status != http.StatusOK || resp["message"] != "Tienda actualizada" {
+		t.Errorf("PUT igual: status %d: %v", status, resp)
+	}
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM tiendas_movimientos WHERE id_tienda = ?", idNueva); n != 1 {
+		t.Errorf("movimientos = %d", n)
+	}
+	if status, _ := llamar(t, como(UpdateTienda(repos), 2, "C", 0, editar), http.MethodPut, "/api/v1/tiendas/2", movida); status != http.StatusNotFound {
+		t.Errorf("PUT de otro cliente: status %d", status)
+	}
+
+	// Otro cliente no la elimina aunque mande el id_usuario, ni un admin desde otra empresa
+	eliminar := fmt.Sprintf("/api/v1/tiendas/eliminar?id_tienda=%d&id_usuario=%d", idNueva, cliente)
+	if status, resp := llamar(t, como(EliminarTienda(dbc), 2, "C", 0, nil), http.MethodDelete, eliminar, ""); status == http.StatusOK {
+		t.Errorf("eliminar la tienda de otro: %v", resp)
+	}
+	if status, resp := llamarEmpresa(t, integracion.IDOtraEmpresa, como(EliminarTienda(dbc), integracion.IDAdmin, "A", 0, nil), http.MethodDelete, eliminar, ""); status == http.StatusOK {
+		t.Errorf("eliminar desde otra empresa: %v", resp)
+	}
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM tiendas WHERE id_tienda = ? AND estatus = 'activo'", idNueva); n != 1 {
+		t.Fatal("se eliminó la tienda")
+	}
+	status, resp = llamar(t, como(EliminarTienda(dbc), cliente, "C", 0, nil), http.MethodDelete, fmt.Sprintf("/api/v1/tiendas/eliminar?id_tienda=%d", idNueva), "")
+	if status != http.StatusOK {
+		t.Fatalf("eliminar: status %d: %v", status, resp)
+	}
+	if n := contar(t, dbc.Local, "SELECT COUNT(*) FROM usuarios WHERE id_usuario = ? AND id_tienda_activa IS NULL", cliente); n != 1 {
+		t.Error("la tienda eliminada sigue como la activa")
+	}
+}
+
+// El perfil, la tienda y la edición de un usuario son de la empresa de la
+// petición, y un cliente sólo llega a los suyos aunque mande otro id_usuario.
+func TestIntegracionPerfilDeLaSesion(t *testing.T) {
+	dbc := integracion.Iniciar(t)
+	const otro = 2 // cliente de la misma empresa, sin tiendas
+	nombre := func(id int) string {
+		t.Helper()
+		var n string
+		if err := dbc.Local.QueryRow("SELECT nombre_completo FROM usuarios WHERE id_usuario = ?", id).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	perfil := fmt.Sprintf("/api/v1/perfil?id_usuario=%d", integracion.IDUsuarioCliente)
+	status, resp := llamar(t, conSesion(GetPerfilUsuario(dbc), otro, "C"), http.MethodGet, perfil, "")
+	if status != http.StatusOK || resp["data"].(map[string]interface{})["usuario"].(map[string]interface{})["correo"] != integracion.CorreoSuspendido {
+		t.Errorf("perfil pedido por otro cliente: status %d: %v", status, resp)
+	}
+	if status, resp := llamarEmpresa(t, integracion.IDOtraEmpresa, conSesion(GetPerfilUsuario(dbc), integracion.IDAdmin, "A"), http.MethodGet, perfil, ""); status != http.StatusNotFound {
+		t.Errorf("perfil desde otra empresa: status %d: %v", status, resp)
+	}
+
+	tienda := fmt.Sprintf("/api/v1/tiendas/por_usuario?usuario=%d", integracion.IDUsuarioCliente)
+	if status, resp := llamar(t, conSesion(GetTiendaByUsuario(dbc), otro, "C"), http.MethodGet, tienda, ""); status != http.StatusNotFound {
+		t.Errorf("tienda pedida por otro cliente: status %d: %v", status, resp)
+	}
+	if status, resp := llamarEmpresa(t, integracion.IDOtraEmpresa, conSesion(GetTiendaByUsuario(dbc), integracion.IDAdmin, "A"), http.MethodGet, tienda, ""); status != http.StatusNotFound {
+		t.Errorf("tienda desde otra empresa: status %d: %v", status, resp)
+	}
+
+	editar := fmt.Sprintf(`{"id_usuario": %d, "nombre_completo": "Cambiado", "telefono": "9991112233"}`, integracion.IDUsuarioCliente)
+	if status, resp := llamar(t, conSesion(EditarUsuario(dbc), otro, "C"), http.MethodPut, "/api/v1/usuarios/editar", editar); status != http.StatusOK {
+		t.Fatalf("editar como otro cliente: status %d: %v", status, resp)
+	}
+	if nombre(integracion.IDUsuarioCliente) == "Cambiado" || nombre(otro) != "Cambiado" {
+		t.Errorf("el cliente editó a otro usuario y no a sí mismo")
+	}
+	if status, resp := llamarEmpresa(t, integracion.IDOtraEmpresa, conSesion(EditarUsuario(dbc), integracion.IDAdmin, "A"), http.MethodPut, "/api/v1/usuarios/editar", editar); status != http.StatusNotFound {
+		t.Errorf("editar desde otra empresa: status %d: %v", status, resp)
+	}
+	if nombre(integracion.IDUsuarioCliente) == "Cambiado" {
+		t.Error("se editó un usuario de otra empresa")
+	}
+	// Un admin de la empresa sí lo edita, también si no cambia nada
+	for _, etapa := range []string{"editar como admin", "editar sin cambios"} {
+		if status, resp := llamar(t, conSesion(EditarUsuario(dbc), integracion.IDAdmin, "A"), http.MethodPut, "/api/v1/usuarios/editar", editar); status != http.StatusOK {
+			t.Errorf("%s: status %d: %v", etapa, status, resp)
+		}
+	}
+	if status, _ := llamar(t, conSesion(EditarUsuario(dbc), integracion.IDAdmin, "A"), http.MethodPut, "/api/v1/usuarios/editar", `{"nombre_completo": "Sin id"}`); status != http.StatusBadRequest {
+		t.Errorf("admin sin id_usuario: status %d", status)
+	}
+}
+
+func BenchmarkIntegracionAsignarSucursal(b *testing.B) {
+	dbc := integracion.Iniciar(b)
+	sucursales := repositorio.NuevoMySQL(dbc).Sucursales
+	ctx := context.Background()
+	b.Run("sql", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, _, err := db.BuscarSucursalPorUbicacionConCobertura(dbc, "local", integracion.IDEmpresa, 20.97, -89.62); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("memoria", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := sucursales.PorUbicacion(ctx, integracion.IDEmpresa, 20.97, -89.62); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package rutas
 
 import (
+	"context"
 	"crypto/rand"
 	"database/sql"
 	"encoding/base64"
@@ -9,6 +10,11 @@ import (
 	"time"
 
 	"github.com/WolfSlayer04/logica_tiendaenlina/db"
+	"github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+	"github.com/WolfSlayer04/logica_tiendaenlina/reloj"
+	"github.com/WolfSlayer04/logica_tiendaenlina/repositorio"
+	"github.com/WolfSlayer04/logica_tiendaenlina/validacion"
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -16,8 +22,8 @@ import (
 var jwtKey = []byte("TU_CLAVE_SECRETA") // Reemplaza por una clave segura en producción
 
 type LoginRequest struct {
-	Correo string `json:"correo"`
-	Clave  string `json:"clave"`
+	Correo string `json:"correo" valida:"requerido"`
+	Clave  string `json:"clave" valida:"requerido"`
 }
 
 func writeSuccessResponse1(w http.ResponseWriter, message string, data interface{}) {
@@ -30,25 +36,13 @@ func writeSuccessResponse1(w http.ResponseWriter, message string, data interface
 	})
 }
 
-func writeErrorResponse1(w http.ResponseWriter, status int, message string, details string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	resp := map[string]interface{}{
-		"success": false,
-		"message": message,
-	}
-	if details != "" {
-		resp["details"] = details
-	}
-	json.NewEncoder(w).Encode(resp)
-}
-
 type AdminUsuario struct {
 	IDUsuario   int             `json:"id_usuario"`
 	IDPerfil    int             `json:"id_perfil"`
 	Permisos    json.RawMessage `json:"permisos"` // JSON string
 	TipoUsuario string          `json:"tipo_usuario"`
 	Correo      string          `json:"correo"`
+	IDEmpresa   int             `json:"id_empresa"` // 0 = todas las empresas del grupo
 	Clave       string          `json:"-"`
 }
 
@@ -61,14 +55,13 @@ func verificarContraseña(claveAlmacenada, claveIntento string) bool {
 	return claveAlmacenada == claveIntento
 }
 
-// Genera access token (15 minutos) y refresh token (expira medianoche Yucatán)
-// Para usuarios normales (sin permisos especiales)
-func generarTokens(id int, tipo string, correo string) (string, string, int64, error) {
-	loc, err := time.LoadLocation("America/Merida")
-	if err != nil {
-		loc = time.UTC
-	}
-	now := time.Now().In(loc)
+// Genera access token (15 minutos) y refresh token (expira a la medianoche
+// del negocio); ahora es la hora del reloj del negocio.
+// Para usuarios normales (sin permisos especiales). idEmpresa va en el claim
+// "empresa"; 0 (admin de todo el grupo) no lo incluye. idTienda, la tienda
+// activa del cliente, va en el claim "tienda"; 0 no lo incluye.
+func generarTokens(ahora time.Time, id int, tipo string, correo string, idEmpresa, idTienda int) (string, string, int64, error) {
+	now := ahora
 	accessExp := now.Add(15 * time.Minute).Unix()
 	accessClaims := jwt.MapClaims{
 		"id":     id,
@@ -76,12 +69,18 @@ func generarTokens(id int, tipo string, correo string) (string, string, int64, e
 		"correo": correo,
 		"exp":    accessExp,
 	}
+	if idEmpresa != 0 {
+		accessClaims["empresa"] = idEmpresa
+	}
+	if idTienda != 0 {
+		accessClaims["tienda"] = idTienda
+	}
 	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
 	accessString, err := accessToken.SignedString(jwtKey)
 	if err != nil {
 		return "", "", 0, err
 	}
-	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, loc)
+	midnight := reloj.InicioDelDia(now).AddDate(0, 0, 1)
 	refreshExp := midnight.Unix()
 	refreshBytes := make([]byte, 32)
 	_, err = rand.Read(refreshBytes)
@@ -94,12 +93,8 @@ func generarTokens(id int, tipo string, correo string) (string, string, int64, e
 
 // Genera access token y refresh token para admin,
 // incluyendo los permisos en el JWT
-func generarTokensConPermisos(id int, tipo string, correo string, permisos map[string]bool) (string, string, int64, error) {
-	loc, err := time.LoadLocation("America/Merida")
-	if err != nil {
-		loc = time.UTC
-	}
-	now := time.Now().In(loc)
+func generarTokensConPermisos(ahora time.Time, id int, tipo string, correo string, idEmpresa int, permisos map[string]bool) (string, string, int64, error) {
+	now := ahora
 	accessExp := now.Add(15 * time.Minute).Unix()
 	accessClaims := jwt.MapClaims{
 		"id":     id,
@@ -110,12 +105,15 @@ func generarTokensConPermisos(id int, tipo string, correo string, permisos map[s
 	if tipo == "A" && permisos != nil {
 		accessClaims["permisos"] = permisos
 	}
+	if idEmpresa != 0 {
+		accessClaims["empresa"] = idEmpresa
+	}
 	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
 	accessString, err := accessToken.SignedString(jwtKey)
 	if err != nil {
 		return "", "", 0, err
 	}
-	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, loc)
+	midnight := reloj.InicioDelDia(now).AddDate(0, 0, 1)
 	refreshExp := midnight.Unix()
 	refreshBytes := make([]byte, 32)
 	_, err = rand.Read(refreshBytes)
@@ -127,16 +125,7 @@ func generarTokensConPermisos(id int, tipo string, correo string, permisos map[s
 }
 
 // Guarda el refresh token, actualiza si ya existe uno activo, sino crea uno nuevo
-func guardarRefreshToken(dbc *db.DBConnection, userID int, tipoUsuario string, refreshToken, userAgent, ip string, refreshExp int64) error {
-	loc, err := time.LoadLocation("America/Merida")
-	if err != nil {
-		loc = time.UTC
-	}
-	now := time.Now().In(loc)
-	nowStr := now.Format("2006-01-02 15:04:05")
-	midnight := time.Unix(refreshExp, 0).In(loc)
-	midnightStr := midnight.Format("2006-01-02 15:04:05")
-
+func guardarRefreshToken(ctx context.Context, usuarios repositorio.UsuarioRepo, userID int, tipoUsuario string, refreshToken, userAgent, ip string, refreshExp int64) error {
 	tipo := tipoUsuario
 	if tipo != "A" && tipo != "C" {
 		if tipo == "admin" {
@@ -150,35 +139,21 @@ func guardarRefreshToken(dbc *db.DBConnection, userID int, tipoUsuario string, r
 		return err
 	}
 
-	var idToken int
-	err = dbc.Local.QueryRow(`
-        SELECT id FROM refresh_tokens
-        WHERE usuario_id = ? AND tipo_usuario = ? AND estado = 'activo'
-        ORDER BY expiracion DESC LIMIT 1
-    `, userID, tipo).Scan(&idToken)
-
-	if err == sql.ErrNoRows {
-		_, err = dbc.Local.Exec(`
-            INSERT INTO refresh_tokens (usuario_id, tipo_usuario, token_hash, user_agent, ip_address, expiracion, ultimo_uso, estado)
-            VALUES (?, ?, ?, ?, ?, ?, ?, 'activo')
-        `, userID, tipo, string(hash), userAgent, ip, midnightStr, nowStr)
-		return err
-	} else if err != nil {
-		return err
-	}
-
-	_, err = dbc.Local.Exec(`
-        UPDATE refresh_tokens
-        SET token_hash = ?, user_agent = ?, ip_address = ?, expiracion = ?, ultimo_uso = ?, estado = 'activo'
-        WHERE id = ?
-    `, string(hash), userAgent, ip, midnightStr, nowStr, idToken)
-	return err
+	return usuarios.GuardarRefreshToken(ctx, repositorio.RefreshToken{
+		IDUsuario:   userID,
+		TipoUsuario: tipo,
+		Hash:        string(hash),
+		UserAgent:   userAgent,
+		IP:          ip,
+		Expiracion:  time.Unix(refreshExp, 0),
+		UltimoUso:   reloj.Desde(ctx).Ahora(),
+	})
 }
 
-// Lee ultimo_uso como string y lo convierte a time.Time
-func sesionActivaReciente(dbc *db.DBConnection, userID int) (bool, error) {
+// Lee ultimo_uso como string (UTC) y lo compara con el reloj del negocio
+func sesionActivaReciente(ctx context.Context, dbc *db.DBConnection, userID int) (bool, error) {
 	var ultimoUsoStr sql.NullString
-	err := dbc.Local.QueryRow(`
+	err := dbc.Local.QueryRowContext(ctx, `
         SELECT ultimo_uso FROM refresh_tokens
         WHERE usuario_id = ? AND estado = 'activo'
         ORDER BY expiracion DESC LIMIT 1
@@ -192,57 +167,62 @@ func sesionActivaReciente(dbc *db.DBConnection, userID int) (bool, error) {
 	if !ultimoUsoStr.Valid || ultimoUsoStr.String == "" {
 		return false, nil
 	}
-	ultimoUso, err := time.Parse("2006-01-02 15:04:05", ultimoUsoStr.String)
+	ultimoUso, err := reloj.LeerBD(ultimoUsoStr.String, time.UTC)
 	if err != nil {
 		return false, err
 	}
-	if time.Since(ultimoUso) < 15*time.Minute {
+	if reloj.Desde(ctx).Ahora().Sub(ultimoUso) < 15*time.Minute {
 		return true, nil
 	}
 	return false, nil
 }
 
 // LoginUsuario es el handler del endpoint /api/login
-func LoginUsuario(dbc *db.DBConnection) http.HandlerFunc {
+func LoginUsuario(dbc *db.DBConnection, repos repositorio.Repositorios) http.HandlerFunc {
+	usuarios := repos.Usuarios
 	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
 		var req LoginRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			writeErrorResponse1(w, http.StatusBadRequest, "Datos inválidos", err.Error())
+		if err := validacion.Decodificar(w, r, &req); err != nil {
+			errores.Escribir(w, r, err)
 			return
 		}
 
 		var u db.Usuario
-		query := `SELECT id_usuario, id_empresa, tipo_usuario, nombre_completo, correo, telefono, clave, estatus FROM usuarios WHERE correo = ? LIMIT 1`
-		err := dbc.Local.QueryRow(query, req.Correo).Scan(
+		query := `SELECT id_usuario, id_empresa, tipo_usuario, nombre_completo, correo, telefono, clave, estatus FROM usuarios WHERE correo = ? AND id_empresa = ? LIMIT 1`
+		err := dbc.Local.QueryRowContext(r.Context(), query, req.Correo, idEmpresa).Scan(
 			&u.IDUsuario, &u.IDEmpresa, &u.TipoUsuario, &u.NombreCompleto, &u.Correo, &u.Telefono, &u.Clave, &u.Estatus,
 		)
 		var tipoUsuario string
 		var admin AdminUsuario
 
 		if err == sql.ErrNoRows {
-			// Intentar login como admin
-			adminQuery := `SELECT idusuario, idperfil, permisos, tipo_usuario, correo, clave FROM admin_usuarios WHERE correo = ? LIMIT 1`
-			adminErr := dbc.Local.QueryRow(adminQuery, req.Correo).Scan(
-				&admin.IDUsuario, &admin.IDPerfil, &admin.Permisos, &admin.TipoUsuario, &admin.Correo, &admin.Clave,
+			// Intentar login como admin (de la empresa o de todo el grupo)
+			adminQuery := `SELECT idusuario, idperfil, permisos, tipo_usuario, correo, IFNULL(idempresa, 0), clave FROM admin_usuarios WHERE correo = ? AND (idempresa IS NULL OR idempresa = ?) LIMIT 1`
+			adminErr := dbc.Local.QueryRowContext(r.Context(), adminQuery, req.Correo, idEmpresa).Scan(
+				&admin.IDUsuario, &admin.IDPerfil, &admin.Permisos, &admin.TipoUsuario, &admin.Correo, &admin.IDEmpresa, &admin.Clave,
 			)
 			if adminErr == sql.ErrNoRows {
-				writeErrorResponse1(w, http.StatusUnauthorized, "Usuario o contraseña incorrectos", "")
+				errores.Escribir(w, r, errores.Nuevo(errores.CredencialesInvalidas))
 				return
 			} else if adminErr != nil {
-				writeErrorResponse1(w, http.StatusInternalServerError, "Error de base de datos (admin)", adminErr.Error())
+				errores.Escribir(w, r, errores.Interno("Error de base de datos (admin)", adminErr))
 				return
 			}
 			if !verificarContraseña(admin.Clave, req.Clave) {
-				writeErrorResponse1(w, http.StatusUnauthorized, "Usuario o contraseña incorrectos", "")
+				errores.Escribir(w, r, errores.Nuevo(errores.CredencialesInvalidas))
 				return
 			}
-			activo, err := sesionActivaReciente(dbc, admin.IDUsuario)
+			activo, err := sesionActivaReciente(r.Context(), dbc, admin.IDUsuario)
 			if err != nil {
-				writeErrorResponse1(w, http.StatusInternalServerError, "Error verificando sesión activa", err.Error())
+				errores.Escribir(w, r, errores.Interno("Error verificando sesión activa", err))
 				return
 			}
 			if activo {
-				writeErrorResponse1(w, http.StatusConflict, "Sesión iniciada en otro equipo, espere o cierre sesión", "")
+				errores.Escribir(w, r, errores.Nuevo(errores.SesionActiva))
 				return
 			}
 			admin.TipoUsuario = "A"
@@ -251,16 +231,16 @@ func LoginUsuario(dbc *db.DBConnection) http.HandlerFunc {
 			var permisos map[string]bool
 			_ = json.Unmarshal(admin.Permisos, &permisos)
 
-			accessToken, refreshToken, refreshExp, err := generarTokensConPermisos(admin.IDUsuario, admin.TipoUsuario, admin.Correo, permisos)
+			accessToken, refreshToken, refreshExp, err := generarTokensConPermisos(reloj.Desde(r.Context()).Ahora(), admin.IDUsuario, admin.TipoUsuario, admin.Correo, admin.IDEmpresa, permisos)
 			if err != nil {
-				writeErrorResponse1(w, http.StatusInternalServerError, "Error generando tokens", err.Error())
+				errores.Escribir(w, r, errores.Interno("Error generando tokens", err))
 				return
 			}
 			userAgent := r.Header.Get("User-Agent")
 			ip := r.RemoteAddr
-			err = guardarRefreshToken(dbc, admin.IDUsuario, admin.TipoUsuario, refreshToken, userAgent, ip, refreshExp)
+			err = guardarRefreshToken(r.Context(), usuarios, admin.IDUsuario, admin.TipoUsuario, refreshToken, userAgent, ip, refreshExp)
 			if err != nil {
-				writeErrorResponse1(w, http.StatusInternalServerError, "Error guardando refresh token", err.Error())
+				errores.Escribir(w, r, errores.Interno("Error guardando refresh token", err))
 				return
 			}
 			admin.Clave = ""
@@ -272,83 +252,55 @@ func LoginUsuario(dbc *db.DBConnection) http.HandlerFunc {
 			})
 			return
 		} else if err != nil {
-			writeErrorResponse1(w, http.StatusInternalServerError, "Error de base de datos", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
 			return
 		}
 
 		// Login usuario normal
 		if !verificarContraseña(u.Clave, req.Clave) {
-			writeErrorResponse1(w, http.StatusUnauthorized, "Usuario o contraseña incorrectos", "")
+			errores.Escribir(w, r, errores.Nuevo(errores.CredencialesInvalidas))
 			return
 		}
 		if u.Estatus != "activo" {
-			writeErrorResponse1(w, http.StatusUnauthorized, "Usuario inactivo o suspendido", "")
+			errores.Escribir(w, r, errores.Nuevo(errores.UsuarioInactivo))
 			return
 		}
 		u.Clave = ""
 		tipoUsuario = "C"
 
-		activo, err := sesionActivaReciente(dbc, u.IDUsuario)
+		activo, err := sesionActivaReciente(r.Context(), dbc, u.IDUsuario)
 		if err != nil {
-			writeErrorResponse1(w, http.StatusInternalServerError, "Error verificando sesión activa", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error verificando sesión activa", err))
 			return
 		}
 		if activo {
-			writeErrorResponse1(w, http.StatusConflict, "Sesión iniciada en otro equipo, espere o cierre sesión", "")
+			errores.Escribir(w, r, errores.Nuevo(errores.SesionActiva))
 			return
 		}
 
-		var tienda struct {
-			IDTienda     int     `json:"id_tienda"`
-			NombreTienda string  `json:"nombre_tienda"`
-			Direccion    string  `json:"direccion"`
-			Colonia      string  `json:"colonia"`
-			CodigoPostal string  `json:"codigo_postal"`
-			Ciudad       string  `json:"ciudad"`
-			Estado       string  `json:"estado"`
-			Pais         string  `json:"pais"`
-			Latitud      float64 `json:"latitud"`
-			Longitud     float64 `json:"longitud"`
-			LatitudUbic  float64 `json:"latitud_ubic"`
-			LongitudUbic float64 `json:"longitud_ubic"`
-		}
-		var lat, lon, latPoint, lonPoint sql.NullFloat64
-		err = dbc.Local.QueryRow(`
-            SELECT id_tienda, nombre_tienda, direccion, colonia, codigo_postal, ciudad, estado, pais,
-                   latitud, longitud, IFNULL(ST_Y(ubicacion), 0) as latitud_ubic, IFNULL(ST_X(ubicacion), 0) as longitud_ubic
-            FROM tiendas
-            WHERE id_usuario = ?
-            LIMIT 1
-        `, u.IDUsuario).Scan(
-			&tienda.IDTienda, &tienda.NombreTienda, &tienda.Direccion, &tienda.Colonia,
-			&tienda.CodigoPostal, &tienda.Ciudad, &tienda.Estado, &tienda.Pais,
-			&lat, &lon, &latPoint, &lonPoint,
-		)
-		if err != nil && err != sql.ErrNoRows {
-			writeErrorResponse1(w, http.StatusInternalServerError, "Error al consultar la tienda revisa de nuevo", err.Error())
+		tienda, tiendas, err := tiendasLogin(r.Context(), repos.Tiendas, int64(u.IDUsuario))
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al consultar la tienda revisa de nuevo", err))
 			return
 		}
-		tienda.Latitud = db.NullToFloat(lat)
-		tienda.Longitud = db.NullToFloat(lon)
-		tienda.LatitudUbic = db.NullToFloat(latPoint)
-		tienda.LongitudUbic = db.NullToFloat(lonPoint)
 
-		accessToken, refreshToken, refreshExp, err := generarTokens(u.IDUsuario, tipoUsuario, u.Correo)
+		accessToken, refreshToken, refreshExp, err := generarTokens(reloj.Desde(r.Context()).Ahora(), u.IDUsuario, tipoUsuario, u.Correo, u.IDEmpresa, tienda.IDTienda)
 		if err != nil {
-			writeErrorResponse1(w, http.StatusInternalServerError, "Error generando tokens", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error generando tokens", err))
 			return
 		}
 		userAgent := r.Header.Get("User-Agent")
 		ip := r.RemoteAddr
-		err = guardarRefreshToken(dbc, u.IDUsuario, tipoUsuario, refreshToken, userAgent, ip, refreshExp)
+		err = guardarRefreshToken(r.Context(), usuarios, u.IDUsuario, tipoUsuario, refreshToken, userAgent, ip, refreshExp)
 		if err != nil {
-			writeErrorResponse1(w, http.StatusInternalServerError, "Error guardando refresh token", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error guardando refresh token", err))
 			return
 		}
 
 		writeSuccessResponse1(w, "Login exitoso", map[string]interface{}{
 			"usuario":      u,
 			"tienda":       tienda,
+			"tiendas":      tiendas,
 			"access_token": accessToken,
 			// Puedes devolver el refresh token si lo deseas
 			// "refresh_token": refreshToken,
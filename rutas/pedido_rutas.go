@@ -3,24 +3,31 @@ package rutas
 import (
     "database/sql"
     "encoding/json"
+    "context"
+    "errors"
     "fmt"
-    "log"
     "math"
     "net/http"
     "strconv"
     "strings"
     "time"
+    middlewares "github.com/WolfSlayer04/logica_tiendaenlina/Middleware"
+    "github.com/WolfSlayer04/logica_tiendaenlina/bitacora"
     "github.com/WolfSlayer04/logica_tiendaenlina/db"
+    "github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+    "github.com/WolfSlayer04/logica_tiendaenlina/errores"
+    "github.com/WolfSlayer04/logica_tiendaenlina/feriados"
+    "github.com/WolfSlayer04/logica_tiendaenlina/metricas"
+    "github.com/WolfSlayer04/logica_tiendaenlina/reloj"
+    "github.com/WolfSlayer04/logica_tiendaenlina/repositorio"
+    "github.com/WolfSlayer04/logica_tiendaenlina/trazas"
+    "github.com/WolfSlayer04/logica_tiendaenlina/validacion"
+    "go.opentelemetry.io/otel/trace"
 )
 
 // ---------------------------
 // ESTRUCTURAS DE RESPUESTA
 // ---------------------------
-type ErrorResponse struct {
-    Message string `json:"message"`
-    Detail  string `json:"detail,omitempty"`
-}
-
 type SuccessResponse struct {
     Message string      `json:"message"`
     Data    interface{} `json:"data,omitempty"`
@@ -31,48 +38,46 @@ type PedidoDetalleRequest struct {
     ClaveProducto       string   `json:"clave_producto"`
     Descripcion         string   `json:"descripcion"`
     Unidad              string   `json:"unidad"`
-    Cantidad            float64  `json:"cantidad"`
-    PrecioUnitario      float64  `json:"precio_unitario"`
-    PorcentajeDescuento float64  `json:"porcentaje_descuento"`
-    ImporteDescuento    float64  `json:"importe_descuento"`
+    Cantidad            float64  `json:"cantidad" valida:"mayor_cero"`
+    PrecioUnitario      float64  `json:"precio_unitario" valida:"mayor_cero"`
+    PorcentajeDescuento float64  `json:"porcentaje_descuento" valida:"rango=0:100"`
+    ImporteDescuento    float64  `json:"importe_descuento" valida:"no_negativo"`
     IVA                 float64  `json:"iva"`
     IEPS                float64  `json:"ieps"`
     Comentarios         string   `json:"comentarios"`
-    LatitudEntrega      *float64 `json:"latitud_entrega,omitempty"`
-    LongitudEntrega     *float64 `json:"longitud_entrega,omitempty"`
+    LatitudEntrega      *float64 `json:"latitud_entrega,omitempty" valida:"latitud"`
+    LongitudEntrega     *float64 `json:"longitud_entrega,omitempty" valida:"longitud"`
 }
 
 type PedidoRequest struct {
-    IDUsuario         int                    `json:"id_usuario"`
-    IDTienda          int                    `json:"id_tienda"`
-    IDSucursal        int                    `json:"id_sucursal"`
+    IDUsuario         int                    `json:"id_usuario" valida:"requerido"`
+    IDTienda          int                    `json:"id_tienda" valida:"requerido"`
+    IDSucursal        int                    `json:"id_sucursal" valida:"requerido"`
     FechaEntrega      sql.NullTime           `json:"fecha_entrega"`
-    IDMetodoPago      int                    `json:"id_metodo_pago"`
+    IDMetodoPago      int                    `json:"id_metodo_pago" valida:"requerido"`
     ReferenciaPago    sql.NullString         `json:"referencia_pago"`
     DireccionEntrega  string                 `json:"direccion_entrega"`
     ColoniaEntrega    string                 `json:"colonia_entrega"`
-    CPEntrega         string                 `json:"cp_entrega"`
+    CPEntrega         string                 `json:"cp_entrega" valida:"cp"`
     CiudadEntrega     string                 `json:"ciudad_entrega"`
     EstadoEntrega     string                 `json:"estado_entrega"`
-    LatitudEntrega    *float64               `json:"latitud_entrega,omitempty"`
-    LongitudEntrega   *float64               `json:"longitud_entrega,omitempty"`
+    LatitudEntrega    *float64               `json:"latitud_entrega,omitempty" valida:"latitud"`
+    LongitudEntrega   *float64               `json:"longitud_entrega,omitempty" valida:"longitud"`
     OrigenPedido      string                 `json:"origen_pedido"`
     Comentarios       sql.NullString         `json:"comentarios"`
-    Detalles          []PedidoDetalleRequest `json:"detalles"`
+    // IDReserva es el horario apartado en el checkout; fija la sucursal y la
+    // fecha de entrega
+    IDReserva         int64                  `json:"id_reserva"`
+    // IDDireccion es una dirección de la libreta de la tienda; reemplaza la
+    // dirección escrita y fija la sucursal que la cubre
+    IDDireccion       int64                  `json:"id_direccion"`
+    Detalles          []PedidoDetalleRequest `json:"detalles" valida:"requerido"`
 }
 
 
 // ---------------------------
 // AUXILIARES
 // ---------------------------
-func writeErrorResponse(w http.ResponseWriter, status int, message, detail string) {
-    w.Header().Set("Content-Type", "application/json")
-    w.WriteHeader(status)
-    resp := ErrorResponse{Message: message, Detail: detail}
-    log.Printf("HTTP %d: %s | %s", status, message, detail)
-    _ = json.NewEncoder(w).Encode(resp)
-}
-
 func writeSuccessResponse(w http.ResponseWriter, message string, data interface{}) {
     w.Header().Set("Content-Type", "application/json")
     _ = json.NewEncoder(w).Encode(SuccessResponse{
@@ -149,78 +154,79 @@ func NullTimeToStrMes(nt sql.NullTime) string {
 // FUNCIONES DE CÁLCULO DE FECHAS DE ENTREGA
 // ---------------------------
 
-func ObtenerConfigEntrega(dbc *db.DBConnection) (*ConfigEntrega, error) {
-    var configJSON []byte
-    err := dbc.Local.QueryRow("SELECT config_entrega FROM admin_usuarios WHERE tipo_usuario = 'Admin' LIMIT 1").Scan(&configJSON)
+// ObtenerConfigEntrega arma la configuración de entregas de una sucursal: la
+// por defecto, encima la guardada para la empresa y encima la de la sucursal.
+// Cada nivel sólo reemplaza los campos que trae. Con idSucursal 0 regresa la
+// de la empresa.
+func ObtenerConfigEntrega(ctx context.Context, sucursales repositorio.SucursalRepo, idEmpresa, idSucursal int) (*ConfigEntrega, error) {
+    deEmpresa, deSucursal, err := sucursales.ConfigEntrega(ctx, idEmpresa, idSucursal)
     if err != nil {
-        if err == sql.ErrNoRows {
-            return &ConfigEntrega{
-                DiasHabiles:        []string{"LUNES", "MARTES", "MIERCOLES", "JUEVES", "VIERNES"},
-                TiempoProcesamiento: 2,
-                ReglasFindeSemana: struct {
-                    ProcesarSabado       bool `json:"procesar_sabado"`
-                    ProcesarDomingo      bool `json:"procesar_domingo"`
-                    DiasAdicionalesSabado int  `json:"dias_adicionales_sabado"`
-                    DiasAdicionalesDomingo int `json:"dias_adicionales_domingo"`
-                }{
-                    ProcesarSabado:       true,
-                    ProcesarDomingo:      false,
-                    DiasAdicionalesSabado: 1,
-                    DiasAdicionalesDomingo: 2,
-                },
-                HorariosEntrega: []struct {
-                    Etiqueta string `json:"etiqueta"`
-                    Inicio   string `json:"inicio"`
-                    Fin      string `json:"fin"`
-                }{
-                    {Etiqueta: "Mañana", Inicio: "09:00", Fin: "12:00"},
-                    {Etiqueta: "Tarde", Inicio: "13:00", Fin: "18:00"},
-                },
-                DiasFeriados: []struct {
-                    Fecha          string `json:"fecha"`
-                    DiasAdicionales int   `json:"dias_adicionales"`
-                }{},
-            }, nil
-        }
         return nil, err
     }
-
-    if len(configJSON) == 0 {
-        return &ConfigEntrega{
-            DiasHabiles:        []string{"LUNES", "MARTES", "MIERCOLES", "JUEVES", "VIERNES"},
-            TiempoProcesamiento: 2,
-            ReglasFindeSemana: struct {
-                ProcesarSabado       bool `json:"procesar_sabado"`
-                ProcesarDomingo      bool `json:"procesar_domingo"`
-                DiasAdicionalesSabado int  `json:"dias_adicionales_sabado"`
-                DiasAdicionalesDomingo int `json:"dias_adicionales_domingo"`
-            }{
-                ProcesarSabado:       true,
-                ProcesarDomingo:      false,
-                DiasAdicionalesSabado: 1,
-                DiasAdicionalesDomingo: 2,
-            },
-            HorariosEntrega: []struct {
-                Etiqueta string `json:"etiqueta"`
-                Inicio   string `json:"inicio"`
-                Fin      string `json:"fin"`
-            }{
-                {Etiqueta: "Mañana", Inicio: "09:00", Fin: "12:00"},
-                {Etiqueta: "Tarde", Inicio: "13:00", Fin: "18:00"},
-            },
-            DiasFeriados: []struct {
-                Fecha          string `json:"fecha"`
-                DiasAdicionales int   `json:"dias_adicionales"`
-            }{},
-        }, nil
-    }
-
-    var config ConfigEntrega
-    if err := json.Unmarshal(configJSON, &config); err != nil {
+    config, err := combinarConfigEntrega(deEmpresa, deSucursal)
+    if err != nil {
         return nil, err
     }
+    propios, err := sucursales.Feriados(ctx, idEmpresa, idSucursal)
+    if err != nil {
+        return nil, err
+    }
+    config.Calendario = calendarioDe(config, propios)
+    return config, nil
+}
+
+// calendarioDe arma el calendario de la configuración: los feriados propios,
+// después los de dias_feriados y, si no se apagaron, los oficiales.
+func calendarioDe(config *ConfigEntrega, propios []feriados.Feriado) *feriados.Calendario {
+    for _, d := range config.DiasFeriados {
+        // Antes se comparaba por prefijo; se sigue aceptando una fecha con hora
+        fecha, err := time.Parse("2006-01-02", d.Fecha[:min(len(d.Fecha), 10)])
+        if err != nil {
+            continue
+        }
+        propios = append(propios, feriados.Feriado{Fecha: fecha, DiasAdicionales: d.DiasAdicionales, Origen: feriados.Config})
+    }
+    oficiales := config.FeriadosOficiales == nil || *config.FeriadosOficiales
+    return feriados.NuevoCalendario(oficiales, propios)
+}
+
+// combinarConfigEntrega aplica los niveles guardados, en orden, sobre la
+// configuración por defecto.
+func combinarConfigEntrega(niveles ...[]byte) (*ConfigEntrega, error) {
+    config := configEntregaPorDefecto()
+    for _, nivel := range niveles {
+        if len(nivel) == 0 {
+            continue
+        }
+        if err := json.Unmarshal(nivel, config); err != nil {
+            return nil, err
+        }
+    }
+    return config, nil
+}
 
-    return &config, nil
+// configEntregaPorDefecto es la configuración de una empresa que no ha
+// guardado ninguna.
+func configEntregaPorDefecto() *ConfigEntrega {
+    config := &ConfigEntrega{
+        DiasHabiles:        []string{"LUNES", "MARTES", "MIERCOLES", "JUEVES", "VIERNES"},
+        TiempoProcesamiento: 2,
+        ReglasFindeSemana: ReglasFinSemana{
+            ProcesarSabado:       true,
+            ProcesarDomingo:      false,
+            DiasAdicionalesSabado: 1,
+            DiasAdicionalesDomingo: 2,
+        },
+        HorariosEntrega: []HorarioEntrega{
+            {Etiqueta: "Mañana", Inicio: "09:00", Fin: "12:00"},
+            {Etiqueta: "Tarde", Inicio: "13:00", Fin: "18:00"},
+        },
+        DiasFeriados: []DiaFeriado{},
+        // Un puntero por configuración: json.Unmarshal escribe sobre él
+        FeriadosOficiales: new(bool),
+    }
+    *config.FeriadosOficiales = true
+    return config
 }
 
 func obtenerNombreDiaSemana(fecha time.Time) string {
@@ -238,18 +244,65 @@ func esDiaHabil(fecha time.Time, config *ConfigEntrega) bool {
     return false
 }
 
+// esDiaFeriado consulta el calendario de la configuración; si no lo trae
+// (no salió de ObtenerConfigEntrega) lo arma sólo con dias_feriados y los
+// oficiales.
 func esDiaFeriado(fecha time.Time, config *ConfigEntrega) (bool, int) {
-    fechaStr := fecha.Format("2006-01-02")
-    for _, feriado := range config.DiasFeriados {
-        if strings.HasPrefix(feriado.Fecha, fechaStr) {
-            return true, feriado.DiasAdicionales
-        }
+    feriado, ok := feriadoDe(fecha, config)
+    return ok, feriado.DiasAdicionales
+}
+
+func feriadoDe(fecha time.Time, config *ConfigEntrega) (feriados.Feriado, bool) {
+    calendario := config.Calendario
+    if calendario == nil {
+        calendario = calendarioDe(config, nil)
     }
-    return false, 0
+    return calendario.Es(fecha)
 }
 
+// PromesaEntrega es la fecha mínima de entrega de un pedido con los pasos que
+// llevaron a ella, para que soporte pueda contestar por qué cae ese día.
+type PromesaEntrega struct {
+    Fecha time.Time
+    Pasos []string
+}
+
+// Explicacion son los pasos en una línea, p. ej. "pedido después de las
+// 14:00 + 2 días hábiles + feriado 16/11 (Día de la Revolución)".
+func (p PromesaEntrega) Explicacion() string {
+    return strings.Join(p.Pasos, " + ")
+}
+
+// CalcularFechaEntrega es la fecha mínima de entrega de un pedido sin
+// productos que sumen días por categoría.
 func CalcularFechaEntrega(fechaPedido time.Time, config *ConfigEntrega) time.Time {
+    return CalcularPromesaEntrega(fechaPedido, config, TiempoCategoria{}).Fecha
+}
+
+// CalcularPromesaEntrega calcula la fecha mínima de entrega de un pedido hecho
+// en fechaPedido (hora del negocio); categoria es lo que suman sus productos
+// (ver tiempoDelCarrito). Antes de mismo_dia_antes_de se entrega el mismo
+// día; después de hora_corte el pedido cuenta desde el día siguiente. Al día
+// del pedido se le aplican las reglas de fin de semana y de feriado, y desde
+// ahí se cuentan tiempo_procesamiento y los días adicionales en días hábiles
+// que no son feriado. La hora es la del primer horario.
+func CalcularPromesaEntrega(fechaPedido time.Time, config *ConfigEntrega, categoria TiempoCategoria) PromesaEntrega {
+    var promesa PromesaEntrega
+    if fecha, ok := entregaMismoDia(fechaPedido, config, categoria); ok {
+        promesa.Fecha = fecha
+        promesa.Pasos = append(promesa.Pasos, "pedido antes de las "+config.MismoDiaAntesDe+": entrega el mismo día")
+        return promesa
+    }
+
     fechaEntrega := fechaPedido
+    if config.HoraCorte != "" && fechaPedido.Format("15:04") >= config.HoraCorte {
+        fechaEntrega = time.Date(fechaPedido.Year(), fechaPedido.Month(), fechaPedido.Day()+1, 0, 0, 0, 0, fechaPedido.Location())
+        promesa.Pasos = append(promesa.Pasos, "pedido después de las "+config.HoraCorte)
+    }
+    if config.TiempoProcesamiento > 0 {
+        promesa.Pasos = append(promesa.Pasos, diasHabiles(config.TiempoProcesamiento))
+    }
+
     diaSemana := fechaEntrega.Weekday()
     esSabado := diaSemana == time.Saturday
     esDomingo := diaSemana == time.Sunday
@@ -263,25 +316,42 @@ func CalcularFechaEntrega(fechaPedido time.Time, config *ConfigEntrega) time.Tim
             }
         }
         diasAdicionales += config.ReglasFindeSemana.DiasAdicionalesSabado
+        if config.ReglasFindeSemana.DiasAdicionalesSabado > 0 {
+            promesa.Pasos = append(promesa.Pasos, "sábado "+masDias(config.ReglasFindeSemana.DiasAdicionalesSabado))
+        }
     } else if esDomingo {
         if !config.ReglasFindeSemana.ProcesarDomingo {
             fechaEntrega = fechaEntrega.AddDate(0, 0, 1)
         }
         diasAdicionales += config.ReglasFindeSemana.DiasAdicionalesDomingo
+        if config.ReglasFindeSemana.DiasAdicionalesDomingo > 0 {
+            promesa.Pasos = append(promesa.Pasos, "domingo "+masDias(config.ReglasFindeSemana.DiasAdicionalesDomingo))
+        }
     }
 
-    esFeriado, diasAdicionalesFeriado := esDiaFeriado(fechaEntrega, config)
-    if esFeriado {
-        diasAdicionales += diasAdicionalesFeriado
+    if feriado, ok := feriadoDe(fechaEntrega, config); ok && feriado.DiasAdicionales > 0 {
+        diasAdicionales += feriado.DiasAdicionales
+        promesa.Pasos = append(promesa.Pasos, describirFeriado(fechaEntrega, feriado)+" "+masDias(feriado.DiasAdicionales))
+    }
+
+    if categoria.DiasAdicionales > 0 {
+        diasAdicionales += categoria.DiasAdicionales
+        nombre := categoria.Nombre
+        if nombre == "" {
+            nombre = fmt.Sprintf("categoría %d", categoria.IDCategoria)
+        }
+        promesa.Pasos = append(promesa.Pasos, nombre+" "+masDias(categoria.DiasAdicionales))
     }
 
     diasProcesamiento := config.TiempoProcesamiento + diasAdicionales
     for i := 0; i < diasProcesamiento; {
         fechaEntrega = fechaEntrega.AddDate(0, 0, 1)
         if esDiaHabil(fechaEntrega, config) {
-            esFeriado, _ := esDiaFeriado(fechaEntrega, config)
+            feriado, esFeriado := feriadoDe(fechaEntrega, config)
             if !esFeriado {
                 i++
+            } else {
+                promesa.Pasos = append(promesa.Pasos, describirFeriado(fechaEntrega, feriado))
             }
         }
     }
@@ -301,7 +371,53 @@ func CalcularFechaEntrega(fechaPedido time.Time, config *ConfigEntrega) time.Tim
             )
         }
     }
-    return fechaEntrega
+    promesa.Fecha = fechaEntrega
+    return promesa
+}
+
+// entregaMismoDia es el primer horario de hoy que todavía no empieza, si el
+// pedido entra en mismo_dia_antes_de: se hizo antes de esa hora, en un día
+// hábil que no es feriado, y ningún producto suma días por categoría.
+func entregaMismoDia(fechaPedido time.Time, config *ConfigEntrega, categoria TiempoCategoria) (time.Time, bool) {
+    if config.MismoDiaAntesDe == "" || fechaPedido.Format("15:04") >= config.MismoDiaAntesDe || categoria.DiasAdicionales > 0 {
+        return time.Time{}, false
+    }
+    if feriado, _ := esDiaFeriado(fechaPedido, config); feriado || !esDiaHabil(fechaPedido, config) {
+        return time.Time{}, false
+    }
+    if len(config.HorariosEntrega) == 0 {
+        return fechaPedido, true
+    }
+    for _, h := range config.HorariosEntrega {
+        if fecha, ok := fechaConHorario(fechaPedido, h); ok && fecha.After(fechaPedido) {
+            return fecha, true
+        }
+    }
+    return time.Time{}, false
+}
+
+// describirFeriado es "feriado 16/11 (Día de la Revolución)"; los de
+// dias_feriados no tienen nombre.
+func describirFeriado(dia time.Time, feriado feriados.Feriado) string {
+    texto := "feriado " + dia.Format("02/01")
+    if feriado.Nombre != "" {
+        texto += " (" + feriado.Nombre + ")"
+    }
+    return texto
+}
+
+func diasHabiles(n int) string {
+    if n == 1 {
+        return "1 día hábil"
+    }
+    return fmt.Sprintf("%d días hábiles", n)
+}
+
+func masDias(n int) string {
+    if n == 1 {
+        return "+1 día"
+    }
+    return fmt.Sprintf("+%d días", n)
 }
 
 
@@ -310,15 +426,19 @@ func CalcularFechaEntrega(fechaPedido time.Time, config *ConfigEntrega) time.Tim
 // ---------------------------
 func GetAllPedidos(dbc *db.DBConnection) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
-        rows, err := dbc.Local.Query(`
+        idEmpresa, ok := empresas.Requerida(w, r)
+        if !ok {
+            return
+        }
+        rows, err := dbc.Local.QueryContext(r.Context(), `
             SELECT id_pedido, clave_unica, id_usuario, id_tienda, id_sucursal, fecha_creacion, fecha_entrega,
                    subtotal, descuento, iva, ieps, total, id_metodo_pago, referencia_pago, direccion_entrega,
                    colonia_entrega, cp_entrega, ciudad_entrega, estado_entrega, latitud_entrega, longitud_entrega,
                    estatus, comentarios, origen_pedido, id_lista_precio
-            FROM pedidos ORDER BY fecha_creacion DESC
-        `)
+            FROM pedidos WHERE id_empresa = ? ORDER BY fecha_creacion DESC
+        `, idEmpresa)
         if err != nil {
-            writeErrorResponse(w, http.StatusInternalServerError, "Error al obtener los pedidos", err.Error())
+            errores.Escribir(w, r, errores.Interno("Error al obtener los pedidos", err))
             return
         }
         defer rows.Close()
@@ -356,7 +476,7 @@ func GetAllPedidos(dbc *db.DBConnection) http.HandlerFunc {
                 &pedido.IDListaPrecio,
             )
             if err != nil {
-                writeErrorResponse(w, http.StatusInternalServerError, "Error al leer pedido", err.Error())
+                errores.Escribir(w, r, errores.Interno("Error al leer pedido", err))
                 return
             }
             if fechaEntregaStr.Valid {
@@ -368,7 +488,7 @@ func GetAllPedidos(dbc *db.DBConnection) http.HandlerFunc {
                     }
                 }
             }
-            fechaCreacionTime, _ := time.Parse("2006-01-02 15:04:05", pedido.FechaCreacion)
+            fechaCreacionTime, _ := reloj.LeerBD(pedido.FechaCreacion, reloj.Desde(r.Context()).Ahora().Location())
             pedidoMap := map[string]interface{}{
                 "id_pedido":         pedido.IDPedido,
                 "clave_unica":       pedido.ClaveUnica,
@@ -397,13 +517,13 @@ func GetAllPedidos(dbc *db.DBConnection) http.HandlerFunc {
                 "id_lista_precio":   pedido.IDListaPrecio,
             }
 
-            detallesRows, err := dbc.Local.Query(`
+            detallesRows, err := dbc.Local.QueryContext(r.Context(), `
                 SELECT id_detalle, id_pedido, id_producto, clave_producto, descripcion, unidad, cantidad, precio_unitario, 
                        porcentaje_descuento, importe_descuento, subtotal, importe_iva, importe_ieps, total, latitud_entrega, 
                        longitud_entrega, estatus, comentarios, fecha_registro
                 FROM detalle_pedidos WHERE id_pedido = ?`, pedido.IDPedido)
             if err != nil {
-                writeErrorResponse(w, http.StatusInternalServerError, "Error al obtener detalles", err.Error())
+                errores.Escribir(w, r, errores.Interno("Error al obtener detalles", err))
                 return
             }
             var detalles []map[string]interface{}
@@ -432,7 +552,7 @@ func GetAllPedidos(dbc *db.DBConnection) http.HandlerFunc {
                 )
                 if err != nil {
                     detallesRows.Close()
-                    writeErrorResponse(w, http.StatusInternalServerError, "Error al leer detalle", err.Error())
+                    errores.Escribir(w, r, errores.Interno("Error al leer detalle", err))
                     return
                 }
                 var fechaRegistroStr string
@@ -479,28 +599,32 @@ func GetAllPedidos(dbc *db.DBConnection) http.HandlerFunc {
 // ---------------------------
 func GetPedidosByUsuario(dbc *db.DBConnection) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
+        idEmpresa, ok := empresas.Requerida(w, r)
+        if !ok {
+            return
+        }
         idUsuarioStr := r.URL.Query().Get("id_usuario")
         if idUsuarioStr == "" {
-            writeErrorResponse(w, http.StatusBadRequest, "Falta el parámetro id_usuario", "")
+            errores.Escribir(w, r, errores.Validacion(errores.Requerido("id_usuario")))
             return
         }
         var idUsuario int
         if _, err := fmt.Sscanf(idUsuarioStr, "%d", &idUsuario); err != nil || idUsuario <= 0 {
-            writeErrorResponse(w, http.StatusBadRequest, "id_usuario inválido", "")
+            errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_usuario")))
             return
         }
 
-        rows, err := dbc.Local.Query(`
+        rows, err := dbc.Local.QueryContext(r.Context(), `
             SELECT id_pedido, clave_unica, id_usuario, id_tienda, id_sucursal, fecha_creacion, fecha_entrega,
                    subtotal, descuento, iva, ieps, total, id_metodo_pago, referencia_pago, direccion_entrega,
                    colonia_entrega, cp_entrega, ciudad_entrega, estado_entrega, latitud_entrega, longitud_entrega,
                    estatus, comentarios, origen_pedido, id_lista_precio
             FROM pedidos
-            WHERE id_usuario = ?
+            WHERE id_empresa = ? AND id_usuario = ?
             ORDER BY fecha_creacion DESC
-        `, idUsuario)
+        `, idEmpresa, idUsuario)
         if err != nil {
-            writeErrorResponse(w, http.StatusInternalServerError, "Error al obtener los pedidos", err.Error())
+            errores.Escribir(w, r, errores.Interno("Error al obtener los pedidos", err))
             return
         }
         defer rows.Close()
@@ -538,7 +662,7 @@ func GetPedidosByUsuario(dbc *db.DBConnection) http.HandlerFunc {
                 &pedido.IDListaPrecio,
             )
             if err != nil {
-                writeErrorResponse(w, http.StatusInternalServerError, "Error al leer pedido", err.Error())
+                errores.Escribir(w, r, errores.Interno("Error al leer pedido", err))
                 return
             }
             if fechaEntregaStr.Valid {
@@ -550,7 +674,7 @@ func GetPedidosByUsuario(dbc *db.DBConnection) http.HandlerFunc {
                     }
                 }
             }
-            fechaCreacionTime, _ := time.Parse("2006-01-02 15:04:05", pedido.FechaCreacion)
+            fechaCreacionTime, _ := reloj.LeerBD(pedido.FechaCreacion, reloj.Desde(r.Context()).Ahora().Location())
             pedidoMap := map[string]interface{}{
                 "id_pedido":         pedido.IDPedido,
                 "clave_unica":       pedido.ClaveUnica,
@@ -579,13 +703,13 @@ func GetPedidosByUsuario(dbc *db.DBConnection) http.HandlerFunc {
                 "id_lista_precio":   pedido.IDListaPrecio,
             }
 
-            detallesRows, err := dbc.Local.Query(`
+            detallesRows, err := dbc.Local.QueryContext(r.Context(), `
                 SELECT id_detalle, id_pedido, id_producto, clave_producto, descripcion, unidad, cantidad, precio_unitario, 
                        porcentaje_descuento, importe_descuento, subtotal, importe_iva, importe_ieps, total, latitud_entrega, 
                        longitud_entrega, estatus, comentarios, fecha_registro
                 FROM detalle_pedidos WHERE id_pedido = ?`, pedido.IDPedido)
             if err != nil {
-                writeErrorResponse(w, http.StatusInternalServerError, "Error al obtener detalles", err.Error())
+                errores.Escribir(w, r, errores.Interno("Error al obtener detalles", err))
                 return
             }
             var detalles []map[string]interface{}
@@ -614,7 +738,7 @@ func GetPedidosByUsuario(dbc *db.DBConnection) http.HandlerFunc {
                 )
                 if err != nil {
                     detallesRows.Close()
-                    writeErrorResponse(w, http.StatusInternalServerError, "Error al leer detalle", err.Error())
+                    errores.Escribir(w, r, errores.Interno("Error al leer detalle", err))
                     return
                 }
                 fechaRegistroStr := ""
@@ -657,269 +781,334 @@ func GetPedidosByUsuario(dbc *db.DBConnection) http.HandlerFunc {
 // ---------------------------
 // ENDPOINT: Obtener fechas disponibles para entrega
 // ---------------------------
-func GetFechasEntregaDisponibles(dbc *db.DBConnection) http.HandlerFunc {
+func GetFechasEntregaDisponibles(repos repositorio.Repositorios) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
-        config, err := ObtenerConfigEntrega(dbc)
+        idEmpresa, ok := empresas.Requerida(w, r)
+        if !ok {
+            return
+        }
+        // Sin id_sucursal se usa la configuración de la empresa
+        idSucursal, ok := sucursalDeConsulta(w, r, repos.Sucursales, idEmpresa)
+        if !ok {
+            return
+        }
+        config, err := ObtenerConfigEntrega(r.Context(), repos.Sucursales, idEmpresa, idSucursal)
         if err != nil {
-            writeErrorResponse(w, http.StatusInternalServerError, "Error al obtener configuración de entregas", err.Error())
+            errores.Escribir(w, r, errores.Interno("Error al obtener configuración de entregas", err))
             return
         }
-        now := time.Now()
-        fechasDisponibles := []map[string]interface{}{}
-        fechaActual := now
-        diasCalculados := 0
-        for diasCalculados < 7 {
-            fechaActual = fechaActual.AddDate(0, 0, 1)
-            if esDiaHabil(fechaActual, config) {
-                esFeriado, _ := esDiaFeriado(fechaActual, config)
-                if !esFeriado {
-                    for _, horario := range config.HorariosEntrega {
-                        horaParts := strings.Split(horario.Inicio, ":")
-                        if len(horaParts) >= 2 {
-                            hora, _ := strconv.Atoi(horaParts[0])
-                            minuto, _ := strconv.Atoi(horaParts[1])
-                            fechaHora := time.Date(
-                                fechaActual.Year(),
-                                fechaActual.Month(),
-                                fechaActual.Day(),
-                                hora, minuto, 0, 0,
-                                fechaActual.Location(),
-                            )
-                            fechasDisponibles = append(fechasDisponibles, map[string]interface{}{
-                                "fecha": fechaHora.Format("2006-01-02 15:04:05"),
-                                "fecha_formateada": formateaFechaCorta(fechaHora),
-                                "etiqueta": horario.Etiqueta,
-                                "timestamp": fechaHora.Unix(),
-                            })
-                        }
-                    }
-                    diasCalculados++
+        fechasDisponibles, err := fechasEntrega(r.Context(), repos, idEmpresa, idSucursal, config, reloj.Desde(r.Context()).Ahora())
+        if err != nil {
+            errores.Escribir(w, r, errores.Interno("Error al obtener la ocupación de los horarios", err))
+            return
+        }
+        writeSuccessResponse(w, "Fechas de entrega disponibles", fechasDisponibles)
+    }
+}
+
+// fechasEntrega son los horarios que se ofrecen a partir de now, desde la
+// fecha mínima de un carrito sin días por categoría. Con idSucursal 0 no se
+// informa capacidad: la ocupación es por sucursal.
+func fechasEntrega(ctx context.Context, repos repositorio.Repositorios, idEmpresa, idSucursal int, config *ConfigEntrega, now time.Time) ([]map[string]interface{}, error) {
+    minima := CalcularFechaEntrega(now, config)
+    dias := diasDesde(minima, diasOfrecidos-1, config)
+
+    ocupacion := map[repositorio.Horario]repositorio.Ocupacion{}
+    if idSucursal != 0 && len(dias) > 0 {
+        var err error
+        ocupacion, err = repos.Entregas.Ocupacion(ctx, idEmpresa, idSucursal,
+            dias[0].Format("2006-01-02"), dias[len(dias)-1].Format("2006-01-02"), now)
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    fechasDisponibles := []map[string]interface{}{}
+    for _, dia := range dias {
+        for _, horario := range config.HorariosEntrega {
+            fechaHora, ok := fechaConHorario(dia, horario)
+            if !ok || fechaHora.Before(minima) {
+                continue
+            }
+            fecha := map[string]interface{}{
+                "fecha": fechaHora.Format("2006-01-02 15:04:05"),
+                "fecha_formateada": formateaFechaCorta(fechaHora),
+                "etiqueta": horario.Etiqueta,
+                "horario": horario.Inicio,
+                "timestamp": fechaHora.Unix(),
+            }
+            if idSucursal != 0 {
+                clave := repositorio.Horario{Fecha: dia.Format("2006-01-02"), Inicio: horario.Inicio}
+                for k, v := range disponibilidadHorario(horario, ocupacion[clave]) {
+                    fecha[k] = v
                 }
             }
+            fechasDisponibles = append(fechasDisponibles, fecha)
         }
-        writeSuccessResponse(w, "Fechas de entrega disponibles", fechasDisponibles)
     }
+    return fechasDisponibles, nil
 }
 
 // ---------------------------
 // ENDPOINT: Crear Pedido (ajustado a detalle_pedidos)
 // ---------------------------
-func CreatePedido(dbc *db.DBConnection) http.HandlerFunc {
+func CreatePedido(repos repositorio.Repositorios) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
+        idEmpresa, ok := empresas.Requerida(w, r)
+        if !ok {
+            return
+        }
         var req PedidoRequest
-        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-            writeErrorResponse(w, http.StatusBadRequest, "Datos inválidos", err.Error())
+        if err := validacion.Leer(w, r, &req); err != nil {
+            errores.Escribir(w, r, err)
             return
         }
 
+        // Un cliente sólo pide a su nombre (y con sus reservas). Sin id_tienda
+        // pide para su tienda activa; con ella, sólo para una suya
+        if idSesion, tipo, _, _, _ := middlewares.GetUserFromContext(r); tipo == "C" {
+            req.IDUsuario = idSesion
+            if req.IDTienda == 0 {
+                if req.IDTienda, ok = tiendaActiva(w, r, repos, idEmpresa); !ok {
+                    return
+                }
+            } else if !tiendaPermitida(w, r, repos, idEmpresa, req.IDTienda) {
+                return
+            }
+        }
+
+        now := reloj.Desde(r.Context()).Ahora()
+
+        // Con id_direccion se entrega en esa dirección de la libreta y la
+        // atiende la sucursal que la cubre, aunque el pedido traiga otra
+        if req.IDDireccion != 0 {
+            direccion, err := repos.Direcciones.Obtener(r.Context(), idEmpresa, req.IDTienda, req.IDDireccion)
+            if errors.Is(err, repositorio.ErrNoEncontrado) {
+                errores.Escribir(w, r, errores.Nuevo(errores.DireccionNoEncontrada))
+                return
+            } else if err != nil {
+                errores.Escribir(w, r, errores.Interno("No se pudo obtener la dirección de entrega", err))
+                return
+            }
+            cobertura, err := coberturaDe(r.Context(), repos.Sucursales, idEmpresa, direccion.Latitud, direccion.Longitud)
+            if err != nil {
+                errores.Escribir(w, r, errores.Interno("No se pudo buscar la sucursal", err))
+                return
+            }
+            if !cobertura.Cubierta {
+                errores.Escribir(w, r, errores.Nuevo(errores.UbicacionSinCobertura))
+                return
+            }
+            req.IDSucursal = cobertura.Sucursal.IDSucursal
+            req.DireccionEntrega = direccion.Direccion
+            req.ColoniaEntrega = direccion.Colonia
+            req.CPEntrega = direccion.CodigoPostal
+            req.CiudadEntrega = direccion.Ciudad
+            req.EstadoEntrega = direccion.Estado
+            req.LatitudEntrega = &direccion.Latitud
+            req.LongitudEntrega = &direccion.Longitud
+        }
+
+        // Con id_reserva la sucursal y la fecha de entrega son las del horario apartado
+        var reserva repositorio.Reserva
+        if req.IDReserva != 0 {
+            var err error
+            reserva, err = repos.Entregas.Vigente(r.Context(), idEmpresa, req.IDReserva, now)
+            if errors.Is(err, repositorio.ErrReservaVencida) {
+                errores.Escribir(w, r, errores.Nuevo(errores.ReservaVencida))
+                return
+            } else if err != nil {
+                errores.Escribir(w, r, errores.Interno("No se pudo obtener el horario apartado", err))
+                return
+            }
+            if req.IDSucursal == 0 {
+                req.IDSucursal = reserva.IDSucursal
+            }
+        }
+
         if req.IDSucursal == 0 {
-            var idSucursal int
-            err := dbc.Local.QueryRow("SELECT idsucursal FROM adm_sucursales WHERE estatus = 'S' ORDER BY idsucursal LIMIT 1").Scan(&idSucursal)
+            idSucursal, err := repos.Sucursales.PrimeraActiva(r.Context(), idEmpresa)
             if err != nil {
-                writeErrorResponse(w, http.StatusInternalServerError, "No se pudo obtener la sucursal", err.Error())
+                errores.Escribir(w, r, errores.Interno("No se pudo obtener la sucursal", err))
                 return
             }
             req.IDSucursal = idSucursal
+        } else if err := repos.Sucursales.DeEmpresa(r.Context(), idEmpresa, req.IDSucursal); errors.Is(err, repositorio.ErrNoEncontrado) {
+            errores.Escribir(w, r, errores.Nuevo(errores.SucursalNoEncontrada))
+            return
+        } else if err != nil {
+            errores.Escribir(w, r, errores.Interno("No se pudo validar la sucursal", err))
+            return
         }
 
-        if req.IDUsuario == 0 || req.IDTienda == 0 || req.IDSucursal == 0 || req.IDMetodoPago == 0 {
-            writeErrorResponse(w, http.StatusBadRequest, "Campos requeridos faltan", "IDUsuario, IDTienda, IDSucursal, IDMetodoPago son obligatorios")
+        // Se valida después de asignar la sucursal por defecto
+        if campos := validacion.Validar(&req); len(campos) > 0 {
+            errores.Escribir(w, r, errores.Validacion(campos...))
             return
         }
-        if len(req.Detalles) == 0 {
-            writeErrorResponse(w, http.StatusBadRequest, "Debe incluir al menos un producto", "")
+        if req.IDReserva != 0 && (reserva.IDUsuario != req.IDUsuario || reserva.IDSucursal != req.IDSucursal) {
+            errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_reserva")))
             return
         }
 
-        tx, err := dbc.Local.Begin()
+        cantidades := map[int64]float64{}
+        for _, d := range req.Detalles {
+            cantidades[d.IDProducto] += d.Cantidad
+        }
+        peso, err := pesoDe(r.Context(), repos.Productos, idEmpresa, cantidades)
         if err != nil {
-            writeErrorResponse(w, http.StatusInternalServerError, "No se pudo iniciar la transacción", err.Error())
+            errores.Escribir(w, r, errores.Interno("No se pudo obtener el peso de los productos", err))
             return
         }
-        defer func() {
-            if r := recover(); r != nil {
-                tx.Rollback()
-                writeErrorResponse(w, http.StatusInternalServerError, "Error inesperado en el servidor", fmt.Sprintf("%v", r))
-            }
-        }()
 
-        now := time.Now()
-
-        if !req.FechaEntrega.Valid {
-            config, err := ObtenerConfigEntrega(dbc)
+        // Sin horario apartado ni fecha de entrega se aparta aquí el primer
+        // horario con lugar; una fecha_entrega explícita no ocupa capacidad.
+        // La explicación queda en el pedido para soporte
+        apartadoAqui := false
+        explicacion := "fecha de entrega indicada en el pedido"
+        if req.IDReserva != 0 {
+            fechaEntrega, err := fechaDeReserva(reserva, now.Location())
+            if err != nil {
+                errores.Escribir(w, r, errores.Interno("Horario apartado inválido", err))
+                return
+            }
+            req.FechaEntrega = sql.NullTime{Time: fechaEntrega, Valid: true}
+            explicacion = "horario elegido en el checkout"
+        } else if !req.FechaEntrega.Valid {
+            config, err := ObtenerConfigEntrega(r.Context(), repos.Sucursales, idEmpresa, req.IDSucursal)
+            if err != nil {
+                errores.Escribir(w, r, errores.Interno("Error al obtener configuración de entregas", err))
+                return
+            }
+            categoria, err := tiempoDelCarrito(r.Context(), repos.Productos, idEmpresa, config, cantidades)
             if err != nil {
-                writeErrorResponse(w, http.StatusInternalServerError, "Error al obtener configuración de entregas", err.Error())
+                errores.Escribir(w, r, errores.Interno("No se pudo obtener la categoría de los productos", err))
+                return
+            }
+            promesa := CalcularPromesaEntrega(now, config, categoria)
+            idReserva, fechaEntrega, err := apartarPrimerHorario(r.Context(), repos.Entregas, repositorio.Reserva{
+                IDEmpresa:  idEmpresa,
+                IDSucursal: req.IDSucursal,
+                IDUsuario:  req.IDUsuario,
+                Peso:       peso,
+            }, config, promesa.Fecha, now)
+            if errors.Is(err, repositorio.ErrSinCapacidad) {
+                errores.Escribir(w, r, errores.Nuevo(errores.HorarioSinCapacidad))
+                return
+            } else if err != nil {
+                errores.Escribir(w, r, errores.Interno("No se pudo apartar el horario de entrega", err))
                 return
             }
-            fechaEntrega := CalcularFechaEntrega(now, config)
+            req.IDReserva = idReserva
+            apartadoAqui = idReserva != 0
             req.FechaEntrega = sql.NullTime{
                 Time:  fechaEntrega,
                 Valid: true,
             }
+            if reloj.Dia(fechaEntrega) != reloj.Dia(promesa.Fecha) {
+                promesa.Pasos = append(promesa.Pasos, "sin lugar hasta el "+fechaEntrega.Format("02/01"))
+            }
+            explicacion = promesa.Explicacion()
         }
 
-        columnas := []string{
-            "clave_unica", "id_usuario", "id_tienda", "id_sucursal", "fecha_creacion", "fecha_entrega",
-            "subtotal", "descuento", "iva", "ieps", "total", "id_metodo_pago", "referencia_pago",
-            "direccion_entrega", "colonia_entrega", "cp_entrega", "ciudad_entrega", "estado_entrega",
-            "latitud_entrega", "longitud_entrega",
-            "estatus", "comentarios", "origen_pedido", "id_lista_precio",
-        }
-        placeholders := strings.Repeat("?,", len(columnas))
-        placeholders = strings.TrimSuffix(placeholders, ",")
-
-        query := fmt.Sprintf("INSERT INTO pedidos (%s) VALUES (%s)", strings.Join(columnas, ","), placeholders)
-
-        valores := []interface{}{
-            fmt.Sprintf("PED-%d", now.UnixNano()),
-            req.IDUsuario,
-            req.IDTienda,
-            req.IDSucursal,
-            now.Format("2006-01-02 15:04:05"),
-            NullTimeToStrOrNil(req.FechaEntrega),
-            0.0, 0.0, 0.0, 0.0, 0.0,
-            req.IDMetodoPago,
-            NullToStrOrNil(req.ReferenciaPago),
-            req.DireccionEntrega,
-            req.ColoniaEntrega,
-            req.CPEntrega,
-            req.CiudadEntrega,
-            req.EstadoEntrega,
-            req.LatitudEntrega,
-            req.LongitudEntrega,
-            "pendiente",
-            NullToStrOrNil(req.Comentarios),
-            req.OrigenPedido,
-            1,
-        }
-
-        if len(columnas) != len(valores) {
-            errMsg := fmt.Sprintf("Columnas y valores no coinciden: columnas=%d, valores=%d\nColumnas: %v\nValores: %v", len(columnas), len(valores), columnas, valores)
-            writeErrorResponse(w, http.StatusInternalServerError, "Error interno: columnas y valores no coinciden", errMsg)
-            tx.Rollback()
-            return
+        pedido := &repositorio.NuevoPedido{
+            IDEmpresa:        idEmpresa,
+            ClaveUnica:       fmt.Sprintf("PED-%d", now.UnixNano()),
+            IDUsuario:        req.IDUsuario,
+            IDTienda:         req.IDTienda,
+            IDSucursal:       req.IDSucursal,
+            FechaCreacion:    now,
+            FechaEntrega:     req.FechaEntrega,
+            IDMetodoPago:     req.IDMetodoPago,
+            ReferenciaPago:   req.ReferenciaPago,
+            DireccionEntrega: req.DireccionEntrega,
+            ColoniaEntrega:   req.ColoniaEntrega,
+            CPEntrega:        req.CPEntrega,
+            CiudadEntrega:    req.CiudadEntrega,
+            EstadoEntrega:    req.EstadoEntrega,
+            LatitudEntrega:   req.LatitudEntrega,
+            LongitudEntrega:  req.LongitudEntrega,
+            Estatus:          "pendiente",
+            Comentarios:      req.Comentarios,
+            OrigenPedido:     req.OrigenPedido,
+            IDListaPrecio:    1,
+            IDReserva:        req.IDReserva,
+            Peso:             peso,
+            ExplicacionEntrega: explicacion,
+            IDDireccion:      req.IDDireccion,
         }
 
-        result, err := tx.Exec(query, valores...)
-        if err != nil {
-            detalle := fmt.Sprintf("QUERY: %s\nColumnas: %v\nValores: %v\nError: %s", query, columnas, valores, err.Error())
-            writeErrorResponse(w, http.StatusInternalServerError, "Error al crear el pedido", detalle)
-            tx.Rollback()
-            return
-        }
-
-        idPedido, _ := result.LastInsertId()
-        var subtotal, totalDescuento, totalIVA, totalIEPS, total float64
-
-        stmt, err := tx.Prepare(`
-            INSERT INTO detalle_pedidos (
-                id_pedido, id_producto, clave_producto, descripcion, unidad, cantidad,
-                precio_unitario, porcentaje_descuento, importe_descuento, subtotal,
-                importe_iva, importe_ieps, total, latitud_entrega, longitud_entrega, estatus, comentarios, fecha_registro
-            ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-        `)
-        if err != nil {
-            tx.Rollback()
-            writeErrorResponse(w, http.StatusInternalServerError, "Error al preparar el statement de detalle", err.Error())
-            return
-        }
-        defer stmt.Close()
-
         for _, d := range req.Detalles {
-            if d.PrecioUnitario <= 0 || d.Cantidad <= 0 {
-                tx.Rollback()
-                writeErrorResponse(w, http.StatusBadRequest, "Precio o cantidad no válida", "Precio y cantidad deben ser mayores a 0")
-                return
-            }
-
-            // Consulta el IVA y suma de IEPS desde la base
-            var porcentajeIVA, porcentajeIEPS float64
-            err := dbc.Local.QueryRow(`
-                SELECT IFNULL(i.iva, 0), IFNULL(i.ieps1, 0) + IFNULL(i.ieps2, 0) + IFNULL(i.ieps3, 0)
-                FROM crm_productos p
-                LEFT JOIN crm_impuestos i ON p.idiva = i.idiva
-                WHERE p.idproducto = ?
-            `, d.IDProducto).Scan(&porcentajeIVA, &porcentajeIEPS)
+            // IVA y suma de IEPS del catálogo
+            impuestos, err := repos.Productos.Impuestos(r.Context(), idEmpresa, d.IDProducto)
             if err != nil {
-                tx.Rollback()
-                writeErrorResponse(w, http.StatusInternalServerError, "No se pudo obtener impuestos del producto", err.Error())
+                errores.Escribir(w, r, errores.Interno("No se pudo obtener impuestos del producto", err))
                 return
             }
 
             // Calcular precio neto (precio original sin IVA/IEPS)
             precioConIVA := d.PrecioUnitario // Si te llega con IVA, hay que sacar el neto
-            precioNeto := precioConIVA / (1 + (porcentajeIVA/100) + (porcentajeIEPS/100))
+            precioNeto := precioConIVA / (1 + (impuestos.IVA/100) + (impuestos.IEPS/100))
             subt := precioNeto * d.Cantidad
             importeDescuento := d.ImporteDescuento
             porcentajeDescuento := d.PorcentajeDescuento
             if porcentajeDescuento > 0 {
                 importeDescuento = subt * (porcentajeDescuento / 100)
             }
-            ivaImporte := subt * (porcentajeIVA / 100)
-            iepsImporte := subt * (porcentajeIEPS / 100)
+            ivaImporte := subt * (impuestos.IVA / 100)
+            iepsImporte := subt * (impuestos.IEPS / 100)
             tot := subt - importeDescuento + ivaImporte + iepsImporte
 
-            _, err = stmt.Exec(
-                idPedido,
-                d.IDProducto,
-                d.ClaveProducto,
-                d.Descripcion,
-                d.Unidad,
-                d.Cantidad,
-                precioNeto, // <--- precio_unitario: el precio SIN IVA/IEPS
-                porcentajeDescuento,
-                importeDescuento,
-                subt,
-                ivaImporte,
-                iepsImporte,
-                tot,
-                d.LatitudEntrega,
-                d.LongitudEntrega,
-                "solicitado",
-                d.Comentarios,
-                now.Format("2006-01-02 15:04:05"),
-            )
-            if err != nil {
-                tx.Rollback()
-                writeErrorResponse(w, http.StatusInternalServerError, "Error al insertar detalle", err.Error())
-                return
-            }
-            subtotal += subt
-            totalDescuento += importeDescuento
-            totalIVA += ivaImporte
-            totalIEPS += iepsImporte
-            total += tot
+            pedido.Detalles = append(pedido.Detalles, repositorio.NuevoDetalle{
+                IDProducto:          d.IDProducto,
+                ClaveProducto:       d.ClaveProducto,
+                Descripcion:         d.Descripcion,
+                Unidad:              d.Unidad,
+                Cantidad:            d.Cantidad,
+                PrecioUnitario:      precioNeto, // <--- precio_unitario: el precio SIN IVA/IEPS
+                PorcentajeDescuento: porcentajeDescuento,
+                ImporteDescuento:    importeDescuento,
+                Subtotal:            subt,
+                ImporteIVA:          ivaImporte,
+                ImporteIEPS:         iepsImporte,
+                Total:               tot,
+                LatitudEntrega:      d.LatitudEntrega,
+                LongitudEntrega:     d.LongitudEntrega,
+                Estatus:             "solicitado",
+                Comentarios:         d.Comentarios,
+            })
+            pedido.Subtotal += subt
+            pedido.Descuento += importeDescuento
+            pedido.IVA += ivaImporte
+            pedido.IEPS += iepsImporte
+            pedido.Total += tot
         }
 
-        _, err = tx.Exec(`
-            UPDATE pedidos SET
-                subtotal = ?, descuento = ?, iva = ?, ieps = ?, total = ?
-            WHERE id_pedido = ?
-        `, subtotal, totalDescuento, totalIVA, totalIEPS, total, idPedido)
+        // Guarda cabecera, detalles e indicadores diarios/mensuales en una transacción
+        idPedido, err := repos.Pedidos.Crear(r.Context(), pedido)
         if err != nil {
-            tx.Rollback()
-            writeErrorResponse(w, http.StatusInternalServerError, "Error al actualizar el pedido", err.Error())
-            return
-        }
-
-        // Indicadores diarios/mensuales
-        fechaStr := now.Format("2006-01-02 15:04:05")
-        if err := AcumulaIndicadores(tx, total, req.IDUsuario, fechaStr); err != nil {
-            tx.Rollback()
-            writeErrorResponse(w, http.StatusInternalServerError, "Error al actualizar indicadores diarios/mensuales", err.Error())
-            return
-        }
-
-        if err := tx.Commit(); err != nil {
-            tx.Rollback()
-            writeErrorResponse(w, http.StatusInternalServerError, "Error al confirmar el pedido", err.Error())
+            if apartadoAqui {
+                // Que el lugar no quede ocupado hasta que venza el apartado
+                _ = repos.Entregas.Liberar(context.WithoutCancel(r.Context()), idEmpresa, req.IDUsuario, req.IDReserva)
+            }
+            if errors.Is(err, repositorio.ErrReservaVencida) {
+                errores.Escribir(w, r, errores.Nuevo(errores.ReservaVencida))
+                return
+            }
+            errores.Escribir(w, r, errores.Interno("Error al crear el pedido", err))
             return
         }
+        metricas.PedidoCreado(req.IDSucursal, pedido.Total)
+        trazas.RegistrarOrigenPedido(idPedido, trace.SpanContextFromContext(r.Context()))
+        bitacora.Desde(r.Context()).Info("pedido creado",
+            "id_pedido", idPedido, "clave_unica", pedido.ClaveUnica,
+            "id_sucursal", req.IDSucursal, "total", round(pedido.Total, 2))
 
         writeSuccessResponse(w, "Pedido creado exitosamente", map[string]interface{}{
             "id_pedido":    idPedido,
-            "total":        round(total, 2),
+            "total":        round(pedido.Total, 2),
             "fecha_entrega": NullTimeToStrMes(req.FechaEntrega),
+            "explicacion_entrega": explicacion,
         })
     }
 }
\ No newline at end of file
@@ -0,0 +1,375 @@
+package rutas
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	middlewares "github.com/WolfSlayer04/logica_tiendaenlina/Middleware"
+	"github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+	"github.com/WolfSlayer04/logica_tiendaenlina/feriados"
+	"github.com/WolfSlayer04/logica_tiendaenlina/reloj"
+	"github.com/WolfSlayer04/logica_tiendaenlina/repositorio"
+)
+
+// respuestaExito decodifica una SuccessResponse cuyo Data es un objeto.
+func respuestaExito(t *testing.T, rec *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var resp struct {
+		Message string                 `json:"message"`
+		Data    map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("respuesta no es JSON: %v", err)
+	}
+	return resp.Data
+}
+
+// conEmpresa simula la empresa que resolvió empresas.Middleware.
+func conEmpresa(r *http.Request, idEmpresa int) *http.Request {
+	return r.WithContext(empresas.Con(r.Context(), idEmpresa))
+}
+
+// conSesion corre h con la sesión que deja JWTAuthMiddleware.
+func conSesion(h http.HandlerFunc, idUsuario int, tipo string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), middlewares.ContextUserIDKey, idUsuario)
+		h(w, r.WithContext(context.WithValue(ctx, middlewares.ContextTipoKey, tipo)))
+	}
+}
+
+// conReloj corre h con el reloj r, como lo deja reloj.Middleware.
+func conReloj(h http.HandlerFunc, r reloj.Reloj) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		h(w, req.WithContext(reloj.Con(req.Context(), r)))
+	}
+}
+
+// hoy es el día en curso en la zona del negocio.
+func hoy() time.Time {
+	return reloj.Desde(context.Background()).Ahora()
+}
+
+func memoriaConCatalogo() *repositorio.Memoria {
+	m := repositorio.NuevaMemoria()
+	m.Empresas = []repositorio.EmpresaMemoria{{IDEmpresa: 1, Activa: true}}
+	m.Sucursales = []repositorio.SucursalMemoria{
+		{IDSucursal: 7, IDEmpresa: 1, Nombre: "Norte", Activa: true},
+		{IDSucursal: 3, IDEmpresa: 1, Nombre: "Centro", Activa: true},
+		{IDSucursal: 1, IDEmpresa: 1, Nombre: "Cerrada", Activa: false},
+	}
+	m.Productos[10] = repositorio.ProductoMemoria{IDEmpresa: 1, Impuestos: repositorio.Impuestos{IVA: 16}}
+	m.Productos[20] = repositorio.ProductoMemoria{IDEmpresa: 1, Impuestos: repositorio.Impuestos{IVA: 16, IEPS: 8}}
+	return m
+}
+
+func TestCreatePedido(t *testing.T) {
+	m := memoriaConCatalogo()
+	// La sucursal asignada (3) entrega desde las 07:30; la empresa, desde las 10:00
+	m.ConfigEntregaJSON[repositorio.ClaveConfigEntrega{IDEmpresa: 1}] = []byte(`{"horarios_entrega": [{"inicio": "10:00", "fin": "14:00"}]}`)
+	m.ConfigEntregaJSON[repositorio.ClaveConfigEntrega{IDEmpresa: 1, IDSucursal: 3}] = []byte(`{"horarios_entrega": [{"inicio": "07:30", "fin": "11:00"}]}`)
+	h := CreatePedido(m.Repositorios())
+
+	body := `{
+		"id_usuario": 5, "id_tienda": 9, "id_metodo_pago": 1, "origen_pedido": "web",
+		"detalles": [
+			{"id_producto": 10, "descripcion": "Refresco", "cantidad": 2, "precio_unitario": 116},
+			{"id_producto": 20, "descripcion": "Botana", "cantidad": 1, "precio_unitario": 124, "porcentaje_descuento": 10}
+		]
+	}`
+	rec := httptest.NewRecorder()
+	h(rec, conEmpresa(httptest.NewRequest(http.MethodPost, "/api/pedidos", strings.NewReader(body)), 1))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	data := respuestaExito(t, rec)
+	if len(m.Pedidos) != 1 {
+		t.Fatalf("se guardaron %d pedidos, se esperaba 1", len(m.Pedidos))
+	}
+	guardado := m.Pedidos[int64(data["id_pedido"].(float64))]
+	if guardado == nil {
+		t.Fatalf("id_pedido %v no está en el repositorio", data["id_pedido"])
+	}
+	p := guardado.Pedido
+
+	if p.IDSucursal != 3 {
+		t.Errorf("IDSucursal = %d, se esperaba la primera activa (3)", p.IDSucursal)
+	}
+	if !p.FechaEntrega.Valid {
+		t.Error("sin fecha_entrega debe calcularse con la configuración de entregas")
+	} else if hora := p.FechaEntrega.Time.Format("15:04"); hora != "07:30" {
+		t.Errorf("fecha_entrega a las %s, se esperaba el horario de la sucursal (07:30)", hora)
+	}
+	if p.Estatus != "pendiente" || !strings.HasPrefix(p.ClaveUnica, "PED-") {
+		t.Errorf("estatus/clave = %q/%q", p.Estatus, p.ClaveUnica)
+	}
+	if len(p.Detalles) != 2 {
+		t.Fatalf("detalles = %d, se esperaban 2", len(p.Detalles))
+	}
+
+	// Renglón 1: 116 con IVA 16% -> neto 100 x 2
+	d := p.Detalles[0]
+	if !casiIgual(d.PrecioUnitario, 100) || !casiIgual(d.Subtotal, 200) || !casiIgual(d.ImporteIVA, 32) || !casiIgual(d.Total, 232) {
+		t.Errorf("renglón 1 = %+v", d)
+	}
+	// Renglón 2: 124 con IVA 16% + IEPS 8% -> neto 100, descuento 10%
+	d = p.Detalles[1]
+	if !casiIgual(d.PrecioUnitario, 100) || !casiIgual(d.ImporteDescuento, 10) || !casiIgual(d.ImporteIEPS, 8) || !casiIgual(d.Total, 114) {
+		t.Errorf("renglón 2 = %+v", d)
+	}
+	if d.Estatus != "solicitado" {
+		t.Errorf("estatus del detalle = %q", d.Estatus)
+	}
+
+	if !casiIgual(p.Subtotal, 300) || !casiIgual(p.Descuento, 10) || !casiIgual(p.Total, 346) {
+		t.Errorf("totales = subtotal %v, descuento %v, total %v", p.Subtotal, p.Descuento, p.Total)
+	}
+	if data["total"].(float64) != 346 {
+		t.Errorf("total en respuesta = %v", data["total"])
+	}
+	if data["fecha_entrega"] == "" {
+		t.Error("la respuesta no trae fecha_entrega")
+	}
+	if acumulado := m.IndicadoresDiarios[p.FechaCreacion.Format("2006-01-02")]; !casiIgual(acumulado, 346) {
+		t.Errorf("indicador diario = %v", acumulado)
+	}
+}
+
+func TestCreatePedidoRechazos(t *testing.T) {
+	casos := []struct {
+		nombre string
+		body   string
+		falla  error
+		status int
+		codigo errores.Codigo
+		campos []string
+	}{
+		{
+			nombre: "json inválido",
+			body:   `{"id_usuario": `,
+			status: http.StatusBadRequest,
+			codigo: errores.JSONInvalido,
+		},
+		{
+			nombre: "faltan campos",
+			body:   `{"id_usuario": 5, "detalles": [{"id_producto": 10, "cantidad": 1, "precio_unitario": 10}]}`,
+			status: http.StatusBadRequest,
+			codigo: errores.ValidacionFallida,
+			campos: []string{"id_tienda", "id_metodo_pago"},
+		},
+		{
+			nombre: "sin detalles",
+			body:   `{"id_usuario": 5, "id_tienda": 9, "id_metodo_pago": 1, "detalles": []}`,
+			status: http.StatusBadRequest,
+			codigo: errores.ValidacionFallida,
+			campos: []string{"detalles"},
+		},
+		{
+			nombre: "cantidad cero",
+			body:   `{"id_usuario": 5, "id_tienda": 9, "id_metodo_pago": 1, "detalles": [{"id_producto": 10, "cantidad": 0, "precio_unitario": 10}]}`,
+			status: http.StatusBadRequest,
+			codigo: errores.ValidacionFallida,
+			campos: []string{"detalles[0].cantidad"},
+		},
+		{
+			nombre: "código postal inválido",
+			body:   `{"id_usuario": 5, "id_tienda": 9, "id_metodo_pago": 1, "cp_entrega": "9700", "detalles": [{"id_producto": 10, "cantidad": 1, "precio_unitario": 10}]}`,
+			status: http.StatusBadRequest,
+			codigo: errores.ValidacionFallida,
+			campos: []string{"cp_entrega"},
+		},
+		{
+			nombre: "campo desconocido",
+			body:   `{"id_usuario": 5, "id_tienda": 9, "id_metodo_pago": 1, "cupon": "X", "detalles": [{"id_producto": 10, "cantidad": 1, "precio_unitario": 10}]}`,
+			status: http.StatusBadRequest,
+			codigo: errores.ValidacionFallida,
+			campos: []string{"cupon"},
+		},
+		{
+			nombre: "producto sin impuestos",
+			body:   `{"id_usuario": 5, "id_tienda": 9, "id_metodo_pago": 1, "detalles": [{"id_producto": 99, "cantidad": 1, "precio_unitario": 10}]}`,
+			status: http.StatusInternalServerError,
+			codigo: errores.ErrorInterno,
+		},
+		{
+			nombre: "falla al guardar",
+			body:   `{"id_usuario": 5, "id_tienda": 9, "id_metodo_pago": 1, "detalles": [{"id_producto": 10, "cantidad": 1, "precio_unitario": 10}]}`,
+			falla:  errors.New("conexión perdida"),
+			status: http.StatusInternalServerError,
+			codigo: errores.ErrorInterno,
+		},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			m := memoriaConCatalogo()
+			m.Falla = func(op string) error {
+				if op == "Pedidos.Crear" {
+					return c.falla
+				}
+				return nil
+			}
+			rec := httptest.NewRecorder()
+			CreatePedido(m.Repositorios())(rec, conEmpresa(httptest.NewRequest(http.MethodPost, "/api/pedidos", strings.NewReader(c.body)), 1))
+			if rec.Code != c.status {
+				t.Errorf("status = %d, se esperaba %d (body %s)", rec.Code, c.status, rec.Body)
+			}
+			if c.falla != nil && strings.Contains(rec.Body.String(), c.falla.Error()) {
+				t.Errorf("el detalle interno llegó al cliente: %s", rec.Body)
+			}
+			var resp errores.Respuesta
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("respuesta no es JSON: %v", err)
+			}
+			if resp.Error.Codigo != c.codigo {
+				t.Errorf("code = %s, se esperaba %s", resp.Error.Codigo, c.codigo)
+			}
+			var campos []string
+			for _, f := range resp.Error.Campos {
+				campos = append(campos, f.Campo)
+			}
+			if strings.Join(campos, ",") != strings.Join(c.campos, ",") {
+				t.Errorf("fields = %v, se esperaba %v", campos, c.campos)
+			}
+			if len(m.Pedidos) != 0 {
+				t.Errorf("no debía guardarse ningún pedido, hay %d", len(m.Pedidos))
+			}
+		})
+	}
+}
+
+func TestObtenerConfigEntrega(t *testing.T) {
+	m := repositorio.NuevaMemoria()
+	m.ConfigEntregaJSON[repositorio.ClaveConfigEntrega{IDEmpresa: 1}] = []byte(`{"tiempo_procesamiento": 4, "dias_habiles": ["LUNES", "MIERCOLES"]}`)
+	m.ConfigEntregaJSON[repositorio.ClaveConfigEntrega{IDEmpresa: 1, IDSucursal: 7}] = []byte(`{"dias_habiles": ["SABADO"], "reglas_fin_semana": {"procesar_sabado": true, "dias_adicionales_sabado": 0}}`)
+	sucursales := m.Repositorios().Sucursales
+
+	casos := []struct {
+		nombre            string
+		empresa, sucursal int
+		tiempo            int
+		dias              string
+		horarios          int
+		diasSabado        int
+	}{
+		{nombre: "sin configuración", empresa: 2, tiempo: 2, dias: "LUNES,MARTES,MIERCOLES,JUEVES,VIERNES", horarios: 2, diasSabado: 1},
+		{nombre: "empresa", empresa: 1, tiempo: 4, dias: "LUNES,MIERCOLES", horarios: 2, diasSabado: 1},
+		{nombre: "sucursal sin configuración hereda la empresa", empresa: 1, sucursal: 3, tiempo: 4, dias: "LUNES,MIERCOLES", horarios: 2, diasSabado: 1},
+		{nombre: "sucursal cambia sólo lo que trae", empresa: 1, sucursal: 7, tiempo: 4, dias: "SABADO", horarios: 2, diasSabado: 0},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			config, err := ObtenerConfigEntrega(context.Background(), sucursales, c.empresa, c.sucursal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.TiempoProcesamiento != c.tiempo || strings.Join(config.DiasHabiles, ",") != c.dias ||
+				len(config.HorariosEntrega) != c.horarios || config.ReglasFindeSemana.DiasAdicionalesSabado != c.diasSabado {
+				t.Errorf("config = %+v", config)
+			}
+		})
+	}
+
+	m.Falla = func(string) error { return errors.New("sin conexión") }
+	if _, err := ObtenerConfigEntrega(context.Background(), sucursales, 1, 7); err == nil {
+		t.Error("se esperaba el error del repositorio")
+	}
+}
+
+func TestCalendarioEntrega(t *testing.T) {
+	m := repositorio.NuevaMemoria()
+	m.ConfigEntregaJSON[repositorio.ClaveConfigEntrega{IDEmpresa: 1}] = []byte(`{"tiempo_procesamiento": 1, "dias_habiles": ["LUNES", "MARTES", "MIERCOLES", "JUEVES", "VIERNES"],
+		"dias_feriados": [{"fecha": "2026-02-03 00:00:00", "dias_adicionales": 0}]}`)
+	m.ConfigEntregaJSON[repositorio.ClaveConfigEntrega{IDEmpresa: 1, IDSucursal: 3}] = []byte(`{"feriados_oficiales": false}`)
+	m.Feriados = []repositorio.FeriadoMemoria{
+		{IDEmpresa: 1, Feriado: feriados.Feriado{ID: 1, Fecha: time.Date(2020, time.February, 4, 0, 0, 0, 0, time.UTC), Nombre: "Aniversario", Recurrente: true}},
+		{IDEmpresa: 1, Feriado: feriados.Feriado{ID: 2, Fecha: time.Date(2026, time.February, 5, 0, 0, 0, 0, time.UTC), Nombre: "Inventario", IDSucursal: 7}},
+		{IDEmpresa: 2, Feriado: feriados.Feriado{ID: 3, Fecha: time.Date(2026, time.February, 6, 0, 0, 0, 0, time.UTC), Nombre: "Otra empresa"}},
+	}
+	sucursales := m.Repositorios().Sucursales
+
+	// Viernes; el lunes 2 es el día de la Constitución, el 3 viene de
+	// dias_feriados y el 4 es el aniversario de cada año
+	pedido := time.Date(2026, time.January, 30, 10, 0, 0, 0, time.Local)
+	casos := []struct {
+		nombre     string
+		idSucursal int
+		entrega    string
+	}{
+		{nombre: "empresa", entrega: "2026-02-05"},
+		{nombre: "cierre de la sucursal", idSucursal: 7, entrega: "2026-02-06"},
+		{nombre: "sin feriados oficiales", idSucursal: 3, entrega: "2026-02-02"},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			config, err := ObtenerConfigEntrega(context.Background(), sucursales, 1, c.idSucursal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := CalcularFechaEntrega(pedido, config).Format("2006-01-02"); got != c.entrega {
+				t.Errorf("entrega = %s, se esperaba %s", got, c.entrega)
+			}
+		})
+	}
+
+	// Sin calendario (configuración armada a mano) cuentan dias_feriados y los oficiales
+	config := configEntregaPorDefecto()
+	config.DiasFeriados = []DiaFeriado{{Fecha: "2026-02-03", DiasAdicionales: 2}}
+	if feriado, dias := esDiaFeriado(time.Date(2026, time.February, 3, 9, 0, 0, 0, time.Local), config); !feriado || dias != 2 {
+		t.Errorf("dias_feriados: %v %d", feriado, dias)
+	}
+	if feriado, _ := esDiaFeriado(time.Date(2026, time.February, 2, 9, 0, 0, 0, time.Local), config); !feriado {
+		t.Error("el primer lunes de febrero es feriado oficial")
+	}
+}
+
+func TestCalcularPromesaEntrega(t *testing.T) {
+	config, err := combinarConfigEntrega([]byte(`{"dias_habiles": ["LUNES", "MARTES", "MIERCOLES", "JUEVES", "VIERNES"],
+		"hora_corte": "14:00", "mismo_dia_antes_de": "10:00"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frescos := TiempoCategoria{IDCategoria: 7, Nombre: "Frescos", DiasAdicionales: 1}
+	revolucion := "feriado 16/11 (Día de la Revolución)"
+
+	// Del jueves 12 de noviembre de 2026; el lunes 16 es feriado
+	casos := []struct {
+		nombre      string
+		pedido      time.Time
+		categoria   TiempoCategoria
+		entrega     string
+		explicacion string
+	}{
+		{nombre: "mismo día", pedido: time.Date(2026, 11, 12, 8, 0, 0, 0, time.UTC), entrega: "2026-11-12 09:00",
+			explicacion: "pedido antes de las 10:00: entrega el mismo día"},
+		{nombre: "mismo día, ya empezó la mañana", pedido: time.Date(2026, 11, 12, 9, 30, 0, 0, time.UTC), entrega: "2026-11-12 13:00",
+			explicacion: "pedido antes de las 10:00: entrega el mismo día"},
+		{nombre: "frescos no salen el mismo día", pedido: time.Date(2026, 11, 12, 8, 0, 0, 0, time.UTC), categoria: frescos, entrega: "2026-11-18 09:00",
+			explicacion: "2 días hábiles + Frescos +1 día + " + revolucion},
+		{nombre: "antes del corte", pedido: time.Date(2026, 11, 12, 11, 0, 0, 0, time.UTC), entrega: "2026-11-17 09:00",
+			explicacion: "2 días hábiles + " + revolucion},
+		{nombre: "después del corte", pedido: time.Date(2026, 11, 12, 23, 59, 0, 0, time.UTC), entrega: "2026-11-18 09:00",
+			explicacion: "pedido después de las 14:00 + 2 días hábiles + " + revolucion},
+		{nombre: "sábado", pedido: time.Date(2026, 11, 14, 8, 0, 0, 0, time.UTC), entrega: "2026-11-19 09:00",
+			explicacion: "2 días hábiles + sábado +1 día + " + revolucion},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			p := CalcularPromesaEntrega(c.pedido, config, c.categoria)
+			if got := p.Fecha.Format("2006-01-02 15:04"); got != c.entrega || p.Explicacion() != c.explicacion {
+				t.Errorf("entrega = %s (%s), se esperaba %s (%s)", got, p.Explicacion(), c.entrega, c.explicacion)
+			}
+		})
+	}
+}
+
+func casiIgual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
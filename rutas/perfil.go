@@ -1,40 +1,52 @@
 package rutas
 
 import (
-	"encoding/json"
 	"net/http"
+	"strconv"
+	middlewares "github.com/WolfSlayer04/logica_tiendaenlina/Middleware"
 	"github.com/WolfSlayer04/logica_tiendaenlina/db"
+	"github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+	"github.com/WolfSlayer04/logica_tiendaenlina/validacion"
 	
 )
 
 // ---------- RESPUESTA PERFIL (usuario + tiendas asociadas + pedidos) ----------
 
+// El cliente sólo ve su perfil; id_usuario sólo lo indica un admin.
 func GetPerfilUsuario(dbc *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
 		idUsuario := r.URL.Query().Get("id_usuario")
+		if id, tipo, _, _, _ := middlewares.GetUserFromContext(r); tipo == "C" {
+			idUsuario = strconv.Itoa(id)
+		}
 		if idUsuario == "" {
-			writeErrorResponse(w, http.StatusBadRequest, "Falta el id_usuario", "")
+			errores.Escribir(w, r, errores.Validacion(errores.Requerido("id_usuario")))
 			return
 		}
 
 		// Info usuario
 		var u db.Usuario
-		err := dbc.Local.QueryRow(`
+		err := dbc.Local.QueryRowContext(r.Context(), `
 			SELECT id_usuario, id_empresa, tipo_usuario, nombre_completo, correo, telefono, estatus
-			FROM usuarios WHERE id_usuario = ? LIMIT 1
-		`, idUsuario).Scan(&u.IDUsuario, &u.IDEmpresa, &u.TipoUsuario, &u.NombreCompleto, &u.Correo, &u.Telefono, &u.Estatus)
+			FROM usuarios WHERE id_usuario = ? AND id_empresa = ? LIMIT 1
+		`, idUsuario, idEmpresa).Scan(&u.IDUsuario, &u.IDEmpresa, &u.TipoUsuario, &u.NombreCompleto, &u.Correo, &u.Telefono, &u.Estatus)
 		if err != nil {
-			writeErrorResponse(w, http.StatusNotFound, "Usuario no encontrado", err.Error())
+			errores.Escribir(w, r, errores.Nuevo(errores.UsuarioNoEncontrado).Con("Usuario no encontrado", err))
 			return
 		}
 
 		// Tiendas asociadas
-		rows, err := dbc.Local.Query(`
+		rows, err := dbc.Local.QueryContext(r.Context(), `
 			SELECT id_tienda, nombre_tienda, razon_social, rfc, direccion, colonia, codigo_postal, ciudad, estado, pais, tipo_tienda, estatus
-			FROM tiendas WHERE id_usuario = ?
-		`, idUsuario)
+			FROM tiendas WHERE id_usuario = ? AND id_empresa = ?
+		`, idUsuario, idEmpresa)
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "Error al obtener tiendas", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error al obtener tiendas", err))
 			return
 		}
 		defer rows.Close()
@@ -56,7 +68,7 @@ func GetPerfilUsuario(dbc *db.DBConnection) http.HandlerFunc {
 			}
 			err := rows.Scan(&t.IDTienda, &t.NombreTienda, &t.RazonSocial, &t.RFC, &t.Direccion, &t.Colonia, &t.CodigoPostal, &t.Ciudad, &t.Estado, &t.Pais, &t.TipoTienda, &t.Estatus)
 			if err != nil {
-				writeErrorResponse(w, http.StatusInternalServerError, "Error al leer tienda", err.Error())
+				errores.Escribir(w, r, errores.Interno("Error al leer tienda", err))
 				return
 			}
 			tiendas = append(tiendas, map[string]interface{}{
@@ -77,9 +89,9 @@ func GetPerfilUsuario(dbc *db.DBConnection) http.HandlerFunc {
 
 		// Contar pedidos realizados por el usuario
 		var totalPedidos int
-		err = dbc.Local.QueryRow("SELECT COUNT(*) FROM pedidos WHERE id_usuario = ?", idUsuario).Scan(&totalPedidos)
+		err = dbc.Local.QueryRowContext(r.Context(), "SELECT COUNT(*) FROM pedidos WHERE id_usuario = ? AND id_empresa = ?", idUsuario, idEmpresa).Scan(&totalPedidos)
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "Error al contar pedidos", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error al contar pedidos", err))
 			return
 		}
 
@@ -93,16 +105,39 @@ func GetPerfilUsuario(dbc *db.DBConnection) http.HandlerFunc {
 
 // ---------- EDITAR USUARIO (nombre, teléfono, contraseña) ----------
 
+// El cliente sólo se edita a sí mismo; id_usuario sólo lo indica un admin.
 func EditarUsuario(dbc *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
 		var req struct {
 			IDUsuario      int    `json:"id_usuario"`
-			NombreCompleto string `json:"nombre_completo"`
-			Telefono       string `json:"telefono"`
-			ClaveNueva     string `json:"clave_nueva"`
+			NombreCompleto string `json:"nombre_completo" valida:"requerido"`
+			Telefono       string `json:"telefono" valida:"telefono"`
+			ClaveNueva     string `json:"clave_nueva" valida:"min=6"`
+		}
+		if err := validacion.Decodificar(w, r, &req); err != nil {
+			errores.Escribir(w, r, err)
+			return
+		}
+		if id, tipo, _, _, _ := middlewares.GetUserFromContext(r); tipo == "C" {
+			req.IDUsuario = id
+		}
+		if req.IDUsuario <= 0 {
+			errores.Escribir(w, r, errores.Validacion(errores.Requerido("id_usuario")))
+			return
 		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			writeErrorResponse(w, http.StatusBadRequest, "Datos inválidos", err.Error())
+		// Se busca antes: RowsAffected también es 0 si los datos no cambian
+		var existe int
+		err := dbc.Local.QueryRowContext(r.Context(), "SELECT COUNT(*) FROM usuarios WHERE id_usuario=? AND id_empresa=?", req.IDUsuario, idEmpresa).Scan(&existe)
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("No se pudo obtener el usuario", err))
+			return
+		}
+		if existe == 0 {
+			errores.Escribir(w, r, errores.Nuevo(errores.UsuarioNoEncontrado))
 			return
 		}
 		query := "UPDATE usuarios SET nombre_completo=?, telefono=?"
@@ -111,11 +146,11 @@ func EditarUsuario(dbc *db.DBConnection) http.HandlerFunc {
 			query += ", clave=?"
 			args = append(args, req.ClaveNueva)
 		}
-		query += " WHERE id_usuario=?"
-		args = append(args, req.IDUsuario)
-		_, err := dbc.Local.Exec(query, args...)
+		query += " WHERE id_usuario=? AND id_empresa=?"
+		args = append(args, req.IDUsuario, idEmpresa)
+		_, err = dbc.Local.ExecContext(r.Context(), query, args...)
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "No se pudo actualizar usuario", err.Error())
+			errores.Escribir(w, r, errores.Interno("No se pudo actualizar usuario", err))
 			return
 		}
 		writeSuccessResponse(w, "Usuario actualizado", nil)
@@ -124,27 +159,52 @@ func EditarUsuario(dbc *db.DBConnection) http.HandlerFunc {
 
 // ---------- ELIMINAR TIENDA (solo si el usuario queda con al menos 1 activa) ----------
 
+// El cliente sólo elimina sus tiendas; id_usuario sólo lo indica un admin.
 func EliminarTienda(dbc *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
 		idTienda := r.URL.Query().Get("id_tienda")
 		idUsuario := r.URL.Query().Get("id_usuario")
+		if id, tipo, _, _, _ := middlewares.GetUserFromContext(r); tipo == "C" {
+			idUsuario = strconv.Itoa(id)
+		}
 		if idTienda == "" || idUsuario == "" {
-			writeErrorResponse(w, http.StatusBadRequest, "Faltan parámetros", "")
+			var campos []errores.Campo
+			if idTienda == "" {
+				campos = append(campos, errores.Requerido("id_tienda"))
+			}
+			if idUsuario == "" {
+				campos = append(campos, errores.Requerido("id_usuario"))
+			}
+			errores.Escribir(w, r, errores.Validacion(campos...))
 			return
 		}
 		var count int
-		err := dbc.Local.QueryRow("SELECT COUNT(*) FROM tiendas WHERE id_usuario=? AND estatus='activo'", idUsuario).Scan(&count)
+		err := dbc.Local.QueryRowContext(r.Context(), "SELECT COUNT(*) FROM tiendas WHERE id_usuario=? AND id_empresa=? AND estatus='activo'", idUsuario, idEmpresa).Scan(&count)
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "Error al contar tiendas", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error al contar tiendas", err))
 			return
 		}
 		if count <= 1 {
-			writeErrorResponse(w, http.StatusBadRequest, "Debes tener al menos una tienda activa", "")
+			errores.Escribir(w, r, errores.Nuevo(errores.TiendaActivaRequerida))
+			return
+		}
+		res, err := dbc.Local.ExecContext(r.Context(), "UPDATE tiendas SET estatus='eliminado' WHERE id_tienda=? AND id_usuario=? AND id_empresa=? AND estatus='activo'", idTienda, idUsuario, idEmpresa)
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("No se pudo eliminar tienda", err))
+			return
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			errores.Escribir(w, r, errores.Nuevo(errores.TiendaNoEncontrada).Con("Tienda sin eliminar", err))
 			return
 		}
-		_, err = dbc.Local.Exec("UPDATE tiendas SET estatus='eliminado' WHERE id_tienda=? AND id_usuario=?", idTienda, idUsuario)
+		// Si era la activa, el usuario vuelve a trabajar con la primera
+		_, err = dbc.Local.ExecContext(r.Context(), "UPDATE usuarios SET id_tienda_activa=NULL WHERE id_usuario=? AND id_empresa=? AND id_tienda_activa=?", idUsuario, idEmpresa, idTienda)
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "No se pudo eliminar tienda", err.Error())
+			errores.Escribir(w, r, errores.Interno("No se pudo eliminar tienda", err))
 			return
 		}
 		writeSuccessResponse(w, "Tienda eliminada", nil)
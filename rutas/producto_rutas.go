@@ -1,6 +1,7 @@
 package rutas
 
 import (
+    "context"
     "database/sql"
     "encoding/json"
     "fmt"
@@ -9,6 +10,8 @@ import (
     "strings"
 
     "github.com/WolfSlayer04/logica_tiendaenlina/db"
+    "github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+    "github.com/WolfSlayer04/logica_tiendaenlina/errores"
     "github.com/gorilla/mux"
 )
 
@@ -111,64 +114,79 @@ func getPagination(r *http.Request) (limit, offset int) {
     return
 }
 
-// Utilidad para obtener lista de precios por usuario (CORREGIDO: adm_sucursales)
-func getListaPreciosPorUsuario(db *db.DBConnection, idUsuario int) (int, error) {
+// Utilidad para obtener lista de precios por usuario (CORREGIDO: adm_sucursales).
+// Sólo encuentra usuarios con tienda en la empresa.
+func getListaPreciosPorUsuario(ctx context.Context, db *db.DBConnection, idEmpresa, idUsuario int) (int, error) {
     var listaPrecios int
     query := `
         SELECT s.lista_precios
         FROM tiendas t
         JOIN adm_sucursales s ON t.idsucursal = s.idsucursal
-        WHERE t.id_usuario = ?
+        WHERE t.id_empresa = ? AND t.id_usuario = ?
     `
-    err := db.Local.QueryRow(query, idUsuario).Scan(&listaPrecios)
+    err := db.Local.QueryRowContext(ctx, query, idEmpresa, idUsuario).Scan(&listaPrecios)
     return listaPrecios, err
 }
 
+// consultarProductos regresa una página de productos activos de la empresa con
+// precio en la lista de la sucursal del usuario, y el total de ellos.
+func consultarProductos(ctx context.Context, db *db.DBConnection, idEmpresa, idUsuario, limit, offset int) ([]Producto, int, error) {
+    listaPrecios, err := getListaPreciosPorUsuario(ctx, db, idEmpresa, idUsuario)
+    if err != nil {
+        return nil, 0, fmt.Errorf("lista de precios del usuario %d: %w", idUsuario, err)
+    }
+    query := fmt.Sprintf(`
+        SELECT p.idproducto, p.descripcion, p.precio%d, p.estatus, c.categoria
+        FROM crm_productos p
+        LEFT JOIN categorias c ON p.idcategoria = c.idcategoria
+        WHERE p.idempresa = ? AND p.estatus = 'S' AND p.precio%d IS NOT NULL AND p.precio%d > 0
+        LIMIT ? OFFSET ?
+    `, listaPrecios, listaPrecios, listaPrecios)
+    rows, err := db.Local.QueryContext(ctx, query, idEmpresa, limit, offset)
+    if err != nil {
+        return nil, 0, err
+    }
+    defer rows.Close()
+    var productos []Producto
+    for rows.Next() {
+        var p Producto
+        if err := rows.Scan(&p.IDProducto, &p.Descripcion, &p.Precio, &p.Estatus, &p.Categoria); err != nil {
+            return nil, 0, err
+        }
+        productos = append(productos, p)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, 0, err
+    }
+    countQuery := fmt.Sprintf(`
+        SELECT COUNT(*) FROM crm_productos 
+        WHERE idempresa = ? AND estatus = 'S' AND precio%d IS NOT NULL AND precio%d > 0
+    `, listaPrecios, listaPrecios)
+    var total int
+    if err := db.Local.QueryRowContext(ctx, countQuery, idEmpresa).Scan(&total); err != nil {
+        return nil, 0, err
+    }
+    return productos, total, nil
+}
+
 // GetProductos obtiene productos paginados con estatus = 'S' y precio según sucursal/usuario
 func GetProductos(db *db.DBConnection) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
+        idEmpresa, ok := empresas.Requerida(w, r)
+        if !ok {
+            return
+        }
         w.Header().Set("Content-Type", "application/json")
         idUsuarioStr := r.URL.Query().Get("id_usuario")
         idUsuario, err := strconv.Atoi(idUsuarioStr)
         if err != nil {
-            http.Error(w, "ID de usuario inválido", http.StatusBadRequest)
-            return
-        }
-        listaPrecios, err := getListaPreciosPorUsuario(db, idUsuario)
-        if err != nil {
-            http.Error(w, "No se pudo obtener lista de precios", http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_usuario")).Con("ID de usuario inválido", err))
             return
         }
         limit, offset := getPagination(r)
-        query := fmt.Sprintf(`
-            SELECT p.idproducto, p.descripcion, p.precio%d, p.estatus, c.categoria
-            FROM crm_productos p
-            LEFT JOIN categorias c ON p.idcategoria = c.idcategoria
-            WHERE p.estatus = 'S' AND p.precio%d IS NOT NULL AND p.precio%d > 0
-            LIMIT ? OFFSET ?
-        `, listaPrecios, listaPrecios, listaPrecios)
-        rows, err := db.Local.Query(query, limit, offset)
+        productos, total, err := consultarProductos(r.Context(), db, idEmpresa, idUsuario, limit, offset)
         if err != nil {
-            http.Error(w, err.Error(), http.StatusInternalServerError)
-            return
-        }
-        defer rows.Close()
-        var productos []Producto
-        for rows.Next() {
-            var p Producto
-            if err := rows.Scan(&p.IDProducto, &p.Descripcion, &p.Precio, &p.Estatus, &p.Categoria); err != nil {
-                http.Error(w, err.Error(), http.StatusInternalServerError)
-                return
-            }
-            productos = append(productos, p)
-        }
-        countQuery := fmt.Sprintf(`
-            SELECT COUNT(*) FROM crm_productos 
-            WHERE estatus = 'S' AND precio%d IS NOT NULL AND precio%d > 0
-        `, listaPrecios, listaPrecios)
-        var total int
-        if err := db.Local.QueryRow(countQuery).Scan(&total); err != nil {
-            http.Error(w, err.Error(), http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("Error al obtener productos", err))
             return
         }
         json.NewEncoder(w).Encode(map[string]interface{}{
@@ -178,26 +196,102 @@ func GetProductos(db *db.DBConnection) http.HandlerFunc {
     }
 }
 
+// ProductoV2 es el producto de /api/v2/productos: "id" en lugar de
+// "idproducto", precio siempre presente (la consulta descarta los que no
+// tienen) y sin estatus, que en el catálogo público siempre es 'S'.
+type ProductoV2 struct {
+    ID          int        `json:"id"`
+    Descripcion NullString `json:"descripcion"`
+    Precio      float64    `json:"precio"`
+    Categoria   NullString `json:"categoria"`
+}
+
+// Paginacion acompaña a las listas paginadas de v2.
+type Paginacion struct {
+    Pagina  int `json:"pagina"`
+    Limite  int `json:"limite"`
+    Total   int `json:"total"`
+    Paginas int `json:"paginas"`
+}
+
+// ProductosPaginaV2 es la respuesta de /api/v2/productos. data siempre es un
+// arreglo, vacío si la página no trae productos.
+type ProductosPaginaV2 struct {
+    Data       []ProductoV2 `json:"data"`
+    Paginacion Paginacion   `json:"paginacion"`
+}
+
+// limiteMaximoV2 acota el tamaño de página en v2.
+const limiteMaximoV2 = 100
+
+// GetProductosV2 es GetProductos con la forma de respuesta de v2.
+func GetProductosV2(db *db.DBConnection) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        idEmpresa, ok := empresas.Requerida(w, r)
+        if !ok {
+            return
+        }
+        idUsuario, err := strconv.Atoi(r.URL.Query().Get("id_usuario"))
+        if err != nil {
+            errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_usuario")).Con("ID de usuario inválido", err))
+            return
+        }
+        limit, offset := getPagination(r)
+        pagina := offset/limit + 1
+        if limit > limiteMaximoV2 {
+            limit = limiteMaximoV2
+            offset = (pagina - 1) * limit
+        }
+        productos, total, err := consultarProductos(r.Context(), db, idEmpresa, idUsuario, limit, offset)
+        if err != nil {
+            errores.Escribir(w, r, errores.Interno("Error al obtener productos", err))
+            return
+        }
+        resp := ProductosPaginaV2{
+            Data: make([]ProductoV2, 0, len(productos)),
+            Paginacion: Paginacion{
+                Pagina:  pagina,
+                Limite:  limit,
+                Total:   total,
+                Paginas: (total + limit - 1) / limit,
+            },
+        }
+        for _, p := range productos {
+            resp.Data = append(resp.Data, ProductoV2{
+                ID:          p.IDProducto,
+                Descripcion: p.Descripcion,
+                Precio:      p.Precio.Float64,
+                Categoria:   p.Categoria,
+            })
+        }
+        RespondWithJSON(w, http.StatusOK, resp)
+    }
+}
+
 // GetProductosByCategoria obtiene productos filtrados por categoría y paginados y precio sucursal
 func GetProductosByCategoria(db *db.DBConnection) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
+        idEmpresa, ok := empresas.Requerida(w, r)
+        if !ok {
+            return
+        }
         w.Header().Set("Content-Type", "application/json")
         params := mux.Vars(r)
         catIDStr := params["idcategoria"]
         catID, err := strconv.Atoi(catIDStr)
         if err != nil {
-            http.Error(w, "ID de categoría inválido", http.StatusBadRequest)
+            errores.Escribir(w, r, errores.Validacion(errores.Invalido("idcategoria")).Con("ID de categoría inválido", err))
             return
         }
         idUsuarioStr := r.URL.Query().Get("id_usuario")
         idUsuario, err := strconv.Atoi(idUsuarioStr)
         if err != nil {
-            http.Error(w, "ID de usuario inválido", http.StatusBadRequest)
+            errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_usuario")).Con("ID de usuario inválido", err))
             return
         }
-        listaPrecios, err := getListaPreciosPorUsuario(db, idUsuario)
+        listaPrecios, err := getListaPreciosPorUsuario(r.Context(), db, idEmpresa, idUsuario)
         if err != nil {
-            http.Error(w, "No se pudo obtener lista de precios", http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("No se pudo obtener lista de precios", err))
             return
         }
         limit, offset := getPagination(r)
@@ -205,12 +299,12 @@ func GetProductosByCategoria(db *db.DBConnection) http.HandlerFunc {
             SELECT p.idproducto, p.descripcion, p.precio%d, p.estatus, c.categoria
             FROM crm_productos p
             LEFT JOIN categorias c ON p.idcategoria = c.idcategoria
-            WHERE p.idcategoria = ? AND p.estatus = 'S' AND p.precio%d IS NOT NULL AND p.precio%d > 0
+            WHERE p.idempresa = ? AND p.idcategoria = ? AND p.estatus = 'S' AND p.precio%d IS NOT NULL AND p.precio%d > 0
             LIMIT ? OFFSET ?
         `, listaPrecios, listaPrecios, listaPrecios)
-        rows, err := db.Local.Query(query, catID, limit, offset)
+        rows, err := db.Local.QueryContext(r.Context(), query, idEmpresa, catID, limit, offset)
         if err != nil {
-            http.Error(w, err.Error(), http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
             return
         }
         defer rows.Close()
@@ -218,18 +312,18 @@ func GetProductosByCategoria(db *db.DBConnection) http.HandlerFunc {
         for rows.Next() {
             var p Producto
             if err := rows.Scan(&p.IDProducto, &p.Descripcion, &p.Precio, &p.Estatus, &p.Categoria); err != nil {
-                http.Error(w, err.Error(), http.StatusInternalServerError)
+                errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
                 return
             }
             productos = append(productos, p)
         }
         countQuery := fmt.Sprintf(`
             SELECT COUNT(*) FROM crm_productos 
-            WHERE idcategoria = ? AND estatus = 'S' AND precio%d IS NOT NULL AND precio%d > 0
+            WHERE idempresa = ? AND idcategoria = ? AND estatus = 'S' AND precio%d IS NOT NULL AND precio%d > 0
         `, listaPrecios, listaPrecios)
         var total int
-        if err := db.Local.QueryRow(countQuery, catID).Scan(&total); err != nil {
-            http.Error(w, err.Error(), http.StatusInternalServerError)
+        if err := db.Local.QueryRowContext(r.Context(), countQuery, idEmpresa, catID).Scan(&total); err != nil {
+            errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
             return
         }
         json.NewEncoder(w).Encode(map[string]interface{}{
@@ -242,38 +336,42 @@ func GetProductosByCategoria(db *db.DBConnection) http.HandlerFunc {
 // GetProductoByID obtiene un producto por su ID, activo, y precio sucursal
 func GetProductoByID(db *db.DBConnection) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
+        idEmpresa, ok := empresas.Requerida(w, r)
+        if !ok {
+            return
+        }
         w.Header().Set("Content-Type", "application/json")
         params := mux.Vars(r)
         idStr := params["id"]
         id, err := strconv.Atoi(idStr)
         if err != nil {
-            http.Error(w, "ID inválido", http.StatusBadRequest)
+            errores.Escribir(w, r, errores.Validacion(errores.Invalido("id")).Con("ID inválido", err))
             return
         }
         idUsuarioStr := r.URL.Query().Get("id_usuario")
         idUsuario, err := strconv.Atoi(idUsuarioStr)
         if err != nil {
-            http.Error(w, "ID de usuario inválido", http.StatusBadRequest)
+            errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_usuario")).Con("ID de usuario inválido", err))
             return
         }
-        listaPrecios, err := getListaPreciosPorUsuario(db, idUsuario)
+        listaPrecios, err := getListaPreciosPorUsuario(r.Context(), db, idEmpresa, idUsuario)
         if err != nil {
-            http.Error(w, "No se pudo obtener lista de precios", http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("No se pudo obtener lista de precios", err))
             return
         }
         query := fmt.Sprintf(`
             SELECT p.idproducto, p.descripcion, p.precio%d, p.estatus, c.categoria
             FROM crm_productos p
             LEFT JOIN categorias c ON p.idcategoria = c.idcategoria
-            WHERE p.idproducto = ? AND p.estatus = 'S' AND p.precio%d IS NOT NULL AND p.precio%d > 0
+            WHERE p.idempresa = ? AND p.idproducto = ? AND p.estatus = 'S' AND p.precio%d IS NOT NULL AND p.precio%d > 0
         `, listaPrecios, listaPrecios, listaPrecios)
         var p Producto
-        err = db.Local.QueryRow(query, id).Scan(&p.IDProducto, &p.Descripcion, &p.Precio, &p.Estatus, &p.Categoria)
+        err = db.Local.QueryRowContext(r.Context(), query, idEmpresa, id).Scan(&p.IDProducto, &p.Descripcion, &p.Precio, &p.Estatus, &p.Categoria)
         if err == sql.ErrNoRows {
-            http.Error(w, "Producto no encontrado", http.StatusNotFound)
+            errores.Escribir(w, r, errores.Nuevo(errores.ProductoNoEncontrado))
             return
         } else if err != nil {
-            http.Error(w, err.Error(), http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
             return
         }
         json.NewEncoder(w).Encode(p)
@@ -283,22 +381,27 @@ func GetProductoByID(db *db.DBConnection) http.HandlerFunc {
 // GetCategorias obtiene todas las categorías con estatus = 'S', ordenadas alfabéticamente y con productos disponibles según sucursal
 func GetCategorias(db *db.DBConnection) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
+        idEmpresa, ok := empresas.Requerida(w, r)
+        if !ok {
+            return
+        }
         w.Header().Set("Content-Type", "application/json")
         idUsuarioStr := r.URL.Query().Get("id_usuario")
         idUsuario, err := strconv.Atoi(idUsuarioStr)
         if err != nil {
-            http.Error(w, "ID de usuario inválido", http.StatusBadRequest)
+            errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_usuario")).Con("ID de usuario inválido", err))
             return
         }
-        listaPrecios, err := getListaPreciosPorUsuario(db, idUsuario)
+        listaPrecios, err := getListaPreciosPorUsuario(r.Context(), db, idEmpresa, idUsuario)
         if err != nil {
-            http.Error(w, "No se pudo obtener lista de precios", http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("No se pudo obtener lista de precios", err))
             return
         }
         query := fmt.Sprintf(`
             SELECT c.idcategoria, c.categoria, c.estatus
             FROM categorias c
-            JOIN crm_productos p ON p.idcategoria = c.idcategoria 
+            JOIN crm_productos p ON p.idcategoria = c.idcategoria
+                AND p.idempresa = ?
                 AND p.estatus = 'S'
                 AND p.precio%d IS NOT NULL
                 AND p.precio%d > 0
@@ -307,9 +410,9 @@ func GetCategorias(db *db.DBConnection) http.HandlerFunc {
             HAVING COUNT(p.idproducto) > 0
             ORDER BY c.categoria ASC
         `, listaPrecios, listaPrecios)
-        rows, err := db.Local.Query(query)
+        rows, err := db.Local.QueryContext(r.Context(), query, idEmpresa)
         if err != nil {
-            http.Error(w, err.Error(), http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
             return
         }
         defer rows.Close()
@@ -317,7 +420,7 @@ func GetCategorias(db *db.DBConnection) http.HandlerFunc {
         for rows.Next() {
             var c Categoria
             if err := rows.Scan(&c.IDCategoria, &c.Categoria, &c.Estatus); err != nil {
-                http.Error(w, err.Error(), http.StatusInternalServerError)
+                errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
                 return
             }
             categorias = append(categorias, c)
@@ -329,25 +432,29 @@ func GetCategorias(db *db.DBConnection) http.HandlerFunc {
 // GetProductosConIVA obtiene productos paginados con estatus = 'S', su IVA, tipo_iva y precio final calculado según sucursal
 func GetProductosConIVA(db *db.DBConnection) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
+        idEmpresa, ok := empresas.Requerida(w, r)
+        if !ok {
+            return
+        }
         w.Header().Set("Content-Type", "application/json")
         idUsuarioStr := r.URL.Query().Get("id_usuario")
         idUsuario, err := strconv.Atoi(idUsuarioStr)
         if err != nil {
-            http.Error(w, "ID de usuario inválido", http.StatusBadRequest)
+            errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_usuario")).Con("ID de usuario inválido", err))
             return
         }
-        listaPrecios, err := getListaPreciosPorUsuario(db, idUsuario)
+        listaPrecios, err := getListaPreciosPorUsuario(r.Context(), db, idEmpresa, idUsuario)
         if err != nil {
-            http.Error(w, "No se pudo obtener lista de precios", http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("No se pudo obtener lista de precios", err))
             return
         }
         limit, offset := getPagination(r)
         countQuery := fmt.Sprintf(`
-            SELECT COUNT(*) FROM crm_productos WHERE estatus = 'S' AND precio%d IS NOT NULL AND precio%d > 0
+            SELECT COUNT(*) FROM crm_productos WHERE idempresa = ? AND estatus = 'S' AND precio%d IS NOT NULL AND precio%d > 0
         `, listaPrecios, listaPrecios)
         var total int
-        if err := db.Local.QueryRow(countQuery).Scan(&total); err != nil {
-            http.Error(w, err.Error(), http.StatusInternalServerError)
+        if err := db.Local.QueryRowContext(r.Context(), countQuery, idEmpresa).Scan(&total); err != nil {
+            errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
             return
         }
         query := fmt.Sprintf(`
@@ -356,12 +463,12 @@ func GetProductosConIVA(db *db.DBConnection) http.HandlerFunc {
             FROM crm_productos p
             LEFT JOIN categorias c ON p.idcategoria = c.idcategoria
             LEFT JOIN crm_impuestos i ON p.idiva = i.idiva
-            WHERE p.estatus = 'S' AND p.precio%d IS NOT NULL AND p.precio%d > 0
+            WHERE p.idempresa = ? AND p.estatus = 'S' AND p.precio%d IS NOT NULL AND p.precio%d > 0
             LIMIT ? OFFSET ?
         `, listaPrecios, listaPrecios, listaPrecios)
-        rows, err := db.Local.Query(query, limit, offset)
+        rows, err := db.Local.QueryContext(r.Context(), query, idEmpresa, limit, offset)
         if err != nil {
-            http.Error(w, err.Error(), http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
             return
         }
         defer rows.Close()
@@ -378,7 +485,7 @@ func GetProductosConIVA(db *db.DBConnection) http.HandlerFunc {
                 &p.IVA,
                 &p.TipoIVA,
             ); err != nil {
-                http.Error(w, err.Error(), http.StatusInternalServerError)
+                errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
                 return
             }
             base := p.Precio.Float64
@@ -400,23 +507,27 @@ func GetProductosConIVA(db *db.DBConnection) http.HandlerFunc {
 // GetProductosConIVAPorCategoria obtiene productos con IVA y precio final filtrando por categoría y paginados y precio sucursal
 func GetProductosConIVAPorCategoria(db *db.DBConnection) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
+        idEmpresa, ok := empresas.Requerida(w, r)
+        if !ok {
+            return
+        }
         w.Header().Set("Content-Type", "application/json")
         params := mux.Vars(r)
         catIDStr := params["idcategoria"]
         catID, err := strconv.Atoi(catIDStr)
         if err != nil {
-            http.Error(w, "ID de categoría inválido", http.StatusBadRequest)
+            errores.Escribir(w, r, errores.Validacion(errores.Invalido("idcategoria")).Con("ID de categoría inválido", err))
             return
         }
         idUsuarioStr := r.URL.Query().Get("id_usuario")
         idUsuario, err := strconv.Atoi(idUsuarioStr)
         if err != nil {
-            http.Error(w, "ID de usuario inválido", http.StatusBadRequest)
+            errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_usuario")).Con("ID de usuario inválido", err))
             return
         }
-        listaPrecios, err := getListaPreciosPorUsuario(db, idUsuario)
+        listaPrecios, err := getListaPreciosPorUsuario(r.Context(), db, idEmpresa, idUsuario)
         if err != nil {
-            http.Error(w, "No se pudo obtener lista de precios", http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("No se pudo obtener lista de precios", err))
             return
         }
         limit, offset := getPagination(r)
@@ -425,10 +536,10 @@ func GetProductosConIVAPorCategoria(db *db.DBConnection) http.HandlerFunc {
         var query string
         if catID == 0 {
             countQuery := fmt.Sprintf(`
-                SELECT COUNT(*) FROM crm_productos WHERE estatus = 'S' AND precio%d IS NOT NULL AND precio%d > 0
+                SELECT COUNT(*) FROM crm_productos WHERE idempresa = ? AND estatus = 'S' AND precio%d IS NOT NULL AND precio%d > 0
             `, listaPrecios, listaPrecios)
-            if err := db.Local.QueryRow(countQuery).Scan(&total); err != nil {
-                http.Error(w, err.Error(), http.StatusInternalServerError)
+            if err := db.Local.QueryRowContext(r.Context(), countQuery, idEmpresa).Scan(&total); err != nil {
+                errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
                 return
             }
             query = fmt.Sprintf(`
@@ -437,16 +548,16 @@ func GetProductosConIVAPorCategoria(db *db.DBConnection) http.HandlerFunc {
                 FROM crm_productos p
                 LEFT JOIN categorias c ON p.idcategoria = c.idcategoria
                 LEFT JOIN crm_impuestos i ON p.idiva = i.idiva
-                WHERE p.estatus = 'S' AND p.precio%d IS NOT NULL AND p.precio%d > 0
+                WHERE p.idempresa = ? AND p.estatus = 'S' AND p.precio%d IS NOT NULL AND p.precio%d > 0
                 LIMIT ? OFFSET ?
             `, listaPrecios, listaPrecios, listaPrecios)
-            rows, err = db.Local.Query(query, limit, offset)
+            rows, err = db.Local.QueryContext(r.Context(), query, idEmpresa, limit, offset)
         } else {
             countQuery := fmt.Sprintf(`
-                SELECT COUNT(*) FROM crm_productos WHERE idcategoria = ? AND estatus = 'S' AND precio%d IS NOT NULL AND precio%d > 0
+                SELECT COUNT(*) FROM crm_productos WHERE idempresa = ? AND idcategoria = ? AND estatus = 'S' AND precio%d IS NOT NULL AND precio%d > 0
             `, listaPrecios, listaPrecios)
-            if err := db.Local.QueryRow(countQuery, catID).Scan(&total); err != nil {
-                http.Error(w, err.Error(), http.StatusInternalServerError)
+            if err := db.Local.QueryRowContext(r.Context(), countQuery, idEmpresa, catID).Scan(&total); err != nil {
+                errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
                 return
             }
             query = fmt.Sprintf(`
@@ -455,14 +566,14 @@ func GetProductosConIVAPorCategoria(db *db.DBConnection) http.HandlerFunc {
                 FROM crm_productos p
                 LEFT JOIN categorias c ON p.idcategoria = c.idcategoria
                 LEFT JOIN crm_impuestos i ON p.idiva = i.idiva
-                WHERE p.idcategoria = ? AND p.estatus = 'S' AND p.precio%d IS NOT NULL AND p.precio%d > 0
+                WHERE p.idempresa = ? AND p.idcategoria = ? AND p.estatus = 'S' AND p.precio%d IS NOT NULL AND p.precio%d > 0
                 LIMIT ? OFFSET ?
             `, listaPrecios, listaPrecios, listaPrecios)
-            rows, err = db.Local.Query(query, catID, limit, offset)
+            rows, err = db.Local.QueryContext(r.Context(), query, idEmpresa, catID, limit, offset)
         }
 
         if err != nil {
-            http.Error(w, err.Error(), http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
             return
         }
         defer rows.Close()
@@ -479,7 +590,7 @@ func GetProductosConIVAPorCategoria(db *db.DBConnection) http.HandlerFunc {
                 &p.IVA,
                 &p.TipoIVA,
             ); err != nil {
-                http.Error(w, err.Error(), http.StatusInternalServerError)
+                errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
                 return
             }
             base := p.Precio.Float64
@@ -501,42 +612,46 @@ func GetProductosConIVAPorCategoria(db *db.DBConnection) http.HandlerFunc {
 // GetProductoImpuesto obtiene el producto por ID y calcula precio final según sucursal
 func GetProductoImpuesto(db *db.DBConnection) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
+        idEmpresa, ok := empresas.Requerida(w, r)
+        if !ok {
+            return
+        }
         w.Header().Set("Content-Type", "application/json")
         params := mux.Vars(r)
         idStr := params["id"]
         id, err := strconv.Atoi(idStr)
         if err != nil {
-            http.Error(w, "ID inválido", http.StatusBadRequest)
+            errores.Escribir(w, r, errores.Validacion(errores.Invalido("id")).Con("ID inválido", err))
             return
         }
         idUsuarioStr := r.URL.Query().Get("id_usuario")
         idUsuario, err := strconv.Atoi(idUsuarioStr)
         if err != nil {
-            http.Error(w, "ID de usuario inválido", http.StatusBadRequest)
+            errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_usuario")).Con("ID de usuario inválido", err))
             return
         }
-        listaPrecios, err := getListaPreciosPorUsuario(db, idUsuario)
+        listaPrecios, err := getListaPreciosPorUsuario(r.Context(), db, idEmpresa, idUsuario)
         if err != nil {
-            http.Error(w, "No se pudo obtener lista de precios", http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("No se pudo obtener lista de precios", err))
             return
         }
         var prod ProductoImpuesto
         queryProd := fmt.Sprintf(`
             SELECT idproducto, descripcion, precio%d, idiva
             FROM crm_productos
-            WHERE idproducto = ? AND estatus = 'S' AND precio%d IS NOT NULL AND precio%d > 0
+            WHERE idempresa = ? AND idproducto = ? AND estatus = 'S' AND precio%d IS NOT NULL AND precio%d > 0
         `, listaPrecios, listaPrecios, listaPrecios)
-        err = db.Local.QueryRow(queryProd, id).Scan(
+        err = db.Local.QueryRowContext(r.Context(), queryProd, idEmpresa, id).Scan(
             &prod.IDProducto,
             &prod.Descripcion,
             &prod.PrecioBase,
             &prod.IDIVA,
         )
         if err == sql.ErrNoRows {
-            http.Error(w, "Producto no encontrado", http.StatusNotFound)
+            errores.Escribir(w, r, errores.Nuevo(errores.ProductoNoEncontrado))
             return
         } else if err != nil {
-            http.Error(w, err.Error(), http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
             return
         }
         queryImp := `
@@ -544,12 +659,12 @@ func GetProductoImpuesto(db *db.DBConnection) http.HandlerFunc {
             FROM crm_impuestos
             WHERE idiva = ?
         `
-        err = db.Local.QueryRow(queryImp, prod.IDIVA).Scan(&prod.IVA, &prod.TipoIVA)
+        err = db.Local.QueryRowContext(r.Context(), queryImp, prod.IDIVA).Scan(&prod.IVA, &prod.TipoIVA)
         if err == sql.ErrNoRows {
-            http.Error(w, "Impuesto no encontrado", http.StatusNotFound)
+            errores.Escribir(w, r, errores.Nuevo(errores.ImpuestoNoEncontrado))
             return
         } else if err != nil {
-            http.Error(w, err.Error(), http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
             return
         }
         precioBase := prod.PrecioBase.Float64
@@ -562,17 +677,21 @@ func GetProductoImpuesto(db *db.DBConnection) http.HandlerFunc {
 // GetProductosConIVABuscar busca productos por término o ID, con IVA, paginación y precio sucursal
 func GetProductosConIVABuscar(db *db.DBConnection) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
+        idEmpresa, ok := empresas.Requerida(w, r)
+        if !ok {
+            return
+        }
         w.Header().Set("Content-Type", "application/json")
         q := r.URL.Query().Get("q")
         idUsuarioStr := r.URL.Query().Get("id_usuario")
         idUsuario, err := strconv.Atoi(idUsuarioStr)
         if err != nil {
-            http.Error(w, "ID de usuario inválido", http.StatusBadRequest)
+            errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_usuario")).Con("ID de usuario inválido", err))
             return
         }
-        listaPrecios, err := getListaPreciosPorUsuario(db, idUsuario)
+        listaPrecios, err := getListaPreciosPorUsuario(r.Context(), db, idEmpresa, idUsuario)
         if err != nil {
-            http.Error(w, "No se pudo obtener lista de precios", http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("No se pudo obtener lista de precios", err))
             return
         }
         limit, offset := getPagination(r)
@@ -582,40 +701,40 @@ func GetProductosConIVABuscar(db *db.DBConnection) http.HandlerFunc {
         var args []interface{}
 
         if id, err := strconv.Atoi(q); err == nil {
-            countQuery := fmt.Sprintf("SELECT COUNT(*) FROM crm_productos WHERE idproducto = ? AND estatus = 'S' AND precio%d IS NOT NULL AND precio%d > 0", listaPrecios, listaPrecios)
-            db.Local.QueryRow(countQuery, id).Scan(&total)
+            countQuery := fmt.Sprintf("SELECT COUNT(*) FROM crm_productos WHERE idempresa = ? AND idproducto = ? AND estatus = 'S' AND precio%d IS NOT NULL AND precio%d > 0", listaPrecios, listaPrecios)
+            db.Local.QueryRowContext(r.Context(), countQuery, idEmpresa, id).Scan(&total)
             query = fmt.Sprintf(`
                 SELECT p.idproducto, p.descripcion, p.precio%d, p.estatus, c.categoria,
                        p.idiva, IFNULL(i.iva, 0), IFNULL(i.tipo_iva, '')
                 FROM crm_productos p
                 LEFT JOIN categorias c ON p.idcategoria = c.idcategoria
                 LEFT JOIN crm_impuestos i ON p.idiva = i.idiva
-                WHERE p.idproducto = ? AND p.estatus = 'S' AND p.precio%d IS NOT NULL AND p.precio%d > 0
+                WHERE p.idempresa = ? AND p.idproducto = ? AND p.estatus = 'S' AND p.precio%d IS NOT NULL AND p.precio%d > 0
                 LIMIT ? OFFSET ?
             `, listaPrecios, listaPrecios, listaPrecios)
-            args = []interface{}{id, limit, offset}
+            args = []interface{}{idEmpresa, id, limit, offset}
         } else {
             like := "%" + q + "%"
             countQuery := fmt.Sprintf(
-                `SELECT COUNT(*) FROM crm_productos WHERE estatus = 'S' AND (LOWER(descripcion) LIKE LOWER(?) OR LOWER(clave) LIKE LOWER(?)) AND precio%d IS NOT NULL AND precio%d > 0`,
+                `SELECT COUNT(*) FROM crm_productos WHERE idempresa = ? AND estatus = 'S' AND (LOWER(descripcion) LIKE LOWER(?) OR LOWER(clave) LIKE LOWER(?)) AND precio%d IS NOT NULL AND precio%d > 0`,
                 listaPrecios, listaPrecios)
-            db.Local.QueryRow(countQuery, like, like).Scan(&total)
+            db.Local.QueryRowContext(r.Context(), countQuery, idEmpresa, like, like).Scan(&total)
             query = fmt.Sprintf(`
                 SELECT p.idproducto, p.descripcion, p.precio%d, p.estatus, c.categoria,
                        p.idiva, IFNULL(i.iva, 0), IFNULL(i.tipo_iva, '')
                 FROM crm_productos p
                 LEFT JOIN categorias c ON p.idcategoria = c.idcategoria
                 LEFT JOIN crm_impuestos i ON p.idiva = i.idiva
-                WHERE p.estatus = 'S' AND (LOWER(p.descripcion) LIKE LOWER(?) OR LOWER(p.clave) LIKE LOWER(?))
+                WHERE p.idempresa = ? AND p.estatus = 'S' AND (LOWER(p.descripcion) LIKE LOWER(?) OR LOWER(p.clave) LIKE LOWER(?))
                 AND p.precio%d IS NOT NULL AND p.precio%d > 0
                 LIMIT ? OFFSET ?
-            `, listaPrecios, listaPrecios, listaPrecios, listaPrecios)
-            args = []interface{}{like, like, limit, offset}
+            `, listaPrecios, listaPrecios, listaPrecios)
+            args = []interface{}{idEmpresa, like, like, limit, offset}
         }
 
-        rows, err = db.Local.Query(query, args...)
+        rows, err = db.Local.QueryContext(r.Context(), query, args...)
         if err != nil {
-            http.Error(w, err.Error(), http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
             return
         }
         defer rows.Close()
@@ -632,7 +751,7 @@ func GetProductosConIVABuscar(db *db.DBConnection) http.HandlerFunc {
                 &p.IVA,
                 &p.TipoIVA,
             ); err != nil {
-                http.Error(w, err.Error(), http.StatusInternalServerError)
+                errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
                 return
             }
             base := p.Precio.Float64
@@ -654,45 +773,49 @@ func GetProductosConIVABuscar(db *db.DBConnection) http.HandlerFunc {
 // SearchProductos busca productos por término (clave o descripción) con paginación y precio sucursal
 func SearchProductos(db *db.DBConnection) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
+        idEmpresa, ok := empresas.Requerida(w, r)
+        if !ok {
+            return
+        }
         w.Header().Set("Content-Type", "application/json")
         q := r.URL.Query().Get("q")
         if q == "" {
-            http.Error(w, "Falta el parámetro de búsqueda 'q'", http.StatusBadRequest)
+            errores.Escribir(w, r, errores.Validacion(errores.Requerido("q")))
             return
         }
         idUsuarioStr := r.URL.Query().Get("id_usuario")
         idUsuario, err := strconv.Atoi(idUsuarioStr)
         if err != nil {
-            http.Error(w, "ID de usuario inválido", http.StatusBadRequest)
+            errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_usuario")).Con("ID de usuario inválido", err))
             return
         }
-        listaPrecios, err := getListaPreciosPorUsuario(db, idUsuario)
+        listaPrecios, err := getListaPreciosPorUsuario(r.Context(), db, idEmpresa, idUsuario)
         if err != nil {
-            http.Error(w, "No se pudo obtener lista de precios", http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("No se pudo obtener lista de precios", err))
             return
         }
         limit, offset := getPagination(r)
         like := "%" + q + "%"
         countQuery := fmt.Sprintf(`
             SELECT COUNT(*) FROM crm_productos 
-            WHERE estatus = 'S' AND (descripcion LIKE ? OR clave LIKE ?) AND precio%d IS NOT NULL AND precio%d > 0
+            WHERE idempresa = ? AND estatus = 'S' AND (descripcion LIKE ? OR clave LIKE ?) AND precio%d IS NOT NULL AND precio%d > 0
         `, listaPrecios, listaPrecios)
         var total int
-        if err := db.Local.QueryRow(countQuery, like, like).Scan(&total); err != nil {
-            http.Error(w, err.Error(), http.StatusInternalServerError)
+        if err := db.Local.QueryRowContext(r.Context(), countQuery, idEmpresa, like, like).Scan(&total); err != nil {
+            errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
             return
         }
         query := fmt.Sprintf(`
             SELECT p.idproducto, p.descripcion, p.precio%d, p.estatus, c.categoria
             FROM crm_productos p
             LEFT JOIN categorias c ON p.idcategoria = c.idcategoria
-            WHERE p.estatus = 'S' AND (p.descripcion LIKE ? OR p.clave LIKE ?)
+            WHERE p.idempresa = ? AND p.estatus = 'S' AND (p.descripcion LIKE ? OR p.clave LIKE ?)
             AND p.precio%d IS NOT NULL AND p.precio%d > 0
             LIMIT ? OFFSET ?
-        `, listaPrecios, listaPrecios, listaPrecios, listaPrecios)
-        rows, err := db.Local.Query(query, like, like, limit, offset)
+        `, listaPrecios, listaPrecios, listaPrecios)
+        rows, err := db.Local.QueryContext(r.Context(), query, idEmpresa, like, like, limit, offset)
         if err != nil {
-            http.Error(w, err.Error(), http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
             return
         }
         defer rows.Close()
@@ -700,7 +823,7 @@ func SearchProductos(db *db.DBConnection) http.HandlerFunc {
         for rows.Next() {
             var p Producto
             if err := rows.Scan(&p.IDProducto, &p.Descripcion, &p.Precio, &p.Estatus, &p.Categoria); err != nil {
-                http.Error(w, err.Error(), http.StatusInternalServerError)
+                errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
                 return
             }
             productos = append(productos, p)
@@ -715,37 +838,41 @@ func SearchProductos(db *db.DBConnection) http.HandlerFunc {
 // GetProductoSuggestions devuelve sugerencias para autocomplete (nombre/descripcion), mínimo 3 caracteres y precio sucursal
 func GetProductoSuggestions(db *db.DBConnection) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
+        idEmpresa, ok := empresas.Requerida(w, r)
+        if !ok {
+            return
+        }
         w.Header().Set("Content-Type", "application/json")
         q := r.URL.Query().Get("q")
         q = strings.TrimSpace(q)
         if len([]rune(q)) < 3 {
-            http.Error(w, "Debe ingresar al menos 3 caracteres", http.StatusBadRequest)
+            errores.Escribir(w, r, errores.Validacion(errores.NuevoCampo("q", errores.CampoMuyCorto, 3)))
             return
         }
         idUsuarioStr := r.URL.Query().Get("id_usuario")
         idUsuario, err := strconv.Atoi(idUsuarioStr)
         if err != nil {
-            http.Error(w, "ID de usuario inválido", http.StatusBadRequest)
+            errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_usuario")).Con("ID de usuario inválido", err))
             return
         }
-        listaPrecios, err := getListaPreciosPorUsuario(db, idUsuario)
+        listaPrecios, err := getListaPreciosPorUsuario(r.Context(), db, idEmpresa, idUsuario)
         if err != nil {
-            http.Error(w, "No se pudo obtener lista de precios", http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("No se pudo obtener lista de precios", err))
             return
         }
         query := fmt.Sprintf(`
             SELECT idproducto, descripcion as nombre, descripcion
             FROM crm_productos
-            WHERE estatus = 'S'
+            WHERE idempresa = ? AND estatus = 'S'
             AND (LOWER(descripcion) LIKE LOWER(?) OR LOWER(clave) LIKE LOWER(?))
             AND precio%d IS NOT NULL AND precio%d > 0
             ORDER BY descripcion ASC
             LIMIT 10
         `, listaPrecios, listaPrecios)
         likeQuery := "%" + q + "%"
-        rows, err := db.Local.Query(query, likeQuery, likeQuery)
+        rows, err := db.Local.QueryContext(r.Context(), query, idEmpresa, likeQuery, likeQuery)
         if err != nil {
-            http.Error(w, "Error al buscar sugerencias", http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("Error al buscar sugerencias", err))
             return
         }
         defer rows.Close()
@@ -9,6 +9,9 @@ import (
 	"strings"
 
 	"github.com/WolfSlayer04/logica_tiendaenlina/db"
+	"github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+	"github.com/WolfSlayer04/logica_tiendaenlina/validacion"
 	"github.com/gorilla/mux"
 )
 
@@ -25,40 +28,40 @@ type ProductoInput struct {
 	Clave            *string  `json:"clave,omitempty"`
 	IDIVA            *int64   `json:"idiva,omitempty"`
 	CodBarras        *string  `json:"cod_barras,omitempty"`
-	Precio1          *float64 `json:"precio1,omitempty"`
-	Precio2          *float64 `json:"precio2,omitempty"`
-	Precio3          *float64 `json:"precio3,omitempty"`
-	Precio4          *float64 `json:"precio4,omitempty"`
-	Precio5          *float64 `json:"precio5,omitempty"`
-	Precio6          *float64 `json:"precio6,omitempty"`
-	Precio7          *float64 `json:"precio7,omitempty"`
-	Precio8          *float64 `json:"precio8,omitempty"`
-	Precio9          *float64 `json:"precio9,omitempty"`
-	Precio10         *float64 `json:"precio10,omitempty"`
-	Precio11         *float64 `json:"precio11,omitempty"`
-	Precio12         *float64 `json:"precio12,omitempty"`
-	Precio13         *float64 `json:"precio13,omitempty"`
-	Precio14         *float64 `json:"precio14,omitempty"`
-	Precio15         *float64 `json:"precio15,omitempty"`
-	Precio16         *float64 `json:"precio16,omitempty"`
-	Precio17         *float64 `json:"precio17,omitempty"`
-	Precio18         *float64 `json:"precio18,omitempty"`
-	Precio19         *float64 `json:"precio19,omitempty"`
-	Precio20         *float64 `json:"precio20,omitempty"`
-	Precio21         *float64 `json:"precio21,omitempty"`
-	Precio22         *float64 `json:"precio22,omitempty"`
-	Precio23         *float64 `json:"precio23,omitempty"`
-	Precio24         *float64 `json:"precio24,omitempty"`
-	Precio25         *float64 `json:"precio25,omitempty"`
-	IEPSAdic         *float64 `json:"ieps_adic,omitempty"`
+	Precio1          *float64 `json:"precio1,omitempty" valida:"no_negativo"`
+	Precio2          *float64 `json:"precio2,omitempty" valida:"no_negativo"`
+	Precio3          *float64 `json:"precio3,omitempty" valida:"no_negativo"`
+	Precio4          *float64 `json:"precio4,omitempty" valida:"no_negativo"`
+	Precio5          *float64 `json:"precio5,omitempty" valida:"no_negativo"`
+	Precio6          *float64 `json:"precio6,omitempty" valida:"no_negativo"`
+	Precio7          *float64 `json:"precio7,omitempty" valida:"no_negativo"`
+	Precio8          *float64 `json:"precio8,omitempty" valida:"no_negativo"`
+	Precio9          *float64 `json:"precio9,omitempty" valida:"no_negativo"`
+	Precio10         *float64 `json:"precio10,omitempty" valida:"no_negativo"`
+	Precio11         *float64 `json:"precio11,omitempty" valida:"no_negativo"`
+	Precio12         *float64 `json:"precio12,omitempty" valida:"no_negativo"`
+	Precio13         *float64 `json:"precio13,omitempty" valida:"no_negativo"`
+	Precio14         *float64 `json:"precio14,omitempty" valida:"no_negativo"`
+	Precio15         *float64 `json:"precio15,omitempty" valida:"no_negativo"`
+	Precio16         *float64 `json:"precio16,omitempty" valida:"no_negativo"`
+	Precio17         *float64 `json:"precio17,omitempty" valida:"no_negativo"`
+	Precio18         *float64 `json:"precio18,omitempty" valida:"no_negativo"`
+	Precio19         *float64 `json:"precio19,omitempty" valida:"no_negativo"`
+	Precio20         *float64 `json:"precio20,omitempty" valida:"no_negativo"`
+	Precio21         *float64 `json:"precio21,omitempty" valida:"no_negativo"`
+	Precio22         *float64 `json:"precio22,omitempty" valida:"no_negativo"`
+	Precio23         *float64 `json:"precio23,omitempty" valida:"no_negativo"`
+	Precio24         *float64 `json:"precio24,omitempty" valida:"no_negativo"`
+	Precio25         *float64 `json:"precio25,omitempty" valida:"no_negativo"`
+	IEPSAdic         *float64 `json:"ieps_adic,omitempty" valida:"no_negativo"`
 	ConIEPSAdic      *string  `json:"con_ieps_adic,omitempty"`
 	Unidad           *string  `json:"unidad,omitempty"`
 	UnidadEnt        *string  `json:"unidad_ent,omitempty"`
-	FactorConversion *float64 `json:"factor_conversion,omitempty"`
+	FactorConversion *float64 `json:"factor_conversion,omitempty" valida:"mayor_cero"`
 	SATClave         *string  `json:"sat_clave,omitempty"`
 	SATMedida        *string  `json:"sat_medida,omitempty"`
-	Volumen          *float64 `json:"volumen,omitempty"`
-	Peso             *float64 `json:"peso,omitempty"`
+	Volumen          *float64 `json:"volumen,omitempty" valida:"no_negativo"`
+	Peso             *float64 `json:"peso,omitempty" valida:"no_negativo"`
 	IDMoneda         *int64   `json:"idmoneda,omitempty"`
 	Lote             *string  `json:"lote,omitempty"`
 	DescTicket       *string  `json:"desc_ticket,omitempty"`
@@ -133,14 +136,35 @@ type ProductoDBConIVA struct {
 // AddProducto mejorado: solo incluye los campos que realmente vienen en el input (no nulos)
 func AddProducto(dbConn *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
 		var input ProductoInput
-		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-			http.Error(w, "JSON inválido", http.StatusBadRequest)
+		if err := validacion.Leer(w, r, &input); err != nil {
+			errores.Escribir(w, r, err)
 			return
 		}
 
-		if input.IDEmpresa == 0 || input.Descripcion == "" || input.Estatus == "" {
-			http.Error(w, "Faltan campos obligatorios", http.StatusBadRequest)
+		// El producto pertenece a la empresa de la petición; idempresa es
+		// opcional y solo se acepta si coincide
+		if input.IDEmpresa == 0 {
+			input.IDEmpresa = idEmpresa
+		} else if input.IDEmpresa != idEmpresa {
+			errores.Escribir(w, r, errores.Nuevo(errores.EmpresaNoPermitida))
+			return
+		}
+
+		// ProductoInput también sirve para editar, donde nada es obligatorio
+		campos := validacion.Validar(&input)
+		if input.Descripcion == "" {
+			campos = append(campos, errores.Requerido("descripcion"))
+		}
+		if input.Estatus == "" {
+			campos = append(campos, errores.Requerido("estatus"))
+		}
+		if len(campos) > 0 {
+			errores.Escribir(w, r, errores.Validacion(campos...))
 			return
 		}
 
@@ -201,9 +225,9 @@ func AddProducto(dbConn *db.DBConnection) http.HandlerFunc {
 			strings.Join(columns, ", "),
 			strings.TrimRight(strings.Repeat("?, ", len(args)), ", "),
 		)
-		res, err := dbConn.Local.Exec(query, args...)
+		res, err := dbConn.Local.ExecContext(r.Context(), query, args...)
 		if err != nil {
-			http.Error(w, "Error al insertar producto: "+err.Error(), http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error al insertar producto", err))
 			return
 		}
 
@@ -219,11 +243,15 @@ func AddProducto(dbConn *db.DBConnection) http.HandlerFunc {
 // EditProducto mejorado: solo actualiza los campos recibidos en el input, el resto se conserva
 func EditProducto(dbConn *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
 		params := mux.Vars(r)
 		idStr := params["idproducto"]
 		id, err := strconv.Atoi(idStr)
 		if err != nil || id <= 0 {
-			http.Error(w, "ID de producto inválido", http.StatusBadRequest)
+			errores.Escribir(w, r, errores.Validacion(errores.Invalido("idproducto")).Con("ID de producto inválido", err))
 			return
 		}
 
@@ -232,15 +260,20 @@ func EditProducto(dbConn *db.DBConnection) http.HandlerFunc {
 			Clave     sql.NullString
 			IDEmpresa int
 		}
-		row := dbConn.Local.QueryRow("SELECT clave, idempresa FROM crm_productos WHERE idproducto=?", id)
+		row := dbConn.Local.QueryRowContext(r.Context(), "SELECT clave, idempresa FROM crm_productos WHERE idempresa=? AND idproducto=?", idEmpresa, id)
 		if err := row.Scan(&current.Clave, &current.IDEmpresa); err != nil {
-			http.Error(w, "No se encontró el producto", http.StatusNotFound)
+			errores.Escribir(w, r, errores.Nuevo(errores.ProductoNoEncontrado))
 			return
 		}
 
 		var input ProductoInput
-		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-			http.Error(w, "JSON inválido", http.StatusBadRequest)
+		if err := validacion.Decodificar(w, r, &input); err != nil {
+			errores.Escribir(w, r, err)
+			return
+		}
+		// Un producto no se puede mover a otra empresa
+		if input.IDEmpresa != 0 && input.IDEmpresa != current.IDEmpresa {
+			errores.Escribir(w, r, errores.Nuevo(errores.EmpresaNoPermitida))
 			return
 		}
 
@@ -248,14 +281,14 @@ func EditProducto(dbConn *db.DBConnection) http.HandlerFunc {
 		var idivaToSet sql.NullInt64
 		if input.IDIVA != nil {
 			var count int
-			err := dbConn.Local.QueryRow("SELECT COUNT(*) FROM crm_impuestos WHERE idiva=? AND idempresa=?", *input.IDIVA, current.IDEmpresa).Scan(&count)
+			err := dbConn.Local.QueryRowContext(r.Context(), "SELECT COUNT(*) FROM crm_impuestos WHERE idiva=? AND idempresa=?", *input.IDIVA, current.IDEmpresa).Scan(&count)
 			if err != nil || count == 0 {
-				http.Error(w, "idiva no válido para esta empresa", http.StatusBadRequest)
+				errores.Escribir(w, r, errores.Validacion(errores.Invalido("idiva")).Con("idiva no válido para esta empresa", err))
 				return
 			}
 			idivaToSet = sqlNullInt64(input.IDIVA)
 		} else {
-			row := dbConn.Local.QueryRow("SELECT idiva FROM crm_productos WHERE idproducto=?", id)
+			row := dbConn.Local.QueryRowContext(r.Context(), "SELECT idiva FROM crm_productos WHERE idproducto=?", id)
 			var idivaActual sql.NullInt64
 			row.Scan(&idivaActual)
 			idivaToSet = idivaActual
@@ -272,7 +305,6 @@ func EditProducto(dbConn *db.DBConnection) http.HandlerFunc {
 		args := []interface{}{idlineaToSet, tipoProdToSet, clasifToSet, conFormulaToSet, idivaToSet}
 
 		// Solo actualiza los campos recibidos (excepto clave)
-		if input.IDEmpresa != 0            { updateFields = append(updateFields, "idempresa = ?");        args = append(args, input.IDEmpresa) }
 		if input.Descripcion != ""         { updateFields = append(updateFields, "descripcion = ?");      args = append(args, input.Descripcion) }
 		if input.Estatus != ""             { updateFields = append(updateFields, "estatus = ?");          args = append(args, input.Estatus) }
 		if input.IDCategoria != nil        { updateFields = append(updateFields, "idcategoria = ?");      args = append(args, sqlNullInt64(input.IDCategoria)) }
@@ -322,13 +354,13 @@ func EditProducto(dbConn *db.DBConnection) http.HandlerFunc {
 		args = append(args, claveToSet)
 
 		// Al final, WHERE
-		args = append(args, id)
+		args = append(args, idEmpresa, id)
 
-		query := "UPDATE crm_productos SET " + join(updateFields, ", ") + " WHERE idproducto = ?"
+		query := "UPDATE crm_productos SET " + join(updateFields, ", ") + " WHERE idempresa = ? AND idproducto = ?"
 
-		_, err = dbConn.Local.Exec(query, args...)
+		_, err = dbConn.Local.ExecContext(r.Context(), query, args...)
 		if err != nil {
-			http.Error(w, "Error al editar producto: "+err.Error(), http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error al editar producto", err))
 			return
 		}
 
@@ -343,11 +375,15 @@ func EditProducto(dbConn *db.DBConnection) http.HandlerFunc {
 // GetEstatusProductos mejorado: paginación y búsqueda
 func GetEstatusProductos(dbConn *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
 
 		estatus := r.URL.Query().Get("estatus")
 		if estatus == "" {
-			http.Error(w, "Falta el parámetro 'estatus'", http.StatusBadRequest)
+			errores.Escribir(w, r, errores.Validacion(errores.Requerido("estatus")))
 			return
 		}
 
@@ -366,8 +402,8 @@ func GetEstatusProductos(dbConn *db.DBConnection) http.HandlerFunc {
 		offset := (page - 1) * limit
 
 		// WHERE dinámico
-		where := " WHERE p.estatus = ?"
-		args := []interface{}{estatus}
+		where := " WHERE p.idempresa = ? AND p.estatus = ?"
+		args := []interface{}{idEmpresa, estatus}
 		if busqueda != "" {
 			// Puedes usar MATCH ... AGAINST si tienes FULLTEXT, o LIKE si no
 			// Aquí usamos LIKE para mayor compatibilidad
@@ -383,8 +419,8 @@ func GetEstatusProductos(dbConn *db.DBConnection) http.HandlerFunc {
 		// Total para paginación (filtrado)
 		countQuery := "SELECT COUNT(*) FROM crm_productos p " + where
 		var total int
-		if err := dbConn.Local.QueryRow(countQuery, args...).Scan(&total); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if err := dbConn.Local.QueryRowContext(r.Context(), countQuery, args...).Scan(&total); err != nil {
+			errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
 			return
 		}
 
@@ -405,9 +441,9 @@ func GetEstatusProductos(dbConn *db.DBConnection) http.HandlerFunc {
 			` + where + `
 			LIMIT ? OFFSET ?`
 		argsWithLimit := append(args, limit, offset)
-		rows, err := dbConn.Local.Query(query, argsWithLimit...)
+		rows, err := dbConn.Local.QueryContext(r.Context(), query, argsWithLimit...)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
 			return
 		}
 		defer rows.Close()
@@ -426,7 +462,7 @@ func GetEstatusProductos(dbConn *db.DBConnection) http.HandlerFunc {
 				&p.IVA, &p.TipoIVA,
 			)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				errores.Escribir(w, r, errores.Interno("Error de base de datos", err))
 				return
 			}
 			// Calcula el precio final usando Precio1 y el IVA
@@ -492,25 +528,31 @@ type Impuesto struct {
 // Handler para obtener IVAs por empresa
 func GetImpuestosPorEmpresa(dbConn *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		empresaStr := r.URL.Query().Get("empresa")
-		if empresaStr == "" {
-			http.Error(w, "Falta parámetro empresa", http.StatusBadRequest)
+		empresaID, ok := empresas.Requerida(w, r)
+		if !ok {
 			return
 		}
-		empresaID, err := strconv.Atoi(empresaStr)
-		if err != nil || empresaID <= 0 {
-			http.Error(w, "ID de empresa inválido", http.StatusBadRequest)
-			return
+		// ?empresa= se conserva por compatibilidad, pero debe ser la de la petición
+		if empresaStr := r.URL.Query().Get("empresa"); empresaStr != "" {
+			id, err := strconv.Atoi(empresaStr)
+			if err != nil || id <= 0 {
+				errores.Escribir(w, r, errores.Validacion(errores.Invalido("empresa")))
+				return
+			}
+			if id != empresaID {
+				errores.Escribir(w, r, errores.Nuevo(errores.EmpresaNoPermitida))
+				return
+			}
 		}
 
-		rows, err := dbConn.Local.Query(`
+		rows, err := dbConn.Local.QueryContext(r.Context(), `
 			SELECT idiva, descripcion, iva, tipo_iva 
 			FROM crm_impuestos 
 			WHERE idempresa = ?
 			ORDER BY descripcion
 		`, empresaID)
 		if err != nil {
-			http.Error(w, "Error de consulta: "+err.Error(), http.StatusInternalServerError)
+			errores.Escribir(w, r, errores.Interno("Error de consulta", err))
 			return
 		}
 		defer rows.Close()
@@ -519,7 +561,7 @@ func GetImpuestosPorEmpresa(dbConn *db.DBConnection) http.HandlerFunc {
 		for rows.Next() {
 			var imp Impuesto
 			if err := rows.Scan(&imp.IDIVA, &imp.Descripcion, &imp.IVA, &imp.TipoIVA); err != nil {
-				http.Error(w, "Error al leer datos: "+err.Error(), http.StatusInternalServerError)
+				errores.Escribir(w, r, errores.Interno("Error al leer datos", err))
 				return
 			}
 			impuestos = append(impuestos, imp)
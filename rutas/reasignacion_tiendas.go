@@ -0,0 +1,456 @@
+package rutas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	middlewares "github.com/WolfSlayer04/logica_tiendaenlina/Middleware"
+	"github.com/WolfSlayer04/logica_tiendaenlina/bitacora"
+	"github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+	"github.com/WolfSlayer04/logica_tiendaenlina/geocerca"
+	"github.com/WolfSlayer04/logica_tiendaenlina/reloj"
+	"github.com/WolfSlayer04/logica_tiendaenlina/repositorio"
+	"github.com/WolfSlayer04/logica_tiendaenlina/validacion"
+	"github.com/gorilla/mux"
+)
+
+// Qué generó una reasignación.
+const (
+	origenCobertura  = "cobertura"  // se cambió la geocerca de una sucursal
+	origenManual     = "manual"     // la pidió un administrador
+	origenProgramada = "programada" // la revisión periódica
+)
+
+// limiteReasignaciones es cuántas regresa GET /admin/reasignaciones.
+const limiteReasignaciones = 20
+
+// reasignacionPredeterminada es cada cuánto se revisan las tiendas si
+// REASIGNACION_TIENDAS_CADA no dice otra cosa.
+const reasignacionPredeterminada = 24 * time.Hour
+
+// TiendaReasignada es una tienda de un reporte de reasignación.
+type TiendaReasignada struct {
+	IDTienda           int    `json:"id_tienda"`
+	NombreTienda       string `json:"nombre_tienda"`
+	IDSucursalAnterior int    `json:"id_sucursal_anterior"`
+	SucursalAnterior   string `json:"sucursal_anterior"`
+	IDSucursalNueva    int    `json:"id_sucursal_nueva"`
+	SucursalNueva      string `json:"sucursal_nueva"`
+	EnCobertura        bool   `json:"en_cobertura"`
+	Aplicada           bool   `json:"aplicada"`
+}
+
+// Reasignacion es un reporte de reasignación. En la lista de reportes
+// Tiendas es null.
+type Reasignacion struct {
+	IDReasignacion int64              `json:"id_reasignacion"`
+	Estatus        string             `json:"estatus"`
+	Origen         string             `json:"origen"`
+	Creada         string             `json:"creada"`
+	Resuelta       *string            `json:"resuelta"`
+	IDAdmin        *int               `json:"id_admin"`
+	NumTiendas     int                `json:"num_tiendas"`
+	Tiendas        []TiendaReasignada `json:"tiendas"`
+}
+
+// MovimientoSucursal es un cambio de sucursal de una tienda.
+type MovimientoSucursal struct {
+	IDMovimiento       int64  `json:"id_movimiento"`
+	IDTienda           int    `json:"id_tienda"`
+	IDSucursalAnterior int    `json:"id_sucursal_anterior"`
+	SucursalAnterior   string `json:"sucursal_anterior"`
+	IDSucursalNueva    int    `json:"id_sucursal_nueva"`
+	SucursalNueva      string `json:"sucursal_nueva"`
+	IDReasignacion     *int64 `json:"id_reasignacion"`
+	IDAdmin            *int   `json:"id_admin"`
+	Fecha              string `json:"fecha"`
+}
+
+// AprobarReasignacionRequest elige qué tiendas del reporte se mueven; sin
+// id_tiendas se mueven todas.
+type AprobarReasignacionRequest struct {
+	IDTiendas *[]int `json:"id_tiendas"`
+}
+
+func reasignacionDe(re repositorio.Reasignacion) Reasignacion {
+	j := Reasignacion{
+		IDReasignacion: re.ID,
+		Estatus:        re.Estatus,
+		Origen:         re.Origen,
+		Creada:         re.Creada.Format("2006-01-02 15:04:05"),
+		NumTiendas:     re.NumTiendas,
+	}
+	if !re.Resuelta.IsZero() {
+		resuelta := re.Resuelta.Format("2006-01-02 15:04:05")
+		j.Resuelta = &resuelta
+	}
+	if re.IDAdmin != 0 {
+		j.IDAdmin = &re.IDAdmin
+	}
+	if re.Tiendas != nil {
+		j.Tiendas = []TiendaReasignada{}
+	}
+	for _, t := range re.Tiendas {
+		j.Tiendas = append(j.Tiendas, TiendaReasignada(t))
+	}
+	return j
+}
+
+func movimientoDe(m repositorio.MovimientoSucursal) MovimientoSucursal {
+	j := MovimientoSucursal{
+		IDMovimiento:       m.ID,
+		IDTienda:           m.IDTienda,
+		IDSucursalAnterior: m.IDSucursalAnterior,
+		SucursalAnterior:   m.SucursalAnterior,
+		IDSucursalNueva:    m.IDSucursalNueva,
+		SucursalNueva:      m.SucursalNueva,
+		Fecha:              m.Fecha.Format("2006-01-02 15:04:05"),
+	}
+	if m.IDReasignacion != 0 {
+		j.IDReasignacion = &m.IDReasignacion
+	}
+	if m.IDAdmin != 0 {
+		j.IDAdmin = &m.IDAdmin
+	}
+	return j
+}
+
+// evaluarReasignacion compara la sucursal guardada de cada tienda activa con
+// ubicación contra la que le asignan las geocercas vigentes y regresa las
+// que difieren.
+func evaluarReasignacion(ctx context.Context, repos repositorio.Repositorios, idEmpresa int) ([]repositorio.TiendaReasignada, error) {
+	coberturas, err := repos.Sucursales.Coberturas(ctx, idEmpresa)
+	if err != nil {
+		return nil, err
+	}
+	tiendas, err := repos.Tiendas.Ubicaciones(ctx, idEmpresa)
+	if err != nil {
+		return nil, err
+	}
+	coberturas = geocerca.Preparar(coberturas)
+	var cambios []repositorio.TiendaReasignada
+	for _, t := range tiendas {
+		u := geocerca.Asignar(coberturas, t.Punto)
+		if u.IDSucursal == 0 || u.IDSucursal == t.IDSucursal {
+			continue
+		}
+		cambios = append(cambios, repositorio.TiendaReasignada{
+			IDTienda:           t.IDTienda,
+			NombreTienda:       t.NombreTienda,
+			IDSucursalAnterior: t.IDSucursal,
+			SucursalAnterior:   t.NombreSucursal,
+			IDSucursalNueva:    u.IDSucursal,
+			SucursalNueva:      u.Nombre,
+			EnCobertura:        u.Cubierta,
+		})
+	}
+	return cambios, nil
+}
+
+// mismosCambios dice si el reporte pendiente propone exactamente los cambios.
+func mismosCambios(pendiente repositorio.Reasignacion, cambios []repositorio.TiendaReasignada) bool {
+	if len(pendiente.Tiendas) != len(cambios) {
+		return false
+	}
+	propuestos := map[int]repositorio.TiendaReasignada{}
+	for _, t := range pendiente.Tiendas {
+		propuestos[t.IDTienda] = t
+	}
+	for _, c := range cambios {
+		p, ok := propuestos[c.IDTienda]
+		if !ok || p.IDSucursalAnterior != c.IDSucursalAnterior || p.IDSucursalNueva != c.IDSucursalNueva {
+			return false
+		}
+	}
+	return true
+}
+
+// reasignarTiendas evalúa las tiendas de la empresa y deja el reporte
+// pendiente de aprobación. Si el pendiente ya propone lo mismo se conserva;
+// si no hay cambios, el pendiente se reemplaza y se regresa un reporte vacío
+// sin id.
+func reasignarTiendas(ctx context.Context, repos repositorio.Repositorios, idEmpresa int, origen string, ahora time.Time) (repositorio.Reasignacion, error) {
+	cambios, err := evaluarReasignacion(ctx, repos, idEmpresa)
+	if err != nil {
+		return repositorio.Reasignacion{}, fmt.Errorf("evaluando tiendas: %w", err)
+	}
+	pendiente, err := repos.Reasignaciones.Pendiente(ctx, idEmpresa)
+	if err == nil && len(cambios) > 0 && mismosCambios(pendiente, cambios) {
+		return pendiente, nil
+	} else if err != nil && !errors.Is(err, repositorio.ErrNoEncontrado) {
+		return repositorio.Reasignacion{}, fmt.Errorf("consultando la reasignación pendiente: %w", err)
+	}
+	if len(cambios) == 0 && errors.Is(err, repositorio.ErrNoEncontrado) {
+		return repositorio.Reasignacion{IDEmpresa: idEmpresa, Origen: origen, Creada: ahora, Tiendas: []repositorio.TiendaReasignada{}}, nil
+	}
+
+	id, err := repos.Reasignaciones.Guardar(ctx, repositorio.Reasignacion{IDEmpresa: idEmpresa, Origen: origen, Creada: ahora, Tiendas: cambios})
+	if err != nil {
+		return repositorio.Reasignacion{}, fmt.Errorf("guardando reasignación: %w", err)
+	}
+	if id == 0 {
+		return repositorio.Reasignacion{IDEmpresa: idEmpresa, Origen: origen, Creada: ahora, Tiendas: []repositorio.TiendaReasignada{}}, nil
+	}
+	return repos.Reasignaciones.Obtener(ctx, idEmpresa, id)
+}
+
+// cadaReasignacion lee REASIGNACION_TIENDAS_CADA (duración de Go, p. ej.
+// "12h", o segundos). "0" apaga la revisión periódica; sin valor o inválido
+// es reasignacionPredeterminada.
+func cadaReasignacion() time.Duration {
+	valor := os.Getenv("REASIGNACION_TIENDAS_CADA")
+	if valor == "" {
+		return reasignacionPredeterminada
+	}
+	if valor == "0" {
+		return 0
+	}
+	if d, err := time.ParseDuration(valor); err == nil && d > 0 {
+		return d
+	}
+	if seg, err := strconv.Atoi(valor); err == nil && seg > 0 {
+		return time.Duration(seg) * time.Second
+	}
+	slog.Warn("REASIGNACION_TIENDAS_CADA inválido, usando valor por defecto", "valor", valor, "por_defecto", reasignacionPredeterminada.String())
+	return reasignacionPredeterminada
+}
+
+// IniciarReasignacionTiendas revisa en segundo plano, cada
+// REASIGNACION_TIENDAS_CADA, las tiendas de cada empresa activa y deja un
+// reporte pendiente cuando alguna debería cambiar de sucursal (por ejemplo,
+// porque abrió una sucursal). No mueve tiendas: eso lo aprueba un
+// administrador. Se detiene al cancelar ctx; el canal que regresa se cierra
+// cuando termina (de inmediato si está apagada).
+func IniciarReasignacionTiendas(ctx context.Context, repos repositorio.Repositorios) <-chan struct{} {
+	done := make(chan struct{})
+	cada := cadaReasignacion()
+	logger := slog.Default().With("componente", "reasignacion_tiendas")
+	if cada == 0 {
+		logger.Info("revisión periódica de sucursales de tiendas apagada")
+		close(done)
+		return done
+	}
+	go func() {
+		defer close(done)
+		for esperarOCancelar(ctx, cada) {
+			ids, err := repos.Empresas.Activas(ctx)
+			if err != nil {
+				logger.Error("error consultando empresas", "error", err)
+				continue
+			}
+			for _, idEmpresa := range ids {
+				if ctx.Err() != nil {
+					break // apagando: no se empieza otra empresa
+				}
+				re, err := reasignarTiendas(ctx, repos, idEmpresa, origenProgramada, reloj.Desde(ctx).Ahora())
+				if err != nil {
+					logger.Error("error reasignando tiendas", "id_empresa", idEmpresa, "error", err)
+					continue
+				}
+				if re.ID != 0 {
+					logger.Info("reasignación de tiendas pendiente", "id_empresa", idEmpresa, "id_reasignacion", re.ID, "tiendas", re.NumTiendas)
+				}
+			}
+		}
+		logger.Info("revisión de sucursales de tiendas detenida")
+	}()
+	return done
+}
+
+// reasignacionDeRuta lee {id_reasignacion}.
+func reasignacionDeRuta(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id_reasignacion"], 10, 64)
+	if err != nil || id <= 0 {
+		errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_reasignacion")))
+		return 0, false
+	}
+	return id, true
+}
+
+// escribirErrorReasignacion traduce los errores del repositorio.
+func escribirErrorReasignacion(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	switch {
+	case errors.Is(err, repositorio.ErrNoEncontrado):
+		errores.Escribir(w, r, errores.Nuevo(errores.ReasignacionNoEncontrada))
+	case errors.Is(err, repositorio.ErrReasignacionResuelta):
+		errores.Escribir(w, r, errores.Nuevo(errores.ReasignacionResuelta))
+	default:
+		errores.Escribir(w, r, errores.Interno(msg, err))
+	}
+}
+
+// GetReasignaciones regresa los últimos reportes de reasignación de la
+// empresa, sin sus tiendas.
+func GetReasignaciones(repos repositorio.Repositorios) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		lista, err := repos.Reasignaciones.Listar(r.Context(), idEmpresa, limiteReasignaciones)
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al obtener las reasignaciones", err))
+			return
+		}
+		res := []Reasignacion{}
+		for _, re := range lista {
+			res = append(res, reasignacionDe(re))
+		}
+		writeSuccessResponse(w, "Reasignaciones obtenidas", res)
+	}
+}
+
+// CreateReasignacion evalúa ahora las tiendas de la empresa y regresa el
+// reporte pendiente. Si ninguna cambia de sucursal, el reporte viene vacío y
+// sin id.
+func CreateReasignacion(repos repositorio.Repositorios) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		re, err := reasignarTiendas(r.Context(), repos, idEmpresa, origenManual, reloj.Desde(r.Context()).Ahora())
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al evaluar las sucursales de las tiendas", err))
+			return
+		}
+		writeSuccessResponse(w, "Reasignación evaluada", reasignacionDe(re))
+	}
+}
+
+// GetReasignacion regresa un reporte con sus tiendas.
+func GetReasignacion(repos repositorio.Repositorios) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		id, ok := reasignacionDeRuta(w, r)
+		if !ok {
+			return
+		}
+		re, err := repos.Reasignaciones.Obtener(r.Context(), idEmpresa, id)
+		if err != nil {
+			escribirErrorReasignacion(w, r, err, "Error al obtener la reasignación")
+			return
+		}
+		writeSuccessResponse(w, "Reasignación obtenida", reasignacionDe(re))
+	}
+}
+
+// AprobarReasignacion mueve las tiendas del reporte pendiente a su nueva
+// sucursal (nombre_sucursal incluido) y guarda cada movimiento. Las tiendas
+// que cambiaron de sucursal después del reporte se dejan como están.
+func AprobarReasignacion(repos repositorio.Repositorios) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		id, ok := reasignacionDeRuta(w, r)
+		if !ok {
+			return
+		}
+		var req AprobarReasignacionRequest
+		if r.ContentLength != 0 {
+			if err := validacion.Decodificar(w, r, &req); err != nil {
+				errores.Escribir(w, r, err)
+				return
+			}
+		}
+		re, err := repos.Reasignaciones.Obtener(r.Context(), idEmpresa, id)
+		if err != nil {
+			escribirErrorReasignacion(w, r, err, "Error al obtener la reasignación")
+			return
+		}
+		var idTiendas []int
+		if req.IDTiendas != nil {
+			if len(*req.IDTiendas) == 0 {
+				errores.Escribir(w, r, errores.Validacion(errores.NuevoCampo("id_tiendas", errores.CampoSinElementos)))
+				return
+			}
+			enReporte := map[int]bool{}
+			for _, t := range re.Tiendas {
+				enReporte[t.IDTienda] = true
+			}
+			var campos []errores.Campo
+			for i, idTienda := range *req.IDTiendas {
+				if !enReporte[idTienda] {
+					campos = append(campos, errores.Invalido(fmt.Sprintf("id_tiendas[%d]", i)))
+				}
+			}
+			if len(campos) > 0 {
+				errores.Escribir(w, r, errores.Validacion(campos...))
+				return
+			}
+			idTiendas = *req.IDTiendas
+		}
+
+		idAdmin, _, _, _, _ := middlewares.GetUserFromContext(r)
+		movimientos, err := repos.Reasignaciones.Aplicar(r.Context(), idEmpresa, id, idTiendas, idAdmin, reloj.Desde(r.Context()).Ahora())
+		if err != nil {
+			escribirErrorReasignacion(w, r, err, "Error al aplicar la reasignación")
+			return
+		}
+		bitacora.Desde(r.Context()).Info("reasignación de tiendas aplicada",
+			"id_empresa", idEmpresa, "id_reasignacion", id, "id_admin", idAdmin, "tiendas_movidas", len(movimientos))
+		res := []MovimientoSucursal{}
+		for _, m := range movimientos {
+			res = append(res, movimientoDe(m))
+		}
+		writeSuccessResponse(w, "Reasignación aplicada", res)
+	}
+}
+
+// DescartarReasignacion deja el reporte pendiente como descartado.
+func DescartarReasignacion(repos repositorio.Repositorios) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		id, ok := reasignacionDeRuta(w, r)
+		if !ok {
+			return
+		}
+		idAdmin, _, _, _, _ := middlewares.GetUserFromContext(r)
+		if err := repos.Reasignaciones.Descartar(r.Context(), idEmpresa, id, idAdmin, reloj.Desde(r.Context()).Ahora()); err != nil {
+			escribirErrorReasignacion(w, r, err, "Error al descartar la reasignación")
+			return
+		}
+		writeSuccessResponse(w, "Reasignación descartada", nil)
+	}
+}
+
+// GetMovimientosTienda regresa los cambios de sucursal de la tienda, del más
+// nuevo al más viejo.
+func GetMovimientosTienda(repos repositorio.Repositorios) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		idTienda, err := strconv.Atoi(mux.Vars(r)["id_tienda"])
+		if err != nil || idTienda <= 0 {
+			errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_tienda")))
+			return
+		}
+		movimientos, err := repos.Reasignaciones.Movimientos(r.Context(), idEmpresa, idTienda)
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al obtener los movimientos de la tienda", err))
+			return
+		}
+		res := []MovimientoSucursal{}
+		for _, m := range movimientos {
+			res = append(res, movimientoDe(m))
+		}
+		writeSuccessResponse(w, "Movimientos de la tienda", res)
+	}
+}
@@ -0,0 +1,202 @@
+package rutas
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/avisos"
+	"github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+	"github.com/WolfSlayer04/logica_tiendaenlina/reloj"
+	"github.com/WolfSlayer04/logica_tiendaenlina/repositorio"
+	"github.com/WolfSlayer04/logica_tiendaenlina/validacion"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// vigenciaReclamo es cuánto sirve el código que se manda al cliente.
+	vigenciaReclamo = 15 * time.Minute
+	// intentosReclamo son los códigos que se pueden probar por cliente del
+	// ERP en ventanaReclamos, sumando los de los reclamos que se reemplazan.
+	intentosReclamo = 5
+	// reclamosPorVentana son los códigos que se mandan a un mismo cliente del
+	// ERP en ventanaReclamos; los registros de más se rechazan.
+	reclamosPorVentana = 3
+	ventanaReclamos    = time.Hour
+)
+
+// ReclamoRequest es el código que recibió el cliente del ERP en su teléfono.
+type ReclamoRequest struct {
+	Codigo string `json:"codigo" valida:"requerido"`
+}
+
+// ocultarTelefono deja ver sólo los últimos cuatro dígitos del teléfono.
+func ocultarTelefono(telefono string) string {
+	var digitos []rune
+	for _, c := range telefono {
+		if c >= '0' && c <= '9' {
+			digitos = append(digitos, c)
+		}
+	}
+	if len(digitos) <= 4 {
+		return string(digitos)
+	}
+	return strings.Repeat("*", len(digitos)-4) + string(digitos[len(digitos)-4:])
+}
+
+// generarCodigoReclamo regresa un código de 6 dígitos. A diferencia de
+// generarClaveAleatoria no debe poder adivinarse, por eso usa crypto/rand.
+func generarCodigoReclamo() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// iniciarReclamo guarda el alta (con la clave ya encriptada) como reclamo del
+// cliente que ya existe en el ERP y le manda el código a su teléfono.
+// Responde 202 con el id_reclamo para ConfirmarReclamo.
+func iniciarReclamo(w http.ResponseWriter, r *http.Request, repos repositorio.Repositorios, enviador avisos.Enviador, idEmpresa int, cliente repositorio.ClienteExistente, req RegistroRequest) {
+	vinculado, err := repos.Reclamos.Vinculado(r.Context(), idEmpresa, cliente.IDCliente)
+	if err != nil {
+		errores.Escribir(w, r, errores.Interno("No se pudo revisar si el cliente remoto ya tiene cuenta", err))
+		return
+	}
+	if vinculado {
+		errores.Escribir(w, r, errores.Nuevo(errores.ClienteRemotoVinculado))
+		return
+	}
+	// crm_clientes no guarda correo: el teléfono es el único contacto para verificar
+	if !validacion.EsTelefono(cliente.Telefono) {
+		errores.Escribir(w, r, errores.Nuevo(errores.ClienteRemotoSinTelefono))
+		return
+	}
+
+	codigo, err := generarCodigoReclamo()
+	if err != nil {
+		errores.Escribir(w, r, errores.Interno("No se pudo generar el código", err))
+		return
+	}
+	codigoHash, err := bcrypt.GenerateFromPassword([]byte(codigo), bcrypt.DefaultCost)
+	if err != nil {
+		errores.Escribir(w, r, errores.Interno("No se pudo generar el código", err))
+		return
+	}
+	registro, err := json.Marshal(req)
+	if err != nil {
+		errores.Escribir(w, r, errores.Interno("No se pudo guardar el registro", err))
+		return
+	}
+	ahora := reloj.Desde(r.Context()).Ahora()
+	vence := ahora.Add(vigenciaReclamo)
+	reclamo, err := repos.Reclamos.Iniciar(r.Context(), repositorio.Reclamo{
+		IDEmpresa:   idEmpresa,
+		IDRemoto:    cliente.IDCliente,
+		ClaveRemota: cliente.Clave,
+		Telefono:    cliente.Telefono,
+		CodigoHash:  string(codigoHash),
+		Registro:    registro,
+		Creado:      ahora,
+		Vence:       vence,
+	}, repositorio.LimiteReclamos{Desde: ahora.Add(-ventanaReclamos), Reclamos: reclamosPorVentana, Intentos: intentosReclamo})
+	if errors.Is(err, repositorio.ErrReclamosAgotados) {
+		errores.Escribir(w, r, errores.Nuevo(errores.ReclamosAgotados))
+		return
+	} else if err != nil {
+		errores.Escribir(w, r, errores.Interno("No se pudo guardar el reclamo", err))
+		return
+	}
+	mensaje := fmt.Sprintf("Tu código para ligar tu cuenta en línea con %s es %s. Vence en %d minutos.",
+		cliente.NombreComercial, codigo, int(vigenciaReclamo.Minutes()))
+	if err := enviador.Enviar(r.Context(), cliente.Telefono, mensaje); err != nil {
+		errores.Escribir(w, r, errores.Interno("No se pudo enviar el código", err))
+		return
+	}
+
+	telefono := ocultarTelefono(cliente.Telefono)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(SuccessResponse{
+		Message: "Ya eres cliente de la sucursal; te enviamos un código al " + telefono + " para ligar tu cuenta",
+		Data: map[string]interface{}{
+			"id_reclamo": reclamo.ID,
+			"telefono":   telefono,
+			"vence":      vence.Format("2006-01-02 15:04:05"),
+			"intentos":   intentosReclamo - reclamo.Intentos,
+		},
+	})
+}
+
+// ConfirmarReclamo revisa el código del reclamo y, si es el que se mandó,
+// termina el alta guardada con el usuario y la tienda ligados al cliente que
+// ya existía en el ERP (no se crea otro en crm_clientes). Responde igual que
+// el registro. Cada código probado gasta un intento, sea correcto o no.
+func ConfirmarReclamo(repos repositorio.Repositorios) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		id, err := strconv.ParseInt(mux.Vars(r)["id_reclamo"], 10, 64)
+		if err != nil || id <= 0 {
+			errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_reclamo")))
+			return
+		}
+		var req ReclamoRequest
+		if err := validacion.Decodificar(w, r, &req); err != nil {
+			errores.Escribir(w, r, err)
+			return
+		}
+
+		ahora := reloj.Desde(r.Context()).Ahora()
+		reclamo, err := repos.Reclamos.Intentar(r.Context(), idEmpresa, id, ahora, intentosReclamo)
+		if errors.Is(err, repositorio.ErrReclamoVencido) {
+			errores.Escribir(w, r, errores.Nuevo(errores.ReclamoVencido))
+			return
+		} else if err != nil {
+			errores.Escribir(w, r, errores.Interno("No se pudo obtener el reclamo", err))
+			return
+		}
+		if bcrypt.CompareHashAndPassword([]byte(reclamo.CodigoHash), []byte(strings.TrimSpace(req.Codigo))) != nil {
+			errores.Escribir(w, r, errores.Nuevo(errores.CodigoIncorrecto))
+			return
+		}
+
+		var alta RegistroRequest
+		if err := json.Unmarshal(reclamo.Registro, &alta); err != nil {
+			errores.Escribir(w, r, errores.Interno("No se pudo leer el registro del reclamo", err))
+			return
+		}
+		sucursal, err := repos.Sucursales.PorUbicacion(r.Context(), idEmpresa, alta.Tienda.Latitud, alta.Tienda.Longitud)
+		if err != nil {
+			errores.Escribir(w, r, errores.Nuevo(errores.UbicacionSinCobertura))
+			return
+		}
+		tienda := nuevaTienda(idEmpresa, sucursal, alta.Tienda, ahora)
+		tienda.IDRemoto = reclamo.IDRemoto
+		tienda.ClaveRemota = reclamo.ClaveRemota
+		idUsuario, err := repos.Reclamos.Confirmar(r.Context(), idEmpresa, id,
+			nuevoUsuario(idEmpresa, alta.Usuario, reclamo.IDRemoto, reclamo.ClaveRemota, ahora), tienda)
+		if errors.Is(err, repositorio.ErrReclamoVencido) {
+			errores.Escribir(w, r, errores.Nuevo(errores.ReclamoVencido))
+			return
+		} else if errors.Is(err, repositorio.ErrCorreoRegistrado) {
+			errores.Escribir(w, r, errores.Nuevo(errores.CorreoRegistrado))
+			return
+		} else if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al crear usuario y tienda", err))
+			return
+		}
+
+		abrirSesionRegistro(w, r, repos, idEmpresa, idUsuario, ahora, "Cuenta ligada a tu cliente de la sucursal")
+	}
+}
@@ -1,33 +1,38 @@
 package rutas
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
 	"net/http"
 	"time"
 	"github.com/WolfSlayer04/logica_tiendaenlina/db"
+	"github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+	"github.com/WolfSlayer04/logica_tiendaenlina/reloj"
+	"github.com/WolfSlayer04/logica_tiendaenlina/validacion"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // Define la estructura para el request de refresh
 type RefreshRequest struct {
-	RefreshToken string `json:"refresh_token"`
+	RefreshToken string `json:"refresh_token" valida:"requerido"`
 }
 
-// Valida refresh token
-func validarRefreshToken(dbc *db.DBConnection, refreshToken string) (tokenID int, userID int, tipoUsuario, correo string, err error) {
+// Valida refresh token. idEmpresa es 0 para los admins de todo el grupo.
+func validarRefreshToken(ctx context.Context, dbc *db.DBConnection, refreshToken string) (tokenID int, userID int, tipoUsuario, correo string, idEmpresa int, err error) {
 	var (
 		id            int
 		tokenId       int
 		tipo          string
 		correoUsuario string
+		empresa       int
 		tokenHash     string
 		expiracionStr sql.NullString
 	)
 	query := `SELECT id, usuario_id, tipo_usuario, token_hash, expiracion FROM refresh_tokens WHERE estado = 'activo'`
-	rows, err := dbc.Local.Query(query)
+	rows, err := dbc.Local.QueryContext(ctx, query)
 	if err != nil {
-		return 0, 0, "", "", err
+		return 0, 0, "", "", 0, err
 	}
 	defer rows.Close()
 
@@ -43,96 +48,94 @@ func validarRefreshToken(dbc *db.DBConnection, refreshToken string) (tokenID int
 		}
 	}
 	if !found {
-		return 0, 0, "", "", sql.ErrNoRows
+		return 0, 0, "", "", 0, sql.ErrNoRows
 	}
 	if !expiracionStr.Valid || expiracionStr.String == "" {
-		return 0, 0, "", "", sql.ErrNoRows
+		return 0, 0, "", "", 0, sql.ErrNoRows
 	}
-	expiracion, err := time.Parse("2006-01-02 15:04:05", expiracionStr.String)
+	expiracion, err := reloj.LeerBD(expiracionStr.String, time.UTC)
 	if err != nil {
-		return 0, 0, "", "", err
+		return 0, 0, "", "", 0, err
 	}
-	if time.Now().After(expiracion) {
-		return 0, 0, "", "", sql.ErrNoRows
+	if reloj.Desde(ctx).Ahora().After(expiracion) {
+		return 0, 0, "", "", 0, sql.ErrNoRows
 	}
 	if tipo == "A" {
-		err = dbc.Local.QueryRow(`SELECT correo FROM admin_usuarios WHERE idusuario = ?`, id).Scan(&correoUsuario)
+		err = dbc.Local.QueryRowContext(ctx, `SELECT correo, IFNULL(idempresa, 0) FROM admin_usuarios WHERE idusuario = ?`, id).Scan(&correoUsuario, &empresa)
 	} else {
-		err = dbc.Local.QueryRow(`SELECT correo FROM usuarios WHERE id_usuario = ?`, id).Scan(&correoUsuario)
+		err = dbc.Local.QueryRowContext(ctx, `SELECT correo, id_empresa FROM usuarios WHERE id_usuario = ?`, id).Scan(&correoUsuario, &empresa)
 	}
 	if err != nil {
-		return 0, 0, "", "", err
+		return 0, 0, "", "", 0, err
 	}
-	return tokenId, id, tipo, correoUsuario, nil
+	return tokenId, id, tipo, correoUsuario, empresa, nil
 }
 
 func RefreshTokenEndpoint(dbc *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req RefreshRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			writeErrorResponse1(w, http.StatusBadRequest, "Datos inválidos", err.Error())
-			return
-		}
-		if req.RefreshToken == "" {
-			writeErrorResponse1(w, http.StatusBadRequest, "Falta refresh_token", "")
+		if err := validacion.Decodificar(w, r, &req); err != nil {
+			errores.Escribir(w, r, err)
 			return
 		}
 
-		tokenID, userID, tipoUsuario, correo, err := validarRefreshToken(dbc, req.RefreshToken)
+		tokenID, userID, tipoUsuario, correo, idEmpresa, err := validarRefreshToken(r.Context(), dbc, req.RefreshToken)
 		if err != nil {
-			writeErrorResponse1(w, http.StatusUnauthorized, "Refresh token inválido o expirado", err.Error())
+			errores.Escribir(w, r, errores.Nuevo(errores.RefreshTokenInvalido).Con("Refresh token inválido o expirado", err))
 			return
 		}
-
-		loc, err := time.LoadLocation("America/Merida")
-		if err != nil {
-			loc = time.UTC
+		if actual := empresas.Desde(r.Context()); idEmpresa != 0 && actual != 0 && actual != idEmpresa {
+			errores.Escribir(w, r, errores.Nuevo(errores.EmpresaNoPermitida))
+			return
 		}
 
+		now := reloj.Desde(r.Context()).Ahora()
+
 		// Verifica sesión activa reciente antes de renovar (lee como string y convierte)
 		var ultimoUsoStr sql.NullString
-		err = dbc.Local.QueryRow(`
+		err = dbc.Local.QueryRowContext(r.Context(), `
             SELECT ultimo_uso FROM refresh_tokens
             WHERE id = ? AND estado = 'activo'
             LIMIT 1
         `, tokenID).Scan(&ultimoUsoStr)
 		if err == nil && ultimoUsoStr.Valid && ultimoUsoStr.String != "" {
-			ultimoUso, err := time.Parse("2006-01-02 15:04:05", ultimoUsoStr.String)
-			if err == nil && time.Since(ultimoUso) < 15*time.Minute {
-				writeErrorResponse1(w, http.StatusConflict, "Sesión iniciada en otro equipo, espere o cierre sesión", "")
+			ultimoUso, err := reloj.LeerBD(ultimoUsoStr.String, time.UTC)
+			if err == nil && now.Sub(ultimoUso) < 15*time.Minute {
+				errores.Escribir(w, r, errores.Nuevo(errores.SesionActiva))
 				return
 			}
 		}
 
-		now := time.Now().In(loc)
-		midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, loc)
-		nowStr := now.Format("2006-01-02 15:04:05")
-		midnightStr := midnight.Format("2006-01-02 15:04:05")
+		// En la base van en UTC
+		midnight := reloj.InicioDelDia(now).AddDate(0, 0, 1)
+		nowStr := reloj.ParaBD(now)
+		midnightStr := reloj.ParaBD(midnight)
 
-		accessToken, newRefreshToken, _, err := generarTokens(userID, tipoUsuario, correo)
+		// Sin claim de tienda: los handlers usan la que el cliente tiene marcada
+		accessToken, newRefreshToken, _, err := generarTokens(now, userID, tipoUsuario, correo, idEmpresa, 0)
 		if err != nil {
-			writeErrorResponse1(w, http.StatusInternalServerError, "Error generando tokens", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error generando tokens", err))
 			return
 		}
 		userAgent := r.Header.Get("User-Agent")
 		ip := r.RemoteAddr
 		hash, err := bcrypt.GenerateFromPassword([]byte(newRefreshToken), bcrypt.DefaultCost)
 		if err != nil {
-			writeErrorResponse1(w, http.StatusInternalServerError, "Error generando hash de refresh token", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error generando hash de refresh token", err))
 			return
 		}
 
-		_, err = dbc.Local.Exec(`UPDATE refresh_tokens SET estado = 'revocado' WHERE id = ?`, tokenID)
+		_, err = dbc.Local.ExecContext(r.Context(), `UPDATE refresh_tokens SET estado = 'revocado' WHERE id = ?`, tokenID)
 		if err != nil {
-			writeErrorResponse1(w, http.StatusInternalServerError, "Error revocando refresh token anterior", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error revocando refresh token anterior", err))
 			return
 		}
-		_, err = dbc.Local.Exec(`
+		_, err = dbc.Local.ExecContext(r.Context(), `
             INSERT INTO refresh_tokens (usuario_id, tipo_usuario, token_hash, user_agent, ip_address, expiracion, ultimo_uso, estado)
             VALUES (?, ?, ?, ?, ?, ?, ?, 'activo')`,
 			userID, tipoUsuario, string(hash), userAgent, ip, midnightStr, nowStr)
 		if err != nil {
-			writeErrorResponse1(w, http.StatusInternalServerError, "Error guardando nuevo refresh token", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error guardando nuevo refresh token", err))
 			return
 		}
 
@@ -0,0 +1,397 @@
+package rutas
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	middlewares "github.com/WolfSlayer04/logica_tiendaenlina/Middleware"
+	"github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+	"github.com/WolfSlayer04/logica_tiendaenlina/reloj"
+	"github.com/WolfSlayer04/logica_tiendaenlina/repositorio"
+	"github.com/WolfSlayer04/logica_tiendaenlina/validacion"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// duracionApartado es cuánto se guarda un horario mientras el cliente
+	// termina el checkout.
+	duracionApartado = 15 * time.Minute
+	// diasOfrecidos son los días de entrega, desde el de la fecha mínima, que
+	// se ofrecen para elegir horario.
+	diasOfrecidos = 7
+	// diasBusquedaHorario son los días hábiles, después de la fecha mínima, en
+	// los que se busca lugar para un pedido que no apartó horario.
+	diasBusquedaHorario = 30
+)
+
+// ReservaRequest aparta un horario de entrega durante el checkout. Los
+// detalles sólo se usan para el peso; sin ellos el pedido cuenta con 0 kg.
+type ReservaRequest struct {
+	IDUsuario  int              `json:"id_usuario" valida:"requerido"`
+	IDSucursal int              `json:"id_sucursal"`
+	Fecha      string           `json:"fecha" valida:"requerido,fecha"`
+	Horario    string           `json:"horario" valida:"requerido,hora"`
+	Detalles   []ReservaDetalle `json:"detalles"`
+}
+
+// PromesaRequest pide la fecha mínima de entrega de un carrito; los detalles
+// sólo se usan para los días por categoría.
+type PromesaRequest struct {
+	IDSucursal int              `json:"id_sucursal"`
+	Detalles   []ReservaDetalle `json:"detalles"`
+}
+
+// ReservaDetalle es un producto del carrito con su cantidad.
+type ReservaDetalle struct {
+	IDProducto int64   `json:"id_producto" valida:"requerido"`
+	Cantidad   float64 `json:"cantidad" valida:"mayor_cero"`
+}
+
+// capacidadDe es el límite del horario en los términos del repositorio.
+func capacidadDe(h HorarioEntrega) repositorio.Capacidad {
+	return repositorio.Capacidad{Pedidos: h.CapacidadPedidos, Peso: h.CapacidadPeso}
+}
+
+// fechaConHorario es el día de fecha a la hora de inicio del horario.
+func fechaConHorario(fecha time.Time, h HorarioEntrega) (time.Time, bool) {
+	hora, err := time.Parse("15:04", h.Inicio)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Date(fecha.Year(), fecha.Month(), fecha.Day(), hora.Hour(), hora.Minute(), 0, 0, fecha.Location()), true
+}
+
+// diasDesde son el día de minima y los n días de entrega que le siguen.
+func diasDesde(minima time.Time, n int, config *ConfigEntrega) []time.Time {
+	return append([]time.Time{minima}, diasDeEntrega(minima, n, config)...)
+}
+
+// diasDeEntrega regresa los n días hábiles y no feriados que siguen a desde,
+// buscando a lo más un año (menos si la configuración no tiene tantos).
+func diasDeEntrega(desde time.Time, n int, config *ConfigEntrega) []time.Time {
+	dias := make([]time.Time, 0, n)
+	for fecha, limite := desde, desde.AddDate(1, 0, 0); len(dias) < n && fecha.Before(limite); {
+		fecha = fecha.AddDate(0, 0, 1)
+		if feriado, _ := esDiaFeriado(fecha, config); esDiaHabil(fecha, config) && !feriado {
+			dias = append(dias, fecha)
+		}
+	}
+	return dias
+}
+
+// horarioConLugar regresa el primer horario de los días, sin ir antes de
+// minima, donde todavía cabe un pedido de peso kg.
+func horarioConLugar(minima time.Time, dias []time.Time, config *ConfigEntrega, ocupacion map[repositorio.Horario]repositorio.Ocupacion, peso float64) (time.Time, HorarioEntrega, bool) {
+	for _, dia := range dias {
+		for _, h := range config.HorariosEntrega {
+			fecha, ok := fechaConHorario(dia, h)
+			if !ok || fecha.Before(minima) {
+				continue
+			}
+			clave := repositorio.Horario{Fecha: dia.Format("2006-01-02"), Inicio: h.Inicio}
+			if capacidadDe(h).Admite(ocupacion[clave], peso) {
+				return fecha, h, true
+			}
+		}
+	}
+	return time.Time{}, HorarioEntrega{}, false
+}
+
+// apartarPrimerHorario aparta para un pedido que no eligió horario el primero
+// con lugar a partir de la fecha mínima de entrega. res trae empresa,
+// sucursal, usuario y peso. Sin horarios configurados regresa la fecha mínima
+// sin apartar nada (id 0); si no hay lugar, ErrSinCapacidad.
+func apartarPrimerHorario(ctx context.Context, entregas repositorio.EntregaRepo, res repositorio.Reserva, config *ConfigEntrega, minima, ahora time.Time) (int64, time.Time, error) {
+	if len(config.HorariosEntrega) == 0 {
+		return 0, minima, nil
+	}
+	dias := diasDesde(minima, diasBusquedaHorario, config)
+	ocupacion, err := entregas.Ocupacion(ctx, res.IDEmpresa, res.IDSucursal,
+		dias[0].Format("2006-01-02"), dias[len(dias)-1].Format("2006-01-02"), ahora)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	fecha, h, ok := horarioConLugar(minima, dias, config, ocupacion, res.Peso)
+	if !ok {
+		return 0, time.Time{}, repositorio.ErrSinCapacidad
+	}
+	res.Horario = repositorio.Horario{Fecha: fecha.Format("2006-01-02"), Inicio: h.Inicio}
+	res.Expira = ahora.Add(duracionApartado)
+	idReserva, err := entregas.Apartar(ctx, res, capacidadDe(h), ahora)
+	return idReserva, fecha, err
+}
+
+// pesoDe suma el peso en kg de los renglones; los productos sin peso
+// capturado cuentan 0.
+func pesoDe(ctx context.Context, productos repositorio.ProductoRepo, idEmpresa int, cantidades map[int64]float64) (float64, error) {
+	pesos, err := productos.Pesos(ctx, idEmpresa, idsDe(cantidades))
+	if err != nil {
+		return 0, err
+	}
+	total := 0.0
+	for id, cantidad := range cantidades {
+		total += pesos[id] * cantidad
+	}
+	return total, nil
+}
+
+// tiempoDelCarrito es lo que suman por categoría los productos del carrito:
+// de las categorías configuradas que trae, la de más días. Sin ninguna, el
+// valor cero.
+func tiempoDelCarrito(ctx context.Context, productos repositorio.ProductoRepo, idEmpresa int, config *ConfigEntrega, cantidades map[int64]float64) (TiempoCategoria, error) {
+	if len(config.TiemposCategoria) == 0 || len(cantidades) == 0 {
+		return TiempoCategoria{}, nil
+	}
+	categorias, err := productos.Categorias(ctx, idEmpresa, idsDe(cantidades))
+	if err != nil {
+		return TiempoCategoria{}, err
+	}
+	enCarrito := map[int]bool{}
+	for _, idCategoria := range categorias {
+		enCarrito[idCategoria] = true
+	}
+	var mayor TiempoCategoria
+	for _, t := range config.TiemposCategoria {
+		if enCarrito[t.IDCategoria] && t.DiasAdicionales > mayor.DiasAdicionales {
+			mayor = t
+		}
+	}
+	return mayor, nil
+}
+
+func idsDe(cantidades map[int64]float64) []int64 {
+	ids := make([]int64, 0, len(cantidades))
+	for id := range cantidades {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// PromesaDeEntrega explica en el checkout la fecha mínima de entrega del
+// carrito: hora de corte, días de proceso, días por categoría, fin de semana
+// y feriados. No revisa capacidad; el horario se aparta con /entregas/reservas
+// o al crear el pedido.
+func PromesaDeEntrega(repos repositorio.Repositorios) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		var req PromesaRequest
+		if err := validacion.Decodificar(w, r, &req); err != nil {
+			errores.Escribir(w, r, err)
+			return
+		}
+		if req.IDSucursal != 0 {
+			if err := repos.Sucursales.DeEmpresa(r.Context(), idEmpresa, req.IDSucursal); errors.Is(err, repositorio.ErrNoEncontrado) {
+				errores.Escribir(w, r, errores.Nuevo(errores.SucursalNoEncontrada))
+				return
+			} else if err != nil {
+				errores.Escribir(w, r, errores.Interno("No se pudo validar la sucursal", err))
+				return
+			}
+		}
+
+		config, err := ObtenerConfigEntrega(r.Context(), repos.Sucursales, idEmpresa, req.IDSucursal)
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al obtener configuración de entregas", err))
+			return
+		}
+		cantidades := map[int64]float64{}
+		for _, d := range req.Detalles {
+			cantidades[d.IDProducto] += d.Cantidad
+		}
+		categoria, err := tiempoDelCarrito(r.Context(), repos.Productos, idEmpresa, config, cantidades)
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("No se pudo obtener la categoría de los productos", err))
+			return
+		}
+
+		promesa := CalcularPromesaEntrega(reloj.Desde(r.Context()).Ahora(), config, categoria)
+		pasos := promesa.Pasos
+		if pasos == nil {
+			pasos = []string{}
+		}
+		writeSuccessResponse(w, "Fecha mínima de entrega", map[string]interface{}{
+			"id_sucursal":      req.IDSucursal,
+			"fecha_entrega":    promesa.Fecha.Format("2006-01-02 15:04:05"),
+			"fecha_formateada": formateaFechaCorta(promesa.Fecha),
+			"explicacion":      promesa.Explicacion(),
+			"pasos":            pasos,
+		})
+	}
+}
+
+// ApartarHorarioEntrega guarda un lugar en uno de los horarios que ofrece
+// /fechas-entrega-disponibles mientras el cliente termina el checkout. El
+// apartado vence en 15 minutos; CreatePedido con su id_reserva lo confirma.
+// El cliente aparta a su nombre; sólo un admin indica id_usuario.
+func ApartarHorarioEntrega(repos repositorio.Repositorios) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		var req ReservaRequest
+		if err := validacion.Leer(w, r, &req); err != nil {
+			errores.Escribir(w, r, err)
+			return
+		}
+		if idUsuario, tipo, _, _, _ := middlewares.GetUserFromContext(r); tipo == "C" {
+			req.IDUsuario = idUsuario
+		}
+		if campos := validacion.Validar(&req); len(campos) > 0 {
+			errores.Escribir(w, r, errores.Validacion(campos...))
+			return
+		}
+
+		if req.IDSucursal == 0 {
+			idSucursal, err := repos.Sucursales.PrimeraActiva(r.Context(), idEmpresa)
+			if err != nil {
+				errores.Escribir(w, r, errores.Interno("No se pudo obtener la sucursal", err))
+				return
+			}
+			req.IDSucursal = idSucursal
+		} else if err := repos.Sucursales.DeEmpresa(r.Context(), idEmpresa, req.IDSucursal); errors.Is(err, repositorio.ErrNoEncontrado) {
+			errores.Escribir(w, r, errores.Nuevo(errores.SucursalNoEncontrada))
+			return
+		} else if err != nil {
+			errores.Escribir(w, r, errores.Interno("No se pudo validar la sucursal", err))
+			return
+		}
+
+		config, err := ObtenerConfigEntrega(r.Context(), repos.Sucursales, idEmpresa, req.IDSucursal)
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al obtener configuración de entregas", err))
+			return
+		}
+
+		cantidades := map[int64]float64{}
+		for _, d := range req.Detalles {
+			cantidades[d.IDProducto] += d.Cantidad
+		}
+		categoria, err := tiempoDelCarrito(r.Context(), repos.Productos, idEmpresa, config, cantidades)
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("No se pudo obtener la categoría de los productos", err))
+			return
+		}
+
+		// Sólo se aparta lo que se ofrece: un horario de los próximos días de
+		// entrega que no sea antes de la fecha mínima del carrito
+		now := reloj.Desde(r.Context()).Ahora()
+		minima := CalcularPromesaEntrega(now, config, categoria).Fecha
+		var horario *HorarioEntrega
+		var fechaEntrega time.Time
+		for _, dia := range diasDesde(minima, diasOfrecidos-1, config) {
+			if dia.Format("2006-01-02") != req.Fecha {
+				continue
+			}
+			for i, h := range config.HorariosEntrega {
+				if fecha, ok := fechaConHorario(dia, h); ok && h.Inicio == req.Horario && !fecha.Before(minima) {
+					horario = &config.HorariosEntrega[i]
+					fechaEntrega = fecha
+				}
+			}
+		}
+		if horario == nil {
+			errores.Escribir(w, r, errores.Nuevo(errores.HorarioNoDisponible))
+			return
+		}
+
+		peso, err := pesoDe(r.Context(), repos.Productos, idEmpresa, cantidades)
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("No se pudo obtener el peso de los productos", err))
+			return
+		}
+
+		expira := now.Add(duracionApartado)
+		idReserva, err := repos.Entregas.Apartar(r.Context(), repositorio.Reserva{
+			IDEmpresa:  idEmpresa,
+			IDSucursal: req.IDSucursal,
+			IDUsuario:  req.IDUsuario,
+			Horario:    repositorio.Horario{Fecha: req.Fecha, Inicio: req.Horario},
+			Peso:       peso,
+			Expira:     expira,
+		}, capacidadDe(*horario), now)
+		if errors.Is(err, repositorio.ErrSinCapacidad) {
+			errores.Escribir(w, r, errores.Nuevo(errores.HorarioSinCapacidad))
+			return
+		}
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("No se pudo apartar el horario", err))
+			return
+		}
+
+		writeSuccessResponse(w, "Horario de entrega apartado", map[string]interface{}{
+			"id_reserva":    idReserva,
+			"id_sucursal":   req.IDSucursal,
+			"fecha_entrega": fechaEntrega.Format("2006-01-02 15:04:05"),
+			"etiqueta":      horario.Etiqueta,
+			"peso":          round(peso, 3),
+			"expira":        expira.Format("2006-01-02 15:04:05"),
+		})
+	}
+}
+
+// LiberarHorarioEntrega suelta un apartado que ya no se va a usar (el cliente
+// cambió de horario o abandonó el checkout). El cliente sólo suelta los suyos;
+// un admin indica de quién con ?id_usuario=.
+func LiberarHorarioEntrega(repos repositorio.Repositorios) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		idReserva, err := strconv.ParseInt(mux.Vars(r)["id_reserva"], 10, 64)
+		if err != nil || idReserva <= 0 {
+			errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_reserva")))
+			return
+		}
+		idUsuario, tipo, _, _, _ := middlewares.GetUserFromContext(r)
+		if tipo != "C" {
+			if idUsuario, err = strconv.Atoi(r.URL.Query().Get("id_usuario")); err != nil || idUsuario <= 0 {
+				errores.Escribir(w, r, errores.Validacion(errores.Invalido("id_usuario")))
+				return
+			}
+		}
+		err = repos.Entregas.Liberar(r.Context(), idEmpresa, idUsuario, idReserva)
+		if errors.Is(err, repositorio.ErrNoEncontrado) {
+			errores.Escribir(w, r, errores.Nuevo(errores.ReservaNoEncontrada))
+			return
+		}
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("No se pudo liberar el horario", err))
+			return
+		}
+		writeSuccessResponse(w, "Horario de entrega liberado", nil)
+	}
+}
+
+// disponibilidadHorario describe cuánto queda en un horario para
+// /fechas-entrega-disponibles; nil en lo que no tiene límite.
+func disponibilidadHorario(h HorarioEntrega, o repositorio.Ocupacion) map[string]interface{} {
+	d := map[string]interface{}{
+		"capacidad_pedidos":   h.CapacidadPedidos,
+		"capacidad_peso":      h.CapacidadPeso,
+		"pedidos_disponibles": nil,
+		"peso_disponible":     nil,
+		"disponible":          capacidadDe(h).Admite(o, 0),
+	}
+	if h.CapacidadPedidos > 0 {
+		d["pedidos_disponibles"] = max(h.CapacidadPedidos-o.Pedidos, 0)
+	}
+	if h.CapacidadPeso > 0 {
+		d["peso_disponible"] = round(max(h.CapacidadPeso-o.Peso, 0), 3)
+	}
+	return d
+}
+
+// fechaDeReserva es la fecha y hora de entrega de un apartado en la zona del
+// negocio.
+func fechaDeReserva(res repositorio.Reserva, zona *time.Location) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02 15:04", res.Horario.Fecha+" "+res.Horario.Inicio, zona)
+}
@@ -0,0 +1,316 @@
+package rutas
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/reloj"
+	"github.com/WolfSlayer04/logica_tiendaenlina/repositorio"
+	"github.com/gorilla/mux"
+)
+
+func TestHorarioConLugar(t *testing.T) {
+	config := &ConfigEntrega{
+		DiasHabiles: []string{"LUNES", "MARTES", "MIERCOLES", "JUEVES", "VIERNES"},
+		HorariosEntrega: []HorarioEntrega{
+			{Inicio: "09:00", Fin: "12:00", CapacidadPedidos: 2},
+			{Inicio: "13:00", Fin: "18:00", CapacidadPeso: 100},
+		},
+	}
+	// Viernes a las 09:00; el siguiente día de entrega es el lunes
+	minima := time.Date(2026, 10, 23, 9, 0, 0, 0, time.Local)
+	dias := append([]time.Time{minima}, diasDeEntrega(minima, 3, config)...)
+
+	casos := []struct {
+		nombre    string
+		minima    time.Time
+		ocupacion map[repositorio.Horario]repositorio.Ocupacion
+		peso      float64
+		esperada  string
+	}{
+		{nombre: "vacío", minima: minima, esperada: "2026-10-23 09:00"},
+		{
+			nombre:    "mañana llena por pedidos",
+			minima:    minima,
+			ocupacion: map[repositorio.Horario]repositorio.Ocupacion{{Fecha: "2026-10-23", Inicio: "09:00"}: {Pedidos: 2}},
+			esperada:  "2026-10-23 13:00",
+		},
+		{
+			nombre: "tarde sin lugar para el peso",
+			minima: minima,
+			ocupacion: map[repositorio.Horario]repositorio.Ocupacion{
+				{Fecha: "2026-10-23", Inicio: "09:00"}: {Pedidos: 2},
+				{Fecha: "2026-10-23", Inicio: "13:00"}: {Pedidos: 5, Peso: 90},
+			},
+			peso:     15,
+			esperada: "2026-10-26 09:00",
+		},
+		{nombre: "no regresa a un horario anterior a la mínima", minima: minima.Add(4 * time.Hour), esperada: "2026-10-23 13:00"},
+		{nombre: "la mañana no limita el peso", minima: minima, peso: 150, esperada: "2026-10-23 09:00"},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			fecha, _, ok := horarioConLugar(c.minima, dias, config, c.ocupacion, c.peso)
+			if !ok {
+				t.Fatal("no encontró horario")
+			}
+			if got := fecha.Format("2006-01-02 15:04"); got != c.esperada {
+				t.Errorf("horario = %s, se esperaba %s", got, c.esperada)
+			}
+		})
+	}
+
+	lleno := map[repositorio.Horario]repositorio.Ocupacion{}
+	for _, dia := range dias {
+		lleno[repositorio.Horario{Fecha: dia.Format("2006-01-02"), Inicio: "09:00"}] = repositorio.Ocupacion{Pedidos: 2}
+		lleno[repositorio.Horario{Fecha: dia.Format("2006-01-02"), Inicio: "13:00"}] = repositorio.Ocupacion{Peso: 100}
+	}
+	if fecha, _, ok := horarioConLugar(minima, dias, config, lleno, 1); ok {
+		t.Errorf("todo lleno, pero regresó %s", fecha)
+	}
+}
+
+// configConCapacidad entrega todos los días desde mañana, también en fin de
+// semana: por la mañana cabe un pedido y por la tarde 10 kg.
+const configConCapacidad = `{
+	"dias_habiles": ["LUNES", "MARTES", "MIERCOLES", "JUEVES", "VIERNES", "SABADO", "DOMINGO"],
+	"tiempo_procesamiento": 1,
+	"reglas_fin_semana": {"procesar_sabado": true, "procesar_domingo": true, "dias_adicionales_sabado": 0, "dias_adicionales_domingo": 0},
+	"horarios_entrega": [
+		{"etiqueta": "Mañana", "inicio": "09:00", "fin": "12:00", "capacidad_pedidos": 1},
+		{"etiqueta": "Tarde", "inicio": "13:00", "fin": "18:00", "capacidad_peso": 10}
+	]
+}`
+
+func TestReservasEntrega(t *testing.T) {
+	m := memoriaConCatalogo()
+	m.ConfigEntregaJSON[repositorio.ClaveConfigEntrega{IDEmpresa: 1}] = []byte(configConCapacidad)
+	m.Productos[10] = repositorio.ProductoMemoria{IDEmpresa: 1, Impuestos: repositorio.Impuestos{IVA: 16}, Peso: 4}
+	repos := m.Repositorios()
+	apartar, crear := ApartarHorarioEntrega(repos), CreatePedido(repos)
+	manana := hoy().AddDate(0, 0, 1).Format("2006-01-02")
+	reserva := func(usuario int, horario string, cantidad int) string {
+		return fmt.Sprintf(`{"id_usuario": %d, "id_sucursal": 3, "fecha": %q, "horario": %q, "detalles": [{"id_producto": 10, "cantidad": %d}]}`,
+			usuario, manana, horario, cantidad)
+	}
+	pedido := func(usuario int, extra string) string {
+		return fmt.Sprintf(`{"id_usuario": %d, "id_tienda": 9, "id_sucursal": 3, "id_metodo_pago": 1, %s
+			"detalles": [{"id_producto": 10, "cantidad": 1, "precio_unitario": 116}]}`, usuario, extra)
+	}
+	codigo := func(resp map[string]interface{}) interface{} {
+		if e, ok := resp["error"].(map[string]interface{}); ok {
+			return e["code"]
+		}
+		return nil
+	}
+
+	status, resp := llamar(t, apartar, http.MethodPost, "/api/v1/entregas/reservas", reserva(5, "09:00", 1))
+	if status != http.StatusOK {
+		t.Fatalf("apartar: status %d: %v", status, resp)
+	}
+	data := resp["data"].(map[string]interface{})
+	idManana := int64(data["id_reserva"].(float64))
+	if data["fecha_entrega"] != manana+" 09:00:00" || data["peso"] != 4.0 {
+		t.Errorf("apartado: %v", data)
+	}
+
+	rechazos := []struct {
+		nombre string
+		body   string
+		status int
+		codigo string
+	}{
+		{nombre: "mañana sin lugar", body: reserva(6, "09:00", 1), status: http.StatusConflict, codigo: "HORARIO_SIN_CAPACIDAD"},
+		{nombre: "tarde excede el peso", body: reserva(6, "13:00", 3), status: http.StatusConflict, codigo: "HORARIO_SIN_CAPACIDAD"},
+		{nombre: "horario que no existe", body: reserva(6, "10:00", 1), status: http.StatusBadRequest, codigo: "HORARIO_NO_DISPONIBLE"},
+		{
+			nombre: "hoy no se ofrece",
+			body:   fmt.Sprintf(`{"id_usuario": 6, "fecha": %q, "horario": "09:00"}`, hoy().Format("2006-01-02")),
+			status: http.StatusBadRequest, codigo: "HORARIO_NO_DISPONIBLE",
+		},
+		{nombre: "sin fecha", body: `{"id_usuario": 6, "horario": "09:00"}`, status: http.StatusBadRequest, codigo: "VALIDACION"},
+	}
+	for _, c := range rechazos {
+		if status, resp := llamar(t, apartar, http.MethodPost, "/api/v1/entregas/reservas", c.body); status != c.status || codigo(resp) != c.codigo {
+			t.Errorf("%s: status %d: %v", c.nombre, status, resp)
+		}
+	}
+
+	// Un apartado vencido ya no ocupa lugar
+	m.Reservas[idManana].Expira = time.Now().Add(-time.Minute)
+	status, resp = llamar(t, apartar, http.MethodPost, "/api/v1/entregas/reservas", reserva(5, "09:00", 1))
+	if status != http.StatusOK {
+		t.Fatalf("apartar tras vencer: status %d: %v", status, resp)
+	}
+	idManana = int64(resp["data"].(map[string]interface{})["id_reserva"].(float64))
+
+	status, resp = llamar(t, crear, http.MethodPost, "/api/v1/pedidos", pedido(5, fmt.Sprintf(`"id_reserva": %d,`, idManana)))
+	if status != http.StatusOK || resp["data"].(map[string]interface{})["fecha_entrega"] == nil {
+		t.Fatalf("pedido con reserva: status %d: %v", status, resp)
+	}
+	if r := m.Reservas[idManana]; r.IDPedido == 0 || !r.Expira.IsZero() {
+		t.Errorf("la reserva no quedó confirmada: %+v", r)
+	}
+	if p := m.Pedidos[1].Pedido; p.FechaEntrega.Time.Format("2006-01-02 15:04") != manana+" 09:00" || p.Peso != 4 {
+		t.Errorf("pedido: fecha_entrega %v, peso %v", p.FechaEntrega.Time, p.Peso)
+	}
+	if status, resp := llamar(t, crear, http.MethodPost, "/api/v1/pedidos", pedido(5, fmt.Sprintf(`"id_reserva": %d,`, idManana))); status != http.StatusConflict || codigo(resp) != "RESERVA_VENCIDA" {
+		t.Errorf("reserva ya usada: status %d: %v", status, resp)
+	}
+
+	// El cliente aparta a su nombre aunque mande otro id_usuario
+	status, resp = llamar(t, conSesion(apartar, 5, "C"), http.MethodPost, "/api/v1/entregas/reservas", reserva(6, "13:00", 2))
+	if status != http.StatusOK {
+		t.Fatalf("apartar tarde: status %d: %v", status, resp)
+	}
+	idTarde := int64(resp["data"].(map[string]interface{})["id_reserva"].(float64))
+	if u := m.Reservas[idTarde].IDUsuario; u != 5 {
+		t.Errorf("apartado a nombre de %d, se esperaba el de la sesión", u)
+	}
+	if status, resp := llamar(t, crear, http.MethodPost, "/api/v1/pedidos", pedido(6, fmt.Sprintf(`"id_reserva": %d,`, idTarde))); status != http.StatusBadRequest {
+		t.Errorf("reserva de otro usuario: status %d: %v", status, resp)
+	}
+	// Un cliente con su propia tienda tampoco la usa mandando el id_usuario
+	// del dueño: el pedido va a su nombre y la reserva no es suya
+	m.Usuarios[6] = &repositorio.UsuarioMemoria{
+		Usuario: repositorio.Usuario{IDUsuario: 6, IDEmpresa: 1, TipoUsuario: "C"},
+		Tienda:  &repositorio.Tienda{IDTienda: 9},
+		Alta:    repositorio.NuevaTienda{IDEmpresa: 1},
+	}
+	if status, resp := llamar(t, conSesion(crear, 6, "C"), http.MethodPost, "/api/v1/pedidos", pedido(5, fmt.Sprintf(`"id_reserva": %d,`, idTarde))); status != http.StatusBadRequest {
+		t.Errorf("reserva de otro cliente: status %d: %v", status, resp)
+	}
+	if r := m.Reservas[idTarde]; r.IDPedido != 0 || r.Expira.IsZero() {
+		t.Errorf("la reserva de otro cliente quedó usada: %+v", r)
+	}
+
+	liberaciones := []struct {
+		nombre  string
+		usuario int
+		tipo    string
+		query   string
+		status  int
+	}{
+		{nombre: "otro cliente", usuario: 6, tipo: "C", status: http.StatusNotFound},
+		{nombre: "admin sin id_usuario", usuario: 1, tipo: "A", status: http.StatusBadRequest},
+		{nombre: "admin para otro usuario", usuario: 1, tipo: "A", query: "?id_usuario=6", status: http.StatusNotFound},
+		{nombre: "el dueño", usuario: 5, tipo: "C", status: http.StatusOK},
+		{nombre: "dos veces", usuario: 5, tipo: "C", status: http.StatusNotFound},
+	}
+	for _, c := range liberaciones {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/v1/entregas/reservas/%d%s", idTarde, c.query), nil)
+		conSesion(LiberarHorarioEntrega(repos), c.usuario, c.tipo)(rec, mux.SetURLVars(conEmpresa(req, 1), map[string]string{"id_reserva": fmt.Sprint(idTarde)}))
+		if rec.Code != c.status {
+			t.Errorf("liberar %s: status %d, se esperaba %d: %s", c.nombre, rec.Code, c.status, rec.Body)
+		}
+	}
+
+	// Sin reserva ni fecha se aparta el primer horario con lugar: la mañana
+	// ya está llena y en la tarde caben los 4 kg
+	if status, resp := llamar(t, crear, http.MethodPost, "/api/v1/pedidos", pedido(7, "")); status != http.StatusOK {
+		t.Fatalf("pedido sin reserva: status %d: %v", status, resp)
+	}
+	if got := m.Pedidos[2].Pedido.FechaEntrega.Time.Format("2006-01-02 15:04"); got != manana+" 13:00" {
+		t.Errorf("fecha_entrega = %s, se esperaba la tarde de mañana", got)
+	}
+	if id := m.Pedidos[2].Pedido.IDReserva; id == 0 || m.Reservas[id].IDPedido != 2 {
+		t.Errorf("el pedido sin reserva no ocupó lugar (id_reserva %d)", id)
+	}
+
+	// Si el pedido no se guarda, su apartado se libera
+	antes := len(m.Reservas)
+	m.Falla = func(op string) error {
+		if op == "Pedidos.Crear" {
+			return fmt.Errorf("conexión perdida")
+		}
+		return nil
+	}
+	if status, _ := llamar(t, crear, http.MethodPost, "/api/v1/pedidos", pedido(7, "")); status != http.StatusInternalServerError {
+		t.Errorf("falla al guardar: status %d", status)
+	}
+	if len(m.Reservas) != antes {
+		t.Errorf("quedaron %d reservas, se esperaban %d", len(m.Reservas), antes)
+	}
+}
+
+func TestPromesaDeEntrega(t *testing.T) {
+	m := memoriaConCatalogo()
+	m.ConfigEntregaJSON[repositorio.ClaveConfigEntrega{IDEmpresa: 1}] = []byte(`{"dias_habiles": ["LUNES", "MARTES", "MIERCOLES", "JUEVES", "VIERNES"],
+		"hora_corte": "14:00", "tiempos_categoria": [{"id_categoria": 7, "nombre": "Frescos", "dias_adicionales": 1}]}`)
+	m.Productos[10] = repositorio.ProductoMemoria{IDEmpresa: 1, Impuestos: repositorio.Impuestos{IVA: 16}, IDCategoria: 7}
+	repos := m.Repositorios()
+	zona, err := reloj.CargarZona(reloj.ZonaPredeterminada)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Jueves en la tarde; el lunes 16 es el día de la Revolución
+	ahora := reloj.NuevoFijo(time.Date(2026, time.November, 12, 15, 0, 0, 0, zona))
+	promesa, crear := conReloj(PromesaDeEntrega(repos), ahora), conReloj(CreatePedido(repos), ahora)
+
+	casos := []struct {
+		nombre      string
+		body        string
+		fecha       string
+		explicacion string
+	}{
+		{
+			nombre: "sin productos", body: `{"id_sucursal": 3}`, fecha: "2026-11-18 09:00:00",
+			explicacion: "pedido después de las 14:00 + 2 días hábiles + feriado 16/11 (Día de la Revolución)",
+		},
+		{
+			nombre: "con frescos", body: `{"id_sucursal": 3, "detalles": [{"id_producto": 20, "cantidad": 1}, {"id_producto": 10, "cantidad": 2}]}`,
+			fecha:       "2026-11-19 09:00:00",
+			explicacion: "pedido después de las 14:00 + 2 días hábiles + Frescos +1 día + feriado 16/11 (Día de la Revolución)",
+		},
+	}
+	for _, c := range casos {
+		status, resp := llamar(t, promesa, http.MethodPost, "/api/v1/entregas/promesa", c.body)
+		if status != http.StatusOK {
+			t.Fatalf("%s: status %d: %v", c.nombre, status, resp)
+		}
+		data := resp["data"].(map[string]interface{})
+		if data["fecha_entrega"] != c.fecha || data["explicacion"] != c.explicacion {
+			t.Errorf("%s: %v", c.nombre, data)
+		}
+	}
+	if status, _ := llamar(t, promesa, http.MethodPost, "/api/v1/entregas/promesa", `{"id_sucursal": 99}`); status != http.StatusNotFound {
+		t.Errorf("sucursal de otra empresa: status %d", status)
+	}
+
+	// El pedido guarda la misma explicación
+	status, resp := llamar(t, crear, http.MethodPost, "/api/v1/pedidos", `{"id_usuario": 5, "id_tienda": 9, "id_sucursal": 3, "id_metodo_pago": 1,
+		"detalles": [{"id_producto": 10, "cantidad": 1, "precio_unitario": 116}]}`)
+	if status != http.StatusOK {
+		t.Fatalf("pedido: status %d: %v", status, resp)
+	}
+	explicacion := casos[1].explicacion
+	if got := resp["data"].(map[string]interface{})["explicacion_entrega"]; got != explicacion {
+		t.Errorf("explicacion_entrega = %v", got)
+	}
+	if p := m.Pedidos[1].Pedido; p.ExplicacionEntrega != explicacion || p.FechaEntrega.Time.Format("2006-01-02 15:04") != "2026-11-19 09:00" {
+		t.Errorf("pedido: %q, %v", p.ExplicacionEntrega, p.FechaEntrega.Time)
+	}
+}
+
+func TestDisponibilidadHorario(t *testing.T) {
+	h := HorarioEntrega{Inicio: "09:00", Fin: "12:00", CapacidadPedidos: 3, CapacidadPeso: 50}
+	d := disponibilidadHorario(h, repositorio.Ocupacion{Pedidos: 1, Peso: 12.5})
+	if d["pedidos_disponibles"] != 2 || d["peso_disponible"] != 37.5 || d["disponible"] != true {
+		t.Errorf("con lugar: %v", d)
+	}
+	d = disponibilidadHorario(h, repositorio.Ocupacion{Pedidos: 3, Peso: 60})
+	if d["pedidos_disponibles"] != 0 || d["peso_disponible"] != 0.0 || d["disponible"] != false {
+		t.Errorf("lleno: %v", d)
+	}
+	d = disponibilidadHorario(HorarioEntrega{Inicio: "13:00"}, repositorio.Ocupacion{Pedidos: 40})
+	if d["pedidos_disponibles"] != nil || d["peso_disponible"] != nil || d["disponible"] != true {
+		t.Errorf("sin límite: %v", d)
+	}
+	if d["capacidad_pedidos"] != 0 || d["capacidad_peso"] != 0.0 {
+		t.Errorf("sin límite la capacidad es 0: %v", d)
+	}
+}
@@ -0,0 +1,242 @@
+package rutas
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/bitacora"
+	"github.com/WolfSlayer04/logica_tiendaenlina/db"
+	"github.com/WolfSlayer04/logica_tiendaenlina/metricas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/reloj"
+)
+
+// ---------------------------
+// ESTADO DEL SINCRONIZADOR
+// ---------------------------
+
+// estadoSincronizacion guarda en memoria el resultado de la última
+// sincronización para que /readyz no dependa de consultar el log. El detalle
+// de los errores sólo va al log: /readyz no pide autenticación.
+type estadoSincronizacion struct {
+	mu          sync.RWMutex
+	ultimoExito time.Time
+	ultimoError time.Time
+}
+
+// Mensajes fijos de /readyz; la causa de cada falla se escribe en el log.
+const (
+	errReadyzSinConexion  = "conexión no inicializada"
+	errReadyzSinRespuesta = "la base de datos no respondió"
+	errReadyzPendientes   = "no se pudo contar pedidos pendientes"
+	errReadyzPedido       = "falló la sincronización de un pedido"
+)
+
+var estadoSync estadoSincronizacion
+
+func (e *estadoSincronizacion) registrarExito(t time.Time) {
+	e.mu.Lock()
+	e.ultimoExito = t
+	e.mu.Unlock()
+}
+
+func (e *estadoSincronizacion) registrarError(t time.Time) {
+	e.mu.Lock()
+	e.ultimoError = t
+	e.mu.Unlock()
+}
+
+func (e *estadoSincronizacion) snapshot() (ultimoExito, ultimoError time.Time) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.ultimoExito, e.ultimoError
+}
+
+// ---------------------------
+// ESTRUCTURAS DE RESPUESTA
+// ---------------------------
+
+type ChequeoBD struct {
+	OK         bool    `json:"ok"`
+	LatenciaMS float64 `json:"latencia_ms"`
+	Error      string  `json:"error,omitempty"`
+	Pool       PoolBD  `json:"pool"`
+}
+
+type PoolBD struct {
+	MaxOpenConnections int     `json:"max_open_connections"`
+	OpenConnections    int     `json:"open_connections"`
+	InUse              int     `json:"in_use"`
+	Idle               int     `json:"idle"`
+	WaitCount          int64   `json:"wait_count"`
+	WaitDurationMS     float64 `json:"wait_duration_ms"`
+	MaxIdleClosed      int64   `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64   `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64   `json:"max_lifetime_closed"`
+}
+
+type ChequeoSincronizacion struct {
+	OK                   bool     `json:"ok"`
+	PedidosPendientes    int      `json:"pedidos_pendientes"`
+	UltimoExito          string   `json:"ultimo_exito,omitempty"`
+	SegundosDesdeExito   *float64 `json:"segundos_desde_exito"`
+	UltimoError          string   `json:"ultimo_error,omitempty"`
+	MensajeError         string   `json:"mensaje_error,omitempty"`
+	AtrasoMaximoSegundos float64  `json:"atraso_maximo_segundos"`
+	Error                string   `json:"error,omitempty"`
+}
+
+type ReadyzResponse struct {
+	Status         string                `json:"status"`
+	Local          ChequeoBD             `json:"local"`
+	Remote         ChequeoBD             `json:"remote"`
+	Sincronizacion ChequeoSincronizacion `json:"sincronizacion"`
+}
+
+// ---------------------------
+// ENDPOINT: /healthz (liveness)
+// ---------------------------
+
+// Healthz sólo indica que el proceso responde; no toca dependencias.
+func Healthz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	}
+}
+
+// ---------------------------
+// ENDPOINT: /readyz (readiness)
+// ---------------------------
+
+// Readyz revisa ambas bases de datos y el atraso del sincronizador. Responde
+// 503 si alguna revisión falla para que el orquestador deje de enrutar tráfico.
+func Readyz(dbc *db.DBConnection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeoutChequeo())
+		defer cancel()
+
+		resp := ReadyzResponse{
+			Local:  chequearBD(ctx, "local", dbc.Local),
+			Remote: chequearBD(ctx, "remote", dbc.Remote),
+		}
+		resp.Sincronizacion = chequearSincronizacion(ctx, dbc.Local, reloj.Desde(ctx).Ahora())
+
+		status := http.StatusOK
+		resp.Status = "ok"
+		if !resp.Local.OK || !resp.Remote.OK || !resp.Sincronizacion.OK {
+			status = http.StatusServiceUnavailable
+			resp.Status = "fail"
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func chequearBD(ctx context.Context, nombre string, conn *sql.DB) ChequeoBD {
+	var c ChequeoBD
+	if conn == nil {
+		c.Error = errReadyzSinConexion
+		return c
+	}
+	inicio := time.Now()
+	err := conn.PingContext(ctx)
+	c.LatenciaMS = float64(time.Since(inicio).Microseconds()) / 1000
+	if err != nil {
+		bitacora.Desde(ctx).Warn("readyz: la base de datos no respondió", "bd", nombre, "error", err)
+		c.Error = errReadyzSinRespuesta
+	} else {
+		c.OK = true
+	}
+	c.Pool = poolDesdeStats(conn.Stats())
+	return c
+}
+
+func poolDesdeStats(s sql.DBStats) PoolBD {
+	return PoolBD{
+		MaxOpenConnections: s.MaxOpenConnections,
+		OpenConnections:    s.OpenConnections,
+		InUse:              s.InUse,
+		Idle:               s.Idle,
+		WaitCount:          s.WaitCount,
+		WaitDurationMS:     float64(s.WaitDuration.Microseconds()) / 1000,
+		MaxIdleClosed:      s.MaxIdleClosed,
+		MaxIdleTimeClosed:  s.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  s.MaxLifetimeClosed,
+	}
+}
+
+// chequearSincronizacion falla sólo si hay pedidos pendientes y la última
+// sincronización exitosa es más vieja que SYNC_ATRASO_MAXIMO: sin pedidos nuevos
+// es normal que no haya sincronizaciones recientes.
+func chequearSincronizacion(ctx context.Context, local *sql.DB, ahora time.Time) ChequeoSincronizacion {
+	atrasoMax := atrasoMaximoSincronizacion()
+	c := ChequeoSincronizacion{AtrasoMaximoSegundos: atrasoMax.Seconds()}
+
+	if local == nil {
+		c.Error = errReadyzSinConexion
+		return c
+	}
+	err := local.QueryRowContext(ctx, `SELECT COUNT(*) FROM pedidos WHERE sincronizado = false OR sincronizado IS NULL`).Scan(&c.PedidosPendientes)
+	if err != nil {
+		bitacora.Desde(ctx).Warn("readyz: "+errReadyzPendientes, "error", err)
+		c.Error = errReadyzPendientes
+		return c
+	}
+	metricas.PedidosPendientes(c.PedidosPendientes)
+
+	ultimoExito, ultimoError := estadoSync.snapshot()
+	if ultimoExito.IsZero() {
+		// Aún no sincroniza este proceso: usa lo último registrado en BD.
+		// fecha_sincronizacion se guarda en UTC.
+		var fecha sql.NullString
+		if err := local.QueryRowContext(ctx, `SELECT MAX(fecha_sincronizacion) FROM pedidos WHERE sincronizado = true`).Scan(&fecha); err == nil && fecha.Valid {
+			if t, err := reloj.LeerBD(fecha.String, time.UTC); err == nil {
+				ultimoExito = t
+			}
+		}
+	}
+	if !ultimoExito.IsZero() {
+		c.UltimoExito = ultimoExito.UTC().Format(time.RFC3339)
+		seg := ahora.Sub(ultimoExito).Seconds()
+		c.SegundosDesdeExito = &seg
+	}
+	if !ultimoError.IsZero() {
+		c.UltimoError = ultimoError.UTC().Format(time.RFC3339)
+		c.MensajeError = errReadyzPedido
+	}
+
+	c.OK = true
+	if c.PedidosPendientes > 0 && (ultimoExito.IsZero() || ahora.Sub(ultimoExito) > atrasoMax) {
+		c.OK = false
+		c.Error = "hay pedidos pendientes y la última sincronización exitosa excede el atraso máximo"
+	}
+	return c
+}
+
+// atrasoMaximoSincronizacion lee SYNC_ATRASO_MAXIMO (duración de Go). Por defecto 15 minutos.
+func atrasoMaximoSincronizacion() time.Duration {
+	return duracionEnv("SYNC_ATRASO_MAXIMO", 15*time.Minute)
+}
+
+// timeoutChequeo lee READYZ_TIMEOUT (duración de Go). Por defecto 3 segundos.
+func timeoutChequeo() time.Duration {
+	return duracionEnv("READYZ_TIMEOUT", 3*time.Second)
+}
+
+func duracionEnv(nombre string, porDefecto time.Duration) time.Duration {
+	if v := os.Getenv(nombre); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return porDefecto
+}
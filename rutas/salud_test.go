@@ -0,0 +1,98 @@
+package rutas
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/bitacora"
+	"github.com/WolfSlayer04/logica_tiendaenlina/db"
+	"github.com/WolfSlayer04/logica_tiendaenlina/integracion"
+)
+
+func TestHealthz(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Healthz()(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("Cache-Control = %q", cc)
+	}
+	var resp map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp["status"] != "ok" {
+		t.Errorf("cuerpo = %s (%v)", rec.Body, err)
+	}
+}
+
+// readyz llama a Readyz con un logger en buffer y regresa la respuesta y lo
+// que se escribió en el log.
+func readyz(t *testing.T, dbc *db.DBConnection) (int, ReadyzResponse, string) {
+	t.Helper()
+	var log bytes.Buffer
+	req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+	req = req.WithContext(bitacora.ConLogger(req.Context(), slog.New(slog.NewJSONHandler(&log, nil))))
+	rec := httptest.NewRecorder()
+	Readyz(dbc)(rec, req)
+
+	var resp ReadyzResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("respuesta no es JSON: %v\n%s", err, rec.Body)
+	}
+	return rec.Code, resp, log.String()
+}
+
+func TestIntegracionReadyz(t *testing.T) {
+	t.Setenv("READYZ_TIMEOUT", "2s")
+	dbc := integracion.Iniciar(t)
+
+	t.Run("listo", func(t *testing.T) {
+		status, resp, _ := readyz(t, dbc)
+		if status != http.StatusOK || resp.Status != "ok" {
+			t.Fatalf("status = %d: %+v", status, resp)
+		}
+		if !resp.Local.OK || !resp.Remote.OK || !resp.Sincronizacion.OK {
+			t.Errorf("chequeos = %+v", resp)
+		}
+	})
+
+	t.Run("base caida", func(t *testing.T) {
+		// Nada escucha en el puerto 1: el ping falla con la dirección en el error
+		caida, err := sql.Open("mysql", "readyz:secreto@tcp(127.0.0.1:1)/tienda?timeout=1s")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer caida.Close()
+
+		status, resp, log := readyz(t, &db.DBConnection{Local: dbc.Local, Remote: caida})
+		if status != http.StatusServiceUnavailable || resp.Status != "fail" {
+			t.Fatalf("status = %d: %+v", status, resp)
+		}
+		if resp.Remote.OK || resp.Remote.Error != errReadyzSinRespuesta {
+			t.Errorf("remote = %+v, se esperaba el mensaje fijo", resp.Remote)
+		}
+		if !resp.Local.OK {
+			t.Errorf("local = %+v", resp.Local)
+		}
+		// La causa va al log, no a la respuesta
+		if !strings.Contains(log, "127.0.0.1:1") || !strings.Contains(log, `"bd":"remote"`) {
+			t.Errorf("el log no trae la causa: %s", log)
+		}
+	})
+
+	t.Run("sin conexion", func(t *testing.T) {
+		status, resp, _ := readyz(t, &db.DBConnection{})
+		if status != http.StatusServiceUnavailable {
+			t.Fatalf("status = %d", status)
+		}
+		if resp.Local.Error != errReadyzSinConexion || resp.Sincronizacion.Error != errReadyzSinConexion {
+			t.Errorf("respuesta = %+v", resp)
+		}
+	})
+}
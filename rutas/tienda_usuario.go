@@ -2,29 +2,45 @@ package rutas
 
 import (
     "net/http"
+    middlewares "github.com/WolfSlayer04/logica_tiendaenlina/Middleware"
     "github.com/WolfSlayer04/logica_tiendaenlina/db"
+    "github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+    "github.com/WolfSlayer04/logica_tiendaenlina/errores"
     "strconv"
     "database/sql"
 )
 
+// El cliente sólo ve su tienda; usuario sólo lo indica un admin.
 func GetTiendaByUsuario(dbc *db.DBConnection) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
+        idEmpresa, ok := empresas.Requerida(w, r)
+        if !ok {
+            return
+        }
         usuarioIDStr := r.URL.Query().Get("usuario")
+        if id, tipo, _, _, _ := middlewares.GetUserFromContext(r); tipo == "C" {
+            usuarioIDStr = strconv.Itoa(id)
+        }
         usuarioID, err := strconv.Atoi(usuarioIDStr)
         if err != nil || usuarioID <= 0 {
-            writeErrorResponse(w, http.StatusBadRequest, "ID de usuario inválido", "")
+            errores.Escribir(w, r, errores.Validacion(errores.Invalido("usuario")))
             return
         }
 
-        // Incluye latitud, longitud y extrae de ST_Y/ST_X para POINT.
-        row := dbc.Local.QueryRow(`
+        // Incluye latitud, longitud y extrae de ST_Y/ST_X para POINT. Con varias
+        // tiendas regresa la activa del usuario.
+        row := dbc.Local.QueryRowContext(r.Context(), `
             SELECT 
                 id_tienda, id_usuario, id_empresa, nombre_tienda, razon_social, rfc, direccion, colonia, codigo_postal, ciudad, estado, pais, tipo_tienda, estatus,
                 latitud, longitud, 
                 IFNULL(ST_Y(ubicacion), 0) AS latitud_ubic, IFNULL(ST_X(ubicacion), 0) AS longitud_ubic
             FROM tiendas 
-            WHERE id_usuario = ? LIMIT 1
-        `, usuarioID)
+            WHERE id_usuario = ? AND id_empresa = ?
+            ORDER BY estatus = 'activo' DESC,
+                     id_tienda = (SELECT IFNULL(id_tienda_activa, 0) FROM usuarios WHERE id_usuario = ? AND id_empresa = ?) DESC,
+                     id_tienda
+            LIMIT 1
+        `, usuarioID, idEmpresa, usuarioID, idEmpresa)
 
         var t tiendaRow
         var lat sql.NullFloat64
@@ -37,7 +53,7 @@ func GetTiendaByUsuario(dbc *db.DBConnection) http.HandlerFunc {
             &lat, &lon, &latPoint, &lonPoint,
         )
         if err != nil {
-            writeErrorResponse(w, http.StatusNotFound, "No se encontró la tienda para este usuario", err.Error())
+            errores.Escribir(w, r, errores.Nuevo(errores.TiendaNoEncontrada).Con("No se encontró la tienda para este usuario", err))
             return
         }
 
@@ -0,0 +1,222 @@
+package rutas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	middlewares "github.com/WolfSlayer04/logica_tiendaenlina/Middleware"
+	"github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+	"github.com/WolfSlayer04/logica_tiendaenlina/reloj"
+	"github.com/WolfSlayer04/logica_tiendaenlina/repositorio"
+	"github.com/WolfSlayer04/logica_tiendaenlina/validacion"
+)
+
+// tiendaActiva regresa la tienda con la que trabaja el cliente de la sesión:
+// la del encabezado X-Tienda, la del token o, si no eligió ninguna, la que
+// tiene marcada como activa. Si la tienda no es suya escribe el error y
+// regresa false.
+func tiendaActiva(w http.ResponseWriter, r *http.Request, repos repositorio.Repositorios, idEmpresa int) (int, bool) {
+	if idTienda := middlewares.GetTiendaFromContext(r); idTienda != 0 {
+		return idTienda, tiendaPermitida(w, r, repos, idEmpresa, idTienda)
+	}
+	idUsuario, _, _, _, _ := middlewares.GetUserFromContext(r)
+	t, err := repos.Tiendas.PorUsuario(r.Context(), int64(idUsuario))
+	if errors.Is(err, repositorio.ErrNoEncontrado) {
+		errores.Escribir(w, r, errores.Nuevo(errores.TiendaNoEncontrada))
+		return 0, false
+	} else if err != nil {
+		errores.Escribir(w, r, errores.Interno("No se pudo obtener la tienda", err))
+		return 0, false
+	}
+	return t.IDTienda, true
+}
+
+// escribirTienda responde con la tienda tal como queda guardada.
+func escribirTienda(w http.ResponseWriter, r *http.Request, repos repositorio.Repositorios, idEmpresa, idTienda int, mensaje string) {
+	t, err := repos.Tiendas.Obtener(r.Context(), idEmpresa, idTienda)
+	if errors.Is(err, repositorio.ErrNoEncontrado) {
+		errores.Escribir(w, r, errores.Nuevo(errores.TiendaNoEncontrada))
+		return
+	} else if err != nil {
+		errores.Escribir(w, r, errores.Interno("Error al obtener la tienda", err))
+		return
+	}
+	writeSuccessResponse(w, mensaje, tiendaDataDe(t))
+}
+
+// CreateTienda agrega una tienda a un cliente que ya está registrado: al de
+// la sesión o, si pide un administrador, al de id_usuario. Igual que en el
+// registro, la tienda queda en la sucursal que cubre su ubicación y es su
+// propio cliente de esa sucursal en el ERP, salvo que la sucursal ya tenga
+// como cliente otra tienda suya con el mismo RFC: entonces se liga a ése.
+func CreateTienda(repos repositorio.Repositorios) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		var req TiendaRequest
+		if err := validacion.Decodificar(w, r, &req); err != nil {
+			errores.Escribir(w, r, err)
+			return
+		}
+		idUsuario, tipo, _, _, _ := middlewares.GetUserFromContext(r)
+		if tipo == "A" {
+			if req.IDUsuario <= 0 {
+				errores.Escribir(w, r, errores.Validacion(errores.Requerido("id_usuario")))
+				return
+			}
+			idUsuario = req.IDUsuario
+		}
+		u, err := repos.Usuarios.PorID(r.Context(), int64(idUsuario))
+		if errors.Is(err, repositorio.ErrNoEncontrado) || (err == nil && u.IDEmpresa != idEmpresa) {
+			errores.Escribir(w, r, errores.Nuevo(errores.UsuarioNoEncontrado))
+			return
+		} else if err != nil {
+			errores.Escribir(w, r, errores.Interno("No se pudo obtener el usuario", err))
+			return
+		}
+
+		// Se busca antes de crear el cliente remoto para no dejarlo huérfano en
+		// el ERP; el cliente es de la sucursal que atiende la tienda
+		sucursal, err := repos.Sucursales.PorUbicacion(r.Context(), idEmpresa, req.Latitud, req.Longitud)
+		if err != nil {
+			errores.Escribir(w, r, errores.Nuevo(errores.UbicacionSinCobertura))
+			return
+		}
+		idRemoto, claveRemota, err := clienteRemotoTienda(r.Context(), repos.Sync, sucursal.IDSucursal, req, u.Telefono)
+		if errors.Is(err, repositorio.ErrClienteRemotoExistente) {
+			idRemoto, claveRemota, err = clienteRemotoPropio(r.Context(), repos, u.IDUsuario, sucursal.IDSucursal, req)
+		}
+		if errors.Is(err, repositorio.ErrClienteRemotoExistente) {
+			errores.Escribir(w, r, errores.Nuevo(errores.ClienteRemotoExistente))
+			return
+		} else if err != nil {
+			errores.Escribir(w, r, errores.Interno("No se pudo guardar cliente en remota", err))
+			return
+		}
+
+		tienda := nuevaTienda(idEmpresa, sucursal, req, reloj.Desde(r.Context()).Ahora())
+		tienda.IDRemoto = idRemoto
+		tienda.ClaveRemota = claveRemota
+		idTienda, err := repos.Tiendas.Crear(r.Context(), u.IDUsuario, tienda)
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al crear la tienda", err))
+			return
+		}
+		escribirTienda(w, r, repos, idEmpresa, idTienda, "Tienda creada correctamente")
+	}
+}
+
+// clienteRemotoPropio regresa el cliente que la sucursal ya tiene con el RFC
+// o el nombre de la tienda si es el de otra tienda del mismo usuario (la
+// misma razón social en la misma sucursal); si es de alguien más,
+// ErrClienteRemotoExistente.
+func clienteRemotoPropio(ctx context.Context, repos repositorio.Repositorios, idUsuario int64, idSucursal int, t TiendaRequest) (int64, string, error) {
+	existente, err := repos.Sync.BuscarClienteRemoto(ctx, idSucursal, t.RFC, t.NombreTienda)
+	if errors.Is(err, repositorio.ErrNoEncontrado) {
+		return 0, "", repositorio.ErrClienteRemotoExistente
+	} else if err != nil {
+		return 0, "", err
+	}
+	tiendas, err := repos.Tiendas.DeUsuario(ctx, idUsuario)
+	if err != nil {
+		return 0, "", err
+	}
+	for _, ti := range tiendas {
+		if ti.IDRemoto == existente.IDCliente {
+			return existente.IDCliente, existente.Clave, nil
+		}
+	}
+	return 0, "", repositorio.ErrClienteRemotoExistente
+}
+
+// UpdateTienda reemplaza los datos de una tienda. Si la nueva ubicación la
+// cubre otra sucursal, la tienda se mueve a ella y el cambio queda en su
+// historial de movimientos. El cliente remoto no se modifica.
+func UpdateTienda(repos repositorio.Repositorios) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		idTienda, ok := tiendaDeRuta(w, r, repos, idEmpresa)
+		if !ok {
+			return
+		}
+		var req TiendaRequest
+		if err := validacion.Decodificar(w, r, &req); err != nil {
+			errores.Escribir(w, r, err)
+			return
+		}
+		sucursal, err := repos.Sucursales.PorUbicacion(r.Context(), idEmpresa, req.Latitud, req.Longitud)
+		if err != nil {
+			errores.Escribir(w, r, errores.Nuevo(errores.UbicacionSinCobertura))
+			return
+		}
+		idAdmin := 0
+		if idUsuario, tipo, _, _, _ := middlewares.GetUserFromContext(r); tipo == "A" {
+			idAdmin = idUsuario
+		}
+		ahora := reloj.Desde(r.Context()).Ahora()
+		movimiento, err := repos.Tiendas.Actualizar(r.Context(), idTienda, nuevaTienda(idEmpresa, sucursal, req, ahora), idAdmin, ahora)
+		if errors.Is(err, repositorio.ErrNoEncontrado) {
+			errores.Escribir(w, r, errores.Nuevo(errores.TiendaNoEncontrada))
+			return
+		} else if err != nil {
+			errores.Escribir(w, r, errores.Interno("No se pudo actualizar la tienda", err))
+			return
+		}
+		mensaje := "Tienda actualizada"
+		if movimiento != nil {
+			mensaje = fmt.Sprintf("Tienda actualizada; ahora la atiende la sucursal %s", movimiento.SucursalNueva)
+		}
+		escribirTienda(w, r, repos, idEmpresa, idTienda, mensaje)
+	}
+}
+
+// ActivarTienda cambia la tienda activa del cliente de la sesión y regresa un
+// access_token nuevo que la lleva. La elección se guarda: el siguiente login
+// empieza con ella.
+func ActivarTienda(repos repositorio.Repositorios) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		idUsuario, tipo, correo, _, _ := middlewares.GetUserFromContext(r)
+		if tipo != "C" {
+			errores.Escribir(w, r, errores.Nuevo(errores.SinPermiso).Con("Sólo un cliente tiene tienda activa", nil))
+			return
+		}
+		idTienda, ok := tiendaDeRuta(w, r, repos, idEmpresa)
+		if !ok {
+			return
+		}
+		if err := repos.Tiendas.Activar(r.Context(), int64(idUsuario), idTienda); errors.Is(err, repositorio.ErrNoEncontrado) {
+			errores.Escribir(w, r, errores.Nuevo(errores.TiendaNoEncontrada))
+			return
+		} else if err != nil {
+			errores.Escribir(w, r, errores.Interno("No se pudo cambiar la tienda activa", err))
+			return
+		}
+		t, err := repos.Tiendas.Obtener(r.Context(), idEmpresa, idTienda)
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al obtener la tienda", err))
+			return
+		}
+		// La sesión (refresh token) sigue siendo la misma
+		accessToken, _, _, err := generarTokens(reloj.Desde(r.Context()).Ahora(), idUsuario, tipo, correo, idEmpresa, idTienda)
+		if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error generando tokens", err))
+			return
+		}
+		writeSuccessResponse(w, "Tienda activa cambiada", map[string]interface{}{
+			"tienda":       tiendaDataDe(t),
+			"access_token": accessToken,
+		})
+	}
+}
@@ -4,9 +4,13 @@ import (
     "encoding/json"
     "net/http"
     "strconv"
-    "log"
 
+    middlewares "github.com/WolfSlayer04/logica_tiendaenlina/Middleware"
+    "github.com/WolfSlayer04/logica_tiendaenlina/bitacora"
     "github.com/WolfSlayer04/logica_tiendaenlina/db"
+    "github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+    "github.com/WolfSlayer04/logica_tiendaenlina/errores"
+    "github.com/WolfSlayer04/logica_tiendaenlina/validacion"
 )
 
 // Modelo para admin_usuarios (lectura)
@@ -20,11 +24,20 @@ type AdminUsuarioUser struct {
 
 // Modelo para crear admin_usuarios (debe coincidir con el frontend)
 type AdminUsuarioCreate struct {
-    IDPerfil    int    `json:"idperfil"`
-    Permisos    string `json:"permisos"`    // Como string, no RawMessage
-    TipoUsuario string `json:"tipo_usuario"`
-    Correo      string `json:"correo"`
-    Clave       string `json:"clave"`
+    IDPerfil    int    `json:"idperfil" valida:"no_negativo"`
+    Permisos    string `json:"permisos" valida:"requerido"` // Como string, no RawMessage
+    TipoUsuario string `json:"tipo_usuario" valida:"requerido"`
+    Correo      string `json:"correo" valida:"requerido,correo"`
+    Clave       string `json:"clave"` // sólo al crear; la edición no cambia la clave
+}
+
+// filtroAdminEmpresa limita el UPDATE o DELETE de admin_usuarios a los de la
+// empresa; los del grupo (idempresa NULL) sólo los toca un admin del grupo.
+func filtroAdminEmpresa(r *http.Request) string {
+    if middlewares.EsAdminDelGrupo(r) {
+        return "(idempresa IS NULL OR idempresa = ?)"
+    }
+    return "idempresa = ?"
 }
 
 // ===================
@@ -32,10 +45,14 @@ type AdminUsuarioCreate struct {
 // ===================
 func GetAllAdminUsuarios(dbConn *db.DBConnection) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
-        rows, err := dbConn.Local.Query("SELECT idusuario, idperfil, permisos, tipo_usuario, correo FROM admin_usuarios")
+        idEmpresa, ok := empresas.Requerida(w, r)
+        if !ok {
+            return
+        }
+        // Los administradores sin empresa (NULL) son de todo el grupo y se ven en todas
+        rows, err := dbConn.Local.QueryContext(r.Context(), "SELECT idusuario, idperfil, permisos, tipo_usuario, correo, IFNULL(idempresa, 0) FROM admin_usuarios WHERE idempresa IS NULL OR idempresa = ?", idEmpresa)
         if err != nil {
-            log.Printf("Error obteniendo administradores: %v", err)
-            http.Error(w, "Error obteniendo administradores", http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("Error obteniendo administradores", err))
             return
         }
         defer rows.Close()
@@ -44,9 +61,8 @@ func GetAllAdminUsuarios(dbConn *db.DBConnection) http.HandlerFunc {
         for rows.Next() {
             var a AdminUsuario
             var permisosStr string
-            if err := rows.Scan(&a.IDUsuario, &a.IDPerfil, &permisosStr, &a.TipoUsuario, &a.Correo); err != nil {
-                log.Printf("Error escaneando admin: %v", err)
-                http.Error(w, "Error escaneando admin", http.StatusInternalServerError)
+            if err := rows.Scan(&a.IDUsuario, &a.IDPerfil, &permisosStr, &a.TipoUsuario, &a.Correo, &a.IDEmpresa); err != nil {
+                errores.Escribir(w, r, errores.Interno("Error escaneando admin", err))
                 return
             }
             a.Permisos = json.RawMessage(permisosStr)
@@ -63,38 +79,29 @@ func GetAllAdminUsuarios(dbConn *db.DBConnection) http.HandlerFunc {
 // ===================
 func CreateAdminUsuario(dbConn *db.DBConnection) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
+        idEmpresa, ok := empresas.Requerida(w, r)
+        if !ok {
+            return
+        }
         var nuevo AdminUsuarioCreate
-        if err := json.NewDecoder(r.Body).Decode(&nuevo); err != nil {
-            log.Printf("Error decodificando JSON: %v", err)
-            http.Error(w, "JSON inválido: "+err.Error(), http.StatusBadRequest)
+        if err := validacion.Leer(w, r, &nuevo); err != nil {
+            errores.Escribir(w, r, err)
             return
         }
 
-        // Log para debug
-        log.Printf("Datos recibidos: %+v", nuevo)
+        // Sin la clave: nunca debe llegar a los logs
+        bitacora.Desde(r.Context()).Debug("alta de administrador", "correo", nuevo.Correo, "idperfil", nuevo.IDPerfil, "tipo_usuario", nuevo.TipoUsuario)
 
-        // Validación básica
-        if nuevo.Correo == "" {
-            http.Error(w, "El correo es obligatorio", http.StatusBadRequest)
-            return
-        }
+        campos := validacion.Validar(&nuevo)
         if nuevo.Clave == "" {
-            http.Error(w, "La contraseña es obligatoria", http.StatusBadRequest)
-            return
+            campos = append(campos, errores.Requerido("clave"))
         }
-        if nuevo.TipoUsuario == "" {
-            http.Error(w, "El tipo de usuario es obligatorio", http.StatusBadRequest)
-            return
-        }
-        if nuevo.Permisos == "" {
-            http.Error(w, "Los permisos son obligatorios", http.StatusBadRequest)
-            return
+        // Permisos debe ser JSON válido
+        if nuevo.Permisos != "" && !json.Valid([]byte(nuevo.Permisos)) {
+            campos = append(campos, errores.Invalido("permisos"))
         }
-
-        // Validar que permisos sea JSON válido
-        var permisosTest interface{}
-        if err := json.Unmarshal([]byte(nuevo.Permisos), &permisosTest); err != nil {
-            http.Error(w, "Los permisos deben ser JSON válido", http.StatusBadRequest)
+        if len(campos) > 0 {
+            errores.Escribir(w, r, errores.Validacion(campos...))
             return
         }
 
@@ -105,25 +112,23 @@ func CreateAdminUsuario(dbConn *db.DBConnection) http.HandlerFunc {
 
         // Validar correo único
         var existe int
-        err := dbConn.Local.QueryRow("SELECT COUNT(*) FROM admin_usuarios WHERE correo = ?", nuevo.Correo).Scan(&existe)
+        err := dbConn.Local.QueryRowContext(r.Context(), "SELECT COUNT(*) FROM admin_usuarios WHERE correo = ?", nuevo.Correo).Scan(&existe)
         if err != nil {
-            log.Printf("Error validando correo: %v", err)
-            http.Error(w, "Error validando correo", http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("Error validando correo", err))
             return
         }
         if existe > 0 {
-            http.Error(w, "El correo ya está registrado", http.StatusBadRequest)
+            errores.Escribir(w, r, errores.Nuevo(errores.CorreoRegistrado))
             return
         }
 
         // Insertar en base de datos
-        res, err := dbConn.Local.Exec(
-            "INSERT INTO admin_usuarios (idperfil, permisos, tipo_usuario, correo, clave) VALUES (?, ?, ?, ?, ?)",
-            nuevo.IDPerfil, nuevo.Permisos, nuevo.TipoUsuario, nuevo.Correo, nuevo.Clave,
+        res, err := dbConn.Local.ExecContext(r.Context(), 
+            "INSERT INTO admin_usuarios (idempresa, idperfil, permisos, tipo_usuario, correo, clave) VALUES (?, ?, ?, ?, ?, ?)",
+            idEmpresa, nuevo.IDPerfil, nuevo.Permisos, nuevo.TipoUsuario, nuevo.Correo, nuevo.Clave,
         )
         if err != nil {
-            log.Printf("Error creando admin: %v", err)
-            http.Error(w, "Error al crear admin: "+err.Error(), http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("Error al crear admin", err))
             return
         }
         
@@ -142,36 +147,43 @@ func CreateAdminUsuario(dbConn *db.DBConnection) http.HandlerFunc {
 // ===================
 func UpdateAdminUsuario(dbConn *db.DBConnection) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
+        idEmpresa, ok := empresas.Requerida(w, r)
+        if !ok {
+            return
+        }
         idStr := r.URL.Query().Get("id")
         id, err := strconv.Atoi(idStr)
         if err != nil {
-            http.Error(w, "ID inválido", http.StatusBadRequest)
+            errores.Escribir(w, r, errores.Validacion(errores.Invalido("id")).Con("ID inválido", err))
             return
         }
         
         var upd AdminUsuarioCreate
-        if err := json.NewDecoder(r.Body).Decode(&upd); err != nil {
-            log.Printf("Error decodificando JSON para actualización: %v", err)
-            http.Error(w, "JSON inválido", http.StatusBadRequest)
+        if err := validacion.Leer(w, r, &upd); err != nil {
+            errores.Escribir(w, r, err)
             return
         }
 
-        // Validar que permisos sea JSON válido si se proporciona
-        if upd.Permisos != "" {
-            var permisosTest interface{}
-            if err := json.Unmarshal([]byte(upd.Permisos), &permisosTest); err != nil {
-                http.Error(w, "Los permisos deben ser JSON válido", http.StatusBadRequest)
-                return
-            }
+        // El UPDATE reescribe todos los campos, así que se exigen igual que al crear
+        campos := validacion.Validar(&upd)
+        if upd.Permisos != "" && !json.Valid([]byte(upd.Permisos)) {
+            campos = append(campos, errores.Invalido("permisos"))
+        }
+        if len(campos) > 0 {
+            errores.Escribir(w, r, errores.Validacion(campos...))
+            return
         }
 
-        _, err = dbConn.Local.Exec(
-            "UPDATE admin_usuarios SET idperfil=?, permisos=?, tipo_usuario=?, correo=? WHERE idusuario=?",
-            upd.IDPerfil, upd.Permisos, upd.TipoUsuario, upd.Correo, id,
+        res, err := dbConn.Local.ExecContext(r.Context(), 
+            "UPDATE admin_usuarios SET idperfil=?, permisos=?, tipo_usuario=?, correo=? WHERE idusuario=? AND "+filtroAdminEmpresa(r),
+            upd.IDPerfil, upd.Permisos, upd.TipoUsuario, upd.Correo, id, idEmpresa,
         )
         if err != nil {
-            log.Printf("Error actualizando admin: %v", err)
-            http.Error(w, "Error actualizando admin", http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("Error actualizando admin", err))
+            return
+        }
+        if n, err := res.RowsAffected(); err != nil || n == 0 {
+            errores.Escribir(w, r, errores.Nuevo(errores.UsuarioNoEncontrado).Con("Administrador sin cambios", err))
             return
         }
         
@@ -188,10 +200,14 @@ func UpdateAdminUsuario(dbConn *db.DBConnection) http.HandlerFunc {
 // ===================
 func DeleteAdminUsuario(dbConn *db.DBConnection) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
+        idEmpresa, ok := empresas.Requerida(w, r)
+        if !ok {
+            return
+        }
         idStr := r.URL.Query().Get("id")
         id, err := strconv.Atoi(idStr)
         if err != nil {
-            http.Error(w, "ID inválido", http.StatusBadRequest)
+            errores.Escribir(w, r, errores.Validacion(errores.Invalido("id")).Con("ID inválido", err))
             return
         }
 
@@ -205,10 +221,13 @@ func DeleteAdminUsuario(dbConn *db.DBConnection) http.HandlerFunc {
             return
         }
         
-        _, err = dbConn.Local.Exec("DELETE FROM admin_usuarios WHERE idusuario=?", id)
+        res, err := dbConn.Local.ExecContext(r.Context(), "DELETE FROM admin_usuarios WHERE idusuario=? AND "+filtroAdminEmpresa(r), id, idEmpresa)
         if err != nil {
-            log.Printf("Error eliminando admin: %v", err)
-            http.Error(w, "Error eliminando admin", http.StatusInternalServerError)
+            errores.Escribir(w, r, errores.Interno("Error eliminando admin", err))
+            return
+        }
+        if n, err := res.RowsAffected(); err != nil || n == 0 {
+            errores.Escribir(w, r, errores.Nuevo(errores.UsuarioNoEncontrado).Con("Administrador no eliminado", err))
             return
         }
         
@@ -1,17 +1,21 @@
 package rutas
 
 import (
-	"crypto/md5"
+	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
 	"math/rand"
 	"net/http"
-	"strings"
 	"time"
 
+	"github.com/WolfSlayer04/logica_tiendaenlina/avisos"
 	"github.com/WolfSlayer04/logica_tiendaenlina/db"
+	"github.com/WolfSlayer04/logica_tiendaenlina/empresas"
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+	"github.com/WolfSlayer04/logica_tiendaenlina/reloj"
+	"github.com/WolfSlayer04/logica_tiendaenlina/repositorio"
+	"github.com/WolfSlayer04/logica_tiendaenlina/validacion"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -46,10 +50,10 @@ func NullToFloat(nf sql.NullFloat64) float64 {
 
 type UsuarioRequest struct {
 	TipoUsuario    string `json:"tipo_usuario"`
-	NombreCompleto string `json:"nombre_completo"`
-	Correo         string `json:"correo"`
-	Telefono       string `json:"telefono"`
-	Clave          string `json:"clave"`
+	NombreCompleto string `json:"nombre_completo" valida:"requerido"`
+	Correo         string `json:"correo" valida:"requerido,correo"`
+	Telefono       string `json:"telefono" valida:"telefono"`
+	Clave          string `json:"clave" valida:"requerido,min=6"`
 }
 
 type usuarioRow struct {
@@ -76,39 +80,144 @@ func generarClaveAleatoria() string {
 	return fmt.Sprintf("%06d", rand.Intn(1000000))
 }
 
+// nuevoUsuario arma el usuario por guardar con los datos de la petición, la
+// clave ya encriptada y su cliente remoto.
+func nuevoUsuario(idEmpresa int, u UsuarioRequest, idRemoto int64, claveRemota string, ahora time.Time) repositorio.NuevoUsuario {
+	return repositorio.NuevoUsuario{
+		IDEmpresa:      idEmpresa,
+		TipoUsuario:    u.TipoUsuario,
+		NombreCompleto: u.NombreCompleto,
+		Correo:         u.Correo,
+		Telefono:       u.Telefono,
+		Clave:          u.Clave,
+		ClaveRemota:    claveRemota,
+		IDRemoto:       idRemoto,
+		FechaRegistro:  ahora,
+	}
+}
+
 // ---------------------------
 // TIENDAS
 // ---------------------------
 
 type TiendaRequest struct {
 	IDUsuario    int     `json:"id_usuario"`
-	NombreTienda string  `json:"nombre_tienda"`
+	NombreTienda string  `json:"nombre_tienda" valida:"requerido"`
 	RazonSocial  string  `json:"razon_social"`
-	RFC          string  `json:"rfc"`
-	Direccion    string  `json:"direccion"`
+	RFC          string  `json:"rfc" valida:"rfc"`
+	Direccion    string  `json:"direccion" valida:"requerido"`
 	Colonia      string  `json:"colonia"`
-	CodigoPostal string  `json:"codigo_postal"`
+	CodigoPostal string  `json:"codigo_postal" valida:"requerido,cp"`
 	Ciudad       string  `json:"ciudad"`
 	Estado       string  `json:"estado"`
 	Pais         string  `json:"pais"`
 	TipoTienda   string  `json:"tipo_tienda"`
-	Latitud      float64 `json:"latitud"`
-	Longitud     float64 `json:"longitud"`
+	Latitud      float64 `json:"latitud" valida:"latitud"`
+	Longitud     float64 `json:"longitud" valida:"longitud"`
 }
 
 type tiendaData struct {
-	IDTienda     int     `json:"id_tienda"`
-	NombreTienda string  `json:"nombre_tienda"`
-	Direccion    string  `json:"direccion"`
-	Colonia      string  `json:"colonia"`
-	CodigoPostal string  `json:"codigo_postal"`
-	Ciudad       string  `json:"ciudad"`
-	Estado       string  `json:"estado"`
-	Pais         string  `json:"pais"`
-	Latitud      float64 `json:"latitud"`
-	Longitud     float64 `json:"longitud"`
-	LatitudUbic  float64 `json:"latitud_ubic"`
-	LongitudUbic float64 `json:"longitud_ubic"`
+	IDTienda       int     `json:"id_tienda"`
+	IDSucursal     int     `json:"idsucursal"`
+	NombreSucursal string  `json:"nombre_sucursal"`
+	NombreTienda   string  `json:"nombre_tienda"`
+	Direccion      string  `json:"direccion"`
+	Colonia        string  `json:"colonia"`
+	CodigoPostal   string  `json:"codigo_postal"`
+	Ciudad         string  `json:"ciudad"`
+	Estado         string  `json:"estado"`
+	Pais           string  `json:"pais"`
+	Latitud        float64 `json:"latitud"`
+	Longitud       float64 `json:"longitud"`
+	LatitudUbic    float64 `json:"latitud_ubic"`
+	LongitudUbic   float64 `json:"longitud_ubic"`
+	IDRemoto       int     `json:"id_remoto"`
+	ClaveRemota    string  `json:"clave_remota"`
+}
+
+func tiendaDataDe(t repositorio.Tienda) tiendaData {
+	return tiendaData{
+		IDTienda:       t.IDTienda,
+		IDSucursal:     t.IDSucursal,
+		NombreSucursal: t.NombreSucursal,
+		NombreTienda:   t.NombreTienda,
+		Direccion:      t.Direccion,
+		Colonia:        t.Colonia,
+		CodigoPostal:   t.CodigoPostal,
+		Ciudad:         t.Ciudad,
+		Estado:         t.Estado,
+		Pais:           t.Pais,
+		Latitud:        t.Latitud,
+		Longitud:       t.Longitud,
+		LatitudUbic:    t.LatitudUbic,
+		LongitudUbic:   t.LongitudUbic,
+		IDRemoto:       int(t.IDRemoto),
+		ClaveRemota:    t.ClaveRemota,
+	}
+}
+
+// tiendasLogin regresa la tienda activa del usuario y todas sus tiendas
+// activas, la activa primero. Un usuario sin tienda regresa la tienda en
+// ceros y la lista vacía.
+func tiendasLogin(ctx context.Context, tiendas repositorio.TiendaRepo, idUsuario int64) (tiendaData, []tiendaData, error) {
+	ts, err := tiendas.DeUsuario(ctx, idUsuario)
+	if err != nil {
+		return tiendaData{}, nil, err
+	}
+	lista := []tiendaData{}
+	for _, t := range ts {
+		lista = append(lista, tiendaDataDe(t))
+	}
+	if len(lista) == 0 {
+		return tiendaData{}, lista, nil
+	}
+	return lista[0], lista, nil
+}
+
+// nuevaTienda arma la tienda por guardar con los datos de la petición y la
+// sucursal que le toca por su ubicación.
+func nuevaTienda(idEmpresa int, sucursal repositorio.SucursalAsignada, t TiendaRequest, ahora time.Time) repositorio.NuevaTienda {
+	return repositorio.NuevaTienda{
+		IDEmpresa:      idEmpresa,
+		IDSucursal:     sucursal.IDSucursal,
+		NombreSucursal: sucursal.Nombre,
+		NombreTienda:   t.NombreTienda,
+		RazonSocial:    t.RazonSocial,
+		RFC:            t.RFC,
+		Direccion:      t.Direccion,
+		Colonia:        t.Colonia,
+		CodigoPostal:   t.CodigoPostal,
+		Ciudad:         t.Ciudad,
+		Estado:         t.Estado,
+		Pais:           t.Pais,
+		TipoTienda:     t.TipoTienda,
+		Latitud:        t.Latitud,
+		Longitud:       t.Longitud,
+		FechaRegistro:  ahora,
+	}
+}
+
+// clienteRemotoTienda da de alta la tienda como cliente de la sucursal en
+// crm_clientes y regresa su id_cliente y la clave aleatoria con la que se creó.
+func clienteRemotoTienda(ctx context.Context, sync repositorio.SyncRepo, idSucursal int, t TiendaRequest, telefono string) (int64, string, error) {
+	clave := generarClaveAleatoria()
+	id, err := sync.CrearClienteRemoto(ctx, repositorio.ClienteRemoto{
+		IDSucursal:      idSucursal,
+		Clave:           clave,
+		NombreComercial: t.NombreTienda,
+		RazonSocial:     t.RazonSocial,
+		RFC:             t.RFC,
+		Direccion:       t.Direccion,
+		Calle:           t.Direccion,
+		Ciudad:          t.Ciudad,
+		Estado:          t.Estado,
+		CodigoPostal:    t.CodigoPostal,
+		Telefono:        telefono,
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	return id, clave, nil
 }
 
 type tiendaRow struct {
@@ -130,218 +239,36 @@ type tiendaRow struct {
 	Estatus        string
 }
 
-// ---------------------------
-// CREAR CLIENTE REMOTO (nombre_comercial = nombre_tienda, razon_social)
-// ---------------------------
-
-func BuscaClienteRemoto(
-	dbc *sql.DB,
-	idsucursal int,
-	clave string,
-	nombreComercial string,
-	razonSocial string,
-	rfc string,
-	direccion string,
-	calle string,
-	numero string,
-	ciudad string,
-	estado string,
-	cp string,
-	telefono string,
-) (idCliente int64, err error) {
-	// 1. Buscar por RFC si se proporciona
-	if rfc != "" {
-		err = dbc.QueryRow(`
-			SELECT id_cliente FROM crm_clientes
-			WHERE idsucursal = ? AND rfc = ? AND estatus = 'S' LIMIT 1
-		`, idsucursal, rfc).Scan(&idCliente)
-		if err == nil {
-			return 0, fmt.Errorf("Ya existe un cliente remoto con este RFC")
-		}
-		if err != sql.ErrNoRows {
-			return 0, fmt.Errorf("error buscando cliente por RFC: %w", err)
-		}
-	}
-
-	// 2. Buscar por nombre_comercial si no se encontró por RFC
-	if nombreComercial != "" {
-		err = dbc.QueryRow(`
-			SELECT id_cliente FROM crm_clientes
-			WHERE idsucursal = ? AND nombre_comercial = ? AND estatus = 'S' LIMIT 1
-		`, idsucursal, nombreComercial).Scan(&idCliente)
-		if err == nil {
-			return 0, fmt.Errorf("Ya existe un cliente remoto con este nombre comercial")
-		}
-		if err != sql.ErrNoRows {
-			return 0, fmt.Errorf("error buscando cliente por nombre_comercial: %w", err)
-		}
-	}
-
-	// 3. Si no existe, obtener la colonia desde dirección (como en tu PHP)
-	colonia := ""
-	partes := strings.Split(strings.ReplaceAll(direccion, "\"", ""), ",")
-	for i := 0; i < len(partes); i++ {
-		if strings.HasPrefix(strings.TrimSpace(partes[i]), cp) && i > 0 {
-			colonia = strings.TrimSpace(partes[i-1])
-			break
-		}
-	}
-
-	// 4. Crear o actualizar correlativo en crm_indices
-	_, err = dbc.Exec(`
-		INSERT INTO crm_indices (idsucursal, idpedido, idcliente)
-		VALUES (?, 0, 1)
-		ON DUPLICATE KEY UPDATE idcliente = idcliente + 1
-	`, idsucursal)
-	if err != nil {
-		return 0, fmt.Errorf("error actualizando/creando índice de cliente: %w", err)
-	}
-
-	// 5. Obtener el nuevo correlativo
-	var correlativo int64
-	err = dbc.QueryRow(`
-		SELECT idcliente FROM crm_indices WHERE idsucursal = ?
-	`, idsucursal).Scan(&correlativo)
-	if err != nil {
-		return 0, fmt.Errorf("error obteniendo correlativo de cliente: %w", err)
-	}
-
-	// 6. Generar clave_mobile
-	claveMobile := fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintf("%d%s%s%d", time.Now().Unix(), clave, nombreComercial, rand.Intn(10000)))))
-
-	// 7. Insertar cliente en crm_clientes (agregando razon_social)
-	res, err := dbc.Exec(`
-		INSERT INTO crm_clientes (
-			id_cliente, idsucursal, estatus, clave_mobile, nombre_comercial, razon_social, rfc, idcliente, tipo_cliente, lista_precio,
-			ofi_calle, ofi_num_ext, ofi_colonia, ofi_ciudad, ofi_estado, ofi_cod_postal, tel_contacto, clave
-		) VALUES (
-			0, ?, 'S', ?, ?, ?, ?, ?, 'C', 1,
-			?, ?, ?, ?, ?, ?, ?, ?
-		)
-	`, idsucursal, claveMobile, nombreComercial, razonSocial, rfc, correlativo,
-		calle, numero, colonia, ciudad, estado, cp, telefono, clave)
-	if err != nil {
-		return 0, fmt.Errorf("error insertando cliente remoto: %w", err)
-	}
-	idCliente, err = res.LastInsertId()
-	if err != nil {
-		return 0, fmt.Errorf("error obteniendo id_cliente insertado: %w", err)
-	}
-	return idCliente, nil
-}
-
-// ---------------------------
-// Buscar sucursal por ubicación
-// ---------------------------
-
-// Cambia la firma de la función a recibir *db.DBConnection:
-func BuscarSucursalPorUbicacion(dbconn *db.DBConnection, idEmpresa int, lat, lng float64) (idsucursal int, nombreSucursal string, err error) {
-	rows, err := dbconn.Local.Query(`
-        SELECT idsucursal, sucursal, tipo_objeto, radio
-        FROM adm_sucursales
-        WHERE idempresa = ? AND estatus = 'S'
-    `, idEmpresa)
-	if err != nil {
-		return 0, "", err
-	}
-	defer rows.Close()
-
-	var (
-		bestCoberturaID     int
-		bestCoberturaNombre string
-		bestCoberturaDist   float64 = math.MaxFloat64
-
-		bestCercanoID     int
-		bestCercanoNombre string
-		bestCercanoDist   float64 = math.MaxFloat64
-	)
-
-	for rows.Next() {
-		var id int
-		var nombre, tipoObjeto string
-		var radio float64
-		if err := rows.Scan(&id, &nombre, &tipoObjeto, &radio); err != nil {
-			continue
-		}
-		if tipoObjeto == "N" {
-			// Ignorar sucursales sin georreferencia
-			continue
-		}
-		enCobertura, dist, err := db.SeActivoEstaAlerta(dbconn, "local", tipoObjeto, id, "E", radio, lat, lng)
-		if err != nil {
-			continue
-		}
-		// Si está en cobertura, guarda la más cercana dentro de cobertura
-		if enCobertura && dist < bestCoberturaDist {
-			bestCoberturaDist = dist
-			bestCoberturaID = id
-			bestCoberturaNombre = nombre
-		}
-		// Siempre guarda la sucursal más cercana, aunque no esté en cobertura
-		if dist < bestCercanoDist {
-			bestCercanoDist = dist
-			bestCercanoID = id
-			bestCercanoNombre = nombre
-		}
-	}
-	if bestCoberturaID > 0 {
-		return bestCoberturaID, bestCoberturaNombre, nil
-	}
-	if bestCercanoID > 0 {
-		return bestCercanoID, bestCercanoNombre, nil
-	}
-	return 0, "", fmt.Errorf("No hay sucursales válidas")
-}
-
 // ---------------------------
 // OBTENER USUARIO Y TIENDA COMO EN LOGIN
 // ---------------------------
 
-func GetUserAndTiendaForLogin(dbconn *sql.DB, idUsuario int64) (map[string]interface{}, error) {
-	// Usuario
-	var u usuarioRow
-	err := dbconn.QueryRow(`SELECT id_usuario, id_empresa, tipo_usuario, nombre_completo, correo, telefono, estatus, clave_remota, id_remoto FROM usuarios WHERE id_usuario = ?`, idUsuario).
-		Scan(&u.IDUsuario, &u.IDEmpresa, &u.TipoUsuario, &u.NombreCompleto, &u.Correo, &u.Telefono, &u.Estatus, &u.ClaveRemota, &u.IDRemoto)
+func datosLogin(ctx context.Context, repos repositorio.Repositorios, idUsuario int64) (map[string]interface{}, error) {
+	u, err := repos.Usuarios.PorID(ctx, idUsuario)
 	if err != nil {
 		return nil, err
 	}
 	usuario := map[string]interface{}{
-		"id_usuario":      u.IDUsuario,
+		"id_usuario":      int(u.IDUsuario),
 		"id_empresa":      u.IDEmpresa,
 		"tipo_usuario":    u.TipoUsuario,
 		"nombre_completo": u.NombreCompleto,
 		"correo":          u.Correo,
 		"telefono":        u.Telefono,
 		"estatus":         u.Estatus,
-		"id_remoto":       NullToInt(u.IDRemoto),
-		"clave_remota":    NullToStr(u.ClaveRemota),
+		"id_remoto":       int(u.IDRemoto),
+		"clave_remota":    u.ClaveRemota,
 	}
 
-	// Tienda
-	var tienda tiendaData
-	var lat, lon, latPoint, lonPoint sql.NullFloat64
-	err = dbconn.QueryRow(`
-            SELECT id_tienda, nombre_tienda, direccion, colonia, codigo_postal, ciudad, estado, pais,
-                   latitud, longitud, IFNULL(ST_Y(ubicacion), 0) as latitud_ubic, IFNULL(ST_X(ubicacion), 0) as longitud_ubic
-            FROM tiendas
-            WHERE id_usuario = ?
-            LIMIT 1
-        `, idUsuario).Scan(
-		&tienda.IDTienda, &tienda.NombreTienda, &tienda.Direccion, &tienda.Colonia,
-		&tienda.CodigoPostal, &tienda.Ciudad, &tienda.Estado, &tienda.Pais,
-		&lat, &lon, &latPoint, &lonPoint,
-	)
-	if err != nil && err != sql.ErrNoRows {
+	tienda, tiendas, err := tiendasLogin(ctx, repos.Tiendas, idUsuario)
+	if err != nil {
 		return nil, err
 	}
-	tienda.Latitud = NullToFloat(lat)
-	tienda.Longitud = NullToFloat(lon)
-	tienda.LatitudUbic = NullToFloat(latPoint)
-	tienda.LongitudUbic = NullToFloat(lonPoint)
 
 	return map[string]interface{}{
 		"usuario": usuario,
 		"tienda":  tienda,
+		"tiendas": tiendas,
 	}, nil
 }
 
@@ -349,168 +276,123 @@ func GetUserAndTiendaForLogin(dbconn *sql.DB, idUsuario int64) (map[string]inter
 // ENDPOINT: Registro combinado usuario+tienda
 // ---------------------------
 
-func RegistroUsuarioTienda(dbc *db.DBConnection) http.HandlerFunc {
+// RegistroRequest es el alta de un cliente con su primera tienda.
+type RegistroRequest struct {
+	Usuario UsuarioRequest `json:"usuario"`
+	Tienda  TiendaRequest  `json:"tienda"`
+}
+
+// RegistroUsuarioTienda da de alta al cliente con su tienda, también como
+// cliente en el ERP, y le abre sesión. Si la sucursal ya tiene en el ERP un
+// cliente con el RFC o el nombre de la tienda, no se crea otro: se manda un
+// código a su teléfono y el alta termina en ConfirmarReclamo.
+func RegistroUsuarioTienda(repos repositorio.Repositorios, enviador avisos.Enviador) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var req struct {
-			Usuario UsuarioRequest `json:"usuario"`
-			Tienda  TiendaRequest  `json:"tienda"`
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
 		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			writeErrorResponse(w, http.StatusBadRequest, "Datos inválidos", err.Error())
+		var req RegistroRequest
+		if err := validacion.Decodificar(w, r, &req); err != nil {
+			errores.Escribir(w, r, err)
 			return
 		}
 
 		claveEncriptada, err := encriptarContraseña(req.Usuario.Clave)
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "Error al procesar la contraseña", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error al procesar la contraseña", err))
 			return
 		}
+		req.Usuario.Clave = claveEncriptada
 
-		var idEmpresa, idSucursal int
-		err = dbc.Local.QueryRow("SELECT idempresa FROM adm_empresas WHERE estatus = 'S' LIMIT 1").Scan(&idEmpresa)
-		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "No se pudo obtener la empresa", err.Error())
-			return
-		}
-		err = dbc.Local.QueryRow("SELECT idsucursal FROM adm_sucursales WHERE idempresa = ? AND estatus = 'S' LIMIT 1", idEmpresa).Scan(&idSucursal)
+		idSucursal, err := repos.Sucursales.PrimeraActiva(r.Context(), idEmpresa)
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "No se pudo obtener la sucursal", err.Error())
+			errores.Escribir(w, r, errores.Interno("No se pudo obtener la sucursal", err))
 			return
 		}
 
-		// --- Generar clave aleatoria para remota ---
-		claveAleatoria := generarClaveAleatoria()
-
-		// --- Crear cliente remoto con datos de tienda, razon_social y claveAleatoria ---
-		idClienteRemoto, err := BuscaClienteRemoto(
-			dbc.Remote,
-			idSucursal,
-			claveAleatoria,
-			req.Tienda.NombreTienda,
-			req.Tienda.RazonSocial,
-			req.Tienda.RFC,
-			req.Tienda.Direccion,
-			req.Tienda.Direccion,
-			"",
-			req.Tienda.Ciudad,
-			req.Tienda.Estado,
-			req.Tienda.CodigoPostal,
-			req.Usuario.Telefono,
-		)
+		// Se busca antes de crear el cliente remoto para no dejarlo huérfano en el ERP
+		sucursal, err := repos.Sucursales.PorUbicacion(r.Context(), idEmpresa, req.Tienda.Latitud, req.Tienda.Longitud)
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "No se pudo guardar cliente en remota", err.Error())
+			errores.Escribir(w, r, errores.Nuevo(errores.UbicacionSinCobertura))
 			return
 		}
 
-		// ----------- INICIA TRANSACCIÓN -----------
-		tx, err := dbc.Local.Begin()
-		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "Error al iniciar la transacción", err.Error())
+		// --- Un cliente que ya está en el ERP reclama el suyo en vez de duplicarlo ---
+		existente, err := repos.Sync.BuscarClienteRemoto(r.Context(), idSucursal, req.Tienda.RFC, req.Tienda.NombreTienda)
+		if err == nil {
+			iniciarReclamo(w, r, repos, enviador, idEmpresa, existente, req)
+			return
+		} else if !errors.Is(err, repositorio.ErrNoEncontrado) {
+			errores.Escribir(w, r, errores.Interno("No se pudo buscar el cliente en remota", err))
 			return
 		}
 
-		defer func() {
-			if p := recover(); p != nil {
-				tx.Rollback()
-				writeErrorResponse(w, http.StatusInternalServerError, "Transacción abortada", fmt.Sprintf("%v", p))
-			}
-		}()
-
-		// --- Guardar usuario en local ---
-		fechaRegistro := time.Now()
-		userResult, err := tx.Exec(`
-            INSERT INTO usuarios (
-                id_empresa, tipo_usuario, nombre_completo, correo, telefono, clave, clave_remota, fecha_registro, estatus, requiere_cambiar_clave, id_remoto
-            ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, 'activo', false, ?)
-        `, idEmpresa, req.Usuario.TipoUsuario, req.Usuario.NombreCompleto, req.Usuario.Correo, req.Usuario.Telefono, claveEncriptada, claveAleatoria, fechaRegistro, idClienteRemoto)
+		// --- Crear cliente remoto con datos de tienda, razon_social y clave aleatoria ---
+		idClienteRemoto, claveAleatoria, err := clienteRemotoTienda(r.Context(), repos.Sync, idSucursal, req.Tienda, req.Usuario.Telefono)
 		if err != nil {
-			tx.Rollback()
-			writeErrorResponse(w, http.StatusInternalServerError, "Error al crear usuario", err.Error())
+			errores.Escribir(w, r, errores.Interno("No se pudo guardar cliente en remota", err))
 			return
 		}
-		idUsuario, _ := userResult.LastInsertId()
 
-		// --- Crear tienda en local ---
-		now := time.Now()
-		idsucursal, nombreSucursal, err := BuscarSucursalPorUbicacion(dbc, idEmpresa, req.Tienda.Latitud, req.Tienda.Longitud)
-		if err != nil {
-			tx.Rollback()
-			writeErrorResponse(w, http.StatusBadRequest, "No hay sucursal que cubra esa ubicación", "")
+		// --- Guardar usuario y tienda en local (una transacción) ---
+		now := reloj.Desde(r.Context()).Ahora()
+		tienda := nuevaTienda(idEmpresa, sucursal, req.Tienda, now)
+		tienda.IDRemoto = idClienteRemoto
+		tienda.ClaveRemota = claveAleatoria
+		idUsuario, err := repos.Usuarios.RegistrarConTienda(r.Context(),
+			nuevoUsuario(idEmpresa, req.Usuario, idClienteRemoto, claveAleatoria, now), tienda)
+		if errors.Is(err, repositorio.ErrCorreoRegistrado) {
+			errores.Escribir(w, r, errores.Nuevo(errores.CorreoRegistrado))
 			return
-		}
-		_, err = tx.Exec(`
-            INSERT INTO tiendas (
-                id_usuario, id_empresa, idsucursal, nombre_sucursal, nombre_tienda, razon_social, rfc, direccion, colonia, codigo_postal, ciudad, estado, pais, tipo_tienda, latitud, longitud, ubicacion, fecha_registro, ultima_actualizacion, estatus
-            ) VALUES (
-                ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, POINT(?, ?), ?, ?, 'activo'
-            )
-        `,
-			idUsuario,
-			idEmpresa,
-			idsucursal,
-			nombreSucursal,
-			req.Tienda.NombreTienda,
-			req.Tienda.RazonSocial,
-			req.Tienda.RFC,
-			req.Tienda.Direccion,
-			req.Tienda.Colonia,
-			req.Tienda.CodigoPostal,
-			req.Tienda.Ciudad,
-			req.Tienda.Estado,
-			req.Tienda.Pais,
-			req.Tienda.TipoTienda,
-			req.Tienda.Latitud,
-			req.Tienda.Longitud,
-			req.Tienda.Longitud, // X
-			req.Tienda.Latitud,  // Y
-			now, now,
-		)
-		if err != nil {
-			tx.Rollback()
-			writeErrorResponse(w, http.StatusInternalServerError, "Error al crear tienda", err.Error())
+		} else if err != nil {
+			errores.Escribir(w, r, errores.Interno("Error al crear usuario y tienda", err))
 			return
 		}
 
-		// --- Commitea la transacción ---
-		if err := tx.Commit(); err != nil {
-			tx.Rollback()
-			writeErrorResponse(w, http.StatusInternalServerError, "Error al confirmar la transacción", err.Error())
-			return
-		}
+		abrirSesionRegistro(w, r, repos, idEmpresa, idUsuario, now, "Usuario y tienda creados correctamente")
+	}
+}
 
-		// --- Respuesta igual a login: usuario y tienda y access_token ---
-		loginData, err := GetUserAndTiendaForLogin(dbc.Local, idUsuario)
-		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "No se pudo obtener usuario y tienda para login automático", err.Error())
-			return
-		}
+// abrirSesionRegistro responde al alta igual que el login: usuario, tiendas y
+// access_token, con la sesión (refresh token) ya guardada.
+func abrirSesionRegistro(w http.ResponseWriter, r *http.Request, repos repositorio.Repositorios, idEmpresa int, idUsuario int64, now time.Time, mensaje string) {
+	// --- Respuesta igual a login: usuario y tienda y access_token ---
+	loginData, err := datosLogin(r.Context(), repos, idUsuario)
+	if err != nil {
+		errores.Escribir(w, r, errores.Interno("No se pudo obtener usuario y tienda para login automático", err))
+		return
+	}
 
-		// --- Genera los tokens igual que el login ---
-		tipoUsuario := "C"
-		correo := ""
-		if usuario, ok := loginData["usuario"].(map[string]interface{}); ok {
-			if c, ok := usuario["correo"].(string); ok {
-				correo = c
-			}
-		}
-		accessToken, refreshToken, refreshExp, err := generarTokens(int(idUsuario), tipoUsuario, correo)
-		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "Error generando tokens", err.Error())
-			return
-		}
-		userAgent := r.Header.Get("User-Agent")
-		ip := r.RemoteAddr
-		err = guardarRefreshToken(dbc, int(idUsuario), tipoUsuario, refreshToken, userAgent, ip, refreshExp)
-		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "Error guardando refresh token", err.Error())
-			return
+	// --- Genera los tokens igual que el login ---
+	tipoUsuario := "C"
+	correo := ""
+	if usuario, ok := loginData["usuario"].(map[string]interface{}); ok {
+		if c, ok := usuario["correo"].(string); ok {
+			correo = c
 		}
+	}
+	idTienda := 0
+	if t, ok := loginData["tienda"].(tiendaData); ok {
+		idTienda = t.IDTienda
+	}
+	accessToken, refreshToken, refreshExp, err := generarTokens(now, int(idUsuario), tipoUsuario, correo, idEmpresa, idTienda)
+	if err != nil {
+		errores.Escribir(w, r, errores.Interno("Error generando tokens", err))
+		return
+	}
+	userAgent := r.Header.Get("User-Agent")
+	ip := r.RemoteAddr
+	err = guardarRefreshToken(r.Context(), repos.Usuarios, int(idUsuario), tipoUsuario, refreshToken, userAgent, ip, refreshExp)
+	if err != nil {
+		errores.Escribir(w, r, errores.Interno("Error guardando refresh token", err))
+		return
+	}
 
-		// --- Agrega access_token al objeto de respuesta ---
-		loginData["access_token"] = accessToken
+	// --- Agrega access_token al objeto de respuesta ---
+	loginData["access_token"] = accessToken
 
-		writeSuccessResponse(w, "Usuario y tienda creados correctamente", loginData)
-	}
+	writeSuccessResponse(w, mensaje, loginData)
 }
 
 // ---------------------------
@@ -519,9 +401,13 @@ func RegistroUsuarioTienda(dbc *db.DBConnection) http.HandlerFunc {
 
 func GetUsuarios(dbc *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		rows, err := dbc.Local.Query(`SELECT id_usuario, id_empresa, tipo_usuario, nombre_completo, correo, telefono, estatus, id_remoto, clave_remota FROM usuarios`)
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		rows, err := dbc.Local.QueryContext(r.Context(), `SELECT id_usuario, id_empresa, tipo_usuario, nombre_completo, correo, telefono, estatus, id_remoto, clave_remota FROM usuarios WHERE id_empresa = ?`, idEmpresa)
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "Error al obtener usuarios", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error al obtener usuarios", err))
 			return
 		}
 		defer rows.Close()
@@ -533,7 +419,7 @@ func GetUsuarios(dbc *db.DBConnection) http.HandlerFunc {
 			var claveRemota sql.NullString
 			err := rows.Scan(&u.IDUsuario, &u.IDEmpresa, &u.TipoUsuario, &u.NombreCompleto, &u.Correo, &u.Telefono, &u.Estatus, &idRemoto, &claveRemota)
 			if err != nil {
-				writeErrorResponse(w, http.StatusInternalServerError, "Error al leer usuario", err.Error())
+				errores.Escribir(w, r, errores.Interno("Error al leer usuario", err))
 				return
 			}
 			usuarios = append(usuarios, map[string]interface{}{
@@ -554,12 +440,17 @@ func GetUsuarios(dbc *db.DBConnection) http.HandlerFunc {
 
 func GetTiendas(dbc *db.DBConnection) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		rows, err := dbc.Local.Query(`
+		idEmpresa, ok := empresas.Requerida(w, r)
+		if !ok {
+			return
+		}
+		rows, err := dbc.Local.QueryContext(r.Context(), `
             SELECT t.id_tienda, t.id_usuario, t.id_empresa, t.idsucursal, t.nombre_sucursal, t.nombre_tienda, t.razon_social, t.rfc, t.direccion, t.colonia, t.codigo_postal, t.ciudad, t.estado, t.pais, t.tipo_tienda, t.estatus
             FROM tiendas t
-        `)
+            WHERE t.id_empresa = ?
+        `, idEmpresa)
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "Error al obtener tiendas", err.Error())
+			errores.Escribir(w, r, errores.Interno("Error al obtener tiendas", err))
 			return
 		}
 		defer rows.Close()
@@ -571,7 +462,7 @@ func GetTiendas(dbc *db.DBConnection) http.HandlerFunc {
 				&t.IDTienda, &t.IDUsuario, &t.IDEmpresa, &t.IDSucursal, &t.NombreSucursal, &t.NombreTienda, &t.RazonSocial, &t.RFC, &t.Direccion, &t.Colonia, &t.CodigoPostal, &t.Ciudad, &t.Estado, &t.Pais, &t.TipoTienda, &t.Estatus,
 			)
 			if err != nil {
-				writeErrorResponse(w, http.StatusInternalServerError, "Error al leer tienda", err.Error())
+				errores.Escribir(w, r, errores.Interno("Error al leer tienda", err))
 				return
 			}
 			tiendas = append(tiendas, map[string]interface{}{
@@ -0,0 +1,378 @@
+package rutas
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	middlewares "github.com/WolfSlayer04/logica_tiendaenlina/Middleware"
+	"github.com/WolfSlayer04/logica_tiendaenlina/avisos"
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+	"github.com/WolfSlayer04/logica_tiendaenlina/reloj"
+	"github.com/WolfSlayer04/logica_tiendaenlina/repositorio"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func memoriaRegistro() *repositorio.Memoria {
+	m := repositorio.NuevaMemoria()
+	m.Empresas = []repositorio.EmpresaMemoria{{IDEmpresa: 1, Activa: true}}
+	m.Sucursales = []repositorio.SucursalMemoria{
+		{IDSucursal: 2, IDEmpresa: 1, Nombre: "Centro", Activa: true, Latitud: 20.967, Longitud: -89.623, RadioKm: 5},
+		{IDSucursal: 4, IDEmpresa: 1, Nombre: "Progreso", Activa: true, Latitud: 21.283, Longitud: -89.663, RadioKm: 3},
+	}
+	return m
+}
+
+const registroValido = `{
+	"usuario": {"tipo_usuario": "C", "nombre_completo": "Ana Pérez", "correo": "ana@example.com", "telefono": "9991234567", "clave": "secreta"},
+	"tienda": {"nombre_tienda": "Abarrotes Ana", "razon_social": "Ana SA", "rfc": "PEAA800101XXX", "direccion": "Calle 60, Centro, 97000 Mérida",
+		"codigo_postal": "97000", "ciudad": "Mérida", "estado": "Yucatán", "pais": "México", "latitud": 21.28, "longitud": -89.66}
+}`
+
+func TestRegistroUsuarioTienda(t *testing.T) {
+	m := memoriaRegistro()
+	rec := httptest.NewRecorder()
+	RegistroUsuarioTienda(m.Repositorios(), avisos.Bitacora{})(rec, conEmpresa(httptest.NewRequest(http.MethodPost, "/api/registro", strings.NewReader(registroValido)), 1))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	data := respuestaExito(t, rec)
+	if token, _ := data["access_token"].(string); token == "" {
+		t.Error("la respuesta no trae access_token")
+	}
+	usuario, _ := data["usuario"].(map[string]interface{})
+	if usuario["correo"] != "ana@example.com" {
+		t.Errorf("usuario en respuesta = %v", usuario)
+	}
+
+	if len(m.Usuarios) != 1 {
+		t.Fatalf("usuarios guardados = %d", len(m.Usuarios))
+	}
+	u := m.Usuarios[1]
+	if bcrypt.CompareHashAndPassword([]byte(u.Clave), []byte("secreta")) != nil {
+		t.Error("la clave no se guardó encriptada")
+	}
+	if u.Alta.IDSucursal != 4 || u.Alta.NombreSucursal != "Progreso" {
+		t.Errorf("tienda asignada a %d/%q, se esperaba la sucursal que cubre el punto (4)", u.Alta.IDSucursal, u.Alta.NombreSucursal)
+	}
+
+	if len(m.ClientesRemotos) != 1 {
+		t.Fatalf("clientes remotos = %d", len(m.ClientesRemotos))
+	}
+	c := m.ClientesRemotos[0]
+	if c.IDSucursal != 2 || c.NombreComercial != "Abarrotes Ana" || c.Clave != u.Usuario.ClaveRemota {
+		t.Errorf("cliente remoto = %+v", c)
+	}
+	if u.Usuario.IDRemoto != 1 || u.Alta.IDRemoto != 1 || u.Alta.ClaveRemota != c.Clave {
+		t.Errorf("id_remoto = %d, de la tienda %d", u.Usuario.IDRemoto, u.Alta.IDRemoto)
+	}
+
+	if len(m.RefreshTokens) != 1 || m.RefreshTokens[0].TipoUsuario != "C" || m.RefreshTokens[0].IDUsuario != 1 {
+		t.Errorf("refresh tokens = %+v", m.RefreshTokens)
+	}
+}
+
+func TestRegistroUsuarioTiendaRechazos(t *testing.T) {
+	t.Run("rfc de un cliente del ERP sin teléfono", func(t *testing.T) {
+		m := memoriaRegistro()
+		m.ClientesRemotos = []repositorio.ClienteRemoto{{IDSucursal: 2, RFC: "PEAA800101XXX"}}
+		rec := httptest.NewRecorder()
+		RegistroUsuarioTienda(m.Repositorios(), avisos.Bitacora{})(rec, conEmpresa(httptest.NewRequest(http.MethodPost, "/api/registro", strings.NewReader(registroValido)), 1))
+		if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), string(errores.ClienteRemotoSinTelefono)) {
+			t.Errorf("status = %d, body = %s", rec.Code, rec.Body)
+		}
+		if len(m.Usuarios) != 0 || len(m.ClientesRemotos) != 1 || len(m.Reclamos) != 0 {
+			t.Error("no debía crearse nada")
+		}
+	})
+
+	t.Run("sin sucursales", func(t *testing.T) {
+		m := memoriaRegistro()
+		m.Sucursales = []repositorio.SucursalMemoria{{IDSucursal: 2, IDEmpresa: 9, Activa: true}}
+		rec := httptest.NewRecorder()
+		RegistroUsuarioTienda(m.Repositorios(), avisos.Bitacora{})(rec, conEmpresa(httptest.NewRequest(http.MethodPost, "/api/registro", strings.NewReader(registroValido)), 1))
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("status = %d", rec.Code)
+		}
+		if len(m.ClientesRemotos) != 0 || len(m.Usuarios) != 0 {
+			t.Error("no debía crearse nada")
+		}
+	})
+
+	t.Run("datos inválidos", func(t *testing.T) {
+		m := memoriaRegistro()
+		body := `{
+			"usuario": {"tipo_usuario": "C", "nombre_completo": "Ana Pérez", "correo": "ana@", "telefono": "12345", "clave": ""},
+			"tienda": {"nombre_tienda": "Abarrotes Ana", "rfc": "PEAA801301XXX", "direccion": "Calle 60", "codigo_postal": "970",
+				"latitud": 21.28, "longitud": -89.66}
+		}`
+		rec := httptest.NewRecorder()
+		RegistroUsuarioTienda(m.Repositorios(), avisos.Bitacora{})(rec, conEmpresa(httptest.NewRequest(http.MethodPost, "/api/registro", strings.NewReader(body)), 1))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+		}
+		var resp errores.Respuesta
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("respuesta no es JSON: %v", err)
+		}
+		var campos []string
+		for _, f := range resp.Error.Campos {
+			campos = append(campos, f.Campo+":"+string(f.Codigo))
+		}
+		esperados := "usuario.correo:CORREO,usuario.telefono:TELEFONO,usuario.clave:REQUERIDO,tienda.rfc:RFC,tienda.codigo_postal:CODIGO_POSTAL"
+		if strings.Join(campos, ",") != esperados {
+			t.Errorf("fields = %v, se esperaba %s", campos, esperados)
+		}
+		if len(m.Usuarios) != 0 || len(m.ClientesRemotos) != 0 {
+			t.Error("no debía crearse nada")
+		}
+	})
+
+	t.Run("json inválido", func(t *testing.T) {
+		m := memoriaRegistro()
+		rec := httptest.NewRecorder()
+		RegistroUsuarioTienda(m.Repositorios(), avisos.Bitacora{})(rec, conEmpresa(httptest.NewRequest(http.MethodPost, "/api/registro", strings.NewReader(`{"usuario":`)), 1))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("status = %d", rec.Code)
+		}
+	})
+}
+
+// avisosEnviados guarda los mensajes en vez de mandarlos.
+type avisosEnviados []string
+
+func (a *avisosEnviados) Enviar(_ context.Context, telefono, mensaje string) error {
+	*a = append(*a, telefono+": "+mensaje)
+	return nil
+}
+
+// codigoEnviado saca el código de 6 dígitos del último mensaje.
+func codigoEnviado(t *testing.T, a avisosEnviados) string {
+	t.Helper()
+	if len(a) == 0 {
+		t.Fatal("no se envió ningún mensaje")
+	}
+	codigo := regexp.MustCompile(`\b\d{6}\b`).FindString(a[len(a)-1])
+	if codigo == "" {
+		t.Fatalf("el mensaje no trae código: %q", a[len(a)-1])
+	}
+	return codigo
+}
+
+// confirmarReclamo prueba el código en el reclamo.
+func confirmarReclamo(m *repositorio.Memoria, id, codigo string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/registro/reclamos/"+id+"/confirmar", strings.NewReader(`{"codigo": "`+codigo+`"}`))
+	rec := httptest.NewRecorder()
+	ConfirmarReclamo(m.Repositorios())(rec, mux.SetURLVars(conEmpresa(req, 1), map[string]string{"id_reclamo": id}))
+	return rec
+}
+
+func TestRegistroReclamaClienteRemoto(t *testing.T) {
+	m := memoriaRegistro()
+	m.ClientesRemotos = []repositorio.ClienteRemoto{{IDSucursal: 2, RFC: "PEAA800101XXX", NombreComercial: "Abarrotes Doña Ana", Clave: "000077", Telefono: "999 765 4321"}}
+	var enviados avisosEnviados
+	registrar := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		RegistroUsuarioTienda(m.Repositorios(), &enviados)(rec, conEmpresa(httptest.NewRequest(http.MethodPost, "/api/registro", strings.NewReader(registroValido)), 1))
+		return rec
+	}
+
+	rec := registrar()
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	data := respuestaExito(t, rec)
+	if data["id_reclamo"] != float64(1) || data["telefono"] != "******4321" {
+		t.Errorf("reclamo en respuesta = %v", data)
+	}
+	if len(m.Usuarios) != 0 || len(m.ClientesRemotos) != 1 {
+		t.Fatal("no debía crearse el usuario ni otro cliente remoto antes de confirmar")
+	}
+	if len(enviados) != 1 || !strings.HasPrefix(enviados[0], "999 765 4321: ") {
+		t.Fatalf("mensajes = %q", enviados)
+	}
+	codigo := codigoEnviado(t, enviados)
+	if strings.Contains(m.Reclamos[0].CodigoHash, codigo) || strings.Contains(string(m.Reclamos[0].Registro), "secreta") {
+		t.Error("el código o la clave se guardaron sin encriptar")
+	}
+
+	incorrecto := "000000"
+	if codigo == incorrecto {
+		incorrecto = "111111"
+	}
+	if rec := confirmarReclamo(m, "1", incorrecto); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), string(errores.CodigoIncorrecto)) {
+		t.Errorf("código incorrecto: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	rec = confirmarReclamo(m, "1", codigo)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if token, _ := respuestaExito(t, rec)["access_token"].(string); token == "" {
+		t.Error("la respuesta no trae access_token")
+	}
+	u := m.Usuarios[1]
+	if u == nil || u.Usuario.IDRemoto != 1 || u.Usuario.ClaveRemota != "000077" || u.Alta.IDRemoto != 1 || u.Alta.ClaveRemota != "000077" {
+		t.Fatalf("usuario ligado = %+v", u)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.Clave), []byte("secreta")) != nil || u.Alta.IDSucursal != 4 {
+		t.Errorf("alta = %+v", u.Alta)
+	}
+	if len(m.ClientesRemotos) != 1 || len(m.RefreshTokens) != 1 {
+		t.Errorf("clientes remotos = %d, sesiones = %d", len(m.ClientesRemotos), len(m.RefreshTokens))
+	}
+
+	if rec := confirmarReclamo(m, "1", codigo); rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), string(errores.ReclamoVencido)) {
+		t.Errorf("reclamo ya usado: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if rec := registrar(); rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), string(errores.ClienteRemotoVinculado)) {
+		t.Errorf("cliente ya ligado: status = %d, body = %s", rec.Code, rec.Body)
+	}
+}
+
+func TestConfirmarReclamoVencido(t *testing.T) {
+	nuevo := func(t *testing.T) (*repositorio.Memoria, *avisosEnviados) {
+		m := memoriaRegistro()
+		m.ClientesRemotos = []repositorio.ClienteRemoto{{IDSucursal: 2, NombreComercial: "Abarrotes Ana", Telefono: "9997654321"}}
+		enviados := &avisosEnviados{}
+		rec := httptest.NewRecorder()
+		RegistroUsuarioTienda(m.Repositorios(), enviados)(rec, conEmpresa(httptest.NewRequest(http.MethodPost, "/api/registro", strings.NewReader(registroValido)), 1))
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+		}
+		return m, enviados
+	}
+
+	t.Run("sin intentos", func(t *testing.T) {
+		m, enviados := nuevo(t)
+		codigo := codigoEnviado(t, *enviados)
+		for i := 0; i < intentosReclamo; i++ {
+			confirmarReclamo(m, "1", "x"+codigo)
+		}
+		if rec := confirmarReclamo(m, "1", codigo); rec.Code != http.StatusConflict {
+			t.Errorf("status = %d, body = %s", rec.Code, rec.Body)
+		}
+		if len(m.Usuarios) != 0 {
+			t.Error("no debía crearse el usuario")
+		}
+	})
+
+	t.Run("reemplazado por otro registro", func(t *testing.T) {
+		m, enviados := nuevo(t)
+		primero := codigoEnviado(t, *enviados)
+		rec := httptest.NewRecorder()
+		RegistroUsuarioTienda(m.Repositorios(), enviados)(rec, conEmpresa(httptest.NewRequest(http.MethodPost, "/api/registro", strings.NewReader(registroValido)), 1))
+		if rec := confirmarReclamo(m, "1", primero); rec.Code != http.StatusConflict {
+			t.Errorf("status = %d, body = %s", rec.Code, rec.Body)
+		}
+		if rec := confirmarReclamo(m, "2", codigoEnviado(t, *enviados)); rec.Code != http.StatusOK {
+			t.Errorf("el reclamo nuevo: status = %d, body = %s", rec.Code, rec.Body)
+		}
+	})
+
+	t.Run("vencido", func(t *testing.T) {
+		m, enviados := nuevo(t)
+		fijo := reloj.NuevoFijo(time.Now().Add(vigenciaReclamo))
+		req := httptest.NewRequest(http.MethodPost, "/api/registro/reclamos/1/confirmar", strings.NewReader(`{"codigo": "`+codigoEnviado(t, *enviados)+`"}`))
+		rec := httptest.NewRecorder()
+		conReloj(ConfirmarReclamo(m.Repositorios()), fijo)(rec, mux.SetURLVars(conEmpresa(req, 1), map[string]string{"id_reclamo": "1"}))
+		if rec.Code != http.StatusConflict {
+			t.Errorf("status = %d, body = %s", rec.Code, rec.Body)
+		}
+	})
+}
+
+const tiendaCentro = `{"nombre_tienda": "Abarrotes Ana Centro", "rfc": "PEAA800101XX2", "direccion": "Calle 62, Centro", "codigo_postal": "97000", "latitud": 20.967, "longitud": -89.623}`
+
+// agregarTienda registra a Ana y le agrega la tienda del cuerpo con su sesión.
+func agregarTienda(t *testing.T, m *repositorio.Memoria, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	RegistroUsuarioTienda(m.Repositorios(), avisos.Bitacora{})(rec, conEmpresa(httptest.NewRequest(http.MethodPost, "/api/registro", strings.NewReader(registroValido)), 1))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("registro: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	req := conEmpresa(httptest.NewRequest(http.MethodPost, "/api/tiendas", strings.NewReader(body)), 1)
+	ctx := context.WithValue(req.Context(), middlewares.ContextUserIDKey, 1)
+	ctx = context.WithValue(ctx, middlewares.ContextTipoKey, "C")
+	rec = httptest.NewRecorder()
+	CreateTienda(m.Repositorios())(rec, req.WithContext(ctx))
+	return rec
+}
+
+func TestCreateTienda(t *testing.T) {
+	m := memoriaRegistro()
+	rec := agregarTienda(t, m, tiendaCentro)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	data := respuestaExito(t, rec)
+	if data["id_tienda"] != float64(2) || data["idsucursal"] != float64(2) || data["id_remoto"] != float64(2) {
+		t.Errorf("tienda en respuesta = %v", data)
+	}
+
+	u := m.Usuarios[1]
+	if len(u.Otras) != 1 || u.Otras[0].Alta.NombreSucursal != "Centro" {
+		t.Fatalf("tiendas agregadas = %+v", u.Otras)
+	}
+	if len(m.ClientesRemotos) != 2 || m.ClientesRemotos[1].NombreComercial != "Abarrotes Ana Centro" || m.ClientesRemotos[1].Telefono != "9991234567" {
+		t.Errorf("clientes remotos = %+v", m.ClientesRemotos)
+	}
+	// La del registro sigue siendo la activa
+	if ti, err := m.Repositorios().Tiendas.PorUsuario(context.Background(), 1); err != nil || ti.IDTienda != 1 {
+		t.Errorf("tienda activa = %+v, %v", ti, err)
+	}
+}
+
+// El cliente del ERP es de la sucursal que atiende la tienda, no de la
+// primera de la empresa
+func TestCreateTiendaSucursalDelCliente(t *testing.T) {
+	m := memoriaRegistro()
+	rec := agregarTienda(t, m, `{"nombre_tienda": "Abarrotes Ana Puerto", "rfc": "PEAA800101XX3", "direccion": "Calle 80, Progreso",
+		"codigo_postal": "97320", "latitud": 21.283, "longitud": -89.663}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if data := respuestaExito(t, rec); data["idsucursal"] != float64(4) || data["id_remoto"] != float64(2) {
+		t.Errorf("tienda en respuesta = %v", data)
+	}
+	if len(m.ClientesRemotos) != 2 || m.ClientesRemotos[1].IDSucursal != 4 {
+		t.Errorf("clientes remotos = %+v", m.ClientesRemotos)
+	}
+}
+
+// Con el mismo RFC en la sucursal (otra tienda de la misma razón social) la
+// tienda se liga al cliente que ya tiene
+func TestCreateTiendaRfcDuplicado(t *testing.T) {
+	m := memoriaRegistro()
+	rec := agregarTienda(t, m, strings.Replace(tiendaCentro, "PEAA800101XX2", "PEAA800101XXX", 1))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if data := respuestaExito(t, rec); data["idsucursal"] != float64(2) || data["id_remoto"] != float64(1) {
+		t.Errorf("tienda en respuesta = %v", data)
+	}
+	if len(m.Usuarios[1].Otras) != 1 || len(m.ClientesRemotos) != 1 {
+		t.Errorf("tiendas = %d, clientes remotos = %+v", len(m.Usuarios[1].Otras), m.ClientesRemotos)
+	}
+}
+
+// Si el cliente con ese RFC es de alguien más no se liga ni se duplica
+func TestCreateTiendaRfcDeOtroCliente(t *testing.T) {
+	m := memoriaRegistro()
+	m.ClientesRemotos = append(m.ClientesRemotos, repositorio.ClienteRemoto{IDSucursal: 2, RFC: "PEAA800101XX2", NombreComercial: "Abarrotes Beto"})
+	rec := agregarTienda(t, m, tiendaCentro)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "CLIENTE_REMOTO_EXISTENTE") {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if len(m.Usuarios[1].Otras) != 0 || len(m.ClientesRemotos) != 2 {
+		t.Error("no debía crearse la tienda")
+	}
+}
@@ -12,11 +12,6 @@ type Claims struct {
     IsAdmin bool `json:"is_admin"`
 }
 
-// RespondWithError envía una respuesta de error al cliente
-func RespondWithError(w http.ResponseWriter, code int, message string) {
-    RespondWithJSON(w, code, map[string]string{"error": message})
-}
-
 // RespondWithJSON envía una respuesta JSON al cliente
 func RespondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
     response, _ := json.Marshal(payload)
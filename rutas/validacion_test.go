@@ -0,0 +1,29 @@
+package rutas
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/validacion"
+)
+
+// Las etiquetas `valida` mal escritas provocan panic en la primera petición;
+// aquí se revisan las estructuras con nombre que las usan.
+func TestEtiquetasDeValidacion(t *testing.T) {
+	tipos := []any{
+		UsuarioRequest{}, TiendaRequest{}, LoginRequest{}, RefreshRequest{},
+		ConfigEntrega{}, ProductoInput{}, AdminUsuarioCreate{},
+		SucursalRequest{}, EstatusRequest{}, DescuentoRequest{}, DetallesUpdateRequest{},
+		SincronizacionRequest{}, PedidoRequest{},
+	}
+	for _, v := range tipos {
+		t.Run(fmt.Sprintf("%T", v), func(t *testing.T) {
+			defer func() {
+				if p := recover(); p != nil {
+					t.Error(p)
+				}
+			}()
+			validacion.Validar(v)
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package trazas
+
+import (
+	"sync"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxOrigenes limita la memoria usada por el registro de orígenes; si el
+// sincronizador se atrasa más que esto, los pedidos más viejos se sincronizan
+// sin enlace a su traza de creación.
+const maxOrigenes = 10000
+
+// origenes recuerda el span de la petición que creó cada pedido para que la
+// traza de su sincronización (que corre después, en otra goroutine) pueda
+// enlazarse con ella. Sólo vive en memoria: tras un reinicio no hay enlace.
+var origenes = struct {
+	sync.Mutex
+	spans map[int64]trace.SpanContext
+	orden []int64
+}{spans: make(map[int64]trace.SpanContext)}
+
+// RegistrarOrigenPedido guarda el span que creó el pedido idPedido.
+func RegistrarOrigenPedido(idPedido int64, sc trace.SpanContext) {
+	if !sc.IsValid() {
+		return
+	}
+	origenes.Lock()
+	defer origenes.Unlock()
+	if _, ok := origenes.spans[idPedido]; !ok {
+		origenes.orden = append(origenes.orden, idPedido)
+	}
+	origenes.spans[idPedido] = sc
+	for len(origenes.orden) > maxOrigenes {
+		delete(origenes.spans, origenes.orden[0])
+		origenes.orden = origenes.orden[1:]
+	}
+}
+
+// EnlaceOrigenPedido regresa el enlace al span que creó el pedido, si se conoce.
+func EnlaceOrigenPedido(idPedido int64) []trace.Link {
+	origenes.Lock()
+	sc, ok := origenes.spans[idPedido]
+	origenes.Unlock()
+	if !ok {
+		return nil
+	}
+	return []trace.Link{{SpanContext: sc}}
+}
+
+// OlvidarOrigenPedido libera el registro una vez que el pedido se sincronizó.
+func OlvidarOrigenPedido(idPedido int64) {
+	origenes.Lock()
+	defer origenes.Unlock()
+	if _, ok := origenes.spans[idPedido]; !ok {
+		return
+	}
+	delete(origenes.spans, idPedido)
+	for i, id := range origenes.orden {
+		if id == idPedido {
+			origenes.orden = append(origenes.orden[:i], origenes.orden[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package trazas
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// limpiarOrigenes vacía el registro global antes y después de la prueba.
+func limpiarOrigenes(t *testing.T) {
+	t.Helper()
+	vaciar := func() {
+		origenes.Lock()
+		origenes.spans = make(map[int64]trace.SpanContext)
+		origenes.orden = nil
+		origenes.Unlock()
+	}
+	vaciar()
+	t.Cleanup(vaciar)
+}
+
+func TestOrigenPedido(t *testing.T) {
+	limpiarOrigenes(t)
+	tp, exp := proveedor(t)
+	tracer := tp.Tracer(Servicio)
+
+	// La petición que crea el pedido
+	_, creacion := tracer.Start(context.Background(), "POST /api/v1/pedidos")
+	RegistrarOrigenPedido(41, creacion.SpanContext())
+	creacion.End()
+
+	// La sincronización, en otra traza, se enlaza con ella
+	_, sync := tracer.Start(context.Background(), "sincronizar pedido",
+		trace.WithNewRoot(), trace.WithLinks(EnlaceOrigenPedido(41)...))
+	sync.End()
+	OlvidarOrigenPedido(41)
+
+	spans := exp.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("se esperaban 2 spans, hay %d", len(spans))
+	}
+	enlaces := spans[1].Links
+	if len(enlaces) != 1 || enlaces[0].SpanContext.SpanID() != spans[0].SpanContext.SpanID() {
+		t.Fatalf("enlaces = %+v", enlaces)
+	}
+	if spans[1].SpanContext.TraceID() == spans[0].SpanContext.TraceID() {
+		t.Error("la sincronización quedó en la traza de la petición")
+	}
+
+	if EnlaceOrigenPedido(41) != nil {
+		t.Error("el origen sigue registrado después de OlvidarOrigenPedido")
+	}
+	if len(origenes.orden) != 0 {
+		t.Errorf("orden = %v", origenes.orden)
+	}
+	// Olvidar un pedido que no está no hace nada
+	OlvidarOrigenPedido(41)
+}
+
+func TestOrigenPedidoInvalido(t *testing.T) {
+	limpiarOrigenes(t)
+	RegistrarOrigenPedido(1, trace.SpanContext{})
+	if EnlaceOrigenPedido(1) != nil || len(origenes.spans) != 0 {
+		t.Error("se registró un SpanContext inválido")
+	}
+}
+
+func TestOrigenPedidoLimite(t *testing.T) {
+	limpiarOrigenes(t)
+	tp, _ := proveedor(t)
+	_, span := tp.Tracer(Servicio).Start(context.Background(), "crear")
+	sc := span.SpanContext()
+	span.End()
+
+	for id := int64(1); id <= maxOrigenes+5; id++ {
+		RegistrarOrigenPedido(id, sc)
+	}
+	// Registrar otra vez uno que ya está no lo duplica en el orden
+	RegistrarOrigenPedido(maxOrigenes, sc)
+
+	if len(origenes.spans) != maxOrigenes || len(origenes.orden) != maxOrigenes {
+		t.Fatalf("spans = %d, orden = %d, se esperaba %d", len(origenes.spans), len(origenes.orden), maxOrigenes)
+	}
+	// Se descartan los más viejos
+	for id := int64(1); id <= 5; id++ {
+		if EnlaceOrigenPedido(id) != nil {
+			t.Errorf("el pedido %d debió descartarse", id)
+		}
+	}
+	if EnlaceOrigenPedido(6) == nil || EnlaceOrigenPedido(maxOrigenes+5) == nil {
+		t.Error("se descartó un pedido reciente")
+	}
+
+	// Olvidar uno de en medio deja lugar sin descartar otro
+	OlvidarOrigenPedido(500)
+	RegistrarOrigenPedido(maxOrigenes+6, sc)
+	if EnlaceOrigenPedido(6) == nil || len(origenes.orden) != maxOrigenes {
+		t.Errorf("orden = %d, pedido 6 registrado = %v", len(origenes.orden), EnlaceOrigenPedido(6) != nil)
+	}
+}
@@ -0,0 +1,111 @@
+// Package trazas configura OpenTelemetry: el proveedor de trazas, el exportador
+// (OTLP o stdout) y los helpers para abrir spans propios del servicio.
+package trazas
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Servicio es el service.name por defecto (se puede cambiar con OTEL_SERVICE_NAME).
+const Servicio = "logica_tiendaenlina"
+
+// Tracer regresa el tracer del servicio. Antes de Iniciar (o con el exportador
+// "none") es un tracer no-op, así que siempre es seguro usarlo.
+func Tracer() trace.Tracer {
+	return otel.Tracer(Servicio)
+}
+
+// Iniciar instala el proveedor global de trazas según OTEL_TRACES_EXPORTER:
+//
+//	otlp   exporta por OTLP/HTTP (OTEL_EXPORTER_OTLP_ENDPOINT, etc.)
+//	stdout imprime los spans en la salida estándar (desarrollo local)
+//	none   no exporta nada
+//
+// Si la variable no está definida se usa otlp cuando hay un endpoint OTLP
+// configurado y none en caso contrario. La función devuelta vacía los spans
+// pendientes y debe llamarse al apagar el servidor.
+func Iniciar(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	exportador, err := nuevoExportador(ctx, exportadorDesdeEnv())
+	if err != nil {
+		return nil, err
+	}
+	if exportador == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	// WithFromEnv va después para que OTEL_SERVICE_NAME y
+	// OTEL_RESOURCE_ATTRIBUTES tengan prioridad sobre Servicio.
+	res, err := resource.New(ctx,
+		resource.WithSchemaURL(semconv.SchemaURL),
+		resource.WithAttributes(semconv.ServiceName(Servicio)),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creando recurso de trazas: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exportador),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+func exportadorDesdeEnv() string {
+	if v := strings.ToLower(strings.TrimSpace(os.Getenv("OTEL_TRACES_EXPORTER"))); v != "" {
+		return v
+	}
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" {
+		return "otlp"
+	}
+	return "none"
+}
+
+func nuevoExportador(ctx context.Context, tipo string) (sdktrace.SpanExporter, error) {
+	switch tipo {
+	case "otlp":
+		exp, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error creando exportador OTLP: %w", err)
+		}
+		return exp, nil
+	case "stdout", "console":
+		exp, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, fmt.Errorf("error creando exportador stdout: %w", err)
+		}
+		return exp, nil
+	case "none", "":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("OTEL_TRACES_EXPORTER no soportado: %q (usa otlp, stdout o none)", tipo)
+	}
+}
+
+// PeticionTrazable excluye de las trazas las rutas que consulta el
+// orquestador o Prometheus cada pocos segundos.
+func PeticionTrazable(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/healthz", "/readyz", "/metrics":
+		return false
+	}
+	return true
+}
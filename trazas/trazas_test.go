@@ -0,0 +1,102 @@
+package trazas
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// proveedor regresa un proveedor de trazas que guarda los spans en memoria.
+func proveedor(t *testing.T) (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	t.Helper()
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+	return tp, exp
+}
+
+func TestPeticionTrazable(t *testing.T) {
+	casos := map[string]bool{
+		"/healthz":              false,
+		"/readyz":               false,
+		"/metrics":              false,
+		"/api/v1/pedidos":       true,
+		"/api/healthz":          true,
+		"/healthz/extra":        true,
+		"/api/v1/tiendas/15":    true,
+		"/api/openapi.json":     true,
+		"/":                     true,
+		"/api/v1/pedidos/1/pdf": true,
+	}
+	for ruta, esperado := range casos {
+		if got := PeticionTrazable(httptest.NewRequest(http.MethodGet, ruta, nil)); got != esperado {
+			t.Errorf("PeticionTrazable(%s) = %v, se esperaba %v", ruta, got, esperado)
+		}
+	}
+}
+
+// Con el filtro en otelmux, como en main, las sondas no generan spans.
+func TestFiltroOtelmux(t *testing.T) {
+	tp, exp := proveedor(t)
+	r := mux.NewRouter()
+	r.Use(otelmux.Middleware(Servicio, otelmux.WithTracerProvider(tp), otelmux.WithFilter(PeticionTrazable)))
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	r.HandleFunc("/healthz", ok)
+	r.HandleFunc("/readyz", ok)
+	r.HandleFunc("/metrics", ok)
+	r.HandleFunc("/api/v1/pedidos/{id}", ok)
+
+	for _, ruta := range []string{"/healthz", "/readyz", "/metrics", "/api/v1/pedidos/7"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, ruta, nil))
+	}
+
+	spans := exp.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("se esperaba 1 span, hay %d: %v", len(spans), spans.Snapshots())
+	}
+	if spans[0].Name != "/api/v1/pedidos/{id}" {
+		t.Errorf("span = %q", spans[0].Name)
+	}
+}
+
+func TestExportadorDesdeEnv(t *testing.T) {
+	casos := []struct {
+		nombre, exportador, endpoint, esperado string
+	}{
+		{"sin configurar", "", "", "none"},
+		{"con endpoint", "", "http://colector:4318", "otlp"},
+		{"explicito gana", " STDOUT ", "http://colector:4318", "stdout"},
+		{"apagado", "none", "http://colector:4318", "none"},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			t.Setenv("OTEL_TRACES_EXPORTER", c.exportador)
+			t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", c.endpoint)
+			t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+			if got := exportadorDesdeEnv(); got != c.esperado {
+				t.Errorf("exportadorDesdeEnv() = %q, se esperaba %q", got, c.esperado)
+			}
+		})
+	}
+}
+
+func TestNuevoExportador(t *testing.T) {
+	ctx := context.Background()
+	if exp, err := nuevoExportador(ctx, "none"); err != nil || exp != nil {
+		t.Errorf("none = %v, %v", exp, err)
+	}
+	exp, err := nuevoExportador(ctx, "stdout")
+	if err != nil || exp == nil {
+		t.Fatalf("stdout = %v, %v", exp, err)
+	}
+	_ = exp.Shutdown(ctx)
+	if _, err := nuevoExportador(ctx, "jaeger"); err == nil {
+		t.Error("un exportador desconocido no regresó error")
+	}
+}
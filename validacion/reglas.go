@@ -0,0 +1,350 @@
+package validacion
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+)
+
+type fallo struct {
+	codigo errores.CodigoCampo
+	args   []any
+}
+
+// regla revisa un valor ya sin punteros y regresa nil si lo acepta.
+type regla func(reflect.Value) *fallo
+
+type campo struct {
+	indice    []int
+	nombre    string
+	requerido bool
+	reglas    []regla
+	anidado   bool // estructura o arreglo de estructuras con reglas propias
+}
+
+type descripcion struct {
+	campos []campo
+}
+
+var descripciones sync.Map // reflect.Type -> *descripcion
+
+// describir lee las etiquetas de t una sola vez.
+func describir(t reflect.Type) *descripcion {
+	if d, ok := descripciones.Load(t); ok {
+		return d.(*descripcion)
+	}
+	d := &descripcion{}
+	agregarCampos(d, t, nil, "")
+	real, _ := descripciones.LoadOrStore(t, d)
+	return real.(*descripcion)
+}
+
+func agregarCampos(d *descripcion, t reflect.Type, indice []int, prefijo string) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		idx := append(append([]int(nil), indice...), i)
+		nombre, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if nombre == "-" {
+			continue
+		}
+		base := sinPunteros(f.Type)
+		// Estructura embebida sin nombre en el JSON: sus campos se promueven,
+		// igual que en encoding/json, aunque el tipo no sea exportado.
+		if f.Anonymous && nombre == "" && f.Type.Kind() == reflect.Struct {
+			agregarCampos(d, base, idx, prefijo)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if nombre == "" {
+			nombre = f.Name
+		}
+		c := campo{indice: idx, nombre: prefijo + nombre}
+		for _, def := range strings.Split(f.Tag.Get("valida"), ",") {
+			if def = strings.TrimSpace(def); def == "" {
+				continue
+			}
+			if def == "requerido" {
+				c.requerido = true
+				continue
+			}
+			c.reglas = append(c.reglas, construir(t, f, base, def))
+		}
+		switch {
+		case base.Kind() == reflect.Struct:
+			c.anidado = tieneReglas(base, map[reflect.Type]bool{})
+		case base.Kind() == reflect.Slice && sinPunteros(base.Elem()).Kind() == reflect.Struct:
+			c.anidado = tieneReglas(sinPunteros(base.Elem()), map[reflect.Type]bool{})
+		}
+		if c.requerido || len(c.reglas) > 0 || c.anidado {
+			d.campos = append(d.campos, c)
+		}
+	}
+}
+
+// tieneReglas evita recorrer estructuras sin etiquetas (sql.NullString,
+// time.Time, ...).
+func tieneReglas(t reflect.Type, vistos map[reflect.Type]bool) bool {
+	if vistos[t] {
+		return false
+	}
+	vistos[t] = true
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if f.Tag.Get("valida") != "" {
+			return true
+		}
+		base := sinPunteros(f.Type)
+		if base.Kind() == reflect.Slice {
+			base = sinPunteros(base.Elem())
+		}
+		if base.Kind() == reflect.Struct && tieneReglas(base, vistos) {
+			return true
+		}
+	}
+	return false
+}
+
+func sinPunteros(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// construir traduce una regla de la etiqueta; los errores de escritura son
+// errores de programación y se reportan con panic.
+func construir(padre reflect.Type, f reflect.StructField, t reflect.Type, def string) regla {
+	nombre, arg, _ := strings.Cut(def, "=")
+	mal := func(motivo string) {
+		panic(fmt.Sprintf("validacion: %s.%s: regla %q: %s", padre, f.Name, def, motivo))
+	}
+	texto := func() {
+		if t.Kind() != reflect.String {
+			mal("sólo aplica a texto")
+		}
+	}
+	numero := func() {
+		if !esNumero(t.Kind()) {
+			mal("sólo aplica a números")
+		}
+	}
+	entero := func(s string) int {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			mal("se esperaba un entero no negativo")
+		}
+		return n
+	}
+
+	switch nombre {
+	case "correo":
+		texto()
+		return formato(errores.CampoCorreo, EsCorreo)
+	case "rfc":
+		texto()
+		return formato(errores.CampoRFC, EsRFC)
+	case "cp":
+		texto()
+		return formato(errores.CampoCodigoPostal, EsCodigoPostal)
+	case "telefono":
+		texto()
+		return formato(errores.CampoTelefono, EsTelefono)
+	case "hora":
+		texto()
+		return formato(errores.CampoFormatoFecha, EsHora, "HH:MM")
+	case "fecha":
+		texto()
+		return formato(errores.CampoFormatoFecha, EsFecha, "YYYY-MM-DD")
+	case "min":
+		texto()
+		n := entero(arg)
+		return func(v reflect.Value) *fallo {
+			if utf8.RuneCountInString(v.String()) < n {
+				return &fallo{errores.CampoMuyCorto, []any{n}}
+			}
+			return nil
+		}
+	case "max":
+		texto()
+		n := entero(arg)
+		return func(v reflect.Value) *fallo {
+			if utf8.RuneCountInString(v.String()) > n {
+				return &fallo{errores.CampoMuyLargo, []any{n}}
+			}
+			return nil
+		}
+	case "uno_de":
+		texto()
+		valores := strings.Split(arg, "|")
+		if arg == "" {
+			mal("sin valores")
+		}
+		lista := strings.Join(valores, ", ")
+		return func(v reflect.Value) *fallo {
+			for _, x := range valores {
+				if v.String() == x {
+					return nil
+				}
+			}
+			return &fallo{errores.CampoNoPermitido, []any{lista}}
+		}
+	case "rango":
+		numero()
+		a, b, ok := strings.Cut(arg, ":")
+		desde, err1 := strconv.ParseFloat(a, 64)
+		hasta, err2 := strconv.ParseFloat(b, 64)
+		if !ok || err1 != nil || err2 != nil || desde > hasta {
+			mal("se esperaba rango=A:B")
+		}
+		return rango(desde, hasta)
+	case "latitud":
+		numero()
+		return rango(-90, 90)
+	case "longitud":
+		numero()
+		return rango(-180, 180)
+	case "mayor_cero":
+		numero()
+		return func(v reflect.Value) *fallo {
+			if aFloat(v) <= 0 {
+				return &fallo{codigo: errores.CampoMayorACero}
+			}
+			return nil
+		}
+	case "no_negativo":
+		numero()
+		return func(v reflect.Value) *fallo {
+			if aFloat(v) < 0 {
+				return &fallo{codigo: errores.CampoNoNegativo}
+			}
+			return nil
+		}
+	}
+	mal("regla desconocida")
+	return nil
+}
+
+func formato(c errores.CodigoCampo, valido func(string) bool, args ...any) regla {
+	return func(v reflect.Value) *fallo {
+		if !valido(v.String()) {
+			return &fallo{c, args}
+		}
+		return nil
+	}
+}
+
+func rango(desde, hasta float64) regla {
+	return func(v reflect.Value) *fallo {
+		if x := aFloat(v); x < desde || x > hasta {
+			return &fallo{errores.CampoFueraDeRango, []any{desde, hasta}}
+		}
+		return nil
+	}
+}
+
+func esNumero(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func aFloat(v reflect.Value) float64 {
+	switch {
+	case v.CanInt():
+		return float64(v.Int())
+	case v.CanUint():
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
+
+// ---------------------------
+// VALIDADORES DE FORMATO
+// ---------------------------
+
+// EsCorreo acepta una dirección simple (usuario@dominio), sin nombre para
+// mostrar ni espacios.
+func EsCorreo(s string) bool {
+	a, err := mail.ParseAddress(s)
+	return err == nil && a.Address == s && strings.Contains(s[strings.LastIndex(s, "@"):], ".")
+}
+
+var patronRFC = regexp.MustCompile(`^([A-ZÑ&]{3,4})([0-9]{6})([A-Z0-9]{3})$`)
+
+// EsRFC acepta el RFC de persona moral (3 letras) o física (4 letras) con
+// homoclave, en mayúsculas o minúsculas. La fecha debe existir; el dígito
+// verificador de la homoclave no se revisa.
+func EsRFC(s string) bool {
+	m := patronRFC.FindStringSubmatch(strings.ToUpper(s))
+	if m == nil {
+		return false
+	}
+	_, err := time.Parse("060102", m[2])
+	return err == nil
+}
+
+// EsCodigoPostal acepta los códigos postales de SEPOMEX: 5 dígitos, sin
+// empezar en 00.
+func EsCodigoPostal(s string) bool {
+	if len(s) != 5 || strings.HasPrefix(s, "00") {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// EsTelefono acepta un número nacional de 10 dígitos, opcionalmente con +52 o
+// 52 adelante y separado con espacios, guiones, puntos o paréntesis.
+func EsTelefono(s string) bool {
+	var digitos strings.Builder
+	for i, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			digitos.WriteRune(c)
+		case c == '+' && i == 0:
+		case strings.ContainsRune(" -.()", c):
+		default:
+			return false
+		}
+	}
+	d := digitos.String()
+	if len(d) == 12 && strings.HasPrefix(d, "52") {
+		d = d[2:]
+	} else if strings.HasPrefix(s, "+") {
+		return false
+	}
+	return len(d) == 10
+}
+
+// EsHora acepta HH:MM de 00:00 a 23:59.
+func EsHora(s string) bool {
+	_, err := time.Parse("15:04", s)
+	return err == nil && len(s) == 5
+}
+
+// EsFecha acepta YYYY-MM-DD con una fecha que exista.
+func EsFecha(s string) bool {
+	_, err := time.Parse("2006-01-02", s)
+	return err == nil
+}
@@ -0,0 +1,187 @@
+// Package validacion lee cuerpos JSON de forma estricta y valida sus campos
+// con reglas declaradas en la etiqueta `valida`:
+//
+//	type UsuarioRequest struct {
+//		Correo   string `json:"correo" valida:"requerido,correo"`
+//		Telefono string `json:"telefono" valida:"telefono"`
+//	}
+//
+// Las reglas no se aplican a textos vacíos, punteros nil ni arreglos vacíos;
+// para exigirlos se agrega "requerido". Los números sí se revisan aunque
+// valgan 0, así "mayor_cero" rechaza una cantidad que no vino en el JSON. Las
+// estructuras anidadas y los arreglos de estructuras se recorren siempre y los
+// campos se nombran como en el JSON ("tienda.rfc", "detalles[0].cantidad").
+// Todas las fallas salen juntas en un error VALIDACION de errores.
+//
+// Reglas:
+//
+//	requerido      distinto del valor cero; en arreglos, al menos un elemento
+//	correo         dirección de correo sin nombre para mostrar
+//	rfc            RFC de persona física o moral con fecha válida
+//	cp             código postal de 5 dígitos
+//	telefono       10 dígitos; admite espacios, guiones, paréntesis y +52
+//	hora           HH:MM en formato de 24 horas
+//	fecha          YYYY-MM-DD
+//	min=N, max=N   longitud del texto en caracteres
+//	rango=A:B      número entre A y B inclusive
+//	mayor_cero     número mayor a 0
+//	no_negativo    número mayor o igual a 0
+//	latitud        número entre -90 y 90
+//	longitud       número entre -180 y 180
+//	uno_de=a|b     texto igual a alguno de los valores
+//
+// Una regla mal escrita o aplicada a un tipo que no le corresponde provoca
+// panic la primera vez que se valida el tipo.
+package validacion
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+)
+
+// TamanoMaximo es el límite del cuerpo que acepta Leer.
+const TamanoMaximo = 1 << 20
+
+// Decodificar lee el cuerpo en dst con Leer y lo valida. El error, si hay, es
+// un *errores.Error listo para errores.Escribir.
+func Decodificar(w http.ResponseWriter, r *http.Request, dst any) error {
+	if err := Leer(w, r, dst); err != nil {
+		return err
+	}
+	if campos := Validar(dst); len(campos) > 0 {
+		return errores.Validacion(campos...)
+	}
+	return nil
+}
+
+// Leer decodifica el cuerpo en dst sin validar reglas: rechaza campos que dst
+// no declara, tipos incorrectos, datos después del JSON y cuerpos de más de
+// TamanoMaximo. Sirve cuando el handler ajusta valores antes de Validar.
+func Leer(w http.ResponseWriter, r *http.Request, dst any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, TamanoMaximo))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return errorLectura(err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		if err == nil {
+			err = errors.New("datos después del JSON")
+		}
+		return errorLectura(err)
+	}
+	return nil
+}
+
+func errorLectura(err error) *errores.Error {
+	var (
+		grande *http.MaxBytesError
+		tipo   *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &grande):
+		return errores.Nuevo(errores.CuerpoMuyGrande).Con("Cuerpo demasiado grande", err)
+	case errors.As(err, &tipo) && tipo.Field != "":
+		return errores.Validacion(errores.NuevoCampo(nombreCampo(tipo.Field), errores.CampoTipoInvalido)).Con("Tipo de dato incorrecto", err)
+	}
+	if campo, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return errores.Validacion(errores.NuevoCampo(strings.Trim(campo, `"`), errores.CampoDesconocido)).Con("Campo desconocido", err)
+	}
+	return errores.Nuevo(errores.JSONInvalido).Con("Datos inválidos", err)
+}
+
+// nombreCampo pasa la ruta de encoding/json ("detalles.0.cantidad") a la
+// forma de los errores de campo ("detalles[0].cantidad").
+func nombreCampo(ruta string) string {
+	var b strings.Builder
+	for i, parte := range strings.Split(ruta, ".") {
+		if _, err := strconv.Atoi(parte); err == nil {
+			b.WriteString("[" + parte + "]")
+			continue
+		}
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(parte)
+	}
+	return b.String()
+}
+
+// Validar aplica las reglas de v (estructura o puntero a estructura) y
+// regresa los campos que no las cumplen, en el orden en que se declaran.
+func Validar(v any) []errores.Campo {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validacion: %T no es una estructura", v))
+	}
+	var campos []errores.Campo
+	validarEstructura(rv, "", &campos)
+	return campos
+}
+
+func validarEstructura(rv reflect.Value, prefijo string, campos *[]errores.Campo) {
+	for _, c := range describir(rv.Type()).campos {
+		nombre := prefijo + c.nombre
+		v := rv.FieldByIndex(c.indice)
+		if c.requerido && (v.IsZero() || (v.Kind() == reflect.Slice && v.Len() == 0)) {
+			codigo := errores.CampoRequerido
+			if v.Kind() == reflect.Slice {
+				codigo = errores.CampoSinElementos
+			}
+			*campos = append(*campos, errores.NuevoCampo(nombre, codigo))
+			continue
+		}
+		if vacio(v) {
+			continue
+		}
+		for v.Kind() == reflect.Pointer {
+			v = v.Elem()
+		}
+		for _, regla := range c.reglas {
+			if fallo := regla(v); fallo != nil {
+				*campos = append(*campos, errores.NuevoCampo(nombre, fallo.codigo, fallo.args...))
+				break
+			}
+		}
+		if !c.anidado {
+			continue
+		}
+		if v.Kind() == reflect.Struct {
+			validarEstructura(v, nombre+".", campos)
+			continue
+		}
+		for i := range v.Len() {
+			e := v.Index(i)
+			if e.Kind() == reflect.Pointer {
+				if e.IsNil() {
+					continue
+				}
+				e = e.Elem()
+			}
+			validarEstructura(e, fmt.Sprintf("%s[%d].", nombre, i), campos)
+		}
+	}
+}
+
+func vacio(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
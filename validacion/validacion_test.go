@@ -0,0 +1,205 @@
+package validacion
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/WolfSlayer04/logica_tiendaenlina/errores"
+)
+
+type detalle struct {
+	Cantidad float64  `json:"cantidad" valida:"mayor_cero"`
+	Precio   *float64 `json:"precio" valida:"no_negativo"`
+}
+
+type horario struct {
+	Inicio string `json:"inicio" valida:"requerido,hora"`
+}
+
+type base struct {
+	Pais string `json:"pais" valida:"uno_de=México|USA"`
+}
+
+type solicitud struct {
+	base
+	Correo    string    `json:"correo" valida:"requerido,correo"`
+	Clave     string    `json:"clave" valida:"requerido,min=8,max=20"`
+	RFC       string    `json:"rfc" valida:"rfc"`
+	CP        string    `json:"cp" valida:"cp"`
+	Telefono  string    `json:"telefono" valida:"telefono"`
+	Fecha     string    `json:"fecha" valida:"fecha"`
+	Lista     int       `json:"lista" valida:"rango=1:25"`
+	Latitud   *float64  `json:"latitud" valida:"latitud"`
+	Detalles  []detalle `json:"detalles" valida:"requerido"`
+	Horario   *horario  `json:"horario"`
+	SinReglas struct {
+		Nota string `json:"nota"`
+	} `json:"sin_reglas"`
+	Ignorado string `json:"-" valida:"requerido"`
+}
+
+func TestValidar(t *testing.T) {
+	lat := 91.0
+	neg := -1.0
+	casos := []struct {
+		nombre string
+		s      solicitud
+		campos []string
+	}{
+		{
+			nombre: "vacía",
+			campos: []string{"correo:REQUERIDO", "clave:REQUERIDO", "lista:FUERA_DE_RANGO", "detalles:SIN_ELEMENTOS"},
+		},
+		{
+			nombre: "válida",
+			s: solicitud{
+				base:   base{Pais: "México"},
+				Correo: "ana@example.com", Clave: "secreta12", RFC: "GODE561231GR8", CP: "97000",
+				Telefono: "+52 (999) 123-4567", Fecha: "2026-02-28", Lista: 25,
+				Detalles: []detalle{{Cantidad: 1}}, Horario: &horario{Inicio: "09:30"},
+			},
+		},
+		{
+			nombre: "formatos",
+			s: solicitud{
+				base:   base{Pais: "Canadá"},
+				Correo: "Ana <ana@example.com>", Clave: "corta", RFC: "GODE561331GR8", CP: "00123",
+				Telefono: "999 123 456", Fecha: "2026-02-30", Lista: 26, Latitud: &lat,
+				Detalles: []detalle{{Cantidad: 1}, {Cantidad: 0, Precio: &neg}}, Horario: &horario{Inicio: "24:00"},
+			},
+			campos: []string{
+				"pais:NO_PERMITIDO", "correo:CORREO", "clave:MUY_CORTO", "rfc:RFC", "cp:CODIGO_POSTAL", "telefono:TELEFONO",
+				"fecha:FORMATO_FECHA", "lista:FUERA_DE_RANGO", "latitud:FUERA_DE_RANGO",
+				"detalles[1].cantidad:MAYOR_A_CERO", "detalles[1].precio:NO_NEGATIVO", "horario.inicio:FORMATO_FECHA",
+			},
+		},
+		{
+			nombre: "anidado requerido",
+			s: solicitud{
+				Correo: "ana@example.com", Clave: strings.Repeat("x", 21), Lista: 1,
+				Detalles: []detalle{{Cantidad: 2}}, Horario: &horario{},
+			},
+			campos: []string{"clave:MUY_LARGO", "horario.inicio:REQUERIDO"},
+		},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			var got []string
+			for _, f := range Validar(&c.s) {
+				got = append(got, f.Campo+":"+string(f.Codigo))
+			}
+			if strings.Join(got, ",") != strings.Join(c.campos, ",") {
+				t.Errorf("campos = %v\nse esperaba %v", got, c.campos)
+			}
+		})
+	}
+}
+
+func TestValidadores(t *testing.T) {
+	casos := []struct {
+		nombre   string
+		f        func(string) bool
+		validos  []string
+		invalido []string
+	}{
+		{"correo", EsCorreo, []string{"ana@example.com", "a.b+c@sub.example.mx"}, []string{"ana", "ana@", "ana@localhost", "Ana <ana@example.com>", " ana@example.com"}},
+		{"rfc", EsRFC, []string{"GODE561231GR8", "ABC680524P76", "XAXX010101000", "gode561231gr8", "ÑAÑ000229AB1"}, []string{"GODE56123GR8", "GODE561232GR8", "AB680524P76", "GODE561231GR", "ABC010229AB1"}},
+		{"cp", EsCodigoPostal, []string{"97000", "01000", "99999"}, []string{"9700", "970000", "00500", "97a00"}},
+		{"telefono", EsTelefono, []string{"9991234567", "999 123 4567", "(999) 123-45-67", "+52 999 123 4567", "529991234567"}, []string{"123456789", "+1 999 123 4567", "999-123-4567 ext 2", "99912345678"}},
+		{"hora", EsHora, []string{"00:00", "09:05", "23:59"}, []string{"9:05", "24:00", "12:60", "12:00:00"}},
+		{"fecha", EsFecha, []string{"2024-02-29"}, []string{"2025-02-29", "29/02/2024", "2024-2-9"}},
+	}
+	for _, c := range casos {
+		for _, s := range c.validos {
+			if !c.f(s) {
+				t.Errorf("%s: %q debería ser válido", c.nombre, s)
+			}
+		}
+		for _, s := range c.invalido {
+			if c.f(s) {
+				t.Errorf("%s: %q debería ser inválido", c.nombre, s)
+			}
+		}
+	}
+}
+
+func TestDecodificar(t *testing.T) {
+	type pedido struct {
+		IDTienda int       `json:"id_tienda" valida:"requerido"`
+		Detalles []detalle `json:"detalles"`
+	}
+	casos := []struct {
+		nombre string
+		body   string
+		status int
+		codigo errores.Codigo
+		campo  string
+	}{
+		{nombre: "válido", body: `{"id_tienda": 1, "detalles": [{"cantidad": 2}]}`},
+		{nombre: "reglas", body: `{"detalles": [{"cantidad": 0}]}`, status: 400, codigo: errores.ValidacionFallida, campo: "id_tienda"},
+		{nombre: "campo desconocido", body: `{"id_tienda": 1, "id_tiend": 2}`, status: 400, codigo: errores.ValidacionFallida, campo: "id_tiend:DESCONOCIDO"},
+		{nombre: "tipo incorrecto", body: `{"id_tienda": "1"}`, status: 400, codigo: errores.ValidacionFallida, campo: "id_tienda:TIPO_INVALIDO"},
+		{nombre: "tipo incorrecto anidado", body: `{"id_tienda": 1, "detalles": [{"cantidad": "x"}]}`, status: 400, codigo: errores.ValidacionFallida, campo: "detalles[0].cantidad:TIPO_INVALIDO"},
+		{nombre: "sintaxis", body: `{"id_tienda": `, status: 400, codigo: errores.JSONInvalido},
+		{nombre: "vacío", body: ``, status: 400, codigo: errores.JSONInvalido},
+		{nombre: "datos extra", body: `{"id_tienda": 1} {"id_tienda": 2}`, status: 400, codigo: errores.JSONInvalido},
+		{nombre: "muy grande", body: `{"id_tienda": 1, "detalles": [` + strings.Repeat(`{"cantidad": 1},`, TamanoMaximo/16) + `{"cantidad": 1}]}`, status: 413, codigo: errores.CuerpoMuyGrande},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			var p pedido
+			rec := httptest.NewRecorder()
+			err := Decodificar(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(c.body)), &p)
+			if c.status == 0 {
+				if err != nil {
+					t.Fatalf("error inesperado: %v", err)
+				}
+				return
+			}
+			var e *errores.Error
+			if !errors.As(err, &e) {
+				t.Fatalf("err = %v, se esperaba *errores.Error", err)
+			}
+			if e.Estatus() != c.status || e.Codigo != c.codigo {
+				t.Errorf("estatus %d, código %s", e.Estatus(), e.Codigo)
+			}
+			if c.campo == "" {
+				return
+			}
+			nombre, codigo, _ := strings.Cut(c.campo, ":")
+			if len(e.Campos) == 0 || e.Campos[0].Campo != nombre || (codigo != "" && string(e.Campos[0].Codigo) != codigo) {
+				t.Errorf("campos = %+v, se esperaba %s", e.Campos, c.campo)
+			}
+		})
+	}
+}
+
+func TestReglaMalEscrita(t *testing.T) {
+	casos := []any{
+		&struct {
+			N int `valida:"correo"`
+		}{},
+		&struct {
+			S string `valida:"mayor_cero"`
+		}{},
+		&struct {
+			S string `valida:"obligatorio"`
+		}{},
+		&struct {
+			N int `valida:"rango=5"`
+		}{},
+	}
+	for i, v := range casos {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("caso %d: se esperaba panic", i)
+				}
+			}()
+			Validar(v)
+		}()
+	}
+}
@@ -0,0 +1,90 @@
+// Package versiones agrupa las rutas de la API por versión. Cada versión es
+// un subrouter con su prefijo (/api/v1, /api/v2); las rutas sin versión
+// (/api/...) se montan como alias de v1 para no romper la app móvil ya
+// instalada y responden con las cabeceras Deprecation, Sunset y Link
+// (RFC 9745 y RFC 8594) para que los clientes migren antes del retiro.
+//
+// Un endpoint rediseñado se registra sólo en la versión nueva; la anterior
+// sigue respondiendo igual hasta que se retire.
+package versiones
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Prefijos de las versiones publicadas.
+const (
+	Legado = "/api"
+	V1     = "/api/v1"
+	V2     = "/api/v2"
+)
+
+// Aviso describe la obsolescencia de un grupo de rutas.
+type Aviso struct {
+	// Desde es la fecha en que se marcó obsoleta (cabecera Deprecation).
+	Desde time.Time
+	// Retiro es la fecha en que dejará de responder (cabecera Sunset); cero
+	// si todavía no hay fecha.
+	Retiro time.Time
+	// Sucesor regresa la ruta que reemplaza a la de la petición (Link con
+	// rel="successor-version"); nil o "" si no hay.
+	Sucesor func(*http.Request) string
+}
+
+// Montar crea el subrouter de prefijo y registra en él las rutas.
+func Montar(r *mux.Router, prefijo string, registrar func(*mux.Router)) *mux.Router {
+	sub := r.PathPrefix(prefijo).Subrouter()
+	registrar(sub)
+	return sub
+}
+
+// Alias registra otra vez las rutas bajo prefijo, marcadas como obsoletas.
+// Debe montarse después de las versiones cuyo prefijo empiece igual.
+func Alias(r *mux.Router, prefijo string, registrar func(*mux.Router), aviso Aviso) *mux.Router {
+	sub := r.PathPrefix(prefijo).Subrouter()
+	sub.Use(Obsoleta(aviso))
+	registrar(sub)
+	return sub
+}
+
+// Obsoleta agrega las cabeceras del aviso a todas las respuestas, errores
+// incluidos.
+func Obsoleta(aviso Aviso) mux.MiddlewareFunc {
+	deprecation := "@" + strconv.FormatInt(aviso.Desde.Unix(), 10)
+	var sunset string
+	if !aviso.Retiro.IsZero() {
+		sunset = aviso.Retiro.UTC().Format(http.TimeFormat)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("Deprecation", deprecation)
+			if sunset != "" {
+				h.Set("Sunset", sunset)
+			}
+			if aviso.Sucesor != nil {
+				if s := aviso.Sucesor(r); s != "" {
+					h.Add("Link", "<"+s+`>; rel="successor-version"`)
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CambiarPrefijo es un Sucesor que apunta a la misma ruta bajo otro prefijo
+// (p. ej. /api/productos -> /api/v1/productos).
+func CambiarPrefijo(de, a string) func(*http.Request) string {
+	return func(r *http.Request) string {
+		resto, ok := strings.CutPrefix(r.URL.Path, de)
+		if !ok {
+			return ""
+		}
+		return a + resto
+	}
+}
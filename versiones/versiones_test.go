@@ -0,0 +1,76 @@
+package versiones
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestAlias(t *testing.T) {
+	aviso := Aviso{
+		Desde:   time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+		Retiro:  time.Date(2027, 4, 30, 0, 0, 0, 0, time.UTC),
+		Sucesor: CambiarPrefijo(Legado, V1),
+	}
+	rutas := func(api *mux.Router) {
+		api.HandleFunc("/productos/{id}", func(w http.ResponseWriter, r *http.Request) {
+			plantilla, _ := mux.CurrentRoute(r).GetPathTemplate()
+			w.Write([]byte(plantilla))
+		}).Methods("GET")
+	}
+	r := mux.NewRouter()
+	Montar(r, V2, func(api *mux.Router) {
+		api.HandleFunc("/productos", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("v2")) }).Methods("GET")
+	})
+	Montar(r, V1, rutas)
+	Alias(r, Legado, rutas, aviso)
+
+	casos := []struct {
+		url, cuerpo, deprecation, sunset, link string
+		status                                 int
+	}{
+		{url: "/api/v1/productos/7", cuerpo: "/api/v1/productos/{id}", status: http.StatusOK},
+		{url: "/api/v2/productos", cuerpo: "v2", status: http.StatusOK},
+		{
+			url: "/api/productos/7", cuerpo: "/api/productos/{id}", status: http.StatusOK,
+			deprecation: "@1792368000", sunset: "Fri, 30 Apr 2027 00:00:00 GMT", link: `</api/v1/productos/7>; rel="successor-version"`,
+		},
+		{url: "/api/v1/pedidos", status: http.StatusNotFound},
+		{url: "/api/v2/productos/7", status: http.StatusNotFound},
+	}
+	for _, c := range casos {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, c.url, nil))
+		if rec.Code != c.status {
+			t.Errorf("%s: status = %d, se esperaba %d", c.url, rec.Code, c.status)
+			continue
+		}
+		if c.cuerpo != "" && rec.Body.String() != c.cuerpo {
+			t.Errorf("%s: respondió %q, se esperaba %q", c.url, rec.Body, c.cuerpo)
+		}
+		h := rec.Header()
+		if h.Get("Deprecation") != c.deprecation || h.Get("Sunset") != c.sunset || h.Get("Link") != c.link {
+			t.Errorf("%s: Deprecation %q, Sunset %q, Link %q", c.url, h.Get("Deprecation"), h.Get("Sunset"), h.Get("Link"))
+		}
+	}
+}
+
+func TestObsoletaSinRetiroNiSucesor(t *testing.T) {
+	h := Obsoleta(Aviso{Desde: time.Unix(1700000000, 0)})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/perfil", nil))
+	if rec.Header().Get("Deprecation") != "@1700000000" {
+		t.Errorf("Deprecation = %q", rec.Header().Get("Deprecation"))
+	}
+	if _, ok := rec.Header()["Sunset"]; ok {
+		t.Error("Sunset sin fecha de retiro")
+	}
+	if _, ok := rec.Header()["Link"]; ok {
+		t.Error("Link sin sucesor")
+	}
+}